@@ -0,0 +1,549 @@
+// archive.go – aging policies for videos left unwatched.
+//
+// An archive policy picks videos by tag and type, such as home videos or
+// downloaded YouTube videos, and keeps them for good or, once they have
+// gone its number of days without being added or played, moves them to
+// another directory (cold storage) or to the trash. Every archiveCheckEvery
+// the server works out what the policies pick and records it as proposals
+// for an admin to approve in Settings; nothing moves before then. A video a
+// keep policy picks is never proposed, and one several other policies pick
+// goes to the one due soonest. Dismissing a proposal keeps the video where
+// it is until the policy stops picking it, for instance because it was
+// played. Approving runs the policies again first, as of when the proposal
+// was made but with what is known now: a video played, added or kept since
+// is no longer picked, and its proposal is dropped instead.
+//
+// The trash is a folder named archiveTrashDir at the top of the video's
+// directory. Scans skip it and trashed videos leave the library; emptying
+// it is left to the admin.
+//
+// GET    /archive                         – policies and proposals (settings panel)
+// POST   /archive/policies                – save a policy (form values name, tag_id, type, action, days, dir_id)
+// DELETE /archive/policies/{id}           – remove a policy and its proposals
+// POST   /archive/check                   – work out the proposals now
+// POST   /archive/proposals/approve       – carry out every proposal not dismissed, in the background
+// POST   /archive/proposals/{id}/approve  – carry out a video's proposal
+// POST   /archive/proposals/{id}/dismiss  – keep the video
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// archiveTrashDir is the trash folder at the top of each directory.
+const archiveTrashDir = ".vm_trash"
+
+// archivePolicyRow is a policy in the settings panel.
+type archivePolicyRow struct {
+	store.ArchivePolicy
+	Summary string // the policy in words
+}
+
+// archiveProposalRow is a proposal in the settings panel.
+type archiveProposalRow struct {
+	store.ArchiveProposal
+	Video  store.Video
+	Policy store.ArchivePolicy
+	Action string // what approving does, in words
+}
+
+// archivePanel is the data behind archive.html.
+type archivePanel struct {
+	Policies    []archivePolicyRow
+	Proposals   []archiveProposalRow
+	Tags        []store.TagCount // plain tags, for the policy form
+	Directories []store.Directory
+	Running     bool // approving every proposal is under way
+	Error       string
+}
+
+// describeArchivePolicy puts p in words, naming its tag and directory.
+func (s *server) describeArchivePolicy(ctx context.Context, p store.ArchivePolicy) string {
+	var which []string
+	if p.VideoType != "" {
+		which = append(which, p.VideoType)
+	}
+	if p.TagID != 0 {
+		if t, err := s.store.GetTag(ctx, p.TagID); err == nil {
+			which = append(which, "tagged "+t.Name)
+		}
+	}
+	videos := "every video"
+	if len(which) > 0 {
+		videos = "videos " + strings.Join(which, ", ")
+	}
+	switch p.Action {
+	case store.ArchiveKeep:
+		return videos + ": never touch"
+	case store.ArchiveMove:
+		to := "a removed directory"
+		if d, err := s.store.GetDirectory(ctx, p.DirectoryID); err == nil {
+			to = d.Path
+		}
+		return fmt.Sprintf("%s: move to %s after %d days unwatched", videos, to, p.Days)
+	default:
+		return fmt.Sprintf("%s: trash after %d days unwatched", videos, p.Days)
+	}
+}
+
+func (s *server) renderArchive(w http.ResponseWriter, r *http.Request, data archivePanel) {
+	ctx := r.Context()
+	policies, err := s.store.ListArchivePolicies(ctx)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	byID := map[int64]store.ArchivePolicy{}
+	for _, p := range policies {
+		byID[p.ID] = p
+		data.Policies = append(data.Policies, archivePolicyRow{p, s.describeArchivePolicy(ctx, p)})
+	}
+	proposals, err := s.store.ListArchiveProposals(ctx)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	for _, p := range proposals {
+		v, err := s.store.GetVideo(ctx, p.VideoID)
+		if err != nil {
+			continue
+		}
+		row := archiveProposalRow{ArchiveProposal: p, Video: v, Policy: byID[p.PolicyID], Action: "Trash"}
+		if row.Policy.Action == store.ArchiveMove {
+			row.Action = "Move to cold storage"
+			if d, err := s.store.GetDirectory(ctx, row.Policy.DirectoryID); err == nil {
+				row.Action = "Move to " + d.Path
+			}
+		}
+		data.Proposals = append(data.Proposals, row)
+	}
+	if data.Tags, err = s.store.ListTagCounts(ctx); err != nil {
+		storeError(w, err)
+		return
+	}
+	if data.Directories, err = s.store.ListDirectories(ctx); err != nil {
+		storeError(w, err)
+		return
+	}
+	data.Running = data.Running || s.archiving.Load()
+	render(w, "archive.html", data)
+}
+
+// archivePicks works out what the policies pick at now: the ID of the
+// policy proposing each video, by video ID.
+func (s *server) archivePicks(ctx context.Context, now time.Time) (map[int64]int64, error) {
+	policies, err := s.store.ListArchivePolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keep := map[int64]bool{}
+	var due []store.ArchivePolicy
+	for _, p := range policies {
+		if p.Action != store.ArchiveKeep {
+			due = append(due, p)
+			continue
+		}
+		videos, _, err := s.store.ListVideosPage(ctx, store.VideoQuery{TagID: p.TagID, Type: p.VideoType, Companions: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range videos {
+			keep[v.ID] = true
+		}
+	}
+	// Soonest due first, so of two policies picking a video the one with
+	// fewer days has it.
+	slices.SortStableFunc(due, func(a, b store.ArchivePolicy) int { return a.Days - b.Days })
+	picks := map[int64]int64{}
+	for _, p := range due {
+		videos, err := s.store.ListIdleVideos(ctx, p.TagID, p.VideoType, now.AddDate(0, 0, -p.Days))
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range videos {
+			if keep[v.ID] || picks[v.ID] != 0 {
+				continue
+			}
+			// Already in cold storage; a later policy may still trash it.
+			if p.Action == store.ArchiveMove && v.DirectoryID == p.DirectoryID {
+				continue
+			}
+			picks[v.ID] = p.ID
+		}
+	}
+	return picks, nil
+}
+
+// checkArchive records what the policies pick at now as the proposals and
+// tells the admins about new ones.
+func (s *server) checkArchive(ctx context.Context, now time.Time) error {
+	picks, err := s.archivePicks(ctx, now)
+	if err != nil {
+		return err
+	}
+	before, err := s.store.ListArchiveProposals(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.store.SetArchiveProposals(ctx, picks, now); err != nil {
+		return err
+	}
+	fresh := len(picks)
+	for _, p := range before {
+		if picks[p.VideoID] == p.PolicyID {
+			fresh--
+		}
+	}
+	switch {
+	case fresh == 1:
+		s.notifyAdmins(store.NotifyArchive, "A video is due to be archived; review it in Settings", 0)
+	case fresh > 1:
+		s.notifyAdmins(store.NotifyArchive, fmt.Sprintf("%d videos are due to be archived; review them in Settings", fresh), 0)
+	}
+	return nil
+}
+
+// startArchiver checks the archive policies every archiveCheckEvery until
+// ctx is cancelled.
+func (s *server) startArchiver(ctx context.Context) {
+	ticker := time.NewTicker(archiveCheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if s.maintenance.Load() {
+				continue
+			}
+			if err := s.checkArchive(ctx, now); err != nil {
+				slog.Warn("archive check failed", "err", err)
+			}
+		}
+	}
+}
+
+// errArchiveStale is returned for a proposal its policy no longer picks.
+var errArchiveStale = errors.New("the policy no longer picks the video, for instance because it was played; the proposal was dropped")
+
+// archiveRecheck holds what the policies pick, by the proposal date they
+// were run again at, for approving several proposals.
+type archiveRecheck map[string]map[int64]int64
+
+// proposalStands runs the policies again at the date p was proposed, with
+// what is known now, and reports whether they still pick its video for its
+// policy.
+func (s *server) proposalStands(ctx context.Context, p store.ArchiveProposal, recheck archiveRecheck) (bool, error) {
+	picks, ok := recheck[p.ProposedAt]
+	if !ok {
+		at, err := time.Parse(time.DateTime, p.ProposedAt)
+		if err != nil {
+			return false, fmt.Errorf("proposal date %q: %w", p.ProposedAt, err)
+		}
+		if picks, err = s.archivePicks(ctx, at); err != nil {
+			return false, err
+		}
+		recheck[p.ProposedAt] = picks
+	}
+	return picks[p.VideoID] == p.PolicyID, nil
+}
+
+// archiveVideo carries out the proposal for video id, or drops it with
+// errArchiveStale when the policies no longer pick the video.
+func (s *server) archiveVideo(ctx context.Context, id int64, recheck archiveRecheck) error {
+	proposal, err := s.store.GetArchiveProposal(ctx, id)
+	if err != nil {
+		return err
+	}
+	ok, err := s.proposalStands(ctx, proposal, recheck)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := s.store.DeleteArchiveProposal(ctx, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		return errArchiveStale
+	}
+	policy, err := s.store.GetArchivePolicy(ctx, proposal.PolicyID)
+	if err != nil {
+		return err
+	}
+	video, err := s.store.GetVideo(ctx, id)
+	if err != nil {
+		return err
+	}
+	switch policy.Action {
+	case store.ArchiveMove:
+		dir, err := s.store.GetDirectory(ctx, policy.DirectoryID)
+		if err != nil {
+			return fmt.Errorf("cold storage directory: %w", err)
+		}
+		if err := s.archiveMove(ctx, video, dir); err != nil {
+			return err
+		}
+		if err := s.store.DeleteArchiveProposal(ctx, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	case store.ArchiveTrash:
+		// The proposal goes with the video.
+		if err := s.archiveTrash(ctx, video); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("policy %q does not move videos", policy.Name)
+	}
+	slog.Info("video archived", "video", video.FilePath(), "policy", policy.Name, "action", policy.Action)
+	return nil
+}
+
+// archiveMove moves video's file to the top of dir.
+func (s *server) archiveMove(ctx context.Context, video store.Video, dir store.Directory) error {
+	if dir.Offline {
+		return fmt.Errorf("%s is offline", dir.Path)
+	}
+	src := video.FilePath()
+	dst := filepath.Join(dir.Path, video.Filename)
+	if src == dst {
+		return nil
+	}
+	if _, err := s.blobs.Stat(dst); err == nil {
+		return fmt.Errorf("%s already exists in %s", video.Filename, dir.Path)
+	}
+	crossDevice, err := moveFile(s.blobs, src, dst)
+	if err != nil {
+		return err
+	}
+	if err := s.store.UpdateVideoPath(ctx, video.ID, dir.ID, dir.Path, video.Filename); err != nil {
+		if crossDevice {
+			s.blobs.Remove(dst) //nolint:errcheck
+		} else {
+			s.blobs.Rename(dst, src) //nolint:errcheck
+		}
+		return err
+	}
+	if crossDevice {
+		if err := s.blobs.Remove(src); err != nil {
+			slog.Warn("archive: could not remove source", "src", src, "err", err)
+		}
+	}
+	s.moveVideoThumbnail(ctx, video, dir.Path)
+	s.pruneEmptyFolders(ctx, video.DirectoryPath)
+	return nil
+}
+
+// archiveTrash moves video's file into the trash folder of its directory
+// and takes it out of the library.
+func (s *server) archiveTrash(ctx context.Context, video store.Video) error {
+	root := video.DirectoryPath
+	if d, err := s.store.GetDirectory(ctx, video.DirectoryID); err == nil {
+		root = d.Path
+	}
+	trash := filepath.Join(root, archiveTrashDir)
+	if err := os.MkdirAll(trash, 0755); err != nil {
+		return err
+	}
+	dst := filepath.Join(trash, video.Filename)
+	if _, err := s.blobs.Stat(dst); err == nil {
+		dst = filepath.Join(trash, strconv.FormatInt(video.ID, 10)+"-"+video.Filename)
+	}
+	crossDevice, err := moveFile(s.blobs, video.FilePath(), dst)
+	if err != nil {
+		return err
+	}
+	if crossDevice {
+		if err := s.blobs.Remove(video.FilePath()); err != nil {
+			slog.Warn("archive: could not remove source", "src", video.FilePath(), "err", err)
+		}
+	}
+	// The generated thumbnail goes with the file; a chosen poster stays.
+	if thumb := autoThumbnailPath(video.FilePath()); video.ThumbnailPath == thumb {
+		if err := os.Remove(thumb); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("archive: delete thumbnail failed", "path", thumb, "err", err)
+		}
+	}
+	if err := s.store.DeleteVideo(ctx, video.ID); err != nil {
+		return err
+	}
+	s.pruneEmptyFolders(ctx, video.DirectoryPath)
+	return nil
+}
+
+// GET /archive
+func (s *server) handleArchive(w http.ResponseWriter, r *http.Request) {
+	s.renderArchive(w, r, archivePanel{})
+}
+
+// POST /archive/policies saves the policy named in the form; a policy with
+// the same name is replaced.
+func (s *server) handleSaveArchivePolicy(w http.ResponseWriter, r *http.Request) {
+	p := store.ArchivePolicy{
+		Name:      strings.TrimSpace(r.FormValue("name")),
+		VideoType: r.FormValue("type"),
+		Action:    r.FormValue("action"),
+	}
+	var err error
+	if v := r.FormValue("tag_id"); v != "" {
+		if p.TagID, err = strconv.ParseInt(v, 10, 64); err != nil || p.TagID < 0 {
+			http.Error(w, "invalid tag_id", http.StatusBadRequest)
+			return
+		}
+	}
+	switch {
+	case p.Name == "":
+		http.Error(w, "name required", http.StatusBadRequest)
+		return
+	case !store.IsValidVideoType(p.VideoType):
+		http.Error(w, "invalid type", http.StatusBadRequest)
+		return
+	case p.Action != store.ArchiveKeep && p.Action != store.ArchiveMove && p.Action != store.ArchiveTrash:
+		http.Error(w, "action must be keep, move or trash", http.StatusBadRequest)
+		return
+	}
+	if p.TagID != 0 {
+		if _, err := s.store.GetTag(r.Context(), p.TagID); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+	if p.Action != store.ArchiveKeep {
+		if p.Days, err = strconv.Atoi(r.FormValue("days")); err != nil || p.Days < 1 {
+			http.Error(w, "days must be a whole number of days, at least 1", http.StatusBadRequest)
+			return
+		}
+	}
+	if p.Action == store.ArchiveMove {
+		if p.DirectoryID, err = strconv.ParseInt(r.FormValue("dir_id"), 10, 64); err != nil {
+			http.Error(w, "invalid dir_id", http.StatusBadRequest)
+			return
+		}
+		if _, err := s.store.GetDirectory(r.Context(), p.DirectoryID); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+	if _, err := s.store.SaveArchivePolicy(r.Context(), p); err != nil {
+		storeError(w, err)
+		return
+	}
+	slog.Info("archive policy saved", "policy", p.Name, "by", s.requestUser(r).Username)
+	s.renderArchive(w, r, archivePanel{})
+}
+
+// DELETE /archive/policies/{id}
+func (s *server) handleDeleteArchivePolicy(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteArchivePolicy(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderArchive(w, r, archivePanel{})
+}
+
+// POST /archive/check
+func (s *server) handleCheckArchive(w http.ResponseWriter, r *http.Request) {
+	if err := s.checkArchive(r.Context(), time.Now()); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderArchive(w, r, archivePanel{})
+}
+
+// POST /archive/proposals/{id}/approve carries out the proposal for video
+// id. A failure is shown in the panel and the proposal stays.
+func (s *server) handleApproveArchive(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.store.GetArchiveProposal(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+	var data archivePanel
+	switch err := s.archiveVideo(r.Context(), id, archiveRecheck{}); {
+	case errors.Is(err, errArchiveStale):
+		data.Error = "Not archived: " + err.Error()
+	case err != nil:
+		slog.Warn("archive failed", "video", id, "err", err)
+		data.Error = "Could not archive the video: " + err.Error()
+	}
+	s.renderArchive(w, r, data)
+}
+
+// POST /archive/proposals/approve carries out every proposal not
+// dismissed, in the background, and notifies the admin when done.
+func (s *server) handleApproveAllArchive(w http.ResponseWriter, r *http.Request) {
+	if !s.archiving.CompareAndSwap(false, true) {
+		s.renderArchive(w, r, archivePanel{})
+		return
+	}
+	proposals, err := s.store.ListArchiveProposals(r.Context())
+	if err != nil {
+		s.archiving.Store(false)
+		storeError(w, err)
+		return
+	}
+	var ids []int64
+	for _, p := range proposals {
+		if !p.Dismissed {
+			ids = append(ids, p.VideoID)
+		}
+	}
+	userID := s.requestUser(r).ID
+	go func() {
+		defer s.archiving.Store(false)
+		recheck := archiveRecheck{}
+		done, stale, failed := 0, 0, 0
+		for _, id := range ids {
+			switch err := s.archiveVideo(context.Background(), id, recheck); {
+			case errors.Is(err, errArchiveStale):
+				stale++
+			case err != nil:
+				slog.Warn("archive failed", "video", id, "err", err)
+				failed++
+			default:
+				done++
+			}
+		}
+		msg := fmt.Sprintf("Archived %d videos", done)
+		if stale > 0 {
+			msg += fmt.Sprintf("; %d no longer due were left alone", stale)
+		}
+		if failed > 0 {
+			s.notifyFailed(userID, store.NotifyArchive, fmt.Sprintf("%s; %d could not be moved", msg, failed), 0)
+			return
+		}
+		s.notify(userID, store.NotifyArchive, msg, 0)
+	}()
+	s.renderArchive(w, r, archivePanel{Running: true})
+}
+
+// POST /archive/proposals/{id}/dismiss
+func (s *server) handleDismissArchive(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.DismissArchiveProposal(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderArchive(w, r, archivePanel{})
+}
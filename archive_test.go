@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/internal/fixture"
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestArchivePolicies(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := t.Context()
+	libDir, coldDir := t.TempDir(), t.TempDir()
+	for _, name := range []string{"home.mp4", "clip.mp4", "talk.mp4"} {
+		os.WriteFile(filepath.Join(libDir, name), []byte("data"), 0644) //nolint:errcheck
+	}
+	lib, _ := srv.store.AddDirectory(ctx, libDir)
+	cold, _ := srv.store.AddDirectory(ctx, coldDir)
+	home := fixture.AddVideo(t, srv.store, lib, fixture.Video{Filename: "home.mp4", Tags: []string{"home"}})
+	fixture.AddVideo(t, srv.store, lib, fixture.Video{Filename: "clip.mp4", Type: "YouTube", Tags: []string{"home"}})
+	talk := fixture.AddVideo(t, srv.store, lib, fixture.Video{Filename: "talk.mp4", Type: "YouTube"})
+	homeTag := fixture.Tag(t, srv.store, "home", "", 0)
+
+	for _, form := range []url.Values{
+		{"name": {"Home"}, "tag_id": {itoa(homeTag.ID)}, "action": {"keep"}},
+		{"name": {"Old downloads"}, "type": {"YouTube"}, "action": {"move"}, "days": {"180"}, "dir_id": {itoa(cold.ID)}},
+		{"name": {"Ancient downloads"}, "type": {"YouTube"}, "action": {"trash"}, "days": {"365"}},
+	} {
+		if rec := doAs(srv, nil, http.MethodPost, "/archive/policies", form); rec.Code != http.StatusOK {
+			t.Fatalf("save %v: got %d: %s", form, rec.Code, rec.Body.String())
+		}
+	}
+	body := doAs(srv, nil, http.MethodGet, "/archive", nil).Body.String()
+	if !strings.Contains(body, "videos YouTube: move to "+coldDir+" after 180 days unwatched") ||
+		!strings.Contains(body, "videos tagged home: never touch") {
+		t.Errorf("panel doesn't describe the policies:\n%s", body)
+	}
+
+	// Nothing is due yet.
+	if err := srv.checkArchive(ctx, time.Now()); err != nil {
+		t.Fatalf("checkArchive: %v", err)
+	}
+	if got, _ := srv.store.ListArchiveProposals(ctx); len(got) != 0 {
+		t.Fatalf("proposals now = %+v, want none", got)
+	}
+
+	// Half a year on, the download is due to move; the home-tagged one is
+	// kept and the home video is no download.
+	if err := srv.checkArchive(ctx, time.Now().AddDate(0, 0, 200)); err != nil {
+		t.Fatalf("checkArchive: %v", err)
+	}
+	got, _ := srv.store.ListArchiveProposals(ctx)
+	if len(got) != 1 || got[0].VideoID != talk.ID {
+		t.Fatalf("proposals = %+v, want only %d", got, talk.ID)
+	}
+	if n, _ := srv.store.CountUnreadNotifications(ctx, 0); n != 1 {
+		t.Errorf("unread notifications = %d, want 1", n)
+	}
+
+	// Nothing moved before approval.
+	if _, err := os.Stat(filepath.Join(libDir, "talk.mp4")); err != nil {
+		t.Fatalf("moved before approval: %v", err)
+	}
+	if rec := doAs(srv, nil, http.MethodPost, "/archive/proposals/"+itoa(talk.ID)+"/approve", nil); rec.Code != http.StatusOK {
+		t.Fatalf("approve: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(coldDir, "talk.mp4")); err != nil {
+		t.Errorf("not moved to cold storage: %v", err)
+	}
+	if v, _ := srv.store.GetVideo(ctx, talk.ID); v.DirectoryID != cold.ID {
+		t.Errorf("video directory = %d, want %d", v.DirectoryID, cold.ID)
+	}
+
+	// In cold storage it waits for the trash policy, then goes to the
+	// trash and out of the library.
+	if err := srv.checkArchive(ctx, time.Now().AddDate(0, 0, 200)); err != nil {
+		t.Fatalf("checkArchive: %v", err)
+	}
+	if got, _ := srv.store.ListArchiveProposals(ctx); len(got) != 0 {
+		t.Fatalf("proposals in cold storage = %+v, want none", got)
+	}
+	srv.checkArchive(ctx, time.Now().AddDate(0, 0, 400)) //nolint:errcheck
+	doAs(srv, nil, http.MethodPost, "/archive/proposals/approve", nil)
+	for deadline := time.Now().Add(5 * time.Second); srv.archiving.Load() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(filepath.Join(coldDir, archiveTrashDir, "talk.mp4")); err != nil {
+		t.Errorf("not in the trash: %v", err)
+	}
+	if _, err := srv.store.GetVideo(ctx, talk.ID); err != store.ErrNotFound {
+		t.Errorf("trashed video still in the library: %v", err)
+	}
+
+	// A kept video is not proposed again while the policy picks it.
+	srv.store.SaveArchivePolicy(ctx, store.ArchivePolicy{Name: "Home", TagID: homeTag.ID, Action: store.ArchiveTrash, Days: 30}) //nolint:errcheck
+	srv.checkArchive(ctx, time.Now().AddDate(0, 0, 60))                                                                          //nolint:errcheck
+	if rec := doAs(srv, nil, http.MethodPost, "/archive/proposals/"+itoa(home.ID)+"/dismiss", nil); rec.Code != http.StatusOK {
+		t.Fatalf("dismiss: got %d", rec.Code)
+	}
+	srv.checkArchive(ctx, time.Now().AddDate(0, 0, 90)) //nolint:errcheck
+	if p, err := srv.store.GetArchiveProposal(ctx, home.ID); err != nil || !p.Dismissed {
+		t.Errorf("dismissed proposal = %+v, %v", p, err)
+	}
+	doAs(srv, nil, http.MethodPost, "/archive/proposals/approve", nil)
+	for deadline := time.Now().Add(5 * time.Second); srv.archiving.Load() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(filepath.Join(libDir, "home.mp4")); err != nil {
+		t.Errorf("kept video was archived: %v", err)
+	}
+
+	for _, form := range []url.Values{
+		{"action": {"keep"}},
+		{"name": {"x"}, "action": {"burn"}},
+		{"name": {"x"}, "action": {"trash"}},
+		{"name": {"x"}, "action": {"trash"}, "days": {"0"}},
+		{"name": {"x"}, "action": {"move"}, "days": {"10"}},
+		{"name": {"x"}, "action": {"keep"}, "type": {"Opera"}},
+	} {
+		if code := doAs(srv, nil, http.MethodPost, "/archive/policies", form).Code; code != http.StatusBadRequest {
+			t.Errorf("save %v: got %d, want 400", form, code)
+		}
+	}
+	if code := doAs(srv, nil, http.MethodPost, "/archive/policies", url.Values{"name": {"x"}, "action": {"move"}, "days": {"10"}, "dir_id": {"999"}}).Code; code != http.StatusNotFound {
+		t.Errorf("unknown directory: got %d, want 404", code)
+	}
+	if code := doAs(srv, nil, http.MethodPost, "/archive/proposals/999/approve", nil).Code; code != http.StatusNotFound {
+		t.Errorf("approve unknown: got %d, want 404", code)
+	}
+}
+
+func TestArchiveApproveRechecksPolicies(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := t.Context()
+	libDir := t.TempDir()
+	os.WriteFile(filepath.Join(libDir, "talk.mp4"), []byte("data"), 0644) //nolint:errcheck
+	lib, _ := srv.store.AddDirectory(ctx, libDir)
+	talk := fixture.AddVideo(t, srv.store, lib, fixture.Video{Filename: "talk.mp4", Type: "YouTube"})
+	srv.store.SaveArchivePolicy(ctx, store.ArchivePolicy{Name: "Old downloads", VideoType: "YouTube", Action: store.ArchiveTrash, Days: 30}) //nolint:errcheck
+	if err := srv.checkArchive(ctx, time.Now().AddDate(0, 0, 60)); err != nil {
+		t.Fatalf("checkArchive: %v", err)
+	}
+
+	// Kept since it was proposed: approving leaves it and drops the proposal.
+	keepTag := fixture.Tag(t, srv.store, "keepers", "", 0)
+	srv.store.TagVideo(ctx, talk.ID, keepTag.ID)                                                                         //nolint:errcheck
+	srv.store.SaveArchivePolicy(ctx, store.ArchivePolicy{Name: "Keepers", TagID: keepTag.ID, Action: store.ArchiveKeep}) //nolint:errcheck
+	rec := doAs(srv, nil, http.MethodPost, "/archive/proposals/"+itoa(talk.ID)+"/approve", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "no longer picks the video") {
+		t.Fatalf("approve: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(libDir, "talk.mp4")); err != nil {
+		t.Errorf("video no longer due was archived: %v", err)
+	}
+	if _, err := srv.store.GetArchiveProposal(ctx, talk.ID); err != store.ErrNotFound {
+		t.Errorf("proposal no longer due: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestSyncSkipsArchiveTrash(t *testing.T) {
+	srv := newTestServer(t)
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, archiveTrashDir), 0755)                              //nolint:errcheck
+	os.WriteFile(filepath.Join(root, archiveTrashDir, "gone.mp4"), []byte("data"), 0644) //nolint:errcheck
+	os.WriteFile(filepath.Join(root, "here.mp4"), []byte("data"), 0644)                  //nolint:errcheck
+	d, _ := srv.store.AddDirectory(t.Context(), root)
+	srv.syncDir(d)
+	videos, _ := srv.store.ListVideosByDirectory(t.Context(), d.ID)
+	if len(videos) != 1 || videos[0].Filename != "here.mp4" {
+		t.Errorf("synced %+v, want only here.mp4", videos)
+	}
+}
@@ -0,0 +1,510 @@
+// auth_external.go – sign-in through an external identity provider.
+//
+// Two sources are supported, each creating accounts on first sign-in:
+//
+//   - A trusted reverse proxy (Authelia, Authentik, oauth2-proxy…) that
+//     authenticates the user itself and passes the username in a header such
+//     as Remote-User. The header is only believed when the request comes from
+//     one of the -trusted-proxies addresses.
+//   - An OpenID Connect provider, using the authorization code flow with
+//     PKCE. The ID token must carry the nonce sent with the sign-in, and the
+//     user's identity is read from the provider's userinfo endpoint.
+//
+// When -admin-group is set, membership of that group (Remote-Groups header
+// or "groups" claim) decides the role on every sign-in. Otherwise new
+// accounts are viewers, except the very first account, which is an admin.
+//
+// GET /login/oidc          – redirect to the OIDC provider
+// GET /login/oidc/callback – finish the OIDC sign-in
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+const (
+	oidcTimeout  = 10 * time.Second
+	oidcStateTTL = 10 * time.Minute // how long a sign-in may sit at the provider
+	proxyUserTTL = time.Minute      // how long a proxied identity's account is reused
+)
+
+// oidcClient makes the discovery, token and userinfo requests. The timeout
+// keeps a provider that stops answering from holding a sign-in open.
+var oidcClient = &http.Client{Timeout: oidcTimeout}
+
+// proxyAuth trusts a username header set by a reverse proxy.
+type proxyAuth struct {
+	userHeader   string         // e.g. "Remote-User"
+	groupsHeader string         // e.g. "Remote-Groups"; comma-separated
+	trusted      []netip.Prefix // proxies allowed to set the headers
+
+	// Resolved accounts keyed by the user and groups header values, so
+	// that a page and its assets do not each look the account up.
+	mu    sync.Mutex
+	users map[string]proxyUserEntry
+}
+
+type proxyUserEntry struct {
+	user    store.User
+	expires time.Time
+}
+
+// cached returns the account resolved for key within proxyUserTTL.
+func (p *proxyAuth) cached(key string) (store.User, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.users[key]
+	if !ok || time.Now().After(e.expires) {
+		return store.User{}, false
+	}
+	return e.user, true
+}
+
+func (p *proxyAuth) remember(key string, user store.User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.users == nil {
+		p.users = make(map[string]proxyUserEntry)
+	}
+	for k, e := range p.users {
+		if time.Now().After(e.expires) {
+			delete(p.users, k)
+		}
+	}
+	p.users[key] = proxyUserEntry{user: user, expires: time.Now().Add(proxyUserTTL)}
+}
+
+// forget drops the resolved accounts, after an account's role changes or
+// it is deleted.
+func (p *proxyAuth) forget() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clear(p.users)
+}
+
+// parseTrustedProxies parses a comma-separated list of addresses and CIDR
+// ranges.
+func parseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, f := range strings.Split(list, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		if p, err := netip.ParsePrefix(f); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		a, err := netip.ParseAddr(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", f)
+		}
+		out = append(out, netip.PrefixFrom(a, a.BitLen()))
+	}
+	return out, nil
+}
+
+// identity returns the username and groups a trusted proxy vouches for.
+func (p *proxyAuth) identity(r *http.Request) (username string, groups []string, ok bool) {
+	username = strings.TrimSpace(r.Header.Get(p.userHeader))
+	if username == "" {
+		return "", nil, false
+	}
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return "", nil, false
+	}
+	ip := addr.Addr().Unmap()
+	if !slices.ContainsFunc(p.trusted, func(pr netip.Prefix) bool { return pr.Contains(ip) }) {
+		return "", nil, false
+	}
+	if p.groupsHeader != "" {
+		for _, g := range strings.Split(r.Header.Get(p.groupsHeader), ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				groups = append(groups, g)
+			}
+		}
+	}
+	return username, groups, true
+}
+
+// oidcAuth is an OpenID Connect relying party. The provider's endpoints are
+// discovered on first use.
+type oidcAuth struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+
+	mu        sync.Mutex
+	endpoints *oidcEndpoints
+}
+
+type oidcEndpoints struct {
+	Authorization string `json:"authorization_endpoint"`
+	Token         string `json:"token_endpoint"`
+	UserInfo      string `json:"userinfo_endpoint"`
+}
+
+// discover fetches the provider's configuration document, caching it once
+// it has been read successfully.
+func (o *oidcAuth) discover(ctx context.Context) (*oidcEndpoints, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.endpoints != nil {
+		return o.endpoints, nil
+	}
+	var ep oidcEndpoints
+	if err := oidcGetJSON(ctx, strings.TrimSuffix(o.issuer, "/")+"/.well-known/openid-configuration", "", &ep); err != nil {
+		return nil, fmt.Errorf("discover %s: %w", o.issuer, err)
+	}
+	if ep.Authorization == "" || ep.Token == "" || ep.UserInfo == "" {
+		return nil, fmt.Errorf("discover %s: provider does not list authorization, token and userinfo endpoints", o.issuer)
+	}
+	o.endpoints = &ep
+	return o.endpoints, nil
+}
+
+// oidcGetJSON GETs url, with bearer as the access token when set, and
+// decodes the JSON response into v.
+func oidcGetJSON(ctx context.Context, url, bearer string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// oidcUserInfo is the subset of the userinfo response used to name and
+// place an account.
+type oidcUserInfo struct {
+	Subject           string   `json:"sub"`
+	PreferredUsername string   `json:"preferred_username"`
+	Email             string   `json:"email"`
+	Groups            []string `json:"groups"`
+}
+
+func (u oidcUserInfo) username() string {
+	for _, name := range []string{u.PreferredUsername, u.Email, u.Subject} {
+		if name = strings.TrimSpace(name); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// oidcSignIn is what a sign-in in progress keeps in the oidc_state cookie
+// to check the provider's answer against.
+type oidcSignIn struct {
+	state    string // echoed back by the provider on the callback
+	nonce    string // must appear in the ID token
+	verifier string // PKCE code verifier, sent with the code
+}
+
+func newOIDCSignIn() oidcSignIn {
+	return oidcSignIn{state: newToken(), nonce: newToken(), verifier: newToken() + newToken()}
+}
+
+func (si oidcSignIn) cookieValue() string {
+	return si.state + "." + si.nonce + "." + si.verifier
+}
+
+func parseOIDCSignIn(v string) (oidcSignIn, bool) {
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return oidcSignIn{}, false
+	}
+	return oidcSignIn{state: parts[0], nonce: parts[1], verifier: parts[2]}, true
+}
+
+// challenge is the S256 PKCE code challenge for the verifier.
+func (si oidcSignIn) challenge() string {
+	sum := sha256.Sum256([]byte(si.verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// oidcIDClaims are the ID token claims checked before the sign-in is
+// accepted.
+type oidcIDClaims struct {
+	Issuer   string          `json:"iss"`
+	Subject  string          `json:"sub"`
+	Audience json.RawMessage `json:"aud"` // a string or an array of strings
+	Nonce    string          `json:"nonce"`
+	Expiry   int64           `json:"exp"`
+}
+
+// checkIDToken reads the claims of an ID token and checks that it was
+// issued by the provider to this client for this sign-in. The token comes
+// straight from the provider's token endpoint over the back channel, so its
+// signature is not checked (OpenID Connect Core 3.1.3.7).
+func (o *oidcAuth) checkIDToken(raw, nonce string) (oidcIDClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return oidcIDClaims{}, fmt.Errorf("malformed ID token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return oidcIDClaims{}, fmt.Errorf("ID token payload: %w", err)
+	}
+	var c oidcIDClaims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return oidcIDClaims{}, fmt.Errorf("ID token claims: %w", err)
+	}
+	var aud []string
+	if err := json.Unmarshal(c.Audience, &aud); err != nil {
+		var one string
+		if json.Unmarshal(c.Audience, &one) == nil {
+			aud = []string{one}
+		}
+	}
+	switch {
+	case strings.TrimSuffix(c.Issuer, "/") != strings.TrimSuffix(o.issuer, "/"):
+		return oidcIDClaims{}, fmt.Errorf("ID token issued by %q", c.Issuer)
+	case !slices.Contains(aud, o.clientID):
+		return oidcIDClaims{}, fmt.Errorf("ID token not issued to this client")
+	case c.Nonce != nonce:
+		return oidcIDClaims{}, fmt.Errorf("ID token nonce does not match the sign-in")
+	case time.Now().Unix() >= c.Expiry:
+		return oidcIDClaims{}, fmt.Errorf("ID token expired")
+	}
+	return c, nil
+}
+
+// exchange trades an authorization code, with the sign-in's PKCE verifier,
+// for tokens, checks the ID token against the sign-in and reads the
+// signed-in user from the userinfo endpoint.
+func (o *oidcAuth) exchange(ctx context.Context, code string, si oidcSignIn) (oidcUserInfo, error) {
+	ep, err := o.discover(ctx)
+	if err != nil {
+		return oidcUserInfo{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.redirectURL},
+		"code_verifier": {si.verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.Token, strings.NewReader(form.Encode()))
+	if err != nil {
+		return oidcUserInfo{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.clientSecret))
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return oidcUserInfo{}, err
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return oidcUserInfo{}, fmt.Errorf("token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.AccessToken == "" {
+		return oidcUserInfo{}, fmt.Errorf("token request failed: %s %s", resp.Status, tok.Error)
+	}
+	claims, err := o.checkIDToken(tok.IDToken, si.nonce)
+	if err != nil {
+		return oidcUserInfo{}, err
+	}
+	var info oidcUserInfo
+	if err := oidcGetJSON(ctx, ep.UserInfo, tok.AccessToken, &info); err != nil {
+		return oidcUserInfo{}, fmt.Errorf("userinfo: %w", err)
+	}
+	if info.Subject != claims.Subject {
+		return oidcUserInfo{}, fmt.Errorf("userinfo is for a different subject than the ID token")
+	}
+	return info, nil
+}
+
+// externalRole decides the role of an externally authenticated user.
+// keep is the account's current role, or "" for a new account.
+func (s *server) externalRole(ctx context.Context, groups []string, keep string) string {
+	if s.adminGroup != "" {
+		if slices.Contains(groups, s.adminGroup) {
+			return store.RoleAdmin
+		}
+		return store.RoleViewer
+	}
+	if keep != "" {
+		return keep
+	}
+	// Nobody can administer the server yet: the first account must.
+	if users, err := s.store.ListUsers(ctx); err == nil && len(users) == 0 && s.passwordHash == nil {
+		return store.RoleAdmin
+	}
+	return store.RoleViewer
+}
+
+// provisionUser finds or creates the account for an externally
+// authenticated username, bringing its role in line with its groups.
+// Provisioned accounts have no password, so they cannot sign in on the
+// login form.
+func (s *server) provisionUser(ctx context.Context, username string, groups []string) (store.User, error) {
+	user, _, err := s.store.GetUserByName(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		user, err = s.store.CreateUser(ctx, username, "", s.externalRole(ctx, groups, ""))
+		if err != nil {
+			return store.User{}, err
+		}
+		slog.Info("provisioned user", "username", user.Username, "role", user.Role)
+		s.refreshAccounts(ctx)
+		return user, nil
+	}
+	if err != nil {
+		return store.User{}, err
+	}
+	if role := s.externalRole(ctx, groups, user.Role); role != user.Role {
+		if err := s.store.SetUserRole(ctx, user.ID, role); err != nil {
+			return store.User{}, err
+		}
+		user.Role = role
+	}
+	return user, nil
+}
+
+// proxyUser returns the account vouched for by a trusted reverse proxy.
+// The account is provisioned on the first request with a given identity
+// and reused for proxyUserTTL.
+func (s *server) proxyUser(r *http.Request) (store.User, bool) {
+	if s.proxy == nil {
+		return store.User{}, false
+	}
+	username, groups, ok := s.proxy.identity(r)
+	if !ok {
+		return store.User{}, false
+	}
+	key := username + "\n" + strings.Join(groups, ",")
+	if user, ok := s.proxy.cached(key); ok {
+		return user, true
+	}
+	user, err := s.provisionUser(r.Context(), username, groups)
+	if err != nil {
+		slog.Warn("provision proxy user failed", "username", username, "err", err)
+		return store.User{}, false
+	}
+	s.proxy.remember(key, user)
+	return user, true
+}
+
+// forgetProxyUsers makes the next proxied request of each user look its
+// account up again.
+func (s *server) forgetProxyUsers() {
+	if s.proxy != nil {
+		s.proxy.forget()
+	}
+}
+
+// handleOIDCLogin sends the browser to the provider with a one-time state,
+// nonce and PKCE challenge, keeping them in a cookie for the callback.
+func (s *server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	ep, err := s.oidc.discover(r.Context())
+	if err != nil {
+		slog.Warn("oidc discovery failed", "err", err)
+		http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	si := newOIDCSignIn()
+	// Lax, not Strict: the cookie must come back on the provider's redirect.
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oidc_state",
+		Value:    si.cookieValue(),
+		Path:     "/login/oidc",
+		MaxAge:   int(oidcStateTTL / time.Second),
+		HttpOnly: true,
+		Secure:   s.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.oidc.clientID},
+		"redirect_uri":          {s.oidc.redirectURL},
+		"scope":                 {"openid profile email groups"},
+		"state":                 {si.state},
+		"nonce":                 {si.nonce},
+		"code_challenge":        {si.challenge()},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(ep.Authorization, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, ep.Authorization+sep+q.Encode(), http.StatusFound)
+}
+
+// handleOIDCCallback completes the sign-in and starts a session for the
+// provisioned account.
+func (s *server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: "oidc_state", Value: "", Path: "/login/oidc", MaxAge: -1})
+	var si oidcSignIn
+	cookie, err := r.Cookie("oidc_state")
+	if err == nil {
+		si, _ = parseOIDCSignIn(cookie.Value)
+	}
+	if si.state == "" || r.FormValue("state") != si.state {
+		s.renderLogin(w, r, "Single sign-on expired, please try again.")
+		return
+	}
+	if e := r.FormValue("error"); e != "" {
+		s.renderLogin(w, r, "Single sign-on failed: "+e)
+		return
+	}
+	info, err := s.oidc.exchange(r.Context(), r.FormValue("code"), si)
+	if err != nil {
+		slog.Warn("oidc sign-in failed", "err", err)
+		s.renderLogin(w, r, "Single sign-on failed.")
+		return
+	}
+	username := info.username()
+	if username == "" {
+		s.renderLogin(w, r, "The identity provider did not return a username.")
+		return
+	}
+	user, err := s.provisionUser(r.Context(), username, info.Groups)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	// The sign-in arrives by a cross-site redirect from the provider, which
+	// browsers treat as cross-site throughout; a Strict cookie set here would
+	// not be sent on the way to "/".
+	s.startSession(w, r, user.ID, http.SameSiteLaxMode)
+}
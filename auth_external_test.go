@@ -0,0 +1,299 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	got, err := parseTrustedProxies("127.0.0.1, 10.1.2.3/8,::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"127.0.0.1/32", "10.0.0.0/8", "::1/128"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("prefix %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+	if _, err := parseTrustedProxies("proxy.lan"); err == nil {
+		t.Error("expected an error for a hostname")
+	}
+}
+
+// asProxyUser is a doAs option for a request forwarded by a proxy that
+// signed in username. httptest requests come from 192.0.2.1.
+func asProxyUser(username, groups string) func(*http.Request) {
+	return func(r *http.Request) {
+		r.Header.Set("Remote-User", username)
+		if groups != "" {
+			r.Header.Set("Remote-Groups", groups)
+		}
+	}
+}
+
+func withProxyAuth(t *testing.T, srv *server, trusted string) {
+	t.Helper()
+	prefixes, err := parseTrustedProxies(trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.proxy = &proxyAuth{userHeader: "Remote-User", groupsHeader: "Remote-Groups", trusted: prefixes}
+}
+
+func TestProxyAuth_ProvisionsUsers(t *testing.T) {
+	srv := newTestServer(t)
+	withProxyAuth(t, srv, "192.0.2.0/24")
+
+	if rec := doAs(srv, nil, http.MethodGet, "/settings", nil, asProxyUser("alice", "")); rec.Code != http.StatusOK {
+		t.Fatalf("expected the first provisioned user to be an admin, got %d", rec.Code)
+	}
+	if rec := doAs(srv, nil, http.MethodGet, "/videos", nil, asProxyUser("bob", "")); rec.Code != http.StatusOK {
+		t.Fatalf("expected bob to be signed in, got %d", rec.Code)
+	}
+	if rec := doAs(srv, nil, http.MethodGet, "/settings", nil, asProxyUser("bob", "")); rec.Code != http.StatusForbidden {
+		t.Errorf("expected later users to be viewers, got %d", rec.Code)
+	}
+	_, hash, err := srv.store.GetUserByName(context.Background(), "bob")
+	if err != nil || hash != "" {
+		t.Errorf("expected bob provisioned without a password, got %q, %v", hash, err)
+	}
+	if rec := doAs(srv, nil, http.MethodGet, "/videos", nil, asProxyUser("", "")); rec.Code != http.StatusFound {
+		t.Errorf("expected a request without the header to be sent to /login, got %d", rec.Code)
+	}
+}
+
+func TestProxyAuth_IgnoresUntrustedSource(t *testing.T) {
+	srv := newTestServer(t)
+	withProxyAuth(t, srv, "10.0.0.0/8")
+	if rec := doAs(srv, nil, http.MethodGet, "/videos", nil, asProxyUser("mallory", "")); rec.Code != http.StatusFound {
+		t.Errorf("expected the header from an untrusted address to be ignored, got %d", rec.Code)
+	}
+	if _, _, err := srv.store.GetUserByName(context.Background(), "mallory"); err == nil {
+		t.Error("expected no account for an untrusted header")
+	}
+}
+
+func TestProxyAuth_AdminGroupSetsRole(t *testing.T) {
+	srv := newTestServer(t)
+	withProxyAuth(t, srv, "192.0.2.1")
+	srv.adminGroup = "admins"
+
+	if rec := doAs(srv, nil, http.MethodGet, "/settings", nil, asProxyUser("carol", "media, admins")); rec.Code != http.StatusOK {
+		t.Fatalf("expected a member of the admin group to be an admin, got %d", rec.Code)
+	}
+	if rec := doAs(srv, nil, http.MethodGet, "/settings", nil, asProxyUser("carol", "media")); rec.Code != http.StatusForbidden {
+		t.Errorf("expected leaving the group to demote the account, got %d", rec.Code)
+	}
+	if u, _, _ := srv.store.GetUserByName(context.Background(), "carol"); u.Role != store.RoleViewer {
+		t.Errorf("role = %q, want viewer", u.Role)
+	}
+}
+
+func TestProxyAuth_ReusesResolvedAccount(t *testing.T) {
+	srv := newTestServer(t)
+	withProxyAuth(t, srv, "192.0.2.0/24")
+	addTestUser(t, srv, "root", "adminpass", store.RoleAdmin)
+	admin := loginAs(t, srv, "root", "adminpass")
+
+	if rec := doAs(srv, nil, http.MethodGet, "/settings", nil, asProxyUser("erin", "")); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected erin to be a viewer, got %d", rec.Code)
+	}
+	erin, _, _ := srv.store.GetUserByName(context.Background(), "erin")
+
+	// A change made behind the server's back is not seen until the entry
+	// expires...
+	srv.store.SetUserRole(context.Background(), erin.ID, store.RoleAdmin) //nolint:errcheck
+	if rec := doAs(srv, nil, http.MethodGet, "/settings", nil, asProxyUser("erin", "")); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the cached viewer account, got %d", rec.Code)
+	}
+	// ...but one made through the users page is.
+	srv.store.SetUserRole(context.Background(), erin.ID, store.RoleViewer) //nolint:errcheck
+	if rec := doAs(srv, admin, http.MethodPut, "/users/"+itoa(erin.ID)+"/role", url.Values{"role": {"admin"}}); rec.Code != http.StatusOK {
+		t.Fatalf("set role: %d", rec.Code)
+	}
+	if rec := doAs(srv, nil, http.MethodGet, "/settings", nil, asProxyUser("erin", "")); rec.Code != http.StatusOK {
+		t.Errorf("expected the role change to apply, got %d", rec.Code)
+	}
+}
+
+// mockOIDCProvider serves discovery, authorization, token and userinfo
+// endpoints. The authorization endpoint records the request's nonce and
+// PKCE challenge; the token endpoint accepts the code "good-code" with the
+// matching verifier and returns an ID token carrying the nonce.
+type mockOIDCProvider struct {
+	*httptest.Server
+	mu               sync.Mutex
+	nonce, challenge string
+	idNonce          string // when set, sent in the ID token instead of nonce
+}
+
+func (p *mockOIDCProvider) setIDNonce(nonce string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idNonce = nonce
+}
+
+func newMockOIDCProvider(t *testing.T, info map[string]any) *mockOIDCProvider {
+	t.Helper()
+	p := &mockOIDCProvider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{ //nolint:errcheck
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"userinfo_endpoint":      p.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.nonce, p.challenge = r.FormValue("nonce"), r.FormValue("code_challenge")
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		id, secret, _ := r.BasicAuth()
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "good-code" || id != "vm" || secret != "s3cret" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"}) //nolint:errcheck
+			return
+		}
+		claims, _ := json.Marshal(map[string]any{
+			"iss": p.URL, "aud": "vm", "sub": info["sub"],
+			"nonce": cmp.Or(p.idNonce, p.nonce), "exp": time.Now().Add(time.Minute).Unix(),
+		})
+		idToken := "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(claims) + "."
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "tok", "token_type": "Bearer", "id_token": idToken}) //nolint:errcheck
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(info) //nolint:errcheck
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// startOIDCLogin begins a sign-in at srv, visits the provider's
+// authorization endpoint as the browser would, and returns the state and
+// the oidc_state cookie for the callback.
+func startOIDCLogin(t *testing.T, srv *server, provider *mockOIDCProvider) (string, *http.Cookie) {
+	t.Helper()
+	rec := doAs(srv, nil, http.MethodGet, "/login/oidc", nil)
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if rec.Code != http.StatusFound || err != nil || !strings.HasPrefix(loc.String(), provider.URL+"/authorize?") {
+		t.Fatalf("expected a redirect to the provider, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	q := loc.Query()
+	if q.Get("client_id") != "vm" || q.Get("state") == "" || q.Get("nonce") == "" || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("unexpected authorization request %s", loc)
+	}
+	resp, err := http.Get(loc.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "oidc_state" {
+			return q.Get("state"), c
+		}
+	}
+	t.Fatal("expected an oidc_state cookie")
+	return "", nil
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newMockOIDCProvider(t, map[string]any{"sub": "123", "preferred_username": "dana", "groups": []string{"family"}})
+	srv := newTestServer(t)
+	srv.oidc = &oidcAuth{issuer: provider.URL, clientID: "vm", clientSecret: "s3cret", redirectURL: "https://vm.example/login/oidc/callback"}
+
+	if rec := doAs(srv, nil, http.MethodGet, "/login", nil); !strings.Contains(rec.Body.String(), `href="/login/oidc"`) {
+		t.Error("expected the login page to offer single sign-on")
+	}
+	state, stateCookie := startOIDCLogin(t, srv, provider)
+
+	// A callback whose state does not match the cookie is refused.
+	rec := doAs(srv, stateCookie, http.MethodGet, "/login/oidc/callback?code=good-code&state=forged", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "expired") {
+		t.Errorf("expected a forged state to be refused, got %d", rec.Code)
+	}
+
+	rec = doAs(srv, stateCookie, http.MethodGet, "/login/oidc/callback?code=good-code&state="+state, nil)
+	var session *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "session" {
+			session = c
+		}
+	}
+	if rec.Code != http.StatusFound || session == nil {
+		t.Fatalf("expected a session after the callback, got %d: %s", rec.Code, rec.Body.String())
+	}
+	u, _, err := srv.store.GetUserByName(context.Background(), "dana")
+	if err != nil || u.Role != store.RoleAdmin {
+		t.Errorf("expected dana provisioned as the first admin, got %+v, %v", u, err)
+	}
+	if rec := doAs(srv, session, http.MethodGet, "/", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "dana") {
+		t.Errorf("expected the signed-in index page, got %d", rec.Code)
+	}
+}
+
+func TestOIDCLogin_BadCode(t *testing.T) {
+	provider := newMockOIDCProvider(t, map[string]any{"sub": "123"})
+	srv := newTestServer(t)
+	srv.oidc = &oidcAuth{issuer: provider.URL, clientID: "vm", clientSecret: "s3cret", redirectURL: "https://vm.example/login/oidc/callback"}
+	state := &http.Cookie{Name: "oidc_state", Value: "abc.nonce.verifier"}
+	rec := doAs(srv, state, http.MethodGet, "/login/oidc/callback?code=bad&state=abc", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Single sign-on failed") {
+		t.Errorf("expected the login page with an error, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if users, _ := srv.store.ListUsers(context.Background()); len(users) != 0 {
+		t.Errorf("expected no account for a failed sign-in, got %v", users)
+	}
+}
+
+func TestOIDCLogin_ChecksNonceAndVerifier(t *testing.T) {
+	provider := newMockOIDCProvider(t, map[string]any{"sub": "123", "preferred_username": "dana"})
+	srv := newTestServer(t)
+	srv.oidc = &oidcAuth{issuer: provider.URL, clientID: "vm", clientSecret: "s3cret", redirectURL: "https://vm.example/login/oidc/callback"}
+
+	// An ID token minted for another sign-in is refused.
+	state, cookie := startOIDCLogin(t, srv, provider)
+	provider.setIDNonce("replayed")
+	if rec := doAs(srv, cookie, http.MethodGet, "/login/oidc/callback?code=good-code&state="+state, nil); !strings.Contains(rec.Body.String(), "Single sign-on failed") {
+		t.Errorf("expected a wrong nonce to be refused, got %d", rec.Code)
+	}
+	provider.setIDNonce("")
+
+	// So is a code redeemed without the verifier for its challenge.
+	state, cookie = startOIDCLogin(t, srv, provider)
+	si, _ := parseOIDCSignIn(cookie.Value)
+	si.verifier = "intercepted"
+	cookie.Value = si.cookieValue()
+	if rec := doAs(srv, cookie, http.MethodGet, "/login/oidc/callback?code=good-code&state="+state, nil); !strings.Contains(rec.Body.String(), "Single sign-on failed") {
+		t.Errorf("expected a wrong verifier to be refused, got %d", rec.Code)
+	}
+	if users, _ := srv.store.ListUsers(context.Background()); len(users) != 0 {
+		t.Errorf("expected no account, got %v", users)
+	}
+}
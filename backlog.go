@@ -0,0 +1,105 @@
+// backlog.go – the unwatched pile.
+//
+// The pile is the library's backlog: videos never watched or even started,
+// oldest added first, so playing through it works down from what has waited
+// longest. Half-watched videos are left to Continue watching. The store
+// works the pile out on every request, so it is current whenever it is
+// opened or exported; tag_id keeps one tag's videos and limit (default
+// defaultBacklogSize, at most maxBacklogSize) caps how many are listed.
+//
+// GET /api/backlog  – the pile as a watch order (see handlers_watch_orders.go)
+// GET /backlog.m3u  – the pile as an M3U playlist for other players
+//
+// The M3U file holds absolute stream URLs, signed when signed_streams is on.
+// With sign-in on, a player outside the browser cannot open them.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+const (
+	defaultBacklogSize = 100
+	maxBacklogSize     = 1000
+)
+
+// backlogFor reads tag_id and limit and lists the pile. A bad value is
+// answered with 400 and ok false.
+func (s *server) backlogFor(w http.ResponseWriter, r *http.Request) (videos []store.Video, tag store.Tag, ok bool) {
+	q := r.URL.Query()
+	if v := q.Get("tag_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid tag_id", http.StatusBadRequest)
+			return nil, tag, false
+		}
+		if tag, err = s.store.GetTag(r.Context(), id); err != nil {
+			storeError(w, err)
+			return nil, tag, false
+		}
+	}
+	limit := defaultBacklogSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxBacklogSize {
+			http.Error(w, fmt.Sprintf("limit must be 1 to %d", maxBacklogSize), http.StatusBadRequest)
+			return nil, tag, false
+		}
+		limit = n
+	}
+	videos, err := s.store.ListUnwatchedPile(r.Context(), tag.ID, limit)
+	if err != nil {
+		storeError(w, err)
+		return nil, tag, false
+	}
+	return videos, tag, true
+}
+
+// backlogName names the pile, after its tag when it has one.
+func backlogName(tag store.Tag) string {
+	if tag.Name != "" {
+		return "Unwatched " + tag.Name
+	}
+	return "Unwatched pile"
+}
+
+// GET /api/backlog?tag_id=N&limit=N
+func (s *server) handleAPIBacklog(w http.ResponseWriter, r *http.Request) {
+	videos, tag, ok := s.backlogFor(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, newAPIWatchOrder(backlogName(tag), videos, s.streamSigner(r.Context())))
+}
+
+// GET /backlog.m3u?tag_id=N&limit=N
+func (s *server) handleBacklogM3U(w http.ResponseWriter, r *http.Request) {
+	videos, tag, ok := s.backlogFor(w, r)
+	if !ok {
+		return
+	}
+	base := "http://" + r.Host
+	if r.TLS != nil {
+		base = "https://" + r.Host
+	}
+	sign := s.streamSigner(r.Context())
+	// A newline in a name would end its line early.
+	oneLine := func(s string) string { return strings.Join(strings.Fields(s), " ") }
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#PLAYLIST:" + oneLine(backlogName(tag)) + "\n")
+	for _, v := range videos {
+		dur := -1
+		if v.DurationS > 0 {
+			dur = int(v.DurationS)
+		}
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n%s%s\n", dur, oneLine(v.Title()), base, sign("/video/"+strconv.FormatInt(v.ID, 10)))
+	}
+	w.Header().Set("Content-Type", "audio/x-mpegurl; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="backlog.m3u"`)
+	w.Write([]byte(b.String())) //nolint:errcheck
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/internal/fixture"
+)
+
+func TestBacklog(t *testing.T) {
+	srv := newTestServer(t)
+	lib := fixture.Seed(t, srv.store)
+	// The movie and the pilot have been watched; the second episode and
+	// the two added after it have not, and one of those was started.
+	older := fixture.AddVideo(t, srv.store, lib.Dir, fixture.Video{Filename: "Storm.mp4", Tags: []string{"drama"}, Duration: 600})
+	started := fixture.AddVideo(t, srv.store, lib.Dir, fixture.Video{Filename: "Started.mp4"})
+	srv.store.RecordProgress(t.Context(), started.ID, 30) //nolint:errcheck
+
+	var order apiWatchOrder
+	if code := apiGet(t, srv, "/api/backlog", &order); code != http.StatusOK {
+		t.Fatalf("GET /api/backlog: got %d", code)
+	}
+	if order.Name != "Unwatched pile" || len(order.Videos) != 2 || order.Videos[0].ID != lib.Episodes[1].ID || order.Videos[1].ID != older.ID {
+		t.Errorf("backlog = %+v, want episode 2 then Storm", order)
+	}
+	if code := apiGet(t, srv, "/api/backlog?limit=1&tag_id="+itoa(lib.Drama.ID), &order); code != http.StatusOK {
+		t.Fatalf("GET /api/backlog for drama: got %d", code)
+	}
+	if order.Name != "Unwatched drama" || len(order.Videos) != 1 || order.Videos[0].ID != lib.Episodes[1].ID {
+		t.Errorf("drama backlog, limit 1 = %+v", order)
+	}
+
+	// Playing one takes it off the pile at once.
+	srv.store.RecordWatch(t.Context(), lib.Episodes[1].ID, 1500) //nolint:errcheck
+	rec := doAs(srv, nil, http.MethodGet, "/backlog.m3u", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "audio/x-mpegurl") {
+		t.Fatalf("GET /backlog.m3u: got %d, %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	want := "#EXTM3U\n#PLAYLIST:Unwatched pile\n#EXTINF:600,Storm.mp4\nhttp://example.com/video/" + itoa(older.ID) + "\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("M3U =\n%s\nwant\n%s", got, want)
+	}
+
+	for _, target := range []string{"/api/backlog?limit=0", "/api/backlog?limit=5000", "/api/backlog?tag_id=x"} {
+		if rec := doAs(srv, nil, http.MethodGet, target, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+	if rec := doAs(srv, nil, http.MethodGet, "/api/backlog?tag_id=999", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown tag: expected 404, got %d", rec.Code)
+	}
+}
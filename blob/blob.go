@@ -0,0 +1,87 @@
+// Package blob abstracts where video bytes live. Handlers and the library
+// scan open, stat, create, rename and remove video files through a Storage
+// instead of the os package, so a backend other than the local disk (rclone,
+// S3 with presigned streaming) can be plugged in without touching them or
+// the paths kept in the store.
+//
+// Names are the paths the store records, e.g. store.Video.FilePath(). A
+// backend reports a missing file with an error wrapping fs.ErrNotExist.
+//
+// Storage does not cover everything done to a video: ffmpeg and ffprobe
+// (probing, thumbnails, transcodes, trims, metadata writes) and the
+// directory walk are handed local paths, so those features still need the
+// backend mounted on the local file system.
+package blob
+
+import (
+	"io"
+	"io/fs"
+	"os"
+)
+
+// File is an open video. It is seekable so that it can answer HTTP range
+// requests.
+type File interface {
+	io.ReadSeekCloser
+	Stat() (fs.FileInfo, error)
+}
+
+// Storage gives access to video files.
+type Storage interface {
+	Open(name string) (File, error)
+	Stat(name string) (fs.FileInfo, error)
+	Create(name string) (io.WriteCloser, error)
+	Remove(name string) error
+	Rename(oldname, newname string) error
+}
+
+// Spacer is a Storage that can tell how much room is left where a name is
+// stored. Local is one where the platform allows (see Local.Space).
+type Spacer interface {
+	Space(name string) (free, total uint64, err error)
+}
+
+// Copy copies src to dst within s. If the copy fails, the partial dst is
+// removed.
+func Copy(s Storage, src, dst string) error {
+	in, err := s.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := s.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		s.Remove(dst) //nolint:errcheck
+		return err
+	}
+	return out.Close()
+}
+
+// Local is Storage on the local file system.
+type Local struct{}
+
+func (Local) Open(name string) (File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err // not a nil *os.File in a non-nil File
+	}
+	return f, nil
+}
+
+func (Local) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+func (Local) Create(name string) (io.WriteCloser, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (Local) Remove(name string) error { return os.Remove(name) }
+
+func (Local) Rename(oldname, newname string) error { return os.Rename(oldname, newname) }
@@ -0,0 +1,80 @@
+package blob
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	var s Storage = Local{}
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.mp4"), filepath.Join(dir, "b.mp4")
+	if err := os.WriteFile(a, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := s.Open(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(1, io.SeekStart) //nolint:errcheck
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "ideo" {
+		t.Errorf("read after seek = %q", data)
+	}
+
+	if err := s.Rename(a, b); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := s.Stat(b); err != nil || fi.Size() != 5 {
+		t.Errorf("Stat after rename = %v, %v", fi, err)
+	}
+	if err := s.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat(b); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist after Remove, got %v", err)
+	}
+	if f, err := s.Open(b); err == nil || f != nil {
+		t.Errorf("Open of a missing file = %v, %v; want a nil File and an error", f, err)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	var s Storage = Local{}
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.mp4"), filepath.Join(dir, "b.mp4")
+	if err := os.WriteFile(a, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Copy(s, a, b); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(b); string(data) != "video" {
+		t.Errorf("copy = %q", data)
+	}
+	if _, err := s.Stat(a); err != nil {
+		t.Errorf("source should remain after Copy: %v", err)
+	}
+	if err := Copy(s, filepath.Join(dir, "missing.mp4"), b); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Copy of a missing file = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestLocalSpace(t *testing.T) {
+	free, total, err := Local{}.Space(t.TempDir())
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("free space is not reported on this platform")
+	}
+	if err != nil || total == 0 || free > total {
+		t.Errorf("Space = %d free of %d, %v", free, total, err)
+	}
+	if _, _, err := (Local{}).Space(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Space of a missing folder: want an error")
+	}
+}
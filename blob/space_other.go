@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package blob
+
+import "errors"
+
+// Space is not implemented on this platform.
+func (Local) Space(name string) (free, total uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
@@ -0,0 +1,171 @@
+// budgets.go – storage budgets for directories and the whole library.
+//
+// Each directory, and the library as a whole (settings library_budget_bytes
+// and library_cap_bytes), can have a soft budget and a hard cap. Every scan
+// compares usage against them; a limit that becomes exceeded is logged,
+// published to the admins as an event and, when budget_webhook_url is set,
+// POSTed there as JSON. Downloads into a
+// directory that is at its cap, or while the library is at its cap, are
+// refused.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// budgetAlert is a storage limit that usage has reached or passed.
+type budgetAlert struct {
+	Scope       string `json:"scope"` // "directory" or "library"
+	DirectoryID int64  `json:"directory_id,omitempty"`
+	Name        string `json:"name"`
+	Hard        bool   `json:"hard"` // a cap rather than a budget
+	UsedBytes   int64  `json:"used_bytes"`
+	LimitBytes  int64  `json:"limit_bytes"`
+}
+
+// key identifies the limit, so an alert is raised once per crossing.
+func (a budgetAlert) key() string {
+	return fmt.Sprintf("%s:%d:%t", a.Scope, a.DirectoryID, a.Hard)
+}
+
+func (a budgetAlert) String() string {
+	kind := "budget"
+	if a.Hard {
+		kind = "cap"
+	}
+	return fmt.Sprintf("%s is at %s of its %s %s", a.Name, formatBytes(a.UsedBytes), formatBytes(a.LimitBytes), kind)
+}
+
+// librarySizeLimits reads the library-wide budget and cap; 0 means none.
+func (s *server) librarySizeLimits(ctx context.Context) (budget, capBytes int64) {
+	read := func(key string) int64 {
+		v, err := s.store.GetSetting(ctx, key)
+		if err != nil {
+			return 0
+		}
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return read("library_budget_bytes"), read("library_cap_bytes")
+}
+
+// budgetAlerts lists every budget and cap that current usage has reached.
+// Budgets alert once usage passes them; caps once usage reaches them, since
+// that is the point at which downloads stop.
+func (s *server) budgetAlerts(ctx context.Context) ([]budgetAlert, error) {
+	dirs, err := s.store.ListDirectories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.store.DirectoryUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var alerts []budgetAlert
+	check := func(a budgetAlert) {
+		if a.LimitBytes > 0 && (a.UsedBytes > a.LimitBytes || a.Hard && a.UsedBytes >= a.LimitBytes) {
+			alerts = append(alerts, a)
+		}
+	}
+	var total int64
+	for _, used := range usage {
+		total += used
+	}
+	for _, d := range dirs {
+		a := budgetAlert{Scope: "directory", DirectoryID: d.ID, Name: d.Title(), UsedBytes: usage[d.ID]}
+		a.LimitBytes = d.BudgetBytes
+		check(a)
+		a.Hard, a.LimitBytes = true, d.CapBytes
+		check(a)
+	}
+	budget, capBytes := s.librarySizeLimits(ctx)
+	check(budgetAlert{Scope: "library", Name: "Library", UsedBytes: total, LimitBytes: budget})
+	check(budgetAlert{Scope: "library", Name: "Library", Hard: true, UsedBytes: total, LimitBytes: capBytes})
+	return alerts, nil
+}
+
+// checkBudgets compares usage against all limits after a scan. Newly
+// exceeded limits are logged and published; limits back within
+// bounds are forgotten so a later crossing alerts again.
+func (s *server) checkBudgets(ctx context.Context) {
+	alerts, err := s.budgetAlerts(ctx)
+	if err != nil {
+		slog.Warn("check storage budgets failed", "err", err)
+		return
+	}
+	current := make(map[string]bool, len(alerts))
+	var fresh []budgetAlert
+	s.budgetMu.Lock()
+	for _, a := range alerts {
+		current[a.key()] = true
+		if !s.budgetExceeded[a.key()] {
+			fresh = append(fresh, a)
+		}
+	}
+	s.budgetExceeded = current
+	s.budgetMu.Unlock()
+
+	if len(fresh) == 0 {
+		return
+	}
+	for _, a := range fresh {
+		slog.Warn("storage limit exceeded", "scope", a.Scope, "name", a.Name,
+			"hard", a.Hard, "used_bytes", a.UsedBytes, "limit_bytes", a.LimitBytes)
+		s.publish(ctx, store.Event{Kind: store.NotifyBudget, Message: a.String(), Audience: store.AudienceAdmins, Payload: budgetPayload(a)})
+	}
+}
+
+// budgetPayload is the JSON budget_webhook_url is sent for alert.
+func budgetPayload(alert budgetAlert) string {
+	body, _ := json.Marshal(struct {
+		Event string `json:"event"`
+		budgetAlert
+		Message string `json:"message"`
+	}{"storage_limit_exceeded", alert, alert.String()})
+	return string(body)
+}
+
+// downloadCapReached returns the cap that blocks downloads into d, if any.
+func (s *server) downloadCapReached(ctx context.Context, d store.Directory) (budgetAlert, bool) {
+	alerts, err := s.budgetAlerts(ctx)
+	if err != nil {
+		slog.Warn("check storage caps failed", "err", err)
+		return budgetAlert{}, false
+	}
+	for _, a := range alerts {
+		if a.Hard && (a.Scope == "library" || a.DirectoryID == d.ID) {
+			return a, true
+		}
+	}
+	return budgetAlert{}, false
+}
+
+// parseGigabytes reads a size typed in GB (1 GB = 1024³ bytes, as
+// formatBytes displays it). Blank means no limit.
+func parseGigabytes(v string) (int64, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, true
+	}
+	gb, err := strconv.ParseFloat(v, 64)
+	if err != nil || gb < 0 || math.IsInf(gb, 0) || gb > 1<<30 {
+		return 0, false
+	}
+	return int64(math.Round(gb * (1 << 30))), true
+}
+
+// formatGigabytes renders n bytes for a GB input; 0 is blank.
+func formatGigabytes(n int64) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(n)/(1<<30), 'f', -1, 64)
+}
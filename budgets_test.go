@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseGigabytes(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"", 0, true},
+		{"1", 1 << 30, true},
+		{" 0.5 ", 1 << 29, true},
+		{"-1", 0, false},
+		{"lots", 0, false},
+	}
+	for _, c := range cases {
+		got, ok := parseGigabytes(c.in)
+		if got != c.want || ok != c.ok {
+			t.Errorf("parseGigabytes(%q) = %d, %v; want %d, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+	if got := formatGigabytes(3 << 29); got != "1.5" {
+		t.Errorf("formatGigabytes = %q, want 1.5", got)
+	}
+}
+
+func TestBudgetAlerts(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	a, _ := srv.store.AddDirectory(ctx, "/a")
+	b, _ := srv.store.AddDirectory(ctx, "/b")
+	v1, _ := srv.store.UpsertVideo(ctx, a.ID, a.Path, "1.mp4")
+	v2, _ := srv.store.UpsertVideo(ctx, b.ID, b.Path, "2.mp4")
+	srv.store.UpdateVideoFileStat(ctx, v1.ID, 1500, time.Unix(0, 0))            //nolint:errcheck
+	srv.store.UpdateVideoFileStat(ctx, v2.ID, 500, time.Unix(0, 0))             //nolint:errcheck
+	srv.store.SetDirectoryBudget(ctx, a.ID, 1000, 0)                            //nolint:errcheck
+	srv.store.SetDirectoryBudget(ctx, b.ID, 500, 0)                             //nolint:errcheck
+	srv.store.SaveSettings(ctx, map[string]string{"library_cap_bytes": "2000"}) //nolint:errcheck
+
+	alerts, err := srv.budgetAlerts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b sits exactly on its budget, which is not over it; the library sits
+	// exactly on its cap, which is.
+	want := []budgetAlert{
+		{Scope: "directory", DirectoryID: a.ID, Name: "a", UsedBytes: 1500, LimitBytes: 1000},
+		{Scope: "library", Name: "Library", Hard: true, UsedBytes: 2000, LimitBytes: 2000},
+	}
+	if len(alerts) != len(want) {
+		t.Fatalf("got %+v, want %+v", alerts, want)
+	}
+	for i := range want {
+		if alerts[i] != want[i] {
+			t.Errorf("alert %d = %+v, want %+v", i, alerts[i], want[i])
+		}
+	}
+}
+
+func TestCheckBudgets_PostsWebhookOncePerCrossing(t *testing.T) {
+	var posts atomic.Int32
+	var last map[string]any
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		json.NewDecoder(r.Body).Decode(&last) //nolint:errcheck
+	}))
+	defer hook.Close()
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/a")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "1.mp4")
+	srv.store.UpdateVideoFileStat(ctx, v.ID, 2000, time.Unix(0, 0))                //nolint:errcheck
+	srv.store.SetDirectoryBudget(ctx, d.ID, 1000, 0)                               //nolint:errcheck
+	srv.store.SaveSettings(ctx, map[string]string{"budget_webhook_url": hook.URL}) //nolint:errcheck
+
+	srv.checkBudgets(ctx)
+	srv.checkBudgets(ctx)
+	if n := posts.Load(); n != 1 {
+		t.Fatalf("expected one webhook while the budget stays exceeded, got %d", n)
+	}
+	if last["event"] != "storage_limit_exceeded" || last["scope"] != "directory" || last["used_bytes"] != float64(2000) {
+		t.Errorf("unexpected payload %v", last)
+	}
+
+	// Back under budget, then over again: a new crossing alerts again.
+	srv.store.SetDirectoryBudget(ctx, d.ID, 5000, 0) //nolint:errcheck
+	srv.checkBudgets(ctx)
+	srv.store.SetDirectoryBudget(ctx, d.ID, 1000, 0) //nolint:errcheck
+	srv.checkBudgets(ctx)
+	if n := posts.Load(); n != 2 {
+		t.Errorf("expected a second webhook after re-crossing, got %d", n)
+	}
+}
+
+func TestHandleYTDLPDownload_RefusedAtCap(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "1.mp4")
+	srv.store.UpdateVideoFileStat(ctx, v.ID, 1000, time.Unix(0, 0)) //nolint:errcheck
+	srv.store.SetDirectoryBudget(ctx, d.ID, 0, 1000)                //nolint:errcheck
+
+	form := url.Values{"urls": {"https://example.com/clip"}, "dir_id": {itoa(d.ID)}}
+	req := httptest.NewRequest(http.MethodPost, "/ytdlp/download", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("expected 507 at the directory's cap, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleSetDirectoryBudget(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+
+	put := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/directories/"+itoa(d.ID)+"/budget", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := put(url.Values{"budget_gb": {"2"}, "cap_gb": {""}}); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got, _ := srv.store.GetDirectory(ctx, d.ID); got.BudgetBytes != 2<<30 || got.CapBytes != 0 {
+		t.Errorf("got budget %d, cap %d", got.BudgetBytes, got.CapBytes)
+	}
+	if rec := put(url.Values{"budget_gb": {"-3"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a negative budget, got %d", rec.Code)
+	}
+}
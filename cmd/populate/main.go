@@ -19,6 +19,7 @@ import (
 	"strings"
 
 	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/naming"
 )
 
 type episode struct {
@@ -80,7 +81,7 @@ func main() {
 			}
 
 			oldPath := filepath.Join(seasonDir, name)
-			newName := fmt.Sprintf("%s - %s.mp4", key, sanitize(ep.Name))
+			newName := naming.Filename(key+" - "+ep.Name, ".mp4")
 			newPath := filepath.Join(seasonDir, newName)
 
 			if oldPath != newPath {
@@ -166,18 +167,3 @@ func stripHTML(s string) string {
 	).Replace(s)
 	return strings.TrimSpace(s)
 }
-
-// sanitize makes a string safe to use as part of a filename.
-func sanitize(s string) string {
-	return strings.TrimSpace(strings.NewReplacer(
-		"/", "-",
-		"\\", "-",
-		":", "-",
-		"*", "",
-		"?", "",
-		`"`, "",
-		"<", "",
-		">", "",
-		"|", "-",
-	).Replace(s))
-}
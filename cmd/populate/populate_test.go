@@ -26,29 +26,3 @@ func TestStripHTML(t *testing.T) {
 		}
 	}
 }
-
-func TestSanitize(t *testing.T) {
-	cases := []struct {
-		in   string
-		want string
-	}{
-		{"normal", "normal"},
-		{"path/sep", "path-sep"},
-		{"back\\slash", "back-slash"},
-		{"colon:value", "colon-value"},
-		{"star*glob", "starglob"},
-		{"question?mark", "questionmark"},
-		{`quote"here`, "quotehere"},
-		{"less<than", "lessthan"},
-		{"greater>than", "greaterthan"},
-		{"pipe|char", "pipe-char"},
-		{"  trimmed  ", "trimmed"},
-		{"", ""},
-	}
-	for _, c := range cases {
-		got := sanitize(c.in)
-		if got != c.want {
-			t.Errorf("sanitize(%q) = %q, want %q", c.in, got, c.want)
-		}
-	}
-}
@@ -0,0 +1,91 @@
+// companions.go – short clips that belong to photos.
+//
+// A phone's Live Photo is a still with a clip of a few seconds beside it
+// ("IMG_1234.HEIC" and "IMG_1234.MOV"), and Motion Photos exported from
+// Android phones arrive the same way, the photo and sometimes the clip
+// named "PXL_….MP.jpg" and "PXL_….MP.mp4". After each sync, a video running no longer than
+// companionMaxDuration beside a photo of the same name is recorded as that
+// photo's companion clip. Companion clips are left out of the library list
+// unless "Include photo companion clips" is on in Settings, and out of
+// random play and the unwatched pile either way; the player names the
+// photo a clip belongs to.
+package main
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// photoExts are the extensions of the photos a companion clip can belong to.
+var photoExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".heic": true, ".heif": true, ".png": true,
+}
+
+// companionStem returns the name a photo and its companion clip share,
+// folded to lower case: name without its extension or a Motion Photo ".MP"
+// suffix, which either file may carry ("PXL_….MP.jpg", "PXL_….MP.mp4").
+func companionStem(name string) string {
+	stem := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+	return strings.TrimSuffix(stem, ".mp")
+}
+
+// photoStem returns the companionStem of a photo. ok is false when name is
+// not a photo.
+func photoStem(name string) (stem string, ok bool) {
+	if !photoExts[strings.ToLower(filepath.Ext(name))] {
+		return "", false
+	}
+	return companionStem(name), true
+}
+
+// planCompanions finds the companion clips among videos: those known to run
+// no longer than companionMaxDuration with a photo of the same name in
+// their folder. names lists a folder's file names.
+func planCompanions(videos []store.Video, names func(dir string) []string) []store.CompanionClip {
+	photos := make(map[string]map[string]string) // folder → stem → photo name
+	var clips []store.CompanionClip
+	for _, v := range videos {
+		if v.DurationS <= 0 || v.DurationS > companionMaxDuration.Seconds() {
+			continue
+		}
+		stems, ok := photos[v.DirectoryPath]
+		if !ok {
+			stems = make(map[string]string)
+			for _, name := range names(v.DirectoryPath) {
+				if stem, ok := photoStem(name); ok {
+					stems[stem] = name
+				}
+			}
+			photos[v.DirectoryPath] = stems
+		}
+		if photo, ok := stems[companionStem(v.Filename)]; ok {
+			clips = append(clips, store.CompanionClip{VideoID: v.ID, Photo: filepath.Join(v.DirectoryPath, photo)})
+		}
+	}
+	return clips
+}
+
+// linkCompanions records which of directory dirID's videos are companion
+// clips. It runs after each sync, once durations are known.
+func (s *server) linkCompanions(ctx context.Context, dirID int64) {
+	videos, err := s.store.ListVideosByDirectory(ctx, dirID)
+	if err != nil {
+		slog.Warn("link companions: list videos failed", "dirID", dirID, "err", err)
+		return
+	}
+	clips := planCompanions(videos, listDirNames)
+	if err := retryBusy(func() error { return s.store.SetDirectoryCompanions(ctx, dirID, clips) }); err != nil {
+		slog.Warn("link companions failed", "dirID", dirID, "err", err)
+	}
+}
+
+// includeCompanions reports whether the library list shows photo companion
+// clips: the include_companions setting is "true".
+func (s *server) includeCompanions(ctx context.Context) bool {
+	v, _ := s.store.GetSetting(ctx, "include_companions")
+	return v == "true"
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/internal/fixture"
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestPlanCompanions(t *testing.T) {
+	names := map[string][]string{
+		"/p": {"IMG_1234.HEIC", "IMG_1234.MOV", "PXL_20240101.MP.jpg", "PXL_20240101.mp4", "PXL_20240202.MP.jpg", "PXL_20240202.MP.mp4",
+			"clip.mp4", "long.mov", "long.jpg"},
+	}
+	videos := []store.Video{
+		{ID: 1, DirectoryPath: "/p", Filename: "IMG_1234.MOV", DurationS: 2.9},
+		{ID: 2, DirectoryPath: "/p", Filename: "PXL_20240101.mp4", DurationS: 1.5},
+		{ID: 3, DirectoryPath: "/p", Filename: "clip.mp4", DurationS: 2},   // no photo
+		{ID: 4, DirectoryPath: "/p", Filename: "long.mov", DurationS: 600}, // a video with a poster
+		{ID: 5, DirectoryPath: "/q", Filename: "IMG_1234.MOV"},             // duration unknown
+		{ID: 6, DirectoryPath: "/p", Filename: "PXL_20240202.MP.mp4", DurationS: 1.5},
+	}
+	got := planCompanions(videos, func(dir string) []string { return names[dir] })
+	want := []store.CompanionClip{
+		{VideoID: 1, Photo: filepath.Join("/p", "IMG_1234.HEIC")},
+		{VideoID: 2, Photo: filepath.Join("/p", "PXL_20240101.MP.jpg")},
+		{VideoID: 6, Photo: filepath.Join("/p", "PXL_20240202.MP.jpg")},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("planCompanions = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("clip %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLinkCompanions(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := t.Context()
+	root := t.TempDir()
+	for _, f := range []string{"IMG_0001.HEIC", "IMG_0001.MOV", "Holiday.mp4"} {
+		os.WriteFile(filepath.Join(root, f), []byte("data"), 0644) //nolint:errcheck
+	}
+	d, _ := srv.store.AddDirectory(ctx, root)
+	live := fixture.AddVideo(t, srv.store, d, fixture.Video{Filename: "IMG_0001.MOV", Duration: 3})
+	fixture.AddVideo(t, srv.store, d, fixture.Video{Filename: "Holiday.mp4", Duration: 900})
+	srv.linkCompanions(ctx, d.ID)
+
+	if c, err := srv.store.GetCompanionClip(ctx, live.ID); err != nil || c.Photo != filepath.Join(root, "IMG_0001.HEIC") {
+		t.Fatalf("companion = %+v, %v", c, err)
+	}
+	body := doAs(srv, nil, http.MethodGet, "/videos", nil).Body.String()
+	if strings.Contains(body, "IMG_0001") || !strings.Contains(body, "Holiday") {
+		t.Errorf("library list shows the companion clip:\n%s", body)
+	}
+	if _, err := srv.store.GetRandomVideoFiltered(ctx, store.RandomFilter{Exclude: []int64{live.ID + 1}}); err == nil {
+		t.Error("random play picked the companion clip")
+	}
+	if body := doAs(srv, nil, http.MethodGet, "/play/"+itoa(live.ID), nil).Body.String(); !strings.Contains(body, "Companion clip of the photo") {
+		t.Error("player doesn't name the photo")
+	}
+
+	// With the toggle on they are listed, and marked.
+	srv.store.SaveSettings(ctx, map[string]string{"include_companions": "true"}) //nolint:errcheck
+	body = doAs(srv, nil, http.MethodGet, "/videos", nil).Body.String()
+	if !strings.Contains(body, "IMG_0001") || !strings.Contains(body, "Photo companion clip") {
+		t.Errorf("included companion clip not listed and marked:\n%s", body)
+	}
+	if rec := doAs(srv, nil, http.MethodPost, "/settings", url.Values{}); rec.Code != http.StatusOK {
+		t.Fatalf("save settings: got %d", rec.Code)
+	}
+	if srv.includeCompanions(ctx) {
+		t.Error("unchecked setting left companions included")
+	}
+
+	// Once the photo is gone the clip is an ordinary video.
+	os.Remove(filepath.Join(root, "IMG_0001.HEIC")) //nolint:errcheck
+	srv.linkCompanions(ctx, d.ID)
+	if _, err := srv.store.GetCompanionClip(ctx, live.ID); err != store.ErrNotFound {
+		t.Errorf("companion after the photo was removed: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+// cors.go – cross-origin access to the JSON API.
+//
+// Browsers only let pages served by video_manger itself read the /api/*
+// responses. -cors-origins names other origins, such as a separately hosted
+// web app ("https://app.example.com"), that may call the API directly, and
+// -cors-methods the methods they may use. Listed origins may send the
+// session cookie. "*" admits any origin, but without cookies, so it only
+// suits a server that needs no sign-in.
+//
+// A listed origin is trusted: its /api/* requests skip the CSRF token check,
+// which a page on another origin cannot pass because it cannot read the
+// token cookie.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// corsPolicy is the parsed -cors-origins and -cors-methods.
+type corsPolicy struct {
+	origins   []string // e.g. "https://app.example.com"
+	anyOrigin bool     // "*" was listed
+	methods   []string // e.g. GET, HEAD
+}
+
+// parseCORSPolicy parses comma-separated origins and methods. An origin is
+// "*" or a scheme and host with no path, e.g. "http://nas.local:3000".
+func parseCORSPolicy(origins, methods string) (*corsPolicy, error) {
+	p := &corsPolicy{}
+	for _, o := range strings.Split(origins, ",") {
+		if o = strings.TrimSpace(o); o == "" {
+			continue
+		}
+		if o == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.User != nil {
+			return nil, fmt.Errorf("invalid origin %q: want e.g. https://app.example.com", o)
+		}
+		p.origins = append(p.origins, strings.ToLower(u.Scheme+"://"+u.Host))
+	}
+	for _, m := range strings.Split(methods, ",") {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m == "" {
+			continue
+		}
+		switch m {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			p.methods = append(p.methods, m)
+		default:
+			return nil, fmt.Errorf("invalid method %q", m)
+		}
+	}
+	if len(p.methods) == 0 {
+		return nil, fmt.Errorf("no methods allowed")
+	}
+	return p, nil
+}
+
+// listed reports whether origin was named in -cors-origins.
+func (p *corsPolicy) listed(origin string) bool {
+	return slices.Contains(p.origins, strings.ToLower(origin))
+}
+
+// isAPIPath reports whether the path is one of the /api/* routes CORS
+// applies to.
+func isAPIPath(path string) bool {
+	return strings.HasPrefix(path, "/api/")
+}
+
+// corsTrusted reports whether r is an API call from a listed origin using an
+// allowed method, which the CSRF check lets through.
+func (s *server) corsTrusted(r *http.Request) bool {
+	return s.cors != nil && isAPIPath(r.URL.Path) &&
+		s.cors.listed(r.Header.Get("Origin")) && slices.Contains(s.cors.methods, r.Method)
+}
+
+// corsMiddleware adds the CORS headers to /api/* responses for allowed
+// origins and answers their preflight requests, which carry no credentials
+// and so must be handled before the sign-in check.
+func (s *server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if s.cors == nil || origin == "" || !isAPIPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		switch {
+		case s.cors.listed(origin):
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+		case s.cors.anyOrigin:
+			h.Set("Access-Control-Allow-Origin", "*")
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", strings.Join(s.cors.methods, ", "))
+			h.Set("Access-Control-Allow-Headers", "Content-Type")
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
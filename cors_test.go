@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseCORSPolicy(t *testing.T) {
+	p, err := parseCORSPolicy(" https://App.example.com/ , *, http://nas.local:3000", "get, post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.anyOrigin || !p.listed("https://app.example.com") || !p.listed("http://nas.local:3000") ||
+		p.listed("https://other.example.com") {
+		t.Errorf("unexpected origins: %+v", p)
+	}
+	if strings.Join(p.methods, ",") != "GET,POST" {
+		t.Errorf("unexpected methods: %v", p.methods)
+	}
+	for _, c := range []struct{ origins, methods string }{
+		{"app.example.com", "GET"},
+		{"ftp://app.example.com", "GET"},
+		{"https://app.example.com/path", "GET"},
+		{"https://app.example.com", "TRACE"},
+		{"https://app.example.com", ""},
+	} {
+		if _, err := parseCORSPolicy(c.origins, c.methods); err == nil {
+			t.Errorf("parseCORSPolicy(%q, %q): expected an error", c.origins, c.methods)
+		}
+	}
+}
+
+func TestCORS_ListedOrigin(t *testing.T) {
+	srv := newTestServerWithAuth(t, "secret")
+	srv.cors, _ = parseCORSPolicy("https://app.example.com", "GET,POST")
+
+	rec := doAs(srv, nil, http.MethodOptions, "/api/tags", nil, withHeader("Origin", "https://app.example.com"), func(r *http.Request) {
+		r.Header.Set("Access-Control-Request-Method", "GET")
+	})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("preflight: expected 204 without signing in, got %d", rec.Code)
+	}
+	h := rec.Header()
+	if h.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		h.Get("Access-Control-Allow-Credentials") != "true" ||
+		h.Get("Access-Control-Allow-Methods") != "GET, POST" {
+		t.Errorf("unexpected preflight headers: %v", h)
+	}
+
+	rec = doAs(srv, nil, http.MethodGet, "/api/tags", nil, withHeader("Origin", "https://app.example.com"))
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("expected the origin to be allowed on the response, got %v", rec.Header())
+	}
+	if rec.Code != http.StatusFound {
+		t.Errorf("expected the API to still require sign-in, got %d", rec.Code)
+	}
+
+	// A listed origin cannot read the CSRF cookie, so its API calls are
+	// trusted instead.
+	req := httptest.NewRequest(http.MethodPost, "/api/folder-background", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	if !srv.corsTrusted(req) {
+		t.Error("expected a POST from the listed origin to be trusted")
+	}
+}
+
+func TestCORS_OtherOriginsAndPaths(t *testing.T) {
+	srv := newTestServer(t)
+	srv.cors, _ = parseCORSPolicy("https://app.example.com", "GET")
+
+	for _, c := range []struct{ target, origin string }{
+		{"/api/tags", "https://evil.example.com"},
+		{"/settings", "https://app.example.com"},
+	} {
+		rec := doAs(srv, nil, http.MethodGet, c.target, nil, withHeader("Origin", c.origin))
+		if v := rec.Header().Get("Access-Control-Allow-Origin"); v != "" {
+			t.Errorf("%s from %s: expected no CORS headers, got %q", c.target, c.origin, v)
+		}
+	}
+
+	// POST is not an allowed method, so the CSRF check still applies.
+	req := httptest.NewRequest(http.MethodPost, "/api/folder-background", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	if srv.corsTrusted(req) {
+		t.Error("expected a method outside -cors-methods not to be trusted")
+	}
+
+	srv.cors, _ = parseCORSPolicy("*", "GET")
+	rec := doAs(srv, nil, http.MethodGet, "/api/tags", nil, withHeader("Origin", "https://any.example.com"))
+	if rec.Header().Get("Access-Control-Allow-Origin") != "*" || rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("wildcard: expected * without credentials, got %v", rec.Header())
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("wildcard: expected 200, got %d", rec.Code)
+	}
+}
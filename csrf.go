@@ -0,0 +1,89 @@
+// csrf.go – cross-site request forgery protection.
+//
+// Every visitor gets a random token in an HttpOnly csrf_token cookie. Pages
+// embed the same token (a <meta name="csrf-token"> tag and the login form),
+// and the page scripts send it back with every state-changing request: htmx
+// and fetch as an X-CSRF-Token header, plain form posts and sendBeacon as a
+// csrf_token field. A POST, PUT, PATCH or DELETE whose token does not match
+// the cookie is refused with 403.
+//
+// Only browsers can be tricked into sending such requests, and they label
+// every one with an Origin or Sec-Fetch-Site header, so requests without
+// either (curl, scripts, the Roku channel) are not checked. Requests with an
+// Authorization header are token-authenticated API calls, which a browser
+// never attaches cross-site by itself, and are exempt as well, as are API
+// calls from the origins trusted by -cors-origins (see cors.go).
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+)
+
+const (
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+	csrfField  = "csrf_token"
+)
+
+// csrfKey is the request context key holding the visitor's CSRF token.
+type csrfKey struct{}
+
+// csrfToken returns the token pages must embed for this request.
+func csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey{}).(string)
+	return token
+}
+
+// csrfExempt reports whether a request needs no token: safe methods,
+// token-authenticated API calls, and requests that did not come from a
+// browser.
+func csrfExempt(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	if r.Header.Get("Authorization") != "" {
+		return true
+	}
+	return r.Header.Get("Origin") == "" && r.Header.Get("Sec-Fetch-Site") == ""
+}
+
+// csrfMiddleware issues the CSRF cookie and checks the token on
+// state-changing browser requests.
+func (s *server) csrfMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		if c, err := r.Cookie(csrfCookie); err == nil && len(c.Value) == 32 {
+			token = c.Value
+		}
+		if !csrfExempt(r) && !s.corsTrusted(r) {
+			sent := r.Header.Get(csrfHeader)
+			if sent == "" {
+				sent = r.PostFormValue(csrfField)
+			}
+			if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				http.Error(w, "invalid or missing CSRF token — reload the page and try again", http.StatusForbidden)
+				return
+			}
+		}
+		// Pages are fetched with GET, so that is where a new visitor's token
+		// is issued.
+		if token == "" && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			token = newToken()
+			// Lax so the cookie survives arriving from another site (e.g.
+			// the OIDC callback); the token check does the protecting.
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookie,
+				Value:    token,
+				Path:     "/",
+				MaxAge:   int(sessionTTL.Seconds()),
+				HttpOnly: true,
+				Secure:   s.secureCookies,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfKey{}, token)))
+	})
+}
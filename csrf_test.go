@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// csrfCookieFrom fetches the index page and returns the issued CSRF cookie.
+func csrfCookieFrom(t *testing.T, srv *server) *http.Cookie {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == csrfCookie {
+			if !strings.Contains(rec.Body.String(), `<meta name="csrf-token" content="`+c.Value+`">`) {
+				t.Error("expected the page to embed the cookie's token")
+			}
+			return c
+		}
+	}
+	t.Fatal("expected a csrf_token cookie on the index page")
+	return nil
+}
+
+func TestCSRF_BrowserPostsNeedToken(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	cookie := csrfCookieFrom(t, srv)
+	target := "/videos/" + itoa(v.ID) + "/rating"
+
+	post := func(form url.Values, header func(*http.Request)) int {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Origin", "http://example.com")
+		req.AddCookie(cookie)
+		if header != nil {
+			header(req)
+		}
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	rating := url.Values{"rating": {"1"}}
+	if code := post(rating, nil); code != http.StatusForbidden {
+		t.Errorf("no token: expected 403, got %d", code)
+	}
+	if code := post(rating, func(r *http.Request) { r.Header.Set(csrfHeader, "0123456789abcdef0123456789abcdef") }); code != http.StatusForbidden {
+		t.Errorf("wrong token: expected 403, got %d", code)
+	}
+	if code := post(rating, func(r *http.Request) { r.Header.Set(csrfHeader, cookie.Value) }); code != http.StatusOK {
+		t.Errorf("header token: expected 200, got %d", code)
+	}
+	if code := post(url.Values{"rating": {"2"}, csrfField: {cookie.Value}}, nil); code != http.StatusOK {
+		t.Errorf("form token: expected 200, got %d", code)
+	}
+	if code := post(rating, func(r *http.Request) { r.Header.Set("Authorization", "Bearer api-token") }); code != http.StatusOK {
+		t.Errorf("token-authenticated API call: expected exemption, got %d", code)
+	}
+}
+
+func TestCSRF_CrossSiteWithoutCookieRefused(t *testing.T) {
+	srv := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/settings", strings.NewReader("video_sort=rating"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+	if v, _ := srv.store.GetSetting(context.Background(), "video_sort"); v == "rating" {
+		t.Error("expected the forged post not to change settings")
+	}
+}
+
+func TestCSRF_NonBrowserClientsUnchecked(t *testing.T) {
+	srv := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/settings", strings.NewReader("video_sort=rating"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected a request without Origin or Sec-Fetch-Site to pass, got %d", rec.Code)
+	}
+}
+
+func TestCSRF_LoginFormCarriesToken(t *testing.T) {
+	srv := newTestServerWithAuth(t, "secret")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == csrfCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !strings.Contains(rec.Body.String(), `name="csrf_token" value="`+cookie.Value+`"`) {
+		t.Fatal("expected the login form to carry the CSRF token")
+	}
+
+	form := url.Values{"password": {"secret"}, csrfField: {cookie.Value}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "http://example.com")
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Errorf("expected the browser login to succeed, got %d", rec.Code)
+	}
+}
+
+// TestCSRF_CookieSecureMatchesSession checks the CSRF cookie follows the
+// session cookie's Secure rule even when TLS ends at a reverse proxy.
+func TestCSRF_CookieSecureMatchesSession(t *testing.T) {
+	srv := newTestServer(t)
+	srv.secureCookies = true
+	if c := csrfCookieFrom(t, srv); !c.Secure {
+		t.Error("expected a Secure csrf_token cookie behind a TLS-terminating proxy")
+	}
+}
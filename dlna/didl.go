@@ -0,0 +1,78 @@
+package dlna
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Object is an entry in a Browse result: a container the TV can open, or
+// an item it can play.
+type Object struct {
+	ID       string
+	ParentID string
+	Title    string
+	// Container marks a folder. ChildCount is reported for it when
+	// positive; counting is optional and skipped where it is costly.
+	Container  bool
+	ChildCount int
+	// Res is an item's media resource.
+	Res Resource
+	// AlbumArtURI is an optional poster image for an item.
+	AlbumArtURI string
+}
+
+// Resource is where an item's bytes are streamed from.
+type Resource struct {
+	URL          string
+	ProtocolInfo string  // see ProtocolInfo
+	Size         int64   // bytes; 0 when unknown
+	DurationS    float64 // 0 when unknown
+	Width        int     // 0 when unknown
+	Height       int
+}
+
+// DIDL renders objs as a DIDL-Lite document, the Result of a Browse.
+func DIDL(objs []Object) string {
+	var b strings.Builder
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/"` +
+		` xmlns:dc="http://purl.org/dc/elements/1.1/"` +
+		` xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/"` +
+		` xmlns:dlna="urn:schemas-dlna-org:metadata-1-0/">`)
+	for _, o := range objs {
+		if o.Container {
+			fmt.Fprintf(&b, `<container id="%s" parentID="%s" restricted="1"`, escape(o.ID), escape(o.ParentID))
+			if o.ChildCount > 0 {
+				fmt.Fprintf(&b, ` childCount="%d"`, o.ChildCount)
+			}
+			fmt.Fprintf(&b, `><dc:title>%s</dc:title><upnp:class>object.container.storageFolder</upnp:class></container>`,
+				escape(o.Title))
+			continue
+		}
+		fmt.Fprintf(&b, `<item id="%s" parentID="%s" restricted="1"><dc:title>%s</dc:title>`+
+			`<upnp:class>object.item.videoItem</upnp:class>`,
+			escape(o.ID), escape(o.ParentID), escape(o.Title))
+		if o.AlbumArtURI != "" {
+			fmt.Fprintf(&b, `<upnp:albumArtURI dlna:profileID="JPEG_TN">%s</upnp:albumArtURI>`, escape(o.AlbumArtURI))
+		}
+		fmt.Fprintf(&b, `<res protocolInfo="%s"`, escape(o.Res.ProtocolInfo))
+		if o.Res.Size > 0 {
+			fmt.Fprintf(&b, ` size="%d"`, o.Res.Size)
+		}
+		if o.Res.DurationS > 0 {
+			fmt.Fprintf(&b, ` duration="%s"`, duration(o.Res.DurationS))
+		}
+		if o.Res.Width > 0 && o.Res.Height > 0 {
+			fmt.Fprintf(&b, ` resolution="%dx%d"`, o.Res.Width, o.Res.Height)
+		}
+		fmt.Fprintf(&b, `>%s</res></item>`, escape(o.Res.URL))
+	}
+	b.WriteString(`</DIDL-Lite>`)
+	return b.String()
+}
+
+// duration formats secs as a DIDL-Lite duration, H:MM:SS.mmm.
+func duration(secs float64) string {
+	ms := int64(secs*1000 + 0.5)
+	return strconv.FormatInt(ms/3600000, 10) + fmt.Sprintf(":%02d:%02d.%03d", ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,261 @@
+// Package dlna speaks the UPnP AV protocols smart TVs use to find and browse
+// a media server on the LAN: SSDP discovery, the device and service
+// descriptions, SOAP control requests and DIDL-Lite listings.
+//
+// It holds no library knowledge. The caller serves the documents built here
+// over HTTP, answers ContentDirectory Browse actions from its own catalogue
+// and streams the files the listed resources point at.
+package dlna
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Service types and IDs of the two services a MediaServer offers.
+const (
+	DeviceType                = "urn:schemas-upnp-org:device:MediaServer:1"
+	ContentDirectoryType      = "urn:schemas-upnp-org:service:ContentDirectory:1"
+	ConnectionManagerType     = "urn:schemas-upnp-org:service:ConnectionManager:1"
+	contentDirectoryServiceID = "urn:upnp-org:serviceId:ContentDirectory"
+	connectionManagerID       = "urn:upnp-org:serviceId:ConnectionManager"
+)
+
+// Paths the device description points clients at, relative to the server
+// root. The caller routes them.
+const (
+	DescriptionPath           = "/dlna/device.xml"
+	ContentDirectorySCPDPath  = "/dlna/ContentDirectory.xml"
+	ConnectionManagerSCPDPath = "/dlna/ConnectionManager.xml"
+	ControlPath               = "/dlna/control/" // + "ContentDirectory" or "ConnectionManager"
+	EventPath                 = "/dlna/event/"   // + "ContentDirectory" or "ConnectionManager"
+)
+
+// DeviceDescription returns the root device document for a server called
+// name whose unique device name is "uuid:"+uuid.
+func DeviceDescription(name, uuid string) []byte {
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0" xmlns:dlna="urn:schemas-dlna-org:device-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <device>
+    <deviceType>%s</deviceType>
+    <friendlyName>%s</friendlyName>
+    <manufacturer>video_manger</manufacturer>
+    <modelName>video_manger</modelName>
+    <UDN>uuid:%s</UDN>
+    <dlna:X_DLNADOC>DMS-1.50</dlna:X_DLNADOC>
+    <serviceList>
+      <service>
+        <serviceType>%s</serviceType>
+        <serviceId>%s</serviceId>
+        <SCPDURL>%s</SCPDURL>
+        <controlURL>%sContentDirectory</controlURL>
+        <eventSubURL>%sContentDirectory</eventSubURL>
+      </service>
+      <service>
+        <serviceType>%s</serviceType>
+        <serviceId>%s</serviceId>
+        <SCPDURL>%s</SCPDURL>
+        <controlURL>%sConnectionManager</controlURL>
+        <eventSubURL>%sConnectionManager</eventSubURL>
+      </service>
+    </serviceList>
+  </device>
+</root>
+`, DeviceType, escape(name), escape(uuid),
+		ContentDirectoryType, contentDirectoryServiceID, ContentDirectorySCPDPath, ControlPath, EventPath,
+		ConnectionManagerType, connectionManagerID, ConnectionManagerSCPDPath, ControlPath, EventPath))
+}
+
+// ContentDirectorySCPD describes the ContentDirectory actions the server
+// answers: browsing, but not searching.
+const ContentDirectorySCPD = `<?xml version="1.0" encoding="utf-8"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <actionList>
+    <action>
+      <name>Browse</name>
+      <argumentList>
+        <argument><name>ObjectID</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_ObjectID</relatedStateVariable></argument>
+        <argument><name>BrowseFlag</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_BrowseFlag</relatedStateVariable></argument>
+        <argument><name>Filter</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_Filter</relatedStateVariable></argument>
+        <argument><name>StartingIndex</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_Index</relatedStateVariable></argument>
+        <argument><name>RequestedCount</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_Count</relatedStateVariable></argument>
+        <argument><name>SortCriteria</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_SortCriteria</relatedStateVariable></argument>
+        <argument><name>Result</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Result</relatedStateVariable></argument>
+        <argument><name>NumberReturned</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Count</relatedStateVariable></argument>
+        <argument><name>TotalMatches</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Count</relatedStateVariable></argument>
+        <argument><name>UpdateID</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_UpdateID</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>GetSearchCapabilities</name>
+      <argumentList>
+        <argument><name>SearchCaps</name><direction>out</direction><relatedStateVariable>SearchCapabilities</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>GetSortCapabilities</name>
+      <argumentList>
+        <argument><name>SortCaps</name><direction>out</direction><relatedStateVariable>SortCapabilities</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>GetSystemUpdateID</name>
+      <argumentList>
+        <argument><name>Id</name><direction>out</direction><relatedStateVariable>SystemUpdateID</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+  </actionList>
+  <serviceStateTable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_ObjectID</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_BrowseFlag</name><dataType>string</dataType>
+      <allowedValueList><allowedValue>BrowseMetadata</allowedValue><allowedValue>BrowseDirectChildren</allowedValue></allowedValueList>
+    </stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Filter</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Index</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Count</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_SortCriteria</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Result</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_UpdateID</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>SearchCapabilities</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>SortCapabilities</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>SystemUpdateID</name><dataType>ui4</dataType></stateVariable>
+  </serviceStateTable>
+</scpd>
+`
+
+// ConnectionManagerSCPD describes the ConnectionManager actions. Clients
+// call them to learn which formats the server offers; the server has no
+// connections to manage beyond the implicit one, ID 0.
+const ConnectionManagerSCPD = `<?xml version="1.0" encoding="utf-8"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <actionList>
+    <action>
+      <name>GetProtocolInfo</name>
+      <argumentList>
+        <argument><name>Source</name><direction>out</direction><relatedStateVariable>SourceProtocolInfo</relatedStateVariable></argument>
+        <argument><name>Sink</name><direction>out</direction><relatedStateVariable>SinkProtocolInfo</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>GetCurrentConnectionIDs</name>
+      <argumentList>
+        <argument><name>ConnectionIDs</name><direction>out</direction><relatedStateVariable>CurrentConnectionIDs</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>GetCurrentConnectionInfo</name>
+      <argumentList>
+        <argument><name>ConnectionID</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_ConnectionID</relatedStateVariable></argument>
+        <argument><name>RcsID</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_RcsID</relatedStateVariable></argument>
+        <argument><name>AVTransportID</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_AVTransportID</relatedStateVariable></argument>
+        <argument><name>ProtocolInfo</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_ProtocolInfo</relatedStateVariable></argument>
+        <argument><name>PeerConnectionManager</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_ConnectionManager</relatedStateVariable></argument>
+        <argument><name>PeerConnectionID</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_ConnectionID</relatedStateVariable></argument>
+        <argument><name>Direction</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Direction</relatedStateVariable></argument>
+        <argument><name>Status</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_ConnectionStatus</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+  </actionList>
+  <serviceStateTable>
+    <stateVariable sendEvents="yes"><name>SourceProtocolInfo</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>SinkProtocolInfo</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>CurrentConnectionIDs</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_ConnectionStatus</name><dataType>string</dataType>
+      <allowedValueList><allowedValue>OK</allowedValue><allowedValue>ContentFormatMismatch</allowedValue><allowedValue>InsufficientBandwidth</allowedValue><allowedValue>UnreliableChannel</allowedValue><allowedValue>Unknown</allowedValue></allowedValueList>
+    </stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_ConnectionManager</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Direction</name><dataType>string</dataType>
+      <allowedValueList><allowedValue>Input</allowedValue><allowedValue>Output</allowedValue></allowedValueList>
+    </stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_ProtocolInfo</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_ConnectionID</name><dataType>i4</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_AVTransportID</name><dataType>i4</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_RcsID</name><dataType>i4</dataType></stateVariable>
+  </serviceStateTable>
+</scpd>
+`
+
+// videoMIME maps video file extensions to the MIME types TVs expect; the
+// standard library's table lacks most of them.
+var videoMIME = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mkv":  "video/x-matroska",
+	".webm": "video/webm",
+	".avi":  "video/x-msvideo",
+	".divx": "video/x-msvideo",
+	".xvid": "video/x-msvideo",
+	".mov":  "video/quicktime",
+	".wmv":  "video/x-ms-wmv",
+	".flv":  "video/x-flv",
+	".ts":   "video/mp2t",
+	".m2ts": "video/mp2t",
+	".mpeg": "video/mpeg",
+	".mpg":  "video/mpeg",
+	".vob":  "video/mpeg",
+	".ogg":  "video/ogg",
+	".ogv":  "video/ogg",
+	".3gp":  "video/3gpp",
+}
+
+// MIMEType returns the MIME type of a video file from its extension.
+func MIMEType(filename string) string {
+	if m, ok := videoMIME[strings.ToLower(filepath.Ext(filename))]; ok {
+		return m
+	}
+	return "video/mpeg"
+}
+
+// ContentFeatures is the DLNA fourth field of a resource's protocolInfo,
+// also sent as the contentFeatures.dlna.org header: byte-range seeking
+// (OP=01), an original file rather than a transcode (CI=0), and streaming
+// transfer.
+const ContentFeatures = "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+
+// ProtocolInfo returns the protocolInfo of a file of the given MIME type
+// served over HTTP.
+func ProtocolInfo(mime string) string {
+	return "http-get:*:" + mime + ":" + ContentFeatures
+}
+
+// SourceProtocolInfo lists the formats the server can offer, for
+// GetProtocolInfo.
+func SourceProtocolInfo() string {
+	seen := map[string]bool{}
+	var infos []string
+	for _, m := range videoMIME {
+		if !seen[m] {
+			seen[m] = true
+			infos = append(infos, "http-get:*:"+m+":*")
+		}
+	}
+	// Map order is random; keep the answer stable.
+	slices.Sort(infos)
+	return strings.Join(infos, ",")
+}
+
+// SetStreamHeaders adds the DLNA headers TVs look for on a media response.
+func SetStreamHeaders(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("getcontentFeatures.dlna.org") != "" {
+		w.Header().Set("contentFeatures.dlna.org", ContentFeatures)
+	}
+	w.Header().Set("transferMode.dlna.org", "Streaming")
+}
+
+// NewUUID returns a random (version 4) UUID, e.g. for a device's UDN.
+func NewUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("crypto/rand unavailable: " + err.Error())
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,94 @@
+package dlna
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadAction(t *testing.T) {
+	body := `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>` +
+		`<u:Browse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">` +
+		`<ObjectID>dir/3</ObjectID><BrowseFlag>BrowseDirectChildren</BrowseFlag><Filter>*</Filter>` +
+		`<StartingIndex>10</StartingIndex><RequestedCount>5</RequestedCount><SortCriteria/>` +
+		`</u:Browse></s:Body></s:Envelope>`
+	req := httptest.NewRequest("POST", "/dlna/control/ContentDirectory", strings.NewReader(body))
+	req.Header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ContentDirectory:1#Browse"`)
+	a, err := ReadAction(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Service != ContentDirectoryType || a.Name != "Browse" {
+		t.Errorf("got %s#%s", a.Service, a.Name)
+	}
+	want := map[string]string{"ObjectID": "dir/3", "BrowseFlag": "BrowseDirectChildren", "StartingIndex": "10", "RequestedCount": "5", "SortCriteria": ""}
+	for k, v := range want {
+		if got, ok := a.Args[k]; !ok || got != v {
+			t.Errorf("arg %s = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestReadAction_MissingHeader(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("<x/>"))
+	if _, err := ReadAction(req); err == nil {
+		t.Error("expected an error without SOAPACTION")
+	}
+}
+
+func TestDIDL(t *testing.T) {
+	got := DIDL([]Object{
+		{ID: "dir/1", ParentID: "dirs", Title: "Films <new>", Container: true},
+		{ID: "video/2", ParentID: "dir/1", Title: "A & B", Res: Resource{
+			URL: "http://h/dlna/video/2", ProtocolInfo: ProtocolInfo("video/mp4"),
+			Size: 1000, DurationS: 3725.5, Width: 1920, Height: 1080,
+		}},
+	})
+	for _, want := range []string{
+		`<container id="dir/1" parentID="dirs" restricted="1"><dc:title>Films &lt;new&gt;</dc:title>`,
+		`<dc:title>A &amp; B</dc:title>`,
+		`size="1000" duration="1:02:05.500" resolution="1920x1080">http://h/dlna/video/2</res>`,
+		`protocolInfo="http-get:*:video/mp4:DLNA.ORG_OP=01;`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("DIDL missing %q in\n%s", want, got)
+		}
+	}
+}
+
+func TestParseSearch(t *testing.T) {
+	msg := "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 2\r\nST: ssdp:all\r\n\r\n"
+	st, mx, ok := parseSearch([]byte(msg))
+	if !ok || st != "ssdp:all" || mx != 2 {
+		t.Errorf("got %q %d %v", st, mx, ok)
+	}
+	notify := "NOTIFY * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nNTS: ssdp:alive\r\n\r\n"
+	if _, _, ok := parseSearch([]byte(notify)); ok {
+		t.Error("NOTIFY should not be taken for a search")
+	}
+}
+
+func TestSearchResponses(t *testing.T) {
+	a := &Advertiser{UUID: "abc", Port: 8082}
+	ip := net.IPv4(192, 168, 1, 2)
+	if got := a.searchResponses("ssdp:all", ip); len(got) != 5 {
+		t.Errorf("ssdp:all: %d responses, want 5", len(got))
+	}
+	got := a.searchResponses(ContentDirectoryType, ip)
+	if len(got) != 1 {
+		t.Fatalf("ContentDirectory: %d responses, want 1", len(got))
+	}
+	msg := string(got[0])
+	for _, want := range []string{
+		"LOCATION: http://192.168.1.2:8082/dlna/device.xml\r\n",
+		"USN: uuid:abc::" + ContentDirectoryType + "\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("response missing %q:\n%s", want, msg)
+		}
+	}
+	if got := a.searchResponses("urn:schemas-upnp-org:device:MediaRenderer:1", ip); len(got) != 0 {
+		t.Errorf("expected no answer for another device type")
+	}
+}
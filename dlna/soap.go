@@ -0,0 +1,144 @@
+package dlna
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxActionBytes bounds a SOAP request body; Browse requests are tiny.
+const maxActionBytes = 64 << 10
+
+// UPnP error codes returned in SOAP faults.
+const (
+	ErrInvalidAction = 401
+	ErrInvalidArgs   = 402
+	ErrNoSuchObject  = 701
+	ErrActionFailed  = 501
+)
+
+// Action is a SOAP control request, e.g. a ContentDirectory Browse.
+type Action struct {
+	Service string // service type, e.g. ContentDirectoryType
+	Name    string // e.g. "Browse"
+	Args    map[string]string
+}
+
+// Arg is one output argument of an action response. Responses list them in
+// the order the SCPD declares, which some clients rely on.
+type Arg struct {
+	Name, Value string
+}
+
+// ReadAction parses a control request from its SOAPACTION header, e.g.
+// `"urn:schemas-upnp-org:service:ContentDirectory:1#Browse"`, and the
+// arguments inside the envelope's body.
+func ReadAction(r *http.Request) (Action, error) {
+	header := strings.Trim(r.Header.Get("SOAPACTION"), `"`)
+	service, name, ok := strings.Cut(header, "#")
+	if !ok || service == "" || name == "" {
+		return Action{}, errors.New("missing SOAPACTION header")
+	}
+	a := Action{Service: service, Name: name, Args: map[string]string{}}
+	dec := xml.NewDecoder(io.LimitReader(r.Body, maxActionBytes))
+	// Walk to <Body><Name>, then collect its child elements' text.
+	depth, inAction := 0, false
+	var arg string
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Action{}, fmt.Errorf("parse envelope: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 3 && t.Name.Local == name:
+				inAction = true
+			case depth == 4 && inAction:
+				arg = t.Name.Local
+				text.Reset()
+			}
+		case xml.CharData:
+			if arg != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 4 && arg != "" {
+				a.Args[arg] = text.String()
+				arg = ""
+			}
+			if depth == 3 {
+				inAction = false
+			}
+			depth--
+		}
+	}
+	return a, nil
+}
+
+// WriteResponse answers action a with the given output arguments.
+func WriteResponse(w http.ResponseWriter, a Action, out []Arg) {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<u:%sResponse xmlns:u="%s">`, a.Name, escape(a.Service))
+	for _, arg := range out {
+		fmt.Fprintf(&b, "<%s>%s</%s>", arg.Name, escape(arg.Value), arg.Name)
+	}
+	fmt.Fprintf(&b, `</u:%sResponse>`, a.Name)
+	writeEnvelope(w, http.StatusOK, b.String())
+}
+
+// WriteFault answers a failed action with a UPnP error code such as
+// ErrNoSuchObject.
+func WriteFault(w http.ResponseWriter, code int, description string) {
+	writeEnvelope(w, http.StatusInternalServerError, `<s:Fault>`+
+		`<faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring>`+
+		`<detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0">`+
+		`<errorCode>`+strconv.Itoa(code)+`</errorCode>`+
+		`<errorDescription>`+escape(description)+`</errorDescription>`+
+		`</UPnPError></detail></s:Fault>`)
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header().Set("EXT", "")
+	w.WriteHeader(status)
+	fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`+
+		`<s:Body>`+body+`</s:Body></s:Envelope>`)
+}
+
+// escape returns s with XML's special characters escaped.
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s)) //nolint:errcheck // strings.Builder never fails
+	return b.String()
+}
+
+// HandleEvent accepts SUBSCRIBE and UNSUBSCRIBE requests for a service's
+// events. Some TVs refuse a server that rejects subscriptions, but the
+// library's listings are re-read on every Browse, so no events are sent.
+func HandleEvent(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "SUBSCRIBE":
+		sid := r.Header.Get("SID")
+		if sid == "" {
+			sid = "uuid:" + NewUUID()
+		}
+		w.Header().Set("SID", sid)
+		w.Header().Set("TIMEOUT", "Second-1800")
+		w.WriteHeader(http.StatusOK)
+	case "UNSUBSCRIBE":
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
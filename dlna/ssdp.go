@@ -0,0 +1,200 @@
+package dlna
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ssdpAddr is the SSDP multicast group and port.
+var ssdpAddr = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+// ssdpMaxAge is how long clients may cache an announcement. It is
+// re-announced at half that interval.
+const ssdpMaxAge = 30 * time.Minute
+
+// Advertiser announces the media server on the LAN over SSDP and answers
+// clients searching for it.
+type Advertiser struct {
+	UUID string // unique device name, without the "uuid:" prefix
+	Port int    // HTTP port serving DescriptionPath
+}
+
+// notificationTypes are the targets the device answers to: the root device,
+// its UUID, its device type and its two services.
+func (a *Advertiser) notificationTypes() []string {
+	return []string{"upnp:rootdevice", "uuid:" + a.UUID, DeviceType, ContentDirectoryType, ConnectionManagerType}
+}
+
+// usn is the unique service name for notification type nt.
+func (a *Advertiser) usn(nt string) string {
+	if nt == "uuid:"+a.UUID {
+		return nt
+	}
+	return "uuid:" + a.UUID + "::" + nt
+}
+
+// location is the device description URL as reached on local address ip.
+func (a *Advertiser) location(ip net.IP) string {
+	return "http://" + net.JoinHostPort(ip.String(), strconv.Itoa(a.Port)) + DescriptionPath
+}
+
+const ssdpServer = "Linux/1.0 UPnP/1.0 video_manger/1.0"
+
+// Run announces the server and answers searches until ctx is cancelled,
+// then says goodbye. It returns an error only when the multicast group
+// cannot be joined.
+func (a *Advertiser) Run(ctx context.Context) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, ssdpAddr)
+	if err != nil {
+		return fmt.Errorf("join SSDP group: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close() //nolint:errcheck
+	}()
+	go func() {
+		a.notify("ssdp:alive")
+		ticker := time.NewTicker(ssdpMaxAge / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				a.notify("ssdp:byebye")
+				return
+			case <-ticker.C:
+				a.notify("ssdp:alive")
+			}
+		}
+	}()
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.Warn("SSDP read failed", "err", err)
+			continue
+		}
+		st, mx, ok := parseSearch(buf[:n])
+		if !ok {
+			continue
+		}
+		// Spread replies over the MX seconds the client allows, as the
+		// spec asks, so many servers don't answer in one burst.
+		delay := time.Duration(rand.Int64N(int64(min(mx, 5)*int(time.Second)) + 1))
+		time.AfterFunc(delay, func() { a.reply(from, st) })
+	}
+}
+
+// parseSearch reads an M-SEARCH request, returning its search target and
+// MX delay in seconds.
+func parseSearch(packet []byte) (st string, mx int, ok bool) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(packet)))
+	if err != nil || req.Method != "M-SEARCH" || req.Header.Get("MAN") != `"ssdp:discover"` {
+		return "", 0, false
+	}
+	mx, _ = strconv.Atoi(req.Header.Get("MX"))
+	return req.Header.Get("ST"), max(mx, 0), true
+}
+
+// searchResponses builds the replies to a search for st, as seen by a
+// client reaching the server on local address ip.
+func (a *Advertiser) searchResponses(st string, ip net.IP) [][]byte {
+	var out [][]byte
+	for _, nt := range a.notificationTypes() {
+		if st != "ssdp:all" && st != nt {
+			continue
+		}
+		out = append(out, []byte("HTTP/1.1 200 OK\r\n"+
+			"CACHE-CONTROL: max-age="+strconv.Itoa(int(ssdpMaxAge.Seconds()))+"\r\n"+
+			"DATE: "+time.Now().UTC().Format(http.TimeFormat)+"\r\n"+
+			"EXT:\r\n"+
+			"LOCATION: "+a.location(ip)+"\r\n"+
+			"SERVER: "+ssdpServer+"\r\n"+
+			"ST: "+nt+"\r\n"+
+			"USN: "+a.usn(nt)+"\r\n\r\n"))
+	}
+	return out
+}
+
+// reply answers a search from a client. Connecting the UDP socket picks
+// the local address the client can reach, which goes in LOCATION.
+func (a *Advertiser) reply(to *net.UDPAddr, st string) {
+	conn, err := net.DialUDP("udp4", nil, to)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	ip := conn.LocalAddr().(*net.UDPAddr).IP
+	for _, msg := range a.searchResponses(st, ip) {
+		conn.Write(msg) //nolint:errcheck
+	}
+}
+
+// notifyMessages builds the NOTIFY announcements sent from local address
+// ip; nts is "ssdp:alive" or "ssdp:byebye".
+func (a *Advertiser) notifyMessages(nts string, ip net.IP) [][]byte {
+	var out [][]byte
+	for _, nt := range a.notificationTypes() {
+		var b strings.Builder
+		b.WriteString("NOTIFY * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\n")
+		if nts == "ssdp:alive" {
+			b.WriteString("CACHE-CONTROL: max-age=" + strconv.Itoa(int(ssdpMaxAge.Seconds())) + "\r\n")
+			b.WriteString("LOCATION: " + a.location(ip) + "\r\n")
+			b.WriteString("SERVER: " + ssdpServer + "\r\n")
+		}
+		b.WriteString("NT: " + nt + "\r\nNTS: " + nts + "\r\nUSN: " + a.usn(nt) + "\r\n\r\n")
+		out = append(out, []byte(b.String()))
+	}
+	return out
+}
+
+// notify multicasts announcements from every up, non-loopback IPv4
+// address, each pointing at the description on that address.
+func (a *Advertiser) notify(nts string) {
+	for _, ip := range lanAddrs() {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: ip})
+		if err != nil {
+			continue
+		}
+		for _, msg := range a.notifyMessages(nts, ip) {
+			conn.WriteToUDP(msg, ssdpAddr) //nolint:errcheck
+		}
+		conn.Close()
+	}
+}
+
+// lanAddrs lists the machine's non-loopback IPv4 addresses on interfaces
+// that are up and can multicast.
+func lanAddrs() []net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if n, ok := addr.(*net.IPNet); ok && n.IP.To4() != nil {
+				ips = append(ips, n.IP.To4())
+			}
+		}
+	}
+	return ips
+}
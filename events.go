@@ -0,0 +1,294 @@
+// events.go – one activity log for everything the server announces.
+//
+// Finished downloads, conversions and exports, new videos found by the
+// library poller, archive proposals, the nightly report, exceeded storage
+// limits and aired episodes are all published as events. publish saves each
+// one and hands it to every reader in turn: the notifications of the viewers
+// it is for, the viewers following the live stream, and the webhooks. The
+// webhook in events_webhook_url is sent every event; budget_webhook_url and
+// airing_webhook_url are sent their kind's payload, as before. The RSS feed,
+// the JSON list and the activity panel in Settings read the saved log.
+//
+// An event is for one viewer, for the admins or for everyone (see
+// store.Event); each reader only shows a viewer the events meant for them.
+//
+// GET /activity           – recent events (settings panel)
+// GET /events/stream      – new events as server-sent events; Last-Event-ID replays missed ones
+// GET /events/feed.rss    – recent events as RSS 2.0
+// GET /api/events?after=N – recent events as JSON, newer than event N
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// kindWebhooks names the setting holding each kind's own webhook, which is
+// sent the event's payload.
+var kindWebhooks = map[string]string{
+	store.NotifyBudget: "budget_webhook_url",
+	store.NotifyAiring: "airing_webhook_url",
+}
+
+// apiEvent is the JSON representation of an event, as served, streamed and
+// sent to events_webhook_url.
+type apiEvent struct {
+	ID        int64           `json:"id"`
+	Kind      string          `json:"kind"`
+	Message   string          `json:"message"`
+	VideoID   int64           `json:"video_id,omitempty"`
+	Failed    bool            `json:"failed,omitempty"`
+	CreatedAt string          `json:"created_at"`
+	Data      json.RawMessage `json:"data,omitempty"` // the kind's webhook payload
+}
+
+func eventToAPI(e store.Event) apiEvent {
+	out := apiEvent{ID: e.ID, Kind: e.Kind, Message: e.Message, VideoID: e.VideoID, Failed: e.Failed, CreatedAt: e.CreatedAt}
+	if e.Payload != "" {
+		out.Data = json.RawMessage(e.Payload)
+	}
+	return out
+}
+
+// eventVisible reports whether u may see e.
+func eventVisible(e store.Event, u store.User) bool {
+	switch e.Audience {
+	case store.AudienceEveryone:
+		return true
+	case store.AudienceAdmins:
+		return u.Role == store.RoleAdmin
+	default:
+		return e.UserID == u.ID
+	}
+}
+
+// eventQuery selects up to limit of the events u may see, newer than afterID.
+func eventQuery(u store.User, afterID int64, limit int) store.EventQuery {
+	return store.EventQuery{UserID: u.ID, Admin: u.Role == store.RoleAdmin, AfterID: afterID, Limit: limit}
+}
+
+// publish saves e to the activity log and delivers it to its readers. Like
+// the webhooks it ends with, it returns once they are done; failures are
+// logged.
+func (s *server) publish(ctx context.Context, e store.Event) {
+	saved, err := s.store.AddEvent(ctx, e, eventsKept)
+	if err != nil {
+		slog.Warn("save event failed", "kind", e.Kind, "err", err)
+		saved = e // still worth delivering
+	}
+	s.deliverNotifications(saved)
+	s.broadcastEvent(saved)
+	s.postEventWebhooks(ctx, saved)
+}
+
+// postEventWebhooks sends e to events_webhook_url and to its kind's own
+// webhook, when they are set.
+func (s *server) postEventWebhooks(ctx context.Context, e store.Event) {
+	if hook, _ := s.store.GetSetting(ctx, "events_webhook_url"); strings.TrimSpace(hook) != "" {
+		if err := postWebhook(ctx, strings.TrimSpace(hook), eventToAPI(e)); err != nil {
+			slog.Warn("events webhook failed", "url", hook, "err", err)
+		}
+	}
+	setting, ok := kindWebhooks[e.Kind]
+	if !ok || e.Payload == "" {
+		return
+	}
+	if hook, _ := s.store.GetSetting(ctx, setting); strings.TrimSpace(hook) != "" {
+		if err := postWebhook(ctx, strings.TrimSpace(hook), json.RawMessage(e.Payload)); err != nil {
+			slog.Warn(e.Kind+" webhook failed", "url", hook, "err", err)
+		}
+	}
+}
+
+// eventSub is a viewer following the live stream.
+type eventSub struct {
+	user store.User
+	ch   chan store.Event
+}
+
+// subscribeEvents starts passing the events u may see to the returned
+// subscription, until unsubscribeEvents.
+func (s *server) subscribeEvents(u store.User) *eventSub {
+	sub := &eventSub{user: u, ch: make(chan store.Event, eventSubBuffer)}
+	s.eventSubsMu.Lock()
+	if s.eventSubs == nil {
+		s.eventSubs = make(map[*eventSub]struct{})
+	}
+	s.eventSubs[sub] = struct{}{}
+	s.eventSubsMu.Unlock()
+	return sub
+}
+
+func (s *server) unsubscribeEvents(sub *eventSub) {
+	s.eventSubsMu.Lock()
+	delete(s.eventSubs, sub)
+	s.eventSubsMu.Unlock()
+}
+
+// broadcastEvent passes e to the subscribers who may see it. A subscriber
+// too far behind misses it rather than holding up the publisher; its
+// browser catches up with Last-Event-ID when it reconnects.
+func (s *server) broadcastEvent(e store.Event) {
+	s.eventSubsMu.Lock()
+	defer s.eventSubsMu.Unlock()
+	for sub := range s.eventSubs {
+		if !eventVisible(e, sub.user) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			slog.Debug("event stream subscriber behind; event dropped", "event", e.ID)
+		}
+	}
+}
+
+// GET /events/stream
+func (s *server) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	sse, ok := newSSEWriter(w)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	user := s.requestUser(r)
+	// Subscribe before replaying so nothing published in between is lost;
+	// last skips what the replay already sent.
+	sub := s.subscribeEvents(user)
+	defer s.unsubscribeEvents(sub)
+	send := func(e store.Event) {
+		data, err := json.Marshal(eventToAPI(e))
+		if err != nil {
+			return
+		}
+		sse.Message(e.ID, string(data))
+	}
+	var last int64
+	if id, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil && id > 0 {
+		missed, err := s.store.ListEvents(ctx, eventQuery(user, id, eventsKept))
+		if err != nil {
+			slog.Warn("event stream: replay failed", "err", err)
+		}
+		for i := len(missed) - 1; i >= 0; i-- {
+			send(missed[i])
+			last = missed[i].ID
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-sub.ch:
+			if e.ID != 0 && e.ID <= last {
+				continue
+			}
+			send(e)
+		}
+	}
+}
+
+// GET /api/events?after=N
+func (s *server) handleAPIEvents(w http.ResponseWriter, r *http.Request) {
+	var after int64
+	if v := r.URL.Query().Get("after"); v != "" {
+		var err error
+		if after, err = strconv.ParseInt(v, 10, 64); err != nil || after < 0 {
+			http.Error(w, "invalid after", http.StatusBadRequest)
+			return
+		}
+	}
+	list, err := s.store.ListEvents(r.Context(), eventQuery(s.requestUser(r), after, activityLimit))
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	out := make([]apiEvent, 0, len(list))
+	for _, e := range list {
+		out = append(out, eventToAPI(e))
+	}
+	writeJSON(w, out)
+}
+
+// GET /activity
+func (s *server) handleActivity(w http.ResponseWriter, r *http.Request) {
+	list, err := s.store.ListEvents(r.Context(), eventQuery(s.requestUser(r), 0, activityLimit))
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "activity.html", list)
+}
+
+// rssFeed is an RSS 2.0 document.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title    string  `xml:"title"`
+	Link     string  `xml:"link,omitempty"`
+	Category string  `xml:"category"`
+	GUID     rssGUID `xml:"guid"`
+	PubDate  string  `xml:"pubDate,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// GET /events/feed.rss
+func (s *server) handleEventFeed(w http.ResponseWriter, r *http.Request) {
+	list, err := s.store.ListEvents(r.Context(), eventQuery(s.requestUser(r), 0, activityLimit))
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	base := "http://" + r.Host
+	if r.TLS != nil {
+		base = "https://" + r.Host
+	}
+	feed := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:       "Video Manger activity",
+		Link:        base + "/",
+		Description: "Finished downloads and exports, new videos and other library activity",
+	}}
+	for _, e := range list {
+		item := rssItem{
+			Title:    e.Message,
+			Category: e.Kind,
+			GUID:     rssGUID{Value: base + "/events/" + strconv.FormatInt(e.ID, 10)},
+		}
+		if e.VideoID != 0 {
+			item.Link = base + "/play/" + strconv.FormatInt(e.VideoID, 10)
+		}
+		if t, err := time.Parse(time.DateTime, e.CreatedAt); err == nil {
+			item.PubDate = t.Format(time.RFC1123Z)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(xml.Header)) //nolint:errcheck
+	w.Write(out)                //nolint:errcheck
+}
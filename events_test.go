@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestEvents_PerViewer(t *testing.T) {
+	srv := newTestServer(t)
+	addTestUser(t, srv, "root", "adminpass", store.RoleAdmin)
+	kid := addTestUser(t, srv, "kid", "viewerpass", store.RoleViewer)
+	rootCookie := loginAs(t, srv, "root", "adminpass")
+	kidCookie := loginAs(t, srv, "kid", "viewerpass")
+
+	srv.notifyAdmins(store.NotifyArchive, "A video is due to be archived", 0)
+	srv.notifyEveryone(store.NotifySync, "3 new videos in Films", 0)
+	srv.notify(kid.ID, store.NotifyDownload, "Downloaded Cartoon", 0)
+
+	events := func(c *http.Cookie, query string) []apiEvent {
+		t.Helper()
+		rec := doAs(srv, c, http.MethodGet, "/api/events"+query, nil)
+		var out []apiEvent
+		if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+			t.Fatalf("GET /api/events%s: %d, %v", query, rec.Code, err)
+		}
+		return out
+	}
+	if got := events(kidCookie, ""); len(got) != 2 || got[0].Message != "Downloaded Cartoon" || got[1].Kind != store.NotifySync {
+		t.Errorf("kid's events = %+v, want the download and the scan", got)
+	}
+	got := events(rootCookie, "")
+	if len(got) != 2 || got[0].Kind != store.NotifySync || got[1].Kind != store.NotifyArchive {
+		t.Fatalf("root's events = %+v, want the scan and the archive proposal", got)
+	}
+	if after := events(rootCookie, "?after="+itoa(got[1].ID)); len(after) != 1 || after[0].ID != got[0].ID {
+		t.Errorf("events after %d = %+v", got[1].ID, after)
+	}
+	if code := doAs(srv, rootCookie, http.MethodGet, "/api/events?after=x", nil).Code; code != http.StatusBadRequest {
+		t.Errorf("after=x: got %d, want 400", code)
+	}
+
+	// Each reader shows a viewer only their events.
+	if got := strings.TrimSpace(doAs(srv, rootCookie, http.MethodGet, "/notifications/badge", nil).Body.String()); got != "2" {
+		t.Errorf("root's badge = %q, want 2", got)
+	}
+	body := doAs(srv, kidCookie, http.MethodGet, "/activity", nil).Body.String()
+	if !strings.Contains(body, "Downloaded Cartoon") || strings.Contains(body, "archived") {
+		t.Errorf("kid's activity panel:\n%s", body)
+	}
+	rec := doAs(srv, kidCookie, http.MethodGet, "/events/feed.rss", nil)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/rss+xml") {
+		t.Errorf("feed Content-Type = %q", ct)
+	}
+	if feed := rec.Body.String(); !strings.Contains(feed, "<title>Downloaded Cartoon</title>") ||
+		!strings.Contains(feed, "<category>download</category>") || strings.Contains(feed, "archived") {
+		t.Errorf("kid's feed:\n%s", feed)
+	}
+}
+
+func TestEvents_Webhook(t *testing.T) {
+	var got []apiEvent
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e apiEvent
+		json.NewDecoder(r.Body).Decode(&e) //nolint:errcheck
+		got = append(got, e)
+	}))
+	defer hook.Close()
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	srv.store.SaveSettings(ctx, map[string]string{"events_webhook_url": hook.URL}) //nolint:errcheck
+	srv.notifyFailed(7, store.NotifyExport, "Converting Film failed", 0)
+	d, _ := srv.store.AddDirectory(ctx, "/a")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "1.mp4")
+	srv.store.UpdateVideoFileStat(ctx, v.ID, 2000, time.Unix(0, 0)) //nolint:errcheck
+	srv.store.SetDirectoryBudget(ctx, d.ID, 1000, 0)                //nolint:errcheck
+	srv.checkBudgets(ctx)
+
+	if len(got) != 2 {
+		t.Fatalf("webhook got %+v, want two events", got)
+	}
+	if got[0].Kind != store.NotifyExport || !got[0].Failed || got[0].Message != "Converting Film failed" {
+		t.Errorf("first event = %+v", got[0])
+	}
+	var data map[string]any
+	if err := json.Unmarshal(got[1].Data, &data); got[1].Kind != store.NotifyBudget || err != nil || data["event"] != "storage_limit_exceeded" {
+		t.Errorf("budget event = %+v (data %v)", got[1], data)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+	srv.notifyEveryone(store.NotifySync, "first", 0)
+	srv.notifyEveryone(store.NotifySync, "missed", 0)
+	both, _ := srv.store.ListEvents(t.Context(), store.EventQuery{Admin: true, Limit: 2}) // newest first
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/events/stream", nil)
+	req.Header.Set("Last-Event-ID", itoa(both[1].ID))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewScanner(resp.Body)
+	next := func() apiEvent {
+		t.Helper()
+		for lines.Scan() {
+			if data, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+				var e apiEvent
+				if err := json.Unmarshal([]byte(data), &e); err != nil {
+					t.Fatalf("bad event %q: %v", data, err)
+				}
+				return e
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return apiEvent{}
+	}
+	if e := next(); e.Message != "missed" {
+		t.Errorf("replayed %+v, want only the event after Last-Event-ID", e)
+	}
+	srv.notifyEveryone(store.NotifySync, "live", 0)
+	if e := next(); e.Message != "live" {
+		t.Errorf("streamed %+v, want the live event", e)
+	}
+}
@@ -0,0 +1,290 @@
+// extras.go – trailers and sample clips kept under their main video.
+//
+// A file named like "Film (2019)-trailer.mp4" or "Film.2019.sample.mkv", or
+// sitting in a "Trailers" or "Sample" folder, is an extra unless it is known
+// to run longer than extraMaxDuration. After each sync the directory's
+// extras are matched to the video whose name they share, or to the only
+// other video in the folder (for a Sample or Trailers folder, in the folder
+// above), and are then left out of the library list, random play and
+// shuffles; the player lists them under the main video instead. An extra
+// with no main video stays an ordinary video. Samples are only seen at all
+// with "Skip hidden files and samples" off.
+//
+// Other bonus content (behind the scenes, deleted scenes, interviews …) is
+// linked by hand from the main video's player, picked from the files in its
+// folder, either to that video or to every episode of its show. Links made
+// by hand survive the sync, and so does taking an extra back into the
+// library.
+//
+// GET    /videos/{id}/extras  – the video's extras and the form to add one
+// POST   /videos/{id}/extras  – link an extra (form values video, kind, show)
+// DELETE /extras/{id}         – list video id in the library again
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// extraMarkers are the words that mark an extra, at the end of a file name
+// or as its folder's name.
+var extraMarkers = map[string]string{
+	"trailer":  store.ExtraTrailer,
+	"trailers": store.ExtraTrailer,
+	"sample":   store.ExtraSample,
+	"samples":  store.ExtraSample,
+}
+
+// extrasFolderKind reports the kind of extra a folder named dir holds.
+func extrasFolderKind(dir string) (string, bool) {
+	kind, ok := extraMarkers[strings.ToLower(dir)]
+	return kind, ok
+}
+
+// matchName folds a file name stem for comparing an extra with its main
+// video: lower case, with dots, dashes and underscores read as spaces.
+func matchName(stem string) string {
+	stem = strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r == '_' {
+			return ' '
+		}
+		return r
+	}, strings.ToLower(stem))
+	return strings.Join(strings.Fields(stem), " ")
+}
+
+// extraKind reads a trailer or sample from a file's name or its folder.
+// base is the rest of the name, folded by matchName, for finding the main
+// video; "" when the name is only the marker, as in "trailer.mp4".
+func extraKind(dir, name string) (kind, base string) {
+	words := strings.Fields(matchName(strings.TrimSuffix(name, filepath.Ext(name))))
+	if n := len(words); n > 0 {
+		if kind, ok := extraMarkers[words[n-1]]; ok {
+			return kind, strings.Join(words[:n-1], " ")
+		}
+	}
+	if kind, ok := extrasFolderKind(filepath.Base(dir)); ok {
+		return kind, strings.Join(words, " ")
+	}
+	return "", ""
+}
+
+// planExtras matches the extras among videos with their main videos. An
+// extra's main is the video in the same folder whose name its own starts
+// with, whole words only and the longest such name winning, or else the
+// folder's only video.
+func planExtras(videos []store.Video) []store.ExtraLink {
+	type extra struct {
+		v          store.Video
+		kind, base string
+	}
+	var extras []extra
+	mains := make(map[string][]store.Video) // by folder
+	for _, v := range videos {
+		kind, base := extraKind(v.DirectoryPath, v.Filename)
+		if kind != "" && v.DurationS <= extraMaxDuration.Seconds() {
+			extras = append(extras, extra{v, kind, base})
+			continue
+		}
+		mains[v.DirectoryPath] = append(mains[v.DirectoryPath], v)
+	}
+	var links []store.ExtraLink
+	for _, e := range extras {
+		dir := e.v.DirectoryPath
+		if _, ok := extrasFolderKind(filepath.Base(dir)); ok {
+			dir = filepath.Dir(dir)
+		}
+		candidates := mains[dir]
+		var main store.Video
+		best := -1
+		for _, c := range candidates {
+			name := matchName(strings.TrimSuffix(c.Filename, filepath.Ext(c.Filename)))
+			if (e.base == name || strings.HasPrefix(e.base, name+" ")) && len(name) > best {
+				main, best = c, len(name)
+			}
+		}
+		if best < 0 && len(candidates) == 1 {
+			main = candidates[0]
+		}
+		if main.ID != 0 {
+			links = append(links, store.ExtraLink{VideoID: e.v.ID, MainID: main.ID, Kind: e.kind})
+		}
+	}
+	return links
+}
+
+// linkExtras records which of directory dirID's videos are extras. It runs
+// after each sync, once durations are known.
+func (s *server) linkExtras(ctx context.Context, dirID int64) {
+	videos, err := s.store.ListVideosByDirectory(ctx, dirID)
+	if err != nil {
+		slog.Warn("link extras: list videos failed", "dirID", dirID, "err", err)
+		return
+	}
+	links := planExtras(videos)
+	if err := retryBusy(func() error { return s.store.SetDirectoryExtras(ctx, dirID, links) }); err != nil {
+		slog.Warn("link extras failed", "dirID", dirID, "err", err)
+	}
+}
+
+// videoExtras returns the extras of video v followed by those of its show.
+func (s *server) videoExtras(ctx context.Context, v store.Video) ([]store.VideoExtra, error) {
+	extras, err := s.store.ListVideoExtras(ctx, v.ID)
+	if err != nil || v.ShowName == "" {
+		return extras, err
+	}
+	show, err := s.store.ListShowExtras(ctx, v.ShowName)
+	return append(extras, show...), err
+}
+
+// extraCandidates returns the videos in v's folder and the folders under it
+// that could become its extras: not v itself and not already an extra.
+func (s *server) extraCandidates(ctx context.Context, v store.Video) ([]store.Video, error) {
+	videos, err := s.store.ListVideosByDirectory(ctx, v.DirectoryID)
+	if err != nil {
+		return nil, err
+	}
+	extraIDs, err := s.store.ListExtraVideoIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []store.Video
+	for _, c := range videos {
+		inFolder := c.DirectoryPath == v.DirectoryPath ||
+			strings.HasPrefix(c.DirectoryPath, v.DirectoryPath+string(filepath.Separator))
+		if inFolder && c.ID != v.ID && !extraIDs[c.ID] {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (s *server) renderExtras(w http.ResponseWriter, r *http.Request, v store.Video, errMsg string) {
+	data := struct {
+		Video      store.Video
+		Link       store.ExtraLink // Kind is "" unless v is an extra
+		Main       store.Video     // Link's main video, when it has one
+		Extras     []store.VideoExtra
+		Candidates []store.Video
+		Kinds      []string
+		Error      string
+	}{Video: v, Kinds: store.ExtraKinds, Error: errMsg}
+	link, err := s.store.GetExtraLink(r.Context(), v.ID)
+	switch {
+	case err == nil:
+		data.Link = link
+		if link.MainID != 0 {
+			data.Main, _ = s.store.GetVideo(r.Context(), link.MainID)
+		}
+	case !errors.Is(err, store.ErrNotFound):
+		storeError(w, err)
+		return
+	default:
+		if data.Extras, err = s.videoExtras(r.Context(), v); err != nil {
+			storeError(w, err)
+			return
+		}
+		if data.Candidates, err = s.extraCandidates(r.Context(), v); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+	render(w, "extras_panel.html", data)
+}
+
+// GET /videos/{id}/extras
+func (s *server) handleVideoExtras(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	s.renderExtras(w, r, video, "")
+}
+
+// POST /videos/{id}/extras makes the video named by the form value video an
+// extra of this one, or with show set of every episode of its show. An
+// extra cannot have extras of its own, so neither video may be one already
+// or have any; those refusals are reported in the panel.
+func (s *server) handleAddExtra(w http.ResponseWriter, r *http.Request) {
+	main, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	extraID, err := strconv.ParseInt(r.FormValue("video"), 10, 64)
+	if err != nil || extraID <= 0 {
+		http.Error(w, "invalid video", http.StatusBadRequest)
+		return
+	}
+	kind := r.FormValue("kind")
+	if !slices.Contains(store.ExtraKinds, kind) {
+		http.Error(w, "invalid kind", http.StatusBadRequest)
+		return
+	}
+	link := store.ExtraLink{VideoID: extraID, MainID: main.ID, Kind: kind}
+	if r.FormValue("show") == "on" {
+		if main.ShowName == "" {
+			http.Error(w, "the video has no show", http.StatusBadRequest)
+			return
+		}
+		link.MainID, link.ShowName = 0, main.ShowName
+	}
+	extra, err := s.store.GetVideo(r.Context(), extraID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if msg := s.extraLinkProblem(r.Context(), main, extra); msg != "" {
+		s.renderExtras(w, r, main, msg)
+		return
+	}
+	if err := s.store.LinkExtra(r.Context(), link); err != nil {
+		storeError(w, err)
+		return
+	}
+	slog.Info("extra linked", "extra", extra.FilePath(), "main", main.FilePath(), "show", link.ShowName, "kind", kind)
+	w.Header().Set("HX-Trigger", `{"videoRenamed":true}`)
+	s.renderExtras(w, r, main, "")
+}
+
+// extraLinkProblem explains why extra cannot become an extra of main, or
+// returns "" when it can.
+func (s *server) extraLinkProblem(ctx context.Context, main, extra store.Video) string {
+	if extra.ID == main.ID {
+		return "A video cannot be its own extra"
+	}
+	if _, err := s.store.GetExtraLink(ctx, main.ID); err == nil {
+		return "This video is itself an extra"
+	}
+	if _, err := s.store.GetExtraLink(ctx, extra.ID); err == nil {
+		return fmt.Sprintf("%q is already an extra", extra.Title())
+	}
+	if own, _ := s.store.ListVideoExtras(ctx, extra.ID); len(own) > 0 {
+		return fmt.Sprintf("%q has extras of its own", extra.Title())
+	}
+	return ""
+}
+
+// DELETE /extras/{id} lists an extra in the library again. The sync will
+// not link it again.
+func (s *server) handleUnlinkExtra(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.UnlinkExtra(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+	slog.Info("extra unlinked", "videoID", id)
+	w.Header().Set("HX-Trigger", `{"videoRenamed":true,"extrasChanged":true}`)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestExtraKind(t *testing.T) {
+	cases := []struct {
+		dir, name  string
+		kind, base string
+	}{
+		{"/m", "Film (2019)-trailer.mp4", store.ExtraTrailer, "film (2019)"},
+		{"/m", "Film.2019.1080p.SAMPLE.mkv", store.ExtraSample, "film 2019 1080p"},
+		{"/m", "trailer.mp4", store.ExtraTrailer, ""},
+		{"/m/Trailers", "Teaser.mp4", store.ExtraTrailer, "teaser"},
+		{"/m/Sample", "film-x264.mkv", store.ExtraSample, "film x264"},
+		{"/m", "Trailer Park Boys S01E01.mkv", "", ""},
+		{"/m", "Sampler.mkv", "", ""},
+	}
+	for _, c := range cases {
+		if kind, base := extraKind(c.dir, c.name); kind != c.kind || base != c.base {
+			t.Errorf("extraKind(%q, %q) = %q, %q; want %q, %q", c.dir, c.name, kind, base, c.kind, c.base)
+		}
+	}
+}
+
+func TestPlanExtras(t *testing.T) {
+	videos := []store.Video{
+		{ID: 1, DirectoryPath: "/m/Film", Filename: "Film (2019).mkv", DurationS: 7200},
+		{ID: 2, DirectoryPath: "/m/Film", Filename: "Film (2019)-trailer.mp4", DurationS: 150},
+		{ID: 3, DirectoryPath: "/m/Film/Sample", Filename: "sample.mkv"},
+		{ID: 4, DirectoryPath: "/m/Two", Filename: "Alpha.mkv"},
+		{ID: 5, DirectoryPath: "/m/Two", Filename: "Alpha Beta.mkv"},
+		{ID: 6, DirectoryPath: "/m/Two", Filename: "Alpha Beta-trailer.mkv"},
+		{ID: 7, DirectoryPath: "/m/Two", Filename: "trailer.mkv"},                       // two candidates: no main
+		{ID: 8, DirectoryPath: "/m/Long", Filename: "The Trailer.mkv", DurationS: 5400}, // a feature
+		{ID: 9, DirectoryPath: "/m/Long", Filename: "Other.mkv"},
+	}
+	got := map[int64]store.ExtraLink{}
+	for _, l := range planExtras(videos) {
+		got[l.VideoID] = l
+	}
+	want := map[int64]store.ExtraLink{
+		2: {VideoID: 2, MainID: 1, Kind: store.ExtraTrailer},
+		3: {VideoID: 3, MainID: 1, Kind: store.ExtraSample},
+		6: {VideoID: 6, MainID: 5, Kind: store.ExtraTrailer},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("planExtras = %+v, want %+v", got, want)
+	}
+	for id, l := range want {
+		if got[id] != l {
+			t.Errorf("video %d: got %+v, want %+v", id, got[id], l)
+		}
+	}
+}
+
+func TestSyncDir_LinksExtras(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "Trailers"), 0755) //nolint:errcheck
+	for _, f := range []string{"Film (2019).mkv", "Film (2019)-trailer.mp4", "Trailers/Teaser.mp4"} {
+		if err := os.WriteFile(filepath.Join(root, f), []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, root)
+	srv.syncDir(d)
+
+	page, total, err := srv.store.ListVideosPage(ctx, store.VideoQuery{})
+	if err != nil || total != 1 || len(page) != 1 || page[0].Filename != "Film (2019).mkv" {
+		t.Fatalf("library should list only the film, got %d %+v, %v", total, page, err)
+	}
+	rec := doAs(srv, nil, http.MethodGet, "/play/"+itoa(page[0].ID), nil, withHeader("HX-Request", "true"))
+	if !strings.Contains(rec.Body.String(), "Extras (2)") {
+		t.Errorf("player should count both extras, got %d", rec.Code)
+	}
+	rec = doAs(srv, nil, http.MethodGet, "/videos/"+itoa(page[0].ID)+"/extras", nil)
+	if body := rec.Body.String(); !strings.Contains(body, "Film (2019)-trailer.mp4") || !strings.Contains(body, "Teaser.mp4") {
+		t.Errorf("extras panel should list both extras, got %d", rec.Code)
+	}
+
+	// With the film gone, its trailers are ordinary videos again.
+	os.Remove(filepath.Join(root, "Film (2019).mkv")) //nolint:errcheck
+	srv.syncDir(d)
+	if _, total, _ := srv.store.ListVideosPage(ctx, store.VideoQuery{}); total != 2 {
+		t.Errorf("after removing the film: listed %d videos, want 2", total)
+	}
+}
+
+func TestHandleAddExtra(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	ep1, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "s01e01.mkv")
+	ep2, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "s01e02.mkv")
+	bts, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "making of.mkv")
+	srv.store.UpdateVideoShowName(ctx, ep1.ID, "Severance") //nolint:errcheck
+	srv.store.UpdateVideoShowName(ctx, ep2.ID, "Severance") //nolint:errcheck
+
+	rec := doAs(srv, nil, http.MethodGet, "/videos/"+itoa(ep1.ID)+"/extras", nil)
+	if body := rec.Body.String(); !strings.Contains(body, `<option value="`+itoa(bts.ID)+`">`) || !strings.Contains(body, "for all of Severance") {
+		t.Fatalf("panel should offer the folder's videos, got: %s", body)
+	}
+	for _, form := range []url.Values{
+		{"video": {"x"}, "kind": {store.ExtraOther}},
+		{"video": {itoa(bts.ID)}, "kind": {"blooper"}},
+	} {
+		if rec := doAs(srv, nil, http.MethodPost, "/videos/"+itoa(ep1.ID)+"/extras", form); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: got %d, want 400", form, rec.Code)
+		}
+	}
+
+	form := url.Values{"video": {itoa(bts.ID)}, "kind": {store.ExtraBehindTheScene}, "show": {"on"}}
+	rec = doAs(srv, nil, http.MethodPost, "/videos/"+itoa(ep1.ID)+"/extras", form)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "making of.mkv") {
+		t.Fatalf("add: got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = doAs(srv, nil, http.MethodGet, "/videos/"+itoa(ep2.ID)+"/extras", nil)
+	if !strings.Contains(rec.Body.String(), "making of.mkv") {
+		t.Errorf("the show's other episodes should list the extra, got: %s", rec.Body.String())
+	}
+	if _, total, _ := srv.store.ListVideosPage(ctx, store.VideoQuery{}); total != 2 {
+		t.Errorf("library should hide the extra, listed %d", total)
+	}
+
+	// An extra cannot take extras of its own.
+	form = url.Values{"video": {itoa(ep2.ID)}, "kind": {store.ExtraOther}}
+	rec = doAs(srv, nil, http.MethodPost, "/videos/"+itoa(bts.ID)+"/extras", form)
+	if !strings.Contains(rec.Body.String(), "itself an extra") {
+		t.Errorf("extra of an extra: want the refusal in the panel, got: %s", rec.Body.String())
+	}
+
+	if rec := doAs(srv, nil, http.MethodDelete, "/extras/"+itoa(bts.ID), nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("unlink: got %d", rec.Code)
+	}
+	if rec := doAs(srv, nil, http.MethodDelete, "/extras/"+itoa(bts.ID), nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unlink twice: got %d, want 404", rec.Code)
+	}
+	if _, total, _ := srv.store.ListVideosPage(ctx, store.VideoQuery{}); total != 3 {
+		t.Errorf("unlinked extra should be listed again, listed %d", total)
+	}
+}
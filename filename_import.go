@@ -0,0 +1,295 @@
+// filename_import.go – tags and ratings from filename conventions.
+//
+// Files named like "Beach day [5stars] (family) #summer.mp4" carry their
+// rating and tags in the name. The importer matches each video's filename
+// (without the extension) against the rules in the "filename_rules" setting,
+// one per line as "PATTERN => tag:NAME" or "PATTERN => rating:N". PATTERN is
+// a Go regular expression; NAME may use the match's groups ($1, ${name}) and
+// N is a rating from 0 to 2. Without the setting the defaults below apply.
+// Matched text is cut from the name, so importing with rename set also
+// renames "Beach day [5stars] (family) #summer.mp4" to "Beach day.mp4".
+//
+// GET  /filename-import          – rules and import form (settings panel)
+// PUT  /filename-import/rules    – save the rules
+// GET  /filename-import/preview  – what an import would change
+// POST /filename-import          – import (form values dir_id, rename)
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/naming"
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// defaultFilenameRules read star ratings in brackets, words in parentheses
+// and hashtags. Parentheses holding a year or other number are left alone.
+const defaultFilenameRules = `(?i)\[\s*5\s*stars?\s*\] => rating:2
+(?i)\[\s*[34]\s*stars?\s*\] => rating:1
+(?i)\[\s*[0-2]\s*stars?\s*\] => rating:0
+\(([A-Za-z][A-Za-z -]*)\) => tag:$1
+(?:^|\s)#([\w-]+) => tag:$1`
+
+// filenameRule maps what a pattern matches to a tag or a rating.
+type filenameRule struct {
+	re     *regexp.Regexp
+	tag    string // expanded with the match's groups
+	rating int    // used when tag is empty
+}
+
+// parseFilenameRules reads rules one per line, ignoring blank lines.
+func parseFilenameRules(text string) ([]filenameRule, error) {
+	var rules []filenameRule
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		pattern, action, ok := strings.Cut(line, "=>")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected PATTERN => tag:NAME or rating:N", n+1)
+		}
+		re, err := regexp.Compile(strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		rule := filenameRule{re: re}
+		kind, value, _ := strings.Cut(strings.TrimSpace(action), ":")
+		value = strings.TrimSpace(value)
+		switch kind {
+		case "tag":
+			if value == "" {
+				return nil, fmt.Errorf("line %d: tag name required", n+1)
+			}
+			rule.tag = value
+		case "rating":
+			if rule.rating, err = strconv.Atoi(value); err != nil || rule.rating < 0 || rule.rating > 2 {
+				return nil, fmt.Errorf("line %d: rating must be 0, 1 or 2", n+1)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown action %q", n+1, kind)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// filenameRulesText returns the saved rules, or the defaults when none are.
+func (s *server) filenameRulesText(ctx context.Context) string {
+	if v, _ := s.store.GetSetting(ctx, "filename_rules"); strings.TrimSpace(v) != "" {
+		return v
+	}
+	return defaultFilenameRules
+}
+
+// filenameImport is what the rules read from one video's filename.
+type filenameImport struct {
+	Video     store.Video
+	Tags      []string
+	Rating    int
+	HasRating bool
+	CleanName string // the filename with the matches cut; "" when unchanged
+}
+
+// planFilenameImport applies rules to v's filename in order. Each rule sees
+// the name with earlier rules' matches already cut; when several ratings
+// match, the last wins. ok is false when no rule matched.
+func planFilenameImport(v store.Video, rules []filenameRule) (imp filenameImport, ok bool) {
+	imp.Video = v
+	ext := filepath.Ext(v.Filename)
+	stem := strings.TrimSuffix(v.Filename, ext)
+	for _, rule := range rules {
+		matches := rule.re.FindAllStringSubmatchIndex(stem, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		ok = true
+		for _, m := range matches {
+			if rule.tag == "" {
+				imp.Rating, imp.HasRating = rule.rating, true
+				continue
+			}
+			tag := strings.TrimSpace(string(rule.re.ExpandString(nil, rule.tag, stem, m)))
+			if _, reserved := reservedTagPrefix(tag); tag != "" && !reserved && !containsFold(imp.Tags, tag) {
+				imp.Tags = append(imp.Tags, tag)
+			}
+		}
+		stem = rule.re.ReplaceAllLiteralString(stem, " ")
+	}
+	if !ok {
+		return imp, false
+	}
+	clean := strings.Trim(strings.Join(strings.Fields(stem), " "), " -_.")
+	if clean != "" && naming.Filename(clean, ext) != v.Filename {
+		imp.CleanName = naming.Filename(clean, ext)
+	}
+	return imp, true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// planFilenameImports plans the import for every video, or for the videos
+// of directory dirID when it is not 0.
+func (s *server) planFilenameImports(ctx context.Context, dirID int64) ([]filenameImport, error) {
+	rules, err := parseFilenameRules(s.filenameRulesText(ctx))
+	if err != nil {
+		return nil, err
+	}
+	var videos []store.Video
+	if dirID != 0 {
+		videos, err = s.store.ListVideosByDirectory(ctx, dirID)
+	} else {
+		videos, err = s.store.ListVideos(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []filenameImport
+	for _, v := range videos {
+		if imp, ok := planFilenameImport(v, rules); ok {
+			out = append(out, imp)
+		}
+	}
+	return out, nil
+}
+
+// applyFilenameImport tags and rates imp's video and, with rename set,
+// gives the file its clean name. A name that is taken gets a _2, _3 …
+// suffix.
+func (s *server) applyFilenameImport(ctx context.Context, imp filenameImport, rename bool) error {
+	v := imp.Video
+	for _, name := range imp.Tags {
+		tag, err := s.store.UpsertTag(ctx, name)
+		if err != nil {
+			return err
+		}
+		if err := s.store.TagVideo(ctx, v.ID, tag.ID); err != nil {
+			return err
+		}
+	}
+	if imp.HasRating {
+		if err := s.store.SetVideoRating(ctx, v.ID, imp.Rating); err != nil {
+			return err
+		}
+	}
+	if !rename || imp.CleanName == "" {
+		return nil
+	}
+	ext := filepath.Ext(imp.CleanName)
+	name := freeOutputName(v.DirectoryPath, strings.TrimSuffix(imp.CleanName, ext), "", ext)
+	src, dst := v.FilePath(), filepath.Join(v.DirectoryPath, name)
+	if err := s.blobs.Rename(src, dst); err != nil {
+		return err
+	}
+	if err := s.store.UpdateVideoPath(ctx, v.ID, v.DirectoryID, v.DirectoryPath, name); err != nil {
+		_ = s.blobs.Rename(dst, src)
+		return err
+	}
+	return nil
+}
+
+// filenameImportDir reads the optional dir_id form value.
+func filenameImportDir(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	v := strings.TrimSpace(r.FormValue("dir_id"))
+	if v == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 0 {
+		http.Error(w, "invalid dir_id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *server) renderFilenameImport(w http.ResponseWriter, r *http.Request, rulesErr string) {
+	dirs, err := s.store.ListDirectories(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "filename_import.html", struct {
+		Rules       string
+		RulesError  string
+		Directories []store.Directory
+	}{s.filenameRulesText(r.Context()), rulesErr, dirs})
+}
+
+// GET /filename-import
+func (s *server) handleFilenameImport(w http.ResponseWriter, r *http.Request) {
+	s.renderFilenameImport(w, r, "")
+}
+
+// PUT /filename-import/rules saves the "rules" form value; empty restores
+// the defaults. Invalid rules are reported in the panel and not saved.
+func (s *server) handleSaveFilenameRules(w http.ResponseWriter, r *http.Request) {
+	text := strings.TrimSpace(strings.ReplaceAll(r.FormValue("rules"), "\r\n", "\n"))
+	if _, err := parseFilenameRules(text); err != nil {
+		s.renderFilenameImport(w, r, err.Error())
+		return
+	}
+	if text == defaultFilenameRules {
+		text = ""
+	}
+	if err := s.store.SaveSettings(r.Context(), map[string]string{"filename_rules": text}); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderFilenameImport(w, r, "")
+}
+
+// GET /filename-import/preview
+func (s *server) handleFilenameImportPreview(w http.ResponseWriter, r *http.Request) {
+	dirID, ok := filenameImportDir(w, r)
+	if !ok {
+		return
+	}
+	plan, err := s.planFilenameImports(r.Context(), dirID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "filename_import_preview.html", plan)
+}
+
+// POST /filename-import
+func (s *server) handleRunFilenameImport(w http.ResponseWriter, r *http.Request) {
+	dirID, ok := filenameImportDir(w, r)
+	if !ok {
+		return
+	}
+	rename := r.FormValue("rename") == "on"
+	plan, err := s.planFilenameImports(r.Context(), dirID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	done, failed := 0, 0
+	for _, imp := range plan {
+		if err := s.applyFilenameImport(r.Context(), imp, rename); err != nil {
+			slog.Warn("filename import failed", "path", imp.Video.FilePath(), "err", err)
+			failed++
+			continue
+		}
+		done++
+	}
+	msg := fmt.Sprintf("Imported tags and ratings from %d filenames", done)
+	if failed > 0 {
+		msg += fmt.Sprintf("; %d failed (see the log)", failed)
+	}
+	renderNotice(w, failed == 0, msg)
+}
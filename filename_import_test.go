@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestPlanFilenameImport_Defaults(t *testing.T) {
+	rules, err := parseFilenameRules(defaultFilenameRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name      string
+		tags      []string
+		rating    int
+		hasRating bool
+		clean     string
+	}{
+		{"Beach day [5stars] (family) #summer #2024.mp4", []string{"family", "summer", "2024"}, 2, true, "Beach day.mp4"},
+		{"Party_[3 stars].mkv", nil, 1, true, "Party.mkv"},
+		{"Concert (2019) #live.mp4", []string{"live"}, 0, false, "Concert (2019).mp4"},
+		{"#cats.mp4", []string{"cats"}, 0, false, ""},
+	}
+	for _, c := range cases {
+		imp, ok := planFilenameImport(store.Video{Filename: c.name}, rules)
+		if !ok {
+			t.Errorf("%s: no rule matched", c.name)
+			continue
+		}
+		if !slices.Equal(imp.Tags, c.tags) || imp.Rating != c.rating || imp.HasRating != c.hasRating || imp.CleanName != c.clean {
+			t.Errorf("%s: got tags %q rating %d/%v clean %q", c.name, imp.Tags, imp.Rating, imp.HasRating, imp.CleanName)
+		}
+	}
+	if _, ok := planFilenameImport(store.Video{Filename: "Plain name (2020).mp4"}, rules); ok {
+		t.Error("a plain name should not match")
+	}
+}
+
+func TestParseFilenameRules_Invalid(t *testing.T) {
+	for _, text := range []string{"no arrow", "([ => tag:x", `\d => rating:5`, `\d => colour:red`, `\d => tag:`} {
+		if _, err := parseFilenameRules(text); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
+
+func TestFilenameImport(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"Hike [5stars] #outdoors.mp4", "Hike.mp4", "plain.mp4"} {
+		os.WriteFile(filepath.Join(root, name), []byte("fake"), 0644) //nolint:errcheck
+	}
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, root)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, root, "Hike [5stars] #outdoors.mp4")
+	srv.store.UpsertVideo(ctx, d.ID, root, "Hike.mp4")  //nolint:errcheck
+	srv.store.UpsertVideo(ctx, d.ID, root, "plain.mp4") //nolint:errcheck
+
+	rec := doAs(srv, nil, http.MethodGet, "/filename-import/preview?dir_id="+itoa(d.ID), nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "outdoors") || strings.Contains(rec.Body.String(), "plain.mp4") {
+		t.Fatalf("preview: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got, _ := srv.store.GetVideo(ctx, v.ID); got.Rating != 0 {
+		t.Error("preview changed the video")
+	}
+
+	rec = doAs(srv, nil, http.MethodPost, "/filename-import", url.Values{"dir_id": {itoa(d.ID)}, "rename": {"on"}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "from 1 filenames") {
+		t.Fatalf("import: got %d: %s", rec.Code, rec.Body.String())
+	}
+	got, _ := srv.store.GetVideo(ctx, v.ID)
+	if got.Rating != 2 {
+		t.Errorf("rating = %d, want 2", got.Rating)
+	}
+	// "Hike.mp4" is taken, so the clean name gets a suffix.
+	if got.Filename != "Hike_2.mp4" {
+		t.Errorf("filename = %q, want Hike_2.mp4", got.Filename)
+	}
+	if _, err := os.Stat(filepath.Join(root, "Hike_2.mp4")); err != nil {
+		t.Error("renamed file not found on disk")
+	}
+	tags, _ := srv.store.ListTagsByVideo(ctx, v.ID)
+	if !slices.ContainsFunc(tags, func(tg store.Tag) bool { return tg.Name == "outdoors" }) {
+		t.Errorf("tags = %v, want outdoors", tags)
+	}
+}
+
+func TestFilenameRules_Save(t *testing.T) {
+	srv := newTestServer(t)
+	rec := doAs(srv, nil, http.MethodPut, "/filename-import/rules", url.Values{"rules": {"([ => tag:x"}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "line 1") {
+		t.Fatalf("invalid rules: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if v, _ := srv.store.GetSetting(context.Background(), "filename_rules"); v != "" {
+		t.Errorf("invalid rules saved: %q", v)
+	}
+
+	doAs(srv, nil, http.MethodPut, "/filename-import/rules", url.Values{"rules": {`\{(\w+)\} => tag:$1`}})
+	rules, _ := parseFilenameRules(srv.filenameRulesText(context.Background()))
+	imp, ok := planFilenameImport(store.Video{Filename: "Trip {italy}.mp4"}, rules)
+	if !ok || !slices.Equal(imp.Tags, []string{"italy"}) || imp.CleanName != "Trip.mp4" {
+		t.Errorf("custom rule: got %+v", imp)
+	}
+
+	doAs(srv, nil, http.MethodPut, "/filename-import/rules", url.Values{"rules": {""}})
+	if srv.filenameRulesText(context.Background()) != defaultFilenameRules {
+		t.Error("clearing the rules should restore the defaults")
+	}
+}
@@ -4,8 +4,10 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -13,11 +15,13 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/naming"
 	"github.com/maxgarvey/video_manger/store"
 )
 
@@ -28,6 +32,12 @@ const (
 	maxUploadBytes = 8 << 30
 	// multipartMemBytes is the in-memory buffer used when parsing multipart forms.
 	multipartMemBytes = 64 << 20
+	// maxPosterBytes caps uploaded poster images (20 MB).
+	maxPosterBytes = 20 << 20
+	// maxPosterPixels rejects images whose decoded size would exhaust memory.
+	maxPosterPixels = 50_000_000
+	// posterWidth matches the width of ffmpeg-generated thumbnails.
+	posterWidth = 320
 )
 
 // ── Template data types ──────────────────────────────────────────────────────
@@ -36,6 +46,28 @@ const (
 type videoTagsData struct {
 	VideoID int64
 	Tags    []store.Tag
+	Recent  []store.Tag // recently applied tags not yet on this video
+}
+
+// newVideoTagsData builds the tag widget model, offering the tags the user
+// applied most recently that the video does not already carry as
+// quick-apply chips.
+func (s *server) newVideoTagsData(ctx context.Context, userID, id int64, tags []store.Tag) videoTagsData {
+	data := videoTagsData{VideoID: id, Tags: tags}
+	recent, err := s.store.ListRecentTags(ctx, userID, recentTagsLimit+len(tags))
+	if err != nil {
+		slog.Warn("list recent tags failed", "err", err)
+		return data
+	}
+	for _, t := range recent {
+		if len(data.Recent) == recentTagsLimit {
+			break
+		}
+		if !slices.ContainsFunc(tags, func(have store.Tag) bool { return have.ID == t.ID }) {
+			data.Recent = append(data.Recent, t)
+		}
+	}
+	return data
 }
 
 // fileMetaData is the template model for file_metadata.html and
@@ -44,10 +76,11 @@ type videoTagsData struct {
 // Warn is set to a non-empty string when a metadata write fails so the
 // template can surface a visible warning to the user.
 type fileMetaData struct {
-	VideoID int64
-	Native  metadata.Meta
-	Streams []metadata.Stream
-	Warn    string
+	VideoID  int64
+	Native   metadata.Meta
+	Streams  []metadata.Stream
+	Sidecars []store.Sidecar // companion files catalogued by the last sync
+	Warn     string
 }
 
 // ── Shared helpers ───────────────────────────────────────────────────────────
@@ -93,13 +126,33 @@ func (s *server) videoOrError(w http.ResponseWriter, r *http.Request) (store.Vid
 		return store.Video{}, false
 	}
 	video, err := s.store.GetVideo(r.Context(), id)
-	if err != nil {
+	if errors.Is(err, store.ErrNotFound) {
 		http.Error(w, "video not found", http.StatusNotFound)
 		return store.Video{}, false
 	}
+	if err != nil {
+		storeError(w, err)
+		return store.Video{}, false
+	}
 	return video, true
 }
 
+// storeError answers a failed store call: 404 or 409 for the store's typed
+// errors, otherwise a logged 500 whose body doesn't expose the SQL error.
+func storeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrConflict):
+		http.Error(w, "already exists", http.StatusConflict)
+	case errors.Is(err, store.ErrForeignKey):
+		http.Error(w, "refers to a missing record", http.StatusConflict)
+	default:
+		slog.Error("store call failed", "err", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
 // formPtr reads the named form field and returns a pointer to its value.
 // Useful for building metadata.Updates structs where nil means "leave unchanged".
 func formPtr(r *http.Request, key string) *string {
@@ -157,6 +210,18 @@ func (sw *sseWriter) Event(event, data string) {
 	sw.f.Flush()
 }
 
+// Message sends an unnamed SSE message carrying id, which the browser's
+// EventSource sends back as Last-Event-ID when it reconnects; an id of 0 is
+// left out. Newlines are stripped from data.
+func (sw *sseWriter) Message(id int64, data string) {
+	safe := strings.ReplaceAll(data, "\n", " ")
+	if id != 0 {
+		fmt.Fprintf(sw.w, "id: %d\n", id) //nolint:errcheck
+	}
+	fmt.Fprintf(sw.w, "data: %s\n\n", safe) //nolint:errcheck
+	sw.f.Flush()
+}
+
 // scheduleJobCleanup closes ch immediately and schedules deleteFunc to run
 // after 10 minutes so SSE clients that connect late can still read the result.
 // Use it with defer at the start of a background job goroutine:
@@ -236,10 +301,12 @@ func parseInt(s string) int {
 }
 
 // freeOutputName returns a filename of the form stem+suffix+ext that does not
-// already exist in dir, appending _2, _3, … as needed.
+// already exist in dir, appending _2, _3, … as needed. stem is made safe
+// with naming.Filename, so exports copied elsewhere keep their names.
 // Uses os.Stat rather than O_EXCL; prefer openFreeFile when you need to
 // atomically claim the name (e.g. for upload temp files).
 func freeOutputName(dir, stem, suffix, ext string) string {
+	stem = strings.TrimSuffix(naming.Filename(stem, suffix+ext), suffix+ext)
 	name := stem + suffix + ext
 	if _, err := os.Stat(filepath.Join(dir, name)); os.IsNotExist(err) {
 		return name
@@ -258,13 +325,13 @@ func freeOutputName(dir, stem, suffix, ext string) string {
 func (s *server) refreshVideoTags(w http.ResponseWriter, r *http.Request, id int64) {
 	tags, err := s.store.ListTagsByVideo(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	if video, err := s.store.GetVideo(r.Context(), id); err == nil {
 		s.syncTagsToFile(r.Context(), video)
 	}
-	render(w, "video_tags.html", videoTagsData{id, tags})
+	render(w, "video_tags.html", s.newVideoTagsData(r.Context(), s.requestUser(r).ID, id, tags))
 }
 
 // deleteVideoAndRefresh removes a video from the store, prunes orphan tags,
@@ -272,7 +339,7 @@ func (s *server) refreshVideoTags(w http.ResponseWriter, r *http.Request, id int
 // handleDeleteVideo and handleDeleteVideoAndFile.
 func (s *server) deleteVideoAndRefresh(w http.ResponseWriter, r *http.Request, id int64) {
 	if err := s.store.DeleteVideo(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	if err := s.store.PruneOrphanTags(r.Context()); err != nil {
@@ -18,6 +18,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -50,20 +51,66 @@ type apiVideo struct {
 	AirDate      string  `json:"air_date,omitempty"`
 	Type         string  `json:"type,omitempty"`
 	Rating       int     `json:"rating"`
+	Stars        int     `json:"stars,omitempty"`    // 1 to 5 on the star scale
+	Favorite     bool    `json:"favorite,omitempty"` // marked to watch again soon
 	WatchedAt    string  `json:"watched_at,omitempty"`
 	DurationS    float64 `json:"duration_s,omitempty"`
 	StreamURL    string  `json:"stream_url"`
+	AudioURL     string  `json:"audio_url"` // the sound alone, see handleStreamAudio
 	ThumbnailURL string  `json:"thumbnail_url,omitempty"`
+	// ExternalIDs are keyed by provider, e.g. "imdb"; single-video
+	// responses only.
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
 }
 
 // apiShow is a summary of a show/series.
 type apiShow struct {
-	Title        string `json:"title"`
-	SeasonCount  int    `json:"season_count"`
-	EpisodeCount int    `json:"episode_count"`
-	Genre        string `json:"genre,omitempty"`
-	Channel      string `json:"channel,omitempty"`
-	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	Title        string          `json:"title"`
+	Overview     string          `json:"overview,omitempty"`
+	SeasonCount  int             `json:"season_count"`
+	EpisodeCount int             `json:"episode_count"`
+	Genre        string          `json:"genre,omitempty"`
+	Channel      string          `json:"channel,omitempty"`
+	ThumbnailURL string          `json:"thumbnail_url,omitempty"`
+	Status       string          `json:"status,omitempty"` // e.g. "Running" or "Ended", per TVMaze
+	NextEpisode  *apiNextEpisode `json:"next_episode,omitempty"`
+	Rating       apiRating       `json:"rating"`
+}
+
+// apiRating sums up the ratings of a show's or tag's videos.
+type apiRating struct {
+	Average    float64 `json:"average"` // 0–2, counting unrated videos as 0
+	Liked      int     `json:"liked"`
+	Favourites int     `json:"favourites"`
+}
+
+func ratingToAPI(tr store.TagRating) apiRating {
+	return apiRating{Average: tr.Average, Liked: tr.Liked, Favourites: tr.Favourites}
+}
+
+// ratedAbove orders ratings best first: by average, then by favourites.
+func ratedAbove(a, b apiRating) bool {
+	if a.Average != b.Average {
+		return a.Average > b.Average
+	}
+	return a.Favourites > b.Favourites
+}
+
+// apiNextEpisode is a show's next scheduled episode.
+type apiNextEpisode struct {
+	Season  int       `json:"season"`
+	Episode int       `json:"episode"`
+	Title   string    `json:"title,omitempty"`
+	AirsAt  time.Time `json:"airs_at"`
+}
+
+// nextEpisodeToAPI returns the show's next episode, or nil when none is
+// scheduled or it has already aired.
+func nextEpisodeToAPI(a store.ShowAiring, now time.Time) *apiNextEpisode {
+	if a.Next.Episode == 0 || a.NextAirs.Before(now) {
+		return nil
+	}
+	return &apiNextEpisode{Season: a.Next.Season, Episode: a.Next.Episode, Title: a.Next.Title, AirsAt: a.NextAirs}
 }
 
 // apiSeason summarises one season within a show.
@@ -76,8 +123,11 @@ type apiSeason struct {
 
 // apiTag is the JSON representation of a tag.
 type apiTag struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Color     string     `json:"color,omitempty"`
+	SortOrder int        `json:"sort_order"`
+	Rating    *apiRating `json:"rating,omitempty"` // absent when no video has the tag
 }
 
 // apiWatchedEntry pairs a video with its last resume position.
@@ -86,7 +136,9 @@ type apiWatchedEntry struct {
 	PositionS float64 `json:"position_s"`
 }
 
-func videoToAPI(v store.Video) apiVideo {
+// videoToAPI converts v for the API; sign is applied to its stream URL (see
+// streamSigner).
+func videoToAPI(v store.Video, sign func(string) string) apiVideo {
 	av := apiVideo{
 		ID:           v.ID,
 		Title:        v.Title(),
@@ -101,9 +153,12 @@ func videoToAPI(v store.Video) apiVideo {
 		AirDate:      v.AirDate,
 		Type:         v.VideoType,
 		Rating:       v.Rating,
+		Stars:        v.Stars,
+		Favorite:     v.Favorite,
 		WatchedAt:    v.WatchedAt,
 		DurationS:    v.DurationS,
-		StreamURL:    "/video/" + strconv.FormatInt(v.ID, 10),
+		StreamURL:    sign("/video/" + strconv.FormatInt(v.ID, 10)),
+		AudioURL:     sign("/videos/" + strconv.FormatInt(v.ID, 10) + "/audio"),
 	}
 	if v.ThumbnailPath != "" {
 		av.ThumbnailURL = "/videos/" + strconv.FormatInt(v.ID, 10) + "/thumbnail"
@@ -117,35 +172,85 @@ func videoToAPI(v store.Video) apiVideo {
 // Optional query params:
 //
 //	q=<search term>   full-text search
-//	show=<name>       filter by show name
+//	show=<name>       filter by show name, in episode order (without q, tag_id or tags)
 //	type=<TV|Movie…>  filter by video type
 //	tag_id=<id>       filter by tag ID
+//	tags=<id,id,…>    videos with any of these tags
+//	mode=<any|all>    with tags, require all of them instead
+//	dir_id=<id>       filter by directory ID
+//	rating=<n>        only videos rated at least n
+//	watched=<yes|no>  only watched or only unwatched videos
+//	sort=<order>      name, rating, added, watched, duration or size
+//	limit=<n>         at most n videos (default all)
+//	offset=<n>        skip the first n
+//
+// Filters other than show combine. The X-Total-Count header holds the number of matches before paging.
 func (s *server) handleAPIListVideos(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
+	limit, offset := 0, 0
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"limit", &limit}, {"offset", &offset}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid "+p.name, http.StatusBadRequest)
+			return
+		}
+		*p.dst = n
+	}
+	sortBy := q.Get("sort")
+	if sortBy != "" && !validVideoSort(sortBy) {
+		http.Error(w, "unknown sort", http.StatusBadRequest)
+		return
+	}
+	sortBy = s.ratingSort(r.Context(), sortBy)
+	if _, ok := parseTagIDs(q.Get("tags")); !ok {
+		http.Error(w, "invalid tags", http.StatusBadRequest)
+		return
+	}
+	if m := q.Get("mode"); m != "" && m != "any" && m != "all" {
+		http.Error(w, "mode must be any or all", http.StatusBadRequest)
+		return
+	}
 	var (
 		videos []store.Video
+		total  int
 		err    error
 	)
-	switch {
-	case q.Get("q") != "":
-		videos, err = s.store.SearchVideos(r.Context(), q.Get("q"))
-	case q.Get("tag_id") != "":
-		tagID, _ := strconv.ParseInt(q.Get("tag_id"), 10, 64)
-		videos, err = s.store.ListVideosByTag(r.Context(), tagID)
-	case q.Get("show") != "":
+	inMemory := true
+	if q.Get("q") == "" && q.Get("tag_id") == "" && q.Get("tags") == "" && q.Get("show") != "" {
 		videos, err = s.store.ListVideosByShow(r.Context(), q.Get("show"))
-	case q.Get("type") != "":
-		videos, err = s.store.ListVideosByType(r.Context(), q.Get("type"))
-	default:
-		videos, err = s.store.ListVideos(r.Context())
+	} else {
+		vq := videoQueryFrom(q)
+		vq.Sort, vq.Limit, vq.Offset = sortBy, limit, offset
+		vq.Companions = s.includeCompanions(r.Context())
+		videos, total, err = s.store.ListVideosPage(r.Context(), vq)
+		inMemory = false
 	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
+	if inMemory {
+		// Show results come whole; sort and page them here.
+		sortVideos(videos, sortBy)
+		total = len(videos)
+		end := total
+		if limit > 0 {
+			end = min(offset+limit, total)
+		}
+		videos = videos[min(offset, total):end]
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 	result := make([]apiVideo, len(videos))
+	sign := s.streamSigner(r.Context())
 	for i, v := range videos {
-		result[i] = videoToAPI(v)
+		result[i] = videoToAPI(v, sign)
 	}
 	writeJSON(w, result)
 }
@@ -156,22 +261,63 @@ func (s *server) handleAPIGetVideo(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
+	s.writeAPIVideo(w, r, id)
+}
+
+// writeAPIVideo answers with one video, including its external IDs.
+func (s *server) writeAPIVideo(w http.ResponseWriter, r *http.Request, id int64) {
 	v, err := s.store.GetVideo(r.Context(), id)
 	if err != nil {
+		storeError(w, err)
+		return
+	}
+	av := videoToAPI(v, s.streamSigner(r.Context()))
+	if av.ExternalIDs, err = s.store.ListVideoExternalIDs(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+	writeJSON(w, av)
+}
+
+// apiMarker is the JSON representation of a time range within a video.
+type apiMarker struct {
+	Kind   string  `json:"kind"`  // "skip": jump from start to end; "chapter": a named section
+	Start  float64 `json:"start"` // seconds
+	End    float64 `json:"end"`   // seconds
+	Label  string  `json:"label,omitempty"`
+	Source string  `json:"source,omitempty"`
+}
+
+// GET /api/videos/{id}/markers
+func (s *server) handleAPIVideoMarkers(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.store.GetVideo(r.Context(), id); err != nil {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
-	writeJSON(w, videoToAPI(v))
+	markers, err := s.store.ListVideoMarkers(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	out := make([]apiMarker, len(markers))
+	for i, m := range markers {
+		out[i] = apiMarker{Kind: m.Kind, Start: m.Start, End: m.End, Label: m.Label, Source: m.Source}
+	}
+	writeJSON(w, out)
 }
 
-// GET /api/random
+// GET /api/random skips the viewer's recent random picks.
 func (s *server) handleAPIRandom(w http.ResponseWriter, r *http.Request) {
-	v, err := s.store.GetRandomVideo(r.Context())
+	v, err := s.pickRandom(r, nil)
 	if err != nil {
 		http.Error(w, "no videos", http.StatusNotFound)
 		return
 	}
-	writeJSON(w, videoToAPI(v))
+	writeJSON(w, videoToAPI(v, s.streamSigner(r.Context())))
 }
 
 // ── /api/shows ────────────────────────────────────────────────────────────────
@@ -179,9 +325,14 @@ func (s *server) handleAPIRandom(w http.ResponseWriter, r *http.Request) {
 // GET /api/shows
 // Returns all shows that have at least one video with a show name set.
 func (s *server) handleAPIListShows(w http.ResponseWriter, r *http.Request) {
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy != "" && sortBy != "rating" {
+		http.Error(w, "sort must be rating", http.StatusBadRequest)
+		return
+	}
 	videos, err := s.store.ListVideos(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 
@@ -220,17 +371,45 @@ func (s *server) handleAPIListShows(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	shows, err := s.store.ListShows(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	details := make(map[string]store.Show, len(shows))
+	for _, sh := range shows {
+		details[sh.Name] = sh
+	}
+	ratings, err := s.tagRatings(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	now := time.Now()
 	result := make([]apiShow, 0, len(order))
 	for _, title := range order {
 		sa := accum[title]
-		result = append(result, apiShow{
+		show := apiShow{
 			Title:        title,
+			Overview:     details[title].Overview,
 			SeasonCount:  len(sa.seasons),
 			EpisodeCount: sa.count,
 			Genre:        sa.genre,
 			Channel:      sa.channel,
 			ThumbnailURL: sa.thumb,
-		})
+			Status:       details[title].Airing.Status,
+			NextEpisode:  nextEpisodeToAPI(details[title].Airing, now),
+			Rating:       ratingToAPI(ratings["show:"+title]),
+		}
+		// A scraped poster beats an episode's frame.
+		if poster := showPosterURL(details[title]); poster != "" {
+			show.ThumbnailURL = poster
+		}
+		result = append(result, show)
+	}
+	if sortBy == "rating" {
+		sort.SliceStable(result, func(i, j int) bool { return ratedAbove(result[i].Rating, result[j].Rating) })
 	}
 	writeJSON(w, result)
 }
@@ -244,7 +423,7 @@ func (s *server) handleAPIListSeasons(w http.ResponseWriter, r *http.Request) {
 	}
 	videos, err := s.store.ListVideosByShow(r.Context(), show)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 
@@ -297,14 +476,15 @@ func (s *server) handleAPIListEpisodes(w http.ResponseWriter, r *http.Request) {
 
 	videos, err := s.store.ListVideosByShow(r.Context(), show)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 
 	result := make([]apiVideo, 0)
+	sign := s.streamSigner(r.Context())
 	for _, v := range videos {
 		if v.SeasonNumber == seasonNum {
-			result = append(result, videoToAPI(v))
+			result = append(result, videoToAPI(v, sign))
 		}
 	}
 	sort.Slice(result, func(i, j int) bool {
@@ -319,12 +499,21 @@ func (s *server) handleAPIListEpisodes(w http.ResponseWriter, r *http.Request) {
 func (s *server) handleAPIListTags(w http.ResponseWriter, r *http.Request) {
 	tags, err := s.store.ListTags(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
+		return
+	}
+	ratings, err := s.tagRatings(r.Context())
+	if err != nil {
+		storeError(w, err)
 		return
 	}
 	result := make([]apiTag, len(tags))
 	for i, t := range tags {
-		result[i] = apiTag{ID: t.ID, Name: t.Name}
+		result[i] = apiTag{ID: t.ID, Name: t.Name, Color: t.Color, SortOrder: t.SortOrder}
+		if tr, ok := ratings[t.Name]; ok {
+			rating := ratingToAPI(tr)
+			result[i].Rating = &rating
+		}
 	}
 	writeJSON(w, result)
 }
@@ -338,12 +527,13 @@ func (s *server) handleAPITagVideos(w http.ResponseWriter, r *http.Request) {
 	}
 	videos, err := s.store.ListVideosByTag(r.Context(), tagID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	result := make([]apiVideo, len(videos))
+	sign := s.streamSigner(r.Context())
 	for i, v := range videos {
-		result[i] = videoToAPI(v)
+		result[i] = videoToAPI(v, sign)
 	}
 	writeJSON(w, result)
 }
@@ -356,7 +546,7 @@ func (s *server) handleAPITagVideos(w http.ResponseWriter, r *http.Request) {
 func (s *server) handleAPIRecentlyWatched(w http.ResponseWriter, r *http.Request) {
 	history, err := s.store.ListWatchHistory(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 
@@ -377,13 +567,14 @@ func (s *server) handleAPIRecentlyWatched(w http.ResponseWriter, r *http.Request
 	}
 
 	result := make([]apiWatchedEntry, 0, len(entries))
+	sign := s.streamSigner(r.Context())
 	for _, e := range entries {
 		v, err := s.store.GetVideo(r.Context(), e.id)
 		if err != nil {
 			continue
 		}
 		result = append(result, apiWatchedEntry{
-			apiVideo:  videoToAPI(v),
+			apiVideo:  videoToAPI(v, sign),
 			PositionS: e.position,
 		})
 	}
@@ -393,19 +584,20 @@ func (s *server) handleAPIRecentlyWatched(w http.ResponseWriter, r *http.Request
 // ── Directories ───────────────────────────────────────────────────────────────
 
 type apiDirectory struct {
-	ID   int64  `json:"id"`
-	Path string `json:"path"`
+	ID    int64  `json:"id"`
+	Path  string `json:"path"`
+	Label string `json:"label,omitempty"`
 }
 
 func (s *server) handleAPIDirectories(w http.ResponseWriter, r *http.Request) {
 	dirs, err := s.store.ListDirectories(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	out := make([]apiDirectory, len(dirs))
 	for i, d := range dirs {
-		out[i] = apiDirectory{ID: d.ID, Path: d.Path}
+		out[i] = apiDirectory{ID: d.ID, Path: d.Path, Label: d.Label}
 	}
 	writeJSON(w, out)
 }
@@ -416,7 +608,7 @@ func (s *server) handleAPIDirectories(w http.ResponseWriter, r *http.Request) {
 func (s *server) handleGetFolderBackgrounds(w http.ResponseWriter, r *http.Request) {
 	pairs, err := s.store.ListSettingsWithPrefix(r.Context(), "folder_bg:")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	result := make(map[string]string, len(pairs))
@@ -437,7 +629,7 @@ func (s *server) handleSetFolderBackground(w http.ResponseWriter, r *http.Reques
 	}
 	key := "folder_bg:" + show
 	if err := s.store.SaveSettings(r.Context(), map[string]string{key: path}); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -453,7 +645,7 @@ func (s *server) handleServeImage(w http.ResponseWriter, r *http.Request) {
 	imgPath = filepath.Clean(imgPath)
 	dirs, err := s.store.ListDirectories(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	allowed := false
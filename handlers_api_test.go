@@ -9,6 +9,8 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -671,6 +673,48 @@ func TestHandleAPIListVideos_FilterByTagID(t *testing.T) {
 	}
 }
 
+func TestHandleAPIListVideos_FilterByTags(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	both, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "both.mp4")
+	funny, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "funny.mp4")
+	srv.store.UpsertVideo(ctx, d.ID, d.Path, "other.mp4") //nolint:errcheck
+	comedy, _ := srv.store.UpsertTag(ctx, "comedy")
+	favs, _ := srv.store.UpsertTag(ctx, "favorites")
+	srv.store.TagVideo(ctx, both.ID, comedy.ID)  //nolint:errcheck
+	srv.store.TagVideo(ctx, both.ID, favs.ID)    //nolint:errcheck
+	srv.store.TagVideo(ctx, funny.ID, comedy.ID) //nolint:errcheck
+
+	tags := fmt.Sprintf("tags=%d,%d", comedy.ID, favs.ID)
+	for query, want := range map[string][]int64{
+		tags:               {both.ID, funny.ID},
+		tags + "&mode=any": {both.ID, funny.ID},
+		tags + "&mode=all": {both.ID},
+	} {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/videos?"+query, nil))
+		var got []apiVideo
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		var ids []int64
+		for _, v := range got {
+			ids = append(ids, v.ID)
+		}
+		if !slices.Equal(ids, want) || rec.Header().Get("X-Total-Count") != strconv.Itoa(len(want)) {
+			t.Errorf("%s: got %v (total %s), want %v", query, ids, rec.Header().Get("X-Total-Count"), want)
+		}
+	}
+	for _, query := range []string{"tags=1,x", "tags=0", tags + "&mode=some"} {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/videos?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
+
 func TestHandleAPIListVideos_SearchQuery(t *testing.T) {
 	srv := newTestServer(t)
 	ctx := context.Background()
@@ -702,3 +746,52 @@ func TestHandleAPIListEpisodes_InvalidSeason(t *testing.T) {
 		t.Fatalf("expected 400 or 404 for invalid season, got %d", rec.Code)
 	}
 }
+
+func TestAPIVideoMarkers(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	srv.store.SetVideoMarkers(ctx, v.ID, sponsorBlockSource, []store.Marker{ //nolint:errcheck
+		{Kind: store.MarkerSkip, Start: 30, End: 45, Label: "sponsor"},
+	})
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/videos/"+itoa(v.ID)+"/markers", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var got []apiMarker
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Kind != "skip" || got[0].Start != 30 || got[0].End != 45 || got[0].Source != "sponsorblock" {
+		t.Errorf("unexpected markers: %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/videos/9999/markers", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown video, got %d", rec.Code)
+	}
+}
+
+func TestAPIListVideos_Paging(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	for _, n := range []string{"a.mp4", "b.mp4", "c.mp4"} {
+		srv.store.UpsertVideo(ctx, d.ID, d.Path, n) //nolint:errcheck
+	}
+	for _, target := range []string{"/api/videos?limit=1&offset=1", "/api/videos?q=mp4&limit=1&offset=1"} {
+		rec := doAs(srv, nil, http.MethodGet, target, nil)
+		var got []apiVideo
+		json.NewDecoder(rec.Body).Decode(&got) //nolint:errcheck
+		if len(got) != 1 || got[0].Title != "b.mp4" || rec.Header().Get("X-Total-Count") != "3" {
+			t.Errorf("%s: got %d videos, total %q", target, len(got), rec.Header().Get("X-Total-Count"))
+		}
+	}
+	if rec := doAs(srv, nil, http.MethodGet, "/api/videos?limit=-1", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative limit: expected 400, got %d", rec.Code)
+	}
+}
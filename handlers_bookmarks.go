@@ -0,0 +1,107 @@
+// handlers_bookmarks.go – named positions saved from the player.
+//
+// GET    /videos/{id}/bookmarks              – the bookmark list partial
+// POST   /videos/{id}/bookmarks              – save one from the form fields position (seconds) and label
+// DELETE /videos/{id}/bookmarks/{bookmarkID} – remove one
+//
+// Each responds with the refreshed list. Like chapters, every bookmark links
+// to the player opened at its position, so a moment can also be shared.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxBookmarkLabel caps a bookmark label's length in runes.
+const maxBookmarkLabel = 200
+
+// bookmarkLink is one bookmark as shown in the player.
+type bookmarkLink struct {
+	ID       int64
+	Position float64 // seconds
+	Label    string
+	Clock    string // Position as "h:mm:ss" or "m:ss"
+	URL      string // opens the player at Position
+}
+
+// renderBookmarks writes the video's bookmark list partial.
+func (s *server) renderBookmarks(w http.ResponseWriter, r *http.Request, videoID int64) {
+	bookmarks, err := s.store.ListBookmarks(r.Context(), videoID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	links := make([]bookmarkLink, len(bookmarks))
+	for i, b := range bookmarks {
+		label := b.Label
+		if label == "" {
+			label = fmt.Sprintf("Bookmark %d", i+1)
+		}
+		links[i] = bookmarkLink{
+			ID:       b.ID,
+			Position: b.Position,
+			Label:    label,
+			Clock:    formatDuration(b.Position),
+			URL:      playerLink(videoID, b.Position),
+		}
+	}
+	render(w, "bookmarks.html", struct {
+		VideoID   int64
+		Bookmarks []bookmarkLink
+	}{videoID, links})
+}
+
+func (s *server) handleVideoBookmarks(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	s.renderBookmarks(w, r, video.ID)
+}
+
+func (s *server) handleAddBookmark(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	pos, err := strconv.ParseFloat(r.FormValue("position"), 64)
+	if err != nil || pos < 0 {
+		http.Error(w, "position must be a number of seconds", http.StatusBadRequest)
+		return
+	}
+	if video.DurationS > 0 && pos > video.DurationS {
+		pos = video.DurationS
+	}
+	label := strings.TrimSpace(r.FormValue("label"))
+	if len([]rune(label)) > maxBookmarkLabel {
+		http.Error(w, "label is too long", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.AddBookmark(r.Context(), video.ID, pos, label); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderBookmarks(w, r, video.ID)
+}
+
+func (s *server) handleDeleteBookmark(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	bookmarkID, err := strconv.ParseInt(chi.URLParam(r, "bookmarkID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid bookmark id", http.StatusBadRequest)
+		return
+	}
+	if err := s.store.DeleteBookmark(r.Context(), id, bookmarkID); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderBookmarks(w, r, id)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestBookmarks(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	base := "/videos/" + itoa(v.ID) + "/bookmarks"
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, base, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		return rec
+	}
+	rec := post(url.Values{"position": {"3725"}, "label": {"Car chase"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("add: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, want := range []string{"Car chase", "1:02:05", "/play/" + itoa(v.ID) + "?t=3725"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("list missing %q:\n%s", want, rec.Body.String())
+		}
+	}
+	if rec := post(url.Values{"position": {"-1"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative position: expected 400, got %d", rec.Code)
+	}
+
+	bookmarks, _ := srv.store.ListBookmarks(ctx, v.ID)
+	if len(bookmarks) != 1 {
+		t.Fatalf("expected 1 bookmark, got %d", len(bookmarks))
+	}
+	del := func(id int64) int {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, base+"/"+itoa(id), nil))
+		return rec.Code
+	}
+	if code := del(bookmarks[0].ID); code != http.StatusOK {
+		t.Errorf("delete: expected 200, got %d", code)
+	}
+	if code := del(bookmarks[0].ID); code != http.StatusNotFound {
+		t.Errorf("delete again: expected 404, got %d", code)
+	}
+}
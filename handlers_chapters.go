@@ -0,0 +1,100 @@
+// handlers_chapters.go – chapter markers embedded in video files.
+//
+// Chapters are read with ffprobe and stored as chapter markers, so the
+// markers API lists them alongside skip segments. Each chapter links to the
+// player opened at its start (/play/ID?t=SECONDS), which makes long
+// recordings navigable and individual chapters shareable.
+//
+// GET /videos/{id}/chapters – the video's chapters as JSON
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/store"
+)
+
+const chapterSource = "file" // store.Marker.Source for embedded chapters
+
+// chapterLink is one chapter as shown in the player and returned as JSON.
+type chapterLink struct {
+	Start float64 `json:"start"` // seconds
+	End   float64 `json:"end"`   // seconds
+	Title string  `json:"title"`
+	Clock string  `json:"clock"` // Start as "h:mm:ss" or "m:ss"
+	URL   string  `json:"url"`   // opens the player at Start
+}
+
+// chapterMarkers converts a file's chapters to markers for the store.
+func chapterMarkers(chapters []metadata.Chapter) []store.Marker {
+	markers := make([]store.Marker, len(chapters))
+	for i, c := range chapters {
+		markers[i] = store.Marker{Kind: store.MarkerChapter, Start: c.Start, End: c.End, Label: c.Title}
+	}
+	return markers
+}
+
+// playerLink is the URL that opens video id in the player at secs. Opened
+// in a browser it redirects into the app (see handlePlayer).
+func playerLink(id int64, secs float64) string {
+	return "/play/" + strconv.FormatInt(id, 10) + "?t=" + strconv.FormatFloat(secs, 'f', -1, 64)
+}
+
+// videoChapters returns the video's chapters in order. They are read from
+// the file the first time; a file without chapters is probed again on each
+// call, as the player already probes its streams on every open.
+func (s *server) videoChapters(ctx context.Context, v store.Video) []chapterLink {
+	markers, err := s.store.ListVideoMarkers(ctx, v.ID)
+	if err != nil {
+		slog.Warn("chapters: list markers failed", "video_id", v.ID, "err", err)
+		return nil
+	}
+	var chapters []store.Marker
+	for _, m := range markers {
+		if m.Kind == store.MarkerChapter {
+			chapters = append(chapters, m)
+		}
+	}
+	if len(chapters) == 0 {
+		meta, err := metadata.Read(v.FilePath())
+		if err != nil || len(meta.Chapters) == 0 {
+			return nil
+		}
+		chapters = chapterMarkers(meta.Chapters)
+		if err := s.store.SetVideoMarkers(ctx, v.ID, chapterSource, chapters); err != nil {
+			slog.Warn("chapters: store failed", "video_id", v.ID, "err", err)
+		}
+	}
+	out := make([]chapterLink, len(chapters))
+	for i, c := range chapters {
+		title := c.Label
+		if title == "" {
+			title = fmt.Sprintf("Chapter %d", i+1)
+		}
+		out[i] = chapterLink{
+			Start: c.Start,
+			End:   c.End,
+			Title: title,
+			Clock: formatDuration(c.Start),
+			URL:   playerLink(v.ID, c.Start),
+		}
+	}
+	return out
+}
+
+func (s *server) handleVideoChapters(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	chapters := s.videoChapters(r.Context(), video)
+	if chapters == nil {
+		chapters = []chapterLink{}
+	}
+	writeJSON(w, chapters)
+}
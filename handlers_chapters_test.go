@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// writeChapterStub installs an ffprobe that reports two chapters, the second
+// untitled, and logs each call to the returned file.
+func writeChapterStub(t *testing.T) (calls string) {
+	t.Helper()
+	bin := t.TempDir()
+	calls = filepath.Join(bin, "calls")
+	probe := `#!/bin/sh
+echo x >> "` + calls + `"
+echo '{"format":{"duration":"900.0"},"chapters":[{"start_time":"0.000000","end_time":"312.500000","tags":{"title":"Opening"}},{"start_time":"312.500000","end_time":"900.000000"}]}'
+`
+	os.WriteFile(filepath.Join(bin, "ffprobe"), []byte(probe), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin)
+	return calls
+}
+
+func TestHandleVideoChapters_ReadsOnceAndStores(t *testing.T) {
+	calls := writeChapterStub(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "talk.mkv"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "talk.mkv")
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/"+itoa(v.ID)+"/chapters", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, rec.Code)
+		}
+		var got []chapterLink
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		want := []chapterLink{
+			{Start: 0, End: 312.5, Title: "Opening", Clock: "0:00", URL: "/play/" + itoa(v.ID) + "?t=0"},
+			{Start: 312.5, End: 900, Title: "Chapter 2", Clock: "5:13", URL: "/play/" + itoa(v.ID) + "?t=312.5"},
+		}
+		if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Fatalf("request %d: chapters = %+v, want %+v", i, got, want)
+		}
+	}
+	if data, _ := os.ReadFile(calls); strings.Count(string(data), "x") != 1 {
+		t.Errorf("expected the file to be probed once, got %d calls", strings.Count(string(data), "x"))
+	}
+	markers, _ := srv.store.ListVideoMarkers(ctx, v.ID)
+	if len(markers) != 2 || markers[0].Kind != store.MarkerChapter || markers[0].Source != chapterSource {
+		t.Errorf("expected chapter markers in the store, got %+v", markers)
+	}
+}
+
+func TestHandleVideoChapters_NoneIsEmptyList(t *testing.T) {
+	t.Setenv("PATH", t.TempDir()) // no ffprobe
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "plain.mp4")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/"+itoa(v.ID)+"/chapters", nil))
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("expected an empty list, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlePlayer_ChaptersAndStartAt(t *testing.T) {
+	writeChapterStub(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "talk.mkv"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "talk.mkv")
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/play/"+itoa(v.ID)+"?t=312.5", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if !regexp.MustCompile(`seekPlayer\(videoID, +312\.5 *, false\)`).MatchString(body) {
+		t.Error("expected the player to start at 312.5s")
+	}
+	for _, want := range []string{
+		`href="/play/` + itoa(v.ID) + `?t=312.5"`,
+		"Chapter 2",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the player", want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/play/"+itoa(v.ID)+"?t=-4", nil))
+	if !regexp.MustCompile(`seekPlayer\(videoID, +0 *, false\)`).MatchString(rec.Body.String()) {
+		t.Error("expected a negative start to be ignored")
+	}
+
+	// Without ?t the player resumes from the saved position, unless that is
+	// within resumeEndSlack of the end.
+	srv.store.UpdateVideoDuration(ctx, v.ID, 900) //nolint:errcheck
+	for _, c := range []struct {
+		saved float64
+		want  string
+	}{{120, "120"}, {897, "0"}} {
+		srv.store.RecordWatch(ctx, v.ID, c.saved) //nolint:errcheck
+		rec = httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/play/"+itoa(v.ID), nil))
+		if !regexp.MustCompile(`seekPlayer\(videoID, +` + c.want + ` *, false\)`).MatchString(rec.Body.String()) {
+			t.Errorf("saved at %v: expected the player to start at %s", c.saved, c.want)
+		}
+	}
+
+	// Opened directly in a browser, a deep link lands in the app.
+	req := httptest.NewRequest(http.MethodGet, "/play/"+itoa(v.ID)+"?t=312.5", nil)
+	req.Header.Set("Sec-Fetch-Mode", "navigate")
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if want := "/?t=312.5&video=" + itoa(v.ID); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != want {
+		t.Errorf("expected a redirect to %s, got %d %q", want, rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestSyncDir_StoresChapters(t *testing.T) {
+	writeChapterStub(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "talk.mkv"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	srv.syncDir(d)
+
+	videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID)
+	if len(videos) != 1 {
+		t.Fatalf("expected 1 video, got %d", len(videos))
+	}
+	markers, _ := srv.store.ListVideoMarkers(ctx, videos[0].ID)
+	if len(markers) != 2 || markers[1].Kind != store.MarkerChapter || markers[1].Start != 312.5 {
+		t.Errorf("expected the scan to store chapters, got %+v", markers)
+	}
+}
@@ -0,0 +1,307 @@
+// handlers_config.go – moving the server's configuration to another machine.
+//
+// GET  /settings/export – download settings and directory options as JSON
+// POST /settings/import – apply a file produced by /settings/export
+//
+// Unlike a copy of the database, the export carries no videos, tags or watch
+// history: only what an admin configured. Nor does it carry credentials (API
+// keys and webhook URLs), since the file gets downloaded and passed around.
+// Directories are matched by path; an imported directory whose folder exists
+// but isn't registered is added and synced, and one whose folder is missing
+// is skipped. An import is checked in full before any of it is applied.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// configVersion is written to every export; imports of other versions are refused.
+const configVersion = 1
+
+// maxConfigBytes bounds an import body.
+const maxConfigBytes = 4 << 20
+
+// machineSettings are settings that identify this machine rather than
+// configure it, so they are neither exported nor imported.
+var machineSettings = []string{"dlna_uuid"}
+
+// portableSetting reports whether setting key travels in an export: it is
+// neither one of machineSettings nor a credential, an API key or a webhook
+// URL (which commonly carries a token). Credentials are entered on each
+// machine.
+func portableSetting(key string) bool {
+	return !slices.Contains(machineSettings, key) &&
+		!strings.HasSuffix(key, "_api_key") && !strings.HasSuffix(key, "_webhook_url")
+}
+
+// configDirectory is a directory's options as exported.
+type configDirectory struct {
+	Path           string   `json:"path"`
+	Parent         string   `json:"parent,omitempty"` // path of the directory it was registered under
+	Label          string   `json:"label,omitempty"`
+	Excludes       []string `json:"excludes,omitempty"`
+	MaxDepth       int      `json:"max_depth,omitempty"`
+	FollowSymlinks bool     `json:"follow_symlinks,omitempty"`
+	PruneEmpty     bool     `json:"prune_empty,omitempty"`
+	SyncEvery      int64    `json:"sync_every_s,omitempty"` // seconds between scheduled rescans
+	BudgetBytes    int64    `json:"budget_bytes,omitempty"`
+	CapBytes       int64    `json:"cap_bytes,omitempty"`
+}
+
+// configExport is the document served by /settings/export.
+type configExport struct {
+	Version     int               `json:"version"`
+	ExportedAt  time.Time         `json:"exported_at"`
+	Settings    map[string]string `json:"settings"`
+	Directories []configDirectory `json:"directories"`
+}
+
+// configImportResult reports what an import changed.
+type configImportResult struct {
+	Settings    int      `json:"settings"`
+	Directories int      `json:"directories"`
+	Added       []string `json:"added,omitempty"`   // directories registered by the import
+	Skipped     []string `json:"skipped,omitempty"` // directories whose folder doesn't exist here
+}
+
+func (s *server) handleExportConfig(w http.ResponseWriter, r *http.Request) {
+	settings, err := s.store.ListSettingsWithPrefix(r.Context(), "")
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	for key := range settings {
+		if !portableSetting(key) {
+			delete(settings, key)
+		}
+	}
+	dirs, err := s.store.ListDirectories(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	paths := make(map[int64]string, len(dirs))
+	for _, d := range dirs {
+		paths[d.ID] = d.Path
+	}
+	out := configExport{
+		Version:     configVersion,
+		ExportedAt:  time.Now().UTC(),
+		Settings:    settings,
+		Directories: make([]configDirectory, 0, len(dirs)),
+	}
+	for _, d := range dirs {
+		out.Directories = append(out.Directories, configDirectory{
+			Path:           d.Path,
+			Parent:         paths[d.ParentID],
+			Label:          d.Label,
+			Excludes:       d.Excludes,
+			MaxDepth:       d.MaxDepth,
+			FollowSymlinks: d.FollowSymlinks,
+			PruneEmpty:     d.PruneEmpty,
+			SyncEvery:      int64(d.SyncEvery / time.Second),
+			BudgetBytes:    d.BudgetBytes,
+			CapBytes:       d.CapBytes,
+		})
+	}
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="video_manger-config-%s.json"`, out.ExportedAt.Format("2006-01-02")))
+	writeJSON(w, out)
+}
+
+// errConfigDuplicate is returned for an import listing one folder twice.
+var errConfigDuplicate = errors.New("directory listed twice")
+
+// configDirPlan is an imported directory as worked out before anything is
+// applied: the registered entry it updates, or the folder it adds and what
+// to link it under.
+type configDirPlan struct {
+	configDirectory
+	dir        store.Directory // the registered entry; zero when add
+	add        bool
+	parentID   int64  // a registered parent
+	parentPath string // a parent this import adds
+}
+
+func (s *server) handleImportConfig(w http.ResponseWriter, r *http.Request) {
+	var in configExport
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConfigBytes))
+	if err := dec.Decode(&in); err != nil {
+		http.Error(w, "invalid configuration file", http.StatusBadRequest)
+		return
+	}
+	if in.Version != configVersion {
+		http.Error(w, fmt.Sprintf("unsupported configuration version %d", in.Version), http.StatusBadRequest)
+		return
+	}
+	for _, d := range in.Directories {
+		if err := validateConfigDirectory(d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for key := range in.Settings {
+		if !portableSetting(key) {
+			delete(in.Settings, key)
+		}
+	}
+	ctx := r.Context()
+	plan, skipped, err := s.planConfigDirectories(ctx, in.Directories)
+	if errors.Is(err, errConfigDuplicate) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	// Everything checks out; apply it.
+	if len(in.Settings) > 0 {
+		if err := s.store.SaveSettings(ctx, in.Settings); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+	res := configImportResult{Settings: len(in.Settings), Skipped: skipped}
+	added := make(map[string]store.Directory)
+	var toSync []store.Directory
+	for _, p := range plan {
+		d := p.dir
+		if p.add {
+			switch {
+			case p.parentPath != "":
+				d, err = s.store.AddChildDirectory(ctx, added[p.parentPath].ID, p.Path)
+			case p.parentID != 0:
+				d, err = s.store.AddChildDirectory(ctx, p.parentID, p.Path)
+			default:
+				d, err = s.store.AddDirectory(ctx, p.Path)
+			}
+			if err != nil {
+				addDirectoryError(w, err)
+				return
+			}
+			added[d.Path] = d
+			res.Added = append(res.Added, d.Path)
+		}
+		if err := s.applyConfigDirectory(ctx, d.ID, p.configDirectory); err != nil {
+			storeError(w, err)
+			return
+		}
+		d.Label, d.Excludes, d.MaxDepth, d.FollowSymlinks = p.Label, p.Excludes, p.MaxDepth, p.FollowSymlinks
+		d.PruneEmpty, d.SyncEvery = p.PruneEmpty, time.Duration(p.SyncEvery)*time.Second
+		d.BudgetBytes, d.CapBytes = p.BudgetBytes, p.CapBytes
+		toSync = append(toSync, d)
+		res.Directories++
+	}
+	// Children are all registered before any sync starts so a parent's walk
+	// skips their folders, as in handleAddDirectory.
+	for _, d := range toSync {
+		s.startSyncDir(d)
+	}
+	writeJSON(w, res)
+}
+
+// planConfigDirectories works out what importing dirs does, parents before
+// their children, without changing anything. It returns the folders
+// missing here, which are skipped, apart.
+func (s *server) planConfigDirectories(ctx context.Context, dirs []configDirectory) ([]configDirPlan, []string, error) {
+	list, err := s.store.ListDirectories(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	registered := make(map[string]store.Directory, len(list))
+	for _, d := range list {
+		registered[d.Path] = d
+	}
+	// Parents come before their children so a child can be linked to the
+	// entry its parent is added as.
+	slices.SortStableFunc(dirs, func(a, b configDirectory) int {
+		return len(filepath.Clean(a.Path)) - len(filepath.Clean(b.Path))
+	})
+	var (
+		plan    []configDirPlan
+		skipped []string
+	)
+	planned := make(map[string]bool)
+	for _, cd := range dirs {
+		path, err := store.CanonicalPath(cd.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if planned[path] {
+			return nil, nil, fmt.Errorf("%w: %s", errConfigDuplicate, cd.Path)
+		}
+		p := configDirPlan{configDirectory: cd}
+		if d, ok := registered[path]; ok {
+			p.dir = d
+		} else {
+			if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+				skipped = append(skipped, cd.Path)
+				continue
+			}
+			p.add = true
+			if parent, err := store.CanonicalPath(cd.Parent); err == nil {
+				if d, ok := registered[parent]; ok {
+					p.parentID = d.ID
+				} else if planned[parent] {
+					p.parentPath = parent
+				}
+			}
+		}
+		planned[path] = true
+		plan = append(plan, p)
+	}
+	return plan, skipped, nil
+}
+
+// applyConfigDirectory stores an imported directory's options.
+func (s *server) applyConfigDirectory(ctx context.Context, id int64, cd configDirectory) error {
+	if err := s.store.SetDirectoryLabel(ctx, id, cd.Label); err != nil {
+		return err
+	}
+	if err := s.store.SetDirectoryExcludes(ctx, id, cd.Excludes); err != nil {
+		return err
+	}
+	if err := s.store.SetDirectoryMaxDepth(ctx, id, cd.MaxDepth); err != nil {
+		return err
+	}
+	if err := s.store.SetDirectoryFollowSymlinks(ctx, id, cd.FollowSymlinks); err != nil {
+		return err
+	}
+	if err := s.store.SetDirectoryPruneEmpty(ctx, id, cd.PruneEmpty); err != nil {
+		return err
+	}
+	if err := s.store.SetDirectorySyncEvery(ctx, id, time.Duration(cd.SyncEvery)*time.Second); err != nil {
+		return err
+	}
+	return s.store.SetDirectoryBudget(ctx, id, cd.BudgetBytes, cd.CapBytes)
+}
+
+// validateConfigDirectory checks an imported directory with the same rules
+// the scan-options and budget forms apply.
+func validateConfigDirectory(d configDirectory) error {
+	if !filepath.IsAbs(d.Path) {
+		return fmt.Errorf("directory path must be absolute: %q", d.Path)
+	}
+	for _, p := range d.Excludes {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern: %s", p)
+		}
+	}
+	if d.MaxDepth < 0 || d.BudgetBytes < 0 || d.CapBytes < 0 || !validSyncEvery(time.Duration(d.SyncEvery)*time.Second) {
+		return fmt.Errorf("invalid options for %s", d.Path)
+	}
+	return nil
+}
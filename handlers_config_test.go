@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := newTestServer(t)
+	if err := src.store.SaveSettings(ctx, map[string]string{
+		"autoplay_next": "true",
+		"video_sort":    "rating",
+		"dlna_uuid":     "this-machine",
+		"tmdb_api_key":  "secret-key",
+
+		"events_webhook_url": "https://hooks.example.com/secret-token",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	dir, err := src.store.AddDirectory(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.store.SetDirectoryExcludes(ctx, dir.ID, []string{"*.part"}) //nolint:errcheck
+	src.store.SetDirectoryMaxDepth(ctx, dir.ID, 2)                  //nolint:errcheck
+	src.store.SetDirectoryLabel(ctx, dir.ID, "Movies")              //nolint:errcheck
+	src.store.SetDirectoryBudget(ctx, dir.ID, 1<<30, 2<<30)         //nolint:errcheck
+	src.store.SetDirectorySyncEvery(ctx, dir.ID, time.Hour)         //nolint:errcheck
+	if _, err := src.store.AddDirectory(ctx, filepath.Join(root, "gone")); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	src.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/settings/export", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	exported := rec.Body.String()
+	if strings.Contains(exported, "this-machine") {
+		t.Error("export includes the machine's DLNA UUID")
+	}
+	if strings.Contains(exported, "secret-key") || strings.Contains(exported, "secret-token") {
+		t.Error("export includes credentials")
+	}
+
+	dst := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/settings/import", strings.NewReader(exported))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	dst.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var res configImportResult
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Directories != 1 || !slices.Equal(res.Skipped, []string{filepath.Join(dir.Path, "gone")}) {
+		t.Errorf("result = %+v, want one directory and the missing folder skipped", res)
+	}
+
+	if v, _ := dst.store.GetSetting(ctx, "video_sort"); v != "rating" {
+		t.Errorf("video_sort = %q, want rating", v)
+	}
+	if v, _ := dst.store.GetSetting(ctx, "dlna_uuid"); v != "" {
+		t.Errorf("dlna_uuid = %q, want it left unset", v)
+	}
+	dirs, err := dst.store.ListDirectories(ctx)
+	if err != nil || len(dirs) != 1 {
+		t.Fatalf("directories = %+v, %v; want one", dirs, err)
+	}
+	got := dirs[0]
+	if got.Path != dir.Path || got.Label != "Movies" || got.MaxDepth != 2 ||
+		!slices.Equal(got.Excludes, []string{"*.part"}) || got.BudgetBytes != 1<<30 || got.CapBytes != 2<<30 ||
+		got.SyncEvery != time.Hour {
+		t.Errorf("imported directory = %+v", got)
+	}
+}
+
+func TestConfigImport_Invalid(t *testing.T) {
+	srv := newTestServer(t)
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"not json":       "{",
+		"wrong version":  `{"version": 99}`,
+		"relative path":  `{"version": 1, "directories": [{"path": "videos"}]}`,
+		"bad pattern":    `{"version": 1, "directories": [{"path": "/videos", "excludes": ["["]}]}`,
+		"negative depth": `{"version": 1, "directories": [{"path": "/videos", "max_depth": -1}]}`,
+		"odd schedule":   `{"version": 1, "directories": [{"path": "/videos", "sync_every_s": 42}]}`,
+		"listed twice": `{"version": 1, "settings": {"video_sort": "rating"},
+		                  "directories": [{"path": "` + dir + `"}, {"path": "` + dir + `/"}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/settings/import", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rec.Code)
+		}
+	}
+	// Nothing of a refused import is applied.
+	if v, _ := srv.store.GetSetting(context.Background(), "video_sort"); v == "rating" {
+		t.Error("a refused import changed video_sort")
+	}
+	if dirs, _ := srv.store.ListDirectories(context.Background()); len(dirs) != 0 {
+		t.Errorf("directories after refused imports = %+v", dirs)
+	}
+}
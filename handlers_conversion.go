@@ -4,10 +4,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"net/http"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
@@ -69,6 +70,7 @@ func (s *server) handleConvertStart(w http.ResponseWriter, r *http.Request) {
 	s.convertJobsMu.Unlock()
 
 	dirID := video.DirectoryID
+	userID := s.requestUser(r).ID
 	go func() {
 		defer scheduleJobCleanup(job.ch, func() {
 			s.convertJobsMu.Lock()
@@ -91,14 +93,16 @@ func (s *server) handleConvertStart(w http.ResponseWriter, r *http.Request) {
 		err := transcode.ConvertProgress(context.Background(), src, dst, f, quality, totalSecs, send)
 		if err != nil {
 			job.err = err
-			if rmErr := os.Remove(dst); rmErr != nil && !os.IsNotExist(rmErr) {
+			if rmErr := s.blobs.Remove(dst); rmErr != nil && !errors.Is(rmErr, fs.ErrNotExist) {
 				slog.Warn("convert: remove failed output", "path", dst, "err", rmErr)
 			}
+			s.notifyFailed(userID, store.NotifyExport, "Converting "+video.Title()+" failed: "+err.Error(), video.ID)
 		} else {
 			job.outName = outName
 			if d, err2 := s.store.GetDirectory(context.Background(), dirID); err2 == nil {
 				s.startSyncDir(d)
 			}
+			s.notify(userID, store.NotifyExport, "Converted "+video.Title()+" to "+outName, video.ID)
 		}
 	}()
 
@@ -178,7 +182,8 @@ func (s *server) handleExportUSB(w http.ResponseWriter, r *http.Request) {
 	if d, err := s.store.GetDirectory(r.Context(), video.DirectoryID); err == nil {
 		s.startSyncDir(d)
 	}
-	fmt.Fprintf(w, `<span style="color:#4a9a4a;font-size:0.8rem">✓ Exported as %s</span>`, dstName)
+	s.notify(s.requestUser(r).ID, store.NotifyExport, "Exported "+video.Title()+" for USB as "+dstName, video.ID)
+	renderNotice(w, true, "Exported as "+dstName)
 }
 
 // ── Shared helpers ────────────────────────────────────────────────────────────
@@ -266,8 +271,8 @@ func (s *server) handleTrim(w http.ResponseWriter, r *http.Request) {
 			newVid = upserted
 		}
 	} else {
-		if err := os.Rename(dst, src); err != nil {
-			os.Remove(dst)
+		if err := s.blobs.Rename(dst, src); err != nil {
+			s.blobs.Remove(dst) //nolint:errcheck
 			http.Error(w, "replace failed: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -368,8 +373,8 @@ func (s *server) handleDelogo(w http.ResponseWriter, r *http.Request) {
 			newVid = upserted
 		}
 	} else {
-		if err := os.Rename(dst, src); err != nil {
-			os.Remove(dst)
+		if err := s.blobs.Rename(dst, src); err != nil {
+			s.blobs.Remove(dst) //nolint:errcheck
 			http.Error(w, "replace failed: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -4,22 +4,27 @@ package main
 
 import (
 	"bufio"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/naming"
 	"github.com/maxgarvey/video_manger/store"
 )
 
@@ -49,7 +54,7 @@ func (s *server) importFile(ctx context.Context, dir store.Directory, fh io.Read
 	if err != nil {
 		slog.Warn("import: upsert video failed", "dir", dir.Path, "filename", savedName, "err", err)
 	} else {
-		dirTag, err := s.store.UpsertTag(ctx, filepath.Base(dir.Path))
+		dirTag, err := s.store.UpsertTag(ctx, dir.Title())
 		if err == nil {
 			_ = s.store.TagVideo(ctx, v.ID, dirTag.ID)
 		}
@@ -99,29 +104,78 @@ func (s *server) handleImportUpload(w http.ResponseWriter, r *http.Request) {
 
 // ── Directories ───────────────────────────────────────────────────────────────
 
+// directoryDeletion is what deleting a directory's files would destroy.
+type directoryDeletion struct {
+	store.Directory
+	Files   int
+	Bytes   int64
+	Unsized int // files with no size recorded yet, not counted in Bytes
+	// Typed is the text the user must type to confirm a large deletion;
+	// empty when a click is enough.
+	Typed string
+}
+
+func (d directoryDeletion) Size() string { return formatBytes(d.Bytes) }
+
+// planDirectoryDeletion counts the files of directory id from the sizes
+// recorded by the last scan.
+func (s *server) planDirectoryDeletion(ctx context.Context, id int64) (directoryDeletion, error) {
+	dir, err := s.store.GetDirectory(ctx, id)
+	if err != nil {
+		return directoryDeletion{}, err
+	}
+	videos, err := s.store.ListVideosByDirectory(ctx, id)
+	if err != nil {
+		return directoryDeletion{}, err
+	}
+	d := directoryDeletion{Directory: dir, Files: len(videos)}
+	for _, v := range videos {
+		if v.FileSize == 0 {
+			d.Unsized++
+		}
+		d.Bytes += v.FileSize
+	}
+	if d.Files > deleteTypedFiles || d.Bytes > deleteTypedBytes {
+		d.Typed = dir.Title()
+	}
+	return d, nil
+}
+
 func (s *server) handleDirectoryDeleteConfirm(w http.ResponseWriter, r *http.Request) {
 	id, ok := parseIDParam(w, r)
 	if !ok {
 		return
 	}
-	dir, err := s.store.GetDirectory(r.Context(), id)
+	plan, err := s.planDirectoryDeletion(r.Context(), id)
 	if err != nil {
-		http.Error(w, "directory not found", http.StatusNotFound)
+		storeError(w, err)
 		return
 	}
-	render(w, "directory_delete_confirm.html", dir)
+	render(w, "directory_delete_confirm.html", plan)
 }
 
+// DELETE /directories/{id}/files removes the directory and deletes its
+// files. A large deletion also needs the form value confirm set to the
+// directory's title.
 func (s *server) handleDeleteDirectoryAndFiles(w http.ResponseWriter, r *http.Request) {
 	id, ok := parseIDParam(w, r)
 	if !ok {
 		return
 	}
+	plan, err := s.planDirectoryDeletion(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if plan.Typed != "" && strings.TrimSpace(r.FormValue("confirm")) != plan.Typed {
+		http.Error(w, fmt.Sprintf("type %q to delete %d files", plan.Typed, plan.Files), http.StatusBadRequest)
+		return
+	}
 	// Atomically delete all video records and the directory in a single
 	// transaction, then remove the files from disk on a best-effort basis.
 	paths, err := s.store.DeleteDirectoryAndVideos(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	for _, p := range paths {
@@ -135,7 +189,7 @@ func (s *server) handleDeleteDirectoryAndFiles(w http.ResponseWriter, r *http.Re
 func (s *server) serveDirList(w http.ResponseWriter, r *http.Request) {
 	dirs, err := s.store.ListDirectories(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	s.syncingMu.Lock()
@@ -144,10 +198,20 @@ func (s *server) serveDirList(w http.ResponseWriter, r *http.Request) {
 		syncing[id] = true
 	}
 	s.syncingMu.Unlock()
+	// The most severe exceeded limit per directory, for its badge.
+	over := make(map[int64]*budgetAlert)
+	if alerts, err := s.budgetAlerts(r.Context()); err == nil {
+		for _, a := range alerts {
+			if a.Scope == "directory" && (over[a.DirectoryID] == nil || a.Hard) {
+				over[a.DirectoryID] = &a
+			}
+		}
+	}
 	data := struct {
 		Dirs    []store.Directory
 		Syncing map[int64]bool
-	}{dirs, syncing}
+		Over    map[int64]*budgetAlert
+	}{dirs, syncing, over}
 	render(w, "directories.html", data)
 }
 
@@ -165,10 +229,304 @@ func (s *server) handleSyncDirectory(w http.ResponseWriter, r *http.Request) {
 	s.serveDirList(w, r)
 }
 
+// handleSetDirectoryScanOptions saves a directory's exclude patterns (one
+// glob per line in "patterns"), "max_depth" (blank or 0 = unlimited) and
+// the other scan options parseScanOptions reads, then rescans it so files
+// that are now out of scope drop out of the library.
+func (s *server) handleSetDirectoryScanOptions(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	dir, err := s.store.GetDirectory(r.Context(), id)
+	if err != nil {
+		http.Error(w, "directory not found", http.StatusNotFound)
+		return
+	}
+	opts, err := parseScanOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.store.SetDirectoryExcludes(r.Context(), id, opts.Excludes); err != nil {
+		storeError(w, err)
+		return
+	}
+	if err := s.store.SetDirectoryMaxDepth(r.Context(), id, opts.MaxDepth); err != nil {
+		storeError(w, err)
+		return
+	}
+	if err := s.store.SetDirectoryFollowSymlinks(r.Context(), id, opts.FollowSymlinks); err != nil {
+		storeError(w, err)
+		return
+	}
+	if err := s.store.SetDirectoryPruneEmpty(r.Context(), id, opts.PruneEmpty); err != nil {
+		storeError(w, err)
+		return
+	}
+	if err := s.store.SetDirectorySyncEvery(r.Context(), id, opts.SyncEvery); err != nil {
+		storeError(w, err)
+		return
+	}
+	dir.Excludes, dir.MaxDepth, dir.FollowSymlinks = opts.Excludes, opts.MaxDepth, opts.FollowSymlinks
+	dir.PruneEmpty, dir.SyncEvery = opts.PruneEmpty, opts.SyncEvery
+	s.startSyncDir(dir)
+	s.serveDirList(w, r)
+}
+
+// handleSetDirectoryBudget sets a directory's soft budget ("budget_gb") and
+// hard download cap ("cap_gb"); blank clears either.
+func (s *server) handleSetDirectoryBudget(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.store.GetDirectory(r.Context(), id); err != nil {
+		http.Error(w, "directory not found", http.StatusNotFound)
+		return
+	}
+	budget, ok := parseGigabytes(r.FormValue("budget_gb"))
+	if !ok {
+		http.Error(w, "invalid budget", http.StatusBadRequest)
+		return
+	}
+	capBytes, ok := parseGigabytes(r.FormValue("cap_gb"))
+	if !ok {
+		http.Error(w, "invalid cap", http.StatusBadRequest)
+		return
+	}
+	if err := s.store.SetDirectoryBudget(r.Context(), id, budget, capBytes); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.checkBudgets(r.Context())
+	s.serveDirList(w, r)
+}
+
+// handleSetDirectoryLabel sets a directory's display label. The label is
+// also the directory's auto-tag, so the videos lose the old auto-tag and a
+// rescan applies the new one.
+func (s *server) handleSetDirectoryLabel(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	dir, err := s.store.GetDirectory(r.Context(), id)
+	if err != nil {
+		http.Error(w, "directory not found", http.StatusNotFound)
+		return
+	}
+	label := strings.TrimSpace(r.FormValue("label"))
+	if strings.Contains(label, ":") {
+		// Namespaced names are reserved for system tags (show:, genre:, …).
+		http.Error(w, "label must not contain ':'", http.StatusBadRequest)
+		return
+	}
+	if err := s.store.SetDirectoryLabel(r.Context(), id, label); err != nil {
+		storeError(w, err)
+		return
+	}
+	oldTitle := dir.Title()
+	dir.Label = label
+	if dir.Title() != oldTitle {
+		s.untagDirectory(r.Context(), dir.ID, oldTitle)
+		s.startSyncDir(dir)
+		w.Header().Set("HX-Trigger", `{"videoRenamed":true}`)
+	}
+	s.serveDirList(w, r)
+}
+
+// untagDirectory removes the tag named tagName from every video in the
+// directory and prunes it if no video carries it any more.
+func (s *server) untagDirectory(ctx context.Context, dirID int64, tagName string) {
+	tags, err := s.store.ListTags(ctx)
+	if err != nil {
+		slog.Warn("untag directory: list tags failed", "err", err)
+		return
+	}
+	i := slices.IndexFunc(tags, func(t store.Tag) bool { return t.Name == tagName })
+	if i < 0 {
+		return
+	}
+	videos, err := s.store.ListVideosByDirectory(ctx, dirID)
+	if err != nil {
+		slog.Warn("untag directory: list videos failed", "dirID", dirID, "err", err)
+		return
+	}
+	for _, v := range videos {
+		if err := s.store.UntagVideo(ctx, v.ID, tags[i].ID); err != nil {
+			slog.Warn("untag directory: untag failed", "videoID", v.ID, "err", err)
+		}
+	}
+	if err := s.store.PruneOrphanTags(ctx); err != nil {
+		slog.Warn("untag directory: prune tags failed", "err", err)
+	}
+}
+
+// pruneEmptyFolders removes folder if it is empty, then each parent left
+// empty in turn, when the registered directory it lies under has PruneEmpty
+// set. It stops at any registered directory, which is never removed. Called
+// after a video file is deleted or moved out of folder.
+func (s *server) pruneEmptyFolders(ctx context.Context, folder string) {
+	dirs, err := s.store.ListDirectories(ctx)
+	if err != nil {
+		slog.Warn("prune empty folders: list directories failed", "err", err)
+		return
+	}
+	registered := make(map[string]bool, len(dirs))
+	var root store.Directory
+	for _, d := range dirs {
+		registered[d.Path] = true
+		if strings.HasPrefix(folder, d.Path+string(filepath.Separator)) && len(d.Path) > len(root.Path) {
+			root = d
+		}
+	}
+	if !root.PruneEmpty {
+		return
+	}
+	for folder != root.Path && !registered[folder] {
+		if err := os.Remove(folder); err != nil {
+			// Not empty (or already gone): nothing above it is empty either.
+			return
+		}
+		slog.Info("removed empty folder", "path", folder)
+		folder = filepath.Dir(folder)
+	}
+}
+
+// syncEveryOption is a rescan schedule offered for a directory.
+type syncEveryOption struct {
+	Every time.Duration
+	Label string
+}
+
+// syncEveryOptions are the rescan schedules a directory can have, as offered
+// in its scan options; 0 rescans it on every poll.
+var syncEveryOptions = []syncEveryOption{
+	{0, "every minute"},
+	{5 * time.Minute, "every 5 minutes"},
+	{15 * time.Minute, "every 15 minutes"},
+	{time.Hour, "hourly"},
+	{6 * time.Hour, "every 6 hours"},
+	{24 * time.Hour, "daily"},
+	{7 * 24 * time.Hour, "weekly"},
+}
+
+// validSyncEvery reports whether every is one of syncEveryOptions.
+func validSyncEvery(every time.Duration) bool {
+	return slices.ContainsFunc(syncEveryOptions, func(o syncEveryOption) bool { return o.Every == every })
+}
+
+// parseScanOptions reads the "patterns" (one glob per line), "max_depth",
+// "follow_symlinks", "prune_empty" and "sync_every" (seconds, one of
+// syncEveryOptions) form values shared by the scan-options and preview
+// endpoints. Only the scan option fields of the returned Directory are set.
+func parseScanOptions(r *http.Request) (store.Directory, error) {
+	var opts store.Directory
+	for _, p := range strings.Split(r.FormValue("patterns"), "\n") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return store.Directory{}, fmt.Errorf("invalid pattern: %s", p)
+		}
+		opts.Excludes = append(opts.Excludes, p)
+	}
+	if v := strings.TrimSpace(r.FormValue("max_depth")); v != "" {
+		depth, err := strconv.Atoi(v)
+		if err != nil || depth < 0 {
+			return store.Directory{}, fmt.Errorf("max_depth must be a non-negative integer")
+		}
+		opts.MaxDepth = depth
+	}
+	opts.FollowSymlinks = r.FormValue("follow_symlinks") != ""
+	opts.PruneEmpty = r.FormValue("prune_empty") != ""
+	if v := strings.TrimSpace(r.FormValue("sync_every")); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || !validSyncEvery(time.Duration(secs)*time.Second) {
+			return store.Directory{}, fmt.Errorf("invalid rescan schedule")
+		}
+		opts.SyncEvery = time.Duration(secs) * time.Second
+	}
+	return opts, nil
+}
+
+// previewFile is one entry of a scan preview.
+type previewFile struct {
+	Path string `json:"path"` // relative to the previewed directory
+	Size int64  `json:"size"`
+}
+
+// scanPreview is the response of GET /directories/preview.
+type scanPreview struct {
+	Path       string        `json:"path"`
+	Count      int           `json:"count"`
+	TotalBytes int64         `json:"total_bytes"`
+	Files      []previewFile `json:"files"`
+	Truncated  bool          `json:"truncated"` // Files was capped at previewMaxFiles
+}
+
+// handlePreviewDirectory serves GET /directories/preview?path=…: a dry run
+// of syncDir that reports which video files would be imported, honouring
+// the optional scan options ("patterns", "max_depth", "follow_symlinks"),
+// without writing anything. Folders that are already registered directories
+// are skipped, just as a real sync would.
+func (s *server) handlePreviewDirectory(w http.ResponseWriter, r *http.Request) {
+	path := filepath.Clean(strings.TrimSpace(r.URL.Query().Get("path")))
+	if path == "." {
+		http.Error(w, "path required", http.StatusBadRequest)
+		return
+	}
+	if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+		http.Error(w, "not a directory", http.StatusBadRequest)
+		return
+	}
+	d, err := parseScanOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d.Path = path
+	dirs, err := s.store.ListDirectories(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	registered := make(map[string]bool, len(dirs))
+	for _, rd := range dirs {
+		registered[filepath.Clean(rd.Path)] = true
+	}
+
+	out := scanPreview{Path: path, Files: []previewFile{}}
+	err = walkVideoFiles(d, registered, s.skipJunkFiles(r.Context()), func(p string, de fs.DirEntry) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		info, err := de.Info()
+		if err != nil {
+			return nil
+		}
+		out.Count++
+		out.TotalBytes += info.Size()
+		if len(out.Files) < previewMaxFiles {
+			rel, _ := filepath.Rel(path, p)
+			out.Files = append(out.Files, previewFile{Path: rel, Size: info.Size()})
+		} else {
+			out.Truncated = true
+		}
+		return nil
+	})
+	if err != nil {
+		return // client went away
+	}
+	writeJSON(w, out)
+}
+
 func (s *server) handleDirectoryOptions(w http.ResponseWriter, r *http.Request) {
 	dirs, err := s.store.ListDirectories(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	render(w, "directory_options.html", dirs)
@@ -180,13 +538,23 @@ func (s *server) handleDirectoryOptions(w http.ResponseWriter, r *http.Request)
 func (s *server) addAndSyncDir(w http.ResponseWriter, r *http.Request, path string) {
 	d, err := s.store.AddDirectory(r.Context(), path)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		addDirectoryError(w, err)
 		return
 	}
 	s.startSyncDir(d)
 	s.serveDirList(w, r)
 }
 
+// addDirectoryError reports a failure to register a directory: 400 for a
+// path that is empty or relative, 500 for anything else.
+func addDirectoryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrRelativePath) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	storeError(w, err)
+}
+
 // handleCreateDirectory creates the directory on disk (MkdirAll) then registers
 // and syncs it.  Creation is restricted to the user's home-directory subtree
 // to prevent an authenticated client from creating directories anywhere on the
@@ -215,13 +583,71 @@ func (s *server) handleCreateDirectory(w http.ResponseWriter, r *http.Request) {
 	s.addAndSyncDir(w, r, cleaned)
 }
 
+// handleAddDirectory registers a directory. With "split_subdirs" set, each
+// immediate visible subfolder is also registered as its own child entry so
+// that e.g. season or show folders get separate tags and scan options.
 func (s *server) handleAddDirectory(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimSpace(r.FormValue("path"))
 	if path == "" {
 		http.Error(w, "path required", http.StatusBadRequest)
 		return
 	}
-	s.addAndSyncDir(w, r, path)
+	if r.FormValue("split_subdirs") == "" {
+		s.addAndSyncDir(w, r, path)
+		return
+	}
+	parent, err := s.store.AddDirectory(r.Context(), path)
+	if err != nil {
+		addDirectoryError(w, err)
+		return
+	}
+	children, err := s.addChildDirectories(r.Context(), parent)
+	if err != nil {
+		slog.Warn("register subdirectories failed", "dir", parent.Path, "err", err)
+	}
+	// Children are registered before any sync starts so the parent's walk
+	// skips their folders instead of claiming their videos.
+	for _, d := range children {
+		s.startSyncDir(d)
+	}
+	s.startSyncDir(parent)
+	s.serveDirList(w, r)
+}
+
+// addChildDirectories registers every immediate, non-hidden subfolder of
+// parent that is not already a registered directory, linked to parent.
+func (s *server) addChildDirectories(ctx context.Context, parent store.Directory) ([]store.Directory, error) {
+	entries, err := os.ReadDir(parent.Path)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := s.store.ListDirectories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	registered := make(map[string]bool, len(dirs))
+	for _, d := range dirs {
+		registered[filepath.Clean(d.Path)] = true
+	}
+	var children []store.Directory
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		// Directories are stored under their canonical path, so a
+		// symlinked subfolder is registered if its target is.
+		path, err := store.CanonicalPath(filepath.Join(parent.Path, e.Name()))
+		if err != nil || registered[path] {
+			continue
+		}
+		registered[path] = true // two links to the same folder
+		d, err := s.store.AddChildDirectory(ctx, parent.ID, path)
+		if err != nil {
+			return children, err
+		}
+		children = append(children, d)
+	}
+	return children, nil
 }
 
 func (s *server) handleDeleteDirectory(w http.ResponseWriter, r *http.Request) {
@@ -230,7 +656,7 @@ func (s *server) handleDeleteDirectory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.store.DeleteDirectory(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	s.serveDirList(w, r)
@@ -257,6 +683,10 @@ func (s *server) handleRenameDirectory(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "name must not contain path separators or '..'", http.StatusBadRequest)
 		return
 	}
+	if name = naming.Sanitize(name); name == "" {
+		http.Error(w, "name has no usable characters", http.StatusBadRequest)
+		return
+	}
 	newPath := filepath.Join(filepath.Dir(dir.Path), name)
 	if newPath == dir.Path {
 		s.serveDirList(w, r)
@@ -276,7 +706,7 @@ func (s *server) handleRenameDirectory(w http.ResponseWriter, r *http.Request) {
 	if err := s.store.RenameDirectory(r.Context(), id, newPath); err != nil {
 		// Roll back filesystem change.
 		os.Rename(newPath, dir.Path) //nolint:errcheck
-		http.Error(w, "db update failed: "+err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	// Trigger a video list refresh so stale paths/group names update.
@@ -307,12 +737,22 @@ func (s *server) handleCreateSubfolder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "folder name must not contain path separators or '..'", http.StatusBadRequest)
 		return
 	}
+	if name = naming.Sanitize(name); name == "" {
+		http.Error(w, "folder name has no usable characters", http.StatusBadRequest)
+		return
+	}
 	path := filepath.Join(parent.Path, name)
 	if err := os.MkdirAll(path, 0755); err != nil {
 		http.Error(w, "could not create folder: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	s.addAndSyncDir(w, r, path)
+	d, err := s.store.AddChildDirectory(r.Context(), parent.ID, path)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	s.startSyncDir(d)
+	s.serveDirList(w, r)
 }
 
 // handleBrowseFS lists the immediate visible subdirectories of a path.
@@ -393,15 +833,15 @@ func (s *server) handleYTDLPDownload(w http.ResponseWriter, r *http.Request) {
 	}
 	// Split on newlines; validate each URL allows only http/https to prevent
 	// SSRF via file://, ftp://, or internal network schemes that yt-dlp accepts.
+	allowed := s.ytdlpAllowedDomains(r.Context())
 	var urls []string
 	for _, line := range strings.Split(rawURLs, "\n") {
 		u := strings.TrimSpace(line)
 		if u == "" {
 			continue
 		}
-		parsed, parseErr := url.Parse(u)
-		if parseErr != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
-			http.Error(w, "only http:// and https:// URLs are permitted", http.StatusBadRequest)
+		if err := validateYTDLPURL(u, allowed); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 		urls = append(urls, u)
@@ -426,6 +866,10 @@ func (s *server) handleYTDLPDownload(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "directory not found", http.StatusNotFound)
 		return
 	}
+	if capped, ok := s.downloadCapReached(r.Context(), dir); ok {
+		http.Error(w, capped.String()+" — downloads are paused", http.StatusInsufficientStorage)
+		return
+	}
 
 	if _, err := exec.LookPath("yt-dlp"); err != nil {
 		http.Error(w, "yt-dlp is not installed — downloading is unavailable", http.StatusServiceUnavailable)
@@ -433,37 +877,119 @@ func (s *server) handleYTDLPDownload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create a job for each URL; launch each in its own goroutine.
-	type jobEntry struct {
-		JobID string
-		URL   string
-	}
-	var entries []jobEntry
+	var entries []ytdlpJobEntry
+	userID := s.requestUser(r).ID
 	for _, rawURL := range urls {
-		jobID := newToken()
-
-		// 4096 lines: yt-dlp output is typically low-volume, but playlists
-		// or verbose modes can produce many lines.  The non-blocking send
-		// drops lines when the buffer fills rather than blocking the goroutine.
-		job := &ytdlpJob{ch: make(chan string, 4096)}
-		s.jobsMu.Lock()
-		s.jobs[jobID] = job
-		s.jobsMu.Unlock()
-		entries = append(entries, jobEntry{JobID: jobID, URL: rawURL})
-
-		go func() {
-			defer scheduleJobCleanup(job.ch, func() {
-				s.jobsMu.Lock()
-				delete(s.jobs, jobID)
-				s.jobsMu.Unlock()
-			})
+		jobID := s.startYTDLPJob(userID, rawURL, func(job *ytdlpJob) {
 			s.runYTDLPJob(job, dir, rawURL)
-		}()
+		})
+		entries = append(entries, ytdlpJobEntry{JobID: jobID, URL: rawURL})
 	}
 
 	// Return one progress block per queued URL.
 	render(w, "ytdlp_progress.html", entries)
 }
 
+// ytdlpJobEntry is one progress block in ytdlp_progress.html.
+type ytdlpJobEntry struct {
+	JobID string
+	URL   string
+}
+
+// startYTDLPJob registers a new download job of rawURL, runs it in the
+// background and returns its ID for the progress SSE stream. The viewer
+// userID is notified when it finishes.
+func (s *server) startYTDLPJob(userID int64, rawURL string, run func(job *ytdlpJob)) string {
+	jobID := newToken()
+
+	// 4096 lines: yt-dlp output is typically low-volume, but playlists
+	// or verbose modes can produce many lines.  The non-blocking send
+	// drops lines when the buffer fills rather than blocking the goroutine.
+	job := &ytdlpJob{ch: make(chan string, 4096)}
+	s.jobsMu.Lock()
+	s.jobs[jobID] = job
+	s.jobsMu.Unlock()
+
+	go func() {
+		defer scheduleJobCleanup(job.ch, func() {
+			s.jobsMu.Lock()
+			delete(s.jobs, jobID)
+			s.jobsMu.Unlock()
+		})
+		run(job)
+		s.notifyDownload(userID, rawURL, job)
+	}()
+	return jobID
+}
+
+// ytdlpQuality is a target resolution offered for re-downloads.
+type ytdlpQuality struct {
+	Value string // form value; a maximum height, or "best"
+	Label string
+}
+
+var ytdlpQualities = []ytdlpQuality{
+	{"best", "Best available"},
+	{"2160", "4K (2160p)"},
+	{"1080", "1080p"},
+	{"720", "720p"},
+	{"480", "480p"},
+}
+
+// ytdlpFormatArgs returns the yt-dlp format selection for a quality value:
+// the best video no taller than the target merged with the best audio,
+// falling back to the best single file within the limit.
+func ytdlpFormatArgs(quality string) []string {
+	if quality == "" || quality == "best" {
+		return nil
+	}
+	return []string{"-f", fmt.Sprintf("bv*[height<=%[1]s]+ba/b[height<=%[1]s]", quality)}
+}
+
+// handleRedownloadVideo re-fetches a downloaded video from its recorded
+// source URL at the requested quality (form value "quality", default
+// "best"), replacing the file in place — useful when the original grab
+// was low quality.
+func (s *server) handleRedownloadVideo(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	src, err := s.store.GetVideoSource(r.Context(), video.ID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && src.URL == "") {
+		http.Error(w, "no download source recorded for this video", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	dir, err := s.store.GetDirectory(r.Context(), video.DirectoryID)
+	if err != nil {
+		http.Error(w, "directory not found", http.StatusNotFound)
+		return
+	}
+	quality := cmp.Or(r.FormValue("quality"), "best")
+	if !slices.ContainsFunc(ytdlpQualities, func(q ytdlpQuality) bool { return q.Value == quality }) {
+		http.Error(w, "unknown quality", http.StatusBadRequest)
+		return
+	}
+	// The recorded URL came from the site's info JSON; hold it to the same
+	// rules as a submitted one.
+	if err := validateYTDLPURL(src.URL, s.ytdlpAllowedDomains(r.Context())); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := exec.LookPath("yt-dlp"); err != nil {
+		http.Error(w, "yt-dlp is not installed — downloading is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	jobID := s.startYTDLPJob(s.requestUser(r).ID, src.URL, func(job *ytdlpJob) {
+		s.runYTDLPRedownload(job, dir, video, src, quality)
+	})
+	render(w, "ytdlp_progress.html", []ytdlpJobEntry{{JobID: jobID, URL: src.URL}})
+}
+
 // scanYTDLPOutput reads yt-dlp output line by line, forwarding each line to
 // send. It returns the destination file path captured from the output.
 // Prefers the [Merger] line (for merged multi-stream downloads) over the
@@ -494,67 +1020,198 @@ func scanYTDLPOutput(r io.Reader, send func(string)) string {
 // runYTDLPJob executes the yt-dlp download for a single URL, streams output
 // to job.ch, and on success writes metadata and syncs the library directory.
 func (s *server) runYTDLPJob(job *ytdlpJob, dir store.Directory, rawURL string) {
-	send := func(line string) {
-		select {
-		case job.ch <- line:
-		default:
+	send := job.send
+	send("[queue] Waiting for download slot…")
+	s.convertSem <- struct{}{}
+	defer func() { <-s.convertSem }()
+
+	// Download into a staging folder so a failure leaves no fragments in
+	// the library; only the finished file is moved across.
+	staging, err := newStagingDir(dir.Path)
+	if err != nil {
+		job.err = err
+		return
+	}
+	defer os.RemoveAll(staging) //nolint:errcheck
+
+	videoPath := s.execYTDLP(job, staging, rawURL)
+	if job.err != nil {
+		return
+	}
+	var source store.VideoSource
+	if videoPath != "" {
+		source = applyYTDLPInfo(videoPath, send)
+		dest, existed, err := promoteDownload(videoPath, dir.Path)
+		if err != nil {
+			job.err = err
+			return
 		}
+		if existed {
+			send("[video_manger] " + filepath.Base(dest) + " is already in the library; keeping the existing file")
+		}
+		videoPath = dest
+	}
+	if source.URL == "" {
+		source.URL = rawURL
 	}
+	send("[video_manger] Syncing library…")
+	s.syncDir(dir)
+	if videoPath != "" {
+		if v, verr := s.store.UpsertVideo(context.Background(), dir.ID, dir.Path, filepath.Base(videoPath)); verr == nil {
+			job.videoID = v.ID
+		}
+	}
+	if job.videoID > 0 {
+		s.saveYTDLPSource(job.videoID, source, send)
+	}
+	send("[video_manger] Done!")
+}
 
+// runYTDLPRedownload fetches a video again from its recorded source and
+// swaps the new file in for the old one, keeping the library row — and with
+// it tags, ratings and watch history. The download lands in a staging
+// folder first so a failed or partial fetch never touches the existing file.
+func (s *server) runYTDLPRedownload(job *ytdlpJob, dir store.Directory, video store.Video, src store.VideoSource, quality string) {
+	send := job.send
 	send("[queue] Waiting for download slot…")
 	s.convertSem <- struct{}{}
 	defer func() { <-s.convertSem }()
 
-	pr, pw := io.Pipe()
-	cmd := exec.Command("yt-dlp", //nolint:gosec
+	staging, err := newStagingDir(dir.Path)
+	if err != nil {
+		job.err = err
+		return
+	}
+	defer os.RemoveAll(staging) //nolint:errcheck
+
+	newPath := s.execYTDLP(job, staging, src.URL, ytdlpFormatArgs(quality)...)
+	if job.err != nil {
+		return
+	}
+	if newPath == "" {
+		job.err = errors.New("yt-dlp did not report an output file")
+		return
+	}
+	if fresh := applyYTDLPInfo(newPath, send); fresh.ID != "" {
+		fresh.URL = cmp.Or(fresh.URL, src.URL)
+		src = fresh
+	}
+
+	// Keep the existing name; only the extension may change.
+	newName := strings.TrimSuffix(video.Filename, filepath.Ext(video.Filename)) + filepath.Ext(newPath)
+	dest := filepath.Join(video.DirectoryPath, newName)
+	if dest != video.FilePath() {
+		if _, err := s.blobs.Stat(dest); err == nil {
+			job.err = fmt.Errorf("%s already exists", newName)
+			return
+		}
+	}
+	send("[video_manger] Replacing " + video.Filename + "…")
+	// Move the new file in before touching the old one: under the same name
+	// the rename replaces it atomically, and if the rename fails the old
+	// file is still there.
+	if err := s.blobs.Rename(newPath, dest); err != nil {
+		job.err = err
+		return
+	}
+	ctx := context.Background()
+	if newName != video.Filename {
+		if err := s.store.UpdateVideoPath(ctx, video.ID, video.DirectoryID, video.DirectoryPath, newName); err != nil {
+			job.err = err
+			return
+		}
+		if err := s.blobs.Remove(video.FilePath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			send("[video_manger] Warning: could not remove " + video.Filename + ": " + err.Error())
+		}
+	}
+	send("[video_manger] Syncing library…")
+	s.syncDir(dir)
+	job.videoID = video.ID
+	s.saveYTDLPSource(video.ID, src, send)
+	send("[video_manger] Done!")
+}
+
+// execYTDLP runs yt-dlp for rawURL with any extra options, downloading into
+// the staging folder and streaming its output to the job. It sets job.err on
+// failure and returns the path of the downloaded file, or "" if yt-dlp did
+// not report one.
+func (s *server) execYTDLP(job *ytdlpJob, staging, rawURL string, extra ...string) string {
+	args := []string{
 		"--no-playlist",
 		"--newline",
 		"--write-info-json",
 		"--no-write-thumbnail",
-		"-o", filepath.Join(dir.Path, "%(title)s.%(ext)s"),
-		rawURL,
-	)
+		"-o", ytdlpOutputTemplate(staging),
+	}
+	args = append(args, extra...)
+	// "--" so the URL can never be read as an option.
+	args = append(args, "--", rawURL)
+	pr, pw := io.Pipe()
+	cmd := exec.Command("yt-dlp", args...) //nolint:gosec
 	cmd.Stdout = pw
 	cmd.Stderr = pw
 
 	if err := cmd.Start(); err != nil {
 		job.err = err
-		return
+		return ""
 	}
 
 	var videoPath string
 	scanDone := make(chan struct{})
 	go func() {
 		defer close(scanDone)
-		videoPath = scanYTDLPOutput(pr, send)
+		videoPath = scanYTDLPOutput(pr, job.send)
 	}()
 	job.err = cmd.Wait()
 	pw.Close()
 	<-scanDone
+	if videoPath == "" || job.err != nil {
+		return videoPath
+	}
+	p, ok := stagedOutput(staging, videoPath)
+	if !ok {
+		job.err = fmt.Errorf("yt-dlp reported a file outside the download folder: %s", videoPath)
+		return ""
+	}
+	return p
+}
 
-	if job.err != nil {
-		return
+// applyYTDLPInfo consumes the .info.json yt-dlp wrote next to videoPath:
+// its fields are written into the file's metadata and the sidecar removed.
+// Returns the download's origin, empty when there was no info file.
+func applyYTDLPInfo(videoPath string, send func(string)) store.VideoSource {
+	infoJSON := videoPath + ".info.json"
+	data, err := os.ReadFile(infoJSON)
+	if err != nil {
+		return store.VideoSource{}
 	}
-	if videoPath != "" {
-		infoJSON := videoPath + ".info.json"
-		if data, err := os.ReadFile(infoJSON); err == nil {
-			if u, ok := parseYTDLPInfoJSON(data); ok {
-				send("[video_manger] Writing metadata to file…")
-				if err := metadata.Write(videoPath, u); err != nil {
-					send("[video_manger] Warning: metadata write failed: " + err.Error())
-				}
-			}
-			os.Remove(infoJSON) //nolint:errcheck
+	defer os.Remove(infoJSON) //nolint:errcheck
+	if u, ok := parseYTDLPInfoJSON(data); ok {
+		send("[video_manger] Writing metadata to file…")
+		if err := metadata.Write(videoPath, u); err != nil {
+			send("[video_manger] Warning: metadata write failed: " + err.Error())
 		}
 	}
-	send("[video_manger] Syncing library…")
-	s.syncDir(dir)
-	if videoPath != "" {
-		if v, verr := s.store.UpsertVideo(context.Background(), dir.ID, dir.Path, filepath.Base(videoPath)); verr == nil {
-			job.videoID = v.ID
-		}
+	return parseYTDLPSource(data)
+}
+
+// saveYTDLPSource records where videoID was downloaded from and, for
+// YouTube videos, refreshes its SponsorBlock skip segments.
+func (s *server) saveYTDLPSource(videoID int64, source store.VideoSource, send func(string)) {
+	ctx := context.Background()
+	if err := s.store.SetVideoSource(ctx, videoID, source); err != nil {
+		slog.Warn("save video source failed", "videoID", videoID, "err", err)
+		return
+	}
+	if source.Extractor != "youtube" {
+		return
+	}
+	send("[video_manger] Fetching SponsorBlock segments…")
+	if n, err := s.refreshSponsorBlock(ctx, videoID); err != nil {
+		send("[video_manger] Warning: SponsorBlock lookup failed: " + err.Error())
+	} else if n > 0 {
+		send(fmt.Sprintf("[video_manger] Saved %d skippable segments", n))
 	}
-	send("[video_manger] Done!")
 }
 
 // handleYTDLPJobEvents streams yt-dlp output for a background download job
@@ -603,10 +1260,48 @@ loop:
 	}
 }
 
+// parseYTDLPSource extracts where a download came from — extractor, the
+// site's video ID, page URL, uploader and upload date — from a yt-dlp
+// .info.json file. All fields are empty if the file cannot be parsed.
+func parseYTDLPSource(data []byte) store.VideoSource {
+	var info struct {
+		ID         string `json:"id"`
+		Extractor  string `json:"extractor"`
+		WebpageURL string `json:"webpage_url"`
+		Uploader   string `json:"uploader"`
+		Channel    string `json:"channel"`
+		UploadDate string `json:"upload_date"`
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return store.VideoSource{}
+	}
+	uploader := info.Uploader
+	if uploader == "" {
+		uploader = info.Channel
+	}
+	return store.VideoSource{
+		Extractor:  strings.ToLower(info.Extractor),
+		ID:         info.ID,
+		URL:        info.WebpageURL,
+		Uploader:   uploader,
+		UploadDate: formatYTDLPDate(info.UploadDate),
+	}
+}
+
+// formatYTDLPDate turns yt-dlp's YYYYMMDD dates into YYYY-MM-DD.
+func formatYTDLPDate(d string) string {
+	if len(d) == 8 {
+		return d[:4] + "-" + d[4:6] + "-" + d[6:]
+	}
+	return d
+}
+
 // parseYTDLPInfoJSON converts a yt-dlp .info.json file into a metadata.Updates
 // that can be written directly to the video file via ffmpeg stream-copy.
 func parseYTDLPInfoJSON(data []byte) (metadata.Updates, bool) {
 	var info struct {
+		ID          string   `json:"id"`
+		WebpageURL  string   `json:"webpage_url"`
 		Title       string   `json:"title"`
 		Description string   `json:"description"`
 		Uploader    string   `json:"uploader"`
@@ -625,15 +1320,9 @@ func parseYTDLPInfoJSON(data []byte) (metadata.Updates, bool) {
 		return metadata.Updates{}, false
 	}
 
-	formatDate := func(d string) string {
-		if len(d) == 8 {
-			return d[:4] + "-" + d[4:6] + "-" + d[6:]
-		}
-		return d
-	}
-	date := formatDate(info.ReleaseDate)
+	date := formatYTDLPDate(info.ReleaseDate)
 	if date == "" {
-		date = formatDate(info.UploadDate)
+		date = formatYTDLPDate(info.UploadDate)
 	}
 
 	network := info.Channel
@@ -670,5 +1359,14 @@ func parseYTDLPInfoJSON(data []byte) (metadata.Updates, bool) {
 	if info.EpisodeID != "" {
 		u.EpisodeID = strPtr(info.EpisodeID)
 	}
+	if info.Uploader != "" {
+		u.Artist = strPtr(info.Uploader)
+	}
+	if info.WebpageURL != "" {
+		u.SourceURL = strPtr(info.WebpageURL)
+	}
+	if info.ID != "" {
+		u.SourceID = strPtr(info.ID)
+	}
 	return u, true
 }
@@ -3,14 +3,22 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/blob"
+	"github.com/maxgarvey/video_manger/store"
 )
 
 func TestHandleDirectories(t *testing.T) {
@@ -41,6 +49,26 @@ func TestHandleDirectories(t *testing.T) {
 	}
 }
 
+// TestHandleDirectories_Duplicate verifies that re-adding a directory is a
+// 409 whose body doesn't leak the SQLite constraint text.
+func TestHandleDirectories_Duplicate(t *testing.T) {
+	srv := newTestServer(t)
+	form := url.Values{"path": {"/my/videos"}}
+	var rec *httptest.ResponseRecorder
+	for range 2 {
+		rec = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/directories", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		srv.routes().ServeHTTP(rec, req)
+	}
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "UNIQUE") {
+		t.Errorf("response leaks the SQL error: %q", rec.Body.String())
+	}
+}
+
 func TestHandleCreateDirectory_Success(t *testing.T) {
 	// Create the new dir inside home so it passes the home-dir restriction.
 	home, _ := os.UserHomeDir()
@@ -250,6 +278,44 @@ func TestHandleDirectoryDeleteConfirm(t *testing.T) {
 	}
 }
 
+func TestHandleDeleteDirectoryAndFiles_LargeNeedsTypedName(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "big.mkv"), []byte("fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "big.mkv")
+	srv.store.UpsertVideo(ctx, d.ID, d.Path, "unscanned.mkv") //nolint:errcheck
+	scan := store.VideoScan{VideoID: v.ID, FileSize: deleteTypedBytes + 1, FileModTime: time.Now()}
+	srv.store.SaveVideoScans(ctx, []store.VideoScan{scan}) //nolint:errcheck
+
+	body := doAs(srv, nil, http.MethodGet, "/directories/"+itoa(d.ID)+"/delete-confirm", nil).Body.String()
+	for _, want := range []string{"2 files", formatBytes(deleteTypedBytes + 1), "1 not yet sized", `name="confirm"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("confirmation lacks %q: %s", want, body)
+		}
+	}
+
+	name := filepath.Base(dir)
+	for _, c := range []struct {
+		target string
+		code   int
+	}{
+		{"/directories/" + itoa(d.ID) + "/files", http.StatusBadRequest},
+		{"/directories/" + itoa(d.ID) + "/files?confirm=wrong", http.StatusBadRequest},
+		{"/directories/" + itoa(d.ID) + "/files?confirm=" + url.QueryEscape(name), http.StatusOK},
+	} {
+		if rec := doAs(srv, nil, http.MethodDelete, c.target, nil); rec.Code != c.code {
+			t.Fatalf("DELETE %s: status %d, want %d", c.target, rec.Code, c.code)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "big.mkv")); (err == nil) != (c.code != http.StatusOK) {
+			t.Fatalf("DELETE %s: file exists = %v", c.target, err == nil)
+		}
+	}
+}
+
 func TestHandleDirectoryDeleteConfirm_NotFound(t *testing.T) {
 	srv := newTestServer(t)
 	rec := httptest.NewRecorder()
@@ -554,6 +620,9 @@ func TestHandleCreateSubfolder(t *testing.T) {
 	for _, dir := range dirs {
 		if dir.Path == want {
 			found = true
+			if dir.ParentID != d.ID {
+				t.Errorf("subfolder ParentID = %d, want %d", dir.ParentID, d.ID)
+			}
 		}
 	}
 	if !found {
@@ -644,6 +713,201 @@ func TestHandleSyncDirectory_NotFound(t *testing.T) {
 	}
 }
 
+func TestHandleSetDirectoryScanOptions(t *testing.T) {
+	tmp := t.TempDir()
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, tmp)
+
+	form := url.Values{"patterns": {"*.sample.*\n\n  extras/**  \n"}, "max_depth": {"2"}, "follow_symlinks": {"1"}, "prune_empty": {"1"}, "sync_every": {"604800"}}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/directories/"+itoa(d.ID)+"/scan-options", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	got, _ := srv.store.GetDirectory(ctx, d.ID)
+	if len(got.Excludes) != 2 || got.Excludes[0] != "*.sample.*" || got.Excludes[1] != "extras/**" {
+		t.Errorf("unexpected excludes: %q", got.Excludes)
+	}
+	if got.MaxDepth != 2 {
+		t.Errorf("MaxDepth = %d, want 2", got.MaxDepth)
+	}
+	if !got.FollowSymlinks {
+		t.Error("FollowSymlinks not saved")
+	}
+	if !got.PruneEmpty {
+		t.Error("PruneEmpty not saved")
+	}
+	if got.SyncEvery != 7*24*time.Hour {
+		t.Errorf("SyncEvery = %v, want a week", got.SyncEvery)
+	}
+}
+
+func TestHandleSetDirectoryScanOptions_InvalidSchedule(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+
+	for _, every := range []string{"42", "soon", "-300"} {
+		rec := doAs(srv, nil, http.MethodPost, "/directories/"+itoa(d.ID)+"/scan-options", url.Values{"sync_every": {every}})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("sync_every %q: expected 400, got %d", every, rec.Code)
+		}
+	}
+}
+
+func TestHandleSetDirectoryScanOptions_InvalidDepth(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+
+	form := url.Values{"max_depth": {"-1"}}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/directories/"+itoa(d.ID)+"/scan-options", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for negative depth, got %d", rec.Code)
+	}
+}
+
+func TestHandleSetDirectoryScanOptions_InvalidPattern(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+
+	form := url.Values{"patterns": {"[unclosed"}}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/directories/"+itoa(d.ID)+"/scan-options", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for malformed glob, got %d", rec.Code)
+	}
+}
+
+func TestHandleSetDirectoryLabel(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "ep.mp4"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, root)
+	srv.syncDir(d)
+
+	form := url.Values{"label": {"  Cartoons "}}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/directories/"+itoa(d.ID)+"/label", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), ">Cartoons</span>") {
+		t.Error("expected the label to replace the path in the directory list")
+	}
+	got, _ := srv.store.GetDirectory(ctx, d.ID)
+	if got.Label != "Cartoons" || got.Title() != "Cartoons" {
+		t.Errorf("label not saved: %+v", got)
+	}
+	// The folder-name auto-tag is gone; the background rescan adds "Cartoons".
+	videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID)
+	tags, _ := srv.store.ListTagsByVideo(ctx, videos[0].ID)
+	for _, tag := range tags {
+		if tag.Name == filepath.Base(root) {
+			t.Errorf("old auto-tag %q should be removed", tag.Name)
+		}
+	}
+}
+
+func TestHandleSetDirectoryLabel_RejectsNamespace(t *testing.T) {
+	srv := newTestServer(t)
+	d, _ := srv.store.AddDirectory(context.Background(), t.TempDir())
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/directories/"+itoa(d.ID)+"/label", strings.NewReader("label=show%3AFoo"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestHandlePreviewDirectory(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	root := t.TempDir()
+	files := map[string]string{
+		"a.mp4":                   "12345",
+		"notes.txt":               "ignored",
+		"Season 1/e01.mkv":        "123",
+		"Season 1/e01.sample.mkv": "1",
+		"extras/bonus.mp4":        "1",
+		"registered/x.mp4":        "1",
+	}
+	for name, body := range files {
+		p := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(p), 0755) //nolint:errcheck
+		if err := os.WriteFile(p, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.store.AddDirectory(ctx, filepath.Join(root, "registered")) //nolint:errcheck
+
+	q := url.Values{"path": {root}, "patterns": {"*.sample.*\nextras"}}
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/directories/preview?"+q.Encode(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var got scanPreview
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Count != 2 || got.TotalBytes != 8 || len(got.Files) != 2 {
+		t.Fatalf("unexpected preview: %+v", got)
+	}
+	if got.Files[0].Path != "Season 1/e01.mkv" || got.Files[1].Path != "a.mp4" {
+		t.Errorf("unexpected files: %+v", got.Files)
+	}
+
+	// Nothing was written.
+	if n, _ := srv.store.CountVideos(ctx); n != 0 {
+		t.Errorf("preview imported %d videos", n)
+	}
+	if dirs, _ := srv.store.ListDirectories(ctx); len(dirs) != 1 {
+		t.Errorf("preview registered directories: %+v", dirs)
+	}
+}
+
+func TestHandlePreviewDirectory_MaxDepth(t *testing.T) {
+	srv := newTestServer(t)
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "a", "b"), 0755)                  //nolint:errcheck
+	os.WriteFile(filepath.Join(root, "a", "one.mp4"), nil, 0644)      //nolint:errcheck
+	os.WriteFile(filepath.Join(root, "a", "b", "two.mp4"), nil, 0644) //nolint:errcheck
+
+	q := url.Values{"path": {root}, "max_depth": {"1"}}
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/directories/preview?"+q.Encode(), nil))
+	var got scanPreview
+	json.NewDecoder(rec.Body).Decode(&got) //nolint:errcheck
+	if got.Count != 1 {
+		t.Errorf("expected 1 file within depth 1, got %+v", got)
+	}
+}
+
+func TestHandlePreviewDirectory_BadPath(t *testing.T) {
+	srv := newTestServer(t)
+	for _, path := range []string{"", filepath.Join(t.TempDir(), "missing")} {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/directories/preview?path="+url.QueryEscape(path), nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("path %q: expected 400, got %d", path, rec.Code)
+		}
+	}
+}
+
 func TestHandleDirectoryOptions(t *testing.T) {
 	srv := newTestServer(t)
 	ctx := context.Background()
@@ -830,6 +1094,55 @@ func TestHandleAddDirectory_Success(t *testing.T) {
 	}
 }
 
+func TestHandleAddDirectory_SplitSubdirs(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	root := t.TempDir()
+	for _, name := range []string{"Season 1", "Season 2", ".hidden"} {
+		if err := os.Mkdir(filepath.Join(root, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An already-registered subfolder is left as-is rather than duplicated,
+	// and so are symlinks to subfolders, which resolve to the same paths.
+	existing, _ := srv.store.AddDirectory(ctx, filepath.Join(root, "Season 2"))
+	if err := os.Symlink(filepath.Join(root, "Season 2"), filepath.Join(root, "Latest")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	os.Symlink(filepath.Join(root, "Season 1"), filepath.Join(root, "First")) //nolint:errcheck
+
+	form := url.Values{"path": {root}, "split_subdirs": {"1"}}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/directories", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	dirs, _ := srv.store.ListDirectories(ctx)
+	byPath := make(map[string]int64)
+	var parentID int64
+	for _, d := range dirs {
+		byPath[d.Path] = d.ParentID
+		if d.Path == root {
+			parentID = d.ID
+		}
+	}
+	if len(dirs) != 3 {
+		t.Fatalf("expected root + 2 seasons registered, got %+v", dirs)
+	}
+	if parentID == 0 || byPath[root] != 0 {
+		t.Errorf("root should be a top-level entry: %+v", dirs)
+	}
+	if got := byPath[filepath.Join(root, "Season 1")]; got != parentID {
+		t.Errorf("Season 1 ParentID = %d, want %d", got, parentID)
+	}
+	if got := byPath[existing.Path]; got != 0 {
+		t.Errorf("pre-registered Season 2 ParentID = %d, want 0", got)
+	}
+}
+
 func TestHandleAddDirectory_EmptyPath(t *testing.T) {
 	srv := newTestServer(t)
 	form := url.Values{"path": {""}}
@@ -841,3 +1154,164 @@ func TestHandleAddDirectory_EmptyPath(t *testing.T) {
 		t.Fatalf("expected 400 for empty path, got %d", rec.Code)
 	}
 }
+
+func TestHandleAddDirectory_RelativePath(t *testing.T) {
+	srv := newTestServer(t)
+	for _, split := range []string{"", "1"} {
+		form := url.Values{"path": {"videos/tv"}, "split_subdirs": {split}}
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/directories", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		srv.routes().ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("split_subdirs=%q: expected 400 for a relative path, got %d", split, rec.Code)
+		}
+	}
+}
+
+func TestHandleRedownloadVideo_NoSource(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "local.mp4")
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/videos/"+itoa(v.ID)+"/redownload", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a video with no recorded source, got %d", rec.Code)
+	}
+}
+
+func TestHandleRedownloadVideo_UnknownQuality(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "clip.mp4")
+	srv.store.SetVideoSource(ctx, v.ID, store.VideoSource{URL: "https://example.com/c"}) //nolint:errcheck
+
+	form := url.Values{"quality": {"9999"}}
+	req := httptest.NewRequest(http.MethodPost, "/videos/"+itoa(v.ID)+"/redownload", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown quality, got %d", rec.Code)
+	}
+}
+
+func TestYTDLPFormatArgs(t *testing.T) {
+	if args := ytdlpFormatArgs("best"); args != nil {
+		t.Errorf("best should leave yt-dlp's default selection, got %v", args)
+	}
+	if args := ytdlpFormatArgs("1080"); len(args) != 2 || args[1] != "bv*[height<=1080]+ba/b[height<=1080]" {
+		t.Errorf("unexpected 1080p selection: %v", args)
+	}
+}
+
+func TestRunYTDLPRedownload_ReplacesFileInPlace(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	if err := os.WriteFile(filepath.Join(dir, "Old Name.mp4"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "Old Name.mp4")
+	tag, _ := srv.store.UpsertTag(ctx, "keep")
+	srv.store.TagVideo(ctx, v.ID, tag.ID) //nolint:errcheck
+	src := store.VideoSource{Extractor: "generic", ID: "x1", URL: "https://example.com/x1"}
+	srv.store.SetVideoSource(ctx, v.ID, src) //nolint:errcheck
+
+	// The stub writes a differently named .mkv into the -o directory, as
+	// yt-dlp does when the site title or best format has changed.
+	argsFile := stubYTDLPDownload(t, "Renamed Upstream.mkv")
+
+	job := &ytdlpJob{ch: make(chan string, 64)}
+	srv.runYTDLPRedownload(job, d, v, src, "720")
+	if job.err != nil {
+		t.Fatalf("redownload failed: %v", job.err)
+	}
+	if job.videoID != v.ID {
+		t.Errorf("videoID = %d, want %d", job.videoID, v.ID)
+	}
+	if args, _ := os.ReadFile(argsFile); !strings.Contains(string(args), "-f bv*[height<=720]+ba/b[height<=720]") {
+		t.Errorf("expected a 720p format selection, yt-dlp got: %s", args)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "Old Name.mp4")); !os.IsNotExist(err) {
+		t.Error("old file should have been replaced")
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "Old Name.mkv")); err != nil || string(data) != "new" {
+		t.Errorf("new file should keep the old name with the new extension: %q, %v", data, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.IsDir() {
+			t.Errorf("temporary directory %s left behind", e.Name())
+		}
+	}
+
+	got, err := srv.store.GetVideo(ctx, v.ID)
+	if err != nil || got.Filename != "Old Name.mkv" {
+		t.Fatalf("library row should follow the file: %+v, %v", got, err)
+	}
+	tags, _ := srv.store.ListTagsByVideo(ctx, v.ID)
+	if !slices.ContainsFunc(tags, func(t store.Tag) bool { return t.Name == "keep" }) {
+		t.Errorf("tags should survive a redownload, got %+v", tags)
+	}
+	if videos, _ := srv.store.ListVideos(ctx); len(videos) != 1 {
+		t.Errorf("expected the library to still hold one video, got %d", len(videos))
+	}
+}
+
+// stubYTDLPDownload puts a fake yt-dlp on PATH that writes "new" to name in
+// the -o directory and reports it. It returns the file its arguments are
+// recorded in.
+func stubYTDLPDownload(t *testing.T, name string) string {
+	t.Helper()
+	bin := t.TempDir()
+	argsFile := filepath.Join(bin, "args")
+	script := `#!/bin/sh
+echo "$@" > "` + argsFile + `"
+while [ $# -gt 1 ]; do [ "$1" = "-o" ] && out="$2"; shift; done
+out_dir=$(dirname "$out")
+printf new > "$out_dir/` + name + `"
+echo "[download] Destination: $out_dir/` + name + `"
+`
+	os.WriteFile(filepath.Join(bin, "yt-dlp"), []byte(script), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return argsFile
+}
+
+// renameFails is local storage whose renames fail, as across devices.
+type renameFails struct{ blob.Local }
+
+func (renameFails) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EXDEV}
+}
+
+func TestRunYTDLPRedownload_FailedRenameKeepsOriginal(t *testing.T) {
+	srv := newTestServer(t)
+	srv.blobs = renameFails{}
+	ctx := context.Background()
+	dir := t.TempDir()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	src := store.VideoSource{Extractor: "generic", ID: "x1", URL: "https://example.com/x1"}
+	stubYTDLPDownload(t, "film.mkv")
+
+	job := &ytdlpJob{ch: make(chan string, 64)}
+	srv.runYTDLPRedownload(job, d, v, src, "best")
+	if !errors.Is(job.err, syscall.EXDEV) {
+		t.Fatalf("expected the rename error, got %v", job.err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "film.mp4")); err != nil || string(data) != "old" {
+		t.Errorf("original file should survive a failed replace: %q, %v", data, err)
+	}
+	if got, _ := srv.store.GetVideo(ctx, v.ID); got.Filename != "film.mp4" {
+		t.Errorf("library row should still point at the original, got %q", got.Filename)
+	}
+}
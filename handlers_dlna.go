@@ -0,0 +1,394 @@
+// handlers_dlna.go – DLNA media server for smart TVs on the LAN.
+//
+// With the dlna_enabled setting on, main starts a plain-HTTP listener on
+// -dlna-port and announces it over SSDP, so TVs list the library among
+// their media sources. The listener serves:
+//
+// GET  /dlna/device.xml               – device description
+// GET  /dlna/{service}.xml            – ContentDirectory / ConnectionManager SCPD
+// POST /dlna/control/{service}        – SOAP actions, chiefly Browse
+// SUBSCRIBE /dlna/event/{service}     – accepted; no events are sent
+// GET  /dlna/video/{id}               – the video file, with range requests
+// GET  /dlna/thumb/{id}               – its poster frame
+//
+// TVs cannot sign in, so the listener skips the auth middleware. Instead it
+// only answers private, loopback and link-local addresses, and stops
+// answering once dlna_enabled is switched off.
+//
+// The browse tree is:
+//
+//	0             root: "Folders" and "Tags"
+//	dirs          top-level directories
+//	dir/{id}      a directory's registered subfolders, then its videos
+//	tags          every tag
+//	tag/{id}      the tag's videos
+//	video/{id}    a playable item
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/maxgarvey/video_manger/dlna"
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// errNoSuchObject is returned by dlnaObject and dlnaChildren for an object
+// ID that names nothing in the library.
+var errNoSuchObject = errors.New("no such object")
+
+// startDLNA serves the DLNA routes on port and advertises them until ctx
+// is cancelled. The device UUID is kept in the dlna_uuid setting so TVs
+// recognise the server across restarts.
+func (s *server) startDLNA(ctx context.Context, port string) (*http.Server, error) {
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+	uuid, _ := s.store.GetSetting(ctx, "dlna_uuid")
+	if uuid == "" {
+		uuid = dlna.NewUUID()
+		if err := s.store.SaveSettings(ctx, map[string]string{"dlna_uuid": uuid}); err != nil {
+			return nil, fmt.Errorf("save device UUID: %w", err)
+		}
+	}
+	name := "video_manger"
+	if host, err := os.Hostname(); err == nil {
+		name += " on " + host
+	}
+	srv := &http.Server{Addr: ":" + port, Handler: s.dlnaRoutes(name, uuid)}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("DLNA server error", "err", err)
+		}
+	}()
+	go func() {
+		ad := &dlna.Advertiser{UUID: uuid, Port: portNum}
+		if err := ad.Run(ctx); err != nil {
+			slog.Warn("SSDP discovery unavailable", "err", err)
+		}
+	}()
+	return srv, nil
+}
+
+func (s *server) dlnaRoutes(name, uuid string) http.Handler {
+	chi.RegisterMethod("SUBSCRIBE")
+	chi.RegisterMethod("UNSUBSCRIBE")
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	r.Use(s.dlnaGuard)
+	r.Use(middleware.GetHead) // TVs probe media with HEAD first
+
+	description := dlna.DeviceDescription(name, uuid)
+	r.Get(dlna.DescriptionPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+		w.Write(description) //nolint:errcheck
+	})
+	r.Get(dlna.ContentDirectorySCPDPath, serveXML(dlna.ContentDirectorySCPD))
+	r.Get(dlna.ConnectionManagerSCPDPath, serveXML(dlna.ConnectionManagerSCPD))
+	r.Post(dlna.ControlPath+"{service}", s.handleDLNAControl)
+	r.HandleFunc(dlna.EventPath+"{service}", dlna.HandleEvent)
+	r.With(s.meterStream, s.throttleStream).Get("/dlna/video/{id}", func(w http.ResponseWriter, r *http.Request) {
+		dlna.SetStreamHeaders(w, r)
+		s.handleVideoFile(w, r)
+	})
+	r.Get("/dlna/thumb/{id}", s.handleVideoThumb)
+	return r
+}
+
+func serveXML(doc string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+		fmt.Fprint(w, doc)
+	}
+}
+
+// dlnaGuard confines the unauthenticated DLNA listener to the local
+// network, and turns it away while dlna_enabled is off.
+func (s *server) dlnaGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err != nil {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		ip := addr.Addr().Unmap()
+		if !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if v, _ := s.store.GetSetting(r.Context(), "dlna_enabled"); v != "true" {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleDLNAControl answers ContentDirectory and ConnectionManager actions.
+func (s *server) handleDLNAControl(w http.ResponseWriter, r *http.Request) {
+	a, err := dlna.ReadAction(r)
+	if err != nil {
+		dlna.WriteFault(w, dlna.ErrInvalidAction, err.Error())
+		return
+	}
+	switch a.Service + "#" + a.Name {
+	case dlna.ContentDirectoryType + "#Browse":
+		s.dlnaBrowse(w, r, a)
+	case dlna.ContentDirectoryType + "#GetSystemUpdateID":
+		dlna.WriteResponse(w, a, []dlna.Arg{{Name: "Id", Value: "1"}})
+	case dlna.ContentDirectoryType + "#GetSearchCapabilities":
+		dlna.WriteResponse(w, a, []dlna.Arg{{Name: "SearchCaps", Value: ""}})
+	case dlna.ContentDirectoryType + "#GetSortCapabilities":
+		dlna.WriteResponse(w, a, []dlna.Arg{{Name: "SortCaps", Value: ""}})
+	case dlna.ConnectionManagerType + "#GetProtocolInfo":
+		dlna.WriteResponse(w, a, []dlna.Arg{{Name: "Source", Value: dlna.SourceProtocolInfo()}, {Name: "Sink", Value: ""}})
+	case dlna.ConnectionManagerType + "#GetCurrentConnectionIDs":
+		dlna.WriteResponse(w, a, []dlna.Arg{{Name: "ConnectionIDs", Value: "0"}})
+	case dlna.ConnectionManagerType + "#GetCurrentConnectionInfo":
+		dlna.WriteResponse(w, a, []dlna.Arg{
+			{Name: "RcsID", Value: "-1"}, {Name: "AVTransportID", Value: "-1"},
+			{Name: "ProtocolInfo", Value: ""}, {Name: "PeerConnectionManager", Value: ""},
+			{Name: "PeerConnectionID", Value: "-1"}, {Name: "Direction", Value: "Output"},
+			{Name: "Status", Value: "OK"},
+		})
+	default:
+		dlna.WriteFault(w, dlna.ErrInvalidAction, "unsupported action "+a.Name)
+	}
+}
+
+// dlnaBrowse answers a Browse: the object itself for BrowseMetadata, or a
+// page of its children for BrowseDirectChildren.
+func (s *server) dlnaBrowse(w http.ResponseWriter, r *http.Request, a dlna.Action) {
+	id := a.Args["ObjectID"]
+	start, err1 := strconv.Atoi(cmp.Or(a.Args["StartingIndex"], "0"))
+	count, err2 := strconv.Atoi(cmp.Or(a.Args["RequestedCount"], "0"))
+	if err1 != nil || err2 != nil || start < 0 || count < 0 {
+		dlna.WriteFault(w, dlna.ErrInvalidArgs, "invalid StartingIndex or RequestedCount")
+		return
+	}
+	base := "http://" + r.Host
+	var objs []dlna.Object
+	var err error
+	switch a.Args["BrowseFlag"] {
+	case "BrowseMetadata":
+		var o dlna.Object
+		o, err = s.dlnaObject(r.Context(), base, id)
+		objs = []dlna.Object{o}
+	case "BrowseDirectChildren":
+		objs, err = s.dlnaChildren(r.Context(), base, id)
+	default:
+		dlna.WriteFault(w, dlna.ErrInvalidArgs, "invalid BrowseFlag")
+		return
+	}
+	if errors.Is(err, errNoSuchObject) {
+		dlna.WriteFault(w, dlna.ErrNoSuchObject, "no such object")
+		return
+	}
+	if err != nil {
+		slog.Warn("DLNA browse failed", "object", id, "err", err)
+		dlna.WriteFault(w, dlna.ErrActionFailed, "browse failed")
+		return
+	}
+	total := len(objs)
+	page := objs[min(start, total):]
+	if count > 0 && count < len(page) {
+		page = page[:count]
+	}
+	dlna.WriteResponse(w, a, []dlna.Arg{
+		{Name: "Result", Value: dlna.DIDL(page)},
+		{Name: "NumberReturned", Value: strconv.Itoa(len(page))},
+		{Name: "TotalMatches", Value: strconv.Itoa(total)},
+		{Name: "UpdateID", Value: "1"},
+	})
+}
+
+// dlnaObject describes the object with the given ID.
+func (s *server) dlnaObject(ctx context.Context, base, id string) (dlna.Object, error) {
+	switch id {
+	case "0":
+		return dlna.Object{ID: "0", ParentID: "-1", Title: "video_manger", Container: true, ChildCount: 2}, nil
+	case "dirs":
+		return dlna.Object{ID: "dirs", ParentID: "0", Title: "Folders", Container: true}, nil
+	case "tags":
+		return dlna.Object{ID: "tags", ParentID: "0", Title: "Tags", Container: true}, nil
+	}
+	kind, n, ok := strings.Cut(id, "/")
+	num, err := strconv.ParseInt(n, 10, 64)
+	if !ok || err != nil {
+		return dlna.Object{}, errNoSuchObject
+	}
+	switch kind {
+	case "dir":
+		d, err := s.store.GetDirectory(ctx, num)
+		if err != nil || d.Offline {
+			return dlna.Object{}, errNoSuchObject
+		}
+		return dlnaDirectory(d), nil
+	case "tag":
+		tags, err := s.store.ListTags(ctx)
+		if err != nil {
+			return dlna.Object{}, err
+		}
+		i := slices.IndexFunc(tags, func(t store.Tag) bool { return t.ID == num })
+		if i < 0 {
+			return dlna.Object{}, errNoSuchObject
+		}
+		return dlnaTag(tags[i]), nil
+	case "video":
+		v, err := s.store.GetVideo(ctx, num)
+		if err != nil {
+			return dlna.Object{}, errNoSuchObject
+		}
+		return dlnaVideo(base, "dir/"+strconv.FormatInt(v.DirectoryID, 10), v), nil
+	}
+	return dlna.Object{}, errNoSuchObject
+}
+
+// dlnaChildren lists the children of the container with the given ID.
+// Offline directories are left out, since their files cannot be streamed.
+func (s *server) dlnaChildren(ctx context.Context, base, id string) ([]dlna.Object, error) {
+	switch id {
+	case "0":
+		return []dlna.Object{
+			{ID: "dirs", ParentID: "0", Title: "Folders", Container: true},
+			{ID: "tags", ParentID: "0", Title: "Tags", Container: true},
+		}, nil
+	case "dirs":
+		return s.dlnaSubdirectories(ctx, 0)
+	case "tags":
+		tags, err := s.store.ListTags(ctx)
+		if err != nil {
+			return nil, err
+		}
+		objs := make([]dlna.Object, len(tags))
+		for i, t := range tags {
+			objs[i] = dlnaTag(t)
+		}
+		return objs, nil
+	}
+	kind, n, ok := strings.Cut(id, "/")
+	num, err := strconv.ParseInt(n, 10, 64)
+	if !ok || err != nil {
+		return nil, errNoSuchObject
+	}
+	switch kind {
+	case "dir":
+		d, err := s.store.GetDirectory(ctx, num)
+		if err != nil || d.Offline {
+			return nil, errNoSuchObject
+		}
+		objs, err := s.dlnaSubdirectories(ctx, d.ID)
+		if err != nil {
+			return nil, err
+		}
+		videos, err := s.store.ListVideosByDirectory(ctx, d.ID)
+		if err != nil {
+			return nil, err
+		}
+		return append(objs, dlnaVideos(base, id, videos)...), nil
+	case "tag":
+		videos, err := s.store.ListVideosByTag(ctx, num)
+		if err != nil {
+			return nil, err
+		}
+		offline, err := s.offlineDirectories(ctx)
+		if err != nil {
+			return nil, err
+		}
+		videos = slices.DeleteFunc(videos, func(v store.Video) bool { return offline[v.DirectoryID] })
+		return dlnaVideos(base, id, videos), nil
+	case "video":
+		return nil, nil
+	}
+	return nil, errNoSuchObject
+}
+
+// dlnaSubdirectories lists the online directories registered under
+// parentID, or the top-level ones for 0, by title.
+func (s *server) dlnaSubdirectories(ctx context.Context, parentID int64) ([]dlna.Object, error) {
+	dirs, err := s.store.ListDirectories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dirs = slices.DeleteFunc(dirs, func(d store.Directory) bool { return d.ParentID != parentID || d.Offline })
+	slices.SortFunc(dirs, func(a, b store.Directory) int {
+		return cmp.Compare(strings.ToLower(a.Title()), strings.ToLower(b.Title()))
+	})
+	objs := make([]dlna.Object, len(dirs))
+	for i, d := range dirs {
+		objs[i] = dlnaDirectory(d)
+	}
+	return objs, nil
+}
+
+// offlineDirectories returns the IDs of directories currently offline.
+func (s *server) offlineDirectories(ctx context.Context) (map[int64]bool, error) {
+	dirs, err := s.store.ListDirectories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	offline := map[int64]bool{}
+	for _, d := range dirs {
+		if d.Offline {
+			offline[d.ID] = true
+		}
+	}
+	return offline, nil
+}
+
+func dlnaDirectory(d store.Directory) dlna.Object {
+	parent := "dirs"
+	if d.ParentID != 0 {
+		parent = "dir/" + strconv.FormatInt(d.ParentID, 10)
+	}
+	return dlna.Object{ID: "dir/" + strconv.FormatInt(d.ID, 10), ParentID: parent, Title: d.Title(), Container: true}
+}
+
+func dlnaTag(t store.Tag) dlna.Object {
+	return dlna.Object{ID: "tag/" + strconv.FormatInt(t.ID, 10), ParentID: "tags", Title: t.Name, Container: true}
+}
+
+// dlnaVideos lists videos under parent, by title.
+func dlnaVideos(base, parent string, videos []store.Video) []dlna.Object {
+	slices.SortFunc(videos, func(a, b store.Video) int {
+		return cmp.Compare(strings.ToLower(a.Title()), strings.ToLower(b.Title()))
+	})
+	objs := make([]dlna.Object, len(videos))
+	for i, v := range videos {
+		objs[i] = dlnaVideo(base, parent, v)
+	}
+	return objs
+}
+
+// dlnaVideo describes v as a playable item whose URLs are on base, the
+// address the TV reached the server on.
+func dlnaVideo(base, parent string, v store.Video) dlna.Object {
+	id := strconv.FormatInt(v.ID, 10)
+	return dlna.Object{
+		ID:          "video/" + id,
+		ParentID:    parent,
+		Title:       v.Title(),
+		AlbumArtURI: base + "/dlna/thumb/" + id,
+		Res: dlna.Resource{
+			URL:          base + "/dlna/video/" + id,
+			ProtocolInfo: dlna.ProtocolInfo(dlna.MIMEType(v.Filename)),
+			Size:         v.FileSize,
+			DurationS:    v.DurationS,
+			Width:        v.Width,
+			Height:       v.Height,
+		},
+	}
+}
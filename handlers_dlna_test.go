@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/dlna"
+)
+
+// dlnaRequest sends a request to the DLNA listener from a LAN address.
+func dlnaRequest(srv *server, req *http.Request) *httptest.ResponseRecorder {
+	req.RemoteAddr = "192.168.1.50:50000"
+	rec := httptest.NewRecorder()
+	srv.dlnaRoutes("test", "uuid-1").ServeHTTP(rec, req)
+	return rec
+}
+
+// dlnaBrowseRequest builds a ContentDirectory Browse of id.
+func dlnaBrowseRequest(id, flag string) *http.Request {
+	body := `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>` +
+		`<u:Browse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">` +
+		`<ObjectID>` + id + `</ObjectID><BrowseFlag>` + flag + `</BrowseFlag>` +
+		`<Filter>*</Filter><StartingIndex>0</StartingIndex><RequestedCount>0</RequestedCount><SortCriteria></SortCriteria>` +
+		`</u:Browse></s:Body></s:Envelope>`
+	req := httptest.NewRequest(http.MethodPost, "/dlna/control/ContentDirectory", strings.NewReader(body))
+	req.Header.Set("SOAPACTION", `"`+dlna.ContentDirectoryType+`#Browse"`)
+	return req
+}
+
+func enableDLNA(t *testing.T, srv *server) {
+	t.Helper()
+	if err := srv.store.SaveSettings(context.Background(), map[string]string{"dlna_enabled": "true"}); err != nil {
+		t.Fatalf("enable dlna: %v", err)
+	}
+}
+
+func TestDLNA_DisabledByDefault(t *testing.T) {
+	srv := newTestServer(t)
+	rec := dlnaRequest(srv, httptest.NewRequest(http.MethodGet, dlna.DescriptionPath, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 while dlna_enabled is off, got %d", rec.Code)
+	}
+}
+
+func TestDLNA_RejectsNonLANClients(t *testing.T) {
+	srv := newTestServer(t)
+	enableDLNA(t, srv)
+	req := httptest.NewRequest(http.MethodGet, dlna.DescriptionPath, nil)
+	req.RemoteAddr = "203.0.113.9:4000"
+	rec := httptest.NewRecorder()
+	srv.dlnaRoutes("test", "uuid-1").ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a public address, got %d", rec.Code)
+	}
+}
+
+func TestDLNA_DeviceDescription(t *testing.T) {
+	srv := newTestServer(t)
+	enableDLNA(t, srv)
+	rec := dlnaRequest(srv, httptest.NewRequest(http.MethodGet, dlna.DescriptionPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	for _, want := range []string{"<UDN>uuid:uuid-1</UDN>", dlna.DeviceType, "/dlna/control/ContentDirectory"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("description missing %q", want)
+		}
+	}
+}
+
+func TestDLNA_BrowseDirectoriesAndTags(t *testing.T) {
+	srv := newTestServer(t)
+	enableDLNA(t, srv)
+	ctx := context.Background()
+	dir := t.TempDir()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film & friends.mkv")
+	tag, _ := srv.store.UpsertTag(ctx, "favourites")
+	srv.store.TagVideo(ctx, v.ID, tag.ID) //nolint:errcheck
+
+	rec := dlnaRequest(srv, dlnaBrowseRequest("0", "BrowseDirectChildren"))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<TotalMatches>2</TotalMatches>") {
+		t.Fatalf("root: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = dlnaRequest(srv, dlnaBrowseRequest("dirs", "BrowseDirectChildren"))
+	if !strings.Contains(rec.Body.String(), "id=&#34;dir/"+itoa(d.ID)+"&#34;") {
+		t.Fatalf("dirs should list the directory, got %s", rec.Body.String())
+	}
+
+	// The Result is DIDL-Lite escaped inside the SOAP envelope.
+	rec = dlnaRequest(srv, dlnaBrowseRequest("dir/"+itoa(d.ID), "BrowseDirectChildren"))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"film &amp;amp; friends.mkv",
+		"http://example.com/dlna/video/" + itoa(v.ID),
+		"video/x-matroska",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("directory listing missing %q in %s", want, body)
+		}
+	}
+
+	rec = dlnaRequest(srv, dlnaBrowseRequest("tag/"+itoa(tag.ID), "BrowseDirectChildren"))
+	if !strings.Contains(rec.Body.String(), "video/"+itoa(v.ID)) {
+		t.Errorf("tag listing should include the video, got %s", rec.Body.String())
+	}
+
+	rec = dlnaRequest(srv, dlnaBrowseRequest("video/"+itoa(v.ID), "BrowseMetadata"))
+	if !strings.Contains(rec.Body.String(), "parentID=&#34;dir/"+itoa(d.ID)+"&#34;") {
+		t.Errorf("metadata should name the directory as parent, got %s", rec.Body.String())
+	}
+}
+
+func TestDLNA_BrowseUnknownObject(t *testing.T) {
+	srv := newTestServer(t)
+	enableDLNA(t, srv)
+	rec := dlnaRequest(srv, dlnaBrowseRequest("dir/999", "BrowseDirectChildren"))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "<errorCode>701</errorCode>") {
+		t.Fatalf("expected UPnP error 701, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDLNA_StreamsVideoWithDLNAHeaders(t *testing.T) {
+	srv := newTestServer(t)
+	enableDLNA(t, srv)
+	ctx := context.Background()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "clip.mp4"), []byte("0123456789"), 0644) //nolint:errcheck
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "clip.mp4")
+
+	req := httptest.NewRequest(http.MethodGet, "/dlna/video/"+itoa(v.ID), nil)
+	req.Header.Set("Range", "bytes=2-4")
+	req.Header.Set("getcontentFeatures.dlna.org", "1")
+	rec := dlnaRequest(srv, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "234" {
+		t.Fatalf("expected bytes 2-4, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("contentFeatures.dlna.org") != dlna.ContentFeatures {
+		t.Errorf("missing contentFeatures.dlna.org header")
+	}
+}
@@ -0,0 +1,61 @@
+// handlers_external_ids.go – a video's identifiers at outside services.
+//
+// PUT /videos/{id}/external-ids                – set or clear IDs, one form field per provider
+// GET /api/external-ids/{provider}/{externalID} – the video with that ID, as GET /api/videos/{id}
+//
+// TMDB lookups and YouTube downloads record IDs themselves; the PUT lets an
+// admin or a script fill in the rest, e.g. TVMaze episode IDs for scrobbling.
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func (s *server) handleSetExternalIDs(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+	for provider := range r.Form {
+		if provider != csrfField && !slices.Contains(store.ExternalProviders, provider) {
+			http.Error(w, "unknown provider: "+provider, http.StatusBadRequest)
+			return
+		}
+	}
+	for _, provider := range store.ExternalProviders {
+		if !r.Form.Has(provider) {
+			continue
+		}
+		id := strings.TrimSpace(r.Form.Get(provider))
+		if err := s.store.SetVideoExternalID(r.Context(), video.ID, provider, id); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+	ids, err := s.store.ListVideoExternalIDs(r.Context(), video.ID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	writeJSON(w, ids)
+}
+
+func (s *server) handleAPIFindByExternalID(w http.ResponseWriter, r *http.Request) {
+	id, err := s.store.FindVideoByExternalID(r.Context(),
+		chi.URLParam(r, "provider"), chi.URLParam(r, "externalID"))
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	s.writeAPIVideo(w, r, id)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExternalIDs(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "episode.mp4")
+
+	put := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/videos/"+itoa(v.ID)+"/external-ids", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := put(url.Values{"tvmaze": {"1234"}, "imdb": {"tt0000001"}}); rec.Code != http.StatusOK {
+		t.Fatalf("set: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	// Providers left out keep their IDs; an empty one is cleared.
+	rec := put(url.Values{"imdb": {""}})
+	var ids map[string]string
+	json.NewDecoder(rec.Body).Decode(&ids) //nolint:errcheck
+	if len(ids) != 1 || ids["tvmaze"] != "1234" {
+		t.Errorf("unexpected IDs: %v", ids)
+	}
+	if rec := put(url.Values{"netflix": {"1"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown provider: expected 400, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/external-ids/tvmaze/1234", nil))
+	var got apiVideo
+	json.NewDecoder(rec.Body).Decode(&got) //nolint:errcheck
+	if rec.Code != http.StatusOK || got.ID != v.ID || got.ExternalIDs["tvmaze"] != "1234" {
+		t.Errorf("lookup: got %d %+v", rec.Code, got)
+	}
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/external-ids/tvmaze/999", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown ID: expected 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,301 @@
+// handlers_hls.go – seekable HLS transcode sessions.
+//
+// Each session owns a temp directory of MPEG-TS segments and at most one
+// running ffmpeg. The playlist lists every segment of the video up front, so
+// players can seek anywhere; when a requested segment is far ahead of (or
+// behind) what ffmpeg is producing, ffmpeg is restarted at that segment
+// instead of transcoding linearly up to it.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/transcode"
+)
+
+// hlsSession tracks one client's HLS transcode of a single video.
+type hlsSession struct {
+	id      string
+	videoID int64
+	src     string
+	dir     string // temp directory holding the segments
+	opts    transcode.HLSOptions
+
+	mu       sync.Mutex
+	cancel   context.CancelFunc // stops the running ffmpeg; nil before the first start
+	done     chan struct{}      // closed when the running ffmpeg exits
+	lastUsed time.Time
+}
+
+// segmentPath returns the on-disk path of segment n.
+func (h *hlsSession) segmentPath(n int) string {
+	return filepath.Join(h.dir, transcode.HLSSegmentName(n))
+}
+
+// running reports whether ffmpeg is still producing segments. Caller holds h.mu.
+func (h *hlsSession) running() bool {
+	if h.done == nil {
+		return false
+	}
+	select {
+	case <-h.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// frontier returns the index of the first segment at or after the running
+// job's start that has not been written yet. Caller holds h.mu.
+func (h *hlsSession) frontier() int {
+	n := h.opts.StartSegment
+	for {
+		if _, err := os.Stat(h.segmentPath(n)); err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+// startAt (re)starts ffmpeg so that it produces segments from seg onwards,
+// stopping any previous run first. Caller holds h.mu.
+func (h *hlsSession) startAt(seg int) {
+	if h.cancel != nil {
+		h.cancel()
+		<-h.done
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	opts := h.opts
+	opts.StartSegment = seg
+	h.opts, h.cancel, h.done = opts, cancel, done
+	go func() {
+		defer close(done)
+		if err := transcode.HLS(ctx, h.src, h.dir, opts); err != nil && ctx.Err() == nil {
+			slog.Warn("hls transcode failed", "session", h.id, "video_id", h.videoID, "err", err)
+		}
+	}()
+	slog.Debug("hls transcode started", "session", h.id, "segment", seg)
+}
+
+// stop kills ffmpeg and removes the session's segments.
+func (h *hlsSession) stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cancel != nil {
+		h.cancel()
+		<-h.done
+		h.cancel = nil
+	}
+	os.RemoveAll(h.dir) //nolint:errcheck
+}
+
+// hlsShouldRestart decides whether a request for segment seg that is not on
+// disk yet warrants restarting ffmpeg. start is the running job's first
+// segment and frontier the next segment it will write. Segments within
+// hlsRestartGap of the frontier are cheaper to wait for than to restart.
+func hlsShouldRestart(seg, start, frontier int, running bool) bool {
+	if !running {
+		return true
+	}
+	return seg < start || seg >= frontier+hlsRestartGap
+}
+
+// hlsPlaylist renders a VOD media playlist covering durationS seconds in
+// segments of segSecs, each pointing at /hls/{sessionID}/{n}.ts as passed
+// through sign (see streamSigner).
+func hlsPlaylist(sessionID string, durationS, segSecs float64, sign func(string) string) string {
+	n := int(math.Ceil(durationS / segSecs))
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(segSecs)))
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for i := 0; i < n; i++ {
+		d := segSecs
+		if rest := durationS - float64(i)*segSecs; rest < d {
+			d = rest
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", d, sign("/hls/"+sessionID+"/"+transcode.HLSSegmentName(i)))
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+// handleHLSPlaylist serves GET /videos/{id}/hls.m3u8. Each call opens a new
+// transcode session (optionally capped at ?max_height and ?max_kbps) and
+// returns its playlist; ffmpeg starts lazily on the first segment request.
+func (s *server) handleHLSPlaylist(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		http.Error(w, "ffmpeg is not installed — transcoding is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	opts := transcode.HLSOptions{SegmentSecs: hlsSegmentSecs}
+	if opts.AudioTrack, ok = audioTrackOption(r); !ok {
+		http.Error(w, "invalid audio", http.StatusBadRequest)
+		return
+	}
+	if v := r.URL.Query().Get("max_height"); v != "" {
+		h, err := strconv.Atoi(v)
+		if err != nil || h < 0 {
+			http.Error(w, "invalid max_height", http.StatusBadRequest)
+			return
+		}
+		opts.MaxHeight = h
+	}
+	if v := r.URL.Query().Get("max_kbps"); v != "" {
+		k, err := strconv.Atoi(v)
+		if err != nil || k < 0 {
+			http.Error(w, "invalid max_kbps", http.StatusBadRequest)
+			return
+		}
+		opts.MaxBitrateK = k
+	}
+	duration := video.DurationS
+	if duration <= 0 {
+		duration = metadata.ReadDuration(video.FilePath())
+	}
+	if duration <= 0 {
+		http.Error(w, "video duration unknown — cannot build playlist", http.StatusInternalServerError)
+		return
+	}
+	dir, err := os.MkdirTemp("", "video_manger-hls-*")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sess := &hlsSession{
+		id:       newToken(),
+		videoID:  video.ID,
+		src:      video.FilePath(),
+		dir:      dir,
+		opts:     opts,
+		lastUsed: time.Now(),
+	}
+	s.hlsMu.Lock()
+	s.hlsSessions[sess.id] = sess
+	s.hlsMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(w, hlsPlaylist(sess.id, duration, hlsSegmentSecs, s.streamSigner(r.Context())))
+}
+
+// handleHLSSegment serves GET /hls/{session}/{n}.ts, restarting the session's
+// ffmpeg at n when the player has seeked away from the current encode.
+func (s *server) handleHLSSegment(w http.ResponseWriter, r *http.Request) {
+	s.hlsMu.Lock()
+	sess := s.hlsSessions[chi.URLParam(r, "session")]
+	s.hlsMu.Unlock()
+	if sess == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	seg, err := strconv.Atoi(strings.TrimSuffix(chi.URLParam(r, "segment"), ".ts"))
+	if err != nil || seg < 0 {
+		http.Error(w, "invalid segment", http.StatusBadRequest)
+		return
+	}
+	path := sess.segmentPath(seg)
+
+	sess.mu.Lock()
+	sess.lastUsed = time.Now()
+	if _, err := os.Stat(path); err != nil &&
+		hlsShouldRestart(seg, sess.opts.StartSegment, sess.frontier(), sess.running()) {
+		sess.startAt(seg)
+	}
+	done := sess.done
+	sess.mu.Unlock()
+
+	// Wait for ffmpeg to finish writing the segment.
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-done:
+			// ffmpeg exited (finished, failed, or was restarted elsewhere);
+			// the segment is either there now or will not be produced.
+			if _, err := os.Stat(path); err != nil {
+				http.Error(w, "segment unavailable", http.StatusServiceUnavailable)
+				return
+			}
+		case <-tick.C:
+		}
+	}
+	w.Header().Set("Content-Type", "video/mp2t")
+	http.ServeFile(w, r, path)
+}
+
+// handleHLSStop serves DELETE /hls/{session}: stops the transcode and removes
+// its temp segments. Players that never call this are reaped by the pruner.
+func (s *server) handleHLSStop(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "session")
+	s.hlsMu.Lock()
+	sess := s.hlsSessions[id]
+	delete(s.hlsSessions, id)
+	s.hlsMu.Unlock()
+	if sess == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	sess.stop()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pruneHLSSessions stops sessions that have not served a segment for longer
+// than ttl (the player was closed or navigated away). A negative ttl stops all.
+func (s *server) pruneHLSSessions(now time.Time, ttl time.Duration) {
+	var idle []*hlsSession
+	s.hlsMu.Lock()
+	for id, sess := range s.hlsSessions {
+		sess.mu.Lock()
+		if now.Sub(sess.lastUsed) > ttl {
+			idle = append(idle, sess)
+			delete(s.hlsSessions, id)
+		}
+		sess.mu.Unlock()
+	}
+	s.hlsMu.Unlock()
+	for _, sess := range idle {
+		slog.Debug("hls session expired", "session", sess.id)
+		sess.stop()
+	}
+}
+
+// startHLSPruner reaps idle HLS sessions until ctx is cancelled, then stops
+// any that remain so no ffmpeg or temp directory outlives the server.
+func (s *server) startHLSPruner(ctx context.Context) {
+	ticker := time.NewTicker(hlsIdleTTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.pruneHLSSessions(time.Now(), -1)
+			return
+		case now := <-ticker.C:
+			s.pruneHLSSessions(now, hlsIdleTTL)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// handlers_maintenance.go – library housekeeping.
+//
+// POST /maintenance/prune – remove video rows whose files are gone and tags
+// that no video carries, returning a JSON summary.
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// pruneSummary reports what handleMaintenancePrune removed.
+type pruneSummary struct {
+	VideosRemoved  []string `json:"videos_removed"`  // file paths of the deleted rows
+	TagsRemoved    []string `json:"tags_removed"`    // names of the deleted tags
+	SkippedOffline int      `json:"skipped_offline"` // videos kept because their drive is offline
+}
+
+// handleMaintenancePrune deletes videos whose files no longer exist and then
+// tags left without videos. Videos in offline directories are kept: their
+// files are expected back when the drive is reconnected.
+func (s *server) handleMaintenancePrune(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	dirs, err := s.store.ListDirectories(ctx)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	offline := make(map[int64]bool)
+	for _, d := range dirs {
+		if !s.checkDirectoryOnline(ctx, d) {
+			offline[d.ID] = true
+		}
+	}
+	videos, err := s.store.ListVideos(ctx)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	out := pruneSummary{VideosRemoved: []string{}, TagsRemoved: []string{}}
+	for _, v := range videos {
+		if _, err := s.blobs.Stat(v.FilePath()); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if offline[v.DirectoryID] {
+			out.SkippedOffline++
+			continue
+		}
+		if err := retryBusy(func() error { return s.store.DeleteVideo(ctx, v.ID) }); err != nil {
+			slog.Warn("prune: delete video failed", "videoID", v.ID, "err", err)
+			continue
+		}
+		out.VideosRemoved = append(out.VideosRemoved, v.FilePath())
+	}
+
+	before, err := s.store.ListTags(ctx)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if err := s.store.PruneOrphanTags(ctx); err != nil {
+		storeError(w, err)
+		return
+	}
+	after, err := s.store.ListTags(ctx)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	for _, t := range before {
+		if !slices.ContainsFunc(after, func(a store.Tag) bool { return a.ID == t.ID }) {
+			out.TagsRemoved = append(out.TagsRemoved, t.Name)
+		}
+	}
+	slog.Info("prune: done", "videos", len(out.VideosRemoved), "tags", len(out.TagsRemoved), "skipped_offline", out.SkippedOffline)
+	writeJSON(w, out)
+}
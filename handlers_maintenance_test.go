@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandleMaintenancePrune(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "here.mp4"), []byte("fake"), 0644) //nolint:errcheck
+	d, _ := srv.store.AddDirectory(ctx, root)
+	here, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "here.mp4")
+	gone, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "gone.mp4")
+	keep, _ := srv.store.UpsertTag(ctx, "keep")
+	stale, _ := srv.store.UpsertTag(ctx, "stale")
+	srv.store.TagVideo(ctx, here.ID, keep.ID)  //nolint:errcheck
+	srv.store.TagVideo(ctx, gone.ID, stale.ID) //nolint:errcheck
+
+	drive, _ := srv.store.AddDirectory(ctx, filepath.Join(t.TempDir(), "unplugged"))
+	away, _ := srv.store.UpsertVideo(ctx, drive.ID, drive.Path, "away.mp4")
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/maintenance/prune", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var got pruneSummary
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.VideosRemoved) != 1 || got.VideosRemoved[0] != gone.FilePath() {
+		t.Errorf("VideosRemoved = %v, want [%s]", got.VideosRemoved, gone.FilePath())
+	}
+	if len(got.TagsRemoved) != 1 || got.TagsRemoved[0] != "stale" {
+		t.Errorf("TagsRemoved = %v, want [stale]", got.TagsRemoved)
+	}
+	if got.SkippedOffline != 1 {
+		t.Errorf("SkippedOffline = %d, want 1", got.SkippedOffline)
+	}
+	if _, err := srv.store.GetVideo(ctx, here.ID); err != nil {
+		t.Error("video with an existing file was removed")
+	}
+	if _, err := srv.store.GetVideo(ctx, away.ID); err != nil {
+		t.Error("video on an offline drive was removed")
+	}
+}
@@ -0,0 +1,90 @@
+// handlers_markers.go – intro and credits ranges marked from the player.
+//
+// POST /videos/{id}/markers – set or clear the video's intro or credits range
+//
+// The ranges are stored as markers and returned with the playback progress,
+// so the player can offer to skip the intro or the end credits. Sending no
+// start and end clears the range.
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+const playerMarkerSource = "player" // store.Marker.Source for ranges marked in the player
+
+// skipRange is an intro or credits range as returned to the player.
+type skipRange struct {
+	Start float64 `json:"start"` // seconds
+	End   float64 `json:"end"`   // seconds
+}
+
+// skipRanges returns the video's intro and credits ranges keyed by marker
+// kind, with nil for one not marked.
+func (s *server) skipRanges(ctx context.Context, videoID int64) (map[string]*skipRange, error) {
+	markers, err := s.store.ListVideoMarkers(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]*skipRange{store.MarkerIntro: nil, store.MarkerCredits: nil}
+	for _, m := range markers {
+		if m.Kind == store.MarkerIntro || m.Kind == store.MarkerCredits {
+			out[m.Kind] = &skipRange{Start: m.Start, End: m.End}
+		}
+	}
+	return out, nil
+}
+
+// handleSetSkipMarker sets the intro or credits range from the form fields
+// kind, start and end (seconds), and responds with both ranges.
+func (s *server) handleSetSkipMarker(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	kind := r.FormValue("kind")
+	if kind != store.MarkerIntro && kind != store.MarkerCredits {
+		http.Error(w, "kind must be intro or credits", http.StatusBadRequest)
+		return
+	}
+	unset := r.FormValue("start") == "" && r.FormValue("end") == ""
+	start, errStart := strconv.ParseFloat(r.FormValue("start"), 64)
+	end, errEnd := strconv.ParseFloat(r.FormValue("end"), 64)
+	if !unset && (errStart != nil || errEnd != nil || start < 0 || end <= start) {
+		http.Error(w, "start and end must be seconds with start before end", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.GetVideo(r.Context(), id); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	markers, err := s.store.ListVideoMarkers(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	// Keep this source's other range; only the one being set is replaced.
+	var keep []store.Marker
+	for _, m := range markers {
+		if m.Source == playerMarkerSource && m.Kind != kind {
+			keep = append(keep, m)
+		}
+	}
+	if !unset {
+		keep = append(keep, store.Marker{Kind: kind, Start: start, End: end})
+	}
+	if err := s.store.SetVideoMarkers(r.Context(), id, playerMarkerSource, keep); err != nil {
+		storeError(w, err)
+		return
+	}
+	ranges, err := s.skipRanges(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	writeJSON(w, ranges)
+}
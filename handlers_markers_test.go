@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestSetSkipMarker(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "episode.mp4")
+	srv.store.SetVideoMarkers(ctx, v.ID, sponsorBlockSource, []store.Marker{{Kind: store.MarkerSkip, Start: 300, End: 330}}) //nolint:errcheck
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/videos/"+itoa(v.ID)+"/markers", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		return rec
+	}
+	progress := func() map[string]*skipRange {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/"+itoa(v.ID)+"/progress", nil))
+		var body map[string]*skipRange
+		json.NewDecoder(rec.Body).Decode(&body) //nolint:errcheck
+		return body
+	}
+
+	if rec := post(url.Values{"kind": {"intro"}, "start": {"5"}, "end": {"65.5"}}); rec.Code != http.StatusOK {
+		t.Fatalf("set intro: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post(url.Values{"kind": {"credits"}, "start": {"1300"}, "end": {"1380"}}); rec.Code != http.StatusOK {
+		t.Fatalf("set credits: expected 200, got %d", rec.Code)
+	}
+	got := progress()
+	if got["intro"] == nil || *got["intro"] != (skipRange{5, 65.5}) || got["credits"] == nil || *got["credits"] != (skipRange{1300, 1380}) {
+		t.Errorf("unexpected ranges with progress: intro %+v, credits %+v", got["intro"], got["credits"])
+	}
+
+	// Setting the intro again replaces it; clearing leaves credits alone.
+	post(url.Values{"kind": {"intro"}, "start": {"10"}, "end": {"70"}})
+	post(url.Values{"kind": {"intro"}})
+	got = progress()
+	if got["intro"] != nil || got["credits"] == nil {
+		t.Errorf("after clearing the intro: intro %+v, credits %+v", got["intro"], got["credits"])
+	}
+	markers, _ := srv.store.ListVideoMarkers(ctx, v.ID)
+	if len(markers) != 2 {
+		t.Errorf("expected the sponsor segment and the credits, got %+v", markers)
+	}
+
+	for _, form := range []url.Values{
+		{"kind": {"outro"}, "start": {"1"}, "end": {"2"}},
+		{"kind": {"intro"}, "start": {"20"}, "end": {"10"}},
+		{"kind": {"intro"}, "start": {"x"}, "end": {"10"}},
+		{"kind": {"intro"}, "start": {"5"}},
+	} {
+		if rec := post(form); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d", form, rec.Code)
+		}
+	}
+}
@@ -6,11 +6,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"html"
 	"log/slog"
+	"math"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -196,7 +197,11 @@ func (s *server) handleGetMetadata(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		slog.Warn("read streams failed", "path", video.FilePath(), "err", err)
 	}
-	render(w, "file_metadata.html", fileMetaData{VideoID: video.ID, Native: native, Streams: streams})
+	sidecars, err := s.store.ListVideoSidecars(r.Context(), video.ID)
+	if err != nil {
+		slog.Warn("list sidecars failed", "videoID", video.ID, "err", err)
+	}
+	render(w, "file_metadata.html", fileMetaData{VideoID: video.ID, Native: native, Streams: streams, Sidecars: sidecars})
 }
 
 func (s *server) handleEditMetadata(w http.ResponseWriter, r *http.Request) {
@@ -211,6 +216,17 @@ func (s *server) handleEditMetadata(w http.ResponseWriter, r *http.Request) {
 	render(w, "file_metadata_edit.html", fileMetaData{VideoID: video.ID, Native: native})
 }
 
+// saveDescription records the description just written to a video's file,
+// so search finds it without waiting for the next scan.
+func (s *server) saveDescription(ctx context.Context, videoID int64, u metadata.Updates) {
+	if u.Description == nil {
+		return
+	}
+	if err := s.store.SetVideoDescription(ctx, videoID, strings.TrimSpace(*u.Description)); err != nil {
+		slog.Warn("save description failed", "videoID", videoID, "err", err)
+	}
+}
+
 func (s *server) handleUpdateMetadata(w http.ResponseWriter, r *http.Request) {
 	video, ok := s.videoOrError(w, r)
 	if !ok {
@@ -232,6 +248,8 @@ func (s *server) handleUpdateMetadata(w http.ResponseWriter, r *http.Request) {
 	if err := metadata.Write(video.FilePath(), u); err != nil {
 		slog.Warn("write metadata failed", "path", video.FilePath(), "err", err)
 		warn = "Metadata write failed: " + err.Error()
+	} else {
+		s.saveDescription(r.Context(), video.ID, u)
 	}
 	native, err := metadata.Read(video.FilePath())
 	if err != nil {
@@ -275,12 +293,12 @@ func (s *server) handleUpdateVideoFields(w http.ResponseWriter, r *http.Request)
 		Channel:       r.FormValue("channel"),
 	}
 	if err := s.store.UpdateVideoFields(r.Context(), id, f); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	video, err := s.store.GetVideo(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	w.Header().Set("HX-Trigger", fmt.Sprintf(`{"videoLabelled":{"id":%d}}`, id))
@@ -289,16 +307,32 @@ func (s *server) handleUpdateVideoFields(w http.ResponseWriter, r *http.Request)
 
 // ── Tags list ─────────────────────────────────────────────────────────────────
 
+// handleListTags serves GET /tags, the library's filter chips. They are
+// shuffled within each sort order, so tags given an order stay grouped.
 func (s *server) handleListTags(w http.ResponseWriter, r *http.Request) {
 	tags, err := s.store.ListTags(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	rand.Shuffle(len(tags), func(i, j int) { tags[i], tags[j] = tags[j], tags[i] })
+	slices.SortStableFunc(tags, func(a, b store.Tag) int { return a.SortOrder - b.SortOrder })
 	render(w, "tags.html", tags)
 }
 
+// handleSuggestTags serves GET /tags/suggest?q=…: datalist options for the
+// add-tag input, listing existing tags that contain q, most-used first, so
+// users pick "vacation" instead of creating "vacations".
+func (s *server) handleSuggestTags(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	tags, err := s.store.SuggestTags(r.Context(), q, tagSuggestLimit)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "tag_suggest.html", tags)
+}
+
 // ── TMDB lookup ───────────────────────────────────────────────────────────────
 
 // requireTMDBKey retrieves the configured TMDB API key. If the key is not set
@@ -313,48 +347,79 @@ func (s *server) requireTMDBKey(w http.ResponseWriter, r *http.Request) (string,
 	return key, true
 }
 
-// fetchMovieMetadata fetches title, overview, release date, and first genre
-// for a TMDB movie ID.
-func fetchMovieMetadata(apiKey, tmdbID string) (metadata.Updates, error) {
+// tmdbLookup is what a TMDB lookup found for one video.
+type tmdbLookup struct {
+	Updates metadata.Updates
+	IDs     map[string]string // the video's external IDs, keyed by provider
+	// Show and PosterURL are the series' details and poster image, and
+	// Episodes its episode list, nil when it couldn't be fetched; TV only.
+	Show      *store.Show
+	PosterURL string
+	Episodes  []store.ShowEpisode
+}
+
+// fetchMovieMetadata fetches title, overview, release date, first genre and
+// IMDb ID for a TMDB movie ID.
+func fetchMovieMetadata(apiKey, tmdbID string) (tmdbLookup, error) {
 	var m struct {
 		Title       string                  `json:"title"`
 		Overview    string                  `json:"overview"`
 		ReleaseDate string                  `json:"release_date"`
 		Genres      []struct{ Name string } `json:"genres"`
+		IMDbID      string                  `json:"imdb_id"`
 	}
 	if err := tmdbGet(apiKey, "/movie/"+tmdbID, &m); err != nil {
-		return metadata.Updates{}, err
+		return tmdbLookup{}, err
 	}
 	genre := ""
 	if len(m.Genres) > 0 {
 		genre = m.Genres[0].Name
 	}
-	return metadata.Updates{
-		Title:       strPtr(m.Title),
-		Description: strPtr(m.Overview),
-		Genre:       strPtr(genre),
-		Date:        strPtr(m.ReleaseDate),
+	return tmdbLookup{
+		Updates: metadata.Updates{
+			Title:       strPtr(m.Title),
+			Description: strPtr(m.Overview),
+			Genre:       strPtr(genre),
+			Date:        strPtr(m.ReleaseDate),
+		},
+		IDs: map[string]string{store.ExternalTMDB: "movie/" + tmdbID, store.ExternalIMDb: m.IMDbID},
 	}, nil
 }
 
 // fetchTVMetadata fetches show + episode details for a TMDB TV series ID.
-func fetchTVMetadata(apiKey, tmdbID string, season, episode int) (metadata.Updates, error) {
+func fetchTVMetadata(apiKey, tmdbID string, season, episode int) (tmdbLookup, error) {
 	var show struct {
-		Name     string                  `json:"name"`
-		Networks []struct{ Name string } `json:"networks"`
-		Genres   []struct{ Name string } `json:"genres"`
+		Name        string                  `json:"name"`
+		Overview    string                  `json:"overview"`
+		PosterPath  string                  `json:"poster_path"`
+		Networks    []struct{ Name string } `json:"networks"`
+		Genres      []struct{ Name string } `json:"genres"`
+		ExternalIDs struct {
+			IMDbID   string `json:"imdb_id"`
+			TVMazeID int    `json:"tvmaze_id"`
+		} `json:"external_ids"`
+		Seasons []struct {
+			Number int `json:"season_number"`
+		} `json:"seasons"`
 	}
-	if err := tmdbGet(apiKey, "/tv/"+tmdbID, &show); err != nil {
-		return metadata.Updates{}, err
+	if err := tmdbGet(apiKey, "/tv/"+tmdbID+"?append_to_response=external_ids", &show); err != nil {
+		return tmdbLookup{}, err
 	}
 	var ep struct {
-		Name     string `json:"name"`
-		Overview string `json:"overview"`
-		AirDate  string `json:"air_date"`
-	}
-	epPath := fmt.Sprintf("/tv/%s/season/%d/episode/%d", tmdbID, season, episode)
-	if err := tmdbGet(apiKey, epPath, &ep); err != nil {
+		Name        string `json:"name"`
+		Overview    string `json:"overview"`
+		AirDate     string `json:"air_date"`
+		ExternalIDs struct {
+			IMDbID string `json:"imdb_id"`
+		} `json:"external_ids"`
+	}
+	epPath := fmt.Sprintf("tv/%s/season/%d/episode/%d", tmdbID, season, episode)
+	ids := map[string]string{}
+	if err := tmdbGet(apiKey, "/"+epPath+"?append_to_response=external_ids", &ep); err != nil {
 		slog.Warn("TMDB episode fetch failed", "err", err)
+	} else {
+		ids[store.ExternalTMDB] = epPath
+		ids[store.ExternalIMDb] = ep.ExternalIDs.IMDbID
 	}
 	genre, network := "", ""
 	if len(show.Genres) > 0 {
@@ -365,16 +430,45 @@ func fetchTVMetadata(apiKey, tmdbID string, season, episode int) (metadata.Updat
 	}
 	sNum := strconv.Itoa(season)
 	eNum := strconv.Itoa(episode)
-	return metadata.Updates{
-		Title:       strPtr(ep.Name),
-		Description: strPtr(ep.Overview),
-		Genre:       strPtr(genre),
-		Date:        strPtr(ep.AirDate),
-		Show:        strPtr(show.Name),
-		Network:     strPtr(network),
-		SeasonNum:   &sNum,
-		EpisodeNum:  &eNum,
-	}, nil
+	res := tmdbLookup{
+		Updates: metadata.Updates{
+			Title:       strPtr(ep.Name),
+			Description: strPtr(ep.Overview),
+			Genre:       strPtr(genre),
+			Date:        strPtr(ep.AirDate),
+			Show:        strPtr(show.Name),
+			Network:     strPtr(network),
+			SeasonNum:   &sNum,
+			EpisodeNum:  &eNum,
+		},
+		IDs: ids,
+	}
+	if show.Name != "" {
+		res.Show = &store.Show{
+			Name:     show.Name,
+			Overview: show.Overview,
+			ExternalIDs: map[string]string{
+				store.ExternalTMDB: "tv/" + tmdbID,
+				store.ExternalIMDb: show.ExternalIDs.IMDbID,
+			},
+		}
+		if show.ExternalIDs.TVMazeID > 0 {
+			res.Show.ExternalIDs[store.ExternalTVMaze] = strconv.Itoa(show.ExternalIDs.TVMazeID)
+		}
+		if show.PosterPath != "" {
+			res.PosterURL = tmdbImageBase + show.PosterPath
+		}
+		seasons := make([]int, 0, len(show.Seasons))
+		for _, sn := range show.Seasons {
+			seasons = append(seasons, sn.Number)
+		}
+		episodes, err := fetchTMDBEpisodes(apiKey, tmdbID, seasons)
+		if err != nil {
+			slog.Warn("TMDB episode list fetch failed", "show", show.Name, "err", err)
+		}
+		res.Episodes = episodes
+	}
+	return res, nil
 }
 
 // applyTMDBSystemTags persists TMDB metadata as system tags in the DB.
@@ -483,14 +577,14 @@ func (s *server) handleLookupApply(w http.ResponseWriter, r *http.Request) {
 	episode, _ := strconv.Atoi(r.FormValue("episode"))
 
 	var (
-		u   metadata.Updates
+		res tmdbLookup
 		err error
 	)
 	switch mediaType {
 	case "movie":
-		u, err = fetchMovieMetadata(apiKey, tmdbID)
+		res, err = fetchMovieMetadata(apiKey, tmdbID)
 	case "tv":
-		u, err = fetchTVMetadata(apiKey, tmdbID, season, episode)
+		res, err = fetchTVMetadata(apiKey, tmdbID, season, episode)
 	default:
 		http.Error(w, "invalid media_type", http.StatusBadRequest)
 		return
@@ -500,13 +594,27 @@ func (s *server) handleLookupApply(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	u := res.Updates
 	var warn string
 	if err := metadata.Write(video.FilePath(), u); err != nil {
 		slog.Warn("TMDB apply: write failed", "path", video.FilePath(), "err", err)
 		warn = "Metadata write failed: " + err.Error()
+	} else {
+		s.saveDescription(r.Context(), video.ID, u)
 	}
 
 	s.applyTMDBSystemTags(r.Context(), video.ID, mediaType, u, season)
+	if res.Show != nil {
+		s.saveTMDBShow(r.Context(), res)
+	}
+	for provider, id := range res.IDs {
+		if id == "" {
+			continue
+		}
+		if err := s.store.SetVideoExternalID(r.Context(), video.ID, provider, id); err != nil {
+			slog.Warn("TMDB apply: set external ID failed", "provider", provider, "err", err)
+		}
+	}
 
 	native, err := metadata.Read(video.FilePath())
 	if err != nil {
@@ -524,8 +632,7 @@ func (s *server) handleLookupEpisodes(w http.ResponseWriter, r *http.Request) {
 	apiKey, _ := s.store.GetSetting(r.Context(), "tmdb_api_key")
 	apiKey = strings.TrimSpace(apiKey)
 	if apiKey == "" {
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		fmt.Fprint(w, `<p style="font-size:0.82rem;color:#f87">TMDB API key not configured.</p>`)
+		renderNotice(w, false, "TMDB API key not configured.")
 		return
 	}
 	tmdbID := r.FormValue("tmdb_id")
@@ -539,8 +646,7 @@ func (s *server) handleLookupEpisodes(w http.ResponseWriter, r *http.Request) {
 	epPath := fmt.Sprintf("/tv/%s/season/%d", tmdbID, season)
 	if err := tmdbGet(apiKey, epPath, &seasonData); err != nil {
 		slog.Warn("TMDB fetch season failed", "err", err)
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		fmt.Fprintf(w, `<p style="font-size:0.82rem;color:#f87">Could not load episodes: %s</p>`, html.EscapeString(err.Error()))
+		renderNotice(w, false, "Could not load episodes: "+err.Error())
 		return
 	}
 	render(w, "lookup_episodes.html", struct {
@@ -555,25 +661,106 @@ func (s *server) handleLookupEpisodes(w http.ResponseWriter, r *http.Request) {
 
 func (s *server) handleGetSettings(w http.ResponseWriter, r *http.Request) {
 	autoplay, _ := s.store.GetSetting(r.Context(), "autoplay_random")
+	autoplayNext, _ := s.store.GetSetting(r.Context(), "autoplay_next")
+	randomUnwatched, _ := s.store.GetSetting(r.Context(), "random_unwatched")
 	videoSort, _ := s.store.GetSetting(r.Context(), "video_sort")
 	tmdbKey, _ := s.store.GetSetting(r.Context(), "tmdb_api_key")
 	libraryPath, _ := s.store.GetSetting(r.Context(), "library_path")
 	nextFromSearch, _ := s.store.GetSetting(r.Context(), "next_from_search")
 	rokuEnabled, _ := s.store.GetSetting(r.Context(), "roku_enabled")
+	dlnaEnabled, _ := s.store.GetSetting(r.Context(), "dlna_enabled")
+	signedStreams, _ := s.store.GetSetting(r.Context(), "signed_streams")
+	sharePages, _ := s.store.GetSetting(r.Context(), "share_pages")
+	cardFields, _ := s.store.GetSetting(r.Context(), "card_fields")
+	tagFromMeta, _ := s.store.GetSetting(r.Context(), "tag_from_metadata")
+	budgetWebhook, _ := s.store.GetSetting(r.Context(), "budget_webhook_url")
+	airingWebhook, _ := s.store.GetSetting(r.Context(), "airing_webhook_url")
+	eventsWebhook, _ := s.store.GetSetting(r.Context(), "events_webhook_url")
+	libraryView, _ := s.store.GetSetting(r.Context(), "library_view")
+	prepareHours, _ := s.store.GetSetting(r.Context(), "prepare_hours")
+	streamLimit, _ := s.store.GetSetting(r.Context(), "stream_limit_mbps")
+	ytdlpDomains := s.ytdlpAllowedDomains(r.Context())
+	libraryBudget, libraryCap := s.librarySizeLimits(r.Context())
+	tags, err := s.store.ListTagCounts(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	pool := s.autoplayPool(r.Context())
+	poolTags := make(map[int64]bool, len(pool.TagIDs))
+	for _, id := range pool.TagIDs {
+		poolTags[id] = true
+	}
 	render(w, "settings.html", struct {
-		AutoplayRandom bool
-		VideoSort      string
-		HasTMDBKey     bool
-		LibraryPath    string
-		NextFromSearch bool
-		RokuEnabled    bool
+		AutoplayRandom   bool
+		AutoplayNext     bool
+		VideoSort        string
+		HasTMDBKey       bool
+		LibraryPath      string
+		NextFromSearch   bool
+		RokuEnabled      bool
+		DLNAEnabled      bool
+		SignedStreams    bool
+		SharePages       bool
+		TagFromMetadata  bool
+		SkipJunkFiles    bool
+		Companions       bool
+		CardFields       map[string]bool
+		CardFieldOptions []struct{ Key, Label string }
+		LibraryBudget    int64
+		LibraryCap       int64
+		BudgetWebhookURL string
+		AiringWebhookURL string
+		EventsWebhookURL string
+		LibraryView      string
+		StarRatings      bool
+		ThumbPercent     int
+		WatchPercent     int
+		RandomNoRepeat   int
+		RandomUnwatched  bool
+		Tags             []store.TagCount // plain tags, for the autoplay pool
+		PoolTags         map[int64]bool
+		Pool             store.RandomFilter
+		PrepareHours     string
+		ReportHour       int
+		StreamLimitMbps  string
+		StreamsPerClient int
+		YTDLPDomains     string
 	}{
-		AutoplayRandom: autoplay == "true",
-		VideoSort:      videoSort,
-		HasTMDBKey:     strings.TrimSpace(tmdbKey) != "",
-		LibraryPath:    strings.TrimSpace(libraryPath),
-		NextFromSearch: nextFromSearch == "true",
-		RokuEnabled:    rokuEnabled == "true",
+		AutoplayRandom:   autoplay == "true",
+		AutoplayNext:     autoplayNext == "true",
+		VideoSort:        videoSort,
+		HasTMDBKey:       strings.TrimSpace(tmdbKey) != "",
+		LibraryPath:      strings.TrimSpace(libraryPath),
+		NextFromSearch:   nextFromSearch == "true",
+		RokuEnabled:      rokuEnabled == "true",
+		DLNAEnabled:      dlnaEnabled == "true",
+		SignedStreams:    signedStreams == "true",
+		SharePages:       sharePages == "true",
+		TagFromMetadata:  tagFromMeta == "true",
+		SkipJunkFiles:    s.skipJunkFiles(r.Context()),
+		Companions:       s.includeCompanions(r.Context()),
+		CardFields:       parseCardFields(cardFields),
+		CardFieldOptions: cardFieldOptions,
+		LibraryBudget:    libraryBudget,
+		LibraryCap:       libraryCap,
+		BudgetWebhookURL: budgetWebhook,
+		AiringWebhookURL: airingWebhook,
+		EventsWebhookURL: eventsWebhook,
+		LibraryView:      libraryView,
+		StarRatings:      s.starRatings(r.Context()),
+		ThumbPercent:     s.thumbPercent(r),
+		WatchPercent:     int(math.Round(s.watchedFraction(r.Context()) * 100)),
+		RandomNoRepeat:   s.randomRecentN(r.Context()),
+		RandomUnwatched:  randomUnwatched == "true",
+		Tags:             tags,
+		PoolTags:         poolTags,
+		Pool:             pool,
+		PrepareHours:     prepareHours,
+		ReportHour:       s.reportHour(r.Context()),
+		StreamLimitMbps:  strings.TrimSpace(streamLimit),
+		StreamsPerClient: s.streamsPerClientLimit(r.Context()),
+		YTDLPDomains:     strings.Join(ytdlpDomains, ", "),
 	})
 }
 
@@ -582,6 +769,22 @@ func (s *server) handleSaveSettings(w http.ResponseWriter, r *http.Request) {
 	if r.FormValue("autoplay_random") == "on" {
 		autoplay = "true"
 	}
+	autoplayNext := "false"
+	if r.FormValue("autoplay_next") == "on" {
+		autoplayNext = "true"
+	}
+	randomUnwatched := "false"
+	if r.FormValue("random_unwatched") == "on" {
+		randomUnwatched = "true"
+	}
+	poolUnwatched := "false"
+	if r.FormValue("autoplay_pool_unwatched") == "on" {
+		poolUnwatched = "true"
+	}
+	poolExcludeShows := "false"
+	if r.FormValue("autoplay_pool_exclude_shows") == "on" {
+		poolExcludeShows = "true"
+	}
 	nextFromSearch := "false"
 	if r.FormValue("next_from_search") == "on" {
 		nextFromSearch = "true"
@@ -590,20 +793,185 @@ func (s *server) handleSaveSettings(w http.ResponseWriter, r *http.Request) {
 	if r.FormValue("roku_enabled") == "on" {
 		rokuEnabled = "true"
 	}
+	dlnaEnabled := "false"
+	if r.FormValue("dlna_enabled") == "on" {
+		dlnaEnabled = "true"
+	}
+	signedStreams := "false"
+	if r.FormValue("signed_streams") == "on" {
+		signedStreams = "true"
+	}
+	sharePages := "false"
+	if r.FormValue("share_pages") == "on" {
+		sharePages = "true"
+	}
+	tagFromMeta := "false"
+	if r.FormValue("tag_from_metadata") == "on" {
+		tagFromMeta = "true"
+	}
+	skipJunk := "false"
+	if r.FormValue("skip_junk_files") == "on" {
+		skipJunk = "true"
+	}
+	companions := "false"
+	if r.FormValue("include_companions") == "on" {
+		companions = "true"
+	}
+	libraryBudget, ok := parseGigabytes(r.FormValue("library_budget_gb"))
+	if !ok {
+		http.Error(w, "invalid library budget", http.StatusBadRequest)
+		return
+	}
+	libraryCap, ok := parseGigabytes(r.FormValue("library_cap_gb"))
+	if !ok {
+		http.Error(w, "invalid library cap", http.StatusBadRequest)
+		return
+	}
+	webhook := strings.TrimSpace(r.FormValue("budget_webhook_url"))
+	if webhook != "" {
+		if !validWebhookURL(webhook) {
+			http.Error(w, "webhook URL must be an http:// or https:// URL", http.StatusBadRequest)
+			return
+		}
+	}
+	airingWebhook := strings.TrimSpace(r.FormValue("airing_webhook_url"))
+	if airingWebhook != "" && !validWebhookURL(airingWebhook) {
+		http.Error(w, "webhook URL must be an http:// or https:// URL", http.StatusBadRequest)
+		return
+	}
+	eventsWebhook := strings.TrimSpace(r.FormValue("events_webhook_url"))
+	if eventsWebhook != "" && !validWebhookURL(eventsWebhook) {
+		http.Error(w, "webhook URL must be an http:// or https:// URL", http.StatusBadRequest)
+		return
+	}
+	thumbPercent := strings.TrimSpace(r.FormValue("thumbnail_percent"))
+	if thumbPercent != "" {
+		if p, err := strconv.Atoi(thumbPercent); err != nil || p < 0 || p > 100 {
+			http.Error(w, "thumbnail position must be a percentage from 0 to 100", http.StatusBadRequest)
+			return
+		}
+	}
+	watchPercent := strings.TrimSpace(r.FormValue("watched_percent"))
+	if watchPercent != "" {
+		if p, err := strconv.Atoi(watchPercent); err != nil || p < 1 || p > 100 {
+			http.Error(w, "watched share must be a percentage from 1 to 100", http.StatusBadRequest)
+			return
+		}
+	}
+	randomNoRepeat := strings.TrimSpace(r.FormValue("random_no_repeat"))
+	if randomNoRepeat != "" {
+		if n, err := strconv.Atoi(randomNoRepeat); err != nil || n < 0 {
+			http.Error(w, "random repeats must be a whole number of picks", http.StatusBadRequest)
+			return
+		}
+	}
+	poolMinRating := strings.TrimSpace(r.FormValue("autoplay_pool_min_rating"))
+	if poolMinRating != "" {
+		if n, err := strconv.Atoi(poolMinRating); err != nil || n < 0 || n > 2 {
+			http.Error(w, "minimum rating must be 0, 1 or 2", http.StatusBadRequest)
+			return
+		}
+	}
+	var poolTags []string
+	for _, v := range r.Form["autoplay_pool_tags"] {
+		if id, err := strconv.ParseInt(v, 10, 64); err != nil || id <= 0 {
+			http.Error(w, "invalid autoplay pool tag", http.StatusBadRequest)
+			return
+		}
+		poolTags = append(poolTags, v)
+	}
+	prepareHours := strings.ReplaceAll(r.FormValue("prepare_hours"), " ", "")
+	if _, _, ok := parseHourRange(prepareHours); prepareHours != "" && !ok {
+		http.Error(w, "prepare hours must be a range such as 1-6", http.StatusBadRequest)
+		return
+	}
+	reportHour := strings.TrimSpace(r.FormValue("report_hour"))
+	if reportHour != "" {
+		if h, err := strconv.Atoi(reportHour); err != nil || h < 0 || h > 23 {
+			http.Error(w, "report hour must be a whole hour from 0 to 23", http.StatusBadRequest)
+			return
+		}
+	}
+	streamLimit := strings.TrimSpace(r.FormValue("stream_limit_mbps"))
+	if streamLimit != "" {
+		if mbps, err := strconv.ParseFloat(streamLimit, 64); err != nil || mbps < 0 || math.IsInf(mbps, 0) {
+			http.Error(w, "stream limit must be a number of Mbit/s", http.StatusBadRequest)
+			return
+		}
+	}
+	streamsPerClient := strings.TrimSpace(r.FormValue("streams_per_client"))
+	if streamsPerClient != "" {
+		if n, err := strconv.Atoi(streamsPerClient); err != nil || n < 0 {
+			http.Error(w, "streams per device must be a whole number, 0 for no limit", http.StatusBadRequest)
+			return
+		}
+	}
+	ytdlpDomains, ok := parseDomainList(r.FormValue("ytdlp_allowed_domains"))
+	if !ok {
+		http.Error(w, "download sites must be domain names such as youtube.com", http.StatusBadRequest)
+		return
+	}
+	libraryView := "list"
+	if r.FormValue("library_view") == "posters" {
+		libraryView = "posters"
+	}
+	ratingScale := "thumbs"
+	if r.FormValue("rating_scale") == "stars" {
+		ratingScale = "stars"
+	}
+	var cardFields []string
+	for _, opt := range cardFieldOptions {
+		if slices.Contains(r.Form["card_fields"], opt.Key) {
+			cardFields = append(cardFields, opt.Key)
+		}
+	}
 	pairs := map[string]string{
-		"autoplay_random":  autoplay,
-		"video_sort":       r.FormValue("video_sort"),
-		"library_path":     strings.TrimSpace(r.FormValue("library_path")),
-		"next_from_search": nextFromSearch,
-		"roku_enabled":     rokuEnabled,
+		"card_fields":        strings.Join(cardFields, ","),
+		"autoplay_random":    autoplay,
+		"autoplay_next":      autoplayNext,
+		"video_sort":         r.FormValue("video_sort"),
+		"library_path":       strings.TrimSpace(r.FormValue("library_path")),
+		"next_from_search":   nextFromSearch,
+		"roku_enabled":       rokuEnabled,
+		"dlna_enabled":       dlnaEnabled,
+		"signed_streams":     signedStreams,
+		"share_pages":        sharePages,
+		"tag_from_metadata":  tagFromMeta,
+		"skip_junk_files":    skipJunk,
+		"include_companions": companions,
+		"library_view":       libraryView,
+		"rating_scale":       ratingScale,
+		"thumbnail_percent":  thumbPercent,
+		"watched_percent":    watchPercent,
+		"random_no_repeat":   randomNoRepeat,
+		"random_unwatched":   randomUnwatched,
+		"prepare_hours":      prepareHours,
+
+		"autoplay_pool_tags":          strings.Join(poolTags, ","),
+		"autoplay_pool_unwatched":     poolUnwatched,
+		"autoplay_pool_min_rating":    poolMinRating,
+		"autoplay_pool_exclude_shows": poolExcludeShows,
+
+		"report_hour":        reportHour,
+		"stream_limit_mbps":  streamLimit,
+		"streams_per_client": streamsPerClient,
+
+		"ytdlp_allowed_domains": strings.Join(ytdlpDomains, ","),
+
+		"library_budget_bytes": strconv.FormatInt(libraryBudget, 10),
+		"library_cap_bytes":    strconv.FormatInt(libraryCap, 10),
+		"budget_webhook_url":   webhook,
+		"airing_webhook_url":   airingWebhook,
+		"events_webhook_url":   eventsWebhook,
 	}
 	// Only overwrite the TMDB key if a new value was provided.
 	if key := strings.TrimSpace(r.FormValue("tmdb_api_key")); key != "" {
 		pairs["tmdb_api_key"] = key
 	}
 	if err := s.store.SaveSettings(r.Context(), pairs); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
+	s.checkBudgets(r.Context())
 	s.handleGetSettings(w, r)
 }
@@ -511,6 +511,25 @@ func TestHandleSaveSettings_AutoplayOn(t *testing.T) {
 	}
 }
 
+func TestHandleSaveSettings_CardFields(t *testing.T) {
+	srv := newTestServer(t)
+	form := url.Values{"card_fields": {"tags", "bogus", "duration"}}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/settings", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	// Unknown keys are dropped and the canonical display order is kept.
+	if got, _ := srv.store.GetSetting(context.Background(), "card_fields"); got != "duration,tags" {
+		t.Errorf("card_fields = %q, want %q", got, "duration,tags")
+	}
+	if !strings.Contains(rec.Body.String(), `value="duration" checked`) {
+		t.Error("expected duration checkbox to be checked in re-rendered settings")
+	}
+}
+
 func TestHandleSaveSettings_WithTmdbKey(t *testing.T) {
 	srv := newTestServer(t)
 	form := url.Values{"tmdb_api_key": {"mykey123"}}
@@ -558,6 +577,34 @@ func TestHandleListTags_WithTags(t *testing.T) {
 	}
 }
 
+func TestHandleSuggestTags(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	a, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	vacation, _ := srv.store.UpsertTag(ctx, "vacation")
+	vacations, _ := srv.store.UpsertTag(ctx, "Vacations")
+	srv.store.UpsertTag(ctx, "work")            //nolint:errcheck
+	srv.store.TagVideo(ctx, a.ID, vacation.ID)  //nolint:errcheck
+	srv.store.TagVideo(ctx, b.ID, vacation.ID)  //nolint:errcheck
+	srv.store.TagVideo(ctx, a.ID, vacations.ID) //nolint:errcheck
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tags/suggest?q=VACA", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	i, j := strings.Index(body, `value="vacation"`), strings.Index(body, `value="Vacations"`)
+	if i < 0 || j < 0 || i > j {
+		t.Errorf("expected vacation (2 videos) before Vacations (1 video), got %q", body)
+	}
+	if strings.Contains(body, "work") {
+		t.Errorf("non-matching tag suggested: %q", body)
+	}
+}
+
 func TestParseFilenameHints_ExtractsSeasonEpisode(t *testing.T) {
 	cases := []struct {
 		filename string
@@ -0,0 +1,526 @@
+// handlers_playback.go – client capability negotiation and on-the-fly streams.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/store"
+	"github.com/maxgarvey/video_manger/transcode"
+)
+
+// clientCaps is the body of POST /playback/decide. Codec and container names
+// use ffprobe spelling ("h264", "hevc", "aac", "mp4", "matroska", "webm").
+type clientCaps struct {
+	VideoID    int64    `json:"video_id"`
+	Codecs     []string `json:"codecs"`
+	Containers []string `json:"containers"`
+	MaxHeight  int      `json:"max_height"` // 0 = no limit
+	MaxKbps    int      `json:"max_kbps"`   // video bitrate cap; 0 = no limit
+}
+
+// Playback methods, cheapest first.
+const (
+	playDirect    = "direct"
+	playRemux     = "remux"
+	playTranscode = "transcode"
+	playPrepared  = "prepared" // a copy converted ahead of time; see prepared_copies.go
+)
+
+// playbackDecision is the response of POST /playback/decide.
+type playbackDecision struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	HLSURL string `json:"hls_url,omitempty"` // seekable alternative for transcodes
+	Reason string `json:"reason,omitempty"`
+	// AudioTrack is set when the URLs play a track other than the file's
+	// default, such as one in the viewer's preferred language.
+	AudioTrack *int `json:"audio_track,omitempty"`
+	// SubtitleURL is the WebVTT of the subtitle in the viewer's preferred
+	// language, if the video has one; see language_prefs.go.
+	SubtitleURL      string `json:"subtitle_url,omitempty"`
+	SubtitleLanguage string `json:"subtitle_language,omitempty"`
+}
+
+// signed returns d with its URLs passed through sign (see streamSigner).
+func (d playbackDecision) signed(sign func(string) string) playbackDecision {
+	d.URL = sign(d.URL)
+	if d.HLSURL != "" {
+		d.HLSURL = sign(d.HLSURL)
+	}
+	return d
+}
+
+// containerFromExt maps a file extension to the container name clients
+// report, folding aliases (.m4v, .mov) onto their common family.
+func containerFromExt(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".mp4", ".m4v", ".mov":
+		return "mp4"
+	case ".mkv":
+		return "matroska"
+	case ".webm":
+		return "webm"
+	case ".avi":
+		return "avi"
+	case ".ts", ".m2ts":
+		return "mpegts"
+	default:
+		return strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+}
+
+// playingStreams returns the streams a player uses by default: the first
+// video stream and the audio stream flagged default, or else the first one.
+// Other audio tracks, such as a commentary, do not affect how a file plays.
+// Either result is nil when the file has no stream of that type.
+func playingStreams(streams []metadata.Stream) (video, audio *metadata.Stream) {
+	for i := range streams {
+		st := &streams[i]
+		switch st.CodecType {
+		case "video":
+			if video == nil {
+				video = st
+			}
+		case "audio":
+			if audio == nil || (st.Default && !audio.Default) {
+				audio = st
+			}
+		}
+	}
+	return video, audio
+}
+
+// decidePlayback picks the cheapest method that the client can play.
+// streams may be nil when ffprobe is unavailable; in that case only the
+// container is checked and the codecs are assumed to be playable.
+func decidePlayback(caps clientCaps, container string, streams []metadata.Stream) (method, reason string) {
+	video, audio := playingStreams(streams)
+	if video != nil && !slices.Contains(caps.Codecs, video.CodecName) {
+		return playTranscode, fmt.Sprintf("codec %s not supported", video.CodecName)
+	}
+	if audio != nil && !slices.Contains(caps.Codecs, audio.CodecName) {
+		return playTranscode, fmt.Sprintf("codec %s not supported", audio.CodecName)
+	}
+	if video != nil && caps.MaxHeight > 0 && video.Height > caps.MaxHeight {
+		return playTranscode, fmt.Sprintf("height %d exceeds %d", video.Height, caps.MaxHeight)
+	}
+	if !slices.Contains(caps.Containers, container) {
+		return playRemux, fmt.Sprintf("container %s not supported", container)
+	}
+	return playDirect, ""
+}
+
+// handlePlaybackDecide answers POST /playback/decide with the best way for
+// the calling client to play a video: the raw file, a container remux, or a
+// full transcode capped at the client's maximum height.
+func (s *server) handlePlaybackDecide(w http.ResponseWriter, r *http.Request) {
+	var caps clientCaps
+	if err := json.NewDecoder(r.Body).Decode(&caps); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if caps.VideoID <= 0 {
+		http.Error(w, "video_id is required", http.StatusBadRequest)
+		return
+	}
+	for i := range caps.Codecs {
+		caps.Codecs[i] = strings.ToLower(caps.Codecs[i])
+	}
+	for i := range caps.Containers {
+		caps.Containers[i] = strings.ToLower(caps.Containers[i])
+	}
+	video, err := s.store.GetVideo(r.Context(), caps.VideoID)
+	if err != nil {
+		http.Error(w, "video not found", http.StatusNotFound)
+		return
+	}
+	streams := s.cachedStreams(r.Context(), video)
+	method, reason := decidePlayback(caps, containerFromExt(video.Filename), streams)
+	method, reason = capBitrate(method, reason, video, caps.MaxKbps)
+	dec := newPlaybackDecision(video.ID, method, reason, caps.MaxHeight, caps.MaxKbps)
+	dec = s.applyLanguagePrefs(r, video, dec)
+	writeJSON(w, dec.signed(s.streamSigner(r.Context())))
+}
+
+// averageKbps estimates a video's overall bitrate from its size and length;
+// 0 when either is unknown.
+func averageKbps(v store.Video) int {
+	if v.FileSize <= 0 || v.DurationS <= 0 {
+		return 0
+	}
+	return int(float64(v.FileSize) * 8 / v.DurationS / 1000)
+}
+
+// capBitrate turns method into a transcode when the video's average bitrate
+// is over maxKbps (0 = no cap), which only a re-encode can bring down.
+func capBitrate(method, reason string, v store.Video, maxKbps int) (string, string) {
+	if method == playTranscode || maxKbps <= 0 {
+		return method, reason
+	}
+	if kbps := averageKbps(v); kbps > maxKbps {
+		return playTranscode, fmt.Sprintf("bitrate %d kbps exceeds %d", kbps, maxKbps)
+	}
+	return method, reason
+}
+
+// newPlaybackDecision fills in the URLs that serve a video by method; a
+// transcode is capped at maxHeight and maxKbps when they are set.
+func newPlaybackDecision(videoID int64, method, reason string, maxHeight, maxKbps int) playbackDecision {
+	id := strconv.FormatInt(videoID, 10)
+	dec := playbackDecision{Method: method, Reason: reason}
+	switch method {
+	case playDirect:
+		dec.URL = "/video/" + id
+	case playRemux:
+		dec.URL = "/videos/" + id + "/stream?remux=1"
+	case playPrepared:
+		dec.URL = "/videos/" + id + "/prepared"
+	default:
+		dec.URL = "/videos/" + id + "/stream"
+		dec.HLSURL = "/videos/" + id + "/hls.m3u8"
+		q := url.Values{}
+		if maxHeight > 0 {
+			q.Set("max_height", strconv.Itoa(maxHeight))
+		}
+		if maxKbps > 0 {
+			q.Set("max_kbps", strconv.Itoa(maxKbps))
+		}
+		if len(q) > 0 {
+			dec.URL += "?" + q.Encode()
+			dec.HLSURL += "?" + q.Encode()
+		}
+	}
+	return dec
+}
+
+// browserCaps is what the web player can count on every supported browser
+// to play natively. Used to pick the player's source without a round trip
+// through POST /playback/decide.
+var browserCaps = clientCaps{
+	Codecs:     []string{"h264", "vp8", "vp9", "av1", "aac", "mp3", "opus", "vorbis", "flac"},
+	Containers: []string{"mp4", "webm"},
+}
+
+// codecsFromStreams picks the codecs of the streams that play by default and
+// lists the languages of the audio and subtitle tracks.
+func codecsFromStreams(streams []metadata.Stream) store.VideoCodecs {
+	var c store.VideoCodecs
+	video, audio := playingStreams(streams)
+	if video != nil {
+		c.Video = video.CodecName
+	}
+	if audio != nil {
+		c.Audio = audio.CodecName
+	}
+	var audioLangs, subLangs []string
+	for i := range streams {
+		st := &streams[i]
+		lang := st.Language
+		if lang == "und" {
+			lang = ""
+		}
+		switch st.CodecType {
+		case "audio":
+			if st == audio {
+				c.DefaultAudio = len(audioLangs)
+			}
+			audioLangs = append(audioLangs, lang)
+		case "subtitle":
+			if !slices.Contains(textSubtitleCodecs, st.CodecName) {
+				lang = ""
+			}
+			subLangs = append(subLangs, lang)
+		}
+	}
+	c.AudioLanguages = strings.Join(audioLangs, ",")
+	c.SubtitleLanguages = strings.Join(subLangs, ",")
+	return c
+}
+
+// cachedCodecs returns the video's cached codecs and track languages,
+// probing the file and caching the result the first time. Zero when they
+// cannot be determined.
+func (s *server) cachedCodecs(ctx context.Context, video store.Video) store.VideoCodecs {
+	c, err := s.store.GetVideoCodecs(ctx, video.ID)
+	if err != nil {
+		slog.Warn("playback: load codecs failed", "video_id", video.ID, "err", err)
+	}
+	if c == (store.VideoCodecs{}) {
+		streams, err := metadata.ReadStreams(video.FilePath())
+		if err != nil || len(streams) == 0 {
+			return store.VideoCodecs{}
+		}
+		c = codecsFromStreams(streams)
+		if err := s.store.SetVideoCodecs(ctx, video.ID, c); err != nil {
+			slog.Warn("playback: cache codecs failed", "video_id", video.ID, "err", err)
+		}
+	}
+	return c
+}
+
+// cachedStreams returns the video's codecs as streams for decidePlayback.
+// The video stream carries the height recorded at scan time. Returns nil
+// when the codecs cannot be determined.
+func (s *server) cachedStreams(ctx context.Context, video store.Video) []metadata.Stream {
+	c := s.cachedCodecs(ctx, video)
+	var streams []metadata.Stream
+	if c.Video != "" {
+		streams = append(streams, metadata.Stream{CodecType: "video", CodecName: c.Video, Height: video.Height})
+	}
+	if c.Audio != "" {
+		streams = append(streams, metadata.Stream{CodecType: "audio", CodecName: c.Audio})
+	}
+	return streams
+}
+
+// playerPlayback decides how the web player should load a video within the
+// device's quality preset: the raw file when the browser can play it, else
+// its prepared copy when there is one and no preset caps quality, otherwise
+// a remux or transcode stream. Without ffmpeg there is nothing to convert
+// with, so the raw file is served regardless.
+func (s *server) playerPlayback(ctx context.Context, video store.Video, preset store.QualityPreset) playbackDecision {
+	caps := browserCaps
+	caps.MaxHeight = preset.MaxHeight
+	method, reason := decidePlayback(caps, containerFromExt(video.Filename), s.cachedStreams(ctx, video))
+	method, reason = capBitrate(method, reason, video, preset.BitrateK)
+	if method != playDirect {
+		if _, ok := s.preparedCopy(video); ok && preset.MaxHeight == 0 && preset.BitrateK == 0 {
+			return newPlaybackDecision(video.ID, playPrepared, "", 0, 0)
+		}
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			method, reason = playDirect, ""
+		}
+	}
+	return newPlaybackDecision(video.ID, method, reason, preset.MaxHeight, preset.BitrateK)
+}
+
+// handleStreamVideo serves GET /videos/{id}/stream: a fragmented MP4 produced
+// by ffmpeg on the fly. ?remux=1 copies streams; otherwise the video is
+// re-encoded to H.264/AAC, optionally scaled down to ?max_height and capped
+// at ?max_kbps. ?audio=N
+// plays the file's N-th audio track (from 0) instead of ffmpeg's pick.
+func (s *server) handleStreamVideo(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		http.Error(w, "ffmpeg is not installed — transcoding is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	opts := transcode.StreamOptions{Remux: r.URL.Query().Get("remux") == "1"}
+	if opts.AudioTrack, ok = audioTrackOption(r); !ok {
+		http.Error(w, "invalid audio", http.StatusBadRequest)
+		return
+	}
+	if v := r.URL.Query().Get("max_height"); v != "" {
+		h, err := strconv.Atoi(v)
+		if err != nil || h < 0 {
+			http.Error(w, "invalid max_height", http.StatusBadRequest)
+			return
+		}
+		opts.MaxHeight = h
+	}
+	if v := r.URL.Query().Get("max_kbps"); v != "" {
+		k, err := strconv.Atoi(v)
+		if err != nil || k < 0 {
+			http.Error(w, "invalid max_kbps", http.StatusBadRequest)
+			return
+		}
+		opts.MaxBitrateK = k
+	}
+	w.Header().Set("Content-Type", "video/mp4")
+	if err := transcode.Stream(r.Context(), video.FilePath(), opts, w); err != nil && r.Context().Err() == nil {
+		slog.Warn("stream failed", "video_id", video.ID, "err", err)
+	}
+}
+
+// handleStreamAudio serves GET /videos/{id}/audio: just the sound, encoded
+// on the fly, for listening to talks and concerts over a slow link.
+// ?format=aac|mp3 (default aac), ?bitrate=KBPS (default audioStreamKbps),
+// ?audio=N picks a track as for /stream, and ?t=SECS starts part-way in.
+func (s *server) handleStreamAudio(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		http.Error(w, "ffmpeg is not installed — audio streams are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	opts := transcode.AudioOptions{Format: q.Get("format"), BitrateK: audioStreamKbps}
+	contentType := "audio/aac"
+	switch opts.Format {
+	case "", "aac":
+		opts.Format = "aac"
+	case "mp3":
+		contentType = "audio/mpeg"
+	default:
+		http.Error(w, "format must be aac or mp3", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("bitrate"); v != "" {
+		kbps, err := strconv.Atoi(v)
+		if err != nil || kbps < 32 || kbps > 320 {
+			http.Error(w, "bitrate must be between 32 and 320", http.StatusBadRequest)
+			return
+		}
+		opts.BitrateK = kbps
+	}
+	if opts.AudioTrack, ok = audioTrackOption(r); !ok {
+		http.Error(w, "invalid audio", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("t"); v != "" {
+		start, err := strconv.ParseFloat(v, 64)
+		if err != nil || start < 0 {
+			http.Error(w, "invalid t", http.StatusBadRequest)
+			return
+		}
+		opts.StartSecs = start
+	}
+	w.Header().Set("Content-Type", contentType)
+	if err := transcode.Audio(r.Context(), video.FilePath(), opts, w); err != nil && r.Context().Err() == nil {
+		slog.Warn("audio stream failed", "video_id", video.ID, "err", err)
+	}
+}
+
+// audioTrackOption reads ?audio=N, a track from metadata.AudioTracks, as a
+// transcode AudioTrack (counting from 1; 0 when absent).
+func audioTrackOption(r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("audio")
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n + 1, true
+}
+
+// audioChoice is an entry of the player's audio track menu.
+type audioChoice struct {
+	Track int
+	Label string
+	URL   string // stream URL that plays this track
+	// Selected marks the track the player starts with, when it is not the
+	// file's default.
+	Selected bool
+}
+
+// audioTrackLabel names a track for menus, e.g. "ger · ac3 5.1".
+func audioTrackLabel(t metadata.AudioTrack) string {
+	name := t.Title
+	if name == "" {
+		name = t.Language
+	}
+	if name == "" {
+		name = fmt.Sprintf("Track %d", t.Track+1)
+	}
+	parts := []string{name}
+	if t.Codec != "" {
+		parts = append(parts, t.Codec)
+	}
+	switch t.Channels {
+	case 0:
+	case 1:
+		parts = append(parts, "mono")
+	case 2:
+		parts = append(parts, "stereo")
+	case 6:
+		parts = append(parts, "5.1")
+	case 8:
+		parts = append(parts, "7.1")
+	default:
+		parts = append(parts, fmt.Sprintf("%dch", t.Channels))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// withAudioTrack returns dec playing the file's audio track (from 0). A
+// track cannot be picked from the raw file, so direct play switches to a
+// remux; the prepared copy holds only the default track, so it switches to
+// a transcode. Remux and transcode streams just add the track.
+func withAudioTrack(dec playbackDecision, videoID int64, track int) playbackDecision {
+	switch dec.Method {
+	case playDirect:
+		dec = newPlaybackDecision(videoID, playRemux, "audio track "+strconv.Itoa(track+1), 0, 0)
+	case playPrepared:
+		dec = newPlaybackDecision(videoID, playTranscode, "audio track "+strconv.Itoa(track+1), 0, 0)
+	}
+	add := func(u string) string {
+		sep := "?"
+		if strings.Contains(u, "?") {
+			sep = "&"
+		}
+		return u + sep + "audio=" + strconv.Itoa(track)
+	}
+	dec.URL = add(dec.URL)
+	if dec.HLSURL != "" {
+		dec.HLSURL = add(dec.HLSURL)
+	}
+	dec.AudioTrack = &track
+	return dec
+}
+
+// audioChoices builds the audio menu for a file with several audio tracks;
+// see withAudioTrack.
+func audioChoices(dec playbackDecision, videoID int64, tracks []metadata.AudioTrack) []audioChoice {
+	if len(tracks) < 2 {
+		return nil
+	}
+	choices := make([]audioChoice, len(tracks))
+	for i, t := range tracks {
+		choices[i] = audioChoice{
+			Track: t.Track,
+			Label: audioTrackLabel(t),
+			URL:   withAudioTrack(dec, videoID, t.Track).URL,
+		}
+	}
+	return choices
+}
+
+// handleAPIAudioTracks serves GET /api/videos/{id}/audio-tracks: the file's
+// audio streams, for clients that offer a track menu. Pass a track's number
+// as ?audio= to the stream and HLS endpoints to play it.
+func (s *server) handleAPIAudioTracks(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		http.Error(w, "ffprobe is not installed", http.StatusServiceUnavailable)
+		return
+	}
+	streams, err := metadata.ReadStreams(video.FilePath())
+	if err != nil {
+		http.Error(w, "could not read the file's streams", http.StatusUnprocessableEntity)
+		return
+	}
+	type apiAudioTrack struct {
+		Track    int    `json:"track"`
+		Language string `json:"language,omitempty"`
+		Codec    string `json:"codec"`
+		Channels int    `json:"channels,omitempty"`
+		Title    string `json:"title,omitempty"`
+		Label    string `json:"label"`
+	}
+	out := []apiAudioTrack{}
+	for _, t := range metadata.AudioTracks(streams) {
+		out = append(out, apiAudioTrack{t.Track, t.Language, t.Codec, t.Channels, t.Title, audioTrackLabel(t)})
+	}
+	writeJSON(w, out)
+}
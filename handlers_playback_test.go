@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestDecidePlayback(t *testing.T) {
+	caps := clientCaps{
+		Codecs:     []string{"h264", "aac"},
+		Containers: []string{"mp4"},
+		MaxHeight:  1080,
+	}
+	h264 := metadata.Stream{CodecType: "video", CodecName: "h264", Height: 1080}
+	aac := metadata.Stream{CodecType: "audio", CodecName: "aac"}
+	cases := []struct {
+		name      string
+		container string
+		streams   []metadata.Stream
+		want      string
+	}{
+		{"playable mp4", "mp4", []metadata.Stream{h264, aac}, playDirect},
+		{"playable codecs in mkv", "matroska", []metadata.Stream{h264, aac}, playRemux},
+		{"unsupported codec", "mp4", []metadata.Stream{{CodecType: "video", CodecName: "hevc"}, aac}, playTranscode},
+		{"too tall", "mp4", []metadata.Stream{{CodecType: "video", CodecName: "h264", Height: 2160}, aac}, playTranscode},
+		{"subtitle stream ignored", "mp4", []metadata.Stream{h264, aac, {CodecType: "subtitle", CodecName: "mov_text"}}, playDirect},
+		{"unknown streams", "mp4", nil, playDirect},
+		{"unsupported secondary audio", "mp4", []metadata.Stream{h264, aac, {CodecType: "audio", CodecName: "dts"}}, playDirect},
+		{"unsupported default audio", "mp4", []metadata.Stream{h264, aac, {CodecType: "audio", CodecName: "dts", Default: true}}, playTranscode},
+		{"supported default audio", "mp4", []metadata.Stream{h264, {CodecType: "audio", CodecName: "dts"}, {CodecType: "audio", CodecName: "aac", Default: true}}, playDirect},
+	}
+	for _, c := range cases {
+		if got, _ := decidePlayback(caps, c.container, c.streams); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestContainerFromExt(t *testing.T) {
+	cases := map[string]string{
+		"a.mp4": "mp4", "a.M4V": "mp4", "a.mov": "mp4",
+		"a.mkv": "matroska", "a.webm": "webm", "a.flv": "flv",
+	}
+	for in, want := range cases {
+		if got := containerFromExt(in); got != want {
+			t.Errorf("containerFromExt(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHandlePlaybackDecide_DirectPlay(t *testing.T) {
+	t.Setenv("PATH", "") // no ffprobe: decision is based on the container
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "clip.mp4")
+
+	body := `{"video_id":` + itoa(v.ID) + `,"codecs":["h264","aac"],"containers":["MP4"]}`
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/playback/decide", strings.NewReader(body))
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var dec playbackDecision
+	if err := json.NewDecoder(rec.Body).Decode(&dec); err != nil {
+		t.Fatal(err)
+	}
+	if dec.Method != playDirect || dec.URL != "/video/"+itoa(v.ID) {
+		t.Errorf("unexpected decision: %+v", dec)
+	}
+}
+
+func TestHandlePlaybackDecide_Remux(t *testing.T) {
+	t.Setenv("PATH", "")
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mkv")
+
+	body := `{"video_id":` + itoa(v.ID) + `,"codecs":["h264"],"containers":["mp4"]}`
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/playback/decide", strings.NewReader(body))
+	srv.routes().ServeHTTP(rec, req)
+	var dec playbackDecision
+	if err := json.NewDecoder(rec.Body).Decode(&dec); err != nil {
+		t.Fatal(err)
+	}
+	if dec.Method != playRemux || !strings.Contains(dec.URL, "remux=1") {
+		t.Errorf("unexpected decision: %+v", dec)
+	}
+}
+
+func TestHandlePlaybackDecide_UsesCachedCodecs(t *testing.T) {
+	t.Setenv("PATH", "") // no ffprobe: only the cached codecs are known
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "clip.mp4")
+	if err := srv.store.SetVideoCodecs(ctx, v.ID, store.VideoCodecs{Video: "h264", Audio: "aac"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.store.UpdateVideoResolution(ctx, v.ID, 3840, 2160); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"video_id":` + itoa(v.ID) + `,"codecs":["h264","aac"],"containers":["mp4"],"max_height":1080}`
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/playback/decide", strings.NewReader(body))
+	srv.routes().ServeHTTP(rec, req)
+	var dec playbackDecision
+	if err := json.NewDecoder(rec.Body).Decode(&dec); err != nil {
+		t.Fatal(err)
+	}
+	if dec.Method != playTranscode || !strings.Contains(dec.Reason, "2160") {
+		t.Errorf("unexpected decision: %+v", dec)
+	}
+}
+
+func TestHandlePlaybackDecide_BadRequest(t *testing.T) {
+	srv := newTestServer(t)
+	for _, body := range []string{"not json", `{"codecs":["h264"]}`} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/playback/decide", strings.NewReader(body))
+		srv.routes().ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("body %q: expected 400, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestHandlePlaybackDecide_UnknownVideo(t *testing.T) {
+	srv := newTestServer(t)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/playback/decide", strings.NewReader(`{"video_id":999}`))
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestHandleStreamVideo_NoFFmpeg(t *testing.T) {
+	t.Setenv("PATH", "")
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mkv")
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/videos/"+itoa(v.ID)+"/stream", nil)
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+}
+
+// --- HLS sessions ---
+
+func TestHLSPlaylist(t *testing.T) {
+	pl := hlsPlaylist("abc", 14, 6, func(u string) string { return u })
+	for _, want := range []string{
+		"#EXT-X-TARGETDURATION:6", "#EXT-X-PLAYLIST-TYPE:VOD",
+		"#EXTINF:6.000,\n/hls/abc/0.ts", "#EXTINF:2.000,\n/hls/abc/2.ts", "#EXT-X-ENDLIST",
+	} {
+		if !strings.Contains(pl, want) {
+			t.Errorf("playlist missing %q:\n%s", want, pl)
+		}
+	}
+	if strings.Contains(pl, "/hls/abc/3.ts") {
+		t.Errorf("playlist has too many segments:\n%s", pl)
+	}
+}
+
+func TestHLSShouldRestart(t *testing.T) {
+	cases := []struct {
+		seg, start, frontier int
+		running              bool
+		want                 bool
+	}{
+		{5, 0, 5, true, false},                     // next segment: wait
+		{5 + hlsRestartGap - 1, 0, 5, true, false}, // just ahead: wait
+		{5 + hlsRestartGap, 0, 5, true, true},      // far seek ahead
+		{2, 10, 12, true, true},                    // seek backwards
+		{5, 0, 5, false, true},                     // ffmpeg not running
+	}
+	for _, c := range cases {
+		if got := hlsShouldRestart(c.seg, c.start, c.frontier, c.running); got != c.want {
+			t.Errorf("hlsShouldRestart(%d, %d, %d, %v) = %v, want %v",
+				c.seg, c.start, c.frontier, c.running, got, c.want)
+		}
+	}
+}
+
+// makeHLSStub writes a stub ffmpeg that emits a single segment numbered by
+// -start_number into the output playlist's directory, then exits.
+func makeHLSStub(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	script := `#!/bin/sh
+prev=; start=0
+for a; do [ "$prev" = "-start_number" ] && start=$a; prev=$a; last=$a; done
+echo "seg $start" > "${last%/*}/$start.ts"
+`
+	if err := os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
+
+func TestHLS_SeekRestartsAtRequestedSegment(t *testing.T) {
+	t.Setenv("PATH", makeHLSStub(t))
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mkv")
+	srv.store.UpdateVideoDuration(ctx, v.ID, 600) //nolint:errcheck
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/"+itoa(v.ID)+"/hls.m3u8", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("playlist: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var sessionID string
+	for sid := range srv.hlsSessions {
+		sessionID = sid
+	}
+	if !strings.Contains(rec.Body.String(), "/hls/"+sessionID+"/99.ts") {
+		t.Fatalf("playlist should list all 100 segments:\n%s", rec.Body.String())
+	}
+
+	// Seek far ahead, then back to the start: each must restart the encode
+	// at the requested segment rather than transcoding up to it.
+	for _, seg := range []string{"50", "0"} {
+		rec = httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hls/"+sessionID+"/"+seg+".ts", nil))
+		if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "seg "+seg {
+			t.Fatalf("segment %s: got %d %q", seg, rec.Code, rec.Body.String())
+		}
+	}
+
+	dir := srv.hlsSessions[sessionID].dir
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/hls/"+sessionID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("stop: expected 204, got %d", rec.Code)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("expected session temp dir to be removed")
+	}
+}
+
+func TestHLSSegment_UnknownSession(t *testing.T) {
+	srv := newTestServer(t)
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hls/nope/0.ts", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestPruneHLSSessions_RemovesIdle(t *testing.T) {
+	srv := newTestServer(t)
+	now := time.Now()
+	idleDir, activeDir := t.TempDir(), t.TempDir()
+	srv.hlsSessions["idle"] = &hlsSession{id: "idle", dir: idleDir, lastUsed: now.Add(-2 * hlsIdleTTL)}
+	srv.hlsSessions["active"] = &hlsSession{id: "active", dir: activeDir, lastUsed: now}
+
+	srv.pruneHLSSessions(now, hlsIdleTTL)
+	if _, ok := srv.hlsSessions["idle"]; ok {
+		t.Error("idle session should be pruned")
+	}
+	if _, ok := srv.hlsSessions["active"]; !ok {
+		t.Error("active session should be kept")
+	}
+	if _, err := os.Stat(idleDir); !os.IsNotExist(err) {
+		t.Error("idle session dir should be removed")
+	}
+}
+
+func TestPlayerPlayback(t *testing.T) {
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte("#!/bin/sh\n"), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin)
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	cases := []struct {
+		file   string
+		codecs store.VideoCodecs
+		want   string
+	}{
+		{"a.mp4", store.VideoCodecs{Video: "h264", Audio: "aac"}, playDirect},
+		{"b.mkv", store.VideoCodecs{Video: "h264", Audio: "aac"}, playRemux},
+		{"c.mp4", store.VideoCodecs{Video: "hevc", Audio: "aac"}, playTranscode},
+		{"d.webm", store.VideoCodecs{Video: "vp9", Audio: "opus"}, playDirect},
+		{"e.mkv", store.VideoCodecs{Video: "h264", Audio: "ac3"}, playTranscode},
+	}
+	for _, c := range cases {
+		v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, c.file)
+		srv.store.SetVideoCodecs(ctx, v.ID, c.codecs) //nolint:errcheck
+		if got := srv.playerPlayback(ctx, v, store.QualityPreset{}); got.Method != c.want {
+			t.Errorf("%s (%+v): method = %s, want %s", c.file, c.codecs, got.Method, c.want)
+		}
+	}
+}
+
+func TestPlayerPlayback_NoFFmpegServesRawFile(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mkv")
+	srv.store.SetVideoCodecs(ctx, v.ID, store.VideoCodecs{Video: "hevc"}) //nolint:errcheck
+
+	if got := srv.playerPlayback(ctx, v, store.QualityPreset{}); got.Method != playDirect || got.URL != "/video/"+itoa(v.ID) {
+		t.Errorf("without ffmpeg the raw file is the only option, got %+v", got)
+	}
+}
+
+func TestHandlePlayer_UsesTranscodeSourceForUnsupportedCodec(t *testing.T) {
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte("#!/bin/sh\n"), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "film.mkv"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mkv")
+	srv.store.SetVideoCodecs(ctx, v.ID, store.VideoCodecs{Video: "hevc", Audio: "dts"}) //nolint:errcheck
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/play/"+itoa(v.ID), nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, `<source src="/videos/`+itoa(v.ID)+`/stream">`) {
+		t.Error("expected the player to use the transcode stream as its source")
+	}
+	if !strings.Contains(body, `data-playback="transcode"`) {
+		t.Error("expected the playback decision to be exposed on the video element")
+	}
+}
+
+// --- audio tracks ---
+
+func TestAudioChoices(t *testing.T) {
+	tracks := []metadata.AudioTrack{
+		{Track: 0, Language: "ger", Codec: "ac3", Channels: 6},
+		{Track: 1, Language: "eng", Codec: "aac", Channels: 2, Title: "Original"},
+	}
+	direct := audioChoices(newPlaybackDecision(7, playDirect, "", 0, 0), 7, tracks)
+	if len(direct) != 2 || direct[0].URL != "/videos/7/stream?remux=1&audio=0" || direct[0].Label != "ger · ac3 · 5.1" {
+		t.Errorf("direct play should switch to a remux per track, got %+v", direct)
+	}
+	trans := audioChoices(newPlaybackDecision(7, playTranscode, "", 0, 0), 7, tracks)
+	if trans[1].URL != "/videos/7/stream?audio=1" || trans[1].Label != "Original · aac · stereo" {
+		t.Errorf("unexpected transcode choice %+v", trans[1])
+	}
+	if got := audioChoices(newPlaybackDecision(7, playDirect, "", 0, 0), 7, tracks[:1]); got != nil {
+		t.Errorf("a single track needs no menu, got %+v", got)
+	}
+}
+
+func TestHandleStreamVideo_InvalidAudio(t *testing.T) {
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte("#!/bin/sh\n"), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin)
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mkv")
+
+	for _, path := range []string{"/stream?audio=x", "/hls.m3u8?audio=-1"} {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/"+itoa(v.ID)+path, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestHandleStreamAudio(t *testing.T) {
+	// The stub ffmpeg "streams" its own arguments.
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte("#!/bin/sh\necho \"$@\"\n"), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin)
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "concert.mkv")
+	base := "/videos/" + itoa(v.ID) + "/audio"
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	rec := get(base)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "audio/aac" ||
+		!strings.Contains(rec.Body.String(), "-vn") || !strings.Contains(rec.Body.String(), "-b:a 96k -f adts") {
+		t.Errorf("default: got %d %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	rec = get(base + "?format=mp3&bitrate=64&t=30&audio=1")
+	if rec.Header().Get("Content-Type") != "audio/mpeg" ||
+		!strings.Contains(rec.Body.String(), "-ss 30.000") || !strings.Contains(rec.Body.String(), "-map 0:a:1") ||
+		!strings.Contains(rec.Body.String(), "-b:a 64k -f mp3") {
+		t.Errorf("mp3: got %q: %s", rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	for _, q := range []string{"?format=flac", "?bitrate=8", "?t=-1", "?audio=x"} {
+		if rec := get(base + q); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, rec.Code)
+		}
+	}
+}
+
+func TestHandleAPIAudioTracks(t *testing.T) {
+	bin := t.TempDir()
+	probe := `#!/bin/sh
+echo '{"streams":[{"index":0,"codec_type":"video","codec_name":"h264"},{"index":1,"codec_type":"audio","codec_name":"ac3","channels":6,"tags":{"language":"ger"}},{"index":2,"codec_type":"audio","codec_name":"aac","channels":2,"tags":{"language":"eng"}}]}'
+`
+	os.WriteFile(filepath.Join(bin, "ffprobe"), []byte(probe), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin)
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mkv")
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/videos/"+itoa(v.ID)+"/audio-tracks", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var got []struct {
+		Track    int    `json:"track"`
+		Language string `json:"language"`
+		Codec    string `json:"codec"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &got) //nolint:errcheck
+	if len(got) != 2 || got[1].Track != 1 || got[1].Language != "eng" || got[0].Codec != "ac3" {
+		t.Errorf("unexpected tracks %+v", got)
+	}
+}
@@ -0,0 +1,161 @@
+// handlers_preview_clips.go – short motion previews for the library list.
+//
+// GET /videos/{id}/preview – a silent, low-resolution MP4 montage
+//
+// A preview is previewClipSegments pieces of previewClipSegSecs each, taken
+// at evenly spaced points through the video and joined. The first request
+// queues generation in the background and answers 202 Accepted; once ready
+// the clip is served from previewCacheDir, keyed like storyboards by the
+// file's size and modification time. Runs share the convert slots.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/store"
+	"github.com/maxgarvey/video_manger/transcode"
+)
+
+// previewCacheDir holds generated preview clips, one per video and file
+// version. main moves it beside the database.
+var previewCacheDir = filepath.Join(os.TempDir(), "video_manger-previews")
+
+// previewClipPath is where v's preview lives for the file's current contents.
+func previewClipPath(v store.Video, fi os.FileInfo) string {
+	return filepath.Join(previewCacheDir,
+		fmt.Sprintf("%d-%x-%x.mp4", v.ID, fi.Size(), fi.ModTime().UnixNano()))
+}
+
+// previewClipStarts spreads n segments of segSecs evenly through a video of
+// durationS seconds, centring each in its share. A video too short for that
+// is previewed from the start in one piece.
+func previewClipStarts(durationS float64, n int, segSecs float64) []float64 {
+	if durationS <= float64(n)*segSecs {
+		return []float64{0}
+	}
+	starts := make([]float64, n)
+	for i := range starts {
+		starts[i] = max(0, durationS*(float64(i)+0.5)/float64(n)-segSecs/2)
+	}
+	return starts
+}
+
+// previewClip returns v's clip path and its status, "ready", "running",
+// "failed" or "unavailable", queueing a run when there is none yet. A failed
+// run is retried after previewClipRetry.
+func (s *server) previewClip(v store.Video) (path string, status string) {
+	fi, err := s.blobs.Stat(v.FilePath())
+	if err != nil {
+		return "", "unavailable"
+	}
+	path = previewClipPath(v, fi)
+	if _, err := os.Stat(path); err == nil {
+		return path, "ready"
+	}
+	s.previewMu.Lock()
+	defer s.previewMu.Unlock()
+	if job, ok := s.previewJobs[path]; ok {
+		select {
+		case <-job.done:
+			if time.Since(job.finished) < previewClipRetry {
+				return path, "failed"
+			}
+		default:
+			return path, "running"
+		}
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return path, "unavailable"
+	}
+	if s.previewJobs == nil {
+		s.previewJobs = make(map[string]*storyboardJob)
+	}
+	job := &storyboardJob{done: make(chan struct{})}
+	s.previewJobs[path] = job
+	go s.runPreviewClip(v, path, job)
+	return path, "running"
+}
+
+// runPreviewClip generates v's preview at dst via a temp file, so a clip at
+// dst is always complete.
+func (s *server) runPreviewClip(v store.Video, dst string, job *storyboardJob) {
+	err := func() error {
+		s.convertSem <- struct{}{}
+		defer func() { <-s.convertSem }()
+
+		duration := v.DurationS
+		if duration <= 0 {
+			duration = metadata.ReadDuration(v.FilePath())
+		}
+		if duration <= 0 {
+			return fmt.Errorf("unknown duration")
+		}
+		if err := os.MkdirAll(previewCacheDir, 0755); err != nil {
+			return err
+		}
+		tmp := filepath.Join(previewCacheDir, "."+newToken()+".mp4")
+		defer os.Remove(tmp) //nolint:errcheck
+		starts := previewClipStarts(duration, previewClipSegments, previewClipSegSecs)
+		segSecs := previewClipSegSecs
+		if len(starts) == 1 {
+			segSecs = min(duration, previewClipSegments*previewClipSegSecs)
+		}
+		if err := transcode.PreviewClip(context.Background(), v.FilePath(), tmp, starts, segSecs, previewClipWidth); err != nil {
+			return err
+		}
+		prunePreviewClips(v)
+		return os.Rename(tmp, dst)
+	}()
+
+	s.previewMu.Lock()
+	job.err, job.finished = err, time.Now()
+	if err == nil {
+		delete(s.previewJobs, dst)
+	} else {
+		slog.Warn("preview clip generation failed", "path", v.FilePath(), "err", err)
+	}
+	close(job.done)
+	s.previewMu.Unlock()
+}
+
+// prunePreviewClips removes v's previews of earlier versions of the file.
+func prunePreviewClips(v store.Video) {
+	old, _ := filepath.Glob(filepath.Join(previewCacheDir, strconv.FormatInt(v.ID, 10)+"-*.mp4"))
+	for _, p := range old {
+		os.Remove(p) //nolint:errcheck
+	}
+}
+
+func (s *server) handleVideoPreview(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	path, status := s.previewClip(video)
+	switch status {
+	case "ready":
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		w.Header().Set("Content-Type", "video/mp4")
+		http.ServeFile(w, r, path)
+	case "running":
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "preview is being generated", http.StatusAccepted)
+	case "failed":
+		http.Error(w, "preview generation failed, see the server log", http.StatusNotFound)
+	default:
+		if path == "" {
+			http.Error(w, "video file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "ffmpeg is not installed — previews are unavailable", http.StatusServiceUnavailable)
+	}
+}
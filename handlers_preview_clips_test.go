@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPreviewClipStarts(t *testing.T) {
+	if got := previewClipStarts(100, 5, 3); !slices.Equal(got, []float64{8.5, 28.5, 48.5, 68.5, 88.5}) {
+		t.Errorf("100s: starts = %v", got)
+	}
+	if got := previewClipStarts(12, 5, 3); !slices.Equal(got, []float64{0}) {
+		t.Errorf("12s: starts = %v, want one piece from the start", got)
+	}
+}
+
+// writePreviewStub installs an ffmpeg that writes a placeholder to its last
+// argument, the output file.
+func writePreviewStub(t *testing.T) {
+	t.Helper()
+	bin := t.TempDir()
+	script := "#!/bin/sh\nfor last; do true; done\necho clip > \"$last\"\n"
+	os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(script), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	orig := previewCacheDir
+	previewCacheDir = t.TempDir()
+	t.Cleanup(func() { previewCacheDir = orig })
+}
+
+func TestHandleVideoPreview_GeneratesInBackground(t *testing.T) {
+	writePreviewStub(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	srv.store.UpdateVideoDuration(ctx, v.ID, 600) //nolint:errcheck
+	path := "/videos/" + itoa(v.ID) + "/preview"
+
+	rec := doAs(srv, nil, http.MethodGet, path, nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("first request: expected 202, got %d", rec.Code)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for rec.Code == http.StatusAccepted && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rec = doAs(srv, nil, http.MethodGet, path, nil)
+	}
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "video/mp4" || rec.Body.String() != "clip\n" {
+		t.Errorf("expected the clip, got %d %q: %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	if rec := doAs(srv, nil, http.MethodGet, "/videos/"+itoa(v.ID+1)+"/preview", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown video: expected 404, got %d", rec.Code)
+	}
+}
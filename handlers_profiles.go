@@ -0,0 +1,199 @@
+// handlers_profiles.go – viewer profiles and their landing filters.
+//
+// A profile is chosen per device and remembered in the "profile" cookie, so a
+// kids' tablet can open straight to its own corner of the library.
+//
+// GET    /profiles              – profile manager fragment (settings panel)
+// POST   /profiles              – create a profile
+// POST   /profiles/active       – select the device's profile (0 = none)
+// PUT    /profiles/{id}/landing – set the profile's landing tag and sort
+// DELETE /profiles/{id}         – delete a profile
+//
+// Daily watch-time allowances are in watch_quota.go.
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+const profileCookie = "profile"
+
+// landingSorts lists the sort orders a profile can land on, in display order.
+// The empty key keeps the global video_sort setting.
+var landingSorts = append([]struct{ Key, Label string }{{"", "Default"}}, videoSorts...)
+
+func validLandingSort(sort string) bool {
+	return sort == "" || validVideoSort(sort)
+}
+
+// activeProfile returns the profile selected by the request's cookie. ok is
+// false when no profile is selected or it has since been deleted.
+func (s *server) activeProfile(r *http.Request) (store.Profile, bool) {
+	c, err := r.Cookie(profileCookie)
+	if err != nil {
+		return store.Profile{}, false
+	}
+	id, err := strconv.ParseInt(c.Value, 10, 64)
+	if err != nil || id <= 0 {
+		return store.Profile{}, false
+	}
+	p, err := s.store.GetProfile(r.Context(), id)
+	if err != nil {
+		return store.Profile{}, false
+	}
+	return p, true
+}
+
+func (s *server) setProfileCookie(w http.ResponseWriter, id int64) {
+	c := &http.Cookie{
+		Name:     profileCookie,
+		Value:    strconv.FormatInt(id, 10),
+		Path:     "/",
+		MaxAge:   int(profileCookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   s.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if id == 0 {
+		c.Value, c.MaxAge = "", -1
+	}
+	http.SetCookie(w, c)
+}
+
+// profileLocked reports whether the device must stay on profile p: p has a
+// daily allowance and the request is not from an admin.
+func (s *server) profileLocked(r *http.Request, p store.Profile) bool {
+	return p.DailyMinutes > 0 && s.requestUser(r).Role != store.RoleAdmin
+}
+
+// renderProfiles renders the profile manager with activeID as the selected
+// profile; callers that just changed the selection pass the new ID because
+// the request still carries the old cookie.
+func (s *server) renderProfiles(w http.ResponseWriter, r *http.Request, activeID int64) {
+	profiles, err := s.store.ListProfiles(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	tags, err := s.store.ListTags(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	var active store.Profile
+	for _, p := range profiles {
+		if p.ID == activeID {
+			active = p
+		}
+	}
+	var quota watchQuota
+	if active.ID != 0 {
+		if quota, err = s.watchQuota(r.Context(), active); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+	render(w, "profiles.html", struct {
+		Profiles []store.Profile
+		Active   store.Profile
+		Locked   bool
+		Quota    watchQuota
+		Tags     []store.Tag
+		Sorts    []struct{ Key, Label string }
+	}{profiles, active, s.profileLocked(r, active), quota, tags, landingSorts})
+}
+
+func (s *server) handleListProfiles(w http.ResponseWriter, r *http.Request) {
+	p, _ := s.activeProfile(r)
+	s.renderProfiles(w, r, p.ID)
+}
+
+func (s *server) handleCreateProfile(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Error(w, "name required", http.StatusBadRequest)
+		return
+	}
+	p, err := s.store.CreateProfile(r.Context(), name)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	// A device creating its first profile is most likely setting itself up.
+	active, ok := s.activeProfile(r)
+	if !ok {
+		s.setProfileCookie(w, p.ID)
+		active = p
+	}
+	s.renderProfiles(w, r, active.ID)
+}
+
+func (s *server) handleSelectProfile(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.FormValue("profile_id"), 10, 64)
+	if err != nil || id < 0 {
+		http.Error(w, "invalid profile_id", http.StatusBadRequest)
+		return
+	}
+	if id != 0 {
+		if _, err := s.store.GetProfile(r.Context(), id); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	// Leaving a profile with a daily allowance would get round it.
+	if active, ok := s.activeProfile(r); ok && s.profileLocked(r, active) && id != active.ID {
+		http.Error(w, "only an admin can switch this device away from "+active.Name, http.StatusForbidden)
+		return
+	}
+	s.setProfileCookie(w, id)
+	s.renderProfiles(w, r, id)
+}
+
+func (s *server) handleSetProfileLanding(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	var tagID int64
+	if v := r.FormValue("tag_id"); v != "" {
+		var err error
+		if tagID, err = strconv.ParseInt(v, 10, 64); err != nil || tagID < 0 {
+			http.Error(w, "invalid tag_id", http.StatusBadRequest)
+			return
+		}
+	}
+	sort := r.FormValue("sort")
+	if !validLandingSort(sort) {
+		http.Error(w, "invalid sort", http.StatusBadRequest)
+		return
+	}
+	if err := s.store.SetProfileLanding(r.Context(), id, tagID, sort); err != nil {
+		slog.Warn("set profile landing failed", "profile", id, "err", err)
+		http.Error(w, "could not save landing view", http.StatusBadRequest)
+		return
+	}
+	active, _ := s.activeProfile(r)
+	s.renderProfiles(w, r, active.ID)
+}
+
+func (s *server) handleDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	active, _ := s.activeProfile(r)
+	if err := s.store.DeleteProfile(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+	if active.ID == id {
+		s.setProfileCookie(w, 0)
+		active = store.Profile{}
+	}
+	s.renderProfiles(w, r, active.ID)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func profileCookieFor(id int64) *http.Cookie {
+	return &http.Cookie{Name: profileCookie, Value: itoa(id)}
+}
+
+func TestHandleCreateProfile_SelectsFirstProfile(t *testing.T) {
+	srv := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/profiles", strings.NewReader(url.Values{"name": {"Kids"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Header().Get("Set-Cookie"), profileCookie+"=") {
+		t.Errorf("expected profile cookie, got %q", rec.Header().Get("Set-Cookie"))
+	}
+	if !strings.Contains(rec.Body.String(), "Open the library on") {
+		t.Error("expected landing form for the new active profile")
+	}
+}
+
+func TestHandleSelectProfile_Unknown(t *testing.T) {
+	srv := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/profiles/active", strings.NewReader("profile_id=42"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestHandleSetProfileLanding_RejectsUnknownSort(t *testing.T) {
+	srv := newTestServer(t)
+	p, _ := srv.store.CreateProfile(context.Background(), "Kids")
+	req := httptest.NewRequest(http.MethodPut, "/profiles/"+itoa(p.ID)+"/landing", strings.NewReader("sort=random"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestHandleIndex_AppliesProfileLandingTag(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	tag, _ := srv.store.UpsertTag(ctx, "kids")
+	p, _ := srv.store.CreateProfile(ctx, "Kids")
+	srv.store.SetProfileLanding(ctx, p.ID, tag.ID, "") //nolint:errcheck
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(profileCookieFor(p.ID))
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+
+	if !strings.Contains(rec.Body.String(), `id="active-tag" name="tag_id" value="`+itoa(tag.ID)+`"`) {
+		t.Error("expected the landing tag to be preselected")
+	}
+}
+
+func TestServeVideoList_ProfileSortsRecentlyAdded(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	srv.store.UpsertVideo(ctx, d.ID, d.Path, "a_old.mp4") //nolint:errcheck
+	srv.store.UpsertVideo(ctx, d.ID, d.Path, "b_new.mp4") //nolint:errcheck
+	p, _ := srv.store.CreateProfile(ctx, "Kids")
+	srv.store.SetProfileLanding(ctx, p.ID, 0, "added") //nolint:errcheck
+
+	req := httptest.NewRequest(http.MethodGet, "/videos", nil)
+	req.AddCookie(profileCookieFor(p.ID))
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	older, newer := strings.Index(body, "a_old.mp4"), strings.Index(body, "b_new.mp4")
+	if older < 0 || newer < 0 {
+		t.Fatalf("expected both videos listed:\n%s", body)
+	}
+	if newer > older {
+		t.Error("expected the most recently added video first")
+	}
+}
+
+func TestHandleDeleteProfile_ClearsActiveCookie(t *testing.T) {
+	srv := newTestServer(t)
+	p, _ := srv.store.CreateProfile(context.Background(), "Kids")
+	req := httptest.NewRequest(http.MethodDelete, "/profiles/"+itoa(p.ID), nil)
+	req.AddCookie(profileCookieFor(p.ID))
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+
+	if !strings.Contains(rec.Header().Get("Set-Cookie"), "Max-Age=0") {
+		t.Errorf("expected profile cookie to be cleared, got %q", rec.Header().Get("Set-Cookie"))
+	}
+}
@@ -0,0 +1,163 @@
+// handlers_quality_presets.go – named playback quality caps.
+//
+// A preset such as "Phone over LTE" caps the player at a height and a video
+// bitrate; the player transcodes to fit whenever a file is over either. The
+// preset is chosen per device and remembered in the "quality" cookie.
+//
+// GET    /quality-presets        – preset manager fragment (settings panel)
+// POST   /quality-presets        – create a preset
+// DELETE /quality-presets/{id}   – delete a preset
+// POST   /videos/{id}/quality    – select the device's preset (0 = original)
+// GET    /api/quality-presets    – the presets as JSON
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+const qualityCookie = "quality"
+
+// apiQualityPreset is the JSON representation of a quality preset.
+type apiQualityPreset struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	MaxHeight int    `json:"max_height,omitempty"`
+	MaxKbps   int    `json:"max_kbps,omitempty"`
+}
+
+// activeQualityPreset returns the preset selected by the request's cookie,
+// or the zero preset (no caps) when none is selected or it has since been
+// deleted.
+func (s *server) activeQualityPreset(r *http.Request) store.QualityPreset {
+	c, err := r.Cookie(qualityCookie)
+	if err != nil {
+		return store.QualityPreset{}
+	}
+	id, err := strconv.ParseInt(c.Value, 10, 64)
+	if err != nil || id <= 0 {
+		return store.QualityPreset{}
+	}
+	p, err := s.store.GetQualityPreset(r.Context(), id)
+	if err != nil {
+		return store.QualityPreset{}
+	}
+	return p
+}
+
+func (s *server) setQualityCookie(w http.ResponseWriter, id int64) {
+	c := &http.Cookie{
+		Name:     qualityCookie,
+		Value:    strconv.FormatInt(id, 10),
+		Path:     "/",
+		MaxAge:   int(profileCookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   s.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if id == 0 {
+		c.Value, c.MaxAge = "", -1
+	}
+	http.SetCookie(w, c)
+}
+
+func (s *server) renderQualityPresets(w http.ResponseWriter, r *http.Request) {
+	presets, err := s.store.ListQualityPresets(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "quality_presets.html", presets)
+}
+
+func (s *server) handleListQualityPresets(w http.ResponseWriter, r *http.Request) {
+	s.renderQualityPresets(w, r)
+}
+
+// POST /quality-presets takes name, max_height and max_kbps; an empty or 0
+// cap leaves that side uncapped, but a preset must cap something.
+func (s *server) handleCreateQualityPreset(w http.ResponseWriter, r *http.Request) {
+	p := store.QualityPreset{Name: strings.TrimSpace(r.FormValue("name"))}
+	if p.Name == "" {
+		http.Error(w, "name required", http.StatusBadRequest)
+		return
+	}
+	for _, f := range []struct {
+		field string
+		dst   *int
+	}{{"max_height", &p.MaxHeight}, {"max_kbps", &p.BitrateK}} {
+		v := strings.TrimSpace(r.FormValue(f.field))
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid "+f.field, http.StatusBadRequest)
+			return
+		}
+		*f.dst = n
+	}
+	if p.MaxHeight == 0 && p.BitrateK == 0 {
+		http.Error(w, "a preset needs a maximum height or bitrate", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.CreateQualityPreset(r.Context(), p); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderQualityPresets(w, r)
+}
+
+func (s *server) handleDeleteQualityPreset(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteQualityPreset(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderQualityPresets(w, r)
+}
+
+// POST /videos/{id}/quality selects preset_id for this device and answers
+// with the video's playback decision under it, so the player can switch
+// source without reloading.
+func (s *server) handleSelectQuality(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(r.FormValue("preset_id"), 10, 64)
+	if err != nil || id < 0 {
+		http.Error(w, "invalid preset_id", http.StatusBadRequest)
+		return
+	}
+	var preset store.QualityPreset
+	if id != 0 {
+		if preset, err = s.store.GetQualityPreset(r.Context(), id); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+	s.setQualityCookie(w, id)
+	dec := s.applyLanguagePrefs(r, video, s.playerPlayback(r.Context(), video, preset))
+	writeJSON(w, dec.signed(s.streamSigner(r.Context())))
+}
+
+// GET /api/quality-presets
+func (s *server) handleAPIListQualityPresets(w http.ResponseWriter, r *http.Request) {
+	presets, err := s.store.ListQualityPresets(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	out := make([]apiQualityPreset, 0, len(presets))
+	for _, p := range presets {
+		out = append(out, apiQualityPreset{ID: p.ID, Name: p.Name, MaxHeight: p.MaxHeight, MaxKbps: p.BitrateK})
+	}
+	writeJSON(w, out)
+}
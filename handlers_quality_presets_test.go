@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestQualityPresets(t *testing.T) {
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte("#!/bin/sh\n"), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin)
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	if rec := doAs(srv, nil, http.MethodPost, "/quality-presets", url.Values{"name": {"Phone over LTE"}, "max_height": {"720"}, "max_kbps": {"2000"}}); rec.Code != http.StatusOK ||
+		!strings.Contains(rec.Body.String(), "Phone over LTE") {
+		t.Fatalf("create: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := doAs(srv, nil, http.MethodPost, "/quality-presets", url.Values{"name": {"Uncapped"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("preset without caps: expected 400, got %d", rec.Code)
+	}
+	var presets []apiQualityPreset
+	apiGet(t, srv, "/api/quality-presets", &presets)
+	if len(presets) != 1 || presets[0].MaxHeight != 720 || presets[0].MaxKbps != 2000 {
+		t.Fatalf("presets = %+v", presets)
+	}
+
+	// A small 1080p MP4 the browser plays directly, at 4000 kbit/s.
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "big.mp4"), []byte("fake"), 0644) //nolint:errcheck
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	big, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "big.mp4")
+	srv.store.SetVideoCodecs(ctx, big.ID, store.VideoCodecs{Video: "h264", Audio: "aac"}) //nolint:errcheck
+	srv.store.UpdateVideoResolution(ctx, big.ID, 1920, 1080)                              //nolint:errcheck
+	srv.store.UpdateVideoDuration(ctx, big.ID, 100)                                       //nolint:errcheck
+	srv.store.UpdateVideoFileStat(ctx, big.ID, 50_000_000, time.Now())                    //nolint:errcheck
+	big, _ = srv.store.GetVideo(ctx, big.ID)
+
+	if got := srv.playerPlayback(ctx, big, store.QualityPreset{}); got.Method != playDirect {
+		t.Errorf("original quality: method = %s, want direct", got.Method)
+	}
+	if got := srv.playerPlayback(ctx, big, store.QualityPreset{BitrateK: 8000}); got.Method != playDirect {
+		t.Errorf("bitrate under the cap: method = %s, want direct", got.Method)
+	}
+
+	rec := doAs(srv, nil, http.MethodPost, "/videos/"+itoa(big.ID)+"/quality", url.Values{"preset_id": {itoa(presets[0].ID)}})
+	var dec playbackDecision
+	json.NewDecoder(rec.Body).Decode(&dec) //nolint:errcheck
+	if rec.Code != http.StatusOK || dec.Method != playTranscode || dec.URL != "/videos/"+itoa(big.ID)+"/stream?max_height=720&max_kbps=2000" {
+		t.Fatalf("select preset: got %d %+v", rec.Code, dec)
+	}
+	cookie := rec.Result().Cookies()[0]
+	if cookie.Name != qualityCookie || cookie.Value != itoa(presets[0].ID) {
+		t.Fatalf("expected the quality cookie, got %v", cookie)
+	}
+	// The device's preset then applies to the player.
+	if rec := doAs(srv, cookie, http.MethodGet, "/play/"+itoa(big.ID), nil); !strings.Contains(rec.Body.String(), "max_height=720") {
+		t.Error("player should stream within the device's preset")
+	}
+	if rec := doAs(srv, nil, http.MethodPost, "/videos/"+itoa(big.ID)+"/quality", url.Values{"preset_id": {"999"}}); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown preset: expected 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,119 @@
+// handlers_queue.go – the shuffle play queue.
+//
+// POST /queue/shuffle – build a new queue in random order
+// GET  /queue/next    – the next video in the queue
+//
+// A shuffle covers the whole library, or only the videos with tag_id and/or
+// in dir_id. The queue is kept in the store, so random play does not repeat a video
+// until every one in the set has come up. When the queue runs out the same
+// set is reshuffled for another round.
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// shuffleCandidates returns the videos a shuffle of tagID and dirID (0 for
+// any) draws from, leaving out extras and those on offline drives.
+func (s *server) shuffleCandidates(r *http.Request, tagID, dirID int64) ([]store.Video, error) {
+	var (
+		videos []store.Video
+		err    error
+	)
+	switch {
+	case tagID != 0:
+		videos, err = s.store.ListVideosByTag(r.Context(), tagID)
+	case dirID != 0:
+		videos, err = s.store.ListVideosByDirectory(r.Context(), dirID)
+	default:
+		videos, err = s.store.ListVideos(r.Context())
+	}
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := s.store.ListDirectories(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	offline := map[int64]bool{}
+	for _, d := range dirs {
+		offline[d.ID] = d.Offline
+	}
+	extras, err := s.store.ListExtraVideoIDs(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	out := videos[:0]
+	for _, v := range videos {
+		if !offline[v.DirectoryID] && !extras[v.ID] && (dirID == 0 || v.DirectoryID == dirID) {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// shuffleIDs returns ids in a random order.
+func shuffleIDs(ids []int64) []int64 {
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	return ids
+}
+
+// handleShuffleQueue builds a new shuffle queue and reports its size.
+func (s *server) handleShuffleQueue(w http.ResponseWriter, r *http.Request) {
+	tagID, _ := strconv.ParseInt(r.FormValue("tag_id"), 10, 64)
+	dirID, _ := strconv.ParseInt(r.FormValue("dir_id"), 10, 64)
+	videos, err := s.shuffleCandidates(r, tagID, dirID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if len(videos) == 0 {
+		http.Error(w, "no videos to shuffle", http.StatusNotFound)
+		return
+	}
+	ids := make([]int64, len(videos))
+	for i, v := range videos {
+		ids[i] = v.ID
+	}
+	if err := s.store.SetPlayQueue(r.Context(), shuffleIDs(ids)); err != nil {
+		storeError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"size": len(ids)})
+}
+
+// handleQueueNext hands out the next video in the shuffle queue, starting
+// a new round in a fresh order once all have been played. 404 when there
+// is no queue.
+func (s *server) handleQueueNext(w http.ResponseWriter, r *http.Request) {
+	id, remaining, err := s.store.AdvancePlayQueue(r.Context())
+	if errors.Is(err, store.ErrNotFound) {
+		var ids []int64
+		ids, err = s.store.ListPlayQueue(r.Context())
+		if err == nil && len(ids) == 0 {
+			http.Error(w, "the shuffle queue is empty", http.StatusNotFound)
+			return
+		}
+		if err == nil {
+			err = s.store.SetPlayQueue(r.Context(), shuffleIDs(ids))
+		}
+		if err == nil {
+			id, remaining, err = s.store.AdvancePlayQueue(r.Context())
+		}
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	video, err := s.store.GetVideo(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"id": video.ID, "title": video.Title(), "remaining": remaining})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestShuffleQueue_NoRepeatsUntilAllPlayed(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	other, _ := srv.store.AddDirectory(ctx, "/other")
+	var want []int64
+	for _, name := range []string{"a.mp4", "b.mp4", "c.mp4"} {
+		v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, name)
+		want = append(want, v.ID)
+	}
+	srv.store.UpsertVideo(ctx, other.ID, other.Path, "elsewhere.mp4") //nolint:errcheck
+
+	if rec := doAs(srv, nil, http.MethodGet, "/queue/next", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("no queue: expected 404, got %d", rec.Code)
+	}
+	rec := doAs(srv, nil, http.MethodPost, "/queue/shuffle", url.Values{"dir_id": {itoa(d.ID)}})
+	var built struct{ Size int }
+	json.NewDecoder(rec.Body).Decode(&built) //nolint:errcheck
+	if rec.Code != http.StatusOK || built.Size != 3 {
+		t.Fatalf("expected a queue of the folder's 3 videos, got %d: %+v", rec.Code, built)
+	}
+
+	next := func() (id int64, remaining int) {
+		rec := doAs(srv, nil, http.MethodGet, "/queue/next", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("next: expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var body struct {
+			ID        int64
+			Remaining int
+		}
+		json.NewDecoder(rec.Body).Decode(&body) //nolint:errcheck
+		return body.ID, body.Remaining
+	}
+	for round := range 2 {
+		var got []int64
+		for i := range 3 {
+			id, remaining := next()
+			if remaining != 2-i {
+				t.Errorf("round %d: expected %d remaining, got %d", round, 2-i, remaining)
+			}
+			got = append(got, id)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("round %d: expected each video once, got %v", round, got)
+		}
+	}
+
+	if rec := doAs(srv, nil, http.MethodPost, "/queue/shuffle", url.Values{"tag_id": {"999"}}); rec.Code != http.StatusNotFound {
+		t.Errorf("empty scope: expected 404, got %d", rec.Code)
+	}
+}
@@ -86,5 +86,5 @@ func (s *server) handleRokuPoll(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "video not found", http.StatusNotFound)
 		return
 	}
-	writeJSON(w, videoToAPI(v))
+	writeJSON(w, videoToAPI(v, s.streamSigner(r.Context())))
 }
@@ -0,0 +1,260 @@
+// handlers_shows.go – series posters and summaries from the metadata scraper.
+//
+// GET /api/shows/{show}/poster  – the show's poster image
+// GET /api/shows/{show}/missing – aired episodes not in the library, per season
+// GET /shows/missing?show=NAME  – the same as an HTML partial for the library list
+// GET /shows/next?show=NAME     – when the show's next episode airs, as an HTML partial
+//
+// A TMDB lookup of a TV episode saves its series' overview, poster, external
+// IDs and episode list to the shows table; GET /api/shows lists them
+// alongside the episode counts derived from the videos. Comparing the episode
+// list with the videos' season and episode numbers finds the gaps; the next
+// episode's air date comes from TVMaze (see tvmaze.go).
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// tmdbImageBase prefixes a TMDB poster_path to make a fetchable image URL.
+const tmdbImageBase = "https://image.tmdb.org/t/p/w500"
+
+// showPosterDir holds downloaded show posters, one per show ID.
+var showPosterDir = filepath.Join(os.TempDir(), "video_manger-show-posters")
+
+// saveTMDBShow records the show found by a TMDB lookup with its episode
+// list and downloads its poster. Failures are logged: the lookup itself has
+// already succeeded.
+func (s *server) saveTMDBShow(ctx context.Context, res tmdbLookup) {
+	show, posterURL := *res.Show, res.PosterURL
+	saved, err := s.store.SaveShow(ctx, show)
+	if err != nil {
+		slog.Warn("TMDB apply: save show failed", "show", show.Name, "err", err)
+		return
+	}
+	if res.Episodes != nil {
+		if err := s.store.SetShowEpisodes(ctx, saved.ID, res.Episodes); err != nil {
+			slog.Warn("TMDB apply: save episode list failed", "show", show.Name, "err", err)
+		}
+	}
+	if posterURL == "" {
+		return
+	}
+	dst := filepath.Join(showPosterDir, strconv.FormatInt(saved.ID, 10)+".jpg")
+	if err := fetchPoster(ctx, posterURL, dst); err != nil {
+		slog.Warn("TMDB apply: fetch show poster failed", "show", show.Name, "err", err)
+		return
+	}
+	if _, err := s.store.SaveShow(ctx, store.Show{Name: saved.Name, PosterPath: dst}); err != nil {
+		slog.Warn("TMDB apply: save show poster failed", "show", show.Name, "err", err)
+	}
+}
+
+// fetchTMDBEpisodes fetches the episode lists of the given seasons of TMDB
+// series tmdbID. Specials (season 0) are left out. It fails as a whole, so a
+// stored list is never replaced by one missing a season.
+func fetchTMDBEpisodes(apiKey, tmdbID string, seasons []int) ([]store.ShowEpisode, error) {
+	out := []store.ShowEpisode{}
+	for _, sn := range seasons {
+		if sn <= 0 {
+			continue
+		}
+		var season struct {
+			Episodes []struct {
+				Number  int    `json:"episode_number"`
+				Name    string `json:"name"`
+				AirDate string `json:"air_date"`
+			} `json:"episodes"`
+		}
+		if err := tmdbGet(apiKey, fmt.Sprintf("/tv/%s/season/%d", tmdbID, sn), &season); err != nil {
+			return nil, fmt.Errorf("season %d: %w", sn, err)
+		}
+		for _, e := range season.Episodes {
+			out = append(out, store.ShowEpisode{Season: sn, Episode: e.Number, Title: e.Name, AirDate: e.AirDate})
+		}
+	}
+	return out, nil
+}
+
+// fetchPoster downloads the image at src and writes it to dst as a poster.
+func fetchPoster(ctx context.Context, src, dst string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := tmdbClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("poster fetch: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPosterBytes))
+	if err != nil {
+		return err
+	}
+	img, err := decodePoster(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return writePoster(dst, img)
+}
+
+// showPosterURL is where a show's poster is served, or "" when it has none.
+func showPosterURL(show store.Show) string {
+	if show.PosterPath == "" {
+		return ""
+	}
+	return "/api/shows/" + url.PathEscape(show.Name) + "/poster"
+}
+
+// GET /api/shows/{show}/poster
+func (s *server) handleAPIShowPoster(w http.ResponseWriter, r *http.Request) {
+	name, err := url.PathUnescape(chi.URLParam(r, "show"))
+	if err != nil || name == "" {
+		http.Error(w, "invalid show", http.StatusBadRequest)
+		return
+	}
+	show, err := s.store.GetShow(r.Context(), name)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if show.PosterPath == "" {
+		http.Error(w, "no poster", http.StatusNotFound)
+		return
+	}
+	http.ServeFile(w, r, show.PosterPath)
+}
+
+// missingEpisode is an aired episode the library doesn't have.
+type missingEpisode struct {
+	Episode int    `json:"episode"`
+	Title   string `json:"title"`
+	AirDate string `json:"air_date"`
+}
+
+// seasonGaps compares one season's aired episodes with the library.
+type seasonGaps struct {
+	Season  int              `json:"season"`
+	Aired   int              `json:"aired"`   // episodes aired so far
+	OnDisk  int              `json:"on_disk"` // aired episodes the library has
+	Missing []missingEpisode `json:"missing"`
+}
+
+// showGaps is the missing-episodes report for one show.
+type showGaps struct {
+	Show    string       `json:"show"`
+	Missing int          `json:"missing"` // across all seasons
+	Seasons []seasonGaps `json:"seasons"`
+}
+
+// showGaps compares the show's scraped episode list with its videos. Only
+// episodes aired by today count; a show that was never scraped is
+// ErrNotFound, and one scraped without an episode list has no seasons.
+func (s *server) showGaps(ctx context.Context, name string, today time.Time) (showGaps, error) {
+	show, err := s.store.GetShow(ctx, name)
+	if err != nil {
+		return showGaps{}, err
+	}
+	episodes, err := s.store.ListShowEpisodes(ctx, show.ID)
+	if err != nil {
+		return showGaps{}, err
+	}
+	videos, err := s.store.ListVideosByShow(ctx, name)
+	if err != nil {
+		return showGaps{}, err
+	}
+	have := map[[2]int]bool{}
+	for _, v := range videos {
+		have[[2]int{v.SeasonNumber, v.EpisodeNumber}] = true
+	}
+	out := showGaps{Show: show.Name, Seasons: []seasonGaps{}}
+	day := today.Format("2006-01-02")
+	for _, e := range episodes {
+		if e.AirDate == "" || e.AirDate > day {
+			continue
+		}
+		if n := len(out.Seasons); n == 0 || out.Seasons[n-1].Season != e.Season {
+			out.Seasons = append(out.Seasons, seasonGaps{Season: e.Season, Missing: []missingEpisode{}})
+		}
+		sg := &out.Seasons[len(out.Seasons)-1]
+		sg.Aired++
+		if have[[2]int{e.Season, e.Episode}] {
+			sg.OnDisk++
+			continue
+		}
+		sg.Missing = append(sg.Missing, missingEpisode{Episode: e.Episode, Title: e.Title, AirDate: e.AirDate})
+		out.Missing++
+	}
+	return out, nil
+}
+
+// GET /api/shows/{show}/missing
+func (s *server) handleAPIShowMissing(w http.ResponseWriter, r *http.Request) {
+	name, err := url.PathUnescape(chi.URLParam(r, "show"))
+	if err != nil || name == "" {
+		http.Error(w, "invalid show", http.StatusBadRequest)
+		return
+	}
+	gaps, err := s.showGaps(r.Context(), name, time.Now())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	writeJSON(w, gaps)
+}
+
+// GET /shows/missing?show=NAME renders the report for a show group in the
+// library list; shows that were never scraped render nothing.
+func (s *server) handleShowMissing(w http.ResponseWriter, r *http.Request) {
+	gaps, err := s.showGaps(r.Context(), r.URL.Query().Get("show"), time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "show_gaps.html", gaps)
+}
+
+// GET /shows/next?show=NAME renders "next episode airs on …" for a show
+// group in the library list, or nothing when no episode is scheduled.
+func (s *server) handleShowNext(w http.ResponseWriter, r *http.Request) {
+	show, err := s.store.GetShow(r.Context(), r.URL.Query().Get("show"))
+	if errors.Is(err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	next := nextEpisodeToAPI(show.Airing, time.Now())
+	if next == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	render(w, "show_next.html", next)
+}
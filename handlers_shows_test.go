@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestLookupApply_SavesShow(t *testing.T) {
+	cleanup := withMockTMDB(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/poster.png"):
+			png.Encode(w, image.NewRGBA(image.Rect(0, 0, 20, 30))) //nolint:errcheck
+		case strings.Contains(r.URL.Path, "/episode/"):
+			w.Write([]byte(`{"name":"Pilot","external_ids":{"imdb_id":"tt0959621"}}`)) //nolint:errcheck
+		case strings.HasSuffix(r.URL.Path, "/season/1"):
+			w.Write([]byte(`{"episodes":[{"episode_number":1,"name":"Pilot","air_date":"2008-01-20"},` + //nolint:errcheck
+				`{"episode_number":2,"name":"Cat's in the Bag...","air_date":"2008-01-27"}]}`))
+		case strings.Contains(r.URL.Path, "/tv/"):
+			w.Write([]byte(`{"name":"Breaking Bad","overview":"A chemistry teacher turns to crime.",` + //nolint:errcheck
+				`"poster_path":"/poster.png","external_ids":{"imdb_id":"tt0903747","tvmaze_id":169},` +
+				`"seasons":[{"season_number":0},{"season_number":1}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer cleanup()
+	orig := showPosterDir
+	showPosterDir = t.TempDir()
+	defer func() { showPosterDir = orig }()
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	srv.store.SaveSettings(ctx, map[string]string{"tmdb_api_key": "fake-key"}) //nolint:errcheck
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "s01e01.mp4")
+
+	form := url.Values{"media_type": {"tv"}, "tmdb_id": {"1396"}, "season": {"1"}, "episode": {"1"}}
+	req := httptest.NewRequest(http.MethodPost, "/videos/"+itoa(v.ID)+"/lookup/apply", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("apply: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	show, err := srv.store.GetShow(ctx, "Breaking Bad")
+	if err != nil {
+		t.Fatalf("GetShow: %v", err)
+	}
+	if show.Overview != "A chemistry teacher turns to crime." || show.PosterPath == "" ||
+		show.ExternalIDs[store.ExternalTMDB] != "tv/1396" || show.ExternalIDs[store.ExternalTVMaze] != "169" {
+		t.Errorf("unexpected show: %+v", show)
+	}
+	if eps, _ := srv.store.ListShowEpisodes(ctx, show.ID); len(eps) != 2 || eps[1].Title != "Cat's in the Bag..." {
+		t.Errorf("episode list = %+v, want season 1's two episodes", eps)
+	}
+	if ids, _ := srv.store.ListVideoExternalIDs(ctx, v.ID); ids[store.ExternalIMDb] != "tt0959621" {
+		t.Errorf("episode IDs = %v, want its own IMDb ID", ids)
+	}
+
+	var shows []apiShow
+	if code := apiGet(t, srv, "/api/shows", &shows); code != http.StatusOK {
+		t.Fatalf("/api/shows: expected 200, got %d", code)
+	}
+	if len(shows) != 1 || shows[0].Overview != show.Overview || shows[0].ThumbnailURL != "/api/shows/Breaking%20Bad/poster" {
+		t.Fatalf("unexpected shows: %+v", shows)
+	}
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, shows[0].ThumbnailURL, nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("poster: got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestShowMissing(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	show, _ := srv.store.SaveShow(ctx, store.Show{Name: "Lost & Found"})
+	srv.store.SetShowEpisodes(ctx, show.ID, []store.ShowEpisode{ //nolint:errcheck
+		{Season: 1, Episode: 1, AirDate: "2004-09-22"},
+		{Season: 1, Episode: 2, Title: "Pilot, Part 2", AirDate: "2004-09-29"},
+		{Season: 1, Episode: 3, AirDate: "2004-10-06"},
+		{Season: 2, Episode: 1, AirDate: "2005-09-21"},
+		{Season: 2, Episode: 2, AirDate: "2999-01-01"}, // not aired yet
+		{Season: 2, Episode: 3},                        // not announced
+	})
+	for i, se := range [][2]int{{1, 1}, {1, 3}} {
+		v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "ep"+itoa(int64(i))+".mp4")
+		srv.store.UpdateVideoShowName(ctx, v.ID, show.Name)                                                  //nolint:errcheck
+		srv.store.UpdateVideoFields(ctx, v.ID, store.VideoFields{SeasonNumber: se[0], EpisodeNumber: se[1]}) //nolint:errcheck
+	}
+
+	var gaps showGaps
+	if code := apiGet(t, srv, "/api/shows/"+url.PathEscape(show.Name)+"/missing", &gaps); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if gaps.Missing != 2 || len(gaps.Seasons) != 2 ||
+		gaps.Seasons[0].OnDisk != 2 || gaps.Seasons[0].Missing[0].Title != "Pilot, Part 2" ||
+		gaps.Seasons[1].Aired != 1 || gaps.Seasons[1].Missing[0].Episode != 1 {
+		t.Errorf("unexpected report: %+v", gaps)
+	}
+	if code := apiGet(t, srv, "/api/shows/Unknown/missing", &gaps); code != http.StatusNotFound {
+		t.Errorf("unscraped show: expected 404, got %d", code)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/shows/missing?show="+url.QueryEscape(show.Name), nil))
+	if !strings.Contains(rec.Body.String(), "2 episodes missing") {
+		t.Errorf("partial missing the count:\n%s", rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos", nil))
+	// The query-escaped name, with each "+" (a space) HTML-escaped as &#43;.
+	if !strings.Contains(rec.Body.String(), `hx-get="/shows/missing?show=Lost&#43;%26&#43;Found"`) {
+		t.Errorf("library list doesn't load the report for the show group:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,271 @@
+// handlers_smart_playlists.go – saved library filters.
+//
+// A smart playlist is the library's filters and sort saved under a name:
+// search text, tags (any or all of them), type, folder, minimum rating,
+// watched state and favourites only. Nothing else is stored, so opening one
+// lists the library as it stands now. Playlists are shared by everyone;
+// admins save them from the library bar and delete them in Settings.
+//
+// GET    /api/smart-playlists             – saved playlists
+// GET    /api/smart-playlists/{id}        – a playlist's videos, as a watch order
+// GET    /smart-playlists                 – the smart playlists panel (settings)
+// GET    /smart-playlists/options         – <option>s for the library bar
+// GET    /smart-playlists/{id}/videos     – a playlist as the library list
+// POST   /smart-playlists                 – save a playlist (form value name and the library filters)
+// DELETE /smart-playlists/{id}            – remove a playlist
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// maxSmartPlaylistVideos caps the videos a playlist plays through the API.
+const maxSmartPlaylistVideos = 1000
+
+// smartPlaylistValues writes p's filter as the library list's query, as
+// videoQueryFrom reads it.
+func smartPlaylistValues(p store.SmartPlaylist) url.Values {
+	q := p.Query
+	v := url.Values{}
+	set := func(key, value string) {
+		if value != "" && value != "0" {
+			v.Set(key, value)
+		}
+	}
+	set("q", q.Search)
+	tags := make([]string, len(q.TagIDs))
+	for i, id := range q.TagIDs {
+		tags[i] = strconv.FormatInt(id, 10)
+	}
+	set("tags", strings.Join(tags, ","))
+	if q.AllTags && len(q.TagIDs) > 1 {
+		v.Set("mode", "all")
+	}
+	set("type", q.Type)
+	set("dir_id", strconv.FormatInt(q.DirectoryID, 10))
+	set("rating", strconv.Itoa(q.MinRating))
+	set("watched", q.Watched)
+	if q.Favorites {
+		v.Set("favorite", "1")
+	}
+	set("sort", q.Sort)
+	return v
+}
+
+// smartPlaylistRow is a playlist in the settings panel.
+type smartPlaylistRow struct {
+	store.SmartPlaylist
+	Summary string // the filter in words
+}
+
+// describeSmartPlaylist puts p's filter in words, naming its tags and
+// folder.
+func (s *server) describeSmartPlaylist(ctx context.Context, p store.SmartPlaylist) string {
+	q := p.Query
+	var parts []string
+	if q.Search != "" {
+		parts = append(parts, fmt.Sprintf("matching %q", q.Search))
+	}
+	if len(q.TagIDs) > 0 {
+		var names []string
+		for _, id := range q.TagIDs {
+			if t, err := s.store.GetTag(ctx, id); err == nil {
+				names = append(names, t.Name)
+			}
+		}
+		join := " or "
+		if q.AllTags {
+			join = " and "
+		}
+		parts = append(parts, "tagged "+strings.Join(names, join))
+	}
+	if q.Type != "" {
+		parts = append(parts, q.Type)
+	}
+	if q.DirectoryID != 0 {
+		if d, err := s.store.GetDirectory(ctx, q.DirectoryID); err == nil {
+			parts = append(parts, "in "+d.Path)
+		}
+	}
+	switch q.MinRating {
+	case 1:
+		parts = append(parts, "♥ liked or better")
+	case 2:
+		parts = append(parts, "★ favourites")
+	}
+	switch q.Watched {
+	case "no":
+		parts = append(parts, "unwatched")
+	case "yes":
+		parts = append(parts, "watched")
+	}
+	if q.Favorites {
+		parts = append(parts, "⚑ watch again soon")
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "the whole library")
+	}
+	for _, o := range videoSorts {
+		if o.Key == q.Sort && o.Key != "name" {
+			parts = append(parts, "by "+strings.ToLower(o.Label))
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+// renderSmartPlaylists renders the smart playlists panel.
+func (s *server) renderSmartPlaylists(w http.ResponseWriter, r *http.Request) {
+	list, err := s.store.ListSmartPlaylists(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	rows := make([]smartPlaylistRow, 0, len(list))
+	for _, p := range list {
+		rows = append(rows, smartPlaylistRow{p, s.describeSmartPlaylist(r.Context(), p)})
+	}
+	render(w, "smart_playlists.html", rows)
+}
+
+// GET /smart-playlists
+func (s *server) handleListSmartPlaylists(w http.ResponseWriter, r *http.Request) {
+	s.renderSmartPlaylists(w, r)
+}
+
+// GET /smart-playlists/options
+func (s *server) handleSmartPlaylistOptions(w http.ResponseWriter, r *http.Request) {
+	list, err := s.store.ListSmartPlaylists(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "smart_playlist_options.html", list)
+}
+
+// GET /smart-playlists/{id}/videos renders the library list filtered and
+// sorted as the playlist says. limit, page and view work as for /videos.
+func (s *server) handleSmartPlaylistVideos(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	p, err := s.store.GetSmartPlaylist(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	q := smartPlaylistValues(p)
+	for _, key := range []string{"limit", "page", "view"} {
+		if v := r.URL.Query().Get(key); v != "" {
+			q.Set(key, v)
+		}
+	}
+	r2 := r.Clone(r.Context())
+	r2.URL.RawQuery = q.Encode()
+	s.serveVideoList(w, r2)
+}
+
+// POST /smart-playlists saves the library filters in the form (q, tag_id,
+// tags, mode, type, dir_id, rating, watched, favorite and sort) under the
+// form value name. A playlist with the same name is replaced.
+func (s *server) handleSaveSmartPlaylist(w http.ResponseWriter, r *http.Request) {
+	p := store.SmartPlaylist{Name: strings.TrimSpace(r.FormValue("name"))}
+	if p.Name == "" {
+		http.Error(w, "name required", http.StatusBadRequest)
+		return
+	}
+	if _, ok := parseTagIDs(r.FormValue("tags")); !ok {
+		http.Error(w, "invalid tags", http.StatusBadRequest)
+		return
+	}
+	p.Query = videoQueryFrom(r.Form)
+	if id := p.Query.TagID; id != 0 && !slices.Contains(p.Query.TagIDs, id) {
+		p.Query.TagIDs = append(p.Query.TagIDs, id)
+	}
+	p.Query.TagID = 0
+	p.Query.Search = strings.TrimSpace(p.Query.Search)
+	p.Query.Sort = r.FormValue("sort")
+	switch {
+	case !store.IsValidVideoType(p.Query.Type):
+		http.Error(w, "invalid type", http.StatusBadRequest)
+		return
+	case p.Query.MinRating < 0 || p.Query.MinRating > 2:
+		http.Error(w, "rating must be 0, 1 or 2", http.StatusBadRequest)
+		return
+	case p.Query.Watched != "" && p.Query.Watched != "yes" && p.Query.Watched != "no":
+		http.Error(w, "watched must be yes or no", http.StatusBadRequest)
+		return
+	case p.Query.Sort != "" && !validVideoSort(p.Query.Sort):
+		http.Error(w, "invalid sort", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.SaveSmartPlaylist(r.Context(), p); err != nil {
+		storeError(w, err)
+		return
+	}
+	w.Header().Set("HX-Trigger", "smartPlaylistsChanged")
+	s.renderSmartPlaylists(w, r)
+}
+
+// DELETE /smart-playlists/{id}
+func (s *server) handleDeleteSmartPlaylist(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteSmartPlaylist(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+	w.Header().Set("HX-Trigger", "smartPlaylistsChanged")
+	s.renderSmartPlaylists(w, r)
+}
+
+// GET /api/smart-playlists
+func (s *server) handleAPIListSmartPlaylists(w http.ResponseWriter, r *http.Request) {
+	list, err := s.store.ListSmartPlaylists(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	out := make([]apiWatchOrder, 0, len(list))
+	for _, p := range list {
+		out = append(out, apiWatchOrder{ID: p.ID, Name: p.Name, Videos: []apiVideo{}})
+	}
+	writeJSON(w, out)
+}
+
+// GET /api/smart-playlists/{id} lists the playlist's videos now, at most
+// maxSmartPlaylistVideos of them, with "start" at the first unwatched one.
+func (s *server) handleAPIGetSmartPlaylist(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	p, err := s.store.GetSmartPlaylist(ctx, id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	q := p.Query
+	q.Limit = maxSmartPlaylistVideos
+	q.Sort = s.ratingSort(ctx, q.Sort)
+	q.Companions = s.includeCompanions(ctx)
+	videos, _, err := s.store.ListVideosPage(ctx, q)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	out := newAPIWatchOrder(p.Name, videos, s.streamSigner(ctx))
+	out.ID = p.ID
+	writeJSON(w, out)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/internal/fixture"
+)
+
+func TestSmartPlaylists(t *testing.T) {
+	srv := newTestServer(t)
+	lib := fixture.Seed(t, srv.store)
+
+	// Unwatched drama, newest first: the pilot is half watched, which
+	// counts, so only the second episode.
+	rec := doAs(srv, nil, http.MethodPost, "/smart-playlists", url.Values{
+		"name": {"Drama to watch"}, "tag_id": {itoa(lib.Drama.ID)}, "watched": {"no"}, "sort": {"added"},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /smart-playlists: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("HX-Trigger"); got != "smartPlaylistsChanged" {
+		t.Errorf("HX-Trigger = %q", got)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "Drama to watch") || !strings.Contains(body, "tagged drama · unwatched · by recently added") {
+		t.Errorf("panel doesn't describe the playlist:\n%s", body)
+	}
+	list, _ := srv.store.ListSmartPlaylists(t.Context())
+	if len(list) != 1 {
+		t.Fatalf("saved %d playlists, want 1", len(list))
+	}
+	p := list[0]
+
+	// Evaluated when opened: a new drama joins, a watched episode leaves.
+	extra := fixture.AddVideo(t, srv.store, lib.Dir, fixture.Video{Filename: "Storm.mp4", Tags: []string{"drama"}})
+	srv.store.RecordWatch(t.Context(), lib.Episodes[1].ID, 1500) //nolint:errcheck
+	var order apiWatchOrder
+	if code := apiGet(t, srv, "/api/smart-playlists/"+itoa(p.ID), &order); code != http.StatusOK {
+		t.Fatalf("GET /api/smart-playlists/%d: got %d", p.ID, code)
+	}
+	if len(order.Videos) != 1 || order.Videos[0].ID != extra.ID || order.Name != "Drama to watch" {
+		t.Errorf("playlist = %+v, want only %d", order, extra.ID)
+	}
+	rec = doAs(srv, nil, http.MethodGet, "/smart-playlists/"+itoa(p.ID)+"/videos", nil)
+	if body := rec.Body.String(); !strings.Contains(body, "Storm") || strings.Contains(body, "Alpha") {
+		t.Errorf("library list for the playlist:\n%s", body)
+	}
+
+	// Saving under the same name replaces the filter.
+	doAs(srv, nil, http.MethodPost, "/smart-playlists", url.Values{"name": {"Drama to watch"}, "rating": {"2"}})
+	if got, _ := srv.store.GetSmartPlaylist(t.Context(), p.ID); got.Query.MinRating != 2 || len(got.Query.TagIDs) != 0 {
+		t.Errorf("replaced playlist = %+v", got)
+	}
+	if body := doAs(srv, nil, http.MethodGet, "/smart-playlists/options", nil).Body.String(); !strings.Contains(body, `value="`+itoa(p.ID)+`">Drama to watch`) {
+		t.Errorf("options = %s", body)
+	}
+
+	for _, form := range []url.Values{
+		{"name": {" "}},
+		{"name": {"x"}, "rating": {"3"}},
+		{"name": {"x"}, "watched": {"maybe"}},
+		{"name": {"x"}, "sort": {"random"}},
+		{"name": {"x"}, "tags": {"1,x"}},
+		{"name": {"x"}, "type": {"Opera"}},
+	} {
+		if rec := doAs(srv, nil, http.MethodPost, "/smart-playlists", form); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d", form, rec.Code)
+		}
+	}
+
+	if rec := doAs(srv, nil, http.MethodDelete, "/smart-playlists/"+itoa(p.ID), nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE: expected 200, got %d", rec.Code)
+	}
+	if code := apiGet(t, srv, "/api/smart-playlists/"+itoa(p.ID), &order); code != http.StatusNotFound {
+		t.Errorf("deleted playlist: expected 404, got %d", code)
+	}
+}
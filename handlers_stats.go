@@ -0,0 +1,474 @@
+// handlers_stats.go – library statistics, growth over time and rating
+// summaries.
+//
+// GET /api/stats sums up the library as it is now: how many videos, how long
+// they run, the disk used by each directory, the most watched videos, the
+// hours watched in each of the last statsWeeks weeks and the bytes streamed,
+// overall and for the most streamed videos (counted in streams.go). GET
+// /stats shows the same in settings.
+//
+// A snapshot of each directory's video count and total size is recorded
+// daily (refreshed hourly, so today's row tracks the current state) and
+// served as a time series and as a small chart in settings.
+//
+// Ratings are summed up per show and per tag from the videos' own ratings;
+// GET /api/stats/ratings ranks them and GET /stats/ratings shows the best in
+// settings.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// statsDirectory is one directory's disk usage.
+type statsDirectory struct {
+	ID    int64  `json:"id"`
+	Path  string `json:"path"`
+	Title string `json:"title"`
+	Bytes int64  `json:"bytes"`
+}
+
+// statsVideo is a video and how often it was watched to the end.
+type statsVideo struct {
+	ID      int64  `json:"id"`
+	Title   string `json:"title"`
+	Watches int    `json:"watches"`
+}
+
+// statsStreamed is a video and how many bytes of it were streamed.
+type statsStreamed struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Bytes int64  `json:"bytes"`
+}
+
+// statsWeek is the watching done in one week. Hours adds up the running time
+// of the videos watched to the end, so partial plays are not counted.
+type statsWeek struct {
+	Week    string  `json:"week"` // the week's Monday
+	Watches int     `json:"watches"`
+	Hours   float64 `json:"hours"`
+}
+
+// libraryStats is the body of GET /api/stats.
+type libraryStats struct {
+	Videos       int              `json:"videos"`
+	DurationS    float64          `json:"duration_s"`
+	Bytes        int64            `json:"bytes"`
+	Directories  []statsDirectory `json:"directories"`
+	MostWatched  []statsVideo     `json:"most_watched"`
+	WeeklyHours  []statsWeek      `json:"weekly_hours"`
+	BytesServed  int64            `json:"bytes_served"`
+	MostStreamed []statsStreamed  `json:"most_streamed"`
+}
+
+// libraryStats sums up the library at now.
+func (s *server) libraryStats(ctx context.Context, now time.Time) (libraryStats, error) {
+	out := libraryStats{Directories: []statsDirectory{}, MostWatched: []statsVideo{}, WeeklyHours: []statsWeek{}, MostStreamed: []statsStreamed{}}
+	s.flushBytesServed(ctx)
+	totals, err := s.store.LibraryTotals(ctx)
+	if err != nil {
+		return out, err
+	}
+	out.Videos, out.DurationS, out.Bytes, out.BytesServed = totals.Videos, totals.DurationS, totals.Bytes, totals.Served
+
+	dirs, err := s.store.ListDirectories(ctx)
+	if err != nil {
+		return out, err
+	}
+	usage, err := s.store.DirectoryUsage(ctx)
+	if err != nil {
+		return out, err
+	}
+	for _, d := range dirs {
+		out.Directories = append(out.Directories, statsDirectory{ID: d.ID, Path: d.Path, Title: d.Title(), Bytes: usage[d.ID]})
+	}
+	sort.SliceStable(out.Directories, func(i, j int) bool { return out.Directories[i].Bytes > out.Directories[j].Bytes })
+
+	watched, err := s.store.ListMostWatched(ctx, statsMostWatched)
+	if err != nil {
+		return out, err
+	}
+	for _, c := range watched {
+		v, err := s.store.GetVideo(ctx, c.VideoID)
+		if err != nil {
+			continue
+		}
+		out.MostWatched = append(out.MostWatched, statsVideo{ID: v.ID, Title: v.Title(), Watches: c.Watches})
+	}
+
+	weeks, err := s.store.ListWeeklyWatchTime(ctx, now.AddDate(0, 0, -7*(statsWeeks-1)))
+	if err != nil {
+		return out, err
+	}
+	for _, w := range weeks {
+		out.WeeklyHours = append(out.WeeklyHours, statsWeek{Week: w.Week, Watches: w.Watches, Hours: w.Seconds / 3600})
+	}
+
+	streamed, err := s.store.ListMostServed(ctx, statsMostWatched)
+	if err != nil {
+		return out, err
+	}
+	for _, b := range streamed {
+		v, err := s.store.GetVideo(ctx, b.VideoID)
+		if err != nil {
+			continue
+		}
+		out.MostStreamed = append(out.MostStreamed, statsStreamed{ID: v.ID, Title: v.Title(), Bytes: b.Bytes})
+	}
+	return out, nil
+}
+
+// handleAPILibraryStats serves GET /api/stats.
+func (s *server) handleAPILibraryStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.libraryStats(r.Context(), time.Now())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	writeJSON(w, stats)
+}
+
+// statsPanel is the data for stats.html.
+type statsPanel struct {
+	libraryStats
+	Size     string // total size, formatted
+	Served   string // bytes streamed, formatted
+	Disks    []growthChartDir
+	Streamed []growthChartDir // the most streamed videos, by title
+	Bars     []statsBar
+}
+
+// statsBar is one week in the watch hours chart.
+type statsBar struct {
+	statsWeek
+	Percent float64 // of the busiest week
+}
+
+// buildStatsPanel lays out stats for stats.html, scaling the weekly bars to
+// the busiest week.
+func buildStatsPanel(stats libraryStats) statsPanel {
+	p := statsPanel{libraryStats: stats, Size: formatBytes(stats.Bytes), Served: formatBytes(stats.BytesServed)}
+	for _, d := range stats.Directories {
+		p.Disks = append(p.Disks, growthChartDir{Title: d.Title, Size: formatBytes(d.Bytes)})
+	}
+	for _, v := range stats.MostStreamed {
+		p.Streamed = append(p.Streamed, growthChartDir{Title: v.Title, Size: formatBytes(v.Bytes)})
+	}
+	busiest := 0.0
+	for _, wk := range stats.WeeklyHours {
+		busiest = max(busiest, wk.Hours)
+	}
+	for _, wk := range stats.WeeklyHours {
+		bar := statsBar{statsWeek: wk}
+		if busiest > 0 {
+			bar.Percent = wk.Hours / busiest * 100
+		}
+		p.Bars = append(p.Bars, bar)
+	}
+	return p
+}
+
+// handleLibraryStats renders GET /stats, the library statistics shown in
+// settings.
+func (s *server) handleLibraryStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.libraryStats(r.Context(), time.Now())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "stats.html", buildStatsPanel(stats))
+}
+
+// snapshotDay formats t as a library_snapshots day key.
+func snapshotDay(t time.Time) string {
+	return t.Format(time.DateOnly)
+}
+
+// startSnapshotRecorder records a library snapshot now and then every
+// snapshotEvery until ctx is cancelled.
+func (s *server) startSnapshotRecorder(ctx context.Context) {
+	record := func() {
+		if s.maintenance.Load() {
+			return
+		}
+		if err := s.store.RecordLibrarySnapshot(ctx, snapshotDay(time.Now())); err != nil {
+			slog.Warn("record library snapshot failed", "err", err)
+		}
+	}
+	record()
+	ticker := time.NewTicker(snapshotEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			record()
+		}
+	}
+}
+
+// growthDirectory is one directory's share of a growth point.
+type growthDirectory struct {
+	ID     int64 `json:"id"`
+	Videos int   `json:"videos"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// growthPoint is the library's size on one day.
+type growthPoint struct {
+	Day         string            `json:"day"`
+	Videos      int               `json:"videos"`
+	Bytes       int64             `json:"bytes"`
+	Directories []growthDirectory `json:"directories"`
+}
+
+// libraryGrowth folds the snapshots of the last days days into one point
+// per day, oldest first.
+func (s *server) libraryGrowth(ctx context.Context, days int) ([]growthPoint, error) {
+	since := snapshotDay(time.Now().AddDate(0, 0, -(days - 1)))
+	snaps, err := s.store.ListLibrarySnapshots(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	var points []growthPoint
+	for _, snap := range snaps {
+		if len(points) == 0 || points[len(points)-1].Day != snap.Day {
+			points = append(points, growthPoint{Day: snap.Day})
+		}
+		p := &points[len(points)-1]
+		p.Videos += snap.Videos
+		p.Bytes += snap.Bytes
+		p.Directories = append(p.Directories, growthDirectory{ID: snap.DirectoryID, Videos: snap.Videos, Bytes: snap.Bytes})
+	}
+	return points, nil
+}
+
+// growthDays reads ?days=, defaulting to growthDefaultDays.
+func growthDays(r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("days")
+	if v == "" {
+		return growthDefaultDays, true
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 1 || days > 3650 {
+		return 0, false
+	}
+	return days, true
+}
+
+// handleAPILibraryGrowth serves GET /api/stats/growth?days=N: the daily
+// video count and size of the library and of each directory.
+func (s *server) handleAPILibraryGrowth(w http.ResponseWriter, r *http.Request) {
+	days, ok := growthDays(r)
+	if !ok {
+		http.Error(w, "days must be between 1 and 3650", http.StatusBadRequest)
+		return
+	}
+	points, err := s.libraryGrowth(r.Context(), days)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	dirs, err := s.store.ListDirectories(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	type apiGrowthDir struct {
+		ID    int64  `json:"id"`
+		Path  string `json:"path"`
+		Title string `json:"title"`
+	}
+	out := struct {
+		Directories []apiGrowthDir `json:"directories"`
+		Series      []growthPoint  `json:"series"`
+	}{Directories: []apiGrowthDir{}, Series: points}
+	for _, d := range dirs {
+		out.Directories = append(out.Directories, apiGrowthDir{ID: d.ID, Path: d.Path, Title: d.Title()})
+	}
+	if out.Series == nil {
+		out.Series = []growthPoint{}
+	}
+	writeJSON(w, out)
+}
+
+// growthChart is the data for stats_growth.html.
+type growthChart struct {
+	Days        int
+	Points      string // SVG polyline points for total size
+	First       growthPoint
+	Last        growthPoint
+	Size        string // current size, formatted
+	PerDay      string // average growth per day over the window, formatted
+	Directories []growthChartDir
+}
+
+// growthChartDir is one row of the per-directory table.
+type growthChartDir struct {
+	Title  string
+	Videos int
+	Size   string
+}
+
+// Chart dimensions in SVG user units.
+const (
+	growthChartW = 600
+	growthChartH = 120
+)
+
+// buildGrowthChart lays out points as a size-over-time polyline.
+func buildGrowthChart(points []growthPoint, days int, titles map[int64]string) growthChart {
+	c := growthChart{Days: days}
+	if len(points) == 0 {
+		return c
+	}
+	c.First, c.Last = points[0], points[len(points)-1]
+	c.Size = formatBytes(c.Last.Bytes)
+
+	var maxBytes int64 = 1
+	for _, p := range points {
+		maxBytes = max(maxBytes, p.Bytes)
+	}
+	coords := make([]string, len(points))
+	for i, p := range points {
+		x := 0.0
+		if len(points) > 1 {
+			x = float64(i) / float64(len(points)-1) * growthChartW
+		}
+		y := growthChartH - float64(p.Bytes)/float64(maxBytes)*growthChartH
+		coords[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	c.Points = strings.Join(coords, " ")
+
+	if first, err := time.Parse(time.DateOnly, c.First.Day); err == nil {
+		if last, err := time.Parse(time.DateOnly, c.Last.Day); err == nil {
+			if span := int64(last.Sub(first).Hours() / 24); span > 0 {
+				perDay := (c.Last.Bytes - c.First.Bytes) / span
+				if perDay < 0 {
+					c.PerDay = "-" + formatBytes(-perDay)
+				} else {
+					c.PerDay = formatBytes(perDay)
+				}
+			}
+		}
+	}
+	for _, d := range c.Last.Directories {
+		title, ok := titles[d.ID]
+		if !ok {
+			title = "(removed directory)"
+		}
+		c.Directories = append(c.Directories, growthChartDir{Title: title, Videos: d.Videos, Size: formatBytes(d.Bytes)})
+	}
+	return c
+}
+
+// handleLibraryGrowth renders GET /stats/growth, the growth chart shown in
+// settings.
+func (s *server) handleLibraryGrowth(w http.ResponseWriter, r *http.Request) {
+	days, ok := growthDays(r)
+	if !ok {
+		http.Error(w, "days must be between 1 and 3650", http.StatusBadRequest)
+		return
+	}
+	points, err := s.libraryGrowth(r.Context(), days)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	dirs, err := s.store.ListDirectories(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	titles := make(map[int64]string, len(dirs))
+	for _, d := range dirs {
+		titles[d.ID] = d.Title()
+	}
+	render(w, "stats_growth.html", buildGrowthChart(points, days, titles))
+}
+
+// tagRatings returns the rating summary of every tag in use, keyed by tag
+// name; a show's is under "show:NAME".
+func (s *server) tagRatings(ctx context.Context) (map[string]store.TagRating, error) {
+	list, err := s.store.ListTagRatings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]store.TagRating, len(list))
+	for _, tr := range list {
+		out[tr.Name] = tr
+	}
+	return out, nil
+}
+
+// ratedGroup is a show or tag with the rating summary of its videos.
+type ratedGroup struct {
+	Name   string `json:"name"`
+	Videos int    `json:"videos"`
+	apiRating
+}
+
+// ratingStats is the body of GET /api/stats/ratings, best rated first.
+type ratingStats struct {
+	Shows []ratedGroup `json:"shows"`
+	Tags  []ratedGroup `json:"tags"`
+}
+
+// rankRatings splits the tag ratings into shows and other tags, each ranked
+// best first.
+func rankRatings(list []store.TagRating) ratingStats {
+	out := ratingStats{Shows: []ratedGroup{}, Tags: []ratedGroup{}}
+	for _, tr := range list {
+		g := ratedGroup{Name: tr.Name, Videos: tr.Videos, apiRating: ratingToAPI(tr)}
+		if show, ok := strings.CutPrefix(tr.Name, "show:"); ok {
+			g.Name = show
+			out.Shows = append(out.Shows, g)
+		} else {
+			out.Tags = append(out.Tags, g)
+		}
+	}
+	for _, groups := range [][]ratedGroup{out.Shows, out.Tags} {
+		sort.SliceStable(groups, func(i, j int) bool { return ratedAbove(groups[i].apiRating, groups[j].apiRating) })
+	}
+	return out
+}
+
+// handleAPIRatingStats serves GET /api/stats/ratings.
+func (s *server) handleAPIRatingStats(w http.ResponseWriter, r *http.Request) {
+	list, err := s.store.ListTagRatings(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	writeJSON(w, rankRatings(list))
+}
+
+// handleRatingStats renders GET /stats/ratings, the best rated shows and
+// tags shown in settings. Groups with no rated video are left out.
+func (s *server) handleRatingStats(w http.ResponseWriter, r *http.Request) {
+	list, err := s.store.ListTagRatings(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	stats := rankRatings(list)
+	top := func(groups []ratedGroup) []ratedGroup {
+		n := 0
+		for n < len(groups) && n < ratingStatsTop && groups[n].Average > 0 {
+			n++
+		}
+		return groups[:n]
+	}
+	render(w, "stats_ratings.html", ratingStats{Shows: top(stats.Shows), Tags: top(stats.Tags)})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/internal/fixture"
+)
+
+func TestBuildGrowthChart(t *testing.T) {
+	points := []growthPoint{
+		{Day: "2026-01-01", Videos: 1, Bytes: 1 << 30, Directories: []growthDirectory{{ID: 1, Videos: 1, Bytes: 1 << 30}}},
+		{Day: "2026-01-11", Videos: 3, Bytes: 11 << 30, Directories: []growthDirectory{{ID: 1, Videos: 2, Bytes: 6 << 30}, {ID: 9, Videos: 1, Bytes: 5 << 30}}},
+	}
+	c := buildGrowthChart(points, 30, map[int64]string{1: "Movies"})
+	if c.Points != "0.0,109.1 600.0,0.0" {
+		t.Errorf("Points = %q", c.Points)
+	}
+	if c.PerDay != "1.0 GB" {
+		t.Errorf("PerDay = %q, want 1.0 GB", c.PerDay)
+	}
+	if len(c.Directories) != 2 || c.Directories[0].Title != "Movies" || c.Directories[1].Title != "(removed directory)" {
+		t.Errorf("unexpected directory rows: %+v", c.Directories)
+	}
+}
+
+func TestHandleAPILibraryGrowth(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	srv.store.UpdateVideoFileStat(ctx, v.ID, 2048, time.Unix(0, 0))                 //nolint:errcheck
+	srv.store.RecordLibrarySnapshot(ctx, snapshotDay(time.Now()))                   //nolint:errcheck
+	srv.store.RecordLibrarySnapshot(ctx, snapshotDay(time.Now().AddDate(-1, 0, 0))) //nolint:errcheck
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats/growth?days=30", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var got struct {
+		Directories []struct {
+			ID int64 `json:"id"`
+		} `json:"directories"`
+		Series []growthPoint `json:"series"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Series) != 1 || got.Series[0].Bytes != 2048 || got.Series[0].Videos != 1 {
+		t.Errorf("expected only today's snapshot within 30 days, got %+v", got.Series)
+	}
+	if len(got.Directories) != 1 || got.Directories[0].ID != d.ID {
+		t.Errorf("unexpected directories: %+v", got.Directories)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats/growth?days=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for days=0, got %d", rec.Code)
+	}
+}
+
+func TestHandleLibraryGrowth_Empty(t *testing.T) {
+	srv := newTestServer(t)
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/growth", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "No history yet") {
+		t.Errorf("expected the empty state, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRatingStats(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	comedy, _ := srv.store.UpsertTag(ctx, "comedy")
+	for i, v := range []struct {
+		show   string
+		rating int
+	}{{"Alpha", 0}, {"Alpha", 2}, {"Beta", 1}, {"Beta", 2}} {
+		vid, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "ep"+itoa(int64(i))+".mp4")
+		srv.store.UpdateVideoShowName(ctx, vid.ID, v.show) //nolint:errcheck
+		srv.store.SetVideoRating(ctx, vid.ID, v.rating)    //nolint:errcheck
+		if v.show == "Alpha" {
+			srv.store.TagVideo(ctx, vid.ID, comedy.ID) //nolint:errcheck
+		}
+	}
+
+	var stats ratingStats
+	if code := apiGet(t, srv, "/api/stats/ratings", &stats); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(stats.Shows) != 2 || stats.Shows[0].Name != "Beta" || stats.Shows[0].Average != 1.5 ||
+		stats.Shows[1].Average != 1 || stats.Shows[1].Favourites != 1 {
+		t.Errorf("unexpected show ratings: %+v", stats.Shows)
+	}
+	if len(stats.Tags) != 1 || stats.Tags[0].Name != "comedy" || stats.Tags[0].Videos != 2 {
+		t.Errorf("unexpected tag ratings: %+v", stats.Tags)
+	}
+
+	var shows []apiShow
+	apiGet(t, srv, "/api/shows?sort=rating", &shows)
+	if len(shows) != 2 || shows[0].Title != "Beta" || shows[0].Rating.Liked != 1 {
+		t.Errorf("shows by rating: %+v", shows)
+	}
+	var tags []apiTag
+	apiGet(t, srv, "/api/tags", &tags)
+	for _, tag := range tags {
+		if tag.Name == "comedy" && (tag.Rating == nil || tag.Rating.Average != 1) {
+			t.Errorf("comedy tag rating = %+v", tag.Rating)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/ratings", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "Beta") || !strings.Contains(body, "1.50") {
+		t.Errorf("panel missing the best show:\n%s", body)
+	}
+}
+
+func TestLibraryStats(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := t.Context()
+	movies, _ := srv.store.AddDirectory(ctx, "/movies")
+	shows, _ := srv.store.AddDirectory(ctx, "/shows")
+	film := fixture.AddVideo(t, srv.store, movies, fixture.Video{Filename: "film.mp4", Duration: 7200})
+	ep := fixture.AddVideo(t, srv.store, shows, fixture.Video{Filename: "ep.mp4", Duration: 1800})
+	srv.store.UpdateVideoFileStat(ctx, film.ID, 3000, time.Unix(0, 0)) //nolint:errcheck
+	srv.store.UpdateVideoFileStat(ctx, ep.ID, 1000, time.Unix(0, 0))   //nolint:errcheck
+	for range 2 {
+		srv.store.RecordWatch(ctx, ep.ID, 1800) //nolint:errcheck
+		srv.store.ClearWatch(ctx, ep.ID)        //nolint:errcheck
+	}
+	srv.store.RecordWatch(ctx, film.ID, 7200) //nolint:errcheck
+
+	var stats libraryStats
+	if code := apiGet(t, srv, "/api/stats", &stats); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if stats.Videos != 2 || stats.DurationS != 9000 || stats.Bytes != 4000 {
+		t.Errorf("totals = %d videos, %v s, %d bytes", stats.Videos, stats.DurationS, stats.Bytes)
+	}
+	if len(stats.Directories) != 2 || stats.Directories[0].ID != movies.ID || stats.Directories[0].Bytes != 3000 {
+		t.Errorf("directories = %+v, want /movies first", stats.Directories)
+	}
+	if len(stats.MostWatched) != 2 || stats.MostWatched[0].ID != ep.ID || stats.MostWatched[0].Watches != 2 {
+		t.Errorf("most watched = %+v, want the episode twice first", stats.MostWatched)
+	}
+	if len(stats.WeeklyHours) != 1 || stats.WeeklyHours[0].Watches != 3 || stats.WeeklyHours[0].Hours != 3 {
+		t.Errorf("weekly hours = %+v, want 3 watches over 3 hours this week", stats.WeeklyHours)
+	}
+
+	body := doAs(srv, nil, http.MethodGet, "/stats", nil).Body.String()
+	if !strings.Contains(body, "2:30:00") || !strings.Contains(body, "3.0 h") {
+		t.Errorf("panel missing the totals or this week:\n%s", body)
+	}
+}
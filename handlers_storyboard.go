@@ -0,0 +1,254 @@
+// handlers_storyboard.go – scrub preview sprite sheets.
+//
+// A storyboard is a set of JPEG sprite sheets, each tiling storyboardColumns
+// × storyboardRows small frames taken at a fixed interval, plus a WebVTT
+// "thumbnails" track whose cues point at a frame with a #xywh= fragment. The
+// player uses it to show a preview while hovering the seek bar.
+//
+// GET /videos/{id}/storyboard         – status JSON; queues generation
+// GET /videos/{id}/storyboard.vtt     – the thumbnails track, once ready
+// GET /videos/{id}/storyboard/{sheet} – sprite sheet n, e.g. 0.jpg
+//
+// Storyboards are built in the background, one ffmpeg run at a time per
+// video and sharing the convert slots, and cached in storyboardCacheDir
+// keyed by the file's size and modification time.
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg" // sprite sheet dimensions
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/store"
+	"github.com/maxgarvey/video_manger/transcode"
+)
+
+// storyboardCacheDir holds generated storyboards, one folder per video and
+// file version. Sprite sheets for a long library take real disk space, so
+// main puts them beside the database, where the user can see and clear them.
+var storyboardCacheDir = filepath.Join(os.TempDir(), "video_manger-storyboards")
+
+const storyboardVTT = "storyboard.vtt"
+
+// storyboardJob is a storyboard being generated, or one that failed.
+type storyboardJob struct {
+	done     chan struct{} // closed when the run ends
+	err      error         // set before done is closed
+	finished time.Time     // set before done is closed
+}
+
+// storyboardStatus is the JSON body of GET /videos/{id}/storyboard.
+type storyboardStatus struct {
+	Status string `json:"status"` // "ready", "running", "failed" or "unavailable"
+	VTT    string `json:"vtt,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// storyboardDir is where v's storyboard lives for the file's current
+// contents.
+func storyboardDir(v store.Video, fi os.FileInfo) string {
+	return filepath.Join(storyboardCacheDir,
+		fmt.Sprintf("%d-%x-%x", v.ID, fi.Size(), fi.ModTime().UnixNano()))
+}
+
+// storyboardInterval spaces frames so a video yields at most
+// storyboardMaxFrames of them, and never closer than storyboardMinGap.
+func storyboardInterval(durationS float64) float64 {
+	return math.Max(storyboardMinGap, math.Ceil(durationS/storyboardMaxFrames))
+}
+
+// storyboard reports the state of v's storyboard, queueing a run when there
+// is none yet. A failed run is retried after storyboardRetryWait.
+func (s *server) storyboard(v store.Video) (dir string, status storyboardStatus) {
+	fi, err := s.blobs.Stat(v.FilePath())
+	if err != nil {
+		return "", storyboardStatus{Status: "unavailable", Error: "video file not found"}
+	}
+	dir = storyboardDir(v, fi)
+	if _, err := os.Stat(filepath.Join(dir, storyboardVTT)); err == nil {
+		return dir, storyboardStatus{Status: "ready", VTT: "/videos/" + strconv.FormatInt(v.ID, 10) + "/" + storyboardVTT}
+	}
+	s.storyboardMu.Lock()
+	defer s.storyboardMu.Unlock()
+	if job, ok := s.storyboards[dir]; ok {
+		select {
+		case <-job.done:
+			if time.Since(job.finished) < storyboardRetryWait {
+				// The error names server paths; it is logged, not returned.
+				return dir, storyboardStatus{Status: "failed", Error: "generation failed, see the server log"}
+			}
+		default:
+			return dir, storyboardStatus{Status: "running"}
+		}
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return dir, storyboardStatus{Status: "unavailable", Error: "ffmpeg is not installed"}
+	}
+	if s.storyboards == nil {
+		s.storyboards = make(map[string]*storyboardJob)
+	}
+	job := &storyboardJob{done: make(chan struct{})}
+	s.storyboards[dir] = job
+	go s.runStoryboard(v, dir, job)
+	return dir, storyboardStatus{Status: "running"}
+}
+
+// runStoryboard generates v's storyboard into dir. It is built in a
+// temporary folder and renamed into place, so a folder holding the .vtt is
+// always complete.
+func (s *server) runStoryboard(v store.Video, dir string, job *storyboardJob) {
+	err := func() error {
+		s.convertSem <- struct{}{}
+		defer func() { <-s.convertSem }()
+
+		duration := v.DurationS
+		if duration <= 0 {
+			duration = metadata.ReadDuration(v.FilePath())
+		}
+		if duration <= 0 {
+			return fmt.Errorf("unknown duration")
+		}
+		tmp := dir + ".tmp-" + newToken()
+		if err := os.MkdirAll(tmp, 0755); err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp) //nolint:errcheck
+		opts := transcode.StoryboardOptions{
+			IntervalSecs: storyboardInterval(duration),
+			TileWidth:    storyboardTileWidth,
+			Columns:      storyboardColumns,
+			Rows:         storyboardRows,
+		}
+		if err := transcode.Storyboard(context.Background(), v.FilePath(), tmp, opts); err != nil {
+			return err
+		}
+		if err := writeStoryboardVTT(tmp, duration, opts); err != nil {
+			return err
+		}
+		pruneStoryboards(v)
+		return os.Rename(tmp, dir)
+	}()
+
+	s.storyboardMu.Lock()
+	job.err, job.finished = err, time.Now()
+	if err == nil {
+		delete(s.storyboards, dir)
+	} else {
+		slog.Warn("storyboard generation failed", "path", v.FilePath(), "err", err)
+	}
+	close(job.done)
+	s.storyboardMu.Unlock()
+}
+
+// writeStoryboardVTT writes the thumbnails track for the sheets in dir. The
+// frame height is read back from the first sheet, since ffmpeg picks it from
+// the video's aspect ratio.
+func writeStoryboardVTT(dir string, duration float64, opts transcode.StoryboardOptions) error {
+	f, err := os.Open(filepath.Join(dir, transcode.StoryboardSheetName(0)))
+	if err != nil {
+		return fmt.Errorf("no sprite sheets written: %w", err)
+	}
+	cfg, _, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("read sprite sheet: %w", err)
+	}
+	sheets := 0
+	for {
+		if _, err := os.Stat(filepath.Join(dir, transcode.StoryboardSheetName(sheets))); err != nil {
+			break
+		}
+		sheets++
+	}
+	perSheet := opts.Columns * opts.Rows
+	tileW, tileH := cfg.Width/opts.Columns, cfg.Height/opts.Rows
+	frames := min(int(math.Ceil(duration/opts.IntervalSecs)), sheets*perSheet)
+
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i := range frames {
+		start := float64(i) * opts.IntervalSecs
+		end := math.Min(start+opts.IntervalSecs, duration)
+		k := i % perSheet
+		fmt.Fprintf(&b, "\n%s --> %s\nstoryboard/%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), transcode.StoryboardSheetName(i/perSheet),
+			k%opts.Columns*tileW, k/opts.Columns*tileH, tileW, tileH)
+	}
+	return os.WriteFile(filepath.Join(dir, storyboardVTT), []byte(b.String()), 0644)
+}
+
+// vttTimestamp formats secs as a WebVTT cue time, e.g. 01:02:03.500.
+func vttTimestamp(secs float64) string {
+	ms := int64(math.Round(secs * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// pruneStoryboards removes v's storyboards for earlier versions of the file.
+func pruneStoryboards(v store.Video) {
+	old, _ := filepath.Glob(filepath.Join(storyboardCacheDir, strconv.FormatInt(v.ID, 10)+"-*"))
+	for _, p := range old {
+		if !strings.Contains(filepath.Base(p), ".tmp-") {
+			os.RemoveAll(p) //nolint:errcheck
+		}
+	}
+}
+
+func (s *server) handleStoryboardStatus(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	_, status := s.storyboard(video)
+	writeJSON(w, status)
+}
+
+func (s *server) handleStoryboardVTT(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	dir, status := s.storyboard(video)
+	if status.Status != "ready" {
+		http.Error(w, "storyboard "+status.Status, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	http.ServeFile(w, r, filepath.Join(dir, storyboardVTT))
+}
+
+func (s *server) handleStoryboardSheet(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(chi.URLParam(r, "sheet"), ".jpg"))
+	if err != nil || n < 0 {
+		http.Error(w, "invalid sheet", http.StatusBadRequest)
+		return
+	}
+	dir, status := s.storyboard(video)
+	if status.Status != "ready" {
+		http.Error(w, "storyboard "+status.Status, http.StatusNotFound)
+		return
+	}
+	path := filepath.Join(dir, transcode.StoryboardSheetName(n))
+	if _, err := os.Stat(path); err != nil {
+		http.Error(w, "sheet not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeFile(w, r, path)
+}
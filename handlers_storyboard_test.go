@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/transcode"
+)
+
+// writeSheet writes a blank w×h JPEG to path.
+func writeSheet(t *testing.T, path string, w, h int) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := jpeg.Encode(f, image.NewGray(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoryboardInterval(t *testing.T) {
+	for _, c := range []struct{ dur, want float64 }{
+		{30, storyboardMinGap},
+		{6000, 20},
+		{6001, 21},
+	} {
+		if got := storyboardInterval(c.dur); got != c.want {
+			t.Errorf("storyboardInterval(%g) = %g, want %g", c.dur, got, c.want)
+		}
+	}
+	if got := vttTimestamp(3723.5); got != "01:02:03.500" {
+		t.Errorf("vttTimestamp = %q", got)
+	}
+}
+
+func TestWriteStoryboardVTT(t *testing.T) {
+	dir := t.TempDir()
+	writeSheet(t, filepath.Join(dir, "0.jpg"), 1600, 900)
+	writeSheet(t, filepath.Join(dir, "1.jpg"), 1600, 900)
+	opts := transcode.StoryboardOptions{IntervalSecs: 2, TileWidth: 160, Columns: 10, Rows: 10}
+	if err := writeStoryboardVTT(dir, 250, opts); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, storyboardVTT))
+	vtt := string(data)
+	for _, want := range []string{
+		"WEBVTT\n",
+		"\n00:00:00.000 --> 00:00:02.000\nstoryboard/0.jpg#xywh=0,0,160,90\n",
+		"\n00:00:24.000 --> 00:00:26.000\nstoryboard/0.jpg#xywh=320,90,160,90\n",
+		"\n00:03:22.000 --> 00:03:24.000\nstoryboard/1.jpg#xywh=160,0,160,90\n",
+		"\n00:04:08.000 --> 00:04:10.000\n",
+	} {
+		if !strings.Contains(vtt, want) {
+			t.Errorf("expected %q in:\n%s", want, vtt)
+		}
+	}
+	if n := strings.Count(vtt, " --> "); n != 125 {
+		t.Errorf("expected 125 cues for 250s at 2s, got %d", n)
+	}
+}
+
+// writeStoryboardStub installs an ffmpeg that copies a 1600×900 sheet to
+// 0.jpg in the output directory, or fails when fail is set.
+func writeStoryboardStub(t *testing.T, fail bool) {
+	t.Helper()
+	bin := t.TempDir()
+	sheet := filepath.Join(bin, "sheet.jpg")
+	writeSheet(t, sheet, 1600, 900)
+	script := `#!/bin/sh
+for last; do true; done
+cp "` + sheet + `" "$(dirname "$last")/0.jpg"
+`
+	if fail {
+		script = "#!/bin/sh\necho broken >&2\nexit 1\n"
+	}
+	os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(script), 0755) //nolint:errcheck
+	// Keep the rest of PATH for cp and dirname; the stub still shadows ffmpeg.
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	orig := storyboardCacheDir
+	storyboardCacheDir = t.TempDir()
+	t.Cleanup(func() { storyboardCacheDir = orig })
+}
+
+// waitStoryboard polls the status endpoint until generation has finished.
+func waitStoryboard(t *testing.T, srv *server, id int64) storyboardStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var st storyboardStatus
+		json.NewDecoder(doAs(srv, nil, http.MethodGet, "/videos/"+itoa(id)+"/storyboard", nil).Body).Decode(&st) //nolint:errcheck
+		if st.Status != "running" || time.Now().After(deadline) {
+			return st
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleStoryboard_GeneratesInBackground(t *testing.T) {
+	writeStoryboardStub(t, false)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	srv.store.UpdateVideoDuration(ctx, v.ID, 20) //nolint:errcheck
+	base := "/videos/" + itoa(v.ID) + "/"
+
+	if rec := doAs(srv, nil, http.MethodGet, base+"storyboard.vtt", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 before the storyboard exists, got %d", rec.Code)
+	}
+	st := waitStoryboard(t, srv, v.ID)
+	if st.Status != "ready" || st.VTT != base+"storyboard.vtt" {
+		t.Fatalf("expected a ready storyboard, got %+v", st)
+	}
+	rec := doAs(srv, nil, http.MethodGet, base+"storyboard.vtt", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "WEBVTT") ||
+		strings.Count(rec.Body.String(), " --> ") != 10 {
+		t.Errorf("expected a 10-cue thumbnails track, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := doAs(srv, nil, http.MethodGet, base+"storyboard/0.jpg", nil); rec.Code != http.StatusOK {
+		t.Errorf("sheet 0: expected 200, got %d", rec.Code)
+	}
+	if rec := doAs(srv, nil, http.MethodGet, base+"storyboard/1.jpg", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("sheet 1: expected 404, got %d", rec.Code)
+	}
+	if rec := doAs(srv, nil, http.MethodGet, base+"storyboard/..%2Fx", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad sheet name: expected 400, got %d", rec.Code)
+	}
+}
+
+func TestHandleStoryboard_FailureIsNotRetriedAtOnce(t *testing.T) {
+	writeStoryboardStub(t, true)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	srv.store.UpdateVideoDuration(ctx, v.ID, 20) //nolint:errcheck
+
+	if st := waitStoryboard(t, srv, v.ID); st.Status != "failed" || strings.Contains(st.Error, "broken") {
+		t.Fatalf("expected a failed storyboard, got %+v", st)
+	}
+	if st := waitStoryboard(t, srv, v.ID); st.Status != "failed" {
+		t.Errorf("expected the failure to be remembered, got %+v", st)
+	}
+}
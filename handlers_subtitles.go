@@ -0,0 +1,194 @@
+// handlers_subtitles.go – subtitle streams embedded in video files.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// textSubtitleCodecs are the embedded subtitle formats ffmpeg can convert to
+// WebVTT. Image-based ones (PGS, VobSub) would need OCR and are skipped.
+var textSubtitleCodecs = []string{"subrip", "ass", "ssa", "webvtt", "mov_text", "text"}
+
+// subtitleCacheDir holds WebVTT extracted from embedded subtitle streams.
+// Extractions are slow, so main keeps them beside the database, where they
+// survive restarts, rather than in the temp directory used by default.
+var subtitleCacheDir = filepath.Join(os.TempDir(), "video_manger-subtitles")
+
+// subtitleTrack is an embedded subtitle stream the player can offer.
+type subtitleTrack struct {
+	Track    int    // position among the file's subtitle streams (ffmpeg's 0:s:N)
+	Language string // ISO 639-2, e.g. "eng"; empty if untagged
+	Label    string
+	Default  bool // shown when the player opens
+}
+
+// subtitleTracks lists the text subtitle streams among a file's streams.
+func subtitleTracks(streams []metadata.Stream) []subtitleTrack {
+	var tracks []subtitleTrack
+	n := 0
+	for _, st := range streams {
+		if st.CodecType != "subtitle" {
+			continue
+		}
+		track := n
+		n++
+		if !slices.Contains(textSubtitleCodecs, st.CodecName) {
+			continue
+		}
+		lang := st.Language
+		if lang == "und" {
+			lang = ""
+		}
+		label := st.Title
+		if label == "" {
+			label = lang
+		}
+		if label == "" {
+			label = fmt.Sprintf("Track %d", track+1)
+		}
+		tracks = append(tracks, subtitleTrack{Track: track, Language: lang, Label: label})
+	}
+	return tracks
+}
+
+// sidecarSubtitle is a subtitle file beside a video, e.g. "film.en.srt".
+type sidecarSubtitle struct {
+	File     string // base name, passed back as ?file=
+	Language string // language qualifier such as "en"; empty if none
+	Label    string
+	Default  bool // shown when the player opens
+}
+
+// videoSubtitles lists the subtitle sidecars syncDir catalogued for video.
+func (s *server) videoSubtitles(ctx context.Context, video store.Video) []sidecarSubtitle {
+	sidecars, err := s.store.ListVideoSidecars(ctx, video.ID)
+	if err != nil {
+		slog.Warn("list sidecars failed", "videoID", video.ID, "err", err)
+	}
+	return sidecarSubtitles(video, sidecars)
+}
+
+// sidecarSubtitles picks the .srt and .vtt files out of video's sidecars,
+// the one named exactly after the video first.
+func sidecarSubtitles(video store.Video, sidecars []store.Sidecar) []sidecarSubtitle {
+	stem := strings.TrimSuffix(video.Filename, filepath.Ext(video.Filename))
+	var primary, qualified []sidecarSubtitle
+	for _, sc := range sidecars {
+		if sc.Kind != store.SidecarSubtitle {
+			continue
+		}
+		name := filepath.Base(sc.Path)
+		// "film.forced.en.srt" → qualifier "forced.en", language "en".
+		qual := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSuffix(name, filepath.Ext(name)), stem), ".")
+		if qual == "" {
+			primary = append(primary, sidecarSubtitle{File: name, Label: "Subtitles"})
+			continue
+		}
+		sub := sidecarSubtitle{File: name, Label: qual}
+		if last := qual[strings.LastIndex(qual, ".")+1:]; len(last) == 2 || len(last) == 3 {
+			sub.Language = last
+		}
+		qualified = append(qualified, sub)
+	}
+	return append(primary, qualified...)
+}
+
+// handleServeSubtitles serves a subtitle file beside the video as WebVTT
+// (SRT is converted on the fly) so the browser <track> element can consume
+// it directly. ?file= picks one of sidecarSubtitles; without it the first
+// is served.
+func (s *server) handleServeSubtitles(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	subs := s.videoSubtitles(r.Context(), video)
+	file := r.URL.Query().Get("file")
+	i := slices.IndexFunc(subs, func(sub sidecarSubtitle) bool { return file == "" || sub.File == file })
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(video.DirectoryPath, subs[i].File))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	text := string(data)
+	if !strings.EqualFold(filepath.Ext(subs[i].File), ".vtt") {
+		text = srtToWebVTT(text)
+	}
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	fmt.Fprint(w, text)
+}
+
+// handleEmbeddedSubtitles serves GET /videos/{id}/subtitles/{track}: the
+// file's track-th subtitle stream converted to WebVTT. Conversions are
+// cached per file modification time, so an edited file is re-extracted.
+func (s *server) handleEmbeddedSubtitles(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	track, err := strconv.Atoi(chi.URLParam(r, "track"))
+	if err != nil || track < 0 {
+		http.Error(w, "invalid track", http.StatusBadRequest)
+		return
+	}
+	info, err := s.blobs.Stat(video.FilePath())
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	cached := filepath.Join(subtitleCacheDir,
+		fmt.Sprintf("%d-%d-%d.vtt", video.ID, track, info.ModTime().UnixNano()))
+	if _, err := os.Stat(cached); err != nil {
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			http.Error(w, "ffmpeg is not installed", http.StatusServiceUnavailable)
+			return
+		}
+		if err := extractSubtitle(video.FilePath(), track, cached); err != nil {
+			slog.Warn("subtitle extraction failed", "video_id", video.ID, "track", track, "err", err)
+			http.Error(w, "subtitle track not found", http.StatusNotFound)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	http.ServeFile(w, r, cached)
+}
+
+// extractSubtitle converts subtitle stream track of src to WebVTT at dest.
+// It writes to a temporary file first so concurrent requests never see a
+// partial conversion.
+func extractSubtitle(src string, track int, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".extract-*.vtt")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	out, err := exec.Command("ffmpeg", "-v", "error", "-y", //nolint:gosec
+		"-i", src, "-map", "0:s:"+strconv.Itoa(track), "-f", "webvtt", tmp.Name()).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, out)
+	}
+	return os.Rename(tmp.Name(), dest)
+}
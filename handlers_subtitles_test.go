@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestSubtitleTracks(t *testing.T) {
+	streams := []metadata.Stream{
+		{CodecType: "video", CodecName: "h264"},
+		{CodecType: "subtitle", CodecName: "subrip", Language: "eng", Title: "English (SDH)"},
+		{CodecType: "subtitle", CodecName: "hdmv_pgs_subtitle", Language: "eng"},
+		{CodecType: "subtitle", CodecName: "ass", Language: "fre"},
+		{CodecType: "subtitle", CodecName: "mov_text", Language: "und"},
+	}
+	got := subtitleTracks(streams)
+	want := []subtitleTrack{
+		{Track: 0, Language: "eng", Label: "English (SDH)"},
+		{Track: 2, Language: "fre", Label: "fre"},
+		{Track: 3, Label: "Track 4"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("track %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// writeSubtitleStubs installs an ffprobe reporting one English subtitle
+// stream and an ffmpeg that writes a WebVTT file to its last argument,
+// counting its invocations in bin/calls.
+func writeSubtitleStubs(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	probe := `#!/bin/sh
+echo '{"streams":[{"index":0,"codec_type":"video","codec_name":"h264"},{"index":1,"codec_type":"subtitle","codec_name":"subrip","tags":{"language":"eng"}}]}'
+`
+	ffmpeg := `#!/bin/sh
+echo x >> "` + filepath.Join(bin, "calls") + `"
+for last; do true; done
+printf 'WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n' > "$last"
+`
+	os.WriteFile(filepath.Join(bin, "ffprobe"), []byte(probe), 0755) //nolint:errcheck
+	os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(ffmpeg), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin)
+	subtitleCacheDir = t.TempDir()
+	t.Cleanup(func() { subtitleCacheDir = filepath.Join(os.TempDir(), "video_manger-subtitles") })
+	return bin
+}
+
+func TestHandleEmbeddedSubtitles_ExtractsAndCaches(t *testing.T) {
+	bin := writeSubtitleStubs(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "film.mkv"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mkv")
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/"+itoa(v.ID)+"/subtitles/0", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d: %s", i, rec.Code, rec.Body.String())
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/vtt") {
+			t.Errorf("Content-Type = %q, want text/vtt", ct)
+		}
+		if !strings.Contains(rec.Body.String(), "Hello") {
+			t.Errorf("unexpected body: %q", rec.Body.String())
+		}
+	}
+	if calls, _ := os.ReadFile(filepath.Join(bin, "calls")); strings.Count(string(calls), "x") != 1 {
+		t.Errorf("expected one ffmpeg run with the second request cached, got %d", strings.Count(string(calls), "x"))
+	}
+}
+
+func TestHandleEmbeddedSubtitles_BadTrack(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mkv")
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/"+itoa(v.ID)+"/subtitles/-1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a negative track, got %d", rec.Code)
+	}
+}
+
+func TestHandlePlayer_ListsEmbeddedSubtitleTracks(t *testing.T) {
+	writeSubtitleStubs(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/play/"+itoa(v.ID), nil))
+	want := `<track kind="subtitles" src="/videos/` + itoa(v.ID) + `/subtitles/0" srclang="eng" label="eng">`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("expected player to render %s", want)
+	}
+}
+
+func TestSidecarSubtitles(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"film.mkv", "film.en.srt", "film.forced.de.vtt", "film.srt", "film.nfo", "other.srt"}
+	got := sidecarSubtitles(store.Video{Filename: "film.mkv", DirectoryPath: dir}, findSidecars(dir, "film.mkv", names))
+	want := []sidecarSubtitle{
+		{File: "film.srt", Label: "Subtitles"},
+		{File: "film.en.srt", Language: "en", Label: "en"},
+		{File: "film.forced.de.vtt", Language: "de", Label: "forced.de"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestHandleServeSubtitles_PicksVTTSidecarByFile(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("fake"), 0644)                                    //nolint:errcheck
+	os.WriteFile(filepath.Join(dir, "film.srt"), []byte("1\n00:00:01,000 --> 00:00:02,000\nSRT\n"), 0644) //nolint:errcheck
+	vtt := "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nDeutsch\n"
+	os.WriteFile(filepath.Join(dir, "film.de.vtt"), []byte(vtt), 0644) //nolint:errcheck
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	srv.syncDir(d)
+	v := onlyVideo(t, srv)
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/"+itoa(v.ID)+"/subtitles?file=film.de.vtt", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != vtt {
+		t.Errorf("expected the .vtt served unchanged, got %d: %q", rec.Code, rec.Body.String())
+	}
+
+	// Only catalogued sidecars are served; no reaching for other files.
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/"+itoa(v.ID)+"/subtitles?file=../film.mp4", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a file that is not a subtitle sidecar, got %d", rec.Code)
+	}
+}
+
+func TestHandlePlayer_ListsSidecarSubtitles(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"film.mp4", "film.srt", "film.fr.srt"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644) //nolint:errcheck
+	}
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	srv.syncDir(d)
+	v := onlyVideo(t, srv)
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/play/"+itoa(v.ID), nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`src="/videos/` + itoa(v.ID) + `/subtitles?file=film.srt" label="Subtitles" default>`,
+		`src="/videos/` + itoa(v.ID) + `/subtitles?file=film.fr.srt" srclang="fr" label="fr">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected player to contain %s", want)
+		}
+	}
+}
+
+func TestHandleGetMetadata_ListsCataloguedSidecars(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"film.mp4", "film.en.srt", "film.nfo"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644) //nolint:errcheck
+	}
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	srv.syncDir(d)
+	v := onlyVideo(t, srv)
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/"+itoa(v.ID)+"/metadata", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "Sidecar Files") || !strings.Contains(body, "film.en.srt") || !strings.Contains(body, "film.nfo") {
+		t.Errorf("expected catalogued sidecars in the metadata view:\n%s", body)
+	}
+}
+
+// onlyVideo returns the library's single video, failing when there is not
+// exactly one.
+func onlyVideo(t *testing.T, srv *server) store.Video {
+	t.Helper()
+	videos, err := srv.store.ListVideos(context.Background())
+	if err != nil || len(videos) != 1 {
+		t.Fatalf("expected one video, got %d (err %v)", len(videos), err)
+	}
+	return videos[0]
+}
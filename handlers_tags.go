@@ -0,0 +1,255 @@
+// handlers_tags.go – library-wide tag management.
+//
+// Tags are applied to videos one at a time or in batches elsewhere; this
+// panel works on the tags themselves. Renaming a tag renames it on every
+// video carrying it, merging folds a duplicate such as "Bobs Burgers" into
+// "Bob's Burgers", and deleting removes a tag from every video once the
+// count of videos carrying it has been confirmed. Each way, the affected
+// files' keywords are rewritten to match. A tag can also be given one of the
+// color labels and a sort order, so related tags sit together, marked alike,
+// wherever tag chips are shown. Namespaced tags (show:, genre: …) are edited
+// through their dedicated fields and are not listed.
+//
+// GET    /tags/manage              – tag list with video counts (settings panel)
+// PUT    /tags/{id}                – rename a tag, set its color and order (form values name, color, sort_order)
+// POST   /tags/{id}/merge          – merge a tag into another (form value into, a tag ID)
+// GET    /tags/{id}/delete-confirm – how many videos carry the tag (table row)
+// DELETE /tags/{id}                – delete a tag from every video
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// tagManager is the data behind tags_manage.html.
+type tagManager struct {
+	Tags  []store.TagCount
+	Error string
+	// MergeFrom and MergeInto are set when a rename hit an existing name,
+	// to offer merging the two instead.
+	MergeFrom, MergeInto store.Tag
+}
+
+func (s *server) renderTagManager(w http.ResponseWriter, r *http.Request, data tagManager) {
+	tags, err := s.store.ListTagCounts(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	data.Tags = tags
+	render(w, "tags_manage.html", data)
+}
+
+// syncTagFiles rewrites the keywords of videos whose tags changed, in the
+// background since that runs ffmpeg once per video.
+func (s *server) syncTagFiles(videos []store.Video) {
+	if len(videos) == 0 {
+		return
+	}
+	go func() {
+		for _, v := range videos {
+			s.syncTagsToFile(context.Background(), v)
+		}
+	}()
+}
+
+// plainTag loads tag id, answering 404 when it is missing and 400 when it
+// is namespaced.
+func (s *server) plainTag(w http.ResponseWriter, r *http.Request, id int64) (store.Tag, bool) {
+	tag, err := s.store.GetTag(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return store.Tag{}, false
+	}
+	if _, reserved := reservedTagPrefix(tag.Name); reserved {
+		http.Error(w, "namespaced tags are edited through their own fields", http.StatusBadRequest)
+		return store.Tag{}, false
+	}
+	return tag, true
+}
+
+// GET /tags/manage
+func (s *server) handleTagManager(w http.ResponseWriter, r *http.Request) {
+	s.renderTagManager(w, r, tagManager{})
+}
+
+// PUT /tags/{id} renames a plain tag and sets the color and sort_order form
+// values when present. A name another tag already has is reported in the
+// panel, with an offer to merge into that tag, and nothing changes.
+func (s *server) handleUpdateTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Error(w, "name required", http.StatusBadRequest)
+		return
+	}
+	tag, ok := s.plainTag(w, r, id)
+	if !ok {
+		return
+	}
+	color, sortOrder := tag.Color, tag.SortOrder
+	if _, ok := r.Form["color"]; ok {
+		color = r.FormValue("color")
+		if !store.IsValidColorLabel(color) {
+			http.Error(w, "invalid color", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := strings.TrimSpace(r.FormValue("sort_order")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid sort_order", http.StatusBadRequest)
+			return
+		}
+		sortOrder = n
+	}
+	if p, ok := reservedTagPrefix(name); ok {
+		s.renderTagManager(w, r, tagManager{Error: "Use the dedicated field to set " + strings.TrimSuffix(p, ":")})
+		return
+	}
+	if name != tag.Name {
+		if err := s.store.RenameTag(r.Context(), id, name); errors.Is(err, store.ErrConflict) {
+			data := tagManager{Error: fmt.Sprintf("A tag named %q already exists", name), MergeFrom: tag}
+			data.MergeInto, _ = s.tagByName(r.Context(), name)
+			s.renderTagManager(w, r, data)
+			return
+		} else if err != nil {
+			storeError(w, err)
+			return
+		}
+		slog.Info("tag renamed", "from", tag.Name, "to", name, "by", s.requestUser(r).Username)
+		videos, err := s.store.ListVideosByTag(r.Context(), id)
+		if err != nil {
+			slog.Warn("list renamed tag's videos failed", "tag", id, "err", err)
+		}
+		s.syncTagFiles(videos)
+	}
+	if color != tag.Color || sortOrder != tag.SortOrder {
+		if err := s.store.SetTagStyle(r.Context(), id, color, sortOrder); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+	s.renderTagManager(w, r, tagManager{})
+}
+
+// tagByName finds a plain tag by its exact name.
+func (s *server) tagByName(ctx context.Context, name string) (store.Tag, bool) {
+	tags, err := s.store.ListTagCounts(ctx)
+	if err != nil {
+		return store.Tag{}, false
+	}
+	for _, t := range tags {
+		if t.Name == name {
+			return t.Tag, true
+		}
+	}
+	return store.Tag{}, false
+}
+
+// POST /tags/{id}/merge moves the tag's videos onto the tag "into" and
+// deletes it.
+func (s *server) handleMergeTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	intoID, err := strconv.ParseInt(r.FormValue("into"), 10, 64)
+	if err != nil || intoID <= 0 {
+		http.Error(w, "invalid into", http.StatusBadRequest)
+		return
+	}
+	if intoID == id {
+		http.Error(w, "a tag cannot be merged into itself", http.StatusBadRequest)
+		return
+	}
+	from, ok := s.plainTag(w, r, id)
+	if !ok {
+		return
+	}
+	into, ok := s.plainTag(w, r, intoID)
+	if !ok {
+		return
+	}
+	videos, err := s.store.ListVideosByTag(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if err := s.store.MergeTags(r.Context(), id, intoID); err != nil {
+		storeError(w, err)
+		return
+	}
+	slog.Info("tags merged", "from", from.Name, "into", into.Name, "videos", len(videos), "by", s.requestUser(r).Username)
+	s.syncTagFiles(videos)
+	s.renderTagManager(w, r, tagManager{})
+}
+
+// GET /tags/{id}/delete-confirm
+func (s *server) handleTagDeleteConfirm(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	tag, ok := s.plainTag(w, r, id)
+	if !ok {
+		return
+	}
+	n, err := s.store.CountTagVideos(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	// Archive policies picking videos by the tag go with it.
+	all, err := s.store.ListArchivePolicies(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	var policies []string
+	for _, p := range all {
+		if p.TagID == id {
+			policies = append(policies, p.Name)
+		}
+	}
+	render(w, "tag_delete_confirm.html", struct {
+		Tag      store.Tag
+		Videos   int
+		Policies []string
+	}{tag, n, policies})
+}
+
+// DELETE /tags/{id} removes the tag from every video and deletes it.
+func (s *server) handleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	tag, ok := s.plainTag(w, r, id)
+	if !ok {
+		return
+	}
+	videos, err := s.store.ListVideosByTag(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if err := s.store.DeleteTag(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+	slog.Info("tag deleted", "tag", tag.Name, "videos", len(videos), "by", s.requestUser(r).Username)
+	s.syncTagFiles(videos)
+	s.renderTagManager(w, r, tagManager{})
+}
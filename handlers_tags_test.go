@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestHandleRenameTag(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	typo, _ := srv.store.UpsertTag(ctx, "comdy")
+	drama, _ := srv.store.UpsertTag(ctx, "drama")
+	show, _ := srv.store.UpsertTag(ctx, "show:Friends")
+	srv.store.TagVideo(ctx, v.ID, typo.ID) //nolint:errcheck
+
+	rec := doAs(srv, nil, http.MethodGet, "/tags/manage", nil)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, `value="comdy"`) || strings.Contains(body, "Friends") {
+		t.Fatalf("panel: got %d: %s", rec.Code, body)
+	}
+
+	rec = doAs(srv, nil, http.MethodPut, "/tags/"+itoa(typo.ID), url.Values{"name": {" comedy "}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="comedy"`) {
+		t.Fatalf("rename: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if tags, _ := srv.store.ListTagsByVideo(ctx, v.ID); len(tags) != 1 || tags[0].Name != "comedy" {
+		t.Errorf("video tags after rename = %+v", tags)
+	}
+
+	rec = doAs(srv, nil, http.MethodPut, "/tags/"+itoa(drama.ID), url.Values{"name": {"comedy"}})
+	if !strings.Contains(rec.Body.String(), "already exists") {
+		t.Errorf("taken name: want the conflict in the panel, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if tag, _ := srv.store.GetTag(ctx, drama.ID); tag.Name != "drama" {
+		t.Errorf("conflicting rename changed the tag to %q", tag.Name)
+	}
+
+	rec = doAs(srv, nil, http.MethodPut, "/tags/"+itoa(drama.ID), url.Values{"name": {"genre:Drama"}})
+	if !strings.Contains(rec.Body.String(), "dedicated field") {
+		t.Errorf("reserved name: want the error in the panel, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	cases := []struct {
+		id   int64
+		name string
+		want int
+	}{
+		{drama.ID, " ", http.StatusBadRequest},
+		{show.ID, "Friends", http.StatusBadRequest},
+		{999, "x", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		if rec := doAs(srv, nil, http.MethodPut, "/tags/"+itoa(tc.id), url.Values{"name": {tc.name}}); rec.Code != tc.want {
+			t.Errorf("rename %d to %q: got %d, want %d", tc.id, tc.name, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestHandleMergeTag(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "pilot.mp4")
+	dup, _ := srv.store.UpsertTag(ctx, "Bobs Burgers")
+	tag, _ := srv.store.UpsertTag(ctx, "Bob's Burgers")
+	show, _ := srv.store.UpsertTag(ctx, "show:Bob's Burgers")
+	srv.store.TagVideo(ctx, v.ID, dup.ID) //nolint:errcheck
+
+	// Renaming onto the existing name offers the merge.
+	rec := doAs(srv, nil, http.MethodPut, "/tags/"+itoa(dup.ID), url.Values{"name": {"Bob's Burgers"}})
+	if body := rec.Body.String(); !strings.Contains(body, "/tags/"+itoa(dup.ID)+"/merge") || !strings.Contains(body, `"into": "`+itoa(tag.ID)+`"`) {
+		t.Fatalf("rename conflict should offer the merge, got: %s", body)
+	}
+
+	cases := []struct {
+		id   int64
+		into string
+		want int
+	}{
+		{dup.ID, "", http.StatusBadRequest},
+		{dup.ID, itoa(dup.ID), http.StatusBadRequest},
+		{dup.ID, itoa(show.ID), http.StatusBadRequest},
+		{dup.ID, "999", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		if rec := doAs(srv, nil, http.MethodPost, "/tags/"+itoa(tc.id)+"/merge", url.Values{"into": {tc.into}}); rec.Code != tc.want {
+			t.Errorf("merge %d into %q: got %d, want %d", tc.id, tc.into, rec.Code, tc.want)
+		}
+	}
+
+	rec = doAs(srv, nil, http.MethodPost, "/tags/"+itoa(dup.ID)+"/merge", url.Values{"into": {itoa(tag.ID)}})
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "Bobs Burgers") {
+		t.Fatalf("merge: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if tags, _ := srv.store.ListTagsByVideo(ctx, v.ID); len(tags) != 1 || tags[0].ID != tag.ID {
+		t.Errorf("video tags after merge = %+v", tags)
+	}
+}
+
+func TestHandleDeleteTag(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	a, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	tag, _ := srv.store.UpsertTag(ctx, "blooper")
+	show, _ := srv.store.UpsertTag(ctx, "show:Bluey")
+	srv.store.TagVideo(ctx, a.ID, tag.ID) //nolint:errcheck
+	srv.store.TagVideo(ctx, b.ID, tag.ID) //nolint:errcheck
+
+	rec := doAs(srv, nil, http.MethodGet, "/tags/"+itoa(tag.ID)+"/delete-confirm", nil)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "2 videos") || !strings.Contains(body, `hx-delete="/tags/`+itoa(tag.ID)+`"`) {
+		t.Fatalf("confirm: got %d: %s", rec.Code, body)
+	}
+	if rec := doAs(srv, nil, http.MethodDelete, "/tags/"+itoa(show.ID), nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("namespaced tag: got %d, want 400", rec.Code)
+	}
+	if rec := doAs(srv, nil, http.MethodDelete, "/tags/999", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("missing tag: got %d, want 404", rec.Code)
+	}
+
+	rec = doAs(srv, nil, http.MethodDelete, "/tags/"+itoa(tag.ID), nil)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "blooper") {
+		t.Fatalf("delete: got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, v := range []store.Video{a, b} {
+		if tags, _ := srv.store.ListTagsByVideo(ctx, v.ID); len(tags) != 0 {
+			t.Errorf("%s: tags after delete = %+v", v.Filename, tags)
+		}
+	}
+}
+
+func TestHandleTagStyle(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	comedy, _ := srv.store.UpsertTag(ctx, "comedy")
+	drama, _ := srv.store.UpsertTag(ctx, "drama")
+	srv.store.TagVideo(ctx, v.ID, comedy.ID) //nolint:errcheck
+	srv.store.TagVideo(ctx, v.ID, drama.ID)  //nolint:errcheck
+
+	rec := doAs(srv, nil, http.MethodPut, "/tags/"+itoa(drama.ID), url.Values{"name": {"drama"}, "color": {"red"}, "sort_order": {"-1"}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="red" selected`) {
+		t.Fatalf("style: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if tag, _ := srv.store.GetTag(ctx, drama.ID); tag.Color != "red" || tag.SortOrder != -1 {
+		t.Errorf("tag after style = %+v", tag)
+	}
+
+	// Without color and sort_order a rename leaves them alone.
+	doAs(srv, nil, http.MethodPut, "/tags/"+itoa(drama.ID), url.Values{"name": {"dramas"}})
+	if tag, _ := srv.store.GetTag(ctx, drama.ID); tag.Name != "dramas" || tag.Color != "red" || tag.SortOrder != -1 {
+		t.Errorf("tag after rename = %+v", tag)
+	}
+
+	red := "box-shadow:inset 3px 0 0 " + store.VideoLabelColors["red"]
+	for _, target := range []string{"/tags", "/videos/" + itoa(v.ID) + "/tags"} {
+		body := doAs(srv, nil, http.MethodGet, target, nil).Body.String()
+		if !strings.Contains(body, red) {
+			t.Errorf("%s: want the colored chip, got %s", target, body)
+		}
+		if i, j := strings.Index(body, "dramas"), strings.Index(body, "comedy"); i < 0 || j < 0 || i > j {
+			t.Errorf("%s: want dramas listed before comedy, got %s", target, body)
+		}
+	}
+
+	for _, form := range []url.Values{
+		{"name": {"comedy"}, "color": {"teal"}},
+		{"name": {"comedy"}, "sort_order": {"first"}},
+	} {
+		if rec := doAs(srv, nil, http.MethodPut, "/tags/"+itoa(comedy.ID), form); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: got %d, want 400", form, rec.Code)
+		}
+	}
+}
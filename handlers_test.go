@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestHandleVideoList_Empty(t *testing.T) {
@@ -174,6 +175,32 @@ func TestHandleVideoList_ShowsWatchedIndicator(t *testing.T) {
 	}
 }
 
+func TestHandleVideoList_StarsSorted(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	srv.store.SaveSettings(ctx, map[string]string{"video_sort": "rating", "rating_scale": "stars", "card_fields": "rating"}) //nolint:errcheck
+
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	one, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "a-one.mp4")
+	three, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "b-three.mp4")
+	srv.store.SetVideoStars(ctx, one.ID, 1)   //nolint:errcheck
+	srv.store.SetVideoStars(ctx, three.ID, 3) //nolint:errcheck
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	// Neither is liked, so only the star scale tells them apart.
+	if strings.Index(body, "b-three.mp4") > strings.Index(body, "a-one.mp4") {
+		t.Error("expected 3 stars before 1 star")
+	}
+	if !strings.Contains(body, "3 of 5 stars") {
+		t.Error("expected the card to show its stars")
+	}
+}
+
 func TestHandleVideoList_RatingSorted(t *testing.T) {
 	srv := newTestServer(t)
 	ctx := context.Background()
@@ -272,6 +299,155 @@ func TestServeVideoListPagination(t *testing.T) {
 	}
 }
 
+func TestServeVideoList_LoadMore(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	tag, _ := srv.store.UpsertTag(ctx, "kept")
+	for _, n := range []string{"a.mp4", "b.mp4", "c.mp4", "d.mp4"} {
+		v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, n)
+		if n != "d.mp4" {
+			srv.store.TagVideo(ctx, v.ID, tag.ID) //nolint:errcheck
+		}
+	}
+
+	rec := doAs(srv, nil, http.MethodGet, "/videos?limit=2&tag_id="+itoa(tag.ID), nil)
+	body := rec.Body.String()
+	if !strings.Contains(body, "2 of 3") || !strings.Contains(body, "Load more") {
+		t.Fatalf("expected a load-more footer for 2 of 3, got: %s", body)
+	}
+	// The next request keeps the filter and asks for another page.
+	if !strings.Contains(body, "limit="+itoa(int64(2+videoPageSize))) || !strings.Contains(body, "tag_id="+itoa(tag.ID)) {
+		t.Errorf("load-more URL lost the filter or limit: %s", body)
+	}
+	if strings.Contains(body, "c.mp4") {
+		t.Error("third video rendered on the first page")
+	}
+
+	rec = doAs(srv, nil, http.MethodGet, "/videos?limit=3&tag_id="+itoa(tag.ID), nil)
+	body = rec.Body.String()
+	if !strings.Contains(body, "c.mp4") || strings.Contains(body, "d.mp4") || strings.Contains(body, "Load more") {
+		t.Errorf("expected all 3 tagged videos and no footer, got: %s", body)
+	}
+}
+
+func TestServeVideoList_SortParam(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	short, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "clip_a.mp4")
+	long, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "clip_b.mp4")
+	srv.store.UpdateVideoDuration(ctx, short.ID, 60) //nolint:errcheck
+	srv.store.UpdateVideoDuration(ctx, long.ID, 600) //nolint:errcheck
+
+	// The sort applies to the whole list and to search results alike.
+	for _, target := range []string{"/videos?sort=duration", "/videos?q=clip&sort=duration"} {
+		body := doAs(srv, nil, http.MethodGet, target, nil).Body.String()
+		a, b := strings.Index(body, "clip_a"), strings.Index(body, "clip_b")
+		if a < 0 || b < 0 || b > a {
+			t.Errorf("%s: want the longer clip_b before clip_a, got: %s", target, body)
+		}
+	}
+	if rec := doAs(srv, nil, http.MethodGet, "/api/videos?sort=shuffle", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("/api/videos with an unknown sort: status %d, want 400", rec.Code)
+	}
+}
+
+func TestServeVideoList_SearchWithinFilters(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	tv, _ := srv.store.AddDirectory(ctx, "/tv")
+	films, _ := srv.store.AddDirectory(ctx, "/films")
+	srv.store.UpsertVideo(ctx, tv.ID, tv.Path, "moon_landing.mp4") //nolint:errcheck
+	film, _ := srv.store.UpsertVideo(ctx, films.ID, films.Path, "moon_film.mp4")
+	tag, _ := srv.store.UpsertTag(ctx, "classic")
+	srv.store.TagVideo(ctx, film.ID, tag.ID) //nolint:errcheck
+
+	for _, target := range []string{
+		"/videos?q=moon&tag_id=" + itoa(tag.ID),
+		"/videos?q=moon&dir_id=" + itoa(films.ID),
+	} {
+		body := doAs(srv, nil, http.MethodGet, target, nil).Body.String()
+		if !strings.Contains(body, "moon_film") || strings.Contains(body, "moon_landing") {
+			t.Errorf("%s: want only moon_film, got: %s", target, body)
+		}
+	}
+}
+
+func TestServeVideoList_CardFields(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	srv.store.UpdateVideoDuration(ctx, v.ID, 3725)         //nolint:errcheck
+	srv.store.UpdateVideoResolution(ctx, v.ID, 1920, 1080) //nolint:errcheck
+	srv.store.SetVideoRating(ctx, v.ID, 2)                 //nolint:errcheck
+	srv.store.SetVideoFavorite(ctx, v.ID, true)            //nolint:errcheck
+	// The size comes from the last scan; /videos/film.mp4 does not exist.
+	srv.store.UpdateVideoFileStat(ctx, v.ID, 3<<30, time.Now()) //nolint:errcheck
+	tag, _ := srv.store.UpsertTag(ctx, "vacation")
+	srv.store.TagVideo(ctx, v.ID, tag.ID) //nolint:errcheck
+
+	list := func() string {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos", nil))
+		return rec.Body.String()
+	}
+
+	// Default: rating shown, the new optional fields hidden.
+	body := list()
+	if !strings.Contains(body, "★") {
+		t.Error("expected rating mark with default card fields")
+	}
+	if !strings.Contains(body, "Watch again soon") {
+		t.Error("expected the watch-again flag with default card fields")
+	}
+	for _, hidden := range []string{"1:02:05", "1080p", "3.0 GB", "#vacation"} {
+		if strings.Contains(body, hidden) {
+			t.Errorf("did not expect %q with default card fields", hidden)
+		}
+	}
+
+	srv.store.SaveSettings(ctx, map[string]string{"card_fields": "duration,resolution,size,tags"}) //nolint:errcheck
+	body = list()
+	for _, want := range []string{"1:02:05", "1080p", "3.0 GB", "#vacation"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q on card", want)
+		}
+	}
+	if strings.Contains(body, "★") {
+		t.Error("rating mark should be hidden when rating is not selected")
+	}
+
+	// The watch-again flag has its own field, apart from the rating.
+	srv.store.SaveSettings(ctx, map[string]string{"card_fields": "rating"}) //nolint:errcheck
+	if body = list(); strings.Contains(body, "Watch again soon") {
+		t.Error("watch-again flag should be hidden when favorite is not selected")
+	}
+	srv.store.SaveSettings(ctx, map[string]string{"card_fields": "favorite"}) //nolint:errcheck
+	if body = list(); !strings.Contains(body, "Watch again soon") || strings.Contains(body, "★") {
+		t.Error("expected the watch-again flag alone when only favorite is selected")
+	}
+}
+
+func TestFormatHelpers(t *testing.T) {
+	if got := formatDuration(59.6); got != "1:00" {
+		t.Errorf("formatDuration(59.6) = %q", got)
+	}
+	if got := formatDuration(3725); got != "1:02:05" {
+		t.Errorf("formatDuration(3725) = %q", got)
+	}
+	if got := formatBytes(1536); got != "1.5 KB" {
+		t.Errorf("formatBytes(1536) = %q", got)
+	}
+	if got := formatBytes(3 << 30); got != "3.0 GB" {
+		t.Errorf("formatBytes(3 GiB) = %q", got)
+	}
+	if got := resolutionLabel(2160); got != "4K" {
+		t.Errorf("resolutionLabel(2160) = %q", got)
+	}
+}
+
 func TestHandleQuickLabelModal_OK(t *testing.T) {
 	srv := newTestServer(t)
 	ctx := context.Background()
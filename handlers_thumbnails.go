@@ -0,0 +1,137 @@
+// handlers_thumbnails.go – cached poster frames for the library grid.
+//
+// GET /videos/{id}/thumb – a JPEG frame from the video
+//
+// The frame is taken thumbnail_percent of the way into the file (default
+// defaultThumbPercent) and cached in thumbCacheDir, keyed by the file's
+// size and modification time so a replaced file gets a fresh frame. A
+// custom poster set with PUT /videos/{id}/thumbnail is served instead.
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/store"
+	"github.com/maxgarvey/video_manger/transcode"
+)
+
+// thumbCacheDir holds generated poster frames, one per video, frame position
+// and file version (see cachedThumbPath). main moves it beside the database.
+var thumbCacheDir = filepath.Join(os.TempDir(), "video_manger-thumbs")
+
+// thumbSem limits concurrent frame extractions, since a poster grid asks
+// for many at once.
+var thumbSem = make(chan struct{}, thumbConcurrent)
+
+// thumbPercent reads how far into a video, in percent, poster frames are
+// taken.
+func (s *server) thumbPercent(r *http.Request) int {
+	v, err := s.store.GetSetting(r.Context(), "thumbnail_percent")
+	if err != nil {
+		return defaultThumbPercent
+	}
+	if p, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && p >= 0 && p <= 100 {
+		return p
+	}
+	return defaultThumbPercent
+}
+
+// customPoster returns the video's poster when the user chose one, rather
+// than one generated during sync.
+func customPoster(v store.Video) (string, bool) {
+	if v.ThumbnailPath == "" || v.ThumbnailPath == autoThumbnailPath(v.FilePath()) {
+		return "", false
+	}
+	if _, err := os.Stat(v.ThumbnailPath); err != nil {
+		return "", false
+	}
+	return v.ThumbnailPath, true
+}
+
+// cachedThumbPath names the cache entry for v's frame at percent, given the
+// file's current size and modification time.
+func cachedThumbPath(v store.Video, fi os.FileInfo, percent int) string {
+	return filepath.Join(thumbCacheDir,
+		fmt.Sprintf("%d-%d-%x-%x.jpg", v.ID, percent, fi.Size(), fi.ModTime().UnixNano()))
+}
+
+// pruneThumbCache removes v's cache entries other than keep.
+func pruneThumbCache(v store.Video, keep string) {
+	old, _ := filepath.Glob(filepath.Join(thumbCacheDir, strconv.FormatInt(v.ID, 10)+"-*.jpg"))
+	for _, p := range old {
+		if p != keep {
+			os.Remove(p) //nolint:errcheck
+		}
+	}
+}
+
+func (s *server) handleVideoThumb(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if poster, ok := customPoster(video); ok {
+		http.ServeFile(w, r, poster)
+		return
+	}
+	fi, err := s.blobs.Stat(video.FilePath())
+	if err != nil {
+		http.Error(w, "video file not found", http.StatusNotFound)
+		return
+	}
+	percent := s.thumbPercent(r)
+	cached := cachedThumbPath(video, fi, percent)
+	if _, err := os.Stat(cached); err == nil {
+		http.ServeFile(w, r, cached)
+		return
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		http.Error(w, "ffmpeg is not installed — thumbnails are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	select {
+	case thumbSem <- struct{}{}:
+		defer func() { <-thumbSem }()
+	case <-r.Context().Done():
+		return
+	}
+	// Another request may have made it while this one waited.
+	if _, err := os.Stat(cached); err != nil {
+		if err := s.generateThumb(video, cached, percent); err != nil {
+			slog.Warn("generate thumb failed", "path", video.FilePath(), "err", err)
+			http.Error(w, "failed to generate thumbnail", http.StatusInternalServerError)
+			return
+		}
+		pruneThumbCache(video, cached)
+	}
+	http.ServeFile(w, r, cached)
+}
+
+// generateThumb extracts v's frame at percent into dst via a temp file, so
+// concurrent readers never see a partial JPEG.
+func (s *server) generateThumb(v store.Video, dst string, percent int) error {
+	if err := os.MkdirAll(thumbCacheDir, 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(thumbCacheDir, "."+newToken()+".jpg")
+	defer os.Remove(tmp) //nolint:errcheck
+	position := float64(percent) / 100
+	var err error
+	if v.DurationS > 0 {
+		err = transcode.ExtractFrame(v.FilePath(), tmp, v.DurationS*position)
+	} else {
+		err = transcode.GenerateThumbnail(v.FilePath(), tmp, position)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
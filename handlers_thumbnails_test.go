@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeThumbStubs installs an ffmpeg that records its arguments in
+// bin/calls and writes a fake JPEG to its last argument, and points the
+// thumbnail cache at a temp directory.
+func writeThumbStubs(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	ffmpeg := `#!/bin/sh
+echo "$@" >> "` + filepath.Join(bin, "calls") + `"
+for last; do true; done
+printf 'JPEG' > "$last"
+`
+	os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(ffmpeg), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin)
+	orig := thumbCacheDir
+	thumbCacheDir = t.TempDir()
+	t.Cleanup(func() { thumbCacheDir = orig })
+	return bin
+}
+
+func TestHandleVideoThumb_GeneratesAndCaches(t *testing.T) {
+	bin := writeThumbStubs(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "film.mp4")
+	os.WriteFile(file, []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	srv.store.UpdateVideoDuration(ctx, v.ID, 200)                             //nolint:errcheck
+	srv.store.SaveSettings(ctx, map[string]string{"thumbnail_percent": "25"}) //nolint:errcheck
+
+	for i := 0; i < 2; i++ {
+		if rec := doAs(srv, nil, http.MethodGet, "/videos/"+itoa(v.ID)+"/thumb", nil); rec.Code != http.StatusOK || rec.Body.String() != "JPEG" {
+			t.Fatalf("request %d: expected the frame, got %d: %q", i, rec.Code, rec.Body.String())
+		}
+	}
+	calls, _ := os.ReadFile(filepath.Join(bin, "calls"))
+	if n := strings.Count(string(calls), "\n"); n != 1 {
+		t.Fatalf("expected one ffmpeg run with the second request cached, got %d", n)
+	}
+	if !strings.Contains(string(calls), "-ss 50.000") {
+		t.Errorf("expected a seek 25%% into a 200s video, got %q", calls)
+	}
+
+	// A replaced file gets a fresh frame and the stale entry is dropped.
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(file, later, later) //nolint:errcheck
+	if rec := doAs(srv, nil, http.MethodGet, "/videos/"+itoa(v.ID)+"/thumb", nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 after the file changed, got %d", rec.Code)
+	}
+	entries, _ := os.ReadDir(thumbCacheDir)
+	if len(entries) != 1 {
+		t.Errorf("expected one cache entry after regeneration, got %d", len(entries))
+	}
+}
+
+func TestHandleVideoThumb_PrefersCustomPoster(t *testing.T) {
+	writeThumbStubs(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("fake"), 0644)          //nolint:errcheck
+	os.WriteFile(filepath.Join(dir, "film_poster.jpg"), []byte("POSTER"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	srv.store.UpdateVideoThumbnail(ctx, v.ID, filepath.Join(dir, "film_poster.jpg")) //nolint:errcheck
+
+	if rec := doAs(srv, nil, http.MethodGet, "/videos/"+itoa(v.ID)+"/thumb", nil); rec.Code != http.StatusOK || rec.Body.String() != "POSTER" {
+		t.Errorf("expected the custom poster, got %d: %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleVideoThumb_MissingFile(t *testing.T) {
+	writeThumbStubs(t)
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "gone.mp4")
+	if rec := doAs(srv, nil, http.MethodGet, "/videos/"+itoa(v.ID)+"/thumb", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing file, got %d", rec.Code)
+	}
+}
+
+func TestServeVideoList_PosterGrid(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	img := `<img src="/videos/` + itoa(v.ID) + `/thumb"`
+
+	list := func(target string) string {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Body.String()
+	}
+	if body := list("/videos"); strings.Contains(body, img) {
+		t.Error("expected rows by default")
+	}
+	if body := list("/videos?view=posters"); !strings.Contains(body, img) {
+		t.Error("expected view=posters to render the poster grid")
+	}
+	srv.store.SaveSettings(ctx, map[string]string{"library_view": "posters"}) //nolint:errcheck
+	if body := list("/videos"); !strings.Contains(body, img) {
+		t.Error("expected the library_view setting to pick the poster grid")
+	}
+	if body := list("/videos?view=list"); strings.Contains(body, img) {
+		t.Error("expected view=list to override the setting")
+	}
+}
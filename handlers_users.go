@@ -0,0 +1,223 @@
+// handlers_users.go – user accounts and admin/viewer roles.
+//
+// Admins manage directories, settings, files and background jobs; viewers
+// browse, play, rate and tag. Creating the first account turns on sign-in.
+// Without accounts or a shared -password everyone is an admin.
+//
+// GET    /users               – account manager fragment (settings panel)
+// POST   /users               – create an account
+// PUT    /users/{id}/role     – change an account's role
+// PUT    /users/{id}/password – set an account's password
+// DELETE /users/{id}          – delete an account and end its sessions
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// userKey is the request context key holding the signed-in store.User.
+type userKey struct{}
+
+// requestUser returns the user making the request. Without sign-in
+// everyone acts as an admin.
+func (s *server) requestUser(r *http.Request) store.User {
+	if !s.authRequired() {
+		return store.User{Role: store.RoleAdmin}
+	}
+	user, _ := r.Context().Value(userKey{}).(store.User)
+	return user
+}
+
+// requireAdmin refuses requests from viewers with 403 Forbidden.
+func (s *server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.requestUser(r).Role != store.RoleAdmin {
+			http.Error(w, "this action needs an admin account", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validRole(role string) bool {
+	return role == store.RoleAdmin || role == store.RoleViewer
+}
+
+// refreshAccounts re-reads whether any account exists, which decides
+// whether sign-in is required.
+func (s *server) refreshAccounts(ctx context.Context) {
+	users, err := s.store.ListUsers(ctx)
+	if err == nil {
+		s.accounts.Store(len(users) > 0)
+	}
+}
+
+// otherAccounts counts the accounts other than id, and the admins among
+// them, to keep the server from being left without an admin.
+func (s *server) otherAccounts(ctx context.Context, id int64) (accounts, admins int, err error) {
+	users, err := s.store.ListUsers(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, u := range users {
+		if u.ID == id {
+			continue
+		}
+		accounts++
+		if u.Role == store.RoleAdmin {
+			admins++
+		}
+	}
+	return accounts, admins, nil
+}
+
+func (s *server) renderUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.store.ListUsers(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "users.html", struct {
+		Users []store.User
+		Me    store.User
+	}{users, s.requestUser(r)})
+}
+
+func (s *server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	s.renderUsers(w, r)
+}
+
+func (s *server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	username := strings.TrimSpace(r.FormValue("username"))
+	if username == "" || strings.ContainsAny(username, " \t") {
+		http.Error(w, "username required, without spaces", http.StatusBadRequest)
+		return
+	}
+	role := r.FormValue("role")
+	if !validRole(role) {
+		http.Error(w, "role must be admin or viewer", http.StatusBadRequest)
+		return
+	}
+	pw := r.FormValue("password")
+	if len(pw) < minPasswordLen {
+		http.Error(w, "password too short", http.StatusBadRequest)
+		return
+	}
+	// The first account turns on sign-in; if it were a viewer nobody could
+	// administer the server any more.
+	if !s.authRequired() && role != store.RoleAdmin {
+		http.Error(w, "the first account must be an admin", http.StatusBadRequest)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = s.store.CreateUser(r.Context(), username, string(hash), role)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "username already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	s.refreshAccounts(r.Context())
+	s.renderUsers(w, r)
+}
+
+func (s *server) handleSetUserRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	role := r.FormValue("role")
+	if !validRole(role) {
+		http.Error(w, "role must be admin or viewer", http.StatusBadRequest)
+		return
+	}
+	// Without a shared password to fall back on, someone must stay admin.
+	if role != store.RoleAdmin && s.passwordHash == nil {
+		_, admins, err := s.otherAccounts(r.Context(), id)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+		if admins == 0 {
+			http.Error(w, "cannot demote the last admin", http.StatusConflict)
+			return
+		}
+	}
+	if err := s.store.SetUserRole(r.Context(), id, role); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	s.forgetProxyUsers()
+	s.renderUsers(w, r)
+}
+
+func (s *server) handleSetUserPassword(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	pw := r.FormValue("password")
+	if len(pw) < minPasswordLen {
+		http.Error(w, "password too short", http.StatusBadRequest)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.store.SetUserPassword(r.Context(), id, string(hash)); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	s.renderUsers(w, r)
+}
+
+func (s *server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	// Deleting the last admin is fine only if it is the last account too,
+	// which turns sign-in off again.
+	if s.passwordHash == nil {
+		accounts, admins, err := s.otherAccounts(r.Context(), id)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+		if accounts > 0 && admins == 0 {
+			http.Error(w, "cannot delete the last admin", http.StatusConflict)
+			return
+		}
+	}
+	if err := s.store.DeleteUser(r.Context(), id); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	// The store drops the account's sessions; drop the in-memory copies.
+	s.sessionsMu.Lock()
+	for tok, uid := range s.sessionUsers {
+		if uid == id {
+			delete(s.sessions, tok)
+			delete(s.sessionUsers, tok)
+		}
+	}
+	s.sessionsMu.Unlock()
+	s.forgetProxyUsers()
+	s.refreshAccounts(r.Context())
+	s.renderUsers(w, r)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// addTestUser creates an account directly in the store and turns sign-in on.
+func addTestUser(t *testing.T, srv *server, username, password, role string) store.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	u, err := srv.store.CreateUser(context.Background(), username, string(hash), role)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	srv.refreshAccounts(context.Background())
+	return u
+}
+
+// loginAs signs in and returns the session cookie, failing the test if the
+// credentials are refused.
+func loginAs(t *testing.T, srv *server, username, password string) *http.Cookie {
+	t.Helper()
+	body := strings.NewReader(url.Values{"username": {username}, "password": {password}}.Encode())
+	req := httptest.NewRequest(http.MethodPost, "/login", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "session" {
+			return c
+		}
+	}
+	t.Fatalf("login as %q failed: %d %s", username, rec.Code, rec.Body.String())
+	return nil
+}
+
+func TestRoles_ViewerCannotReachAdminRoutes(t *testing.T) {
+	srv := newTestServer(t)
+	addTestUser(t, srv, "root", "adminpass", store.RoleAdmin)
+	addTestUser(t, srv, "kid", "viewerpass", store.RoleViewer)
+	d, _ := srv.store.AddDirectory(context.Background(), t.TempDir())
+	v, _ := srv.store.UpsertVideo(context.Background(), d.ID, d.Path, "a.mp4")
+	viewer := loginAs(t, srv, "kid", "viewerpass")
+	admin := loginAs(t, srv, "root", "adminpass")
+
+	for _, c := range []struct{ method, target string }{
+		{http.MethodGet, "/settings"},
+		{http.MethodPost, "/directories/" + itoa(d.ID) + "/sync"},
+		{http.MethodDelete, "/videos/" + itoa(v.ID)},
+		{http.MethodPost, "/ytdlp/download"},
+		{http.MethodGet, "/users"},
+	} {
+		if rec := doAs(srv, viewer, c.method, c.target, nil); rec.Code != http.StatusForbidden {
+			t.Errorf("viewer %s %s: expected 403, got %d", c.method, c.target, rec.Code)
+		}
+	}
+	for _, c := range []struct {
+		method, target string
+		form           url.Values
+	}{
+		{http.MethodGet, "/videos", nil},
+		{http.MethodPost, "/videos/" + itoa(v.ID) + "/rating", url.Values{"rating": {"1"}}},
+		{http.MethodPost, "/videos/" + itoa(v.ID) + "/tags", url.Values{"tag": {"favourites"}}},
+	} {
+		if rec := doAs(srv, viewer, c.method, c.target, c.form); rec.Code != http.StatusOK {
+			t.Errorf("viewer %s %s: expected 200, got %d: %s", c.method, c.target, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := doAs(srv, admin, http.MethodGet, "/settings", nil); rec.Code != http.StatusOK {
+		t.Errorf("admin GET /settings: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestLogin_AccountCredentials(t *testing.T) {
+	srv := newTestServer(t)
+	addTestUser(t, srv, "root", "adminpass", store.RoleAdmin)
+
+	// With an account, sign-in is required even without -password.
+	if rec := doAs(srv, nil, http.MethodGet, "/", nil); rec.Code != http.StatusFound {
+		t.Fatalf("expected redirect to /login, got %d", rec.Code)
+	}
+	for _, form := range []url.Values{
+		{"username": {"root"}, "password": {"wrong"}},
+		{"username": {"nobody"}, "password": {"adminpass"}},
+		{"password": {"adminpass"}}, // no shared password configured
+	} {
+		rec := doAs(srv, nil, http.MethodPost, "/login", form)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Wrong") {
+			t.Errorf("%v: expected the login page with an error, got %d", form, rec.Code)
+		}
+	}
+	cookie := loginAs(t, srv, "ROOT", "adminpass")
+	if rec := doAs(srv, cookie, http.MethodGet, "/", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Signed in as") {
+		t.Errorf("expected the signed-in index page, got %d", rec.Code)
+	}
+}
+
+func TestLogin_SharedPasswordActsAsAdmin(t *testing.T) {
+	srv := newTestServerWithAuth(t, "secret")
+	addTestUser(t, srv, "kid", "viewerpass", store.RoleViewer)
+	cookie := loginAs(t, srv, "", "secret")
+	if rec := doAs(srv, cookie, http.MethodGet, "/settings", nil); rec.Code != http.StatusOK {
+		t.Errorf("expected the shared login to reach admin routes, got %d", rec.Code)
+	}
+}
+
+func TestHandleCreateUser(t *testing.T) {
+	srv := newTestServer(t)
+	form := url.Values{"username": {"kid"}, "password": {"viewerpass"}, "role": {"viewer"}}
+	if rec := doAs(srv, nil, http.MethodPost, "/users", form); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected the first account to have to be an admin, got %d", rec.Code)
+	}
+	form.Set("password", "short")
+	form.Set("role", "admin")
+	if rec := doAs(srv, nil, http.MethodPost, "/users", form); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a short password to be refused, got %d", rec.Code)
+	}
+	form.Set("password", "adminpass")
+	rec := doAs(srv, nil, http.MethodPost, "/users", form)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "kid") {
+		t.Fatalf("expected the account to be listed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !srv.authRequired() {
+		t.Error("expected the first account to turn on sign-in")
+	}
+	admin := loginAs(t, srv, "kid", "adminpass")
+	if rec := doAs(srv, admin, http.MethodPost, "/users", form); rec.Code != http.StatusConflict {
+		t.Errorf("expected a duplicate username to be refused, got %d", rec.Code)
+	}
+}
+
+func TestHandleSetUserRole_KeepsAnAdmin(t *testing.T) {
+	srv := newTestServer(t)
+	root := addTestUser(t, srv, "root", "adminpass", store.RoleAdmin)
+	kid := addTestUser(t, srv, "kid", "viewerpass", store.RoleViewer)
+	admin := loginAs(t, srv, "root", "adminpass")
+
+	if rec := doAs(srv, admin, http.MethodPut, "/users/"+itoa(root.ID)+"/role", url.Values{"role": {"viewer"}}); rec.Code != http.StatusConflict {
+		t.Errorf("expected demoting the only admin to be refused, got %d", rec.Code)
+	}
+	if rec := doAs(srv, admin, http.MethodPut, "/users/"+itoa(kid.ID)+"/role", url.Values{"role": {"admin"}}); rec.Code != http.StatusOK {
+		t.Fatalf("promote: expected 200, got %d", rec.Code)
+	}
+	if rec := doAs(srv, admin, http.MethodPut, "/users/"+itoa(root.ID)+"/role", url.Values{"role": {"viewer"}}); rec.Code != http.StatusOK {
+		t.Errorf("expected demotion to succeed once another admin exists, got %d", rec.Code)
+	}
+	// The role change applies to the existing session straight away.
+	if rec := doAs(srv, admin, http.MethodGet, "/settings", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the demoted session to lose admin routes, got %d", rec.Code)
+	}
+}
+
+func TestHandleDeleteUser_EndsSessions(t *testing.T) {
+	srv := newTestServer(t)
+	addTestUser(t, srv, "root", "adminpass", store.RoleAdmin)
+	kid := addTestUser(t, srv, "kid", "viewerpass", store.RoleViewer)
+	admin := loginAs(t, srv, "root", "adminpass")
+	viewer := loginAs(t, srv, "kid", "viewerpass")
+
+	if rec := doAs(srv, admin, http.MethodDelete, "/users/"+itoa(kid.ID), nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if rec := doAs(srv, viewer, http.MethodGet, "/videos", nil); rec.Code != http.StatusFound {
+		t.Errorf("expected the deleted account's session to be signed out, got %d", rec.Code)
+	}
+}
+
+func TestRecentTags_PerUser(t *testing.T) {
+	srv := newTestServer(t)
+	addTestUser(t, srv, "ana", "anapass12", store.RoleViewer)
+	addTestUser(t, srv, "ben", "benpass12", store.RoleViewer)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	a, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	ana := loginAs(t, srv, "ana", "anapass12")
+	ben := loginAs(t, srv, "ben", "benpass12")
+
+	doAs(srv, ana, http.MethodPost, "/videos/"+itoa(a.ID)+"/tags", url.Values{"tag": {"beach"}})
+	if body := doAs(srv, ana, http.MethodGet, "/videos/"+itoa(b.ID)+"/tags", nil).Body.String(); !strings.Contains(body, "+ beach") {
+		t.Errorf("expected ana to be offered her recent tag, got %q", body)
+	}
+	if body := doAs(srv, ben, http.MethodGet, "/videos/"+itoa(b.ID)+"/tags", nil).Body.String(); strings.Contains(body, "+ beach") {
+		t.Errorf("ben should not be offered ana's recent tag, got %q", body)
+	}
+}
@@ -3,22 +3,36 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html"
+	"image"
+	"image/color"
+	_ "image/gif" // register decoder for poster uploads
+	"image/jpeg"
+	_ "image/png" // register decoder for poster uploads
+	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
+	"math"
 	"math/rand/v2"
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/maxgarvey/video_manger/blob"
 	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/naming"
 	"github.com/maxgarvey/video_manger/store"
 	"github.com/maxgarvey/video_manger/transcode"
 )
@@ -41,10 +55,26 @@ func (s *server) handleInfo(w http.ResponseWriter, r *http.Request) {
 
 func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	rokuEnabled, _ := s.store.GetSetting(r.Context(), "roku_enabled")
+	// The device's profile may open the library pre-filtered to one tag.
+	var landingTag store.Tag
+	if p, ok := s.activeProfile(r); ok && p.LandingTagID != 0 {
+		tags, _ := s.store.ListTags(r.Context())
+		for _, t := range tags {
+			if t.ID == p.LandingTagID {
+				landingTag = t
+			}
+		}
+	}
 	render(w, "index.html", struct {
 		RokuEnabled bool
+		LandingTag  store.Tag
+		User        store.User // Username is empty when sign-in is off
+		CSRFToken   string
 	}{
 		RokuEnabled: rokuEnabled == "true",
+		LandingTag:  landingTag,
+		User:        s.requestUser(r),
+		CSRFToken:   csrfToken(r),
 	})
 }
 
@@ -53,54 +83,115 @@ func (s *server) handlePlayer(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	tags, err := s.store.ListTagsByVideo(r.Context(), video.ID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// /play/{id} is a fragment for the tab strip. A browser opening it
+	// directly (a shared chapter or bookmark link) gets the app instead,
+	// which opens the video in a tab through the same ?t= start.
+	if r.Header.Get("Sec-Fetch-Mode") == "navigate" {
+		q := url.Values{"video": {strconv.FormatInt(video.ID, 10)}}
+		if t := r.URL.Query().Get("t"); t != "" {
+			q.Set("t", t)
+		}
+		http.Redirect(w, r, "/?"+q.Encode(), http.StatusSeeOther)
+		return
+	}
+	if q, usedUp := s.quotaUsedUp(r); usedUp {
+		render(w, "quota_used_up.html", q)
 		return
 	}
-	allTags, err := s.store.ListTags(r.Context())
+	tags, err := s.store.ListTagsByVideo(r.Context(), video.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
-	_, statErr := os.Stat(video.FilePath())
+	_, statErr := s.blobs.Stat(video.FilePath())
 	fileNotFound := statErr != nil
+	// A missing file on an unplugged drive is not gone for good; say so
+	// rather than offering to remove it.
+	dirOffline := false
+	if fileNotFound {
+		if d, err := s.store.GetDirectory(r.Context(), video.DirectoryID); err == nil {
+			dirOffline = !s.checkDirectoryOnline(r.Context(), d)
+		}
+	}
 
-	srtPath := strings.TrimSuffix(video.FilePath(), filepath.Ext(video.FilePath())) + ".srt"
-	_, srtErr := os.Stat(srtPath)
-	hasSubtitles := srtErr == nil
+	// Zero for videos that were not downloaded.
+	source, _ := s.store.GetVideoSource(r.Context(), video.ID)
+
+	// Only worth deciding when there is a file to play.
+	playback := newPlaybackDecision(video.ID, playDirect, "", 0, 0)
+	quality := s.activeQualityPreset(r)
+	var subtitles []subtitleTrack
+	var audio []audioChoice
+	var chapters []chapterLink
+	sidecarSubs := s.videoSubtitles(r.Context(), video)
+	defaultAudio := playback
+	if !fileNotFound {
+		playback = s.playerPlayback(r.Context(), video, quality)
+		defaultAudio = playback
+		if streams, err := metadata.ReadStreams(video.FilePath()); err == nil {
+			subtitles = subtitleTracks(streams)
+			audio = audioChoices(playback, video.ID, metadata.AudioTracks(streams))
+		}
+		chapters = s.videoChapters(r.Context(), video)
+		playback = s.applyLanguagePrefs(r, video, playback)
+	}
+	// Show the preferred subtitle, or else the file named after the video.
+	switch {
+	case playback.SubtitleURL != "":
+		for i := range sidecarSubs {
+			sidecarSubs[i].Default = playback.SubtitleURL == (subtitlePick{File: sidecarSubs[i].File}).URL(video.ID)
+		}
+		for i := range subtitles {
+			subtitles[i].Default = playback.SubtitleURL == (subtitlePick{Track: subtitles[i].Track}).URL(video.ID)
+		}
+	case len(sidecarSubs) > 0:
+		sidecarSubs[0].Default = true
+	}
+	for i := range audio {
+		audio[i].Selected = playback.AudioTrack != nil && *playback.AudioTrack == audio[i].Track
+	}
+	sign := s.streamSigner(r.Context())
+	playback = playback.signed(sign)
+	defaultAudio = defaultAudio.signed(sign)
+	for i := range audio {
+		audio[i].URL = sign(audio[i].URL)
+	}
+	startAt := s.playerStart(r, video)
 
 	libPath, _ := s.store.GetSetting(r.Context(), "library_path")
+	autoplayNext, _ := s.store.GetSetting(r.Context(), "autoplay_next")
+	presets, _ := s.store.ListQualityPresets(r.Context())
+	extras, err := s.videoExtras(r.Context(), video)
+	if err != nil {
+		slog.Warn("list extras failed", "videoID", video.ID, "err", err)
+	}
+	companion, _ := s.store.GetCompanionClip(r.Context(), video.ID)
 	data := struct {
 		Video        store.Video
 		Tags         []store.Tag
-		AllTags      []store.Tag
 		FileNotFound bool
-		HasSubtitles bool
+		DirOffline   bool
+		SidecarSubs  []sidecarSubtitle // .srt/.vtt files beside the video
 		LibraryPath  string
 		Formats      []transcode.FormatEntry
-	}{video, tags, allTags, fileNotFound, hasSubtitles, strings.TrimSpace(libPath), transcode.FormatList}
+		Source       store.VideoSource
+		Qualities    []ytdlpQuality
+		Playback     playbackDecision
+		Subtitles    []subtitleTrack  // embedded text subtitle streams
+		AudioTracks  []audioChoice    // set when the file has more than one
+		DefaultAudio playbackDecision // Playback with the file's default audio track
+		Chapters     []chapterLink
+		Extras       []store.VideoExtra
+		StartAt      float64 // seconds; see playerStart
+		AutoplayNext bool    // open GET /videos/{id}/next when playback ends
+		StarRatings  bool    // rate with star_rating.html rather than ♥/★
+		Companion    string  // the photo a companion clip belongs to
+		Presets      []store.QualityPreset
+		Quality      store.QualityPreset // the device's preset; zero for original quality
+	}{video, tags, fileNotFound, dirOffline, sidecarSubs, strings.TrimSpace(libPath), transcode.FormatList, source, ytdlpQualities, playback, subtitles, audio, defaultAudio, chapters, extras, startAt, autoplayNext == "true", s.starRatings(r.Context()), companion.Photo, presets, quality}
 	render(w, "player.html", data)
 }
 
-// handleServeSubtitles converts a sidecar .srt file to WebVTT on-the-fly and
-// serves it so the browser <track> element can consume it directly.
-func (s *server) handleServeSubtitles(w http.ResponseWriter, r *http.Request) {
-	video, ok := s.videoOrError(w, r)
-	if !ok {
-		return
-	}
-	srtPath := strings.TrimSuffix(video.FilePath(), filepath.Ext(video.FilePath())) + ".srt"
-	data, err := os.ReadFile(srtPath)
-	if err != nil {
-		http.NotFound(w, r)
-		return
-	}
-	vtt := srtToWebVTT(string(data))
-	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
-	fmt.Fprint(w, vtt)
-}
-
 // srtToWebVTT converts SRT subtitle text to WebVTT format.
 // The only structural differences are the header and timestamp separators:
 // SRT uses commas for milliseconds (00:00:01,000) while WebVTT uses dots
@@ -124,7 +215,26 @@ func (s *server) handleVideoFile(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	http.ServeFile(w, r, video.FilePath())
+	f, err := s.blobs.Open(video.FilePath())
+	if err != nil {
+		if d, dErr := s.store.GetDirectory(r.Context(), video.DirectoryID); dErr == nil && d.Offline {
+			http.Error(w, "the drive holding this video is offline", http.StatusServiceUnavailable)
+			return
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "video file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "cannot open video file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.Error(w, "cannot read video file", http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, video.Filename, fi.ModTime(), f)
 }
 
 // ── Video: name, tags, rating, delete, relocate ──────────────────────────────
@@ -136,12 +246,12 @@ func (s *server) handleUpdateVideoName(w http.ResponseWriter, r *http.Request) {
 	}
 	name := r.FormValue("name")
 	if err := s.store.UpdateVideoName(r.Context(), id, name); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	video, err := s.store.GetVideo(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	if name != "" {
@@ -152,7 +262,7 @@ func (s *server) handleUpdateVideoName(w http.ResponseWriter, r *http.Request) {
 	// Trigger a video-list refresh so the sidebar reflects the new name immediately,
 	// and a metadata panel refresh for the player page.
 	w.Header().Set("HX-Trigger", fmt.Sprintf(`{"videoRenamed":true,"videoLabelled":{"id":%d}}`, id))
-	w.Write([]byte(html.EscapeString(video.Title()))) //nolint:errcheck
+	render(w, "text.html", video.Title())
 }
 
 func (s *server) handleVideoTags(w http.ResponseWriter, r *http.Request) {
@@ -162,10 +272,10 @@ func (s *server) handleVideoTags(w http.ResponseWriter, r *http.Request) {
 	}
 	tags, err := s.store.ListTagsByVideo(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
-	render(w, "video_tags.html", videoTagsData{id, tags})
+	render(w, "video_tags.html", s.newVideoTagsData(r.Context(), s.requestUser(r).ID, id, tags))
 }
 
 func (s *server) handleAddVideoTag(w http.ResponseWriter, r *http.Request) {
@@ -178,23 +288,22 @@ func (s *server) handleAddVideoTag(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "tag name required", http.StatusBadRequest)
 		return
 	}
-	reservedPrefixes := []string{"show:", "type:", "genre:", "actor:", "studio:", "channel:"}
-	for _, p := range reservedPrefixes {
-		if strings.HasPrefix(strings.ToLower(tagName), p) {
-			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			fmt.Fprintf(w, `<p style="font-size:0.82rem;color:#f87">Use the dedicated field to set %s</p>`, html.EscapeString(strings.TrimSuffix(p, ":")))
-			return
-		}
+	if p, ok := reservedTagPrefix(tagName); ok {
+		renderNotice(w, false, "Use the dedicated field to set "+strings.TrimSuffix(p, ":"))
+		return
 	}
 	tag, err := s.store.UpsertTag(r.Context(), tagName)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	if err := s.store.TagVideo(r.Context(), id, tag.ID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
+	if err := s.store.RecordTagUse(r.Context(), s.requestUser(r).ID, tag.ID); err != nil {
+		slog.Warn("record tag use failed", "tag", tag.Name, "err", err)
+	}
 	s.refreshVideoTags(w, r, id)
 }
 
@@ -209,7 +318,7 @@ func (s *server) handleRemoveVideoTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.store.UntagVideo(r.Context(), id, tagID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	if err := s.store.PruneOrphanTags(r.Context()); err != nil {
@@ -218,6 +327,145 @@ func (s *server) handleRemoveVideoTag(w http.ResponseWriter, r *http.Request) {
 	s.refreshVideoTags(w, r, id)
 }
 
+// reservedTagPrefixes are the system-tag namespaces managed through
+// dedicated fields rather than the free-form tag inputs.
+var reservedTagPrefixes = []string{"show:", "type:", "genre:", "actor:", "studio:", "channel:"}
+
+// reservedTagPrefix reports the reserved namespace prefix name starts with.
+func reservedTagPrefix(name string) (string, bool) {
+	for _, p := range reservedTagPrefixes {
+		if strings.HasPrefix(strings.ToLower(name), p) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// batchTagsData is the template model for batch_tags.html: the selected
+// videos against the union of their plain tags.
+type batchTagsData struct {
+	IDs    string // comma-separated, echoed back on submit
+	Videos []store.Video
+	Tags   []store.Tag
+	Has    map[int64]map[int64]bool // video ID → tag ID → tagged
+	Error  string
+}
+
+// loadBatchTags builds the tag matrix for ids. Namespaced system tags are
+// left out; they are edited through their dedicated fields.
+func (s *server) loadBatchTags(ctx context.Context, ids []int64) (batchTagsData, error) {
+	data := batchTagsData{Has: make(map[int64]map[int64]bool, len(ids))}
+	strIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		v, err := s.store.GetVideo(ctx, id)
+		if err != nil {
+			continue // deleted since it was selected
+		}
+		data.Videos = append(data.Videos, v)
+		strIDs = append(strIDs, strconv.FormatInt(id, 10))
+	}
+	data.IDs = strings.Join(strIDs, ",")
+	byVideo, err := s.store.ListTagsByVideos(ctx, ids)
+	if err != nil {
+		return data, err
+	}
+	seen := make(map[int64]bool)
+	for videoID, tags := range byVideo {
+		data.Has[videoID] = make(map[int64]bool, len(tags))
+		for _, t := range tags {
+			if strings.Contains(t.Name, ":") {
+				continue
+			}
+			data.Has[videoID][t.ID] = true
+			if !seen[t.ID] {
+				seen[t.ID] = true
+				data.Tags = append(data.Tags, t)
+			}
+		}
+	}
+	slices.SortFunc(data.Tags, func(a, b store.Tag) int { return strings.Compare(a.Name, b.Name) })
+	return data, nil
+}
+
+// handleBatchTagsForm serves GET /videos/batch-tags?ids=1,2,3: a matrix of
+// the selected videos and their tags for bulk clean-up.
+func (s *server) handleBatchTagsForm(w http.ResponseWriter, r *http.Request) {
+	ids, err := parseIDList(r.URL.Query().Get("ids"))
+	if err != nil || len(ids) == 0 {
+		http.Error(w, "ids required", http.StatusBadRequest)
+		return
+	}
+	data, err := s.loadBatchTags(r.Context(), ids)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "batch_tags.html", data)
+}
+
+// handleBatchTags serves POST /videos/batch-tags: it adds the comma-separated
+// tag names in "add" to, and removes each "remove" tag ID from, every video in
+// "ids" in one transaction, then re-renders the matrix. Tags are written back
+// to the files in the background since that runs ffmpeg once per video.
+func (s *server) handleBatchTags(w http.ResponseWriter, r *http.Request) {
+	ids, err := parseIDList(r.FormValue("ids"))
+	if err != nil || len(ids) == 0 {
+		http.Error(w, "ids required", http.StatusBadRequest)
+		return
+	}
+	var add []string
+	for _, name := range strings.Split(r.FormValue("add"), ",") {
+		if name = strings.TrimSpace(name); name == "" || slices.Contains(add, name) {
+			continue
+		}
+		if p, ok := reservedTagPrefix(name); ok {
+			data, _ := s.loadBatchTags(r.Context(), ids)
+			data.Error = "Use the dedicated field to set " + strings.TrimSuffix(p, ":")
+			render(w, "batch_tags.html", data)
+			return
+		}
+		add = append(add, name)
+	}
+	var remove []int64
+	for _, v := range r.Form["remove"] {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid tag id", http.StatusBadRequest)
+			return
+		}
+		remove = append(remove, id)
+	}
+	added, err := s.store.BatchUpdateTags(r.Context(), ids, add, remove)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	userID := s.requestUser(r).ID
+	for _, t := range added {
+		if err := s.store.RecordTagUse(r.Context(), userID, t.ID); err != nil {
+			slog.Warn("record tag use failed", "tag", t.Name, "err", err)
+		}
+	}
+	if len(remove) > 0 {
+		if err := s.store.PruneOrphanTags(r.Context()); err != nil {
+			slog.Warn("prune orphan tags failed", "err", err)
+		}
+	}
+	data, err := s.loadBatchTags(r.Context(), ids)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if len(added) > 0 || len(remove) > 0 {
+		go func(videos []store.Video) {
+			for _, v := range videos {
+				s.syncTagsToFile(context.Background(), v)
+			}
+		}(data.Videos)
+	}
+	render(w, "batch_tags.html", data)
+}
+
 func (s *server) handleVideoDeleteConfirm(w http.ResponseWriter, r *http.Request) {
 	video, ok := s.videoOrError(w, r)
 	if !ok {
@@ -239,9 +487,16 @@ func (s *server) handleDeleteVideoAndFile(w http.ResponseWriter, r *http.Request
 	if !ok {
 		return
 	}
-	if err := os.Remove(video.FilePath()); err != nil {
+	if err := s.blobs.Remove(video.FilePath()); err != nil {
 		slog.Warn("delete file failed", "path", video.FilePath(), "err", err)
 	}
+	// The generated thumbnail goes with the file; a chosen poster stays.
+	if thumb := autoThumbnailPath(video.FilePath()); video.ThumbnailPath == thumb {
+		if err := os.Remove(thumb); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("delete thumbnail failed", "path", thumb, "err", err)
+		}
+	}
+	s.pruneEmptyFolders(r.Context(), video.DirectoryPath)
 	s.deleteVideoAndRefresh(w, r, video.ID)
 }
 
@@ -255,7 +510,7 @@ func (s *server) handleRelocateVideo(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "newpath required", http.StatusBadRequest)
 		return
 	}
-	if _, err := os.Stat(newPath); err != nil {
+	if _, err := s.blobs.Stat(newPath); err != nil {
 		http.Error(w, "file not accessible at new path", http.StatusBadRequest)
 		return
 	}
@@ -265,7 +520,7 @@ func (s *server) handleRelocateVideo(w http.ResponseWriter, r *http.Request) {
 	// Restrict relocation to paths under a registered directory for security.
 	dirs, err := s.store.ListDirectories(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	dirID, underLib := findRegisteredDir(dirs, newDir)
@@ -278,14 +533,14 @@ func (s *server) handleRelocateVideo(w http.ResponseWriter, r *http.Request) {
 		// video is tracked under its own directory entry.
 		dir, err := s.store.AddDirectory(r.Context(), newDir)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			storeError(w, err)
 			return
 		}
 		dirID = dir.ID
 	}
 
 	if err := s.store.UpdateVideoPath(r.Context(), id, dirID, newDir, newFilename); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	s.handlePlayer(w, r)
@@ -293,118 +548,383 @@ func (s *server) handleRelocateVideo(w http.ResponseWriter, r *http.Request) {
 
 // ── Video list ────────────────────────────────────────────────────────────────
 
-// filterVideos applies optional type and rating filters from q in-place.
-func filterVideos(videos []store.Video, q url.Values) []store.Video {
-	if typeVal := q.Get("type"); typeVal != "" {
-		filtered := videos[:0]
-		for _, v := range videos {
-			if v.VideoType == typeVal {
-				filtered = append(filtered, v)
-			}
-		}
-		videos = filtered
+// videoSorts lists the library sort orders, in display order. "name" is
+// by folder, then title; the others are described by VideoQuery.Sort.
+var videoSorts = []struct{ Key, Label string }{
+	{"name", "Name"},
+	{"rating", "Rating (★ first)"},
+	{"added", "Recently added"},
+	{"watched", "Recently watched"},
+	{"duration", "Longest first"},
+	{"size", "Largest first"},
+}
+
+func validVideoSort(sort string) bool {
+	return slices.ContainsFunc(videoSorts, func(o struct{ Key, Label string }) bool { return o.Key == sort })
+}
+
+// sortVideos reorders videos loaded whole, such as a show's episodes, by an
+// explicitly requested sort, one of videoSorts or "stars".
+func sortVideos(videos []store.Video, order string) {
+	byTitle := func(a, b store.Video) int { return cmp.Compare(a.Title(), b.Title()) }
+	switch order {
+	case "rating":
+		slices.SortStableFunc(videos, func(a, b store.Video) int { return cmp.Or(b.Rating-a.Rating, byTitle(a, b)) })
+	case "stars":
+		slices.SortStableFunc(videos, func(a, b store.Video) int { return cmp.Or(b.Stars-a.Stars, byTitle(a, b)) })
+	case "added":
+		slices.SortStableFunc(videos, func(a, b store.Video) int { return cmp.Compare(b.ID, a.ID) })
+	case "watched":
+		// Never watched is empty, so it sorts last.
+		slices.SortStableFunc(videos, func(a, b store.Video) int { return cmp.Or(strings.Compare(b.WatchedAt, a.WatchedAt), byTitle(a, b)) })
+	case "duration":
+		slices.SortStableFunc(videos, func(a, b store.Video) int { return cmp.Or(cmp.Compare(b.DurationS, a.DurationS), byTitle(a, b)) })
+	case "size":
+		slices.SortStableFunc(videos, func(a, b store.Video) int { return cmp.Or(cmp.Compare(b.FileSize, a.FileSize), byTitle(a, b)) })
 	}
-	if q.Get("rating") != "" {
-		minRating, _ := strconv.Atoi(q.Get("rating"))
-		if minRating < 1 {
-			minRating = 1
+}
+
+// videoPageSize is how many videos the library list shows at first and adds
+// with each "Load more".
+const videoPageSize = 500
+
+// videoQueryFrom reads the library filters from a request's query: q,
+// tag_id, tags (comma-separated tag IDs, any of them, or all with
+// mode=all), dir_id, type, rating (at least; 0 is ignored), watched
+// (yes or no) and favorite (1 for favourites only). Unparsable values are
+// ignored.
+func videoQueryFrom(q url.Values) store.VideoQuery {
+	vq := store.VideoQuery{Search: q.Get("q"), Type: q.Get("type"), Watched: q.Get("watched")}
+	vq.TagID, _ = strconv.ParseInt(q.Get("tag_id"), 10, 64)
+	vq.TagIDs, _ = parseTagIDs(q.Get("tags"))
+	vq.AllTags = q.Get("mode") == "all"
+	vq.DirectoryID, _ = strconv.ParseInt(q.Get("dir_id"), 10, 64)
+	vq.MinRating, _ = strconv.Atoi(q.Get("rating"))
+	vq.Favorites = q.Get("favorite") == "1"
+	return vq
+}
+
+// parseTagIDs reads a comma-separated list of tag IDs, skipping blanks. ok
+// is false when an entry is not a positive ID; ids then holds the valid
+// ones.
+func parseTagIDs(list string) (ids []int64, ok bool) {
+	ok = true
+	for _, f := range strings.Split(list, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
 		}
-		filtered := videos[:0]
-		for _, v := range videos {
-			if v.Rating >= minRating {
-				filtered = append(filtered, v)
-			}
+		id, err := strconv.ParseInt(f, 10, 64)
+		if err != nil || id <= 0 {
+			ok = false
+			continue
 		}
-		videos = filtered
+		ids = append(ids, id)
 	}
-	return videos
+	return ids, ok
 }
 
-// serveVideoList renders the video list, respecting tag_id, q, and the
-// video_sort setting.
+// serveVideoList renders the video list, filtered as videoQueryFrom reads
+// the request, in the sort order: the sort parameter, else the active
+// profile's landing sort, else the video_sort setting. view=posters, else
+// the library_view setting, shows a poster grid instead of rows. The list is paged by limit
+// (default videoPageSize) and page (1-indexed); "Load more" asks for the
+// same list with a larger limit, so show and season groups stay whole.
 func (s *server) serveVideoList(w http.ResponseWriter, r *http.Request) {
-	var (
-		videos []store.Video
-		err    error
-	)
 	q := r.URL.Query()
-	sortOrder, _ := s.store.GetSetting(r.Context(), "video_sort")
-	if q.Get("q") != "" {
-		videos, err = s.store.SearchVideos(r.Context(), q.Get("q"))
-	} else {
-		if q.Get("tag_id") != "" {
-			tagID, _ := strconv.ParseInt(q.Get("tag_id"), 10, 64)
-			videos, err = s.store.ListVideosByTag(r.Context(), tagID)
-		} else if sortOrder == "rating" {
-			videos, err = s.store.ListVideosByRating(r.Context())
-		} else {
-			videos, err = s.store.ListVideos(r.Context())
-		}
-		if err == nil {
-			videos = filterVideos(videos, q)
-		}
+	sortOrder := q.Get("sort")
+	if p, ok := s.activeProfile(r); ok && sortOrder == "" {
+		sortOrder = p.LandingSort
 	}
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if sortOrder == "" {
+		sortOrder, _ = s.store.GetSetting(r.Context(), "video_sort")
 	}
-	// SQL ORDER BY already returns videos in the correct order; no Go-level sort needed.
-	// Pagination: default 500 per page; page= is 1-indexed.
-	const defaultPageSize = 500
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
 	if limit <= 0 {
-		limit = defaultPageSize
+		limit = videoPageSize
 	}
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page, _ := strconv.Atoi(q.Get("page"))
 	if page < 1 {
 		page = 1
 	}
-	total := len(videos)
-	start := min((page-1)*limit, total)
-	end := min(start+limit, total)
-	pageVideos := videos[start:end]
+	offset := (page - 1) * limit
+
+	vq := videoQueryFrom(q)
+	vq.Sort, vq.Limit, vq.Offset = s.ratingSort(r.Context(), sortOrder), limit, offset
+	vq.Companions = s.includeCompanions(r.Context())
+	videos, total, err := s.store.ListVideosPage(r.Context(), vq)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
 
 	// WatchedAt is embedded in each Video via SQL LEFT JOIN; no separate query needed.
+	fieldSetting, _ := s.store.GetSetting(r.Context(), "card_fields")
+	cards := s.buildCards(r.Context(), videos, parseCardFields(fieldSetting))
+	view := q.Get("view")
+	if view == "" {
+		view, _ = s.store.GetSetting(r.Context(), "library_view")
+	}
+	// "Load more" repeats this request from the first video with room for
+	// one more page.
+	var moreURL string
+	if page == 1 && limit < total {
+		more := maps.Clone(q)
+		more.Set("limit", strconv.Itoa(limit+videoPageSize))
+		more.Del("page")
+		moreURL = "/videos?" + more.Encode()
+	}
 	data := struct {
 		Groups   []videoGroup
 		Page     int
 		PageSize int
+		Shown    int
 		Total    int
-	}{groupVideosByShowSeason(pageVideos), page, limit, total}
+		MoreURL  string
+		Posters  bool
+	}{groupVideosByShowSeason(cards), page, limit, len(videos), total, moreURL, view == "posters"}
 	render(w, "video_list.html", data)
 }
 
+// cardFieldOptions lists the optional library card fields, in display order.
+// The "card_fields" setting holds a comma-separated subset of the keys.
+var cardFieldOptions = []struct{ Key, Label string }{
+	{"watched", "Watched badge"},
+	{"rating", "Rating"},
+	{"favorite", "Watch-again flag"},
+	{"duration", "Duration"},
+	{"resolution", "Resolution"},
+	{"size", "File size"},
+	{"tags", "Tags"},
+}
+
+// parseCardFields turns the "card_fields" setting into a set, ignoring
+// unknown keys.
+func parseCardFields(setting string) map[string]bool {
+	fields := make(map[string]bool)
+	for _, k := range strings.Split(setting, ",") {
+		k = strings.TrimSpace(k)
+		for _, opt := range cardFieldOptions {
+			if opt.Key == k {
+				fields[k] = true
+			}
+		}
+	}
+	return fields
+}
+
+// cardBadge is one formatted piece of optional information on a card.
+type cardBadge struct {
+	Text  string
+	Title string
+	Color string // CSS colour; empty = inherit
+}
+
+// videoCard is a library list row: the video plus whichever optional fields
+// are enabled, already formatted so the template only has to range over them.
+type videoCard struct {
+	store.Video
+	Marks  []cardBadge // icons before the title (watched ✓, rating ★/♥)
+	Badges []cardBadge // chips after the extension (duration, resolution, size, tags, last watched)
+}
+
+// buildCards shapes videos into cards showing only the enabled fields.
+// Tags are looked up only when their field is enabled.
+func (s *server) buildCards(ctx context.Context, videos []store.Video, fields map[string]bool) []videoCard {
+	var tagsByVideo map[int64][]store.Tag
+	if fields["tags"] {
+		ids := make([]int64, len(videos))
+		for i, v := range videos {
+			ids[i] = v.ID
+		}
+		var err error
+		if tagsByVideo, err = s.store.ListTagsByVideos(ctx, ids); err != nil {
+			slog.Warn("card tags lookup failed", "err", err)
+		}
+	}
+	stars := fields["rating"] && s.starRatings(ctx)
+	// Companion clips are only listed when included, and are then marked.
+	var companions map[int64]bool
+	if s.includeCompanions(ctx) {
+		var err error
+		if companions, err = s.store.ListCompanionVideoIDs(ctx); err != nil {
+			slog.Warn("card companions lookup failed", "err", err)
+		}
+	}
+	cards := make([]videoCard, len(videos))
+	for i, v := range videos {
+		c := videoCard{Video: v}
+		if companions[v.ID] {
+			c.Marks = append(c.Marks, cardBadge{"◐", "Photo companion clip", "#888"})
+		}
+		if fields["watched"] && v.Watched {
+			c.Marks = append(c.Marks, cardBadge{"✓", "Watched", "#4a9"})
+		}
+		if fields["rating"] && stars {
+			if v.Stars > 0 {
+				c.Marks = append(c.Marks, cardBadge{strings.Repeat("★", v.Stars), fmt.Sprintf("%d of 5 stars", v.Stars), "#fc0"})
+			}
+		} else if fields["rating"] {
+			switch v.Rating {
+			case 2:
+				c.Marks = append(c.Marks, cardBadge{"★", "Favourite", ""})
+			case 1:
+				c.Marks = append(c.Marks, cardBadge{"♥", "Liked", ""})
+			}
+		}
+		if fields["favorite"] && v.Favorite {
+			c.Marks = append(c.Marks, cardBadge{"⚑", "Watch again soon", "#9cf"})
+		}
+		if fields["duration"] && v.DurationS > 0 {
+			c.Badges = append(c.Badges, cardBadge{formatDuration(v.DurationS), "Duration", ""})
+		}
+		if fields["resolution"] && v.Height > 0 {
+			c.Badges = append(c.Badges, cardBadge{resolutionLabel(v.Height), fmt.Sprintf("%d×%d", v.Width, v.Height), ""})
+		}
+		if fields["size"] && v.FileSize > 0 {
+			c.Badges = append(c.Badges, cardBadge{formatBytes(v.FileSize), "File size", ""})
+		}
+		if fields["tags"] {
+			for _, t := range tagsByVideo[v.ID] {
+				if !strings.Contains(t.Name, ":") { // system tags are shown elsewhere
+					c.Badges = append(c.Badges, cardBadge{"#" + t.Name, "Tag", "#557"})
+				}
+			}
+		}
+		if fields["watched"] && v.Watched && v.WatchedAt != "" {
+			c.Badges = append(c.Badges, cardBadge{reltime(v.WatchedAt), "Last watched", ""})
+		}
+		cards[i] = c
+	}
+	return cards
+}
+
+// formatDuration renders seconds as "h:mm:ss" or "m:ss".
+func formatDuration(secs float64) string {
+	t := int(secs + 0.5)
+	if t >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", t/3600, t/60%60, t%60)
+	}
+	return fmt.Sprintf("%d:%02d", t/60, t%60)
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "1.4 GB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// resolutionLabel names a video height the way players do ("1080p", "4K").
+func resolutionLabel(height int) string {
+	switch {
+	case height >= 2160:
+		return "4K"
+	case height >= 1440:
+		return "1440p"
+	default:
+		return strconv.Itoa(height) + "p"
+	}
+}
+
 // ── Watch history / progress ──────────────────────────────────────────────────
 
+// watchedFraction reads the share of a video after which it counts as
+// watched (and no longer needs continuing).
+func (s *server) watchedFraction(ctx context.Context) float64 {
+	v, _ := s.store.GetSetting(ctx, "watched_percent")
+	if p, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && p >= 1 && p <= 100 {
+		return float64(p) / 100
+	}
+	return defaultWatchPercent / 100.0
+}
+
+// handlePostProgress saves the playback position from the form field
+// position (seconds). The video is marked watched once the position passes
+// the watched share of its duration; players also send duration, which is
+// stored for videos whose length the scan couldn't read.
 func (s *server) handlePostProgress(w http.ResponseWriter, r *http.Request) {
-	id, ok := parseIDParam(w, r)
+	video, ok := s.videoOrError(w, r)
 	if !ok {
 		return
 	}
 	pos, _ := strconv.ParseFloat(r.FormValue("position"), 64)
-	if err := s.store.RecordWatch(r.Context(), id, pos); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	duration := video.DurationS
+	if d, err := strconv.ParseFloat(r.FormValue("duration"), 64); duration <= 0 && err == nil && d > 0 && !math.IsInf(d, 0) {
+		duration = d
+		if err := s.store.UpdateVideoDuration(r.Context(), video.ID, d); err != nil {
+			slog.Warn("progress: save duration failed", "video_id", video.ID, "err", err)
+		}
+	}
+	record := s.store.RecordProgress
+	if duration > 0 && pos >= duration*s.watchedFraction(r.Context()) {
+		record = s.store.RecordWatch
+	}
+	if err := record(r.Context(), video.ID, pos); err != nil {
+		storeError(w, err)
 		return
 	}
+	if p, ok := s.activeProfile(r); ok {
+		s.countWatchTime(r.Context(), p)
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// resumePosition is where playback resumes from a saved position: nowhere
+// for a second or less, and from the start again within resumeEndSlack of
+// the end. duration 0 (not yet probed) never restarts.
+func resumePosition(pos, duration float64) float64 {
+	if pos <= 1 || duration > 0 && pos >= duration-resumeEndSlack {
+		return 0
+	}
+	return pos
+}
+
+// playerStart is the second the player opens at: ?t=SECONDS when the
+// request is a deep link (a chapter, a bookmark or a shared link), else
+// the saved position.
+func (s *server) playerStart(r *http.Request, v store.Video) float64 {
+	if t := r.URL.Query().Get("t"); t != "" {
+		secs, err := strconv.ParseFloat(t, 64)
+		if err != nil || math.IsNaN(secs) || math.IsInf(secs, 0) || secs < 0 {
+			return 0
+		}
+		return secs
+	}
+	rec, err := s.store.GetWatch(r.Context(), v.ID)
+	if err != nil {
+		return 0
+	}
+	return resumePosition(rec.Position, v.DurationS)
+}
+
 func (s *server) handleGetProgress(w http.ResponseWriter, r *http.Request) {
 	id, ok := parseIDParam(w, r)
 	if !ok {
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	rec, err := s.store.GetWatch(r.Context(), id)
-	if err != nil {
-		// Not yet watched — return zero position.
-		json.NewEncoder(w).Encode(map[string]any{"position": 0, "watched_at": ""}) //nolint:errcheck
-		return
+	// Not yet watched — return zero position.
+	resp := map[string]any{"position": 0, "resume": 0, "watched_at": ""}
+	if rec, err := s.store.GetWatch(r.Context(), id); err == nil {
+		resp["position"], resp["watched_at"] = rec.Position, rec.WatchedAt
+		if v, err := s.store.GetVideo(r.Context(), id); err == nil {
+			resp["resume"] = resumePosition(rec.Position, v.DurationS)
+		}
 	}
-	json.NewEncoder(w).Encode(map[string]any{ //nolint:errcheck
-		"position":   rec.Position,
-		"watched_at": rec.WatchedAt,
-	})
+	// The intro and credits ranges let the player offer to skip them.
+	if ranges, err := s.skipRanges(r.Context(), id); err == nil {
+		for kind, rg := range ranges {
+			resp[kind] = rg
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp) //nolint:errcheck
 }
 
 // handleMarkWatched manually marks a video as watched and refreshes the
@@ -415,7 +935,7 @@ func (s *server) handleMarkWatched(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.store.RecordWatch(r.Context(), id, 1); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	s.serveVideoList(w, r)
@@ -427,7 +947,7 @@ func (s *server) handleClearProgress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.store.ClearWatch(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	s.serveVideoList(w, r)
@@ -447,7 +967,7 @@ func (s *server) handleCopyToLibrary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	src := video.FilePath()
-	if _, err := os.Stat(src); err != nil {
+	if _, err := s.blobs.Stat(src); err != nil {
 		http.Error(w, "source file not found", http.StatusNotFound)
 		return
 	}
@@ -460,11 +980,11 @@ func (s *server) handleCopyToLibrary(w http.ResponseWriter, r *http.Request) {
 	stem := strings.TrimSuffix(base, ext)
 	dstName := freeOutputName(libPath, stem, "", ext)
 	dst := filepath.Join(libPath, dstName)
-	if err := copyFile(src, dst); err != nil {
+	if err := blob.Copy(s.blobs, src, dst); err != nil {
 		http.Error(w, "copy failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	fmt.Fprintf(w, `<span style="color:#4a9a4a;font-size:0.8rem">✓ Copied to %s</span>`, dstName)
+	renderNotice(w, true, "Copied to "+dstName)
 }
 
 // handleRenameVideo renames a video file on disk and updates the DB.
@@ -483,20 +1003,22 @@ func (s *server) handleRenameVideo(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid filename", http.StatusBadRequest)
 		return
 	}
+	ext := filepath.Ext(newName)
+	newName = naming.Filename(strings.TrimSuffix(newName, ext), ext)
 	if newName == video.Filename {
 		s.serveVideoList(w, r)
 		return
 	}
 	src := video.FilePath()
 	dst := filepath.Join(video.DirectoryPath, newName)
-	if err := os.Rename(src, dst); err != nil {
+	if err := s.blobs.Rename(src, dst); err != nil {
 		http.Error(w, "rename failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 	if err := s.store.UpdateVideoPath(r.Context(), video.ID, video.DirectoryID, video.DirectoryPath, newName); err != nil {
 		// Best-effort rollback.
-		_ = os.Rename(dst, src)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		_ = s.blobs.Rename(dst, src)
+		storeError(w, err)
 		return
 	}
 	s.serveVideoList(w, r)
@@ -529,14 +1051,14 @@ func (s *server) resolveDestDir(ctx context.Context, targetDir store.Directory,
 	return destPath, newDir.ID, nil
 }
 
-// moveFile moves src to dst. It tries os.Rename first and falls back to a
-// copy+delete for cross-device moves. Returns crossDevice=true when the
-// fallback was used (the source still exists until the caller removes it).
-func moveFile(src, dst string) (crossDevice bool, err error) {
-	if err := os.Rename(src, dst); err == nil {
+// moveFile moves src to dst within st. It tries a rename first and falls
+// back to a copy+delete for cross-device moves. Returns crossDevice=true when
+// the fallback was used (the source still exists until the caller removes it).
+func moveFile(st blob.Storage, src, dst string) (crossDevice bool, err error) {
+	if err := st.Rename(src, dst); err == nil {
 		return false, nil
 	}
-	if err := copyFile(src, dst); err != nil {
+	if err := blob.Copy(st, src, dst); err != nil {
 		return true, err
 	}
 	return true, nil
@@ -600,12 +1122,12 @@ func (s *server) handleMoveVideo(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "source and destination are the same", http.StatusBadRequest)
 		return
 	}
-	if _, err := os.Stat(dst); err == nil {
+	if _, err := s.blobs.Stat(dst); err == nil {
 		http.Error(w, "a file with that name already exists in the destination", http.StatusConflict)
 		return
 	}
 
-	crossDevice, err := moveFile(src, dst)
+	crossDevice, err := moveFile(s.blobs, src, dst)
 	if err != nil {
 		http.Error(w, "move failed: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -614,27 +1136,28 @@ func (s *server) handleMoveVideo(w http.ResponseWriter, r *http.Request) {
 	if err := s.store.UpdateVideoPath(r.Context(), video.ID, destDirID, destDirPath, video.Filename); err != nil {
 		// DB update failed — roll back the filesystem change for consistency.
 		if crossDevice {
-			if rb := os.Remove(dst); rb != nil {
+			if rb := s.blobs.Remove(dst); rb != nil {
 				slog.Error("move rollback failed: copy is at dst but DB was not updated",
 					"src", src, "dst", dst, "dbErr", err, "rbErr", rb)
 			}
 		} else {
-			if rb := os.Rename(dst, src); rb != nil {
+			if rb := s.blobs.Rename(dst, src); rb != nil {
 				slog.Error("move rollback failed", "src", src, "dst", dst, "dbErr", err, "rbErr", rb)
 			}
 		}
-		http.Error(w, "move failed (database update): "+err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 
 	if crossDevice {
-		if err := os.Remove(src); err != nil {
+		if err := s.blobs.Remove(src); err != nil {
 			slog.Warn("cross-device move: could not remove source after successful DB update",
 				"src", src, "err", err)
 		}
 	}
 
 	s.moveVideoThumbnail(r.Context(), video, destDirPath)
+	s.pruneEmptyFolders(r.Context(), video.DirectoryPath)
 
 	// Sync both directories so the library reflects the change.
 	s.startSyncDir(targetDir)
@@ -698,6 +1221,7 @@ func (s *server) runBulkMove(job *bulkMoveJob, idStrs []string, targetDir store.
 
 	ctx := context.Background()
 	sourceDirs := map[int64]struct{}{}
+	sourceFolders := map[string]struct{}{}
 
 	for i, idStr := range idStrs {
 		id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
@@ -720,13 +1244,13 @@ func (s *server) runBulkMove(job *bulkMoveJob, idStrs []string, targetDir store.
 		if src == dst {
 			continue // already in target
 		}
-		if _, err := os.Stat(dst); err == nil {
+		if _, err := s.blobs.Stat(dst); err == nil {
 			job.fails++
 			job.ch <- fmt.Sprintf("Error: %s: already exists in destination", video.Filename)
 			continue
 		}
 
-		crossDevice, err := moveFile(src, dst)
+		crossDevice, err := moveFile(s.blobs, src, dst)
 		if err != nil {
 			job.fails++
 			job.ch <- fmt.Sprintf("Error: %s: %s", video.Filename, err.Error())
@@ -735,9 +1259,9 @@ func (s *server) runBulkMove(job *bulkMoveJob, idStrs []string, targetDir store.
 
 		if err := s.store.UpdateVideoPath(ctx, video.ID, destDirID, destDirPath, video.Filename); err != nil {
 			if crossDevice {
-				os.Remove(dst) //nolint:errcheck
+				s.blobs.Remove(dst) //nolint:errcheck
 			} else {
-				os.Rename(dst, src) //nolint:errcheck
+				s.blobs.Rename(dst, src) //nolint:errcheck
 			}
 			job.fails++
 			job.ch <- fmt.Sprintf("Error: %s: db update failed", video.Filename)
@@ -745,7 +1269,7 @@ func (s *server) runBulkMove(job *bulkMoveJob, idStrs []string, targetDir store.
 		}
 
 		if crossDevice {
-			if err := os.Remove(src); err != nil {
+			if err := s.blobs.Remove(src); err != nil {
 				slog.Warn("bulk move: could not remove source", "src", src, "err", err)
 			}
 		}
@@ -755,6 +1279,10 @@ func (s *server) runBulkMove(job *bulkMoveJob, idStrs []string, targetDir store.
 		if video.DirectoryID != 0 {
 			sourceDirs[video.DirectoryID] = struct{}{}
 		}
+		sourceFolders[video.DirectoryPath] = struct{}{}
+	}
+	for folder := range sourceFolders {
+		s.pruneEmptyFolders(ctx, folder)
 	}
 
 	// Sync directories once at the end.
@@ -823,17 +1351,83 @@ func (s *server) handleSetRating(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.store.SetVideoRating(r.Context(), video.ID, rating); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	updated, err := s.store.GetVideo(r.Context(), video.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	render(w, "rating_buttons.html", updated)
 }
 
+// starRatings reports whether the rating_scale setting asks for 1–5 stars
+// rather than the ♥/★ thumbs.
+func (s *server) starRatings(ctx context.Context) bool {
+	scale, _ := s.store.GetSetting(ctx, "rating_scale")
+	return scale == "stars"
+}
+
+// ratingSort is the store sort for order: under the star scale "rating"
+// ranks by stars, so 3 stars sit above 1 though neither is liked.
+func (s *server) ratingSort(ctx context.Context, order string) string {
+	if order == "rating" && s.starRatings(ctx) {
+		return "stars"
+	}
+	return order
+}
+
+// POST /videos/{id}/stars sets the star rating (form value stars, 0 to 5;
+// 0 clears it) and renders the stars.
+func (s *server) handleSetStars(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	stars, err := strconv.Atoi(r.FormValue("stars"))
+	if err != nil || stars < 0 || stars > 5 {
+		http.Error(w, "stars must be 0 to 5", http.StatusBadRequest)
+		return
+	}
+	if err := s.store.SetVideoStars(r.Context(), video.ID, stars); err != nil {
+		storeError(w, err)
+		return
+	}
+	updated, err := s.store.GetVideo(r.Context(), video.ID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "star_rating.html", updated)
+}
+
+// POST /videos/{id}/favorite marks the video to watch again soon (form
+// value favorite, 1 or 0) and renders the button. The rating is left
+// alone, and the favourites row on the index refreshes.
+func (s *server) handleSetFavorite(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	favorite := r.FormValue("favorite")
+	if favorite != "0" && favorite != "1" {
+		http.Error(w, "favorite must be 0 or 1", http.StatusBadRequest)
+		return
+	}
+	if err := s.store.SetVideoFavorite(r.Context(), video.ID, favorite == "1"); err != nil {
+		storeError(w, err)
+		return
+	}
+	updated, err := s.store.GetVideo(r.Context(), video.ID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	w.Header().Set("HX-Trigger", "favoritesChanged")
+	render(w, "favorite_button.html", updated)
+}
+
 // ── Video Type ────────────────────────────────────────────────────────────────
 
 func (s *server) handleSetVideoType(w http.ResponseWriter, r *http.Request) {
@@ -847,12 +1441,12 @@ func (s *server) handleSetVideoType(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.store.UpdateVideoType(r.Context(), video.ID, videoType); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	updated, err := s.store.GetVideo(r.Context(), video.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	w.Header().Set("HX-Trigger", fmt.Sprintf(`{"videoLabelled":{"id":%d}}`, video.ID))
@@ -872,12 +1466,12 @@ func (s *server) handleSetVideoColor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.store.SetExclusiveSystemTag(r.Context(), video.ID, "color", color); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	updated, err := s.store.GetVideo(r.Context(), video.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	render(w, "color_label.html", updated)
@@ -890,19 +1484,33 @@ func (s *server) handleSharePanel(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	suffix := fmt.Sprintf("/video/%d", video.ID)
-	addrs := localAddresses(s.port)
-	links := make([]string, 0, len(addrs)+1)
+	sign := s.streamSigner(r.Context())
+	suffix := sign(fmt.Sprintf("/video/%d", video.ID))
+	audioSuffix := sign(fmt.Sprintf("/videos/%d/audio", video.ID))
+	hosts := localAddresses(s.port)
 	if s.mdnsName != "" {
-		links = append(links, "http://"+s.mdnsName+":"+s.port+suffix)
-	}
-	for _, a := range addrs {
-		links = append(links, a+suffix)
+		hosts = append([]string{"http://" + s.mdnsName + ":" + s.port}, hosts...)
+	}
+	var pageSuffix string
+	if s.sharePagesEnabled(r.Context()) {
+		pageSuffix = s.sharePageURL(video.ID)
+	}
+	links := make([]string, 0, len(hosts))
+	audioLinks := make([]string, 0, len(hosts))
+	var pageLinks []string
+	for _, h := range hosts {
+		links = append(links, h+suffix)
+		audioLinks = append(audioLinks, h+audioSuffix)
+		if pageSuffix != "" {
+			pageLinks = append(pageLinks, h+pageSuffix)
+		}
 	}
 	render(w, "share_panel.html", struct {
-		VideoID int64
-		Links   []string
-	}{video.ID, links})
+		VideoID    int64
+		Links      []string
+		AudioLinks []string
+		PageLinks  []string
+	}{video.ID, links, audioLinks, pageLinks})
 }
 
 // ── Duplicates / utility ──────────────────────────────────────────────────────
@@ -917,7 +1525,7 @@ type dupGroup struct {
 func (s *server) handleListDuplicates(w http.ResponseWriter, r *http.Request) {
 	videos, err := s.store.ListVideos(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 
@@ -927,7 +1535,7 @@ func (s *server) handleListDuplicates(w http.ResponseWriter, r *http.Request) {
 	}
 	buckets := map[key][]store.Video{}
 	for _, v := range videos {
-		info, err := os.Stat(v.FilePath())
+		info, err := s.blobs.Stat(v.FilePath())
 		if err != nil {
 			continue // file missing from disk; skip
 		}
@@ -969,8 +1577,110 @@ func (s *server) handleNextUnwatched(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{"id": id, "title": title}) //nolint:errcheck
 }
 
+// isEpisode reports whether v has the show and season/episode numbers that
+// place it in a series.
+func isEpisode(v store.Video) bool {
+	return v.ShowName != "" && (v.SeasonNumber > 0 || v.EpisodeNumber > 0)
+}
+
+// videoAfter returns the video following id in videos.
+func videoAfter(videos []store.Video, id int64) (store.Video, bool) {
+	for i, v := range videos {
+		if v.ID == id && i+1 < len(videos) {
+			return videos[i+1], true
+		}
+	}
+	return store.Video{}, false
+}
+
+// handleNextEpisode returns the video to play after this one: the next
+// episode of the show by season and episode number, or, for a video that is
+// not part of a series, the next file by name in its folder. 404 when this
+// is the last one.
+func (s *server) handleNextEpisode(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	var (
+		videos []store.Video
+		err    error
+	)
+	if isEpisode(video) {
+		videos, err = s.store.ListVideosByShow(r.Context(), video.ShowName)
+		// Episodes without numbers cannot be placed in order.
+		videos = slices.DeleteFunc(videos, func(v store.Video) bool { return !isEpisode(v) })
+	} else {
+		videos, err = s.store.ListVideosByDirectory(r.Context(), video.DirectoryID)
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	next, ok := videoAfter(videos, video.ID)
+	if !ok {
+		http.Error(w, "no next video", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, map[string]any{"id": next.ID, "title": next.Title()})
+}
+
+// continueItem is one video in the continue-watching row.
+type continueItem struct {
+	Video     store.Video
+	Percent   int    // share watched; 0 when the duration is unknown
+	Remaining string // time left, e.g. "12:04"; empty when the duration is unknown
+}
+
+// handleContinueWatching renders the videos left part-way through, most
+// recently watched first. A position of a second or less is not resumed by
+// the player (and is what "Mark watched" records), so it does not count.
+func (s *server) handleContinueWatching(w http.ResponseWriter, r *http.Request) {
+	records, err := s.store.ListInProgress(r.Context(), 1, s.watchedFraction(r.Context()), continueLimit)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	items := make([]continueItem, 0, len(records))
+	for _, rec := range records {
+		v, err := s.store.GetVideo(r.Context(), rec.VideoID)
+		if err != nil {
+			continue
+		}
+		item := continueItem{Video: v}
+		if v.DurationS > 0 {
+			item.Percent = int(rec.Position * 100 / v.DurationS)
+			item.Remaining = formatDuration(v.DurationS - rec.Position)
+		}
+		items = append(items, item)
+	}
+	render(w, "continue_watching.html", items)
+}
+
+// handleFavorites renders the favourites row: the videos marked to watch
+// again soon, most recently added first.
+func (s *server) handleFavorites(w http.ResponseWriter, r *http.Request) {
+	videos, _, err := s.store.ListVideosPage(r.Context(), store.VideoQuery{Favorites: true, Sort: "added", Limit: favoritesLimit})
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "favorites_row.html", videos)
+}
+
+// GET|POST /random-video picks from the whole library, or with ids (a
+// comma-separated list, posted since a filtered list can be long) from those
+// videos, skipping the viewer's recent picks.
 func (s *server) handleRandomVideoID(w http.ResponseWriter, r *http.Request) {
-	video, err := s.store.GetRandomVideo(r.Context())
+	var among []int64
+	if ids := r.FormValue("ids"); ids != "" {
+		var err error
+		if among, err = parseIDList(ids); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	video, err := s.pickRandom(r, among)
 	if err != nil {
 		http.Error(w, "no videos", http.StatusNotFound)
 		return
@@ -994,12 +1704,12 @@ func (s *server) handleQuickLabelModal(w http.ResponseWriter, r *http.Request) {
 	}
 	tags, err := s.store.ListTagsByVideo(r.Context(), video.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	dirs, err := s.store.ListDirectories(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	render(w, "quick_label_modal.html", quickLabelData{Video: video, Tags: tags, Dirs: dirs})
@@ -1017,7 +1727,7 @@ func (s *server) handleQuickLabelSubmit(w http.ResponseWriter, r *http.Request)
 	name := r.FormValue("name")
 	if name != "" {
 		if err := s.store.UpdateVideoName(r.Context(), video.ID, name); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			storeError(w, err)
 			return
 		}
 	}
@@ -1032,7 +1742,7 @@ func (s *server) handleQuickLabelSubmit(w http.ResponseWriter, r *http.Request)
 		AirDate:       r.FormValue("air_date"),
 	}
 	if err := s.store.UpdateVideoFields(r.Context(), video.ID, fields); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	w.Header().Set("HX-Trigger", fmt.Sprintf(`{"videoLabelled":{"id":%d}}`, video.ID))
@@ -1064,12 +1774,137 @@ func (s *server) handleGenerateThumbnail(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	if err := s.store.UpdateVideoThumbnail(r.Context(), video.ID, thumbPath); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// handleSetPoster serves PUT /videos/{id}/thumbnail. It accepts either a
+// multipart "image" upload (JPEG, PNG or GIF) or a "timestamp" in seconds to
+// grab that exact frame, and stores the result as <stem>_poster.jpg. The poster
+// becomes the video's thumbnail; sync never regenerates a video that already
+// has one.
+func (s *server) handleSetPoster(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	posterPath := filepath.Join(
+		filepath.Dir(video.FilePath()),
+		strings.TrimSuffix(video.Filename, filepath.Ext(video.Filename))+"_poster.jpg",
+	)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPosterBytes)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxPosterBytes); err != nil {
+			http.Error(w, "cannot parse upload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if ts := r.FormValue("timestamp"); ts != "" {
+		secs, err := strconv.ParseFloat(ts, 64)
+		if err != nil || secs < 0 || (video.DurationS > 0 && secs > video.DurationS) {
+			http.Error(w, "invalid timestamp", http.StatusBadRequest)
+			return
+		}
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			http.Error(w, "ffmpeg is not installed — frame capture is unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if err := transcode.ExtractFrame(video.FilePath(), posterPath, secs); err != nil {
+			slog.Warn("extract poster frame failed", "path", video.FilePath(), "err", err)
+			http.Error(w, "failed to extract frame", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		f, _, err := r.FormFile("image")
+		if err != nil {
+			http.Error(w, "image upload or timestamp required", http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		img, err := decodePoster(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := writePoster(posterPath, img); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := s.store.UpdateVideoThumbnail(r.Context(), video.ID, posterPath); err != nil {
+		storeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// decodePoster validates and decodes an uploaded poster image. The header is
+// checked before decoding so oversized images are rejected cheaply.
+func decodePoster(f io.ReadSeeker) (image.Image, error) {
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("not a supported image (JPEG, PNG or GIF)")
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPosterPixels {
+		return nil, fmt.Errorf("image dimensions %dx%d are not allowed", cfg.Width, cfg.Height)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s image: %w", format, err)
+	}
+	return img, nil
+}
+
+// writePoster scales img down to posterWidth (never up) and writes it to dst
+// as a JPEG via a temp file, so a failed write leaves any old poster intact.
+func writePoster(dst string, img image.Image) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".poster-*.jpg")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if err := jpeg.Encode(tmp, scaleToWidth(img, posterWidth), &jpeg.Options{Quality: 90}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// scaleToWidth box-filters img down to width w, preserving aspect ratio.
+// Images already narrower than w are returned unchanged.
+func scaleToWidth(img image.Image, w int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= w {
+		return img
+	}
+	h := max(1, b.Dy()*w/b.Dx())
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			out.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return out
+}
+
 func (s *server) handleServeThumbnail(w http.ResponseWriter, r *http.Request) {
 	video, ok := s.videoOrError(w, r)
 	if !ok {
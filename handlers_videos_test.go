@@ -5,15 +5,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"testing/fstest"
 
+	"github.com/maxgarvey/video_manger/blob"
+	"github.com/maxgarvey/video_manger/internal/fixture"
 	"github.com/maxgarvey/video_manger/store"
 )
 
@@ -74,7 +84,8 @@ func TestHandlePlayer(t *testing.T) {
 func TestHandlePlayer_FileNotFound(t *testing.T) {
 	srv := newTestServer(t)
 	ctx := context.Background()
-	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	// The folder exists (so the directory is online) but the file does not.
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
 	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "missing.mp4")
 
 	rec := httptest.NewRecorder()
@@ -93,6 +104,49 @@ func TestHandlePlayer_FileNotFound(t *testing.T) {
 	}
 }
 
+func TestHandlePlayer_DirectoryOffline(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, filepath.Join(t.TempDir(), "unplugged"))
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/play/"+itoa(v.ID), nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "Drive offline") || strings.Contains(body, "Relocate to new path") {
+		t.Error("expected the drive-offline notice instead of the file-not-found options")
+	}
+	if got, _ := srv.store.GetDirectory(ctx, d.ID); !got.Offline {
+		t.Error("opening the player should record the directory as offline")
+	}
+
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/video/"+itoa(v.ID), nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for a file on an offline drive, got %d", rec.Code)
+	}
+}
+
+func TestHandlePlayer_ShowsDownloadSource(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "clip.mp4")
+	srv.store.SetVideoSource(ctx, v.ID, store.VideoSource{ //nolint:errcheck
+		Extractor: "vimeo", ID: "555", URL: "https://vimeo.com/555",
+		Uploader: "Studio Person", UploadDate: "2022-06-30",
+	})
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/play/"+itoa(v.ID), nil))
+	body := rec.Body.String()
+	for _, want := range []string{"https://vimeo.com/555", "Studio Person", "2022-06-30", "/videos/" + itoa(v.ID) + "/redownload"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("player should show %q", want)
+		}
+	}
+}
+
 func TestHandlePlayer_NotFound(t *testing.T) {
 	srv := newTestServer(t)
 	rec := httptest.NewRecorder()
@@ -152,6 +206,106 @@ func TestHandleVideoFile_RangeRequest(t *testing.T) {
 	}
 }
 
+// mapStorage is a blob.Storage held in memory, keyed by path without the
+// leading slash.
+type mapStorage struct{ fstest.MapFS }
+
+func (m mapStorage) Open(name string) (blob.File, error) {
+	f, err := m.MapFS.Open(strings.TrimPrefix(name, "/"))
+	if err != nil {
+		return nil, err
+	}
+	return f.(blob.File), nil
+}
+
+func (m mapStorage) Stat(name string) (fs.FileInfo, error) {
+	return m.MapFS.Stat(strings.TrimPrefix(name, "/"))
+}
+
+func (m mapStorage) Create(name string) (io.WriteCloser, error) {
+	return &mapFile{m: m, name: strings.TrimPrefix(name, "/")}, nil
+}
+
+// mapFile buffers a file being created in a mapStorage until it is closed.
+type mapFile struct {
+	bytes.Buffer
+	m    mapStorage
+	name string
+}
+
+func (f *mapFile) Close() error {
+	f.m.MapFS[f.name] = &fstest.MapFile{Data: f.Bytes()}
+	return nil
+}
+
+func (m mapStorage) Remove(name string) error {
+	delete(m.MapFS, strings.TrimPrefix(name, "/"))
+	return nil
+}
+
+func (m mapStorage) Rename(oldname, newname string) error {
+	oldname, newname = strings.TrimPrefix(oldname, "/"), strings.TrimPrefix(newname, "/")
+	f, ok := m.MapFS[oldname]
+	if !ok {
+		return fs.ErrNotExist
+	}
+	m.MapFS[newname] = f
+	delete(m.MapFS, oldname)
+	return nil
+}
+
+func TestVideoFiles_GoThroughStorage(t *testing.T) {
+	srv := newTestServer(t)
+	mem := mapStorage{fstest.MapFS{"remote/clip.mp4": {Data: []byte("0123456789")}}}
+	srv.blobs = mem
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/remote")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "clip.mp4")
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/video/"+itoa(v.ID), nil)
+	req.Header.Set("Range", "bytes=2-4")
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "234" {
+		t.Fatalf("expected bytes 2-4 from storage, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	form := url.Values{"name": {"renamed.mp4"}}
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/videos/"+itoa(v.ID)+"/rename", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.routes().ServeHTTP(rec, req)
+	if _, ok := mem.MapFS["remote/renamed.mp4"]; !ok || rec.Code != http.StatusOK {
+		t.Fatalf("expected the rename to go through storage, got %d: %v", rec.Code, mem.MapFS)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/videos/"+itoa(v.ID)+"/file", nil))
+	if len(mem.MapFS) != 0 {
+		t.Errorf("expected the delete to go through storage, left %v", mem.MapFS)
+	}
+}
+
+// crossDevice is a mapStorage whose renames fail, as they do between
+// file systems.
+type crossDevice struct{ mapStorage }
+
+func (crossDevice) Rename(oldname, newname string) error { return syscall.EXDEV }
+
+func TestMoveFile_CrossDeviceCopiesThroughStorage(t *testing.T) {
+	mem := mapStorage{fstest.MapFS{"a/clip.mp4": {Data: []byte("video")}}}
+	copied, err := moveFile(crossDevice{mem}, "/a/clip.mp4", "/b/clip.mp4")
+	if err != nil || !copied {
+		t.Fatalf("moveFile = %v, %v; want a copy", copied, err)
+	}
+	if f := mem.MapFS["b/clip.mp4"]; f == nil || string(f.Data) != "video" {
+		t.Errorf("expected the copy in storage, got %v", mem.MapFS)
+	}
+	if _, ok := mem.MapFS["a/clip.mp4"]; !ok {
+		t.Error("the source should stay until the caller removes it")
+	}
+}
+
 func TestHandleUpdateVideoName(t *testing.T) {
 	srv := newTestServer(t)
 	ctx := context.Background()
@@ -245,6 +399,100 @@ func TestHandleAddAndRemoveVideoTag(t *testing.T) {
 	}
 }
 
+func TestHandleVideoTags_OffersRecentTags(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	a, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+
+	form := url.Values{"tag": {"beach"}}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/videos/"+itoa(a.ID)+"/tags", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.routes().ServeHTTP(rec, req)
+	if strings.Contains(rec.Body.String(), "+ beach") {
+		t.Error("tag already on the video should not be offered again")
+	}
+
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/"+itoa(b.ID)+"/tags", nil))
+	if !strings.Contains(rec.Body.String(), "+ beach") {
+		t.Errorf("expected recent tag chip for beach, got %q", rec.Body.String())
+	}
+}
+
+func TestHandleBatchTags(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	a, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	old, _ := srv.store.UpsertTag(ctx, "vacations")
+	keep, _ := srv.store.UpsertTag(ctx, "keep")
+	srv.store.TagVideo(ctx, a.ID, old.ID)  //nolint:errcheck
+	srv.store.TagVideo(ctx, b.ID, old.ID)  //nolint:errcheck
+	srv.store.TagVideo(ctx, a.ID, keep.ID) //nolint:errcheck
+	ids := itoa(a.ID) + "," + itoa(b.ID)
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/batch-tags?ids="+ids, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("form: expected 200, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "vacations") || !strings.Contains(body, "keep") {
+		t.Errorf("matrix missing tag columns: %q", body)
+	}
+
+	form := url.Values{"ids": {ids}, "add": {"vacation, beach,"}, "remove": {itoa(old.ID)}}
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/videos/batch-tags", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("apply: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, v := range []store.Video{a, b} {
+		tags, _ := srv.store.ListTagsByVideo(ctx, v.ID)
+		var names []string
+		for _, tg := range tags {
+			names = append(names, tg.Name)
+		}
+		if !slices.Contains(names, "vacation") || !slices.Contains(names, "beach") || slices.Contains(names, "vacations") {
+			t.Errorf("%s tags = %v", v.Filename, names)
+		}
+	}
+	// The removed tag was orphaned and pruned.
+	if got, _ := srv.store.SuggestTags(ctx, "vacations", 5); len(got) != 0 {
+		t.Errorf("orphaned tag not pruned: %+v", got)
+	}
+}
+
+func TestHandleBatchTags_RejectsReservedAndBadIDs(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+
+	form := url.Values{"ids": {itoa(v.ID)}, "add": {"genre:Drama"}}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/videos/batch-tags", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.routes().ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "dedicated field") {
+		t.Errorf("expected reserved-prefix message, got %q", rec.Body.String())
+	}
+	if tags, _ := srv.store.ListTagsByVideo(ctx, v.ID); len(tags) != 0 {
+		t.Errorf("reserved tag should not be applied: %+v", tags)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/batch-tags?ids=1,x", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad ids, got %d", rec.Code)
+	}
+}
+
 func TestHandleSetRating(t *testing.T) {
 	srv := newTestServer(t)
 	ctx := context.Background()
@@ -289,6 +537,88 @@ func TestHandleSetRating(t *testing.T) {
 	}
 }
 
+func TestHandleSetStars(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "movie.mp4")
+
+	setStars := func(id int64, stars string) *httptest.ResponseRecorder {
+		form := url.Values{"stars": {stars}}
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/videos/"+itoa(id)+"/stars", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		srv.routes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := setStars(v.ID, "4")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("set 4 stars: expected 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "4 of 5 stars") {
+		t.Errorf("expected the stars rendered, got %s", rec.Body.String())
+	}
+	got, _ := srv.store.GetVideo(ctx, v.ID)
+	if got.Stars != 4 || got.Rating != 1 {
+		t.Errorf("expected 4 stars and liked, got stars %d rating %d", got.Stars, got.Rating)
+	}
+
+	for _, bad := range []string{"6", "-1", "x", ""} {
+		if code := setStars(v.ID, bad).Code; code != http.StatusBadRequest {
+			t.Errorf("stars %q: expected 400, got %d", bad, code)
+		}
+	}
+	if code := setStars(999, "3").Code; code != http.StatusNotFound {
+		t.Errorf("unknown video: expected 404, got %d", code)
+	}
+}
+
+func TestHandleSetFavorite(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	lib := fixture.Seed(t, srv.store)
+
+	rec := doAs(srv, nil, http.MethodPost, "/videos/"+itoa(lib.Episodes[0].ID)+"/favorite", url.Values{"favorite": {"1"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("favorite: expected 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "Again soon") {
+		t.Errorf("expected the marked button, got %s", rec.Body.String())
+	}
+	if got := rec.Header().Get("HX-Trigger"); got != "favoritesChanged" {
+		t.Errorf("HX-Trigger = %q, want favoritesChanged", got)
+	}
+	if got, _ := srv.store.GetVideo(ctx, lib.Episodes[0].ID); !got.Favorite || got.Rating != 0 {
+		t.Errorf("got favorite %v rating %d, want a favorite left unrated", got.Favorite, got.Rating)
+	}
+
+	// The row on the index and the library filter list it alone.
+	if body := doAs(srv, nil, http.MethodGet, "/videos/favorites", nil).Body.String(); !strings.Contains(body, "Watch again soon") ||
+		!strings.Contains(body, `data-id="`+itoa(lib.Episodes[0].ID)+`"`) || strings.Contains(body, `data-id="`+itoa(lib.Movie.ID)+`"`) {
+		t.Errorf("favorites row:\n%s", body)
+	}
+	var list []apiVideo
+	apiGet(t, srv, "/api/videos?favorite=1", &list)
+	if len(list) != 1 || list[0].ID != lib.Episodes[0].ID || !list[0].Favorite {
+		t.Errorf("favorite filter: got %+v, want only episode 1", list)
+	}
+
+	doAs(srv, nil, http.MethodPost, "/videos/"+itoa(lib.Episodes[0].ID)+"/favorite", url.Values{"favorite": {"0"}})
+	if body := doAs(srv, nil, http.MethodGet, "/videos/favorites", nil).Body.String(); strings.TrimSpace(body) != "" {
+		t.Errorf("favorites row after unmarking = %q, want empty", body)
+	}
+
+	for _, bad := range []string{"2", "yes", ""} {
+		if code := doAs(srv, nil, http.MethodPost, "/videos/"+itoa(lib.Movie.ID)+"/favorite", url.Values{"favorite": {bad}}).Code; code != http.StatusBadRequest {
+			t.Errorf("favorite %q: expected 400, got %d", bad, code)
+		}
+	}
+	if code := doAs(srv, nil, http.MethodPost, "/videos/999/favorite", url.Values{"favorite": {"1"}}).Code; code != http.StatusNotFound {
+		t.Errorf("unknown video: expected 404, got %d", code)
+	}
+}
+
 func TestHandleSetRating_BadVideo(t *testing.T) {
 	srv := newTestServer(t)
 	form := url.Values{"rating": {"1"}}
@@ -448,6 +778,66 @@ func TestHandleMoveVideo(t *testing.T) {
 	}
 }
 
+func TestHandleDeleteVideoAndFile_PrunesEmptyFolders(t *testing.T) {
+	for _, prune := range []bool{true, false} {
+		root := t.TempDir()
+		season := filepath.Join(root, "Show", "Season 2")
+		os.MkdirAll(season, 0755)                                                //nolint:errcheck
+		os.WriteFile(filepath.Join(season, "ep.mp4"), []byte("data"), 0644)      //nolint:errcheck
+		os.WriteFile(filepath.Join(season, "ep_thumb.jpg"), []byte("jpg"), 0644) //nolint:errcheck
+
+		srv := newTestServer(t)
+		ctx := context.Background()
+		d, _ := srv.store.AddDirectory(ctx, root)
+		srv.store.SetDirectoryPruneEmpty(ctx, d.ID, prune) //nolint:errcheck
+		v, _ := srv.store.UpsertVideo(ctx, d.ID, season, "ep.mp4")
+		srv.store.UpdateVideoThumbnail(ctx, v.ID, filepath.Join(season, "ep_thumb.jpg")) //nolint:errcheck
+
+		if rec := doAs(srv, nil, http.MethodDelete, "/videos/"+itoa(v.ID)+"/file", nil); rec.Code != http.StatusOK {
+			t.Fatalf("delete: got %d: %s", rec.Code, rec.Body.String())
+		}
+		_, err := os.Stat(filepath.Join(root, "Show"))
+		if prune && err == nil {
+			t.Error("emptied folders were kept")
+		}
+		if !prune && err != nil {
+			t.Error("folders removed without prune_empty")
+		}
+		if _, err := os.Stat(root); err != nil {
+			t.Error("the registered folder was removed")
+		}
+	}
+}
+
+func TestHandleMoveVideo_PrunesEmptyFolders(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	sub := filepath.Join(srcDir, "Season 1")
+	os.MkdirAll(sub, 0755)                                              //nolint:errcheck
+	os.WriteFile(filepath.Join(sub, "clip.mp4"), []byte("data"), 0644)  //nolint:errcheck
+	os.WriteFile(filepath.Join(sub, "other.mp4"), []byte("data"), 0644) //nolint:errcheck
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	src, _ := srv.store.AddDirectory(ctx, srcDir)
+	dst, _ := srv.store.AddDirectory(ctx, dstDir)
+	srv.store.SetDirectoryPruneEmpty(ctx, src.ID, true) //nolint:errcheck
+	a, _ := srv.store.UpsertVideo(ctx, src.ID, sub, "clip.mp4")
+	b, _ := srv.store.UpsertVideo(ctx, src.ID, sub, "other.mp4")
+
+	doAs(srv, nil, http.MethodPost, "/videos/"+itoa(a.ID)+"/move", url.Values{"dir_id": {itoa(dst.ID)}})
+	if _, err := os.Stat(sub); err != nil {
+		t.Fatal("a folder that still has a video was removed")
+	}
+	doAs(srv, nil, http.MethodPost, "/videos/"+itoa(b.ID)+"/move", url.Values{"dir_id": {itoa(dst.ID)}})
+	if _, err := os.Stat(sub); err == nil {
+		t.Error("emptied folder was kept")
+	}
+	if _, err := os.Stat(srcDir); err != nil {
+		t.Error("the registered folder was removed")
+	}
+}
+
 func TestHandleMoveVideo_WithSubdir(t *testing.T) {
 	srcDir := t.TempDir()
 	dstDir := t.TempDir()
@@ -719,6 +1109,27 @@ func TestHandleRenameVideo_RenamesFile(t *testing.T) {
 	}
 }
 
+func TestHandleRenameVideo_MakesNameSafe(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "original.mp4"), []byte("fake"), 0644) //nolint:errcheck
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, root)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, root, "original.mp4")
+
+	rec := doAs(srv, nil, http.MethodPost, "/videos/"+itoa(v.ID)+"/rename", url.Values{"name": {"Pilot: Part 1?.mp4"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got, _ := srv.store.GetVideo(ctx, v.ID); got.Filename != "Pilot- Part 1.mp4" {
+		t.Errorf("DB Filename = %q, want %q", got.Filename, "Pilot- Part 1.mp4")
+	}
+	if _, err := os.Stat(filepath.Join(root, "Pilot- Part 1.mp4")); err != nil {
+		t.Error("renamed file not found on disk")
+	}
+}
+
 func TestHandleRenameVideo_SameName(t *testing.T) {
 	root := t.TempDir()
 	os.WriteFile(filepath.Join(root, "clip.mp4"), []byte("fake"), 0644) //nolint:errcheck
@@ -907,6 +1318,40 @@ func TestHandleVideoSearch_Unicode(t *testing.T) {
 	}
 }
 
+func TestHandleContinueWatching(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+
+	get := func() string {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/continue", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		return rec.Body.String()
+	}
+	if body := get(); strings.Contains(body, "Continue watching") {
+		t.Error("expected no row before anything is watched")
+	}
+
+	part, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "part.mp4")
+	srv.store.UpdateVideoDuration(ctx, part.ID, 600) //nolint:errcheck
+	srv.store.RecordWatch(ctx, part.ID, 150)         //nolint:errcheck
+	done, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "done.mp4")
+	srv.store.UpdateVideoDuration(ctx, done.ID, 600) //nolint:errcheck
+	srv.store.RecordWatch(ctx, done.ID, 590)         //nolint:errcheck
+
+	body := get()
+	if !strings.Contains(body, `data-id="`+itoa(part.ID)+`"`) || !strings.Contains(body, "7:30") ||
+		!strings.Contains(body, "width:25%") {
+		t.Errorf("expected part.mp4 with 7:30 left at 25%%, got:\n%s", body)
+	}
+	if strings.Contains(body, `data-id="`+itoa(done.ID)+`"`) {
+		t.Error("expected the finished video to be left out")
+	}
+}
+
 func TestHandleNextUnwatched(t *testing.T) {
 	srv := newTestServer(t)
 	ctx := context.Background()
@@ -946,6 +1391,50 @@ func TestHandleNextUnwatched(t *testing.T) {
 	}
 }
 
+func TestHandleNextEpisode(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	d2, _ := srv.store.AddDirectory(ctx, "/more")
+	episode := func(dir store.Directory, name string, season, ep int) store.Video {
+		v, _ := srv.store.UpsertVideo(ctx, dir.ID, dir.Path, name)
+		srv.store.UpdateVideoShowName(ctx, v.ID, "Show")                                                   //nolint:errcheck
+		srv.store.UpdateVideoFields(ctx, v.ID, store.VideoFields{SeasonNumber: season, EpisodeNumber: ep}) //nolint:errcheck
+		return v
+	}
+	s2e1 := episode(d, "a.mp4", 2, 1)
+	s1e2 := episode(d2, "z.mp4", 1, 2)
+	s1e1 := episode(d, "m.mp4", 1, 1)
+	clip1, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "x-clip.mp4")
+	clip2, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "y-clip.mp4")
+
+	next := func(id int64) (int, int64) {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos/"+itoa(id)+"/next", nil))
+		var body struct{ ID int64 }
+		json.NewDecoder(rec.Body).Decode(&body) //nolint:errcheck
+		return rec.Code, body.ID
+	}
+	for _, c := range []struct {
+		name     string
+		from, to int64
+	}{
+		{"next episode in another folder", s1e1.ID, s1e2.ID},
+		{"first episode of the next season", s1e2.ID, s2e1.ID},
+		{"next file by name for a video outside a series", clip1.ID, clip2.ID},
+	} {
+		if code, id := next(c.from); code != http.StatusOK || id != c.to {
+			t.Errorf("%s: expected 200 and id %d, got %d and %d", c.name, c.to, code, id)
+		}
+	}
+	if code, _ := next(s2e1.ID); code != http.StatusNotFound {
+		t.Errorf("last episode: expected 404, got %d", code)
+	}
+	if code, _ := next(clip2.ID); code != http.StatusNotFound {
+		t.Errorf("last file in folder: expected 404, got %d", code)
+	}
+}
+
 func TestHandleListDuplicates(t *testing.T) {
 	srv := newTestServer(t)
 	ctx := context.Background()
@@ -1177,6 +1666,107 @@ func TestHandleGenerateThumbnail_WithPositionParam(t *testing.T) {
 	}
 }
 
+// withPoster is a doAs option replacing the body with body as a multipart
+// "image" upload, as sent to PUT /videos/{id}/thumbnail.
+func withPoster(body []byte) func(*http.Request) {
+	return func(r *http.Request) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		fw, _ := mw.CreateFormFile("image", "poster.png")
+		fw.Write(body) //nolint:errcheck
+		mw.Close()
+		r.Body, r.ContentLength = io.NopCloser(&buf), int64(buf.Len())
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+	}
+}
+
+func TestHandleSetPoster_UploadIsResized(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 1280, 720))); err != nil {
+		t.Fatal(err)
+	}
+	rec := doAs(srv, nil, http.MethodPut, "/videos/"+itoa(v.ID)+"/thumbnail", nil, withPoster(img.Bytes()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	got, _ := srv.store.GetVideo(ctx, v.ID)
+	if got.ThumbnailPath != filepath.Join(dir, "film_poster.jpg") {
+		t.Fatalf("ThumbnailPath = %q, want film_poster.jpg", got.ThumbnailPath)
+	}
+	f, err := os.Open(got.ThumbnailPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || cfg.Width != posterWidth || cfg.Height != 180 {
+		t.Errorf("poster is %s %dx%d, want jpeg %dx180", format, cfg.Width, cfg.Height, posterWidth)
+	}
+}
+
+func TestHandleSetPoster_RejectsNonImage(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+
+	if rec := doAs(srv, nil, http.MethodPut, "/videos/"+itoa(v.ID)+"/thumbnail", nil, withPoster([]byte("not an image"))); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	if got, _ := srv.store.GetVideo(ctx, v.ID); got.ThumbnailPath != "" {
+		t.Errorf("thumbnail should be unchanged, got %q", got.ThumbnailPath)
+	}
+}
+
+func TestHandleSetPoster_Timestamp(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("fake"), 0644) //nolint:errcheck
+	t.Setenv("PATH", makeFfmpegStub(t))
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+
+	for ts, want := range map[string]int{"12.5": http.StatusOK, "-1": http.StatusBadRequest, "abc": http.StatusBadRequest} {
+		form := url.Values{"timestamp": {ts}}
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/videos/"+itoa(v.ID)+"/thumbnail", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		srv.routes().ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("timestamp %q: expected %d, got %d", ts, want, rec.Code)
+		}
+	}
+	if got, _ := srv.store.GetVideo(ctx, v.ID); filepath.Base(got.ThumbnailPath) != "film_poster.jpg" {
+		t.Errorf("ThumbnailPath = %q, want film_poster.jpg", got.ThumbnailPath)
+	}
+}
+
+func TestHandleSetPoster_MissingInput(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/videos/"+itoa(v.ID)+"/thumbnail", nil)
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
 func TestHandleVideoTags(t *testing.T) {
 	srv := newTestServer(t)
 	ctx := context.Background()
@@ -1319,7 +1909,8 @@ func TestHandleServeSubtitles_ServesWebVTT(t *testing.T) {
 	os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("fake"), 0o644)
 	srtContent := "1\n00:00:01,000 --> 00:00:02,000\nHello!\n"
 	os.WriteFile(filepath.Join(dir, "film.srt"), []byte(srtContent), 0o644)
-	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	srv.syncDir(d)
+	v := onlyVideo(t, srv)
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/videos/%d/subtitles", v.ID), nil)
@@ -1372,8 +1963,50 @@ func TestHandleProgress(t *testing.T) {
 	rec = httptest.NewRecorder()
 	req = httptest.NewRequest(http.MethodGet, "/videos/"+itoa(v.ID)+"/progress", nil)
 	srv.routes().ServeHTTP(rec, req)
-	if !strings.Contains(rec.Body.String(), "42.5") {
-		t.Errorf("expected position 42.5, got %s", rec.Body.String())
+	if !strings.Contains(rec.Body.String(), `"position":42.5`) || !strings.Contains(rec.Body.String(), `"resume":42.5`) {
+		t.Errorf("expected position and resume 42.5, got %s", rec.Body.String())
+	}
+}
+
+func TestHandleProgress_WatchedThreshold(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+
+	post := func(form url.Values) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/videos/"+itoa(v.ID)+"/progress", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("POST progress: expected 204, got %d", rec.Code)
+		}
+	}
+	watched := func() bool {
+		got, _ := srv.store.GetVideo(ctx, v.ID)
+		return got.Watched
+	}
+
+	// The scan didn't read a duration, so the player's is stored.
+	post(url.Values{"position": {"300"}, "duration": {"1000"}})
+	if watched() {
+		t.Error("30% through: should not be watched")
+	}
+	if got, _ := srv.store.GetVideo(ctx, v.ID); got.DurationS != 1000 {
+		t.Errorf("duration = %v, want the player's 1000", got.DurationS)
+	}
+	post(url.Values{"position": {"900"}})
+	if !watched() {
+		t.Error("90% through: should be watched")
+	}
+
+	srv.store.ClearWatch(ctx, v.ID)                                         //nolint:errcheck
+	srv.store.SaveSettings(ctx, map[string]string{"watched_percent": "95"}) //nolint:errcheck
+	post(url.Values{"position": {"900"}})
+	if watched() {
+		t.Error("90% through with a 95% threshold: should not be watched")
 	}
 }
 
@@ -1541,6 +2174,35 @@ func TestHandleCopyToLibrary_OK(t *testing.T) {
 	}
 }
 
+func TestHandleCopyToLibrary_EscapesFileName(t *testing.T) {
+	srcDir := t.TempDir()
+	libDir := t.TempDir()
+	// Copies get names made safe by the naming package, which drops "<" and
+	// ">", so check the escaping with "&".
+	name := `Tom & Jerry.mp4`
+	if err := os.WriteFile(filepath.Join(srcDir, name), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	srv.store.SaveSettings(ctx, map[string]string{"library_path": libDir}) //nolint:errcheck
+	d, _ := srv.store.AddDirectory(ctx, srcDir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, name)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/videos/"+itoa(v.ID)+"/copy-to-library", nil)
+	srv.routes().ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || strings.Contains(body, "Tom & Jerry") || !strings.Contains(body, "Tom &amp; Jerry") {
+		t.Errorf("expected the file name escaped in the notice, got %d: %s", rec.Code, body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("expected an HTML fragment, got %q", ct)
+	}
+}
+
 func TestHandleCopyToLibrary_NoLibraryPath(t *testing.T) {
 	srv := newTestServer(t)
 	ctx := context.Background()
@@ -0,0 +1,265 @@
+// handlers_watch_orders.go – playlists generated from show metadata.
+//
+// GET    /api/shows/{show}/watch-order – the show's videos in viewing order
+// GET    /api/watch-orders             – uploaded crossover orders
+// GET    /api/watch-orders/{id}        – one crossover order's videos
+// GET    /watch-orders                 – the crossover orders panel (settings)
+// POST   /watch-orders                 – upload a crossover order as JSON
+// DELETE /watch-orders/{id}            – remove a crossover order
+//
+// A show plays in episode order (season, then episode) or, with
+// ?order=airdate, by air date, taken from the video or else from the
+// scraped episode list; ?season=N keeps one season. Crossover orders run
+// across shows and are uploaded as
+//
+//	{"name": "Crisis", "episodes": [{"show": "Arrow", "season": 8, "episode": 8}, …]}
+//
+// Every playlist carries "start", the index of its first unwatched video, so
+// the client can pick up where the viewer left off.
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+const (
+	maxWatchOrderBytes   = 1 << 20 // an uploaded order's JSON
+	maxWatchOrderEntries = 5000
+)
+
+// apiWatchOrder is a playlist in viewing order.
+type apiWatchOrder struct {
+	ID     int64      `json:"id,omitempty"` // crossover orders only
+	Name   string     `json:"name"`
+	Order  string     `json:"order,omitempty"` // "episode" or "airdate" for a show
+	Start  int        `json:"start"`           // index of the first unwatched video
+	Videos []apiVideo `json:"videos"`
+}
+
+// newAPIWatchOrder converts videos for the API and finds where to resume:
+// the first unwatched video, or the beginning when all have been watched.
+func newAPIWatchOrder(name string, videos []store.Video, sign func(string) string) apiWatchOrder {
+	out := apiWatchOrder{Name: name, Videos: make([]apiVideo, 0, len(videos))}
+	start := -1
+	for i, v := range videos {
+		out.Videos = append(out.Videos, videoToAPI(v, sign))
+		if start < 0 && !v.Watched {
+			start = i
+		}
+	}
+	out.Start = max(start, 0)
+	return out
+}
+
+// sortByAirDate orders videos by air date, falling back to the scraped
+// episode list for videos without one. Videos with no known date keep their
+// episode order after the dated ones.
+func sortByAirDate(videos []store.Video, scraped []store.ShowEpisode) {
+	aired := map[[2]int]string{}
+	for _, e := range scraped {
+		aired[[2]int{e.Season, e.Episode}] = e.AirDate
+	}
+	date := func(v store.Video) string {
+		if v.AirDate != "" {
+			return v.AirDate
+		}
+		return aired[[2]int{v.SeasonNumber, v.EpisodeNumber}]
+	}
+	sort.SliceStable(videos, func(i, j int) bool {
+		di, dj := date(videos[i]), date(videos[j])
+		if di == "" || dj == "" {
+			return di != "" && dj == ""
+		}
+		return di < dj
+	})
+}
+
+// GET /api/shows/{show}/watch-order?order=episode|airdate&season=N
+func (s *server) handleAPIShowWatchOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name, err := url.PathUnescape(chi.URLParam(r, "show"))
+	if err != nil || name == "" {
+		http.Error(w, "invalid show", http.StatusBadRequest)
+		return
+	}
+	order := r.URL.Query().Get("order")
+	switch order {
+	case "":
+		order = "episode"
+	case "episode", "airdate":
+	default:
+		http.Error(w, "order must be episode or airdate", http.StatusBadRequest)
+		return
+	}
+	season := -1
+	if sn := r.URL.Query().Get("season"); sn != "" {
+		if season, err = strconv.Atoi(sn); err != nil || season < 0 {
+			http.Error(w, "invalid season", http.StatusBadRequest)
+			return
+		}
+	}
+	all, err := s.store.ListVideosByShow(ctx, name)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	var videos []store.Video
+	for _, v := range all {
+		if season < 0 || v.SeasonNumber == season {
+			videos = append(videos, v)
+		}
+	}
+	if len(videos) == 0 {
+		http.Error(w, "no videos for this show", http.StatusNotFound)
+		return
+	}
+	if order == "airdate" {
+		var scraped []store.ShowEpisode
+		if show, err := s.store.GetShow(ctx, name); err == nil {
+			scraped, _ = s.store.ListShowEpisodes(ctx, show.ID)
+		}
+		sortByAirDate(videos, scraped)
+	}
+	out := newAPIWatchOrder(name, videos, s.streamSigner(ctx))
+	out.Order = order
+	writeJSON(w, out)
+}
+
+// GET /api/watch-orders
+func (s *server) handleAPIListWatchOrders(w http.ResponseWriter, r *http.Request) {
+	orders, err := s.store.ListWatchOrders(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	out := make([]apiWatchOrder, 0, len(orders))
+	for _, o := range orders {
+		out = append(out, apiWatchOrder{ID: o.ID, Name: o.Name, Videos: []apiVideo{}})
+	}
+	writeJSON(w, out)
+}
+
+// GET /api/watch-orders/{id} returns the order's episodes that are in the
+// library; the rest are skipped.
+func (s *server) handleAPIGetWatchOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	order, err := s.store.GetWatchOrder(ctx, id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	byShow := map[string]map[[2]int]store.Video{}
+	var videos []store.Video
+	for _, e := range order.Entries {
+		eps, ok := byShow[e.Show]
+		if !ok {
+			list, err := s.store.ListVideosByShow(ctx, e.Show)
+			if err != nil {
+				storeError(w, err)
+				return
+			}
+			eps = map[[2]int]store.Video{}
+			for _, v := range list {
+				key := [2]int{v.SeasonNumber, v.EpisodeNumber}
+				if _, dup := eps[key]; !dup {
+					eps[key] = v
+				}
+			}
+			byShow[e.Show] = eps
+		}
+		if v, ok := eps[[2]int{e.Season, e.Episode}]; ok {
+			videos = append(videos, v)
+		}
+	}
+	out := newAPIWatchOrder(order.Name, videos, s.streamSigner(ctx))
+	out.ID = order.ID
+	writeJSON(w, out)
+}
+
+// renderWatchOrders renders the crossover orders panel.
+func (s *server) renderWatchOrders(w http.ResponseWriter, r *http.Request) {
+	orders, err := s.store.ListWatchOrders(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "watch_orders.html", orders)
+}
+
+// GET /watch-orders
+func (s *server) handleListWatchOrders(w http.ResponseWriter, r *http.Request) {
+	s.renderWatchOrders(w, r)
+}
+
+// POST /watch-orders takes the order's JSON as the uploaded file "order".
+// An order with an existing name replaces it.
+func (s *server) handleUploadWatchOrder(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxWatchOrderBytes+4096)
+	f, _, err := r.FormFile("order")
+	if err != nil {
+		http.Error(w, "upload the order as a JSON file", http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+	var in struct {
+		Name     string `json:"name"`
+		Episodes []struct {
+			Show    string `json:"show"`
+			Season  int    `json:"season"`
+			Episode int    `json:"episode"`
+		} `json:"episodes"`
+	}
+	if err := json.NewDecoder(io.LimitReader(f, maxWatchOrderBytes)).Decode(&in); err != nil {
+		http.Error(w, "invalid order JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	order := store.WatchOrder{Name: strings.TrimSpace(in.Name)}
+	if order.Name == "" {
+		http.Error(w, "order needs a name", http.StatusBadRequest)
+		return
+	}
+	if len(in.Episodes) == 0 || len(in.Episodes) > maxWatchOrderEntries {
+		http.Error(w, "order needs 1 to "+strconv.Itoa(maxWatchOrderEntries)+" episodes", http.StatusBadRequest)
+		return
+	}
+	for i, e := range in.Episodes {
+		show := strings.TrimSpace(e.Show)
+		if show == "" || e.Season < 0 || e.Episode <= 0 {
+			http.Error(w, "episode "+strconv.Itoa(i+1)+" needs a show, season and episode number", http.StatusBadRequest)
+			return
+		}
+		order.Entries = append(order.Entries, store.WatchOrderEntry{Show: show, Season: e.Season, Episode: e.Episode})
+	}
+	if _, err := s.store.SaveWatchOrder(r.Context(), order); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderWatchOrders(w, r)
+}
+
+// DELETE /watch-orders/{id}
+func (s *server) handleDeleteWatchOrder(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteWatchOrder(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderWatchOrders(w, r)
+}
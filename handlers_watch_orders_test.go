@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestShowWatchOrder(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	show, _ := srv.store.SaveShow(ctx, store.Show{Name: "Firefly"})
+	// The episodes aired out of order; the scraped list dates the one
+	// without its own air date.
+	srv.store.SetShowEpisodes(ctx, show.ID, []store.ShowEpisode{{Season: 1, Episode: 2, AirDate: "2002-09-20"}}) //nolint:errcheck
+	ids := map[string]int64{}
+	for _, ep := range []struct {
+		name            string
+		season, episode int
+		airDate         string
+		watched         bool
+	}{
+		{"serenity", 1, 1, "2002-12-20", true},
+		{"train-job", 1, 2, "", false},
+		{"bushwhacked", 1, 3, "2002-09-27", false},
+		{"movie", 2, 1, "", false},
+	} {
+		v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, ep.name+".mp4")
+		srv.store.UpdateVideoShowName(ctx, v.ID, show.Name)       //nolint:errcheck
+		srv.store.UpdateVideoFields(ctx, v.ID, store.VideoFields{ //nolint:errcheck
+			SeasonNumber: ep.season, EpisodeNumber: ep.episode, AirDate: ep.airDate})
+		if ep.watched {
+			srv.store.RecordWatch(ctx, v.ID, 0) //nolint:errcheck
+		}
+		ids[ep.name] = v.ID
+	}
+	order := func(wo apiWatchOrder) []int64 {
+		var out []int64
+		for _, v := range wo.Videos {
+			out = append(out, v.ID)
+		}
+		return out
+	}
+
+	var wo apiWatchOrder
+	if code := apiGet(t, srv, "/api/shows/Firefly/watch-order", &wo); code != http.StatusOK {
+		t.Fatalf("episode order: expected 200, got %d", code)
+	}
+	want := []int64{ids["serenity"], ids["train-job"], ids["bushwhacked"], ids["movie"]}
+	if got := order(wo); !slices.Equal(got, want) || wo.Start != 1 || wo.Order != "episode" {
+		t.Errorf("episode order = %v start %d, want %v start 1", got, wo.Start, want)
+	}
+
+	apiGet(t, srv, "/api/shows/Firefly/watch-order?order=airdate", &wo)
+	want = []int64{ids["train-job"], ids["bushwhacked"], ids["serenity"], ids["movie"]}
+	if got := order(wo); !slices.Equal(got, want) || wo.Start != 0 {
+		t.Errorf("air-date order = %v start %d, want %v start 0", got, wo.Start, want)
+	}
+
+	apiGet(t, srv, "/api/shows/Firefly/watch-order?season=2", &wo)
+	if got := order(wo); len(got) != 1 || got[0] != ids["movie"] {
+		t.Errorf("season 2 = %v, want only the movie", got)
+	}
+	if code := apiGet(t, srv, "/api/shows/Firefly/watch-order?order=random", &wo); code != http.StatusBadRequest {
+		t.Errorf("unknown order: expected 400, got %d", code)
+	}
+	if code := apiGet(t, srv, "/api/shows/Unknown/watch-order", &wo); code != http.StatusNotFound {
+		t.Errorf("unknown show: expected 404, got %d", code)
+	}
+}
+
+func TestCrossoverWatchOrder(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	ids := map[string]int64{}
+	for _, name := range []string{"Arrow", "Flash"} {
+		v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, name+".mp4")
+		srv.store.UpdateVideoShowName(ctx, v.ID, name)                                               //nolint:errcheck
+		srv.store.UpdateVideoFields(ctx, v.ID, store.VideoFields{SeasonNumber: 8, EpisodeNumber: 9}) //nolint:errcheck
+		ids[name] = v.ID
+	}
+
+	upload := func(body string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		fw, _ := mw.CreateFormFile("order", "order.json")
+		fw.Write([]byte(body)) //nolint:errcheck
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/watch-orders", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := upload(`{"name":"Crisis","episodes":[{"show":"Flash","season":8,"episode":9},` +
+		`{"show":"Legends","season":5,"episode":1},{"show":"Arrow","season":8,"episode":9}]}`); rec.Code != http.StatusOK ||
+		!strings.Contains(rec.Body.String(), "Crisis") {
+		t.Fatalf("upload: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := upload(`{"name":"","episodes":[]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty order: expected 400, got %d", rec.Code)
+	}
+
+	var list []apiWatchOrder
+	apiGet(t, srv, "/api/watch-orders", &list)
+	if len(list) != 1 {
+		t.Fatalf("expected 1 order, got %+v", list)
+	}
+	var wo apiWatchOrder
+	if code := apiGet(t, srv, "/api/watch-orders/"+itoa(list[0].ID), &wo); code != http.StatusOK {
+		t.Fatalf("get order: expected 200, got %d", code)
+	}
+	// The episode of Legends isn't in the library and is skipped.
+	if len(wo.Videos) != 2 || wo.Videos[0].ID != ids["Flash"] || wo.Videos[1].ID != ids["Arrow"] {
+		t.Errorf("unexpected order: %+v", wo)
+	}
+}
@@ -0,0 +1,163 @@
+// Package fixture builds test data in a store: AddVideo makes one video as
+// described, and Seed a small, fixed library for tests that only need
+// something on screen. Every call fails the test on a store error, so tests
+// need no error checks of their own for their setup.
+package fixture
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// NewStore opens an empty in-memory store, closed when the test ends.
+func NewStore(t testing.TB) *store.SQLiteStore {
+	t.Helper()
+	s, err := store.NewSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// Video describes a video for AddVideo. Only Filename is required; the
+// zero value of every other field leaves that detail unset.
+type Video struct {
+	Filename     string
+	Type         string // a store.VideoTypes key
+	Show         string
+	Season       int
+	Episode      int
+	EpisodeTitle string
+	Duration     float64 // seconds
+	Rating       int     // thumbs, 0 to 2; the matching stars come with it
+	Color        string  // a store.VideoLabelColors key
+	Tags         []string
+	Position     float64 // when set, a watch stopped this many seconds in
+}
+
+// AddVideo adds v to directory dir and returns it as the store reads it
+// back.
+func AddVideo(t testing.TB, s store.Store, dir store.Directory, v Video) store.Video {
+	t.Helper()
+	ctx := context.Background()
+	got, err := s.UpsertVideo(ctx, dir.ID, dir.Path, v.Filename)
+	if err != nil {
+		t.Fatalf("UpsertVideo %s: %v", v.Filename, err)
+	}
+	id := got.ID
+	must := func(what string, err error) {
+		if err != nil {
+			t.Fatalf("%s %s: %v", what, v.Filename, err)
+		}
+	}
+	for _, set := range [][2]string{{"type", v.Type}, {"show", v.Show}, {"color", v.Color}} {
+		if set[1] != "" {
+			must("set "+set[0], s.SetExclusiveSystemTag(ctx, id, set[0], set[1]))
+		}
+	}
+	if v.Season != 0 || v.Episode != 0 || v.EpisodeTitle != "" {
+		must("UpdateVideoFields", s.UpdateVideoFields(ctx, id, store.VideoFields{
+			SeasonNumber:  v.Season,
+			EpisodeNumber: v.Episode,
+			EpisodeTitle:  v.EpisodeTitle,
+		}))
+	}
+	if v.Duration != 0 {
+		must("UpdateVideoDuration", s.UpdateVideoDuration(ctx, id, v.Duration))
+	}
+	if v.Rating != 0 {
+		must("SetVideoRating", s.SetVideoRating(ctx, id, v.Rating))
+	}
+	for _, name := range v.Tags {
+		tag, err := s.UpsertTag(ctx, name)
+		must("UpsertTag", err)
+		must("TagVideo", s.TagVideo(ctx, id, tag.ID))
+	}
+	if v.Position != 0 {
+		must("RecordWatch", s.RecordWatch(ctx, id, v.Position))
+	}
+	got, err = s.GetVideo(ctx, id)
+	must("GetVideo", err)
+	return got
+}
+
+// Tag returns the tag name, created if missing, with the given color and
+// sort order.
+func Tag(t testing.TB, s store.Store, name, color string, sortOrder int) store.Tag {
+	t.Helper()
+	ctx := context.Background()
+	tag, err := s.UpsertTag(ctx, name)
+	if err != nil {
+		t.Fatalf("UpsertTag %s: %v", name, err)
+	}
+	if err := s.SetTagStyle(ctx, tag.ID, color, sortOrder); err != nil {
+		t.Fatalf("SetTagStyle %s: %v", name, err)
+	}
+	tag.Color, tag.SortOrder = color, sortOrder
+	return tag
+}
+
+// Library is what Seed put in the store.
+type Library struct {
+	Dir      store.Directory
+	Movie    store.Video   // a watched, favourite movie tagged comedy
+	Episodes []store.Video // Alpha S01E01, half watched, and S01E02
+	Comedy   store.Tag     // red, listed first
+	Drama    store.Tag
+	Show     store.Show // Alpha, with S01E03 aired but not on disk and S01E04 to come
+}
+
+// Seed fills s with a directory "/library" holding a movie and two episodes
+// of the show "Alpha", tagged comedy and drama, and Alpha's episode guide.
+// The tags are given distinct sort orders so every list of them comes out in
+// the same order.
+func Seed(t testing.TB, s store.Store) Library {
+	t.Helper()
+	ctx := context.Background()
+	dir, err := s.AddDirectory(ctx, "/library")
+	if err != nil {
+		t.Fatalf("AddDirectory: %v", err)
+	}
+	lib := Library{Dir: dir}
+	lib.Movie = AddVideo(t, s, dir, Video{
+		Filename: "Big Movie (2019).mp4", Type: "Movie", Duration: 5400,
+		Rating: 2, Color: "green", Tags: []string{"comedy"}, Position: 5400,
+	})
+	for ep, title := range []string{"Pilot", "The Return"} {
+		lib.Episodes = append(lib.Episodes, AddVideo(t, s, dir, Video{
+			Filename: fmt.Sprintf("Alpha S01E%02d.mkv", ep+1), Type: "TV",
+			Show: "Alpha", Season: 1, Episode: ep + 1, EpisodeTitle: title,
+			Duration: 1500, Tags: []string{"drama"},
+		}))
+	}
+	// Half way through the pilot, so there is something to continue.
+	if err := s.RecordWatch(ctx, lib.Episodes[0].ID, 750); err != nil {
+		t.Fatalf("RecordWatch: %v", err)
+	}
+	lib.Comedy = Tag(t, s, "comedy", "red", 1)
+	lib.Drama = Tag(t, s, "drama", "", 2)
+	if lib.Show, err = s.SaveShow(ctx, store.Show{Name: "Alpha", Overview: "Two friends and a map."}); err != nil {
+		t.Fatalf("SaveShow: %v", err)
+	}
+	if err := s.SetShowEpisodes(ctx, lib.Show.ID, []store.ShowEpisode{
+		{Season: 1, Episode: 1, Title: "Pilot", AirDate: "2020-01-06"},
+		{Season: 1, Episode: 2, Title: "The Return", AirDate: "2020-01-13"},
+		{Season: 1, Episode: 3, Title: "Lost at Sea", AirDate: "2020-01-20"},
+	}); err != nil {
+		t.Fatalf("SetShowEpisodes: %v", err)
+	}
+	lib.Show.Airing = store.ShowAiring{
+		Status:   "Running",
+		Next:     store.ShowEpisode{Season: 1, Episode: 4, Title: "Home"},
+		NextAirs: time.Date(2099, 1, 5, 12, 0, 0, 0, time.UTC),
+	}
+	if err := s.SetShowAiring(ctx, lib.Show.ID, lib.Show.Airing); err != nil {
+		t.Fatalf("SetShowAiring: %v", err)
+	}
+	return lib
+}
@@ -0,0 +1,195 @@
+// language_prefs.go – preferred audio and subtitle languages per account.
+//
+// Each account (or the shared viewer, without sign-in) lists the languages
+// it wants to hear and read, in order, e.g. audio "ja,en" and subtitles
+// "en". The languages of a file's tracks are cached with its codecs at sync
+// time, so the player and POST /playback/decide pick the first track that
+// matches without probing: a preferred audio track other than the file's
+// default plays through a remux, and a preferred subtitle is switched on.
+//
+// GET /language-prefs – the preferences form (settings panel)
+// PUT /language-prefs – save them (form values audio, subtitles)
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// languageCodes maps ISO 639-1 codes and the ISO 639-2/B spellings some
+// files are tagged with onto the ISO 639-2/T codes ffprobe usually reports,
+// so "en", "eng", "de", "ger" and "deu" all compare as expected.
+var languageCodes = map[string]string{
+	"ar": "ara", "bg": "bul", "bn": "ben", "ca": "cat", "cs": "ces", "cy": "cym",
+	"da": "dan", "de": "deu", "el": "ell", "en": "eng", "es": "spa", "et": "est",
+	"eu": "eus", "fa": "fas", "fi": "fin", "fr": "fra", "ga": "gle", "gl": "glg",
+	"he": "heb", "hi": "hin", "hr": "hrv", "hu": "hun", "hy": "hye", "id": "ind",
+	"is": "isl", "it": "ita", "ja": "jpn", "ka": "kat", "ko": "kor", "lt": "lit",
+	"lv": "lav", "mk": "mkd", "ms": "msa", "nb": "nob", "nl": "nld", "nn": "nno",
+	"no": "nor", "pl": "pol", "pt": "por", "ro": "ron", "ru": "rus", "sk": "slk",
+	"sl": "slv", "sq": "sqi", "sr": "srp", "sv": "swe", "ta": "tam", "te": "tel",
+	"th": "tha", "tl": "tgl", "tr": "tur", "uk": "ukr", "ur": "urd", "vi": "vie",
+	"zh": "zho", "alb": "sqi", "arm": "hye", "baq": "eus", "chi": "zho", "cze": "ces",
+	"dut": "nld", "fre": "fra", "geo": "kat", "ger": "deu", "gre": "ell", "ice": "isl",
+	"mac": "mkd", "may": "msa", "per": "fas", "rum": "ron", "slo": "slk", "wel": "cym",
+}
+
+// normLanguage folds a language tag such as "en", "pt-BR" or "ger" onto its
+// ISO 639-2/T code; "" for untagged and "und".
+func normLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if code, ok := languageCodes[tag]; ok {
+		return code
+	}
+	if tag == "und" {
+		return ""
+	}
+	return tag
+}
+
+// parseLanguages reads a list of language tags separated by commas or
+// spaces, normalized and without repeats.
+func parseLanguages(s string) ([]string, error) {
+	var out []string
+	for _, tag := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		lang := normLanguage(tag)
+		if len(lang) < 2 || len(lang) > 3 || strings.Trim(lang, "abcdefghijklmnopqrstuvwxyz") != "" {
+			return nil, fmt.Errorf("%q is not a language code such as en or eng", tag)
+		}
+		if !containsFold(out, lang) {
+			out = append(out, lang)
+		}
+	}
+	return out, nil
+}
+
+// preferredTrack returns the first track among the comma-separated
+// languages that matches prefs, trying prefs in order; -1 when none does.
+func preferredTrack(languages string, prefs []string) int {
+	if languages == "" {
+		return -1
+	}
+	langs := strings.Split(languages, ",")
+	for _, want := range prefs {
+		for i, lang := range langs {
+			if lang != "" && normLanguage(lang) == want {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// subtitlePick is a preferred subtitle: a file beside the video when File
+// is set, otherwise the embedded stream Track.
+type subtitlePick struct {
+	File     string
+	Track    int
+	Language string
+}
+
+// URL is where the player loads the subtitle as WebVTT.
+func (p subtitlePick) URL(videoID int64) string {
+	id := strconv.FormatInt(videoID, 10)
+	if p.File != "" {
+		return "/videos/" + id + "/subtitles?file=" + url.QueryEscape(p.File)
+	}
+	return "/videos/" + id + "/subtitles/" + strconv.Itoa(p.Track)
+}
+
+// preferredTracks picks the audio track (-1 to keep the default) and the
+// subtitle that best match prefs. A subtitle file beside the video beats an
+// embedded stream in the same language.
+func preferredTracks(c store.VideoCodecs, sidecars []sidecarSubtitle, prefs store.LanguagePrefs) (audio int, sub subtitlePick, ok bool) {
+	audio = -1
+	if langs, _ := parseLanguages(prefs.Audio); len(strings.Split(c.AudioLanguages, ",")) > 1 {
+		if t := preferredTrack(c.AudioLanguages, langs); t >= 0 && t != c.DefaultAudio {
+			audio = t
+		}
+	}
+	langs, _ := parseLanguages(prefs.Subtitles)
+	for _, want := range langs {
+		for _, sc := range sidecars {
+			if sc.Language != "" && normLanguage(sc.Language) == want {
+				return audio, subtitlePick{File: sc.File, Language: want}, true
+			}
+		}
+		if t := preferredTrack(c.SubtitleLanguages, []string{want}); t >= 0 {
+			return audio, subtitlePick{Track: t, Language: want}, true
+		}
+	}
+	return audio, subtitlePick{}, false
+}
+
+// languagePrefs returns the requesting account's preferences; zero when it
+// has none or they cannot be read.
+func (s *server) languagePrefs(r *http.Request) store.LanguagePrefs {
+	p, err := s.store.GetLanguagePrefs(r.Context(), s.requestUser(r).ID)
+	if err != nil {
+		slog.Warn("load language preferences failed", "err", err)
+	}
+	return p
+}
+
+// applyLanguagePrefs switches dec to the requesting account's preferred
+// audio track and adds its preferred subtitle. Picking a track needs ffmpeg,
+// so without it the audio is left alone.
+func (s *server) applyLanguagePrefs(r *http.Request, video store.Video, dec playbackDecision) playbackDecision {
+	prefs := s.languagePrefs(r)
+	if prefs == (store.LanguagePrefs{}) {
+		return dec
+	}
+	c := s.cachedCodecs(r.Context(), video)
+	audio, sub, ok := preferredTracks(c, s.videoSubtitles(r.Context(), video), prefs)
+	if _, err := exec.LookPath("ffmpeg"); audio >= 0 && err == nil {
+		dec = withAudioTrack(dec, video.ID, audio)
+	}
+	if ok {
+		dec.SubtitleURL, dec.SubtitleLanguage = sub.URL(video.ID), sub.Language
+	}
+	return dec
+}
+
+func (s *server) renderLanguagePrefs(w http.ResponseWriter, p store.LanguagePrefs, errMsg string) {
+	render(w, "language_prefs.html", struct {
+		store.LanguagePrefs
+		Error string
+	}{p, errMsg})
+}
+
+// GET /language-prefs
+func (s *server) handleLanguagePrefs(w http.ResponseWriter, r *http.Request) {
+	s.renderLanguagePrefs(w, s.languagePrefs(r), "")
+}
+
+// PUT /language-prefs saves the lists normalized, e.g. "en, ger" as
+// "eng,deu". Unknown codes are reported in the panel and not saved.
+func (s *server) handleSetLanguagePrefs(w http.ResponseWriter, r *http.Request) {
+	in := store.LanguagePrefs{Audio: r.FormValue("audio"), Subtitles: r.FormValue("subtitles")}
+	audio, err := parseLanguages(in.Audio)
+	if err == nil {
+		var subs []string
+		if subs, err = parseLanguages(in.Subtitles); err == nil {
+			in = store.LanguagePrefs{Audio: strings.Join(audio, ","), Subtitles: strings.Join(subs, ",")}
+		}
+	}
+	if err != nil {
+		s.renderLanguagePrefs(w, in, err.Error())
+		return
+	}
+	if err := s.store.SetLanguagePrefs(r.Context(), s.requestUser(r).ID, in); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderLanguagePrefs(w, in, "")
+}
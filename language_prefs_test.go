@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/metadata"
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestParseLanguages(t *testing.T) {
+	got, err := parseLanguages("en, pt-BR ger,eng")
+	if err != nil || strings.Join(got, ",") != "eng,por,deu" {
+		t.Errorf("got %v, %v; want eng,por,deu", got, err)
+	}
+	for _, bad := range []string{"english", "e", "e1"} {
+		if _, err := parseLanguages(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestPreferredTracks(t *testing.T) {
+	c := codecsFromStreams([]metadata.Stream{
+		{CodecType: "video", CodecName: "h264"},
+		{CodecType: "audio", CodecName: "aac", Language: "eng", Default: true},
+		{CodecType: "audio", CodecName: "aac", Language: "jpn"},
+		{CodecType: "subtitle", CodecName: "hdmv_pgs_subtitle", Language: "eng"},
+		{CodecType: "subtitle", CodecName: "subrip", Language: "eng"},
+	})
+	if c.AudioLanguages != "eng,jpn" || c.SubtitleLanguages != ",eng" || c.DefaultAudio != 0 {
+		t.Fatalf("unexpected track languages %+v", c)
+	}
+	sidecars := []sidecarSubtitle{{File: "film.fr.srt", Language: "fr"}}
+
+	cases := []struct {
+		name      string
+		prefs     store.LanguagePrefs
+		wantAudio int
+		wantSub   string // subtitlePick URL; "" for none
+	}{
+		{"none", store.LanguagePrefs{}, -1, ""},
+		{"default track already plays", store.LanguagePrefs{Audio: "en"}, -1, ""},
+		{"second track", store.LanguagePrefs{Audio: "ja,en"}, 1, ""},
+		{"first preference missing", store.LanguagePrefs{Audio: "kor,jpn"}, 1, ""},
+		{"text subtitle, not the image one", store.LanguagePrefs{Subtitles: "eng"}, -1, "/videos/5/subtitles/1"},
+		{"sidecar in the first language", store.LanguagePrefs{Subtitles: "fre,en"}, -1, "/videos/5/subtitles?file=film.fr.srt"},
+		{"no match", store.LanguagePrefs{Audio: "deu", Subtitles: "deu"}, -1, ""},
+	}
+	for _, tc := range cases {
+		audio, sub, ok := preferredTracks(c, sidecars, tc.prefs)
+		got := ""
+		if ok {
+			got = sub.URL(5)
+		}
+		if audio != tc.wantAudio || got != tc.wantSub {
+			t.Errorf("%s: got audio %d, subtitle %q; want %d, %q", tc.name, audio, got, tc.wantAudio, tc.wantSub)
+		}
+	}
+}
+
+func TestHandlePlaybackDecide_PreferredLanguages(t *testing.T) {
+	// A stub ffmpeg and no ffprobe: only the cached track languages are known.
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte("#!/bin/sh\n"), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin)
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "anime.mp4")
+	srv.store.SetVideoCodecs(ctx, v.ID, store.VideoCodecs{ //nolint:errcheck
+		Video: "h264", Audio: "aac", AudioLanguages: "eng,jpn", SubtitleLanguages: "eng",
+	})
+
+	decide := func() playbackDecision {
+		t.Helper()
+		body := `{"video_id":` + itoa(v.ID) + `,"codecs":["h264","aac"],"containers":["mp4"]}`
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/playback/decide", strings.NewReader(body)))
+		var dec playbackDecision
+		if err := json.NewDecoder(rec.Body).Decode(&dec); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body.String(), err)
+		}
+		return dec
+	}
+	if dec := decide(); dec.Method != playDirect || dec.AudioTrack != nil || dec.SubtitleURL != "" {
+		t.Errorf("without preferences: got %+v", dec)
+	}
+
+	rec := doAs(srv, nil, http.MethodPut, "/language-prefs", url.Values{"audio": {"ja"}, "subtitles": {"en"}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="jpn"`) {
+		t.Fatalf("save preferences: got %d: %s", rec.Code, rec.Body.String())
+	}
+	dec := decide()
+	if dec.Method != playRemux || !strings.Contains(dec.URL, "audio=1") || dec.AudioTrack == nil || *dec.AudioTrack != 1 {
+		t.Errorf("preferred audio: got %+v", dec)
+	}
+	if dec.SubtitleURL != "/videos/"+itoa(v.ID)+"/subtitles/0" || dec.SubtitleLanguage != "eng" {
+		t.Errorf("preferred subtitle: got %+v", dec)
+	}
+
+	rec = doAs(srv, nil, http.MethodPut, "/language-prefs", url.Values{"audio": {"japanese"}})
+	if !strings.Contains(rec.Body.String(), "not a language code") {
+		t.Errorf("invalid code: want the error in the panel, got: %s", rec.Body.String())
+	}
+	if p, _ := srv.store.GetLanguagePrefs(ctx, 0); p.Audio != "jpn" {
+		t.Errorf("invalid code should not be saved, got %+v", p)
+	}
+}
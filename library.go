@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
@@ -11,6 +12,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 	"unicode"
@@ -119,13 +121,29 @@ func inferVideoType(filename string, seasonNum, _ int, tags []string) string {
 	return "Movie"
 }
 
+// syncBatchSize is how many files a library scan upserts and saves per
+// transaction. BenchmarkSyncDir sets it to 1 to measure per-file commits.
+var syncBatchSize = 500
+
 // syncDir walks a directory tree recursively and upserts all video files into
 // the store. Subdirectories are not registered as separate directory entries;
 // all videos under the tree share the same directory_id but store their actual
 // containing subdirectory path so FilePath() resolves correctly.
 // If ffprobe is available, native title is read and used to pre-populate
-// display_name for videos that don't yet have one set.
-func (s *server) syncDir(d store.Directory) {
+// display_name for videos that don't yet have one set. It returns the
+// videos the scan added to the library.
+func (s *server) syncDir(d store.Directory) []store.Video {
+	// An unplugged drive looks as if every file was deleted; skip the scan,
+	// and with it the pruning, until the folder is reachable again.
+	if !s.checkDirectoryOnline(context.Background(), d) {
+		slog.Warn("syncDir: directory offline, skipping", "path", d.Path)
+		return nil
+	}
+	// The poller's schedule counts from here, so a rescan by hand also
+	// puts off the next scheduled one.
+	if err := s.store.SetDirectorySynced(context.Background(), d.ID, time.Now()); err != nil {
+		slog.Warn("syncDir: record sync time failed", "path", d.Path, "err", err)
+	}
 	// Build a set of other registered directory paths so we don't walk into
 	// them when d is a parent directory. That would incorrectly reassign
 	// directory_id for videos that belong to a registered child directory.
@@ -138,141 +156,431 @@ func (s *server) syncDir(d store.Directory) {
 		}
 	}
 
-	if err := filepath.WalkDir(d.Path, func(path string, de fs.DirEntry, err error) error {
-		if err != nil {
-			slog.Warn("sync walk error", "path", path, "err", err)
-			return nil // keep walking
-		}
-		if de.IsDir() {
-			// Skip subdirectories that are themselves registered directories.
-			if path != d.Path && otherDirs[filepath.Clean(path)] {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		if !isVideoFile(de.Name()) {
-			return nil
-		}
-		dir := filepath.Dir(path)
-		var v store.Video
+	// When enabled, the files' embedded genre and show become tags.
+	tagFromMeta := false
+	if v, err := s.store.GetSetting(context.Background(), "tag_from_metadata"); err == nil {
+		tagFromMeta = v == "true"
+	}
+	skipJunk := s.skipJunkFiles(context.Background())
+
+	// File names per folder, read once so sidecar lookup does not re-list
+	// the folder for every video in it.
+	listings := make(map[string][]string)
+
+	// Collect the files first and upsert them in batches: one transaction
+	// per batch is much faster than one per file on a large first import.
+	var found []store.VideoInput
+	scanned := make(map[int64]bool) // videos the walk just found
+	var added []store.Video
+	if err := walkVideoFiles(d, otherDirs, skipJunk, func(path string, de fs.DirEntry) error {
+		found = append(found, store.VideoInput{DirectoryID: d.ID, DirectoryPath: filepath.Dir(path), Filename: de.Name()})
+		return nil
+	}); err != nil {
+		slog.Error("syncDir walk failed", "path", d.Path, "err", err)
+	}
+	for batch := range slices.Chunk(found, syncBatchSize) {
+		var videos []store.Video
 		if err := retryBusy(func() error {
 			var e error
-			v, e = s.store.UpsertVideo(context.Background(), d.ID, dir, de.Name())
+			videos, e = s.store.UpsertVideos(context.Background(), batch)
 			return e
 		}); err != nil {
-			slog.Warn("upsert video failed", "path", path, "err", err)
-			return nil
-		}
-		// infer show name if not already set
-		if v.ShowName == "" {
-			show := inferShow(d.Path, dir, de.Name())
-			if show != "" {
+			// Retry one file at a time so a bad file only loses itself.
+			slog.Warn("batch upsert failed, retrying per file", "dir", d.Path, "count", len(batch), "err", err)
+			videos = nil
+			var inputs []store.VideoInput
+			for _, in := range batch {
+				var v store.Video
 				if err := retryBusy(func() error {
-					return s.store.UpdateVideoShowName(context.Background(), v.ID, show)
+					var e error
+					v, e = s.store.UpsertVideo(context.Background(), in.DirectoryID, in.DirectoryPath, in.Filename)
+					return e
 				}); err != nil {
-					slog.Warn("set show name failed", "path", path, "err", err)
+					slog.Warn("upsert video failed", "path", filepath.Join(in.DirectoryPath, in.Filename), "err", err)
+					continue
 				}
-				// update our local copy for later checks (e.g. thumbnail)
-				v.ShowName = show
+				videos = append(videos, v)
+				inputs = append(inputs, in)
 			}
+			batch = inputs
 		}
-		if v.DisplayName == "" {
-			if meta, err := metadata.Read(path); err == nil && meta.Title != "" {
-				if err := retryBusy(func() error {
-					return s.store.UpdateVideoName(context.Background(), v.ID, meta.Title)
-				}); err != nil {
-					slog.Warn("set native title failed", "path", path, "err", err)
-				}
+		// The follow-up writes for the whole batch share one transaction
+		// too; probing the files happens before it opens.
+		scans := make([]store.VideoScan, len(videos))
+		for i, v := range videos {
+			scanned[v.ID] = true
+			scans[i] = s.scanVideo(d, v, batch[i], tagFromMeta, listings)
+			// A file is stat'ed on its first scan; a record without a
+			// modification time is new.
+			if v.FileModTime.IsZero() && !scans[i].FileModTime.IsZero() {
+				added = append(added, v)
 			}
 		}
-		if v.DurationS == 0 {
-			if d := metadata.ReadDuration(path); d > 0 {
-				if err := retryBusy(func() error {
-					return s.store.UpdateVideoDuration(context.Background(), v.ID, d)
-				}); err != nil {
-					slog.Warn("set duration failed", "path", path, "err", err)
-				}
+		s.saveScans(d, videos, scans)
+	}
+
+	// Prune DB records for files that no longer exist on disk or that now
+	// fall outside the directory's exclude patterns, max depth, the junk
+	// filter, or (when symlinks are not followed) sit in a symlinked folder.
+	// Videos the walk just found are kept: it has already filtered them by
+	// the path it followed, whereas the store records a folder reached via
+	// a symlink within the root under its resolved path, which the patterns
+	// and depth limit may judge differently. underSymlink therefore only
+	// catches links leading out of the root, whose videos keep the path
+	// they were found by.
+	existing, err := s.store.ListVideosByDirectory(context.Background(), d.ID)
+	if err != nil {
+		slog.Error("syncDir list videos failed", "path", d.Path, "err", err)
+		return added
+	}
+	for _, v := range existing {
+		if scanned[v.ID] {
+			continue
+		}
+		_, statErr := s.blobs.Stat(v.FilePath())
+		if errors.Is(statErr, fs.ErrNotExist) || isExcluded(d.Excludes, d.Path, v.FilePath()) ||
+			exceedsDepth(d.MaxDepth, d.Path, v.DirectoryPath) ||
+			(skipJunk && underJunk(d.Path, v.FilePath())) ||
+			underStaging(d.Path, v.FilePath()) ||
+			(!d.FollowSymlinks && underSymlink(d.Path, v.DirectoryPath)) {
+			slog.Info("syncDir: removing stale entry", "path", v.FilePath())
+			if err := retryBusy(func() error {
+				return s.store.DeleteVideo(context.Background(), v.ID)
+			}); err != nil {
+				slog.Error("syncDir: delete stale video failed", "videoID", v.ID, "err", err)
 			}
 		}
-		// Infer video type if not already set
-		if v.VideoType == "" {
-			tags, err := s.store.ListTagsByVideo(context.Background(), v.ID)
-			if err != nil {
-				slog.Warn("list tags for inference failed", "videoID", v.ID, "err", err)
+	}
+	s.linkExtras(context.Background(), d.ID)
+	s.linkCompanions(context.Background(), d.ID)
+	s.checkBudgets(context.Background())
+	return added
+}
+
+// scanVideo works out what one scanned file adds to or changes in its
+// record: file stat, show, title, duration and chapters, resolution and
+// codecs, type, folder tag, sidecars and thumbnail. It only reads from the
+// store; syncDir saves the result together with the rest of its batch.
+func (s *server) scanVideo(d store.Directory, v store.Video, in store.VideoInput, tagFromMeta bool, listings map[string][]string) store.VideoScan {
+	dir, name := in.DirectoryPath, in.Filename
+	path := filepath.Join(dir, name)
+	scan := store.VideoScan{VideoID: v.ID, MarkerSource: chapterSource, Tag: d.Title()}
+	// A file replaced or re-encoded in place since the last scan has
+	// stale cached metadata; clear it so the steps below recompute it.
+	if info, err := s.blobs.Stat(path); err == nil &&
+		(info.Size() != v.FileSize || info.ModTime().UnixNano() != v.FileModTime.UnixNano()) {
+		scan.FileSize, scan.FileModTime = info.Size(), info.ModTime()
+		if !v.FileModTime.IsZero() {
+			slog.Info("syncDir: file changed, refreshing metadata", "path", path)
+			invalidateFileMetadata(&v, &scan)
+		}
+	}
+
+	// Native metadata (ffprobe) is only read when something will use it.
+	var meta metadata.Meta
+	haveMeta := false
+	if v.DisplayName == "" || (tagFromMeta && (v.ShowName == "" || v.Genre == "")) {
+		if m, err := metadata.Read(path); err == nil {
+			meta, haveMeta = m, true
+		}
+	}
+	// infer show name if not already set, preferring the file's own show
+	// tag when metadata tagging is enabled
+	if v.ShowName == "" {
+		show := ""
+		if tagFromMeta && haveMeta {
+			show = strings.TrimSpace(meta.Show)
+		}
+		if show == "" {
+			show = inferShow(d.Path, dir, name)
+		}
+		scan.ShowName = show
+		// update our local copy for later checks (e.g. thumbnail)
+		v.ShowName = show
+	}
+	if v.DisplayName == "" && haveMeta {
+		scan.DisplayName = meta.Title
+	}
+	if tagFromMeta && haveMeta && v.Genre == "" {
+		scan.Genre = strings.TrimSpace(meta.Genre)
+	}
+	if v.DurationS == 0 {
+		scan.DurationS = metadata.ReadDuration(path)
+		// A new or changed file: pick up its chapter markers too.
+		if !haveMeta {
+			if m, err := metadata.Read(path); err == nil {
+				meta, haveMeta = m, true
 			}
-			var names []string
-			for _, t := range tags {
-				names = append(names, t.Name)
+		}
+		if haveMeta {
+			scan.Markers = chapterMarkers(meta.Chapters)
+		}
+	}
+	if haveMeta {
+		scan.Description = strings.TrimSpace(meta.Description)
+	}
+	if v.Height == 0 {
+		if streams, err := metadata.ReadStreams(path); err == nil {
+			for _, st := range streams {
+				if st.CodecType == "video" && st.Height > 0 {
+					scan.Width, scan.Height = st.Width, st.Height
+					break
+				}
 			}
-			inferred := inferVideoType(de.Name(), v.SeasonNumber, v.EpisodeNumber, names)
+			scan.Codecs = codecsFromStreams(streams)
+		}
+	}
+	// Infer video type if not already set
+	if v.VideoType == "" {
+		tags, err := s.store.ListTagsByVideo(context.Background(), v.ID)
+		if err != nil {
+			slog.Warn("list tags for inference failed", "videoID", v.ID, "err", err)
+		}
+		var names []string
+		for _, t := range tags {
+			names = append(names, t.Name)
+		}
+		scan.VideoType = inferVideoType(name, v.SeasonNumber, v.EpisodeNumber, names)
+	}
+
+	// Record subtitle, .nfo and artwork companions for later lookup.
+	names, ok := listings[dir]
+	if !ok {
+		names = listDirNames(dir)
+		listings[dir] = names
+	}
+	scan.Sidecars = findSidecars(dir, name, names)
+
+	// Generate thumbnail if it doesn't exist and ffmpeg is available
+	if v.ThumbnailPath == "" {
+		thumbPath := autoThumbnailPath(path)
+		if _, err := os.Stat(thumbPath); os.IsNotExist(err) {
+			// Generate at random position
+			position := 0.1 + rand.Float64()*0.8
+			if err := transcode.GenerateThumbnail(path, thumbPath, position); err != nil {
+				slog.Debug("auto thumbnail generation failed", "path", path, "err", err)
+			} else {
+				scan.ThumbnailPath = thumbPath
+			}
+		} else if err == nil {
+			// Thumbnail exists, update DB
+			scan.ThumbnailPath = thumbPath
+		}
+	}
+	return scan
+}
+
+// saveScans writes a batch of scans, one file at a time if the batch fails
+// so that a bad record only loses itself, then applies each video's JSON
+// sidecar, whose fields override what the scan read from the file.
+func (s *server) saveScans(d store.Directory, videos []store.Video, scans []store.VideoScan) {
+	if err := retryBusy(func() error {
+		return s.store.SaveVideoScans(context.Background(), scans)
+	}); err != nil {
+		slog.Warn("saving scanned videos failed, retrying per file", "dir", d.Path, "count", len(scans), "err", err)
+		for _, sc := range scans {
 			if err := retryBusy(func() error {
-				return s.store.UpdateVideoType(context.Background(), v.ID, inferred)
+				return s.store.SaveVideoScans(context.Background(), []store.VideoScan{sc})
 			}); err != nil {
-				slog.Warn("set video type failed", "path", path, "err", err)
+				slog.Warn("saving scanned video failed", "videoID", sc.VideoID, "err", err)
 			}
 		}
-		// Auto-tag with the registered directory's base name.
-		var dirTag store.Tag
+	}
+	for _, v := range videos {
+		s.applySidecar(context.Background(), v)
+	}
+}
+
+// checkDirectoryOnline stats the directory's folder, records a change of
+// online state in the store, and reports whether the folder is reachable.
+func (s *server) checkDirectoryOnline(ctx context.Context, d store.Directory) bool {
+	fi, err := os.Stat(d.Path)
+	online := err == nil && fi.IsDir()
+	if online == d.Offline {
+		if online {
+			slog.Info("directory back online", "path", d.Path)
+		} else {
+			slog.Warn("directory offline", "path", d.Path, "err", err)
+		}
 		if err := retryBusy(func() error {
-			var e error
-			dirTag, e = s.store.UpsertTag(context.Background(), filepath.Base(d.Path))
-			return e
+			return s.store.SetDirectoryOffline(ctx, d.ID, !online)
 		}); err != nil {
-			slog.Warn("upsert dir tag failed", "dir", d.Path, "err", err)
-		} else if err := retryBusy(func() error {
-			return s.store.TagVideo(context.Background(), v.ID, dirTag.ID)
-		}); err != nil {
-			slog.Warn("tag video with dir tag failed", "videoID", v.ID, "err", err)
+			slog.Warn("record directory online state failed", "path", d.Path, "err", err)
 		}
-		// Apply optional JSON sidecar (same basename, .json extension).
-		s.applySidecar(context.Background(), v)
+	}
+	return online
+}
 
-		// Generate thumbnail if it doesn't exist and ffmpeg is available
-		if v.ThumbnailPath == "" {
-			thumbPath := filepath.Join(dir, strings.TrimSuffix(de.Name(), filepath.Ext(de.Name()))+"_thumb.jpg")
-			if _, err := os.Stat(thumbPath); os.IsNotExist(err) {
-				// Generate at random position
-				position := 0.1 + rand.Float64()*0.8
-				if err := transcode.GenerateThumbnail(path, thumbPath, position); err != nil {
-					slog.Debug("auto thumbnail generation failed", "path", path, "err", err)
-				} else {
-					if err := retryBusy(func() error {
-						return s.store.UpdateVideoThumbnail(context.Background(), v.ID, thumbPath)
-					}); err != nil {
-						slog.Warn("update thumbnail path failed", "videoID", v.ID, "err", err)
-					}
-				}
-			} else if err == nil {
-				// Thumbnail exists, update DB
-				if err := retryBusy(func() error {
-					return s.store.UpdateVideoThumbnail(context.Background(), v.ID, thumbPath)
-				}); err != nil {
-					slog.Warn("update existing thumbnail path failed", "videoID", v.ID, "err", err)
-				}
-			}
+// autoThumbnailPath returns where syncDir stores the generated thumbnail of
+// the video file at path.
+func autoThumbnailPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + "_thumb.jpg"
+}
+
+// invalidateFileMetadata marks the duration, resolution, codecs, chapters
+// and generated thumbnail derived from a video file's previous contents for
+// clearing in scan, and clears them in v. Custom posters are kept since the
+// user picked them deliberately.
+func invalidateFileMetadata(v *store.Video, scan *store.VideoScan) {
+	scan.Reset = true
+	v.DurationS, v.Width, v.Height = 0, 0, 0
+	if thumb := autoThumbnailPath(v.FilePath()); v.ThumbnailPath == thumb {
+		os.Remove(thumb) //nolint:errcheck
+		scan.ClearThumbnail = true
+		v.ThumbnailPath = ""
+	}
+}
+
+// sidecarKind classifies a companion file by extension; "" means the file
+// is not a sidecar.
+func sidecarKind(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".srt", ".vtt":
+		return store.SidecarSubtitle
+	case ".nfo":
+		return store.SidecarNFO
+	case ".jpg", ".jpeg", ".png":
+		return store.SidecarImage
+	}
+	return ""
+}
+
+// findSidecars returns the sidecars of video among the file names of its
+// folder: files named after the video's stem, optionally with an extra
+// qualifier such as a subtitle language ("film.en.srt" for "film.mkv").
+func findSidecars(dir, video string, names []string) []store.Sidecar {
+	stem := strings.TrimSuffix(video, filepath.Ext(video))
+	var out []store.Sidecar
+	for _, name := range names {
+		if name == video {
+			continue
+		}
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		if base != stem && !strings.HasPrefix(base, stem+".") {
+			continue
+		}
+		if kind := sidecarKind(name); kind != "" {
+			out = append(out, store.Sidecar{Kind: kind, Path: filepath.Join(dir, name)})
 		}
+	}
+	return out
+}
 
+// listDirNames returns the names of the regular files in dir, or nil when
+// it cannot be read.
+func listDirNames(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
 		return nil
-	}); err != nil {
-		slog.Error("syncDir walk failed", "path", d.Path, "err", err)
 	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
 
-	// Prune DB records for files that no longer exist on disk.
-	existing, err := s.store.ListVideosByDirectory(context.Background(), d.ID)
+// walkVideoFiles calls visit for every video file under d.Path that syncDir
+// would import, skipping the folders in skip (other registered directories)
+// and anything excluded by d's patterns or beyond its max depth. Symlinked
+// folders are only entered when d.FollowSymlinks is set.
+func walkVideoFiles(d store.Directory, skip map[string]bool, skipJunk bool, visit func(path string, de fs.DirEntry) error) error {
+	if d.FollowSymlinks {
+		return walkFollowingLinks(d, d.Path, skip, skipJunk, make(map[string]bool), visit)
+	}
+	return filepath.WalkDir(d.Path, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			slog.Warn("sync walk error", "path", path, "err", err)
+			return nil // keep walking
+		}
+		if de.IsDir() {
+			// Skip subdirectories that are themselves registered directories.
+			if path != d.Path && skip[filepath.Clean(path)] {
+				return filepath.SkipDir
+			}
+			if isExcluded(d.Excludes, d.Path, path) || exceedsDepth(d.MaxDepth, d.Path, path) ||
+				(path != d.Path && (isStagingDir(de.Name()) || de.Name() == archiveTrashDir)) ||
+				(skipJunk && path != d.Path && isJunkDir(de.Name())) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isVideoFile(de.Name()) || isDownloadFragment(de.Name()) || isExcluded(d.Excludes, d.Path, path) ||
+			(skipJunk && isJunkFile(de.Name())) {
+			return nil
+		}
+		return visit(path, de)
+	})
+}
+
+// walkFollowingLinks is walkVideoFiles for directories that follow symlinks.
+// Paths passed to visit keep the symlinked folder names (so videos stay under
+// d.Path), while seen tracks resolved folders: each real folder is scanned
+// once, which stops symlink loops and duplicate imports via two links.
+func walkFollowingLinks(d store.Directory, dir string, skip map[string]bool, skipJunk bool, seen map[string]bool, visit func(path string, de fs.DirEntry) error) error {
+	real, err := filepath.EvalSymlinks(dir)
 	if err != nil {
-		slog.Error("syncDir list videos failed", "path", d.Path, "err", err)
-		return
+		slog.Warn("sync walk error", "path", dir, "err", err)
+		return nil
 	}
-	for _, v := range existing {
-		if _, err := os.Stat(v.FilePath()); os.IsNotExist(err) {
-			slog.Info("syncDir: removing stale entry", "path", v.FilePath())
-			if err := retryBusy(func() error {
-				return s.store.DeleteVideo(context.Background(), v.ID)
-			}); err != nil {
-				slog.Error("syncDir: delete stale video failed", "videoID", v.ID, "err", err)
+	if seen[real] {
+		slog.Debug("sync: folder already scanned via another path", "path", dir, "target", real)
+		return nil
+	}
+	seen[real] = true
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Warn("sync walk error", "path", dir, "err", err)
+		return nil
+	}
+	for _, de := range entries {
+		path := filepath.Join(dir, de.Name())
+		if de.Type()&fs.ModeSymlink != 0 {
+			fi, err := os.Stat(path)
+			if err != nil {
+				slog.Warn("sync: broken symlink", "path", path, "err", err)
+				continue
 			}
+			de = fs.FileInfoToDirEntry(fi)
 		}
+		if de.IsDir() {
+			if skip[filepath.Clean(path)] || isExcluded(d.Excludes, d.Path, path) || exceedsDepth(d.MaxDepth, d.Path, path) ||
+				isStagingDir(de.Name()) || de.Name() == archiveTrashDir || (skipJunk && isJunkDir(de.Name())) {
+				continue
+			}
+			if err := walkFollowingLinks(d, path, skip, skipJunk, seen, visit); err != nil {
+				return err
+			}
+			continue
+		}
+		if !isVideoFile(de.Name()) || isDownloadFragment(de.Name()) || isExcluded(d.Excludes, d.Path, path) ||
+			(skipJunk && isJunkFile(de.Name())) {
+			continue
+		}
+		if err := visit(path, de); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// underSymlink reports whether any folder between root and dir (inclusive of
+// dir, exclusive of root) is a symlink.
+func underSymlink(root, dir string) bool {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
 	}
+	p := root
+	for _, seg := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, seg)
+		if fi, err := os.Lstat(p); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // startSyncDir marks a directory as syncing and runs syncDir in the background.
@@ -288,8 +596,17 @@ func (s *server) startSyncDir(d store.Directory) {
 	}()
 }
 
-// startLibraryPoller runs in the background, re-scanning all registered
-// directories every 60 s so newly added files are picked up automatically.
+// syncDue reports whether the poller should rescan d at now: on every poll
+// unless d is set to be scanned less often. Half a poll of slack keeps
+// timer jitter from holding a scan back a whole poll.
+func syncDue(d store.Directory, now time.Time) bool {
+	return d.SyncEvery <= libraryPollEvery || now.Sub(d.SyncedAt) >= d.SyncEvery-libraryPollEvery/2
+}
+
+// startLibraryPoller runs in the background, re-scanning the registered
+// directories every 60 s, or as often as each one's SyncEvery asks, so
+// newly added files are picked up automatically and announced in
+// everyone's notifications.
 // Directories are synced sequentially to avoid concurrent write contention
 // on the single-writer SQLite database.
 func (s *server) startLibraryPoller(ctx context.Context) {
@@ -300,11 +617,16 @@ func (s *server) startLibraryPoller(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			if s.maintenance.Load() {
+				continue
+			}
 			dirs, err := s.store.ListDirectories(ctx)
 			if err != nil {
 				slog.Error("library poll: list dirs failed", "err", err)
 				continue
 			}
+			now := time.Now()
+			dirs = slices.DeleteFunc(dirs, func(d store.Directory) bool { return !syncDue(d, now) })
 			// Sync sequentially in a single goroutine to reduce DB
 			// write contention that blocks user-facing read queries.
 			go func() {
@@ -320,8 +642,9 @@ func (s *server) startLibraryPoller(ctx context.Context) {
 
 					start := time.Now()
 					slog.Info("syncDir: start", "path", d.Path)
-					s.syncDir(d)
+					added := s.syncDir(d)
 					slog.Info("syncDir: done", "path", d.Path, "elapsed", time.Since(start).Round(time.Millisecond))
+					s.notifyNewVideos(d, added)
 
 					s.syncingMu.Lock()
 					delete(s.syncingDirs, d.ID)
@@ -463,6 +786,110 @@ func (s *server) applySidecar(ctx context.Context, v store.Video) {
 	}
 }
 
+// isExcluded reports whether path (inside root) matches any of the directory's
+// exclude patterns. A pattern without a slash is matched against the base
+// name; otherwise it is matched against the slash-separated path relative to
+// root, with "**" matching any number of folders (including none).
+func isExcluded(patterns []string, root, path string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, p := range patterns {
+		if !strings.Contains(p, "/") {
+			if ok, _ := filepath.Match(p, filepath.Base(path)); ok {
+				return true
+			}
+			continue
+		}
+		if matchSegments(strings.Split(strings.Trim(p, "/"), "/"), strings.Split(rel, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipJunkFiles reports whether syncDir should ignore hidden files and
+// release samples. It is on unless the skip_junk_files setting is "false".
+func (s *server) skipJunkFiles(ctx context.Context) bool {
+	v, _ := s.store.GetSetting(ctx, "skip_junk_files")
+	return v != "false"
+}
+
+// isJunkFile reports whether a video file name is clutter rather than
+// something to play: dotfiles (including macOS "._" resource forks) and
+// release sample clips such as "movie-sample.mkv" or "Movie.Sample.mkv".
+func isJunkFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	stem := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+	return stem == "sample" || strings.HasSuffix(stem, "-sample") ||
+		strings.HasSuffix(stem, ".sample") || strings.HasSuffix(stem, "_sample")
+}
+
+// isJunkDir reports whether a folder name holds clutter: hidden folders and
+// the "Sample" folders that come with release downloads.
+func isJunkDir(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.EqualFold(name, "sample")
+}
+
+// underJunk reports whether path (inside root) is a junk file or sits in a
+// junk folder below root.
+func underJunk(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	segs := strings.Split(filepath.ToSlash(rel), "/")
+	for _, seg := range segs[:len(segs)-1] {
+		if isJunkDir(seg) {
+			return true
+		}
+	}
+	return isJunkFile(segs[len(segs)-1])
+}
+
+// exceedsDepth reports whether folder dir lies more than maxDepth levels
+// below root. maxDepth <= 0 means unlimited.
+func exceedsDepth(maxDepth int, root, dir string) bool {
+	if maxDepth <= 0 {
+		return false
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return false
+	}
+	return len(strings.Split(filepath.ToSlash(rel), "/")) > maxDepth
+}
+
+// matchSegments matches path segments against pattern segments, where a
+// "**" segment consumes zero or more path segments.
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
 // isVideoFile reports whether name has a video file extension.
 func isVideoFile(name string) bool {
 	switch strings.ToLower(filepath.Ext(name)) {
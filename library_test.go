@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
 )
 
 func TestIsVideoFile(t *testing.T) {
@@ -131,6 +135,41 @@ func TestCheckBinaries_DoesNotPanic(t *testing.T) {
 	checkBinaries()
 }
 
+func TestSyncDue(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		every, since time.Duration
+		want         bool
+	}{
+		{0, 0, true}, // every poll
+		{5 * time.Minute, 4 * time.Minute, false},
+		{5 * time.Minute, 5*time.Minute - time.Second, true}, // timer jitter
+		{7 * 24 * time.Hour, 24 * time.Hour, false},
+		{7 * 24 * time.Hour, 8 * 24 * time.Hour, true},
+	}
+	for _, c := range cases {
+		d := store.Directory{SyncEvery: c.every, SyncedAt: now.Add(-c.since)}
+		if got := syncDue(d, now); got != c.want {
+			t.Errorf("every %v, last %v ago: got %v, want %v", c.every, c.since, got, c.want)
+		}
+	}
+	if !syncDue(store.Directory{SyncEvery: time.Hour}, now) {
+		t.Error("a directory never scanned is not due")
+	}
+}
+
+func TestSyncDir_RecordsSyncTime(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	before := time.Now().Add(-time.Second)
+	srv.syncDir(d)
+	got, _ := srv.store.GetDirectory(ctx, d.ID)
+	if got.SyncedAt.Before(before) {
+		t.Errorf("SyncedAt = %v, want after %v", got.SyncedAt, before)
+	}
+}
+
 func TestSyncDir_Recursive(t *testing.T) {
 	// Build a tree: root/{a.mp4, sub/{b.mkv, ignore.txt}, sub2/{c.mp4}}
 	root := t.TempDir()
@@ -630,8 +669,478 @@ func TestSyncDir_SkipsRegisteredSubdirectory(t *testing.T) {
 	}
 }
 
+func TestIsExcluded(t *testing.T) {
+	root := "/lib"
+	cases := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{[]string{"*.sample.*"}, "/lib/show/ep.sample.mkv", true},
+		{[]string{"*.sample.*"}, "/lib/show/ep.mkv", false},
+		{[]string{"extras"}, "/lib/show/extras", true},
+		{[]string{"extras/**"}, "/lib/extras/bts/clip.mp4", true},
+		{[]string{"extras/**"}, "/lib/show/extras/clip.mp4", false},
+		{[]string{"**/trailers/**"}, "/lib/a/b/trailers/t.mp4", true},
+		{[]string{"**/trailers/**"}, "/lib/trailers", true},
+		{nil, "/lib/a.mp4", false},
+		{[]string{"*"}, "/lib", false}, // the root itself is never excluded
+	}
+	for _, c := range cases {
+		if got := isExcluded(c.patterns, root, c.path); got != c.want {
+			t.Errorf("isExcluded(%q, %q) = %v, want %v", c.patterns, c.path, got, c.want)
+		}
+	}
+}
+
+func TestSyncDir_HonorsExcludePatterns(t *testing.T) {
+	root := t.TempDir()
+	extras := filepath.Join(root, "extras")
+	os.Mkdir(extras, 0755) //nolint:errcheck
+	for _, f := range []string{
+		filepath.Join(root, "film.mp4"),
+		filepath.Join(root, "film.sample.mp4"),
+		filepath.Join(extras, "featurette.mp4"),
+	} {
+		if err := os.WriteFile(f, []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	// Samples are skipped by default; turn that off to test the patterns alone.
+	srv.store.SaveSettings(ctx, map[string]string{"skip_junk_files": "false"}) //nolint:errcheck
+	d, _ := srv.store.AddDirectory(ctx, root)
+	srv.syncDir(d)
+	if videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID); len(videos) != 3 {
+		t.Fatalf("expected 3 videos before excludes, got %d", len(videos))
+	}
+
+	// Adding patterns must skip the files and prune the already-indexed rows.
+	if err := srv.store.SetDirectoryExcludes(ctx, d.ID, []string{"*.sample.*", "extras/**"}); err != nil {
+		t.Fatal(err)
+	}
+	d, _ = srv.store.GetDirectory(ctx, d.ID)
+	srv.syncDir(d)
+	videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID)
+	if len(videos) != 1 || videos[0].Filename != "film.mp4" {
+		t.Errorf("expected only film.mp4 after excludes, got %v", videos)
+	}
+}
+
+func TestIsJunkFile(t *testing.T) {
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"film.mkv", false},
+		{".hidden.mkv", true},
+		{"._film.mkv", true},
+		{"film-sample.mkv", true},
+		{"Film.Sample.mkv", true},
+		{"film_sample.mp4", true},
+		{"sample.mkv", true},
+		{"sampler.mkv", false},
+		{"sample-film.mkv", false},
+	}
+	for _, c := range cases {
+		if got := isJunkFile(c.name); got != c.want {
+			t.Errorf("isJunkFile(%q) = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSyncDir_SkipsJunkFiles(t *testing.T) {
+	root := t.TempDir()
+	for _, sub := range []string{".AppleDouble", "Sample"} {
+		os.Mkdir(filepath.Join(root, sub), 0755) //nolint:errcheck
+	}
+	for _, f := range []string{
+		"film.mp4",
+		"._film.mp4",
+		".secret.mp4",
+		"film-sample.mp4",
+		filepath.Join(".AppleDouble", "film.mp4"),
+		filepath.Join("Sample", "clip.mp4"),
+	} {
+		os.WriteFile(filepath.Join(root, f), []byte("fake"), 0644) //nolint:errcheck
+	}
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	srv.store.SaveSettings(ctx, map[string]string{"skip_junk_files": "false"}) //nolint:errcheck
+	d, _ := srv.store.AddDirectory(ctx, root)
+	srv.syncDir(d)
+	if videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID); len(videos) != 6 {
+		t.Fatalf("expected all 6 files with the filter off, got %d", len(videos))
+	}
+
+	// Turning the filter on skips the junk and prunes what was indexed.
+	srv.store.SaveSettings(ctx, map[string]string{"skip_junk_files": "true"}) //nolint:errcheck
+	srv.syncDir(d)
+	videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID)
+	if len(videos) != 1 || videos[0].Filename != "film.mp4" || videos[0].DirectoryPath != root {
+		t.Errorf("expected only film.mp4 with the filter on, got %v", videos)
+	}
+}
+
+func TestExceedsDepth(t *testing.T) {
+	cases := []struct {
+		max  int
+		dir  string
+		want bool
+	}{
+		{0, "/lib/a/b/c", false},
+		{1, "/lib", false},
+		{1, "/lib/a", false},
+		{1, "/lib/a/b", true},
+		{2, "/lib/a/b", false},
+	}
+	for _, c := range cases {
+		if got := exceedsDepth(c.max, "/lib", c.dir); got != c.want {
+			t.Errorf("exceedsDepth(%d, %q) = %v, want %v", c.max, c.dir, got, c.want)
+		}
+	}
+}
+
+func TestSyncDir_HonorsMaxDepth(t *testing.T) {
+	root := t.TempDir()
+	deep := filepath.Join(root, "show", "cache", "tmp")
+	os.MkdirAll(deep, 0755) //nolint:errcheck
+	for _, f := range []string{
+		filepath.Join(root, "a.mp4"),
+		filepath.Join(root, "show", "b.mp4"),
+		filepath.Join(deep, "c.mp4"),
+	} {
+		if err := os.WriteFile(f, []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, root)
+	srv.syncDir(d)
+	if videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID); len(videos) != 3 {
+		t.Fatalf("expected 3 videos with unlimited depth, got %d", len(videos))
+	}
+
+	if err := srv.store.SetDirectoryMaxDepth(ctx, d.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	d, _ = srv.store.GetDirectory(ctx, d.ID)
+	srv.syncDir(d)
+	videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID)
+	if len(videos) != 2 {
+		t.Errorf("expected 2 videos with max depth 1, got %v", videos)
+	}
+	for _, v := range videos {
+		if v.Filename == "c.mp4" {
+			t.Error("c.mp4 is 3 levels deep and should have been pruned")
+		}
+	}
+}
+
+func TestSyncDir_FollowSymlinks(t *testing.T) {
+	root := t.TempDir()
+	elsewhere := t.TempDir()
+	if err := os.WriteFile(filepath.Join(elsewhere, "linked.mp4"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "local.mp4"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(elsewhere, filepath.Join(root, "farm")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	// A loop back to the root must not be walked forever.
+	if err := os.Symlink(root, filepath.Join(elsewhere, "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, root)
+	srv.syncDir(d)
+	if videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID); len(videos) != 1 {
+		t.Fatalf("without follow: expected only local.mp4, got %v", videos)
+	}
+
+	srv.store.SetDirectoryFollowSymlinks(ctx, d.ID, true) //nolint:errcheck
+	d, _ = srv.store.GetDirectory(ctx, d.ID)
+	srv.syncDir(d)
+	videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID)
+	if len(videos) != 2 {
+		t.Fatalf("with follow: expected 2 videos, got %v", videos)
+	}
+	for _, v := range videos {
+		if v.Filename == "linked.mp4" && v.DirectoryPath != filepath.Join(root, "farm") {
+			t.Errorf("linked video should keep its path under the root, got %q", v.DirectoryPath)
+		}
+	}
+
+	// Turning the option off again prunes videos reached through the link.
+	srv.store.SetDirectoryFollowSymlinks(ctx, d.ID, false) //nolint:errcheck
+	d, _ = srv.store.GetDirectory(ctx, d.ID)
+	srv.syncDir(d)
+	if videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID); len(videos) != 1 {
+		t.Errorf("after disabling follow: expected 1 video, got %v", videos)
+	}
+}
+
+// TestSyncDir_SymlinkWithinRootSurvivesFilters checks that a video reached
+// through a symlink to another folder under the root keeps its ID across
+// scans when the exclude patterns or depth limit would reject the link's
+// target path but not the path the walk followed.
+func TestSyncDir_SymlinkWithinRootSurvivesFilters(t *testing.T) {
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	os.MkdirAll(filepath.Join(root, "archive", "Show"), 0755)                         //nolint:errcheck
+	os.WriteFile(filepath.Join(root, "archive", "Show", "ep.mp4"), []byte("x"), 0644) //nolint:errcheck
+	if err := os.Symlink(filepath.Join(root, "archive", "Show"), filepath.Join(root, "Show")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		setup func(ctx context.Context, srv *server, id int64) error
+	}{
+		{"exclude", func(ctx context.Context, srv *server, id int64) error {
+			return srv.store.SetDirectoryExcludes(ctx, id, []string{"archive"})
+		}},
+		{"max depth", func(ctx context.Context, srv *server, id int64) error {
+			return srv.store.SetDirectoryMaxDepth(ctx, id, 1)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			ctx := context.Background()
+			d, _ := srv.store.AddDirectory(ctx, root)
+			srv.store.SetDirectoryFollowSymlinks(ctx, d.ID, true) //nolint:errcheck
+			if err := tc.setup(ctx, srv, d.ID); err != nil {
+				t.Fatal(err)
+			}
+			d, _ = srv.store.GetDirectory(ctx, d.ID)
+
+			srv.syncDir(d)
+			first, _ := srv.store.ListVideosByDirectory(ctx, d.ID)
+			if len(first) != 1 {
+				t.Fatalf("expected the linked video, got %v", first)
+			}
+			srv.syncDir(d)
+			again, _ := srv.store.ListVideosByDirectory(ctx, d.ID)
+			if len(again) != 1 || again[0].ID != first[0].ID {
+				t.Errorf("expected the video to keep ID %d across scans, got %v", first[0].ID, again)
+			}
+		})
+	}
+}
+
+func TestSyncDir_TagFromMetadata(t *testing.T) {
+	bin := t.TempDir()
+	probe := "#!/bin/sh\necho '{\"format\":{\"tags\":{\"genre\":\"Drama\",\"show\":\"Embedded Show\"}}}'\n"
+	if err := os.WriteFile(filepath.Join(bin, "ffprobe"), []byte(probe), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "Folder Show"), 0755)                            //nolint:errcheck
+	os.WriteFile(filepath.Join(root, "Folder Show", "ep.mp4"), []byte("x"), 0644)    //nolint:errcheck
+	os.WriteFile(filepath.Join(root, "Folder Show", "other.mp4"), []byte("x"), 0644) //nolint:errcheck
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, root)
+
+	// Disabled (default): show comes from the folder and genre stays empty.
+	srv.syncDir(d)
+	videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID)
+	for _, v := range videos {
+		if v.Genre != "" || v.ShowName != "Folder Show" {
+			t.Errorf("option off: got genre %q show %q", v.Genre, v.ShowName)
+		}
+	}
+
+	srv.store.SaveSettings(ctx, map[string]string{"tag_from_metadata": "true"}) //nolint:errcheck
+	srv.store.UpdateVideoShowName(ctx, videos[0].ID, "")                        //nolint:errcheck
+	srv.syncDir(d)
+	for _, v := range videos {
+		got, _ := srv.store.GetVideo(ctx, v.ID)
+		if got.Genre != "Drama" {
+			t.Errorf("%s: genre = %q, want Drama", got.Filename, got.Genre)
+		}
+		// Only the video whose show was cleared picks up the embedded one;
+		// existing values are never overwritten.
+		want := "Folder Show"
+		if v.ID == videos[0].ID {
+			want = "Embedded Show"
+		}
+		if got.ShowName != want {
+			t.Errorf("%s: show = %q, want %q", got.Filename, got.ShowName, want)
+		}
+	}
+}
+
+func TestSyncDir_OfflineDirectoryKeepsVideos(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "drive")
+	os.Mkdir(root, 0755)                                                //nolint:errcheck
+	os.WriteFile(filepath.Join(root, "film.mp4"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, root)
+	srv.syncDir(d)
+
+	// "Unplug" the drive: the scan must not prune the videos.
+	unplugged := filepath.Join(parent, "elsewhere")
+	os.Rename(root, unplugged) //nolint:errcheck
+	srv.syncDir(d)
+	d, _ = srv.store.GetDirectory(ctx, d.ID)
+	if !d.Offline {
+		t.Error("expected the directory to be marked offline")
+	}
+	if videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID); len(videos) != 1 {
+		t.Errorf("offline scan should keep videos, got %d", len(videos))
+	}
+
+	os.Rename(unplugged, root) //nolint:errcheck
+	srv.syncDir(d)
+	if d, _ = srv.store.GetDirectory(ctx, d.ID); d.Offline {
+		t.Error("expected the directory back online")
+	}
+}
+
+func TestSyncDir_AutoTagsWithLabel(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "ep.mp4"), []byte("fake"), 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, root)
+	srv.store.SetDirectoryLabel(ctx, d.ID, "Cartoons") //nolint:errcheck
+	d, _ = srv.store.GetDirectory(ctx, d.ID)
+	srv.syncDir(d)
+
+	videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID)
+	tags, _ := srv.store.ListTagsByVideo(ctx, videos[0].ID)
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	if !slices.Contains(names, "Cartoons") || slices.Contains(names, filepath.Base(root)) {
+		t.Errorf("expected the label instead of the folder name as auto-tag, got %v", names)
+	}
+}
+
+func TestSyncDir_InvalidatesChangedFiles(t *testing.T) {
+	t.Setenv("PATH", "") // no ffprobe/ffmpeg: cleared values stay cleared
+	root := t.TempDir()
+	file := filepath.Join(root, "ep.mp4")
+	os.WriteFile(file, []byte("original"), 0644) //nolint:errcheck
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, root)
+	srv.syncDir(d)
+	videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID)
+	if len(videos) != 1 {
+		t.Fatalf("expected 1 video, got %d", len(videos))
+	}
+	v := videos[0]
+	thumb := autoThumbnailPath(file)
+	os.WriteFile(thumb, []byte("jpg"), 0644)               //nolint:errcheck
+	srv.store.UpdateVideoThumbnail(ctx, v.ID, thumb)       //nolint:errcheck
+	srv.store.UpdateVideoDuration(ctx, v.ID, 42)           //nolint:errcheck
+	srv.store.UpdateVideoResolution(ctx, v.ID, 1920, 1080) //nolint:errcheck
+
+	// An unchanged file keeps its cached metadata.
+	srv.syncDir(d)
+	if got, _ := srv.store.GetVideo(ctx, v.ID); got.DurationS != 42 || got.ThumbnailPath != thumb {
+		t.Fatalf("unchanged file lost metadata: %+v", got)
+	}
+
+	os.WriteFile(file, []byte("re-encoded contents"), 0644) //nolint:errcheck
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(file, later, later) //nolint:errcheck
+	srv.syncDir(d)
+	got, _ := srv.store.GetVideo(ctx, v.ID)
+	if got.DurationS != 0 || got.Height != 0 || got.ThumbnailPath != "" {
+		t.Errorf("changed file kept stale metadata: duration %v height %d thumb %q", got.DurationS, got.Height, got.ThumbnailPath)
+	}
+	if _, err := os.Stat(thumb); !os.IsNotExist(err) {
+		t.Error("stale generated thumbnail should be removed")
+	}
+}
+
+func TestFindSidecars(t *testing.T) {
+	names := []string{
+		"film.mkv", "film.srt", "film.en.vtt", "film.nfo", "film.jpg",
+		"film_thumb.jpg", "film2.srt", "film.json", "other.nfo",
+	}
+	got := findSidecars("/v", "film.mkv", names)
+	want := map[string]string{
+		"/v/film.srt":    store.SidecarSubtitle,
+		"/v/film.en.vtt": store.SidecarSubtitle,
+		"/v/film.nfo":    store.SidecarNFO,
+		"/v/film.jpg":    store.SidecarImage,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %v", got, want)
+	}
+	for _, sc := range got {
+		if want[sc.Path] != sc.Kind {
+			t.Errorf("unexpected sidecar %+v", sc)
+		}
+	}
+}
+
+func TestSyncDir_RecordsSidecars(t *testing.T) {
+	root := t.TempDir()
+	for _, f := range []string{"ep1.mp4", "ep1.srt", "ep1.nfo", "ep2.mp4"} {
+		if err := os.WriteFile(filepath.Join(root, f), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, root)
+	srv.syncDir(d)
+
+	videos, _ := srv.store.ListVideosByDirectory(ctx, d.ID)
+	for _, v := range videos {
+		scs, err := srv.store.ListVideoSidecars(ctx, v.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch v.Filename {
+		case "ep1.mp4":
+			if len(scs) != 2 || scs[0].Kind != store.SidecarNFO || scs[1].Kind != store.SidecarSubtitle {
+				t.Errorf("ep1 sidecars = %+v", scs)
+			}
+		case "ep2.mp4":
+			if len(scs) != 0 {
+				t.Errorf("ep2 should have no sidecars, got %+v", scs)
+			}
+		}
+	}
+
+	// A removed sidecar disappears on the next sync.
+	os.Remove(filepath.Join(root, "ep1.nfo")) //nolint:errcheck
+	srv.syncDir(d)
+	for _, v := range videos {
+		if v.Filename != "ep1.mp4" {
+			continue
+		}
+		if scs, _ := srv.store.ListVideoSidecars(ctx, v.ID); len(scs) != 1 {
+			t.Errorf("expected only the .srt after resync, got %+v", scs)
+		}
+	}
+}
+
 func TestParseYTDLPInfoJSON_Full(t *testing.T) {
 	raw := `{
+		"id": "vid123",
+		"webpage_url": "https://example.com/watch/vid123",
 		"title": "My Video",
 		"description": "A great video",
 		"channel": "TestChannel",
@@ -679,6 +1188,15 @@ func TestParseYTDLPInfoJSON_Full(t *testing.T) {
 	if len(u.Keywords) != 2 || u.Keywords[0] != "tag1" {
 		t.Errorf("Keywords = %v", u.Keywords)
 	}
+	if u.Artist == nil || *u.Artist != "TestUploader" {
+		t.Errorf("Artist = %v", u.Artist)
+	}
+	if u.SourceURL == nil || *u.SourceURL != "https://example.com/watch/vid123" {
+		t.Errorf("SourceURL = %v", u.SourceURL)
+	}
+	if u.SourceID == nil || *u.SourceID != "vid123" {
+		t.Errorf("SourceID = %v", u.SourceID)
+	}
 }
 
 func TestParseYTDLPInfoJSON_FallbackGenre(t *testing.T) {
@@ -712,6 +1230,21 @@ func TestParseYTDLPInfoJSON_InvalidJSON(t *testing.T) {
 	}
 }
 
+func TestParseYTDLPSource(t *testing.T) {
+	src := parseYTDLPSource([]byte(`{"id":"dQw4w9WgXcQ","extractor":"YouTube","title":"X",
+		"webpage_url":"https://www.youtube.com/watch?v=dQw4w9WgXcQ","channel":"Rick","upload_date":"20091025"}`))
+	want := store.VideoSource{
+		Extractor: "youtube", ID: "dQw4w9WgXcQ", URL: "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		Uploader: "Rick", UploadDate: "2009-10-25",
+	}
+	if src != want {
+		t.Errorf("unexpected source: %+v", src)
+	}
+	if src := parseYTDLPSource([]byte("not json")); src.ID != "" {
+		t.Errorf("expected empty source for invalid JSON, got %+v", src)
+	}
+}
+
 func TestYTDLPInfoJSONCleanup(t *testing.T) {
 	tmp := t.TempDir()
 	videoPath := filepath.Join(tmp, "clip.mp4")
@@ -794,3 +1327,37 @@ func TestInferShow(t *testing.T) {
 		})
 	}
 }
+
+// BenchmarkSyncDir times the first import of a folder into an on-disk
+// database, committing per file and in batches.
+func BenchmarkSyncDir(b *testing.B) {
+	dir := b.TempDir()
+	for i := range 300 {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("episode %03d.mp4", i)), nil, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	defer func(n int) { syncBatchSize = n }(syncBatchSize)
+	for _, size := range []int{1, syncBatchSize} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			syncBatchSize = size
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				st, err := store.NewSQLite(filepath.Join(b.TempDir(), "bench.db"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				srv := newTestServer(b)
+				srv.store = st
+				d, _ := st.AddDirectory(context.Background(), dir)
+				b.StartTimer()
+				srv.syncDir(d)
+				b.StopTimer()
+				if n, _ := st.CountVideos(context.Background()); n != 300 {
+					b.Fatalf("expected 300 videos, got %d", n)
+				}
+				st.Close() //nolint:errcheck
+			}
+		})
+	}
+}
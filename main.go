@@ -26,6 +26,7 @@ import (
 	"github.com/grandcat/zeroconf"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/maxgarvey/video_manger/blob"
 	"github.com/maxgarvey/video_manger/store"
 )
 
@@ -36,8 +37,11 @@ var templateFS embed.FS
 var staticFS embed.FS
 
 var templates = template.Must(template.New("").Funcs(template.FuncMap{
-	"base":    filepath.Base,
-	"reltime": reltime,
+	"base":      filepath.Base,
+	"join":      strings.Join,
+	"reltime":   reltime,
+	"gigabytes": formatGigabytes,
+	"duration":  formatDuration,
 	"typeColor": func(videoType string) string {
 		if videoType == "" {
 			return "#d1d5db" // gray for unset
@@ -84,6 +88,9 @@ var templates = template.Must(template.New("").Funcs(template.FuncMap{
 		return vals
 	},
 	"IsValidVideoType": store.IsValidVideoType,
+	"VideoSorts":       func() []struct{ Key, Label string } { return videoSorts },
+	"SyncEveryOptions": func() []syncEveryOption { return syncEveryOptions },
+	"stars":            func() []int { return []int{1, 2, 3, 4, 5} },
 	// splitTagName splits "namespace:value" into parts for styled display.
 	// Returns a struct with Namespace and Value; plain tags have empty Namespace.
 	"splitTagName": func(name string) struct{ Namespace, Value string } {
@@ -96,10 +103,63 @@ var templates = template.Must(template.New("").Funcs(template.FuncMap{
 
 // Server tunables – change these to adjust behaviour without recompiling.
 const (
-	sessionTTL        = 7 * 24 * time.Hour // session cookie lifetime
-	sessionPruneEvery = time.Hour          // how often to run the session pruner
-	libraryPollEvery  = 60 * time.Second   // how often to re-scan directories
-	convertConcurrent = 2                  // max concurrent ffmpeg/yt-dlp processes
+	sessionTTL           = 7 * 24 * time.Hour   // session cookie lifetime
+	sessionPruneEvery    = time.Hour            // how often to run the session pruner
+	libraryPollEvery     = 60 * time.Second     // how often to re-scan directories
+	convertConcurrent    = 2                    // max concurrent ffmpeg/yt-dlp processes
+	hlsSegmentSecs       = 6.0                  // HLS segment length in seconds
+	hlsRestartGap        = 4                    // segments past the encode frontier that trigger an ffmpeg restart
+	hlsIdleTTL           = 2 * time.Minute      // stop HLS sessions idle for this long
+	audioStreamKbps      = 96                   // default bitrate of audio-only streams
+	prepareCheckEvery    = 10 * time.Minute     // how often the prepare hours are checked for work
+	prepareMaxCopies     = 20                   // most prepared copies of incompatible videos kept
+	throttleChunkBytes   = 32 << 10             // largest write between pauses of a rate-limited stream
+	streamsPerClient     = 4                    // video streams one device may have open at once, unless set in Settings
+	streamFlushEvery     = time.Minute          // how often bytes streamed per video are saved
+	resumeEndSlack       = 5.0                  // seconds from the end within which a video restarts instead of resuming
+	previewMaxFiles      = 1000                 // files listed by a directory scan preview
+	deleteTypedFiles     = 100                  // deleting more files than this from a folder needs its name typed
+	deleteTypedBytes     = 10 << 30             // as does deleting more bytes than this
+	tagSuggestLimit      = 10                   // tags offered while typing in the add-tag input
+	recentTagsLimit      = 6                    // quick-apply chips shown under a video's tags
+	notificationsKept    = 100                  // newest notifications kept per viewer
+	eventsKept           = 1000                 // newest events kept in the activity log
+	activityLimit        = 50                   // events listed in the activity panel, feed and API
+	eventSubBuffer       = 16                   // events queued for a slow live stream before it misses some
+	maintenanceRetry     = 5 * time.Minute      // Retry-After sent to viewers during maintenance
+	profileCookieTTL     = 365 * 24 * time.Hour // how long a device remembers its profile
+	quotaGapMax          = 15 * time.Second     // most time between two signs of playback counted toward a profile's allowance
+	snapshotEvery        = time.Hour            // how often today's library growth snapshot is refreshed
+	growthDefaultDays    = 90                   // days of library growth charted by default
+	ratingStatsTop       = 10                   // shows and tags listed in the best-rated panel
+	statsMostWatched     = 10                   // videos listed as most watched, and as most streamed, in the library stats
+	statsWeeks           = 12                   // weeks of watch hours in the library stats
+	downloadLeftoverAge  = 24 * time.Hour       // untouched yt-dlp fragments older than this are removed at startup
+	minPasswordLen       = 8                    // shortest password accepted for a user account
+	thumbConcurrent      = 4                    // max concurrent poster-frame extractions
+	defaultThumbPercent  = 10                   // how far into a video poster frames are taken, in percent
+	extraMaxDuration     = 10 * time.Minute     // longest a trailer or sample runs; a longer file named like one is a feature
+	companionMaxDuration = 5 * time.Second      // longest a photo's companion clip runs
+	storyboardMaxFrames  = 300                  // most scrub preview frames per video
+	storyboardMinGap     = 2.0                  // fewest seconds between scrub preview frames
+	storyboardTileWidth  = 160                  // scrub preview frame width in pixels
+	storyboardColumns    = 10                   // frames per sprite sheet row
+	storyboardRows       = 10                   // rows per sprite sheet
+	storyboardRetryWait  = 10 * time.Minute     // wait before retrying a failed storyboard
+	previewClipSegments  = 5                    // pieces joined into a library preview clip
+	previewClipSegSecs   = 3.0                  // seconds per preview clip piece
+	previewClipWidth     = 320                  // preview clip width in pixels
+	previewClipRetry     = 10 * time.Minute     // wait before retrying a failed preview clip
+	ytdlpMaxURLLen       = 2048                 // longest URL accepted for a yt-dlp download
+	continueLimit        = 20                   // videos in the continue-watching row
+	favoritesLimit       = 20                   // videos in the favourites row
+	defaultRandomRecent  = 10                   // recent random picks kept out of the next one
+	defaultWatchPercent  = 90                   // how far through a video, in percent, it counts as watched
+	corsMaxAge           = 10 * time.Minute     // how long browsers may cache a CORS preflight answer
+	reportCheckEvery     = 10 * time.Minute     // how often the nightly report hour is checked for
+	defaultReportHour    = 6                    // hour of the day, server time, nightly reports go out
+	lowDiskFree          = 0.05                 // share of a library disk left free below which the nightly report warns
+	archiveCheckEvery    = 6 * time.Hour        // how often the archive policies are checked for videos to propose
 )
 
 // reltime formats a SQLite datetime string (UTC, "2006-01-02 15:04:05") as a
@@ -148,6 +208,23 @@ func parseIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
 	return id, true
 }
 
+// parseIDList parses a comma-separated list of IDs such as "3,5,8",
+// ignoring blanks.
+func parseIDList(s string) ([]int64, error) {
+	var ids []int64
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q", f)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 // render executes the named template, writing a 500 on error.
 // The raw template error is only logged server-side; the client receives a
 // generic message so that internal paths and Go type details are not leaked.
@@ -162,12 +239,38 @@ func render(w http.ResponseWriter, name string, data any) {
 	}
 }
 
+// renderNotice writes a one-line htmx fragment: a green "✓ msg" when ok,
+// otherwise msg in red. It is sent with 200 so htmx swaps it in. msg often
+// holds file names or error text, so it goes through notice.html to be
+// escaped rather than being formatted into HTML by hand.
+func renderNotice(w http.ResponseWriter, ok bool, msg string) {
+	render(w, "notice.html", struct {
+		OK      bool
+		Message string
+	}{ok, msg})
+}
+
 func main() {
 	dbPath := flag.String("db", "video_manger.db", "path to SQLite database file")
 	dir := flag.String("dir", "", "video directory to register on startup (optional)")
 	httpPort := flag.String("http-port", "8080", "plain HTTP port (for Roku and other LAN devices)")
 	httpsPort := flag.String("https-port", "8081", "HTTPS/HTTP2 port (for browser)")
+	dlnaPort := flag.String("dlna-port", "8082", "plain HTTP port for the DLNA media server, when enabled in Settings")
 	password := flag.String("password", "", "optional password to protect the UI (leave empty for no auth)")
+	authHeader := flag.String("auth-header", "", "trust this reverse-proxy header (e.g. Remote-User) to name the signed-in user")
+	groupsHeader := flag.String("auth-groups-header", "Remote-Groups", "reverse-proxy header listing the user's groups")
+	trustedProxies := flag.String("trusted-proxies", "127.0.0.1,::1", "comma-separated addresses/CIDRs allowed to set -auth-header")
+	oidcIssuer := flag.String("oidc-issuer", "", "OpenID Connect issuer URL to enable single sign-on")
+	oidcClientID := flag.String("oidc-client-id", "", "OpenID Connect client ID")
+	oidcClientSecret := flag.String("oidc-client-secret", "", "OpenID Connect client secret")
+	oidcRedirect := flag.String("oidc-redirect-url", "", "OpenID Connect redirect URL, ending in /login/oidc/callback")
+	adminGroup := flag.String("admin-group", "", "external group whose members are admins (others become viewers)")
+	corsOrigins := flag.String("cors-origins", "", "comma-separated origins (e.g. https://app.example.com, or *) allowed to call the /api/* JSON API from a browser")
+	corsMethods := flag.String("cors-methods", "GET,HEAD", "comma-separated methods allowed to -cors-origins")
+	smtpAddr := flag.String("smtp-addr", "", "SMTP server (host:port) to email nightly reports through")
+	smtpFrom := flag.String("smtp-from", "", "sender address of nightly report emails")
+	smtpUsername := flag.String("smtp-username", "", "SMTP username (leave empty for no authentication)")
+	smtpPassword := flag.String("smtp-password", "", "SMTP password")
 	flag.Parse()
 
 	s, err := store.NewSQLite(*dbPath)
@@ -180,12 +283,19 @@ func main() {
 	dbDir := filepath.Dir(*dbPath)
 	certFile := filepath.Join(dbDir, "cert.pem")
 	keyFile := filepath.Join(dbDir, "key.pem")
+	thumbCacheDir = filepath.Join(dbDir, "thumbs")
+	storyboardCacheDir = filepath.Join(dbDir, "storyboards")
+	previewCacheDir = filepath.Join(dbDir, "previews")
+	preparedCacheDir = filepath.Join(dbDir, "prepared")
+	subtitleCacheDir = filepath.Join(dbDir, "subtitles")
+	showPosterDir = filepath.Join(dbDir, "show_posters")
 	if err := ensureSelfSignedCert(certFile, keyFile); err != nil {
 		log.Fatalf("TLS cert setup: %v", err)
 	}
 
 	srv := &server{
 		store:         s,
+		blobs:         blob.Local{},
 		port:          *httpPort, // HTTP port — used for Roku share links & /api/info
 		mdnsName:      "video-manger.local",
 		secureCookies: true, // always true: browser uses HTTPS
@@ -195,6 +305,7 @@ func main() {
 		jobs:          make(map[string]*ytdlpJob),
 		convertJobs:   make(map[string]*convertJob),
 		moveJobs:      make(map[string]*bulkMoveJob),
+		hlsSessions:   make(map[string]*hlsSession),
 	}
 	if *password != "" {
 		hash, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
@@ -204,14 +315,63 @@ func main() {
 		srv.passwordHash = hash
 		slog.Info("password protection enabled")
 	}
+	if *authHeader != "" {
+		trusted, err := parseTrustedProxies(*trustedProxies)
+		if err != nil {
+			log.Fatalf("-trusted-proxies: %v", err)
+		}
+		srv.proxy = &proxyAuth{userHeader: *authHeader, groupsHeader: *groupsHeader, trusted: trusted}
+		slog.Info("reverse-proxy authentication enabled", "header", *authHeader, "trusted", *trustedProxies)
+	}
+	if *oidcIssuer != "" {
+		if *oidcClientID == "" || *oidcRedirect == "" {
+			log.Fatal("-oidc-issuer needs -oidc-client-id and -oidc-redirect-url")
+		}
+		srv.oidc = &oidcAuth{
+			issuer:       *oidcIssuer,
+			clientID:     *oidcClientID,
+			clientSecret: *oidcClientSecret,
+			redirectURL:  *oidcRedirect,
+		}
+		slog.Info("OpenID Connect sign-in enabled", "issuer", *oidcIssuer)
+	}
+	srv.adminGroup = *adminGroup
+	if *corsOrigins != "" {
+		cors, err := parseCORSPolicy(*corsOrigins, *corsMethods)
+		if err != nil {
+			log.Fatalf("-cors-origins: %v", err)
+		}
+		srv.cors = cors
+		slog.Info("cross-origin API access enabled", "origins", *corsOrigins, "methods", *corsMethods)
+	}
+
+	if *smtpAddr != "" {
+		if *smtpFrom == "" {
+			log.Fatal("-smtp-addr needs -smtp-from")
+		}
+		srv.mail = &smtpMailer{addr: *smtpAddr, from: *smtpFrom, username: *smtpUsername, password: *smtpPassword}
+		slog.Info("nightly report emails enabled", "smtp", *smtpAddr)
+	}
 
 	// Restore persisted sessions so logins survive a server restart.
 	if savedSessions, err := srv.store.LoadSessions(context.Background()); err == nil {
 		srv.sessions = savedSessions
 	}
+	if sessionUsers, err := srv.store.LoadSessionUsers(context.Background()); err == nil {
+		srv.sessionUsers = sessionUsers
+	}
+	srv.refreshAccounts(context.Background())
+	if on, _ := srv.store.GetSetting(context.Background(), "maintenance_mode"); on == "true" {
+		srv.setMaintenance(true)
+		slog.Warn("maintenance mode is on; background work is paused")
+	}
 
 	if *dir != "" {
-		d, err := srv.store.AddDirectory(context.Background(), *dir)
+		abs, err := filepath.Abs(*dir)
+		if err != nil {
+			log.Fatalf("invalid -dir: %v", err)
+		}
+		d, err := srv.store.AddDirectory(context.Background(), abs)
 		if err != nil {
 			slog.Warn("could not register startup dir", "path", *dir, "err", err)
 		} else {
@@ -240,6 +400,14 @@ func main() {
 
 	go srv.startLibraryPoller(ctx)
 	go srv.startSessionPruner(ctx)
+	go srv.startHLSPruner(ctx)
+	go srv.cleanAllDownloadLeftovers(ctx)
+	go srv.startSnapshotRecorder(ctx)
+	go srv.startAiringRefresher(ctx)
+	go srv.startPreparer(ctx)
+	go srv.startReporter(ctx)
+	go srv.startArchiver(ctx)
+	go srv.startStreamMeter(ctx)
 
 	routes := srv.routes()
 
@@ -259,6 +427,17 @@ func main() {
 		}
 	}()
 
+	// DLNA — smart TVs browse and stream the library; see handlers_dlna.go.
+	var dlnaSrv *http.Server
+	if dlnaEnabled, _ := s.GetSetting(ctx, "dlna_enabled"); dlnaEnabled == "true" {
+		dlnaSrv, err = srv.startDLNA(ctx, *dlnaPort)
+		if err != nil {
+			slog.Warn("DLNA server not started", "err", err)
+		} else {
+			slog.Info("DLNA server started", "port", *dlnaPort)
+		}
+	}
+
 	slog.Info("HTTP  server started (Roku / LAN)", "url", "http://localhost:"+*httpPort)
 	slog.Info("HTTPS server started (browser)", "url", "https://localhost:"+*httpsPort)
 	slog.Info("NOTE: first HTTPS visit will show a cert warning — click Advanced → Proceed to accept the self-signed cert")
@@ -276,6 +455,9 @@ func main() {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	plainSrv.Shutdown(shutdownCtx) //nolint:errcheck
+	if dlnaSrv != nil {
+		dlnaSrv.Shutdown(shutdownCtx) //nolint:errcheck
+	}
 	if err := tlsSrv.Shutdown(shutdownCtx); err != nil {
 		tlsSrv.Close() //nolint:errcheck
 	}
@@ -14,17 +14,18 @@ import (
 	"testing"
 	"time"
 
+	"github.com/maxgarvey/video_manger/blob"
 	"github.com/maxgarvey/video_manger/store"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func newTestServer(t *testing.T) *server {
+func newTestServer(t testing.TB) *server {
 	t.Helper()
 	s, err := store.NewSQLite(":memory:")
 	if err != nil {
 		t.Fatalf("NewSQLite: %v", err)
 	}
-	return &server{store: s, sessions: make(map[string]time.Time), syncingDirs: make(map[int64]struct{}), convertSem: make(chan struct{}, 2), jobs: make(map[string]*ytdlpJob), convertJobs: make(map[string]*convertJob)}
+	return &server{store: s, blobs: blob.Local{}, sessions: make(map[string]time.Time), syncingDirs: make(map[int64]struct{}), convertSem: make(chan struct{}, 2), jobs: make(map[string]*ytdlpJob), convertJobs: make(map[string]*convertJob), hlsSessions: make(map[string]*hlsSession)}
 }
 
 // newTestServerWithAuth creates a test server with password protection enabled.
@@ -126,6 +127,29 @@ func TestAuthLogin(t *testing.T) {
 	}
 }
 
+// doAs sends a request to srv's routes with cookie, when not nil, and form
+// as a urlencoded body. Each option adjusts the request before it is sent.
+func doAs(srv *server, cookie *http.Cookie, method, target string, form url.Values, opts ...func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(req)
+		}
+	}
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+// withHeader is a doAs option setting a request header.
+func withHeader(name, value string) func(*http.Request) {
+	return func(r *http.Request) { r.Header.Set(name, value) }
+}
+
 func itoa(i int64) string {
 	return strconv.FormatInt(i, 10)
 }
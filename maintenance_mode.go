@@ -0,0 +1,125 @@
+// maintenance_mode.go – pause the server for manual work on the library.
+//
+// While maintenance mode is on, the library poller, the prepare hours, the
+// airing refresher and the snapshot recorder skip their runs, and new
+// downloads, conversions and poster frame extractions wait for a slot until
+// it is turned off (cached poster frames are still served), so files can be moved or backed up without the server
+// touching them. Viewers get a 503 page; admins keep full access. Without
+// sign-in everyone is an admin, so only the background work pauses. The
+// mode is kept in the "maintenance_mode" setting and survives a restart.
+//
+// GET /maintenance – the toggle fragment (settings panel)
+// PUT /maintenance – turn it on or off (form value enabled=true|false)
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// setMaintenance turns maintenance mode on or off. Turning it on takes
+// every job slot as running jobs free them; turning it off gives them back.
+func (s *server) setMaintenance(on bool) {
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
+	if on == s.maintenance.Load() {
+		return
+	}
+	s.maintenance.Store(on)
+	if !on {
+		s.releaseJobSlots()
+		s.releaseJobSlots = nil
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.holdJobSlots(ctx)
+	}()
+	s.releaseJobSlots = func() {
+		cancel()
+		<-done
+	}
+}
+
+// holdJobSlots takes every slot of convertSem and thumbSem, waiting for
+// running jobs to finish, and holds them until ctx is cancelled.
+func (s *server) holdJobSlots(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, sem := range []chan struct{}{s.convertSem, thumbSem} {
+		wg.Go(func() { holdSlots(ctx, sem) })
+	}
+	wg.Wait()
+}
+
+// holdSlots takes every slot of sem as they come free and holds them until
+// ctx is cancelled.
+func holdSlots(ctx context.Context, sem chan struct{}) {
+	held := 0
+	defer func() {
+		for range held {
+			<-sem
+		}
+	}()
+	for held < cap(sem) {
+		select {
+		case sem <- struct{}{}:
+			held++
+		case <-ctx.Done():
+			return
+		}
+	}
+	<-ctx.Done()
+}
+
+// maintenanceGate answers viewers with the maintenance page while the mode
+// is on. Sign-in stays reachable so an admin can get in.
+func (s *server) maintenanceGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.maintenance.Load() || s.requestUser(r).Role == store.RoleAdmin ||
+			r.URL.Path == "/login" || strings.HasPrefix(r.URL.Path, "/login/") ||
+			r.URL.Path == "/logout" || strings.HasPrefix(r.URL.Path, "/static/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(maintenanceRetry.Seconds())))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := templates.ExecuteTemplate(w, "maintenance.html", nil); err != nil {
+			slog.Warn("render maintenance page failed", "err", err)
+		}
+	})
+}
+
+func (s *server) renderMaintenance(w http.ResponseWriter) {
+	render(w, "maintenance_toggle.html", s.maintenance.Load())
+}
+
+// GET /maintenance
+func (s *server) handleMaintenanceStatus(w http.ResponseWriter, r *http.Request) {
+	s.renderMaintenance(w)
+}
+
+// PUT /maintenance
+func (s *server) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	on, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+		return
+	}
+	if err := s.store.SaveSettings(r.Context(), map[string]string{"maintenance_mode": strconv.FormatBool(on)}); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.setMaintenance(on)
+	slog.Info("maintenance mode", "on", on, "by", s.requestUser(r).Username)
+	s.renderMaintenance(w)
+}
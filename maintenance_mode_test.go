@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	srv := newTestServer(t)
+	addTestUser(t, srv, "root", "adminpass", store.RoleAdmin)
+	addTestUser(t, srv, "kid", "viewerpass", store.RoleViewer)
+	admin := loginAs(t, srv, "root", "adminpass")
+	viewer := loginAs(t, srv, "kid", "viewerpass")
+
+	if rec := doAs(srv, viewer, http.MethodPut, "/maintenance", url.Values{"enabled": {"true"}}); rec.Code != http.StatusForbidden {
+		t.Errorf("viewer turning maintenance on: expected 403, got %d", rec.Code)
+	}
+	if rec := doAs(srv, admin, http.MethodPut, "/maintenance", url.Values{"enabled": {"yes please"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad enabled: expected 400, got %d", rec.Code)
+	}
+	rec := doAs(srv, admin, http.MethodPut, "/maintenance", url.Values{"enabled": {"true"}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Resume") {
+		t.Fatalf("turning maintenance on: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if v, _ := srv.store.GetSetting(context.Background(), "maintenance_mode"); v != "true" {
+		t.Errorf("maintenance_mode setting = %q, want true", v)
+	}
+
+	for _, target := range []string{"/", "/api/videos"} {
+		rec := doAs(srv, viewer, http.MethodGet, target, nil)
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" ||
+			!strings.Contains(rec.Body.String(), "back shortly") {
+			t.Errorf("viewer GET %s: expected the 503 maintenance page, got %d", target, rec.Code)
+		}
+	}
+	if rec := doAs(srv, admin, http.MethodGet, "/api/videos", nil); rec.Code != http.StatusOK {
+		t.Errorf("admin during maintenance: expected 200, got %d", rec.Code)
+	}
+	if rec := doAs(srv, nil, http.MethodGet, "/login", nil); rec.Code != http.StatusOK {
+		t.Errorf("sign-in page during maintenance: expected 200, got %d", rec.Code)
+	}
+
+	// Every job and poster frame slot is taken, so new jobs wait.
+	deadline := time.Now().Add(2 * time.Second)
+	for (len(srv.convertSem) < cap(srv.convertSem) || len(thumbSem) < cap(thumbSem)) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(srv.convertSem) != cap(srv.convertSem) || len(thumbSem) != cap(thumbSem) {
+		t.Errorf("slots held = %d jobs, %d poster frames; want all %d and %d",
+			len(srv.convertSem), len(thumbSem), cap(srv.convertSem), cap(thumbSem))
+	}
+
+	doAs(srv, admin, http.MethodPut, "/maintenance", url.Values{"enabled": {"false"}})
+	if len(srv.convertSem) != 0 || len(thumbSem) != 0 {
+		t.Errorf("slots still held after maintenance: %d jobs, %d poster frames", len(srv.convertSem), len(thumbSem))
+	}
+	if rec := doAs(srv, viewer, http.MethodGet, "/api/videos", nil); rec.Code != http.StatusOK {
+		t.Errorf("viewer after maintenance: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestMaintenanceMode_TakesSlotsAsJobsFinish(t *testing.T) {
+	srv := newTestServer(t)
+	srv.convertSem <- struct{}{} // a job is running
+	srv.setMaintenance(true)
+	waitSlots := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for len(srv.convertSem) != want && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if len(srv.convertSem) != want {
+			t.Fatalf("slots taken = %d, want %d", len(srv.convertSem), want)
+		}
+	}
+	waitSlots(cap(srv.convertSem))
+	<-srv.convertSem // the job finishes; maintenance takes its slot
+	waitSlots(cap(srv.convertSem))
+	select {
+	case srv.convertSem <- struct{}{}:
+		t.Fatal("a new job started during maintenance")
+	default:
+	}
+	srv.setMaintenance(false)
+	if len(srv.convertSem) != 0 {
+		t.Errorf("slots held after maintenance = %d, want 0", len(srv.convertSem))
+	}
+}
@@ -24,6 +24,16 @@ type Meta struct {
 	EpisodeID   string
 	SeasonNum   string
 	EpisodeNum  string
+	SourceURL   string
+	SourceID    string
+	Chapters    []Chapter // in file order; nil when the file has none
+}
+
+// Chapter is a chapter marker embedded in a video file.
+type Chapter struct {
+	Start float64 // seconds
+	End   float64 // seconds
+	Title string  // empty when the chapter is untitled
 }
 
 // HasData reports whether any metadata field is populated.
@@ -42,8 +52,13 @@ type Updates struct {
 	Genre       *string
 	Date        *string // YYYY-MM-DD
 	Comment     *string
+	Artist      *string
 	Keywords    []string // nil = preserve, []string{} = clear
 
+	// Download origin (custom keys; MP4 needs use_metadata_tags to keep them)
+	SourceURL *string // page the file was downloaded from (purl)
+	SourceID  *string // the site's own video ID
+
 	// TV show fields (map to iTunes atoms in MP4)
 	Show       *string // TV show name  (tvsh)
 	EpisodeID  *string // e.g. "S01E01"  (tven)
@@ -52,8 +67,8 @@ type Updates struct {
 	Network    *string // e.g. "Fox"      (tvnn)
 }
 
-// Read reads native metadata from a video file using ffprobe.
-// Returns an empty Meta (no error) if ffprobe is not available.
+// Read reads native metadata and chapter markers from a video file using
+// ffprobe. Returns an empty Meta (no error) if ffprobe is not available.
 func Read(path string) (Meta, error) {
 	if _, err := exec.LookPath("ffprobe"); err != nil {
 		return Meta{}, nil
@@ -63,6 +78,7 @@ func Read(path string) (Meta, error) {
 		"-v", "quiet",
 		"-print_format", "json",
 		"-show_format",
+		"-show_chapters",
 		path,
 	).Output()
 	if err != nil {
@@ -105,6 +121,9 @@ func Write(path string, u Updates) error {
 	if u.Comment != nil {
 		meta("comment", *u.Comment)
 	}
+	if u.Artist != nil {
+		meta("artist", *u.Artist)
+	}
 	if u.Keywords != nil {
 		meta("keywords", strings.Join(u.Keywords, ","))
 	}
@@ -123,6 +142,15 @@ func Write(path string, u Updates) error {
 	if u.Network != nil {
 		meta("network", *u.Network)
 	}
+	if u.SourceURL != nil {
+		meta("purl", *u.SourceURL)
+	}
+	if u.SourceID != nil {
+		meta("source_id", *u.SourceID)
+	}
+	if (u.SourceURL != nil || u.SourceID != nil) && isMP4Family(ext) {
+		args = append(args, "-movflags", "use_metadata_tags")
+	}
 	args = append(args, tmpPath)
 
 	if out, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
@@ -131,16 +159,62 @@ func Write(path string, u Updates) error {
 	return os.Rename(tmpPath, path)
 }
 
-// Stream holds codec information for a single audio or video stream.
+// isMP4Family reports whether ext names an ISO-BMFF container, whose muxer
+// drops metadata keys it does not know unless told to keep them.
+func isMP4Family(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".mp4", ".m4v", ".mov":
+		return true
+	}
+	return false
+}
+
+// Stream holds codec information for a single stream of a file.
 type Stream struct {
-	CodecType  string // "video" or "audio"
-	CodecName  string // e.g. "h264", "aac"
+	Index      int    // position among all of the file's streams
+	CodecType  string // "video", "audio" or "subtitle"
+	CodecName  string // e.g. "h264", "aac", "subrip"
+	Language   string // ISO 639-2 tag, e.g. "eng"; empty if untagged
+	Title      string // stream title tag, e.g. "English (SDH)"
 	Width      int    // video only
 	Height     int    // video only
 	FrameRate  string // video only, e.g. "23.976"
 	BitRate    string // bits/s
 	SampleRate string // audio only, e.g. "44100"
 	Channels   int    // audio only
+	Default    bool   // flagged as the default stream of its type
+}
+
+// AudioTrack is one of a file's audio streams, as offered for selection
+// between e.g. a dub and the original-language track.
+type AudioTrack struct {
+	Track    int    // position among the file's audio streams (ffmpeg's 0:a:N)
+	Language string // ISO 639-2 tag; empty if untagged or "und"
+	Codec    string // e.g. "aac", "ac3"
+	Channels int
+	Title    string // stream title tag, e.g. "Director's commentary"
+}
+
+// AudioTracks lists the audio streams among streams in file order.
+func AudioTracks(streams []Stream) []AudioTrack {
+	var tracks []AudioTrack
+	for _, st := range streams {
+		if st.CodecType != "audio" {
+			continue
+		}
+		lang := st.Language
+		if lang == "und" {
+			lang = ""
+		}
+		tracks = append(tracks, AudioTrack{
+			Track:    len(tracks),
+			Language: lang,
+			Codec:    st.CodecName,
+			Channels: st.Channels,
+			Title:    st.Title,
+		})
+	}
+	return tracks
 }
 
 // ReadStreams calls ffprobe with -show_streams and returns per-stream
@@ -196,6 +270,13 @@ type ffprobeOutput struct {
 	Format struct {
 		Tags map[string]string `json:"tags"`
 	} `json:"format"`
+	Chapters []struct {
+		StartTime string `json:"start_time"`
+		EndTime   string `json:"end_time"`
+		Tags      struct {
+			Title string `json:"title"`
+		} `json:"tags"`
+	} `json:"chapters"`
 }
 
 func parseFFProbeOutput(data []byte) (Meta, error) {
@@ -216,6 +297,8 @@ func parseFFProbeOutput(data []byte) (Meta, error) {
 		EpisodeID:   tags["episode_id"],
 		SeasonNum:   tags["season_number"],
 		EpisodeNum:  tags["episode_sort"],
+		SourceURL:   tags["purl"],
+		SourceID:    tags["source_id"],
 	}
 	if kw := firstOf(tags, "keywords", "keyword"); kw != "" {
 		for _, k := range strings.FieldsFunc(kw, func(r rune) bool {
@@ -226,6 +309,14 @@ func parseFFProbeOutput(data []byte) (Meta, error) {
 			}
 		}
 	}
+	for _, c := range result.Chapters {
+		start, errS := strconv.ParseFloat(c.StartTime, 64)
+		end, errE := strconv.ParseFloat(c.EndTime, 64)
+		if errS != nil || errE != nil || end <= start {
+			continue
+		}
+		m.Chapters = append(m.Chapters, Chapter{Start: start, End: end, Title: strings.TrimSpace(c.Tags.Title)})
+	}
 	return m, nil
 }
 
@@ -240,6 +331,7 @@ func firstOf(tags map[string]string, keys ...string) string {
 
 type ffprobeStreamsOutput struct {
 	Streams []struct {
+		Index        int    `json:"index"`
 		CodecType    string `json:"codec_type"`
 		CodecName    string `json:"codec_name"`
 		Width        int    `json:"width"`
@@ -248,6 +340,13 @@ type ffprobeStreamsOutput struct {
 		BitRate      string `json:"bit_rate"`
 		SampleRate   string `json:"sample_rate"`
 		Channels     int    `json:"channels"`
+		Disposition  struct {
+			Default int `json:"default"`
+		} `json:"disposition"`
+		Tags struct {
+			Language string `json:"language"`
+			Title    string `json:"title"`
+		} `json:"tags"`
 	} `json:"streams"`
 }
 
@@ -259,13 +358,17 @@ func parseStreams(data []byte) ([]Stream, error) {
 	var out []Stream
 	for _, s := range raw.Streams {
 		st := Stream{
+			Index:      s.Index,
 			CodecType:  s.CodecType,
 			CodecName:  s.CodecName,
+			Language:   s.Tags.Language,
+			Title:      s.Tags.Title,
 			Width:      s.Width,
 			Height:     s.Height,
 			BitRate:    s.BitRate,
 			SampleRate: s.SampleRate,
 			Channels:   s.Channels,
+			Default:    s.Disposition.Default == 1,
 		}
 		// Convert fractional frame rate "num/den" to a decimal string.
 		if s.AvgFrameRate != "" && s.AvgFrameRate != "0/0" {
@@ -64,6 +64,44 @@ func TestParseStreams_VideoAndAudio(t *testing.T) {
 	}
 }
 
+func TestParseStreams_SubtitleTags(t *testing.T) {
+	data := []byte(`{"streams": [
+		{"index": 0, "codec_type": "video", "codec_name": "h264"},
+		{"index": 2, "codec_type": "subtitle", "codec_name": "subrip",
+		 "tags": {"language": "eng", "title": "English (SDH)"}}
+	]}`)
+	streams, err := parseStreams(data)
+	if err != nil {
+		t.Fatalf("parseStreams: %v", err)
+	}
+	sub := streams[1]
+	if sub.Index != 2 || sub.CodecType != "subtitle" || sub.Language != "eng" || sub.Title != "English (SDH)" {
+		t.Errorf("unexpected subtitle stream: %+v", sub)
+	}
+}
+
+func TestAudioTracks(t *testing.T) {
+	streams := []Stream{
+		{CodecType: "video", CodecName: "h264"},
+		{CodecType: "audio", CodecName: "ac3", Language: "ger", Channels: 6},
+		{CodecType: "subtitle", CodecName: "subrip", Language: "eng"},
+		{CodecType: "audio", CodecName: "aac", Language: "und", Channels: 2, Title: "Commentary"},
+	}
+	got := AudioTracks(streams)
+	want := []AudioTrack{
+		{Track: 0, Language: "ger", Codec: "ac3", Channels: 6},
+		{Track: 1, Codec: "aac", Channels: 2, Title: "Commentary"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("track %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
 func TestParseStreams_Empty(t *testing.T) {
 	data := []byte(`{"streams": []}`)
 	streams, err := parseStreams(data)
@@ -173,7 +211,9 @@ func TestParseFFProbeOutput(t *testing.T) {
 				"network":        "HBO",
 				"episode_id":     "S01E02",
 				"season_number":  "1",
-				"episode_sort":   "2"
+				"episode_sort":   "2",
+				"purl":           "https://example.com/v/42",
+				"source_id":      "42"
 			}
 		}
 	}`)
@@ -219,6 +259,9 @@ func TestParseFFProbeOutput(t *testing.T) {
 	if m.EpisodeNum != "2" {
 		t.Errorf("EpisodeNum = %q, want 2", m.EpisodeNum)
 	}
+	if m.SourceURL != "https://example.com/v/42" || m.SourceID != "42" {
+		t.Errorf("source = %q / %q, want the purl and source_id tags", m.SourceURL, m.SourceID)
+	}
 }
 
 func TestParseFFProbeOutput_SemicolonKeywords(t *testing.T) {
@@ -258,6 +301,30 @@ func TestParseFFProbeOutput_FallbackFields(t *testing.T) {
 	}
 }
 
+func TestParseFFProbeOutput_Chapters(t *testing.T) {
+	data := []byte(`{
+		"format": {},
+		"chapters": [
+			{"start_time": "0.000000", "end_time": "312.500000", "tags": {"title": " Opening "}},
+			{"start_time": "312.500000", "end_time": "900.000000"},
+			{"start_time": "900.000000", "end_time": "900.000000", "tags": {"title": "Empty"}}
+		]
+	}`)
+	m, err := parseFFProbeOutput(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Chapter{{Start: 0, End: 312.5, Title: "Opening"}, {Start: 312.5, End: 900}}
+	if len(m.Chapters) != len(want) {
+		t.Fatalf("Chapters = %+v, want %+v", m.Chapters, want)
+	}
+	for i := range want {
+		if m.Chapters[i] != want[i] {
+			t.Errorf("Chapters[%d] = %+v, want %+v", i, m.Chapters[i], want[i])
+		}
+	}
+}
+
 func TestHasData(t *testing.T) {
 	if (Meta{}).HasData() {
 		t.Error("empty Meta.HasData() should be false")
@@ -0,0 +1,89 @@
+// Package naming makes text safe to use as a file or folder name on every
+// system a library might be copied to: Linux, macOS, Windows and the FAT and
+// exFAT file systems of USB sticks. Names are NFC-normalized, so a title
+// typed on one machine and a file name read from another compare equal.
+package naming
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxBytes caps a name in bytes. File systems allow 255; the rest leaves
+// room for suffixes such as "_usb_2" added to avoid clashes.
+const MaxBytes = 200
+
+// replacer swaps characters that Windows, macOS or FAT reject in names.
+var replacer = strings.NewReplacer(
+	"/", "-",
+	"\\", "-",
+	":", "-",
+	"*", "",
+	"?", "",
+	`"`, "",
+	"<", "",
+	">", "",
+	"|", "-",
+)
+
+// reserved are the device names Windows refuses as a name, with or without
+// an extension.
+var reserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Sanitize makes s safe to use as a name or part of one: path separators
+// and other reserved characters are replaced or dropped, control
+// characters removed, leading spaces and trailing dots and spaces trimmed
+// (Windows drops them), device names such as "CON" get a "_" appended, and
+// the result is cut to MaxBytes. It may return "".
+func Sanitize(s string) string {
+	s = replacer.Replace(norm.NFC.String(s))
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, s)
+	s = trim(s)
+	if base, _, _ := strings.Cut(s, "."); reserved[strings.ToUpper(base)] {
+		s = base + "_" + s[len(base):]
+	}
+	return Truncate(s, MaxBytes)
+}
+
+// Truncate cuts s to at most n bytes without splitting a character, then
+// trims what Sanitize trims.
+func Truncate(s string, n int) string {
+	if len(s) > n {
+		i := max(n, 0)
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		s = s[:i]
+	}
+	return trim(s)
+}
+
+// Filename returns stem+ext as a safe file name of at most MaxBytes,
+// shortening stem to fit. ext keeps its leading dot, e.g. ".mp4". A stem
+// with nothing usable left becomes "untitled".
+func Filename(stem, ext string) string {
+	ext = Sanitize(ext)
+	stem = Truncate(Sanitize(stem), MaxBytes-len(ext))
+	if stem == "" {
+		stem = "untitled"
+	}
+	return stem + ext
+}
+
+func trim(s string) string {
+	return strings.TrimLeft(strings.TrimRight(s, ". "), " ")
+}
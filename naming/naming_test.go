@@ -0,0 +1,71 @@
+package naming
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"normal", "normal"},
+		{"path/sep", "path-sep"},
+		{"back\\slash", "back-slash"},
+		{"colon:value", "colon-value"},
+		{"star*glob", "starglob"},
+		{"question?mark", "questionmark"},
+		{`quote"here`, "quotehere"},
+		{"less<than", "lessthan"},
+		{"greater>than", "greaterthan"},
+		{"pipe|char", "pipe-char"},
+		{"  trimmed  ", "trimmed"},
+		{"", ""},
+		{"tab\there\x00", "tabhere"},
+		{"ends with dots...", "ends with dots"},
+		{"..", ""},
+		{"CON", "CON_"},
+		{"con.mp4", "con_.mp4"},
+		{"lpt1.tar.gz", "lpt1_.tar.gz"},
+		{"CONSOLE", "CONSOLE"},
+		{"Cafe\u0301", "Caf\u00e9"}, // decomposed, as macOS names files
+	}
+	for _, c := range cases {
+		if got := Sanitize(c.in); got != c.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := Truncate("aé", 2); got != "a" {
+		t.Errorf("Truncate split a character: %q", got)
+	}
+	if got := Truncate("ab. c", 4); got != "ab" {
+		t.Errorf("Truncate should trim the cut end, got %q", got)
+	}
+	if got := Sanitize(strings.Repeat("ü", 300)); len(got) != MaxBytes {
+		t.Errorf("Sanitize kept %d bytes, want %d", len(got), MaxBytes)
+	}
+}
+
+func TestFilename(t *testing.T) {
+	cases := []struct {
+		stem, ext, want string
+	}{
+		{"Episode 1: Pilot", ".mp4", "Episode 1- Pilot.mp4"},
+		{"???", ".mkv", "untitled.mkv"},
+		{"aux", ".srt", "aux_.srt"},
+		{"film", "", "film"},
+	}
+	for _, c := range cases {
+		if got := Filename(c.stem, c.ext); got != c.want {
+			t.Errorf("Filename(%q, %q) = %q, want %q", c.stem, c.ext, got, c.want)
+		}
+	}
+	long := Filename(strings.Repeat("x", 300), ".webm")
+	if len(long) != MaxBytes || !strings.HasSuffix(long, ".webm") {
+		t.Errorf("long name: got %d bytes %q…", len(long), long[len(long)-10:])
+	}
+}
@@ -0,0 +1,196 @@
+// notifications.go – finished background work, kept until read.
+//
+// Downloads, conversions and exports notify the viewer who started them;
+// new videos found by the library poller and aired episodes notify
+// everyone, exceeded storage limits the admins. Each is published as an
+// event (see events.go) and saved from there as a notification.
+// Notifications are stored per account (user 0 for the shared password or
+// no sign-in), so the bell in the UI shell shows an unread count even after
+// the viewer has navigated away from the job's progress.
+//
+// GET  /notifications            – notification list fragment
+// GET  /notifications/badge      – unread count, as text
+// POST /notifications/read       – mark all read
+// POST /notifications/{id}/read  – mark one read
+// GET  /api/notifications        – unread count and list as JSON
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// apiNotification is the JSON representation of a notification.
+type apiNotification struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"`
+	Message   string `json:"message"`
+	VideoID   int64  `json:"video_id,omitempty"`
+	CreatedAt string `json:"created_at"`
+	Read      bool   `json:"read"`
+}
+
+// notify publishes an event for one viewer, which lands among their
+// notifications. Failures are logged; the job it reports on has already
+// finished.
+func (s *server) notify(userID int64, kind, message string, videoID int64) {
+	s.publish(context.Background(), store.Event{Kind: kind, Message: message, VideoID: videoID, Audience: store.AudienceUser, UserID: userID})
+}
+
+// notifyFailed is notify for a job that failed.
+func (s *server) notifyFailed(userID int64, kind, message string, videoID int64) {
+	s.publish(context.Background(), store.Event{Kind: kind, Message: message, VideoID: videoID, Failed: true, Audience: store.AudienceUser, UserID: userID})
+}
+
+// notifyEveryone notifies the shared viewer and every account.
+func (s *server) notifyEveryone(kind, message string, videoID int64) {
+	s.publish(context.Background(), store.Event{Kind: kind, Message: message, VideoID: videoID, Audience: store.AudienceEveryone})
+}
+
+// notifyAdmins notifies the shared viewer, who can do anything an admin
+// can, and every admin account.
+func (s *server) notifyAdmins(kind, message string, videoID int64) {
+	s.publish(context.Background(), store.Event{Kind: kind, Message: message, VideoID: videoID, Audience: store.AudienceAdmins})
+}
+
+// deliverNotifications saves a published event as a notification for each
+// viewer it is for.
+func (s *server) deliverNotifications(e store.Event) {
+	n := store.Notification{Kind: e.Kind, Message: e.Message, VideoID: e.VideoID, Failed: e.Failed}
+	if e.Audience == store.AudienceUser {
+		n.UserID = e.UserID
+		s.addNotification(n)
+		return
+	}
+	s.addNotification(n) // the shared viewer
+	users, err := s.store.ListUsers(context.Background())
+	if err != nil {
+		slog.Warn("notify: list users failed", "err", err)
+		return
+	}
+	for _, u := range users {
+		if e.Audience == store.AudienceEveryone || u.Role == store.RoleAdmin {
+			n.UserID = u.ID
+			s.addNotification(n)
+		}
+	}
+}
+
+func (s *server) addNotification(n store.Notification) {
+	if _, err := s.store.AddNotification(context.Background(), n, notificationsKept); err != nil {
+		slog.Warn("notify failed", "kind", n.Kind, "err", err)
+	}
+}
+
+// notifyDownload reports a finished yt-dlp job to the viewer who started it.
+func (s *server) notifyDownload(userID int64, rawURL string, job *ytdlpJob) {
+	if job.err != nil {
+		s.notifyFailed(userID, store.NotifyDownload, "Download failed: "+rawURL+": "+job.err.Error(), 0)
+		return
+	}
+	name := rawURL
+	if v, err := s.store.GetVideo(context.Background(), job.videoID); err == nil {
+		name = v.Title()
+	}
+	s.notify(userID, store.NotifyDownload, "Downloaded "+name, job.videoID)
+}
+
+// notifyNewVideos announces the videos a library scan of d added.
+func (s *server) notifyNewVideos(d store.Directory, added []store.Video) {
+	switch len(added) {
+	case 0:
+	case 1:
+		s.notifyEveryone(store.NotifySync, "New in "+d.Title()+": "+added[0].Title(), added[0].ID)
+	default:
+		s.notifyEveryone(store.NotifySync, fmt.Sprintf("%d new videos in %s", len(added), d.Title()), 0)
+	}
+}
+
+func (s *server) renderNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := s.requestUser(r).ID
+	list, err := s.store.ListNotifications(r.Context(), userID, notificationsKept)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	unread, err := s.store.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "notifications.html", struct {
+		Notifications []store.Notification
+		Unread        int
+	}{list, unread})
+}
+
+// GET /notifications
+func (s *server) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	s.renderNotifications(w, r)
+}
+
+// GET /notifications/badge answers with the unread count, or nothing when
+// everything has been read.
+func (s *server) handleNotificationBadge(w http.ResponseWriter, r *http.Request) {
+	n, err := s.store.CountUnreadNotifications(r.Context(), s.requestUser(r).ID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	count := ""
+	if n > 0 {
+		count = fmt.Sprint(n)
+	}
+	render(w, "text.html", count)
+}
+
+// POST /notifications/read
+func (s *server) handleMarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.MarkAllNotificationsRead(r.Context(), s.requestUser(r).ID); err != nil {
+		storeError(w, err)
+		return
+	}
+	w.Header().Set("HX-Trigger", "notificationsRead")
+	s.renderNotifications(w, r)
+}
+
+// POST /notifications/{id}/read
+func (s *server) handleMarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.MarkNotificationRead(r.Context(), s.requestUser(r).ID, id); err != nil {
+		storeError(w, err)
+		return
+	}
+	w.Header().Set("HX-Trigger", "notificationsRead")
+	s.renderNotifications(w, r)
+}
+
+// GET /api/notifications
+func (s *server) handleAPINotifications(w http.ResponseWriter, r *http.Request) {
+	userID := s.requestUser(r).ID
+	list, err := s.store.ListNotifications(r.Context(), userID, notificationsKept)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	out := struct {
+		Unread        int               `json:"unread"`
+		Notifications []apiNotification `json:"notifications"`
+	}{Notifications: make([]apiNotification, 0, len(list))}
+	for _, n := range list {
+		if !n.Read {
+			out.Unread++
+		}
+		out.Notifications = append(out.Notifications, apiNotification{
+			ID: n.ID, Kind: n.Kind, Message: n.Message, VideoID: n.VideoID, CreatedAt: n.CreatedAt, Read: n.Read,
+		})
+	}
+	writeJSON(w, out)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestNotifications_PerViewer(t *testing.T) {
+	srv := newTestServer(t)
+	addTestUser(t, srv, "root", "adminpass", store.RoleAdmin)
+	kid := addTestUser(t, srv, "kid", "viewerpass", store.RoleViewer)
+	rootCookie := loginAs(t, srv, "root", "adminpass")
+	kidCookie := loginAs(t, srv, "kid", "viewerpass")
+
+	srv.notifyEveryone(store.NotifySync, "3 new videos in Films", 0)
+	srv.notify(kid.ID, store.NotifyDownload, "Downloaded Cartoon", 0)
+
+	badge := func(c *http.Cookie) string {
+		return strings.TrimSpace(doAs(srv, c, http.MethodGet, "/notifications/badge", nil).Body.String())
+	}
+	if got := badge(kidCookie); got != "2" {
+		t.Errorf("kid's badge = %q, want 2", got)
+	}
+	if got := badge(rootCookie); got != "1" {
+		t.Errorf("root's badge = %q, want 1", got)
+	}
+	if body := doAs(srv, rootCookie, http.MethodGet, "/notifications", nil).Body.String(); strings.Contains(body, "Cartoon") {
+		t.Error("root should not see kid's download")
+	}
+
+	var out struct {
+		Unread        int               `json:"unread"`
+		Notifications []apiNotification `json:"notifications"`
+	}
+	rec := doAs(srv, kidCookie, http.MethodGet, "/api/notifications", nil)
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil || out.Unread != 2 || len(out.Notifications) != 2 ||
+		out.Notifications[0].Message != "Downloaded Cartoon" {
+		t.Fatalf("GET /api/notifications = %+v, %v", out, err)
+	}
+
+	// Another viewer can't mark it read.
+	first := itoa(out.Notifications[0].ID)
+	if rec := doAs(srv, rootCookie, http.MethodPost, "/notifications/"+first+"/read", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("root marking kid's notification: expected 404, got %d", rec.Code)
+	}
+	rec = doAs(srv, kidCookie, http.MethodPost, "/notifications/"+first+"/read", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("HX-Trigger") != "notificationsRead" {
+		t.Errorf("mark read: got %d, HX-Trigger %q", rec.Code, rec.Header().Get("HX-Trigger"))
+	}
+	if got := badge(kidCookie); got != "1" {
+		t.Errorf("kid's badge after one read = %q, want 1", got)
+	}
+	doAs(srv, kidCookie, http.MethodPost, "/notifications/read", nil)
+	if got := badge(kidCookie); got != "" {
+		t.Errorf("kid's badge after all read = %q, want none", got)
+	}
+	if got := badge(rootCookie); got != "1" {
+		t.Errorf("root's badge = %q, want it untouched", got)
+	}
+}
+
+func TestStartYTDLPJob_NotifiesWhenDone(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	stubYTDLPDownload(t, "Talk.mp4")
+
+	jobID := srv.startYTDLPJob(0, "https://example.com/talk", func(job *ytdlpJob) {
+		srv.runYTDLPJob(job, d, "https://example.com/talk")
+	})
+	srv.jobsMu.Lock()
+	job := srv.jobs[jobID]
+	srv.jobsMu.Unlock()
+	for range job.ch {
+	}
+
+	list, _ := srv.store.ListNotifications(ctx, 0, 10)
+	if len(list) != 1 || list[0].Kind != store.NotifyDownload || list[0].Message != "Downloaded Talk.mp4" || list[0].VideoID != job.videoID {
+		t.Errorf("notifications = %+v, want one for the download", list)
+	}
+}
+
+func TestSyncDir_ReturnsAddedVideos(t *testing.T) {
+	srv := newTestServer(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.mp4"), []byte("a"), 0644) //nolint:errcheck
+	d, _ := srv.store.AddDirectory(context.Background(), dir)
+
+	added := srv.syncDir(d)
+	if len(added) != 1 || added[0].Filename != "a.mp4" {
+		t.Fatalf("first scan added %+v, want a.mp4", added)
+	}
+	srv.notifyNewVideos(d, added)
+	os.WriteFile(filepath.Join(dir, "b.mp4"), []byte("b"), 0644) //nolint:errcheck
+	if added := srv.syncDir(d); len(added) != 1 || added[0].Filename != "b.mp4" {
+		t.Errorf("second scan added %+v, want only b.mp4", added)
+	}
+	if list, _ := srv.store.ListNotifications(context.Background(), 0, 10); len(list) != 1 || !strings.HasPrefix(list[0].Message, "New in ") {
+		t.Errorf("notifications = %+v", list)
+	}
+}
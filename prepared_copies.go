@@ -0,0 +1,270 @@
+// prepared_copies.go – playable copies of incompatible files, made while
+// the server is idle.
+//
+// GET /videos/{id}/prepared – the video's prepared MP4
+//
+// With the "prepare_hours" setting (e.g. "1-6", server local time) set,
+// every prepareCheckEvery during those hours the server picks the videos
+// most likely to be watched next that the browser can't play as they are —
+// next-up episodes of shows in progress, then liked and favourite videos,
+// then the newest unwatched — and remuxes or transcodes up to
+// prepareMaxCopies of them into preparedCacheDir. The player then serves
+// the copy like a plain file, so playback starts and seeks at once. Copies
+// are keyed like storyboards by the source's size and modification time and
+// pruned once a video drops out of the pick; encoding stops when the hours
+// end.
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+	"github.com/maxgarvey/video_manger/transcode"
+)
+
+// preparedCacheDir holds the prepared copies. main moves it beside the
+// database.
+var preparedCacheDir = filepath.Join(os.TempDir(), "video_manger-prepared")
+
+// parseHourRange reads an "START-END" range of hours, such as "1-6" or
+// "22-5" across midnight. END may be 24.
+func parseHourRange(s string) (start, end int, ok bool) {
+	a, b, found := strings.Cut(strings.ReplaceAll(s, " ", ""), "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, errA := strconv.Atoi(a)
+	end, errB := strconv.Atoi(b)
+	if errA != nil || errB != nil || start < 0 || start > 23 || end < 0 || end > 24 || start == end {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// hourWindowEnd reports whether now falls in the hours from start to end
+// and, if so, when they are over.
+func hourWindowEnd(now time.Time, start, end int) (time.Time, bool) {
+	h := now.Hour()
+	if start < end && (h < start || h >= end) || start > end && h < start && h >= end {
+		return time.Time{}, false
+	}
+	over := time.Date(now.Year(), now.Month(), now.Day(), end, 0, 0, 0, now.Location())
+	if !over.After(now) {
+		over = over.AddDate(0, 0, 1)
+	}
+	return over, true
+}
+
+// preparedPath is where v's prepared copy lives for the file's current
+// contents.
+func preparedPath(v store.Video, fi os.FileInfo) string {
+	return filepath.Join(preparedCacheDir,
+		fmt.Sprintf("%d-%x-%x.mp4", v.ID, fi.Size(), fi.ModTime().UnixNano()))
+}
+
+// preparedCopy returns the path of v's prepared copy when there is one for
+// the file as it is now.
+func (s *server) preparedCopy(v store.Video) (string, bool) {
+	fi, err := s.blobs.Stat(v.FilePath())
+	if err != nil {
+		return "", false
+	}
+	path := preparedPath(v, fi)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// nextUpEpisodes returns, for each show with a watched episode, the first
+// unwatched episode after the last watched one.
+func nextUpEpisodes(videos []store.Video) []store.Video {
+	byShow := map[string][]store.Video{}
+	for _, v := range videos {
+		if isEpisode(v) {
+			byShow[v.ShowName] = append(byShow[v.ShowName], v)
+		}
+	}
+	var out []store.Video
+	for _, show := range slices.Sorted(maps.Keys(byShow)) {
+		eps := byShow[show]
+		slices.SortStableFunc(eps, func(a, b store.Video) int {
+			if a.SeasonNumber != b.SeasonNumber {
+				return a.SeasonNumber - b.SeasonNumber
+			}
+			return a.EpisodeNumber - b.EpisodeNumber
+		})
+		last := -1
+		for i, v := range eps {
+			if v.Watched {
+				last = i
+			}
+		}
+		if last < 0 {
+			continue
+		}
+		for _, v := range eps[last+1:] {
+			if !v.Watched {
+				out = append(out, v)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// prepareCandidates orders videos by how likely they are to be played next:
+// next-up episodes, then favourites and liked videos, then unwatched videos
+// newest first.
+func prepareCandidates(videos []store.Video) []store.Video {
+	seen := map[int64]bool{}
+	var out []store.Video
+	add := func(vs []store.Video) {
+		for _, v := range vs {
+			if !seen[v.ID] {
+				seen[v.ID] = true
+				out = append(out, v)
+			}
+		}
+	}
+	add(nextUpEpisodes(videos))
+	rated := slices.DeleteFunc(slices.Clone(videos), func(v store.Video) bool { return v.Rating <= 0 })
+	slices.SortStableFunc(rated, func(a, b store.Video) int { return b.Rating - a.Rating })
+	add(rated)
+	fresh := slices.DeleteFunc(slices.Clone(videos), func(v store.Video) bool { return v.Watched })
+	// IDs are assigned on first sync, so newest first is descending ID.
+	slices.SortStableFunc(fresh, func(a, b store.Video) int { return cmp.Compare(b.ID, a.ID) })
+	add(fresh)
+	return out
+}
+
+// startPreparer prepares copies every prepareCheckEvery until ctx is
+// cancelled.
+func (s *server) startPreparer(ctx context.Context) {
+	ticker := time.NewTicker(prepareCheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.prepareIdle(ctx, now)
+		}
+	}
+}
+
+// prepareIdle makes the missing prepared copies when now is within the
+// prepare hours, one at a time, and removes copies no longer wanted.
+func (s *server) prepareIdle(ctx context.Context, now time.Time) {
+	if s.maintenance.Load() {
+		return
+	}
+	hours, _ := s.store.GetSetting(ctx, "prepare_hours")
+	start, end, ok := parseHourRange(hours)
+	if !ok {
+		return
+	}
+	over, ok := hourWindowEnd(now, start, end)
+	if !ok {
+		return
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return
+	}
+	videos, err := s.store.ListVideos(ctx)
+	if err != nil {
+		slog.Warn("prepare: list videos failed", "err", err)
+		return
+	}
+	type job struct {
+		video store.Video
+		path  string
+		remux bool
+	}
+	var jobs []job
+	keep := map[string]bool{}
+	for _, v := range prepareCandidates(videos) {
+		if len(jobs) == prepareMaxCopies {
+			break
+		}
+		method, _ := decidePlayback(browserCaps, containerFromExt(v.Filename), s.cachedStreams(ctx, v))
+		if method == playDirect {
+			continue
+		}
+		fi, err := s.blobs.Stat(v.FilePath())
+		if err != nil {
+			continue
+		}
+		j := job{video: v, path: preparedPath(v, fi), remux: method == playRemux}
+		jobs = append(jobs, j)
+		keep[filepath.Base(j.path)] = true
+	}
+	old, _ := filepath.Glob(filepath.Join(preparedCacheDir, "*.mp4"))
+	for _, p := range old {
+		if !keep[filepath.Base(p)] {
+			os.Remove(p) //nolint:errcheck
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, over.Sub(now))
+	defer cancel()
+	for _, j := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := os.Stat(j.path); err == nil {
+			continue
+		}
+		if err := s.prepareCopy(ctx, j.video, j.path, j.remux); err != nil && ctx.Err() == nil {
+			slog.Warn("prepare: copy failed", "path", j.video.FilePath(), "err", err)
+		}
+	}
+}
+
+// prepareCopy writes v's prepared copy to dst via a temp file, so a copy at
+// dst is always complete.
+func (s *server) prepareCopy(ctx context.Context, v store.Video, dst string, remux bool) error {
+	select {
+	case s.convertSem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.convertSem }()
+
+	if err := os.MkdirAll(preparedCacheDir, 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(preparedCacheDir, "."+newToken()+".part")
+	defer os.Remove(tmp) //nolint:errcheck
+	if err := transcode.Prepare(ctx, v.FilePath(), tmp, transcode.StreamOptions{Remux: remux}); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// GET /videos/{id}/prepared
+func (s *server) handlePreparedFile(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	path, ok := s.preparedCopy(video)
+	if !ok {
+		http.Error(w, "no prepared copy of this video", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp4")
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestHourWindowEnd(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2026, 3, 1, h, 30, 0, 0, time.UTC) }
+	for _, c := range []struct {
+		hours string
+		now   int
+		in    bool
+		over  time.Time
+	}{
+		{"1-6", 3, true, time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)},
+		{"1-6", 6, false, time.Time{}},
+		{"22-5", 23, true, time.Date(2026, 3, 2, 5, 0, 0, 0, time.UTC)},
+		{"22-5", 2, true, time.Date(2026, 3, 1, 5, 0, 0, 0, time.UTC)},
+		{"22-5", 12, false, time.Time{}},
+		{"0-24", 12, true, time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)},
+	} {
+		start, end, ok := parseHourRange(c.hours)
+		if !ok {
+			t.Fatalf("%q: not parsed", c.hours)
+		}
+		if over, in := hourWindowEnd(at(c.now), start, end); in != c.in || !over.Equal(c.over) {
+			t.Errorf("%q at %d: = %v %v, want %v %v", c.hours, c.now, over, in, c.over, c.in)
+		}
+	}
+	for _, bad := range []string{"", "6", "3-3", "1-25", "x-4"} {
+		if _, _, ok := parseHourRange(bad); ok {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestPrepareCandidates(t *testing.T) {
+	videos := []store.Video{
+		{ID: 1, ShowName: "Lost", SeasonNumber: 1, EpisodeNumber: 1, Watched: true},
+		{ID: 2, ShowName: "Lost", SeasonNumber: 1, EpisodeNumber: 2},
+		{ID: 3, ShowName: "Lost", SeasonNumber: 1, EpisodeNumber: 3},
+		{ID: 4, Filename: "liked.mkv", Rating: 1, Watched: true},
+		{ID: 5, Filename: "favourite.mkv", Rating: 2, Watched: true},
+		{ID: 6, Filename: "new.mkv"},
+		{ID: 7, Filename: "seen.mkv", Watched: true},
+	}
+	var got []int64
+	for _, v := range prepareCandidates(videos) {
+		got = append(got, v.ID)
+	}
+	if want := []int64{2, 5, 4, 6, 3}; !slices.Equal(got, want) {
+		t.Errorf("candidates = %v, want %v", got, want)
+	}
+}
+
+func TestPrepareIdle(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\nfor last; do true; done\necho prepared > \"$last\"\n"
+	os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(script), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	orig := preparedCacheDir
+	preparedCacheDir = t.TempDir()
+	t.Cleanup(func() { preparedCacheDir = orig })
+
+	dir := t.TempDir()
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	add := func(name string, codecs store.VideoCodecs) store.Video {
+		os.WriteFile(filepath.Join(dir, name), []byte("fake"), 0644) //nolint:errcheck
+		v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, name)
+		srv.store.SetVideoCodecs(ctx, v.ID, codecs) //nolint:errcheck
+		return v
+	}
+	hevc := add("hevc.mkv", store.VideoCodecs{Video: "hevc", Audio: "aac"})
+	plain := add("plain.mp4", store.VideoCodecs{Video: "h264", Audio: "aac"})
+	stale := filepath.Join(preparedCacheDir, itoa(plain.ID)+"-1-1.mp4")
+	os.WriteFile(stale, []byte("old"), 0644) //nolint:errcheck
+
+	now := time.Date(2026, 3, 1, 3, 0, 0, 0, time.Local)
+	srv.prepareIdle(ctx, now)
+	if _, ok := srv.preparedCopy(hevc); ok {
+		t.Fatal("prepared a copy with no prepare hours set")
+	}
+	srv.store.SaveSettings(ctx, map[string]string{"prepare_hours": "1-6"}) //nolint:errcheck
+	srv.prepareIdle(ctx, now)
+
+	if _, ok := srv.preparedCopy(hevc); !ok {
+		t.Fatal("expected a prepared copy of the HEVC video")
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("copy no longer wanted should be removed")
+	}
+	if got := srv.playerPlayback(ctx, hevc, store.QualityPreset{}); got.Method != playPrepared || got.URL != "/videos/"+itoa(hevc.ID)+"/prepared" {
+		t.Errorf("player should use the prepared copy, got %+v", got)
+	}
+	rec := doAs(srv, nil, http.MethodGet, "/videos/"+itoa(hevc.ID)+"/prepared", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "video/mp4" || rec.Body.String() != "prepared\n" {
+		t.Errorf("expected the copy, got %d %q: %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	if rec := doAs(srv, nil, http.MethodGet, "/videos/"+itoa(plain.ID)+"/prepared", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("video without a copy: expected 404, got %d", rec.Code)
+	}
+}
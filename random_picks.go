@@ -0,0 +1,170 @@
+// random_picks.go – random play that doesn't repeat itself.
+//
+// The random_no_repeat setting (default defaultRandomRecent) keeps the last N
+// random picks out of the next pick. Picks are remembered in memory per
+// viewer: the device's profile when one is selected, else the signed-in
+// user, else one list shared by everyone. A restart forgets them.
+//
+// With the random_unwatched setting on, or ?unwatched=1 on the request,
+// picks come from videos not yet watched, and from everything once those
+// run out; ?unwatched=0 turns the setting off for one pick.
+//
+// The autoplay pool settings narrow picks from the whole library, such as
+// the video autoplay_random plays on the index page: autoplay_pool_tags
+// (comma-separated tag IDs, any of which will do), autoplay_pool_unwatched
+// (never a watched video, even once those run out), autoplay_pool_min_rating
+// and autoplay_pool_exclude_shows. A pick among given IDs, as from a
+// filtered library list, already has its pool and ignores them.
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// randomRecentN reads how many recent random picks to avoid; 0 turns the
+// check off.
+func (s *server) randomRecentN(ctx context.Context) int {
+	v, _ := s.store.GetSetting(ctx, "random_no_repeat")
+	if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n >= 0 {
+		return n
+	}
+	return defaultRandomRecent
+}
+
+// randomUnwatched reports whether a request's pick should prefer unwatched
+// videos: its unwatched parameter if given, else the setting.
+func (s *server) randomUnwatched(r *http.Request) bool {
+	if v := r.FormValue("unwatched"); v != "" {
+		on, err := strconv.ParseBool(v)
+		return err == nil && on
+	}
+	v, _ := s.store.GetSetting(r.Context(), "random_unwatched")
+	return v == "true"
+}
+
+// autoplayPool reads the settings that narrow picks from the whole library.
+func (s *server) autoplayPool(ctx context.Context) store.RandomFilter {
+	get := func(key string) string {
+		v, _ := s.store.GetSetting(ctx, key)
+		return strings.TrimSpace(v)
+	}
+	f := store.RandomFilter{
+		Unwatched:    get("autoplay_pool_unwatched") == "true",
+		ExcludeShows: get("autoplay_pool_exclude_shows") == "true",
+	}
+	f.MinRating, _ = strconv.Atoi(get("autoplay_pool_min_rating"))
+	f.TagIDs, _ = parseIDList(get("autoplay_pool_tags"))
+	return f
+}
+
+// randomViewer names whose recent picks a request continues.
+func (s *server) randomViewer(r *http.Request) string {
+	if p, ok := s.activeProfile(r); ok {
+		return "profile:" + strconv.FormatInt(p.ID, 10)
+	}
+	if u := s.requestUser(r); u.ID != 0 {
+		return "user:" + strconv.FormatInt(u.ID, 10)
+	}
+	return ""
+}
+
+// recentRandom returns the viewer's most recent picks, newest first.
+func (s *server) recentRandom(viewer string) []int64 {
+	s.randomMu.Lock()
+	defer s.randomMu.Unlock()
+	return slices.Clone(s.randomPicks[viewer])
+}
+
+// rememberRandom records a pick, keeping the viewer's newest n.
+func (s *server) rememberRandom(viewer string, id int64, n int) {
+	s.randomMu.Lock()
+	defer s.randomMu.Unlock()
+	if s.randomPicks == nil {
+		s.randomPicks = make(map[string][]int64)
+	}
+	picks := append([]int64{id}, slices.DeleteFunc(s.randomPicks[viewer], func(p int64) bool { return p == id })...)
+	s.randomPicks[viewer] = picks[:min(len(picks), n)]
+}
+
+// avoidable trims recent to the ones to keep out of a pick from pool
+// candidates: the newest n, but never so many that nothing is left. With a
+// single candidate nothing is avoided.
+func avoidable(recent []int64, n, pool int) []int64 {
+	return recent[:max(0, min(len(recent), n, pool-1))]
+}
+
+// pickRandom picks a random video for the request's viewer, avoiding their
+// recent picks and, when asked, watched videos. With among set the pick is
+// one of those IDs; otherwise it is from the autoplay pool.
+func (s *server) pickRandom(r *http.Request, among []int64) (store.Video, error) {
+	ctx := r.Context()
+	n := s.randomRecentN(ctx)
+	viewer := s.randomViewer(r)
+	recent := s.recentRandom(viewer)
+	unwatched := s.randomUnwatched(r)
+	var (
+		v   store.Video
+		err error
+	)
+	if among != nil {
+		avoid := avoidable(recent, n, len(among))
+		pool := slices.DeleteFunc(slices.Clone(among), func(id int64) bool { return slices.Contains(avoid, id) })
+		if len(pool) == 0 {
+			return store.Video{}, store.ErrNotFound
+		}
+		v, err = s.pickAmong(ctx, pool, unwatched)
+	} else {
+		pool := s.autoplayPool(ctx)
+		preferred := pool
+		preferred.Unwatched = pool.Unwatched || unwatched
+		v, err = s.pickFromLibrary(ctx, preferred, recent[:min(len(recent), n)])
+		if preferred.Unwatched && !pool.Unwatched && errors.Is(err, store.ErrNotFound) {
+			v, err = s.pickFromLibrary(ctx, pool, recent[:min(len(recent), n)])
+		}
+	}
+	if err != nil {
+		return store.Video{}, err
+	}
+	if n > 0 {
+		s.rememberRandom(viewer, v.ID, n)
+	}
+	return v, nil
+}
+
+// pickFromLibrary picks from the library videos passing f, leaving out
+// avoid. The pool's size isn't known here, so it steps back to fewer
+// exclusions until something is left.
+func (s *server) pickFromLibrary(ctx context.Context, f store.RandomFilter, avoid []int64) (store.Video, error) {
+	for k := len(avoid); ; k-- {
+		f.Exclude = avoid[:k]
+		v, err := s.store.GetRandomVideoFiltered(ctx, f)
+		if !errors.Is(err, store.ErrNotFound) || k == 0 {
+			return v, err
+		}
+	}
+}
+
+// pickAmong picks one of pool at random. With unwatched set it tries the
+// pool in random order for a video not yet watched, settling for the first
+// when all of them have been.
+func (s *server) pickAmong(ctx context.Context, pool []int64, unwatched bool) (store.Video, error) {
+	order := rand.Perm(len(pool))
+	first, err := s.store.GetVideo(ctx, pool[order[0]])
+	if err != nil || !unwatched || !first.Watched {
+		return first, err
+	}
+	for _, i := range order[1:] {
+		if v, err := s.store.GetVideo(ctx, pool[i]); err == nil && !v.Watched {
+			return v, nil
+		}
+	}
+	return first, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/internal/fixture"
+)
+
+func TestRandomPicks_AvoidRecent(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	srv.store.SaveSettings(ctx, map[string]string{"random_no_repeat": "2"}) //nolint:errcheck
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	var ids []int64
+	for _, name := range []string{"a.mp4", "b.mp4", "c.mp4"} {
+		v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, name)
+		ids = append(ids, v.ID)
+	}
+	pick := func(method string, form url.Values) int64 {
+		t.Helper()
+		rec := doAs(srv, nil, method, "/random-video", form)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s /random-video: expected 200, got %d", method, rec.Code)
+		}
+		var body struct {
+			ID int64 `json:"id"`
+		}
+		json.NewDecoder(rec.Body).Decode(&body) //nolint:errcheck
+		return body.ID
+	}
+
+	// With three videos and the last two avoided, every pick is the one
+	// left out of the two before it.
+	var got []int64
+	for range 6 {
+		got = append(got, pick(http.MethodGet, nil))
+	}
+	for i := 2; i < len(got); i++ {
+		if got[i] == got[i-1] || got[i] == got[i-2] {
+			t.Fatalf("pick %d repeated a recent one: %v", i, got)
+		}
+	}
+
+	// Picking among two videos can avoid only the last pick.
+	among := url.Values{"ids": {itoa(ids[0]) + "," + itoa(ids[1])}}
+	first := pick(http.MethodPost, among)
+	if second := pick(http.MethodPost, among); second == first || !slices.Contains(ids[:2], second) {
+		t.Errorf("picks among %v: %d then %d", ids[:2], first, second)
+	}
+	if rec := doAs(srv, nil, http.MethodPost, "/random-video", url.Values{"ids": {"x"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad ids: expected 400, got %d", rec.Code)
+	}
+}
+
+func TestRandomPicks_PerProfile(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	p, _ := srv.store.CreateProfile(ctx, "Kids")
+
+	doAs(srv, &http.Cookie{Name: profileCookie, Value: itoa(p.ID)}, http.MethodGet, "/api/random", nil)
+	if got := srv.recentRandom("profile:" + itoa(p.ID)); !slices.Equal(got, []int64{v.ID}) {
+		t.Errorf("profile's picks = %v, want [%d]", got, v.ID)
+	}
+	if got := srv.recentRandom(""); len(got) != 0 {
+		t.Errorf("shared picks = %v, want none", got)
+	}
+}
+
+func TestRandomPicks_Unwatched(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	srv.store.SaveSettings(ctx, map[string]string{"random_no_repeat": "0", "random_unwatched": "true"}) //nolint:errcheck
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	seen, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "seen.mp4")
+	fresh, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "fresh.mp4")
+	srv.store.RecordWatch(ctx, seen.ID, 1) //nolint:errcheck
+	pick := func(target string, form url.Values) int64 {
+		t.Helper()
+		method := http.MethodGet
+		if form != nil {
+			method = http.MethodPost
+		}
+		var body struct {
+			ID int64 `json:"id"`
+		}
+		json.NewDecoder(doAs(srv, nil, method, target, form).Body).Decode(&body) //nolint:errcheck
+		return body.ID
+	}
+
+	among := url.Values{"ids": {itoa(seen.ID) + "," + itoa(fresh.ID)}}
+	for range 10 {
+		if got := pick("/random-video", nil); got != fresh.ID {
+			t.Fatalf("library pick = %d, want the unwatched %d", got, fresh.ID)
+		}
+		if got := pick("/api/random", nil); got != fresh.ID {
+			t.Fatalf("API pick = %d, want the unwatched %d", got, fresh.ID)
+		}
+		if got := pick("/random-video", among); got != fresh.ID {
+			t.Fatalf("pick among both = %d, want the unwatched %d", got, fresh.ID)
+		}
+	}
+
+	// ?unwatched=0 overrides the setting; with everything watched, picks
+	// fall back to the whole library.
+	saw := map[int64]bool{}
+	for range 40 {
+		saw[pick("/random-video?unwatched=0", nil)] = true
+	}
+	if !saw[seen.ID] {
+		t.Error("?unwatched=0 never picked the watched video")
+	}
+	srv.store.RecordWatch(ctx, fresh.ID, 1) //nolint:errcheck
+	if got := pick("/random-video", nil); got == 0 {
+		t.Error("everything watched: expected a pick from the whole library")
+	}
+	if got := pick("/random-video", url.Values{"ids": {itoa(seen.ID)}}); got != seen.ID {
+		t.Errorf("everything watched among one: got %d, want %d", got, seen.ID)
+	}
+}
+
+func TestRandomPicks_AutoplayPool(t *testing.T) {
+	srv := newTestServer(t)
+	lib := fixture.Seed(t, srv.store)
+	clip := fixture.AddVideo(t, srv.store, lib.Dir, fixture.Video{Filename: "clip.mp4"})
+	pick := func(form url.Values) int64 {
+		t.Helper()
+		method := http.MethodGet
+		if form != nil {
+			method = http.MethodPost
+		}
+		rec := doAs(srv, nil, method, "/random-video", form)
+		if rec.Code == http.StatusNotFound {
+			return 0
+		}
+		var body struct {
+			ID int64 `json:"id"`
+		}
+		json.NewDecoder(rec.Body).Decode(&body) //nolint:errcheck
+		return body.ID
+	}
+	save := func(form url.Values) {
+		t.Helper()
+		if rec := doAs(srv, nil, http.MethodPost, "/settings", form); rec.Code != http.StatusOK {
+			t.Fatalf("POST /settings: expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	picks := func() map[int64]bool {
+		saw := map[int64]bool{}
+		for range 30 {
+			saw[pick(nil)] = true
+		}
+		return saw
+	}
+
+	save(url.Values{"random_no_repeat": {"0"}, "autoplay_pool_tags": {itoa(lib.Comedy.ID)}})
+	if saw := picks(); len(saw) != 1 || !saw[lib.Movie.ID] {
+		t.Errorf("comedy pool picked %v, want only the movie %d", saw, lib.Movie.ID)
+	}
+	if rec := doAs(srv, nil, http.MethodGet, "/settings", nil); !strings.Contains(rec.Body.String(), `value="`+itoa(lib.Comedy.ID)+`" checked`) {
+		t.Error("settings form doesn't show the comedy tag ticked")
+	}
+
+	save(url.Values{"random_no_repeat": {"0"}, "autoplay_pool_exclude_shows": {"on"}, "autoplay_pool_unwatched": {"on"}})
+	if saw := picks(); len(saw) != 1 || !saw[clip.ID] {
+		t.Errorf("unwatched, no shows picked %v, want only the clip %d", saw, clip.ID)
+	}
+	// The pool doesn't narrow a pick among given IDs.
+	if got := pick(url.Values{"ids": {itoa(lib.Movie.ID)}}); got != lib.Movie.ID {
+		t.Errorf("pick among the movie = %d, want %d", got, lib.Movie.ID)
+	}
+
+	// A strictly unwatched pool has nothing to fall back to.
+	save(url.Values{"random_no_repeat": {"0"}, "autoplay_pool_min_rating": {"2"}, "autoplay_pool_unwatched": {"on"}})
+	if got := pick(nil); got != 0 {
+		t.Errorf("favourites, strictly unwatched picked %d, want none", got)
+	}
+	// random_unwatched only prefers them, so the watched favourite still plays.
+	save(url.Values{"random_no_repeat": {"0"}, "autoplay_pool_min_rating": {"2"}, "random_unwatched": {"on"}})
+	if got := pick(nil); got != lib.Movie.ID {
+		t.Errorf("favourites, preferring unwatched picked %d, want %d", got, lib.Movie.ID)
+	}
+
+	if rec := doAs(srv, nil, http.MethodPost, "/settings", url.Values{"autoplay_pool_min_rating": {"5"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("min rating 5: expected 400, got %d", rec.Code)
+	}
+	if rec := doAs(srv, nil, http.MethodPost, "/settings", url.Values{"autoplay_pool_tags": {"x"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("tag x: expected 400, got %d", rec.Code)
+	}
+}
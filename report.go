@@ -0,0 +1,308 @@
+// report.go – the nightly report.
+//
+// An account that opts in under Settings (user 0 for the shared password or
+// no sign-in) gets a report once a day at the "report_hour" setting (server
+// local time, defaultReportHour when unset): the new videos, finished
+// downloads and exports and failed jobs from its notifications since the
+// last report, the storage budgets and caps reached (see budgets.go), the
+// library directories whose disk is less than lowDiskFree free, and how many
+// videos are still unwatched. It arrives as a notification like any
+// other and, when the account gave an address and the server was started
+// with -smtp-addr, as an email rendered from report_email.html.
+//
+// GET /report          – the opt-in form (settings panel)
+// PUT /report          – opt in or out (form values enabled, email)
+// GET /report/preview  – the email as it would be sent now
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maxgarvey/video_manger/blob"
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// mailer sends an HTML email.
+type mailer interface {
+	Send(to, subject string, html []byte) error
+}
+
+// smtpMailer sends through the server named by -smtp-addr.
+type smtpMailer struct {
+	addr     string // host:port
+	from     string
+	username string // no authentication when empty
+	password string
+}
+
+func (m *smtpMailer) Send(to, subject string, html []byte) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", m.from, to, mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/html; charset=utf-8\r\n\r\n", time.Now().Format(time.RFC1123Z))
+	msg.Write(html)
+	var auth smtp.Auth
+	if m.username != "" {
+		host, _, _ := strings.Cut(m.addr, ":")
+		auth = smtp.PlainAuth("", m.username, m.password, host)
+	}
+	return smtp.SendMail(m.addr, auth, m.from, []string{to}, msg.Bytes())
+}
+
+// nightlyReport is the data behind report_email.html.
+type nightlyReport struct {
+	Since     time.Time
+	NewVideos []store.Notification // library scans
+	Finished  []store.Notification // downloads and exports
+	Failed    []store.Notification
+	Storage   []budgetAlert
+	LowDisk   []diskAlert
+	Unwatched int
+}
+
+// Summary is the report in one line, for its notification and subject.
+func (r nightlyReport) Summary() string {
+	plural := func(n int, one, many string) string {
+		if n == 1 {
+			return "1 " + one
+		}
+		return fmt.Sprintf("%d %s", n, many)
+	}
+	parts := []string{
+		plural(len(r.NewVideos), "library update", "library updates"),
+		plural(len(r.Finished), "finished job", "finished jobs"),
+		plural(len(r.Failed), "failed job", "failed jobs"),
+	}
+	if n := len(r.Storage) + len(r.LowDisk); n > 0 {
+		parts = append(parts, plural(n, "storage warning", "storage warnings"))
+	}
+	return strings.Join(append(parts, plural(r.Unwatched, "video unwatched", "videos unwatched")), ", ")
+}
+
+// reportHour returns the hour the reports go out.
+func (s *server) reportHour(ctx context.Context) int {
+	v, _ := s.store.GetSetting(ctx, "report_hour")
+	if h, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && h >= 0 && h < 24 {
+		return h
+	}
+	return defaultReportHour
+}
+
+// buildReport gathers userID's report of what happened after since.
+func (s *server) buildReport(ctx context.Context, userID int64, since time.Time) (nightlyReport, error) {
+	rep := nightlyReport{Since: since}
+	list, err := s.store.ListNotificationsSince(ctx, userID, since.UTC().Format(time.DateTime))
+	if err != nil {
+		return rep, err
+	}
+	for _, n := range list {
+		switch {
+		case n.Kind == store.NotifyReport:
+		case n.Failed:
+			rep.Failed = append(rep.Failed, n)
+		case n.Kind == store.NotifySync:
+			rep.NewVideos = append(rep.NewVideos, n)
+		default:
+			rep.Finished = append(rep.Finished, n)
+		}
+	}
+	if rep.Storage, err = s.budgetAlerts(ctx); err != nil {
+		return rep, err
+	}
+	if rep.LowDisk, err = s.diskAlerts(ctx); err != nil {
+		return rep, err
+	}
+	_, rep.Unwatched, err = s.store.ListVideosPage(ctx, store.VideoQuery{Watched: "no", Limit: 1})
+	return rep, err
+}
+
+// diskAlert is a library directory on a disk that is nearly full.
+type diskAlert struct {
+	Path       string
+	FreeBytes  int64
+	TotalBytes int64
+}
+
+func (a diskAlert) String() string {
+	return fmt.Sprintf("%s has only %s free of %s", a.Path, formatBytes(a.FreeBytes), formatBytes(a.TotalBytes))
+}
+
+// diskAlerts lists the online library directories whose disk has less than
+// lowDiskFree of its space left, whether or not a budget is set. It lists
+// none when the video storage can't tell.
+func (s *server) diskAlerts(ctx context.Context) ([]diskAlert, error) {
+	sp, ok := s.blobs.(blob.Spacer)
+	if !ok {
+		return nil, nil
+	}
+	dirs, err := s.store.ListDirectories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var alerts []diskAlert
+	for _, d := range dirs {
+		if d.Offline {
+			continue
+		}
+		free, total, err := sp.Space(d.Path)
+		if err != nil {
+			if !errors.Is(err, errors.ErrUnsupported) {
+				slog.Warn("free space check failed", "dir", d.Path, "err", err)
+			}
+			continue
+		}
+		if total > 0 && float64(free) < float64(total)*lowDiskFree {
+			alerts = append(alerts, diskAlert{Path: d.Path, FreeBytes: int64(free), TotalBytes: int64(total)})
+		}
+	}
+	return alerts, nil
+}
+
+// renderReport renders rep as the email body.
+func renderReport(rep nightlyReport) ([]byte, error) {
+	var buf bytes.Buffer
+	err := templates.ExecuteTemplate(&buf, "report_email.html", rep)
+	return buf.Bytes(), err
+}
+
+// reportSince is where sub's next report starts: its last report, or a day
+// before now for the first.
+func reportSince(sub store.ReportSubscription, now time.Time) time.Time {
+	if t, err := time.Parse(time.DateTime, sub.LastSent); err == nil {
+		return t
+	}
+	return now.Add(-24 * time.Hour)
+}
+
+// startReporter sends the nightly reports, checking every reportCheckEvery
+// until ctx is cancelled.
+func (s *server) startReporter(ctx context.Context) {
+	ticker := time.NewTicker(reportCheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.sendReports(ctx, now)
+		}
+	}
+}
+
+// sendReports sends the reports not yet sent today, once now is in the
+// report hour.
+func (s *server) sendReports(ctx context.Context, now time.Time) {
+	if s.maintenance.Load() || now.Hour() != s.reportHour(ctx) {
+		return
+	}
+	subs, err := s.store.ListReportSubscriptions(ctx)
+	if err != nil {
+		slog.Warn("nightly report: list subscriptions failed", "err", err)
+		return
+	}
+	today := now.Format(time.DateOnly)
+	for _, sub := range subs {
+		if last, err := time.Parse(time.DateTime, sub.LastSent); err == nil && last.Local().Format(time.DateOnly) == today {
+			continue
+		}
+		s.sendReport(ctx, sub, now)
+	}
+}
+
+// sendReport delivers sub's report. A failed email is logged and not
+// retried; the notification still carries the summary.
+func (s *server) sendReport(ctx context.Context, sub store.ReportSubscription, now time.Time) {
+	rep, err := s.buildReport(ctx, sub.UserID, reportSince(sub, now))
+	if err != nil {
+		slog.Warn("nightly report failed", "user", sub.UserID, "err", err)
+		return
+	}
+	s.notify(sub.UserID, store.NotifyReport, "Nightly report: "+rep.Summary(), 0)
+	if sub.Email != "" && s.mail != nil {
+		body, err := renderReport(rep)
+		if err == nil {
+			err = s.mail.Send(sub.Email, "Video library: "+rep.Summary(), body)
+		}
+		if err != nil {
+			slog.Warn("nightly report email failed", "user", sub.UserID, "to", sub.Email, "err", err)
+		}
+	}
+	if err := s.store.MarkReportSent(ctx, sub.UserID, now.UTC().Format(time.DateTime)); err != nil {
+		slog.Warn("nightly report: mark sent failed", "user", sub.UserID, "err", err)
+	}
+}
+
+func (s *server) renderReportPrefs(w http.ResponseWriter, r *http.Request, errMsg string) {
+	sub, err := s.store.GetReportSubscription(r.Context(), s.requestUser(r).ID)
+	enabled := err == nil
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		storeError(w, err)
+		return
+	}
+	render(w, "report_prefs.html", struct {
+		Enabled bool
+		Email   string
+		CanMail bool // -smtp-addr is set
+		Hour    int
+		Error   string
+	}{enabled, sub.Email, s.mail != nil, s.reportHour(r.Context()), errMsg})
+}
+
+// GET /report
+func (s *server) handleReportPrefs(w http.ResponseWriter, r *http.Request) {
+	s.renderReportPrefs(w, r, "")
+}
+
+// PUT /report opts the account in with enabled set, or out. An invalid
+// address is reported in the panel and not saved.
+func (s *server) handleSetReportPrefs(w http.ResponseWriter, r *http.Request) {
+	userID := s.requestUser(r).ID
+	if r.FormValue("enabled") != "on" {
+		if err := s.store.DeleteReportSubscription(r.Context(), userID); err != nil {
+			storeError(w, err)
+			return
+		}
+		s.renderReportPrefs(w, r, "")
+		return
+	}
+	email := strings.TrimSpace(r.FormValue("email"))
+	if email != "" {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Name != "" {
+			s.renderReportPrefs(w, r, fmt.Sprintf("%q is not an email address", email))
+			return
+		}
+		email = addr.Address
+	}
+	if err := s.store.SetReportSubscription(r.Context(), userID, email); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderReportPrefs(w, r, "")
+}
+
+// GET /report/preview
+func (s *server) handleReportPreview(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	sub, err := s.store.GetReportSubscription(r.Context(), s.requestUser(r).ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		storeError(w, err)
+		return
+	}
+	rep, err := s.buildReport(r.Context(), s.requestUser(r).ID, reportSince(sub, now))
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	render(w, "report_email.html", rep)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/blob"
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// sentMail records the emails a test server sends.
+type sentMail struct {
+	to, subject []string
+	bodies      []string
+}
+
+func (m *sentMail) Send(to, subject string, html []byte) error {
+	m.to = append(m.to, to)
+	m.subject = append(m.subject, subject)
+	m.bodies = append(m.bodies, string(html))
+	return nil
+}
+
+// diskSpace is local video storage reporting a disk with free of total
+// bytes left.
+type diskSpace struct {
+	blob.Local
+	free, total uint64
+}
+
+func (d diskSpace) Space(string) (uint64, uint64, error) { return d.free, d.total, nil }
+
+func TestReportWarnsOfLowDisk(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	offline, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	srv.store.SetDirectoryOffline(ctx, offline.ID, true) //nolint:errcheck
+
+	srv.blobs = diskSpace{free: 50 << 30, total: 500 << 30}
+	if rep, err := srv.buildReport(ctx, 0, time.Now()); err != nil || len(rep.LowDisk) != 0 {
+		t.Fatalf("disk 10%% free: LowDisk = %+v, %v; want none", rep.LowDisk, err)
+	}
+	srv.blobs = diskSpace{free: 2 << 30, total: 500 << 30}
+	rep, err := srv.buildReport(ctx, 0, time.Now())
+	if err != nil || len(rep.LowDisk) != 1 || rep.LowDisk[0].Path != d.Path {
+		t.Fatalf("disk 0.4%% free: LowDisk = %+v, %v; want %s only", rep.LowDisk, err, d.Path)
+	}
+	if !strings.Contains(rep.Summary(), "1 storage warning") {
+		t.Errorf("summary = %q, want a storage warning", rep.Summary())
+	}
+}
+
+func TestSendReports(t *testing.T) {
+	srv := newTestServer(t)
+	mail := &sentMail{}
+	srv.mail = mail
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	srv.store.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")                  //nolint:errcheck
+	srv.store.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")                  //nolint:errcheck
+	srv.store.SaveSettings(ctx, map[string]string{"report_hour": "7"}) //nolint:errcheck
+	srv.notify(0, store.NotifySync, "2 new videos in videos", 0)
+	srv.notify(0, store.NotifyDownload, "Downloaded Talk", 0)
+	srv.notifyFailed(0, store.NotifyExport, "Converting Talk failed: exit status 1", 0)
+	srv.notify(5, store.NotifyDownload, "Downloaded Someone Else's", 0)
+	srv.store.SetReportSubscription(ctx, 0, "me@example.com") //nolint:errcheck
+
+	day := time.Now().Add(time.Hour) // notifications are stamped to the second
+	srv.sendReports(ctx, time.Date(day.Year(), day.Month(), day.Day(), 6, 0, 0, 0, time.Local))
+	if len(mail.to) != 0 {
+		t.Fatalf("sent before the report hour: %v", mail.subject)
+	}
+	at := time.Date(day.Year(), day.Month(), day.Day(), 7, 10, 0, 0, time.Local)
+	srv.sendReports(ctx, at)
+	if len(mail.to) != 1 || mail.to[0] != "me@example.com" {
+		t.Fatalf("want one email to me@example.com, got %v", mail.to)
+	}
+	want := "1 library update, 1 finished job, 1 failed job, 2 videos unwatched"
+	if !strings.HasSuffix(mail.subject[0], want) {
+		t.Errorf("subject = %q, want it to end %q", mail.subject[0], want)
+	}
+	body := mail.bodies[0]
+	for _, s := range []string{"2 new videos in videos", "Downloaded Talk", "Converting Talk failed"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("email should mention %q", s)
+		}
+	}
+	if strings.Contains(body, "Someone Else") {
+		t.Error("email should only cover the subscriber's own notifications")
+	}
+	if list, _ := srv.store.ListNotifications(ctx, 0, 1); len(list) != 1 || list[0].Message != "Nightly report: "+want {
+		t.Errorf("want the report as a notification, got %+v", list)
+	}
+
+	srv.sendReports(ctx, at.Add(30*time.Minute))
+	if len(mail.to) != 1 {
+		t.Errorf("report sent twice in one day: %v", mail.subject)
+	}
+}
+
+func TestHandleSetReportPrefs(t *testing.T) {
+	srv := newTestServer(t)
+	srv.mail = &sentMail{}
+	ctx := context.Background()
+
+	rec := doAs(srv, nil, http.MethodPut, "/report", url.Values{"enabled": {"on"}, "email": {"not an address"}})
+	if !strings.Contains(rec.Body.String(), "not an email address") {
+		t.Errorf("invalid address: want the error in the panel, got: %s", rec.Body.String())
+	}
+	if _, err := srv.store.GetReportSubscription(ctx, 0); err == nil {
+		t.Error("an invalid address should not opt in")
+	}
+
+	rec = doAs(srv, nil, http.MethodPut, "/report", url.Values{"enabled": {"on"}, "email": {" me@example.com "}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="me@example.com"`) {
+		t.Fatalf("opt in: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if sub, err := srv.store.GetReportSubscription(ctx, 0); err != nil || sub.Email != "me@example.com" {
+		t.Errorf("subscription = %+v, %v", sub, err)
+	}
+
+	doAs(srv, nil, http.MethodPut, "/report", url.Values{"email": {"me@example.com"}})
+	if _, err := srv.store.GetReportSubscription(ctx, 0); err == nil {
+		t.Error("unchecking should opt out")
+	}
+}
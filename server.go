@@ -10,13 +10,16 @@ import (
 	"log/slog"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/maxgarvey/video_manger/blob"
 	"github.com/maxgarvey/video_manger/store"
 )
 
@@ -29,6 +32,15 @@ type ytdlpJob struct {
 	videoID int64 // set after successful sync; 0 if unknown
 }
 
+// send forwards a line of output without blocking; lines are dropped when
+// the buffer is full.
+func (j *ytdlpJob) send(line string) {
+	select {
+	case j.ch <- line:
+	default:
+	}
+}
+
 // convertJob tracks a running ffmpeg conversion. Lines are sent to ch as
 // they are produced; ch is closed when the job finishes. err is set (if
 // non-nil) and outName is set (on success) before ch is closed.
@@ -50,12 +62,22 @@ type bulkMoveJob struct {
 
 type server struct {
 	store         store.Store
+	blobs         blob.Storage // video file bytes; handlers go through it, not os
 	port          string
 	mdnsName      string               // e.g. "video-manger.local"
 	passwordHash  []byte               // nil means no authentication required
 	secureCookies bool                 // set Secure flag on session cookie (requires HTTPS)
 	sessions      map[string]time.Time // token → expiry (7-day TTL)
+	// sessionUsers maps a session token to its account; sessions from the
+	// shared -password login have no entry. Guarded by sessionsMu.
+	sessionUsers  map[string]int64
 	sessionsMu    sync.RWMutex
+	accounts      atomic.Bool // set while any user account exists
+	proxy         *proxyAuth  // nil unless -auth-header is set
+	oidc          *oidcAuth   // nil unless -oidc-issuer is set
+	cors          *corsPolicy // nil unless -cors-origins is set
+	mail          mailer      // nil unless -smtp-addr is set
+	adminGroup    string      // external group whose members are admins
 	syncingDirs   map[int64]struct{}
 	syncingMu     sync.Mutex
 	convertSem    chan struct{}        // limits concurrent ffmpeg/yt-dlp processes
@@ -65,30 +87,63 @@ type server struct {
 	convertJobsMu sync.Mutex
 	moveJobs      map[string]*bulkMoveJob // active bulk-move jobs
 	moveJobsMu    sync.Mutex
+	hlsSessions   map[string]*hlsSession // active HLS transcode sessions
+	hlsMu         sync.Mutex
+	storyboards   map[string]*storyboardJob // running or failed storyboard runs, by output dir
+	storyboardMu  sync.Mutex
+	previewJobs   map[string]*storyboardJob // running or failed preview clip runs, by output file
+	previewMu     sync.Mutex
+	randomPicks   map[string][]int64 // recent random picks per viewer, newest first
+	randomMu      sync.Mutex
+	// Maintenance mode; see maintenance_mode.go. releaseJobSlots is set
+	// while it is on.
+	maintenance     atomic.Bool
+	maintenanceMu   sync.Mutex
+	releaseJobSlots func()
+	// Storage limits exceeded at the last check, keyed by budgetAlert.key.
+	budgetExceeded map[string]bool
+	budgetMu       sync.Mutex
 	// Roku cast: one pending video to play, cleared after the Roku polls it.
 	castVideoID  int64
 	castPostedAt time.Time
 	castLastPoll time.Time // updated on every /roku/poll call
 	castMu       sync.Mutex
+	// Set while approved archive proposals are carried out; see archive.go.
+	archiving atomic.Bool
+	// Viewers following the live event stream; see events.go.
+	eventSubs   map[*eventSub]struct{}
+	eventSubsMu sync.Mutex
+	// Open streams per device and bytes streamed per video not yet saved;
+	// see streams.go.
+	streamsOpen map[string]int
+	bytesServed map[int64]int64
+	streamMu    sync.Mutex
+	// When each limited profile last showed playback; see watch_quota.go.
+	quotaSeen map[int64]time.Time
+	quotaMu   sync.Mutex
+	// Key for signed stream URLs; see signed_streams.go.
+	streamKey     []byte
+	streamKeyOnce sync.Once
 }
 
 // seasonGroup holds videos belonging to a particular season within a show.
 type seasonGroup struct {
 	Number int
-	Videos []store.Video
+	Videos []videoCard
 }
 
 // videoGroup is a view-layer grouping of videos by show/series. Standalone
 // videos (no show_name) are grouped by their directory base name.
 type videoGroup struct {
 	Show    string
+	IsShow  bool // Show names a show rather than a directory
 	Seasons []seasonGroup
 }
 
 // groupVideosByShowSeason groups a flat video slice first by show name (or
 // directory name when show is absent), then by season number. Order of videos
 // is preserved from the input slice.
-func groupVideosByShowSeason(videos []store.Video) []videoGroup {
+func groupVideosByShowSeason(videos []videoCard) []videoGroup {
 	var groups []videoGroup
 	idx := map[string]int{} // show key → groups index
 	for _, v := range videos {
@@ -102,6 +157,9 @@ func groupVideosByShowSeason(videos []store.Video) []videoGroup {
 			idx[key] = gi
 			groups = append(groups, videoGroup{Show: key})
 		}
+		if v.ShowName != "" {
+			groups[gi].IsShow = true
+		}
 		// find or create season group
 		sn := v.SeasonNumber
 		si := -1
@@ -120,42 +178,105 @@ func groupVideosByShowSeason(videos []store.Video) []videoGroup {
 	return groups
 }
 
-// authMiddleware redirects unauthenticated requests to /login when a password
-// is configured. The /login and /logout routes are always accessible.
+// authRequired reports whether requests must be signed in: when a shared
+// password, an external identity provider or any user account exists.
+func (s *server) authRequired() bool {
+	return s.passwordHash != nil || s.proxy != nil || s.oidc != nil || s.accounts.Load()
+}
+
+// authMiddleware redirects unauthenticated requests to /login when sign-in
+// is required, and otherwise records the signed-in user on the request
+// context for requireAdmin. A user vouched for by a trusted reverse proxy
+// needs no session. The /login* and /logout routes are always accessible,
+// and so are the /share pages, which check their own signed links.
 func (s *server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if s.passwordHash == nil {
+		if !s.authRequired() {
 			next.ServeHTTP(w, r)
 			return
 		}
-		if r.URL.Path == "/login" || r.URL.Path == "/logout" {
+		if r.URL.Path == "/login" || strings.HasPrefix(r.URL.Path, "/login/") || r.URL.Path == "/logout" {
 			next.ServeHTTP(w, r)
 			return
 		}
-		cookie, err := r.Cookie("session")
-		if err == nil {
-			s.sessionsMu.RLock()
-			expiry, ok := s.sessions[cookie.Value]
-			s.sessionsMu.RUnlock()
-			if ok && time.Now().Before(expiry) {
-				next.ServeHTTP(w, r)
-				return
-			}
+		user, ok := s.proxyUser(r)
+		if !ok {
+			user, ok = s.sessionUser(r)
+		}
+		if ok {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/share/") {
+			next.ServeHTTP(w, r)
+			return
 		}
 		http.Redirect(w, r, "/login", http.StatusFound)
 	})
 }
 
+// sessionUser returns the account behind the request's session cookie. The
+// shared -password login is an admin named "admin".
+func (s *server) sessionUser(r *http.Request) (store.User, bool) {
+	cookie, err := r.Cookie("session")
+	if err != nil {
+		return store.User{}, false
+	}
+	s.sessionsMu.RLock()
+	expiry, ok := s.sessions[cookie.Value]
+	userID := s.sessionUsers[cookie.Value]
+	s.sessionsMu.RUnlock()
+	if !ok || !time.Now().Before(expiry) {
+		return store.User{}, false
+	}
+	if userID == 0 {
+		return store.User{Username: "admin", Role: store.RoleAdmin}, true
+	}
+	user, err := s.store.GetUser(r.Context(), userID)
+	if err != nil {
+		return store.User{}, false // account deleted since sign-in
+	}
+	return user, true
+}
+
+// renderLogin shows the login form with an optional error message.
+func (s *server) renderLogin(w http.ResponseWriter, r *http.Request, msg string) {
+	render(w, "login.html", struct {
+		Error     string
+		OIDC      bool
+		CSRFToken string
+	}{msg, s.oidc != nil, csrfToken(r)})
+}
+
 func (s *server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
-	render(w, "login.html", nil)
+	s.renderLogin(w, r, "")
 }
 
+// handleLoginSubmit signs in with an account's username and password, or
+// with the shared -password when the username is left blank.
 func (s *server) handleLoginSubmit(w http.ResponseWriter, r *http.Request) {
+	username := strings.TrimSpace(r.FormValue("username"))
 	pw := r.FormValue("password")
-	if bcrypt.CompareHashAndPassword(s.passwordHash, []byte(pw)) != nil {
-		render(w, "login.html", "Wrong password.")
-		return
+	var userID int64
+	if username == "" {
+		if bcrypt.CompareHashAndPassword(s.passwordHash, []byte(pw)) != nil {
+			s.renderLogin(w, r, "Wrong password.")
+			return
+		}
+	} else {
+		user, hash, err := s.store.GetUserByName(r.Context(), username)
+		if err != nil || hash == "" || bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) != nil {
+			s.renderLogin(w, r, "Wrong username or password.")
+			return
+		}
+		userID = user.ID
 	}
+	s.startSession(w, r, userID, http.SameSiteStrictMode)
+}
+
+// startSession issues a session cookie for userID (0 for the shared
+// password) and redirects to the library.
+func (s *server) startSession(w http.ResponseWriter, r *http.Request, userID int64, sameSite http.SameSite) {
 	// Generate a session token.
 	raw := make([]byte, 32)
 	if _, err := rand.Read(raw); err != nil {
@@ -166,10 +287,20 @@ func (s *server) handleLoginSubmit(w http.ResponseWriter, r *http.Request) {
 	expiry := time.Now().Add(sessionTTL)
 	s.sessionsMu.Lock()
 	s.sessions[token] = expiry
+	if userID != 0 {
+		if s.sessionUsers == nil {
+			s.sessionUsers = make(map[string]int64)
+		}
+		s.sessionUsers[token] = userID
+	}
 	s.sessionsMu.Unlock()
 	// Persist session to DB so it survives a server restart.
 	if err := s.store.SaveSession(r.Context(), token, expiry); err != nil {
 		slog.Warn("persist session failed", "err", err)
+	} else if userID != 0 {
+		if err := s.store.SetSessionUser(r.Context(), token, userID); err != nil {
+			slog.Warn("persist session user failed", "err", err)
+		}
 	}
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session",
@@ -177,7 +308,7 @@ func (s *server) handleLoginSubmit(w http.ResponseWriter, r *http.Request) {
 		Path:     "/",
 		HttpOnly: true,
 		Secure:   s.secureCookies,
-		SameSite: http.SameSiteStrictMode,
+		SameSite: sameSite,
 	})
 	http.Redirect(w, r, "/", http.StatusFound)
 }
@@ -186,6 +317,7 @@ func (s *server) handleLogout(w http.ResponseWriter, r *http.Request) {
 	if cookie, err := r.Cookie("session"); err == nil {
 		s.sessionsMu.Lock()
 		delete(s.sessions, cookie.Value)
+		delete(s.sessionUsers, cookie.Value)
 		s.sessionsMu.Unlock()
 		_ = s.store.DeleteSession(r.Context(), cookie.Value)
 	}
@@ -197,7 +329,10 @@ func (s *server) routes() http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(s.corsMiddleware)
+	r.Use(s.csrfMiddleware)
 	r.Use(s.authMiddleware)
+	r.Use(s.maintenanceGate)
 
 	// Static assets (embedded so the binary works from any working directory)
 	staticSub, _ := fs.Sub(staticFS, "static")
@@ -206,66 +341,74 @@ func (s *server) routes() http.Handler {
 	r.Get("/login", s.handleLoginPage)
 	r.Post("/login", s.handleLoginSubmit)
 	r.Get("/logout", s.handleLogout)
+	r.Get("/login/oidc", s.handleOIDCLogin)
+	r.Get("/login/oidc/callback", s.handleOIDCCallback)
 
 	// Video file streaming, thumbnails, and SSE endpoints must NOT be wrapped
 	// by Compress.  The gzip middleware buffers output until the response ends,
 	// which prevents SSE events from being flushed incrementally to the client.
 	// Video Range requests and already-compressed JPEGs also benefit from
 	// bypassing gzip.
-	r.Get("/video/{id}", s.handleVideoFile)
+	r.With(s.requireStreamSig, s.requireQuota, s.meterStream, s.throttleStream).Get("/video/{id}", s.handleVideoFile)
 	r.Get("/videos/{id}/thumbnail", s.handleServeThumbnail)
+	r.Get("/videos/{id}/thumb", s.handleVideoThumb)
+	r.Get("/videos/{id}/storyboard", s.handleStoryboardStatus)
+	r.Get("/videos/{id}/storyboard.vtt", s.handleStoryboardVTT)
+	r.Get("/videos/{id}/storyboard/{sheet}", s.handleStoryboardSheet)
+	r.Get("/videos/{id}/preview", s.handleVideoPreview)
 	r.Get("/videos/{id}/subtitles", s.handleServeSubtitles)
+	r.Get("/videos/{id}/subtitles/{track}", s.handleEmbeddedSubtitles)
+	r.With(s.requireStreamSig, s.requireQuota).Get("/videos/{id}/stream", s.handleStreamVideo)
+	r.With(s.requireStreamSig, s.requireQuota).Get("/videos/{id}/audio", s.handleStreamAudio)
+	r.With(s.requireStreamSig, s.requireQuota, s.meterStream, s.throttleStream).Get("/videos/{id}/prepared", s.handlePreparedFile)
+	r.With(s.requireStreamSig, s.requireQuota).Get("/videos/{id}/hls.m3u8", s.handleHLSPlaylist)
+	r.With(s.requireStreamSig, s.requireQuota).Get("/hls/{session}/{segment}", s.handleHLSSegment)
+	r.With(s.requireSharePage, s.requireQuota, s.meterStream, s.throttleStream).Get("/share/{id}/video", s.handleVideoFile)
+	r.With(s.requireSharePage).Get("/share/{id}/poster", s.handleServeThumbnail)
 	r.Get("/ytdlp/job/{jobID}/events", s.handleYTDLPJobEvents)
 	r.Get("/videos/{id}/convert/events/{jobID}", s.handleConvertEvents)
 	r.Get("/videos/bulk-move/{jobID}/events", s.handleBulkMoveEvents)
+	r.Get("/events/stream", s.handleEventStream)
 
 	// All remaining routes use gzip compression (HTML/JSON responses).
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.Compress(5))
 
+		// Viewer routes: browsing, playback, rating and tagging.
 		r.Get("/", s.handleIndex)
 		r.Get("/info", s.handleInfo)
 
 		// Videos
 		r.Get("/videos", s.serveVideoList)
 		r.Get("/play/{id}", s.handlePlayer)
-		r.Put("/videos/{id}/name", s.handleUpdateVideoName)
-		r.Get("/videos/{id}/delete-confirm", s.handleVideoDeleteConfirm)
-		r.Delete("/videos/{id}", s.handleDeleteVideo)
-		r.Delete("/videos/{id}/file", s.handleDeleteVideoAndFile)
-		r.Post("/videos/{id}/relocate", s.handleRelocateVideo)
+		r.With(s.requireSharePage).Get("/share/{id}", s.handleSharePage)
+
+		// Playback negotiation (direct play vs. remux vs. transcode)
+		r.Post("/playback/decide", s.handlePlaybackDecide)
+		r.Delete("/hls/{session}", s.handleHLSStop)
+		r.Post("/videos/{id}/quality", s.handleSelectQuality)
+
+		// Profiles
+		r.Get("/profiles", s.handleListProfiles)
+		r.Post("/profiles/active", s.handleSelectProfile)
 
 		// Watch history
 		r.Post("/videos/{id}/progress", s.handlePostProgress)
 		r.Get("/videos/{id}/progress", s.handleGetProgress)
+		r.Get("/videos/continue", s.handleContinueWatching)
+		r.Get("/videos/favorites", s.handleFavorites)
 		r.Post("/videos/{id}/watched", s.handleMarkWatched)
 		r.Delete("/videos/{id}/progress", s.handleClearProgress)
-		r.Post("/videos/{id}/copy-to-library", s.handleCopyToLibrary)
-		r.Post("/videos/{id}/move", s.handleMoveVideo)
-		r.Post("/videos/bulk-move", s.handleBulkMoveVideos)
-		r.Post("/videos/{id}/rename", s.handleRenameVideo)
-		r.Post("/import/upload", s.handleImportUpload)
+		r.Get("/videos/batch-tags", s.handleBatchTagsForm)
+		r.Post("/videos/batch-tags", s.handleBatchTags)
 
 		// Rating
 		r.Post("/videos/{id}/rating", s.handleSetRating)
-		// Video Type
-		r.Post("/videos/{id}/type", s.handleSetVideoType)
+		r.Post("/videos/{id}/stars", s.handleSetStars)
+		r.Post("/videos/{id}/favorite", s.handleSetFavorite)
 		// Color label
 		r.Post("/videos/{id}/color", s.handleSetVideoColor)
 
-		// Export / convert
-		r.Post("/videos/{id}/export/usb", s.handleExportUSB)
-		r.Post("/videos/{id}/convert", s.handleConvertStart)
-
-		// yt-dlp download
-		r.Post("/ytdlp/download", s.handleYTDLPDownload)
-
-		// Metadata lookup (TMDB)
-		r.Get("/videos/{id}/lookup", s.handleLookupModal)
-		r.Post("/videos/{id}/lookup/search", s.handleLookupSearch)
-		r.Get("/videos/{id}/lookup/episodes", s.handleLookupEpisodes)
-		r.Post("/videos/{id}/lookup/apply", s.handleLookupApply)
-
 		// Quick label
 		r.Get("/videos/{id}/quick-label", s.handleQuickLabelModal)
 		r.Post("/videos/{id}/quick-label", s.handleQuickLabelSubmit)
@@ -273,80 +416,252 @@ func (s *server) routes() http.Handler {
 		// P2P share
 		r.Get("/videos/{id}/share", s.handleSharePanel)
 
-		// File metadata (ffprobe/ffmpeg)
+		// File metadata (ffprobe/ffmpeg) and descriptive fields, read-only
 		r.Get("/videos/{id}/metadata", s.handleGetMetadata)
-		r.Get("/videos/{id}/metadata/edit", s.handleEditMetadata)
-		r.Put("/videos/{id}/metadata", s.handleUpdateMetadata)
-
-		// Standardised descriptive fields (genre, season/episode, actors, studio, channel)
 		r.Get("/videos/{id}/fields", s.handleGetVideoFields)
-		r.Get("/videos/{id}/fields/edit", s.handleEditVideoFields)
-		r.Put("/videos/{id}/fields", s.handleUpdateVideoFields)
+		r.Get("/videos/{id}/chapters", s.handleVideoChapters)
+		r.Post("/videos/{id}/markers", s.handleSetSkipMarker)
+		r.Get("/videos/{id}/extras", s.handleVideoExtras)
+		r.Get("/videos/{id}/bookmarks", s.handleVideoBookmarks)
+		r.Post("/videos/{id}/bookmarks", s.handleAddBookmark)
+		r.Delete("/videos/{id}/bookmarks/{bookmarkID}", s.handleDeleteBookmark)
 
 		// Tags
 		r.Get("/videos/{id}/tags", s.handleVideoTags)
 		r.Post("/videos/{id}/tags", s.handleAddVideoTag)
 		r.Delete("/videos/{id}/tags/{tagID}", s.handleRemoveVideoTag)
 		r.Get("/tags", s.handleListTags)
+		r.Get("/tags/suggest", s.handleSuggestTags)
 
-		// Settings
-		r.Get("/settings", s.handleGetSettings)
-		r.Post("/settings", s.handleSaveSettings)
+		// Directory list (the sidebar and download folder picker)
+		r.Get("/directories", s.serveDirList)
+		r.Get("/directories/options", s.handleDirectoryOptions)
 
-		// Thumbnail generation (serving is outside this group — see above)
-		r.Post("/videos/{id}/thumbnail", s.handleGenerateThumbnail)
+		// Missing and upcoming episodes of a scraped show, for its group in the list
+		r.Get("/shows/missing", s.handleShowMissing)
+		r.Get("/shows/next", s.handleShowNext)
 
-		// Filesystem browser (used by folder picker in sidebar)
-		r.Get("/fs", s.handleBrowseFS)
+		// Library growth and rating summaries
+		r.Get("/stats", s.handleLibraryStats)
+		r.Get("/stats/growth", s.handleLibraryGrowth)
+		r.Get("/stats/ratings", s.handleRatingStats)
 
-		// Directories
-		r.Get("/directories", s.serveDirList)
-		r.Get("/directories/options", s.handleDirectoryOptions)
-		r.Post("/directories", s.handleAddDirectory)
-		r.Post("/directories/create", s.handleCreateDirectory)
-		r.Get("/directories/{id}/delete-confirm", s.handleDirectoryDeleteConfirm)
-		r.Post("/directories/{id}/sync", s.handleSyncDirectory)
-		r.Delete("/directories/{id}", s.handleDeleteDirectory)
-		r.Delete("/directories/{id}/files", s.handleDeleteDirectoryAndFiles)
-		r.Post("/directories/{id}/subfolder", s.handleCreateSubfolder)
-		r.Post("/directories/{id}/rename", s.handleRenameDirectory)
+		// Preferred audio and subtitle languages of the signed-in account
+		r.Get("/language-prefs", s.handleLanguagePrefs)
+		r.Put("/language-prefs", s.handleSetLanguagePrefs)
 
-		// Duplicate detection
-		r.Get("/duplicates", s.handleListDuplicates)
+		// Nightly report opt-in of the signed-in account
+		r.Get("/report", s.handleReportPrefs)
+		r.Put("/report", s.handleSetReportPrefs)
+		r.Get("/report/preview", s.handleReportPreview)
 
-		// Video trimming (temporal crop)
-		r.Post("/videos/{id}/trim", s.handleTrim)
+		// The activity log: everything published to the event bus
+		r.Get("/activity", s.handleActivity)
+		r.Get("/events/feed.rss", s.handleEventFeed)
 
-		// Watermark removal (delogo)
-		r.Post("/videos/{id}/delogo", s.handleDelogo)
+		// Notifications of finished downloads, exports and scans
+		r.Get("/notifications", s.handleNotifications)
+		r.Get("/notifications/badge", s.handleNotificationBadge)
+		r.Post("/notifications/read", s.handleMarkAllNotificationsRead)
+		r.Post("/notifications/{id}/read", s.handleMarkNotificationRead)
 
 		// Random video ID (for initial tab load)
 		r.Get("/random-video", s.handleRandomVideoID)
+		r.Post("/random-video", s.handleRandomVideoID)
+
+		// The unwatched pile, oldest first, for other players
+		r.Get("/backlog.m3u", s.handleBacklogM3U)
+
+		// Smart playlists: saved library filters
+		r.Get("/smart-playlists/options", s.handleSmartPlaylistOptions)
+		r.Get("/smart-playlists/{id}/videos", s.handleSmartPlaylistVideos)
 
-		// Next unwatched video
+		// Next unwatched video, and the one to autoplay after a video
 		r.Get("/videos/next-unwatched", s.handleNextUnwatched)
+		r.Get("/videos/{id}/next", s.handleNextEpisode)
+
+		// Shuffle play queue
+		r.Post("/queue/shuffle", s.handleShuffleQueue)
+		r.Get("/queue/next", s.handleQueueNext)
 
 		// ── JSON API (Roku / external clients) ──────────────────────────
 		r.Get("/api/videos", s.handleAPIListVideos)
 		r.Get("/api/videos/{id}", s.handleAPIGetVideo)
+		r.Get("/api/videos/{id}/markers", s.handleAPIVideoMarkers)
+		r.Get("/api/videos/{id}/audio-tracks", s.handleAPIAudioTracks)
+		r.Get("/api/external-ids/{provider}/{externalID}", s.handleAPIFindByExternalID)
 		r.Get("/api/random", s.handleAPIRandom)
 		r.Get("/api/shows", s.handleAPIListShows)
+		r.Get("/api/shows/{show}/poster", s.handleAPIShowPoster)
+		r.Get("/api/shows/{show}/missing", s.handleAPIShowMissing)
 		r.Get("/api/shows/{show}/seasons", s.handleAPIListSeasons)
 		r.Get("/api/shows/{show}/seasons/{season}/episodes", s.handleAPIListEpisodes)
+		r.Get("/api/shows/{show}/watch-order", s.handleAPIShowWatchOrder)
+		r.Get("/api/watch-orders", s.handleAPIListWatchOrders)
+		r.Get("/api/watch-orders/{id}", s.handleAPIGetWatchOrder)
+		r.Get("/api/backlog", s.handleAPIBacklog)
+		r.Get("/api/smart-playlists", s.handleAPIListSmartPlaylists)
+		r.Get("/api/smart-playlists/{id}", s.handleAPIGetSmartPlaylist)
+		r.Get("/api/quality-presets", s.handleAPIListQualityPresets)
 		r.Get("/api/tags", s.handleAPIListTags)
 		r.Get("/api/tags/{id}/videos", s.handleAPITagVideos)
 		r.Get("/api/recently-watched", s.handleAPIRecentlyWatched)
+		r.Get("/api/notifications", s.handleAPINotifications)
+		r.Get("/api/events", s.handleAPIEvents)
+		r.Get("/api/quota", s.handleAPIQuota)
 		r.Get("/api/directories", s.handleAPIDirectories)
+		r.Get("/api/stats", s.handleAPILibraryStats)
+		r.Get("/api/stats/growth", s.handleAPILibraryGrowth)
+		r.Get("/api/stats/ratings", s.handleAPIRatingStats)
 
 		// Folder background images
 		r.Get("/api/folder-backgrounds", s.handleGetFolderBackgrounds)
-		r.Post("/api/folder-background", s.handleSetFolderBackground)
 		r.Get("/api/serve-image", s.handleServeImage)
 
 		// Roku cast — web UI posts a video to play; Roku polls and consumes it.
 		r.Post("/roku/cast/{id}", s.handleRokuCast)
 		r.Get("/roku/poll", s.handleRokuPoll)
 		r.Get("/roku/connected", s.handleRokuConnected)
+
+		// Admin routes: library management, files, settings and jobs.
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireAdmin)
+
+			// Videos
+			r.Put("/videos/{id}/name", s.handleUpdateVideoName)
+			r.Get("/videos/{id}/delete-confirm", s.handleVideoDeleteConfirm)
+			r.Delete("/videos/{id}", s.handleDeleteVideo)
+			r.Delete("/videos/{id}/file", s.handleDeleteVideoAndFile)
+			r.Post("/videos/{id}/relocate", s.handleRelocateVideo)
+			r.Post("/videos/{id}/copy-to-library", s.handleCopyToLibrary)
+			r.Post("/videos/{id}/move", s.handleMoveVideo)
+			r.Post("/videos/bulk-move", s.handleBulkMoveVideos)
+			r.Post("/videos/{id}/rename", s.handleRenameVideo)
+			r.Post("/import/upload", s.handleImportUpload)
+
+			// Extras
+			r.Post("/videos/{id}/extras", s.handleAddExtra)
+			r.Delete("/extras/{id}", s.handleUnlinkExtra)
+
+			// Profiles
+			r.Post("/profiles", s.handleCreateProfile)
+			r.Put("/profiles/{id}/landing", s.handleSetProfileLanding)
+			r.Put("/profiles/{id}/quota", s.handleSetProfileQuota)
+			r.Post("/profiles/{id}/quota/grant", s.handleGrantProfileTime)
+			r.Delete("/profiles/{id}", s.handleDeleteProfile)
+
+			// Users
+			r.Get("/users", s.handleListUsers)
+			r.Post("/users", s.handleCreateUser)
+			r.Put("/users/{id}/role", s.handleSetUserRole)
+			r.Put("/users/{id}/password", s.handleSetUserPassword)
+			r.Delete("/users/{id}", s.handleDeleteUser)
+
+			// Crossover watch orders
+			r.Get("/watch-orders", s.handleListWatchOrders)
+			r.Post("/watch-orders", s.handleUploadWatchOrder)
+			r.Delete("/watch-orders/{id}", s.handleDeleteWatchOrder)
+
+			// Smart playlists
+			r.Get("/smart-playlists", s.handleListSmartPlaylists)
+			r.Post("/smart-playlists", s.handleSaveSmartPlaylist)
+			r.Delete("/smart-playlists/{id}", s.handleDeleteSmartPlaylist)
+
+			// Archive policies for videos left unwatched
+			r.Get("/archive", s.handleArchive)
+			r.Post("/archive/policies", s.handleSaveArchivePolicy)
+			r.Delete("/archive/policies/{id}", s.handleDeleteArchivePolicy)
+			r.Post("/archive/check", s.handleCheckArchive)
+			r.Post("/archive/proposals/approve", s.handleApproveAllArchive)
+			r.Post("/archive/proposals/{id}/approve", s.handleApproveArchive)
+			r.Post("/archive/proposals/{id}/dismiss", s.handleDismissArchive)
+
+			// Playback quality presets
+			r.Get("/quality-presets", s.handleListQualityPresets)
+			r.Post("/quality-presets", s.handleCreateQualityPreset)
+			r.Delete("/quality-presets/{id}", s.handleDeleteQualityPreset)
+
+			// Tag management
+			r.Get("/tags/manage", s.handleTagManager)
+			r.Put("/tags/{id}", s.handleUpdateTag)
+			r.Post("/tags/{id}/merge", s.handleMergeTag)
+			r.Get("/tags/{id}/delete-confirm", s.handleTagDeleteConfirm)
+			r.Delete("/tags/{id}", s.handleDeleteTag)
+
+			// Tags and ratings from filename conventions
+			r.Get("/filename-import", s.handleFilenameImport)
+			r.Put("/filename-import/rules", s.handleSaveFilenameRules)
+			r.Get("/filename-import/preview", s.handleFilenameImportPreview)
+			r.Post("/filename-import", s.handleRunFilenameImport)
+
+			// Video Type
+			r.Post("/videos/{id}/type", s.handleSetVideoType)
+
+			// Export / convert
+			r.Post("/videos/{id}/export/usb", s.handleExportUSB)
+			r.Post("/videos/{id}/convert", s.handleConvertStart)
+
+			// yt-dlp download
+			r.Post("/ytdlp/download", s.handleYTDLPDownload)
+			r.Post("/videos/{id}/redownload", s.handleRedownloadVideo)
+
+			// Metadata lookup (TMDB)
+			r.Get("/videos/{id}/lookup", s.handleLookupModal)
+			r.Post("/videos/{id}/lookup/search", s.handleLookupSearch)
+			r.Get("/videos/{id}/lookup/episodes", s.handleLookupEpisodes)
+			r.Post("/videos/{id}/lookup/apply", s.handleLookupApply)
+
+			// File metadata and descriptive fields, editing
+			r.Get("/videos/{id}/metadata/edit", s.handleEditMetadata)
+			r.Put("/videos/{id}/metadata", s.handleUpdateMetadata)
+			r.Get("/videos/{id}/fields/edit", s.handleEditVideoFields)
+			r.Put("/videos/{id}/fields", s.handleUpdateVideoFields)
+			r.Put("/videos/{id}/external-ids", s.handleSetExternalIDs)
+
+			// Settings
+			r.Get("/settings", s.handleGetSettings)
+			r.Post("/settings", s.handleSaveSettings)
+			r.Get("/settings/export", s.handleExportConfig)
+			r.Post("/settings/import", s.handleImportConfig)
+
+			// Thumbnail generation (serving is outside this group — see above)
+			r.Post("/videos/{id}/thumbnail", s.handleGenerateThumbnail)
+			r.Put("/videos/{id}/thumbnail", s.handleSetPoster)
+
+			// Filesystem browser (used by folder picker in sidebar)
+			r.Get("/fs", s.handleBrowseFS)
+
+			// Directories
+			r.Get("/directories/preview", s.handlePreviewDirectory)
+			r.Post("/directories", s.handleAddDirectory)
+			r.Post("/directories/create", s.handleCreateDirectory)
+			r.Get("/directories/{id}/delete-confirm", s.handleDirectoryDeleteConfirm)
+			r.Post("/directories/{id}/sync", s.handleSyncDirectory)
+			r.Delete("/directories/{id}", s.handleDeleteDirectory)
+			r.Delete("/directories/{id}/files", s.handleDeleteDirectoryAndFiles)
+			r.Post("/directories/{id}/subfolder", s.handleCreateSubfolder)
+			r.Post("/directories/{id}/rename", s.handleRenameDirectory)
+			r.Post("/directories/{id}/scan-options", s.handleSetDirectoryScanOptions)
+			r.Put("/directories/{id}/label", s.handleSetDirectoryLabel)
+			r.Put("/directories/{id}/budget", s.handleSetDirectoryBudget)
+
+			// Duplicate detection
+			r.Get("/duplicates", s.handleListDuplicates)
+
+			// Maintenance
+			r.Post("/maintenance/prune", s.handleMaintenancePrune)
+			r.Get("/maintenance", s.handleMaintenanceStatus)
+			r.Put("/maintenance", s.handleSetMaintenance)
+
+			// Video trimming (temporal crop)
+			r.Post("/videos/{id}/trim", s.handleTrim)
+
+			// Watermark removal (delogo)
+			r.Post("/videos/{id}/delogo", s.handleDelogo)
+
+			// Folder background images
+			r.Post("/api/folder-background", s.handleSetFolderBackground)
+		})
 	})
 
 	return r
@@ -366,6 +681,7 @@ func (s *server) startSessionPruner(ctx context.Context) {
 			for tok, exp := range s.sessions {
 				if now.After(exp) {
 					delete(s.sessions, tok)
+					delete(s.sessionUsers, tok)
 				}
 			}
 			s.sessionsMu.Unlock()
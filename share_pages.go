@@ -0,0 +1,89 @@
+// share_pages.go – public player pages for share links.
+//
+// With the "share_pages" setting on, the share panel also offers a link to
+// /share/{id}: a bare page with the video's poster, title and a video tag,
+// rendered on the server with Open Graph tags so chat apps show a preview,
+// and none of the library around it. Anyone holding the link can watch
+// without signing in, so the page and the media it loads are always signed,
+// whatever the signed_streams setting says, and stop working after
+// streamSigTTL or a restart.
+//
+// GET /share/{id}         – the player page (?t= starts that many seconds in)
+// GET /share/{id}/video   – the file
+// GET /share/{id}/poster  – the poster frame
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// sharePagesEnabled reports whether share links may open a public page.
+func (s *server) sharePagesEnabled(ctx context.Context) bool {
+	v, _ := s.store.GetSetting(ctx, "share_pages")
+	return v == "true"
+}
+
+// sharePageURL returns a signed link to video id's public page.
+func (s *server) sharePageURL(id int64) string {
+	return s.signURL(fmt.Sprintf("/share/%d", id), time.Now().Add(streamSigTTL).Unix())
+}
+
+// requireSharePage answers the /share routes only while share_pages is on
+// and only with a valid signature. They skip sign-in, so this is all that
+// stands between them and anyone on the network.
+func (s *server) requireSharePage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.sharePagesEnabled(r.Context()) {
+			http.NotFound(w, r)
+			return
+		}
+		if !s.validStreamSig(r) {
+			http.Error(w, "share link is invalid or expired — ask for a new one", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GET /share/{id} signs the video and poster URLs to expire with the page's
+// own link. Open Graph needs absolute URLs, which are built from the Host
+// the link was opened with.
+func (s *server) handleSharePage(w http.ResponseWriter, r *http.Request) {
+	video, ok := s.videoOrError(w, r)
+	if !ok {
+		return
+	}
+	expStr, _, _ := strings.Cut(r.URL.Query().Get("sig"), ".")
+	exp, _ := strconv.ParseInt(expStr, 10, 64)
+	base := "http://" + r.Host
+	if r.TLS != nil {
+		base = "https://" + r.Host
+	}
+	page := fmt.Sprintf("/share/%d", video.ID)
+	data := struct {
+		Video     store.Video
+		PageURL   string
+		VideoURL  string
+		PosterURL string
+		Start     float64
+	}{
+		Video:    video,
+		PageURL:  base + s.signURL(page, exp),
+		VideoURL: base + s.signURL(page+"/video", exp),
+	}
+	if video.ThumbnailPath != "" {
+		data.PosterURL = base + s.signURL(page+"/poster", exp)
+	}
+	if t, err := strconv.ParseFloat(r.URL.Query().Get("t"), 64); err == nil && t > 0 && !math.IsInf(t, 0) {
+		data.Start = t
+	}
+	render(w, "share_page.html", data)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSharePage(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("fake video content"), 0644) //nolint:errcheck
+	thumb := filepath.Join(dir, "film.jpg")
+	os.WriteFile(thumb, []byte("fake jpeg"), 0644) //nolint:errcheck
+	srv := newTestServerWithAuth(t, "secret")
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	srv.store.UpdateVideoName(ctx, v.ID, "Beach Day <2024>") //nolint:errcheck
+	srv.store.UpdateVideoThumbnail(ctx, v.ID, thumb)         //nolint:errcheck
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	link := srv.sharePageURL(v.ID)
+	if rec := get(link); rec.Code != http.StatusNotFound {
+		t.Errorf("setting off: expected 404, got %d", rec.Code)
+	}
+
+	srv.store.SaveSettings(ctx, map[string]string{"share_pages": "true"}) //nolint:errcheck
+	if rec := get("/share/" + itoa(v.ID)); rec.Code != http.StatusForbidden {
+		t.Errorf("unsigned: expected 403, got %d", rec.Code)
+	}
+	if rec := get(strings.Replace(link, "/share/"+itoa(v.ID), "/share/"+itoa(v.ID+1), 1)); rec.Code != http.StatusForbidden {
+		t.Errorf("signature for another video: expected 403, got %d", rec.Code)
+	}
+
+	rec := get(link + "&t=90")
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "<h1>Beach Day &lt;2024&gt;</h1>") || strings.Contains(body, "hx-") {
+		t.Fatalf("page without sign-in: got %d: %s", rec.Code, body)
+	}
+	for _, want := range []string{`property="og:title"`, `property="og:image" content="http://example.com/share/`, "#t=90"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+	media := regexp.MustCompile(`(?:src|poster)="http://example\.com([^"#]+)`).FindAllStringSubmatch(body, -1)
+	if len(media) != 2 {
+		t.Fatalf("expected signed video and poster URLs, got %v", media)
+	}
+	for _, m := range media {
+		if rec := get(strings.ReplaceAll(m[1], "&amp;", "&")); rec.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", m[1], rec.Code)
+		}
+	}
+	if rec := get("/video/" + itoa(v.ID)); rec.Code != http.StatusFound {
+		t.Errorf("the library's own stream route should still need sign-in, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedStreams(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "film.mp4"), []byte("fake video content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	path := "/video/" + itoa(v.ID)
+
+	get := func(target string) int {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code
+	}
+	if code := get(path); code != http.StatusOK {
+		t.Fatalf("setting off: expected 200, got %d", code)
+	}
+
+	srv.store.SaveSettings(ctx, map[string]string{"signed_streams": "true"}) //nolint:errcheck
+	if code := get(path); code != http.StatusForbidden {
+		t.Errorf("unsigned: expected 403, got %d", code)
+	}
+	signed := srv.streamSigner(ctx)(path)
+	if code := get(signed); code != http.StatusOK {
+		t.Errorf("signed: expected 200, got %d", code)
+	}
+	if code := get(strings.Replace(signed, path, "/video/"+itoa(v.ID+1), 1)); code != http.StatusForbidden {
+		t.Errorf("signature for another video: expected 403, got %d", code)
+	}
+	past := time.Now().Add(-time.Minute).Unix()
+	expired := path + "?sig=" + strconv.FormatInt(past, 10) + "." + srv.streamMAC(path, past)
+	if code := get(expired); code != http.StatusForbidden {
+		t.Errorf("expired: expected 403, got %d", code)
+	}
+
+	var got apiVideo
+	apiGet(t, srv, "/api/videos/"+itoa(v.ID), &got)
+	if !strings.HasPrefix(got.StreamURL, path+"?sig=") || get(got.StreamURL) != http.StatusOK {
+		t.Errorf("API stream URL %q is not a working signed link", got.StreamURL)
+	}
+}
+
+func TestHLSPlaylist_Signed(t *testing.T) {
+	pl := hlsPlaylist("abc", 14, 6, func(u string) string { return u + "?sig=x" })
+	if !strings.Contains(pl, "/hls/abc/0.ts?sig=x\n") {
+		t.Errorf("segment URLs are not signed:\n%s", pl)
+	}
+}
@@ -0,0 +1,94 @@
+// sponsorblock.go – SponsorBlock segments for downloaded YouTube videos.
+//
+// SponsorBlock (https://sponsor.ajay.app) is a crowd-sourced database of
+// sponsor reads, intros and other skippable segments keyed by YouTube video
+// ID. Segments are stored as skip markers and served by the markers API.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+const (
+	sponsorBlockTimeout = 10 * time.Second
+	sponsorBlockSource  = "sponsorblock" // store.Marker.Source for these markers
+)
+
+var (
+	// sponsorBlockAPI is a variable so tests can point it at a fake server.
+	sponsorBlockAPI    = "https://sponsor.ajay.app/api"
+	sponsorBlockClient = &http.Client{Timeout: sponsorBlockTimeout}
+)
+
+// sponsorBlockCategories are the segment categories fetched as skip markers.
+var sponsorBlockCategories = []string{
+	"sponsor", "selfpromo", "interaction", "intro", "outro", "preview", "music_offtopic",
+}
+
+// fetchSponsorSegments returns the skip segments SponsorBlock knows for a
+// YouTube video ID. A video without segments yields no markers and no error.
+func fetchSponsorSegments(ctx context.Context, youtubeID string) ([]store.Marker, error) {
+	cats, _ := json.Marshal(sponsorBlockCategories)
+	q := url.Values{"videoID": {youtubeID}, "categories": {string(cats)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sponsorBlockAPI+"/skipSegments?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := sponsorBlockClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil // no segments submitted for this video
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SponsorBlock API error: %s", resp.Status)
+	}
+	var segments []struct {
+		Segment    [2]float64 `json:"segment"`
+		Category   string     `json:"category"`
+		ActionType string     `json:"actionType"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&segments); err != nil {
+		return nil, err
+	}
+	var markers []store.Marker
+	for _, seg := range segments {
+		if seg.ActionType != "" && seg.ActionType != "skip" {
+			continue // mute/full-video/highlight segments are not skips
+		}
+		if seg.Segment[1] <= seg.Segment[0] {
+			continue
+		}
+		markers = append(markers, store.Marker{
+			Kind:  store.MarkerSkip,
+			Start: seg.Segment[0],
+			End:   seg.Segment[1],
+			Label: seg.Category,
+		})
+	}
+	return markers, nil
+}
+
+// refreshSponsorBlock replaces the video's SponsorBlock markers with the
+// current segments. Videos without a YouTube ID are left alone.
+func (s *server) refreshSponsorBlock(ctx context.Context, videoID int64) (int, error) {
+	ids, err := s.store.ListVideoExternalIDs(ctx, videoID)
+	if err != nil || ids[store.ExternalYouTube] == "" {
+		return 0, err
+	}
+	markers, err := fetchSponsorSegments(ctx, ids[store.ExternalYouTube])
+	if err != nil {
+		return 0, err
+	}
+	return len(markers), s.store.SetVideoMarkers(ctx, videoID, sponsorBlockSource, markers)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// fakeSponsorBlock points the SponsorBlock client at handler for one test.
+func fakeSponsorBlock(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	orig := sponsorBlockAPI
+	sponsorBlockAPI = ts.URL
+	t.Cleanup(func() { sponsorBlockAPI = orig })
+}
+
+func TestFetchSponsorSegments(t *testing.T) {
+	fakeSponsorBlock(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/skipSegments" || r.URL.Query().Get("videoID") != "abc" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[
+			{"segment":[10.5,40],"category":"sponsor","actionType":"skip"},
+			{"segment":[100,120],"category":"music_offtopic","actionType":"mute"},
+			{"segment":[200,200],"category":"outro","actionType":"skip"}
+		]`)) //nolint:errcheck
+	})
+	markers, err := fetchSponsorSegments(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("fetchSponsorSegments: %v", err)
+	}
+	if len(markers) != 1 || markers[0].Start != 10.5 || markers[0].End != 40 ||
+		markers[0].Kind != store.MarkerSkip || markers[0].Label != "sponsor" {
+		t.Errorf("unexpected markers: %+v", markers)
+	}
+
+	// SponsorBlock answers 404 when a video has no segments.
+	if markers, err := fetchSponsorSegments(context.Background(), "none"); err != nil || markers != nil {
+		t.Errorf("expected no markers and no error, got %v, %v", markers, err)
+	}
+}
+
+func TestRefreshSponsorBlock(t *testing.T) {
+	fakeSponsorBlock(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"segment":[1,2],"category":"intro","actionType":"skip"}]`)) //nolint:errcheck
+	})
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	yt, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "yt.mp4")
+	vimeo, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "vimeo.mp4")
+	srv.store.SetVideoSource(ctx, yt.ID, store.VideoSource{Extractor: "youtube", ID: "abc"})  //nolint:errcheck
+	srv.store.SetVideoSource(ctx, vimeo.ID, store.VideoSource{Extractor: "vimeo", ID: "123"}) //nolint:errcheck
+
+	if n, err := srv.refreshSponsorBlock(ctx, yt.ID); err != nil || n != 1 {
+		t.Fatalf("refreshSponsorBlock(youtube) = %d, %v", n, err)
+	}
+	if markers, _ := srv.store.ListVideoMarkers(ctx, yt.ID); len(markers) != 1 || markers[0].Source != sponsorBlockSource {
+		t.Errorf("unexpected markers: %+v", markers)
+	}
+	if n, _ := srv.refreshSponsorBlock(ctx, vimeo.ID); n != 0 {
+		t.Error("non-YouTube videos should not be looked up")
+	}
+}
@@ -116,6 +116,13 @@ function msBulkTag() {
   next();
 }
 
+// msBatchTags opens the tag matrix for the selected videos.
+function msBatchTags() {
+  if (!_msIDs.size) return;
+  htmx.ajax('GET', '/videos/batch-tags?ids=' + Array.from(_msIDs).join(','),
+    {target: '#quick-label-modal', swap: 'innerHTML'});
+}
+
 // ── Context menu ──────────────────────────────────────────────────────
 
 var _ctx = {id: null, dirID: null, filename: null, dirPath: null};
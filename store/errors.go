@@ -0,0 +1,46 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Errors a Store returns for records that are missing or clash, so callers
+// can answer with a fitting status instead of the database's own message.
+// Test for them with errors.Is; the driver's error stays wrapped for logs.
+var (
+	// ErrNotFound means the record asked for, or the one to change, does
+	// not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means a record with the same unique key already exists,
+	// e.g. a second directory with one path.
+	ErrConflict = errors.New("already exists")
+	// ErrForeignKey means a write refers to a record that does not exist,
+	// e.g. tagging a deleted video.
+	ErrForeignKey = errors.New("refers to a missing record")
+)
+
+// dbError translates database/sql and SQLite errors into the errors above,
+// passing any other error through.
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	var se *sqlite.Error
+	if errors.As(err, &se) {
+		switch se.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return fmt.Errorf("%w: %w", ErrForeignKey, err)
+		}
+	}
+	return err
+}
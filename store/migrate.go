@@ -54,6 +54,12 @@ func runMigrations(conn *sql.DB) error {
 				return fmt.Errorf("migrate013Actors hook: %w", err)
 			}
 		}
+		// 040 canonicalises recorded paths, which needs the file system.
+		if strings.HasPrefix(ver, "040_") {
+			if err := migrate040CanonicalPaths(context.Background(), conn); err != nil {
+				return fmt.Errorf("migrate040CanonicalPaths hook: %w", err)
+			}
+		}
 
 		tx, err := conn.Begin()
 		if err != nil {
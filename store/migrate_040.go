@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// migrate040CanonicalPaths rewrites the recorded directory and video paths
+// in canonical form. A row whose canonical path is already taken by another
+// is left as it is, and so is a relative path, which cannot be resolved.
+func migrate040CanonicalPaths(ctx context.Context, conn *sql.DB) error {
+	rows, err := conn.QueryContext(ctx, `SELECT id, path FROM directories`)
+	if err != nil {
+		return err
+	}
+	roots := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			rows.Close()
+			return err
+		}
+		roots[id] = path
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, path := range roots {
+		canon, err := CanonicalPath(path)
+		if err != nil || canon == path {
+			continue
+		}
+		res, err := conn.ExecContext(ctx, `UPDATE OR IGNORE directories SET path = ? WHERE id = ?`, canon, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			roots[id] = canon
+		}
+	}
+
+	rows, err = conn.QueryContext(ctx, `SELECT id, directory_id, directory_path FROM videos`)
+	if err != nil {
+		return err
+	}
+	type video struct {
+		id    int64
+		dirID sql.NullInt64
+		path  string
+	}
+	var videos []video
+	for rows.Next() {
+		var v video
+		if err := rows.Scan(&v.id, &v.dirID, &v.path); err != nil {
+			rows.Close()
+			return err
+		}
+		videos = append(videos, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, v := range videos {
+		canon, err := canonicalVideoDir(roots[v.dirID.Int64], v.path)
+		if err != nil || canon == v.path {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, `UPDATE OR IGNORE videos SET directory_path = ? WHERE id = ?`, canon, v.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
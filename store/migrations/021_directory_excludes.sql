@@ -0,0 +1,3 @@
+-- Newline-separated glob patterns that syncDir skips for this directory
+-- (e.g. "*.sample.*", "extras/**").
+ALTER TABLE directories ADD COLUMN exclude_patterns TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Maximum number of folder levels below the directory root that syncDir
+-- descends into; 0 means unlimited.
+ALTER TABLE directories ADD COLUMN max_depth INTEGER NOT NULL DEFAULT 0;
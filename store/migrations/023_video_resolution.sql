@@ -0,0 +1,4 @@
+-- Pixel dimensions of the first video stream, filled in by syncDir via
+-- ffprobe. 0 = unknown.
+ALTER TABLE videos ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Comma-separated fields shown on library list cards. The default keeps the
+-- original rating and watched indicators.
+INSERT OR IGNORE INTO settings (key, value) VALUES ('card_fields', 'rating,watched');
@@ -0,0 +1,3 @@
+-- Parent directory for entries registered as immediate subdirectories of
+-- another registered directory (e.g. one entry per season folder of a show).
+ALTER TABLE directories ADD COLUMN parent_id INTEGER REFERENCES directories(id) ON DELETE SET NULL;
@@ -0,0 +1,6 @@
+-- When each tag was last applied by hand, so the tag widget can offer the
+-- most recently used tags as one-click chips.
+CREATE TABLE IF NOT EXISTS recent_tags (
+    tag_id  INTEGER PRIMARY KEY REFERENCES tags(id) ON DELETE CASCADE,
+    used_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
@@ -0,0 +1,8 @@
+-- Companion files found next to a video during sync (subtitles, .nfo,
+-- artwork sharing the video's basename). Rewritten on every sync.
+CREATE TABLE IF NOT EXISTS video_sidecars (
+    video_id INTEGER NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    kind     TEXT    NOT NULL,
+    path     TEXT    NOT NULL,
+    PRIMARY KEY (video_id, path)
+);
@@ -0,0 +1,2 @@
+-- Whether syncDir descends into symlinked folders (with loop detection).
+ALTER TABLE directories ADD COLUMN follow_symlinks INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- File size (bytes) and modification time (Unix nanoseconds) seen at the
+-- last sync; 0 until first recorded. A change means cached metadata such as
+-- duration, resolution and the generated thumbnail is stale.
+ALTER TABLE videos ADD COLUMN file_size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN file_mtime INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+-- Viewer profiles. Each device picks one; its landing filter decides what
+-- the library shows when the app opens (e.g. only "kids", newest first).
+CREATE TABLE IF NOT EXISTS profiles (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    name           TEXT    NOT NULL UNIQUE,
+    landing_tag_id INTEGER REFERENCES tags(id) ON DELETE SET NULL,
+    landing_sort   TEXT    NOT NULL DEFAULT ''
+);
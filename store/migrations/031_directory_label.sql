@@ -0,0 +1,3 @@
+-- Optional display label for a directory, shown instead of its path and used
+-- as the auto-tag name. Empty means "use the folder name".
+ALTER TABLE directories ADD COLUMN label TEXT NOT NULL DEFAULT '';
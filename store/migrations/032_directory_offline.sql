@@ -0,0 +1,3 @@
+-- Set while a directory's folder is unreachable (e.g. an unplugged external
+-- drive). Offline videos are kept but skipped by random play.
+ALTER TABLE directories ADD COLUMN offline INTEGER NOT NULL DEFAULT 0;
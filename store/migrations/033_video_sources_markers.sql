@@ -0,0 +1,20 @@
+-- Where a downloaded video came from (yt-dlp extractor and the site's own
+-- video ID), so site-specific services such as SponsorBlock can be queried.
+CREATE TABLE IF NOT EXISTS video_sources (
+    video_id  INTEGER PRIMARY KEY REFERENCES videos(id) ON DELETE CASCADE,
+    extractor TEXT    NOT NULL,
+    source_id TEXT    NOT NULL
+);
+
+-- Time ranges within a video, e.g. sponsor segments players should skip.
+-- source names who created the marker so a refresh replaces only its own.
+CREATE TABLE IF NOT EXISTS video_markers (
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    video_id INTEGER NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    kind     TEXT    NOT NULL,
+    start_s  REAL    NOT NULL,
+    end_s    REAL    NOT NULL,
+    label    TEXT    NOT NULL DEFAULT '',
+    source   TEXT    NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_video_markers_video ON video_markers(video_id, start_s);
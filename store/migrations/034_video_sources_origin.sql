@@ -0,0 +1,4 @@
+-- Where a download can be fetched again from, and who published it.
+ALTER TABLE video_sources ADD COLUMN url         TEXT NOT NULL DEFAULT '';
+ALTER TABLE video_sources ADD COLUMN uploader    TEXT NOT NULL DEFAULT '';
+ALTER TABLE video_sources ADD COLUMN upload_date TEXT NOT NULL DEFAULT '';
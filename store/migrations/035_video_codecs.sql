@@ -0,0 +1,8 @@
+-- Codecs of a video's first video and audio streams, cached from ffprobe so
+-- the player can choose direct play or transcode without probing each time.
+-- Empty strings mean unknown (not yet probed, or reset after a file change).
+CREATE TABLE IF NOT EXISTS video_codecs (
+    video_id    INTEGER PRIMARY KEY REFERENCES videos(id) ON DELETE CASCADE,
+    video_codec TEXT    NOT NULL DEFAULT '',
+    audio_codec TEXT    NOT NULL DEFAULT ''
+);
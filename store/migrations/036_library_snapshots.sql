@@ -0,0 +1,10 @@
+-- Daily per-directory library size, for charting growth over time.
+-- directory_id is deliberately not a foreign key: removing a directory
+-- must not rewrite the history of what the library used to hold.
+CREATE TABLE IF NOT EXISTS library_snapshots (
+    day          TEXT    NOT NULL, -- YYYY-MM-DD
+    directory_id INTEGER NOT NULL,
+    video_count  INTEGER NOT NULL,
+    total_bytes  INTEGER NOT NULL,
+    PRIMARY KEY (day, directory_id)
+);
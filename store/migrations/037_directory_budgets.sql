@@ -0,0 +1,4 @@
+-- Storage budgets. Exceeding budget_bytes raises a warning; downloads into
+-- a directory at or over cap_bytes are refused. 0 means no limit.
+ALTER TABLE directories ADD COLUMN budget_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE directories ADD COLUMN cap_bytes INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,14 @@
+-- Named accounts with a role. Admins manage directories, settings, files
+-- and jobs; viewers browse, play, rate and tag. password_hash is empty for
+-- accounts that only sign in through an external identity provider.
+CREATE TABLE IF NOT EXISTS users (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    username      TEXT    NOT NULL UNIQUE COLLATE NOCASE,
+    password_hash TEXT    NOT NULL DEFAULT '',
+    role          TEXT    NOT NULL DEFAULT 'viewer' CHECK (role IN ('admin', 'viewer')),
+    created_at    TEXT    NOT NULL DEFAULT (datetime('now'))
+);
+
+-- The account a session belongs to; NULL for the shared -password login,
+-- which acts as an admin.
+ALTER TABLE sessions ADD COLUMN user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
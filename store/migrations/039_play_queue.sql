@@ -0,0 +1,8 @@
+-- The shuffle play queue: a randomised order of videos handed out one at a
+-- time. played marks the entries already handed out; once all are played
+-- the same set is reshuffled for another round.
+CREATE TABLE IF NOT EXISTS play_queue (
+    position INTEGER PRIMARY KEY,
+    video_id INTEGER NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    played   INTEGER NOT NULL DEFAULT 0
+);
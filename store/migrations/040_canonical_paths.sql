@@ -0,0 +1,4 @@
+-- Directory and video paths are recorded in canonical form (absolute,
+-- cleaned, symlinks resolved). Existing rows are rewritten by the Go
+-- migration hook (migrate_040.go), as SQLite cannot resolve symlinks.
+SELECT 1;
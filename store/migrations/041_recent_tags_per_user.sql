@@ -0,0 +1,13 @@
+-- Recently applied tags are kept per account, so each user's quick-apply
+-- chips reflect their own tagging. user_id 0 stands for signing in with the
+-- shared -password, or for no sign-in at all; existing rows move there.
+CREATE TABLE recent_tags_by_user (
+    user_id INTEGER NOT NULL DEFAULT 0,
+    tag_id  INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    used_at TEXT    NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    PRIMARY KEY (user_id, tag_id)
+);
+INSERT INTO recent_tags_by_user (user_id, tag_id, used_at)
+    SELECT 0, tag_id, used_at FROM recent_tags;
+DROP TABLE recent_tags;
+ALTER TABLE recent_tags_by_user RENAME TO recent_tags;
@@ -0,0 +1,13 @@
+-- Identifiers a video has at outside services (TMDB, TVMaze, YouTube, IMDb),
+-- so it can be re-scraped, scrobbled or looked up without guessing from its
+-- name. A video has at most one ID per provider.
+CREATE TABLE IF NOT EXISTS video_external_ids (
+    video_id    INTEGER NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    provider    TEXT    NOT NULL,
+    external_id TEXT    NOT NULL,
+    PRIMARY KEY (video_id, provider)
+);
+CREATE INDEX IF NOT EXISTS idx_video_external_ids_lookup ON video_external_ids(provider, external_id);
+INSERT OR IGNORE INTO video_external_ids (video_id, provider, external_id)
+    SELECT video_id, 'youtube', source_id FROM video_sources
+    WHERE extractor = 'youtube' AND source_id != '';
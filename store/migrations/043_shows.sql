@@ -0,0 +1,16 @@
+-- Series-level details fetched by the metadata scraper. A show is linked to
+-- its episodes by name: videos carry it as their "show:" tag.
+CREATE TABLE IF NOT EXISTS shows (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    name        TEXT    NOT NULL UNIQUE,
+    overview    TEXT    NOT NULL DEFAULT '',
+    poster_path TEXT    NOT NULL DEFAULT ''
+);
+
+-- A show's identifiers at outside services, as video_external_ids.
+CREATE TABLE IF NOT EXISTS show_external_ids (
+    show_id     INTEGER NOT NULL REFERENCES shows(id) ON DELETE CASCADE,
+    provider    TEXT    NOT NULL,
+    external_id TEXT    NOT NULL,
+    PRIMARY KEY (show_id, provider)
+);
@@ -0,0 +1,8 @@
+-- Named positions within a video, saved from the player to jump back to.
+CREATE TABLE IF NOT EXISTS video_bookmarks (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    video_id   INTEGER NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    position_s REAL    NOT NULL,
+    label      TEXT    NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_video_bookmarks_video ON video_bookmarks(video_id, position_s);
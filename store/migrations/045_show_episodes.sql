@@ -0,0 +1,10 @@
+-- A show's episode list as published by the metadata provider, aired or
+-- announced, so the library can be checked for missing episodes.
+CREATE TABLE IF NOT EXISTS show_episodes (
+    show_id  INTEGER NOT NULL REFERENCES shows(id) ON DELETE CASCADE,
+    season   INTEGER NOT NULL,
+    episode  INTEGER NOT NULL,
+    title    TEXT    NOT NULL DEFAULT '',
+    air_date TEXT    NOT NULL DEFAULT '', -- YYYY-MM-DD; '' when not announced
+    PRIMARY KEY (show_id, season, episode)
+);
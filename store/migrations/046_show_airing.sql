@@ -0,0 +1,9 @@
+-- A show's broadcast status and its next scheduled episode, refreshed from
+-- TVMaze while the show is still running. next_airs is a Unix time, 0 when
+-- nothing is scheduled; next_notified records that its airing was announced.
+ALTER TABLE shows ADD COLUMN status        TEXT    NOT NULL DEFAULT '';
+ALTER TABLE shows ADD COLUMN next_season   INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE shows ADD COLUMN next_episode  INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE shows ADD COLUMN next_title    TEXT    NOT NULL DEFAULT '';
+ALTER TABLE shows ADD COLUMN next_airs     INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE shows ADD COLUMN next_notified INTEGER NOT NULL DEFAULT 0;
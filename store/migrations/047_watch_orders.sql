@@ -0,0 +1,16 @@
+-- Named viewing orders that run across shows, e.g. a crossover event, as
+-- uploaded JSON. Entries name episodes by show, season and episode number
+-- and are matched to videos when the order is played.
+CREATE TABLE IF NOT EXISTS watch_orders (
+    id   INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT    NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS watch_order_entries (
+    order_id INTEGER NOT NULL REFERENCES watch_orders(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    show     TEXT    NOT NULL,
+    season   INTEGER NOT NULL,
+    episode  INTEGER NOT NULL,
+    PRIMARY KEY (order_id, position)
+);
@@ -0,0 +1,8 @@
+-- Named playback quality caps, e.g. "Phone over LTE" at 720p and 2 Mbit/s,
+-- chosen per device in the player. 0 means no cap.
+CREATE TABLE IF NOT EXISTS quality_presets (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT    NOT NULL UNIQUE,
+    max_height INTEGER NOT NULL DEFAULT 0,
+    bitrate_k  INTEGER NOT NULL DEFAULT 0
+);
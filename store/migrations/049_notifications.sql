@@ -0,0 +1,13 @@
+-- Finished downloads, exports and library scans, kept until read so a
+-- viewer who navigated away still sees them. user_id 0 stands for the
+-- shared -password or no sign-in, as in recent_tags.
+CREATE TABLE IF NOT EXISTS notifications (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    INTEGER NOT NULL DEFAULT 0,
+    kind       TEXT    NOT NULL,
+    message    TEXT    NOT NULL,
+    video_id   INTEGER REFERENCES videos(id) ON DELETE SET NULL,
+    created_at TEXT    NOT NULL DEFAULT (datetime('now')),
+    read       INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, id);
@@ -0,0 +1,104 @@
+-- Full-text search over more than names: a video's tags (system tags
+-- included, so show, genre, actor and studio names match), the description
+-- from its file metadata, and its episode title and show overview.
+--
+-- Unlike videos_fts (006), the index keeps its own copy of the text, as its
+-- columns come from several tables. The video_search view builds a video's
+-- row; triggers on each source table rebuild the rows it affects.
+ALTER TABLE videos ADD COLUMN description TEXT NOT NULL DEFAULT '';
+
+DROP TRIGGER IF EXISTS videos_fts_ai;
+DROP TRIGGER IF EXISTS videos_fts_au;
+DROP TRIGGER IF EXISTS videos_fts_ad;
+DROP TABLE IF EXISTS videos_fts;
+
+CREATE VIEW IF NOT EXISTS video_search AS
+SELECT v.id,
+       COALESCE(v.display_name, '') AS title,
+       v.filename,
+       COALESCE((SELECT GROUP_CONCAT(t.name, ' ')
+                 FROM video_tags vt JOIN tags t ON t.id = vt.tag_id
+                 WHERE vt.video_id = v.id), '') AS tags,
+       v.description,
+       TRIM(v.episode_title || ' ' || COALESCE((SELECT sh.overview
+                 FROM video_tags vt JOIN tags t ON t.id = vt.tag_id
+                 JOIN shows sh ON t.name = 'show:' || sh.name
+                 WHERE vt.video_id = v.id LIMIT 1), '')) AS show
+FROM videos v;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS video_search_fts USING fts5(
+    title,
+    filename,
+    tags,
+    description,
+    show,
+    tokenize = 'trigram'
+);
+
+INSERT INTO video_search_fts(rowid, title, filename, tags, description, show)
+    SELECT id, title, filename, tags, description, show FROM video_search;
+
+CREATE TRIGGER IF NOT EXISTS video_search_ai AFTER INSERT ON videos BEGIN
+    INSERT INTO video_search_fts(rowid, title, filename, tags, description, show)
+        SELECT id, title, filename, tags, description, show FROM video_search WHERE id = new.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS video_search_au
+AFTER UPDATE OF display_name, filename, description, episode_title ON videos BEGIN
+    DELETE FROM video_search_fts WHERE rowid = old.id;
+    INSERT INTO video_search_fts(rowid, title, filename, tags, description, show)
+        SELECT id, title, filename, tags, description, show FROM video_search WHERE id = new.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS video_search_ad AFTER DELETE ON videos BEGIN
+    DELETE FROM video_search_fts WHERE rowid = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS video_search_tag_ai AFTER INSERT ON video_tags BEGIN
+    DELETE FROM video_search_fts WHERE rowid = new.video_id;
+    INSERT INTO video_search_fts(rowid, title, filename, tags, description, show)
+        SELECT id, title, filename, tags, description, show FROM video_search WHERE id = new.video_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS video_search_tag_ad AFTER DELETE ON video_tags BEGIN
+    DELETE FROM video_search_fts WHERE rowid = old.video_id;
+    INSERT INTO video_search_fts(rowid, title, filename, tags, description, show)
+        SELECT id, title, filename, tags, description, show FROM video_search WHERE id = old.video_id;
+END;
+
+-- UpsertTag rewrites the name on conflict; only a real rename reindexes.
+CREATE TRIGGER IF NOT EXISTS video_search_tag_au AFTER UPDATE OF name ON tags
+WHEN old.name IS NOT new.name BEGIN
+    DELETE FROM video_search_fts WHERE rowid IN (SELECT video_id FROM video_tags WHERE tag_id = new.id);
+    INSERT INTO video_search_fts(rowid, title, filename, tags, description, show)
+        SELECT id, title, filename, tags, description, show FROM video_search
+        WHERE id IN (SELECT video_id FROM video_tags WHERE tag_id = new.id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS video_search_show_ai AFTER INSERT ON shows BEGIN
+    DELETE FROM video_search_fts WHERE rowid IN (SELECT vt.video_id FROM video_tags vt
+        JOIN tags t ON t.id = vt.tag_id WHERE t.name = 'show:' || new.name);
+    INSERT INTO video_search_fts(rowid, title, filename, tags, description, show)
+        SELECT id, title, filename, tags, description, show FROM video_search
+        WHERE id IN (SELECT vt.video_id FROM video_tags vt
+            JOIN tags t ON t.id = vt.tag_id WHERE t.name = 'show:' || new.name);
+END;
+
+CREATE TRIGGER IF NOT EXISTS video_search_show_au AFTER UPDATE OF name, overview ON shows
+WHEN old.name IS NOT new.name OR old.overview IS NOT new.overview BEGIN
+    DELETE FROM video_search_fts WHERE rowid IN (SELECT vt.video_id FROM video_tags vt
+        JOIN tags t ON t.id = vt.tag_id WHERE t.name IN ('show:' || old.name, 'show:' || new.name));
+    INSERT INTO video_search_fts(rowid, title, filename, tags, description, show)
+        SELECT id, title, filename, tags, description, show FROM video_search
+        WHERE id IN (SELECT vt.video_id FROM video_tags vt
+            JOIN tags t ON t.id = vt.tag_id WHERE t.name IN ('show:' || old.name, 'show:' || new.name));
+END;
+
+CREATE TRIGGER IF NOT EXISTS video_search_show_ad AFTER DELETE ON shows BEGIN
+    DELETE FROM video_search_fts WHERE rowid IN (SELECT vt.video_id FROM video_tags vt
+        JOIN tags t ON t.id = vt.tag_id WHERE t.name = 'show:' || old.name);
+    INSERT INTO video_search_fts(rowid, title, filename, tags, description, show)
+        SELECT id, title, filename, tags, description, show FROM video_search
+        WHERE id IN (SELECT vt.video_id FROM video_tags vt
+            JOIN tags t ON t.id = vt.tag_id WHERE t.name = 'show:' || old.name);
+END;
@@ -0,0 +1,3 @@
+-- Whether folders left empty by deleting or moving videos out of them are
+-- removed. The registered folder itself is always kept.
+ALTER TABLE directories ADD COLUMN prune_empty INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,12 @@
+-- Daily watch-time allowance per profile, in minutes; 0 means no limit.
+ALTER TABLE profiles ADD COLUMN daily_minutes INTEGER NOT NULL DEFAULT 0;
+
+-- Playback time per profile and local day ("2006-01-02"). granted_seconds
+-- is extra time an admin allowed for the day.
+CREATE TABLE IF NOT EXISTS profile_watch_time (
+    profile_id      INTEGER NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    day             TEXT    NOT NULL,
+    watched_seconds REAL    NOT NULL DEFAULT 0,
+    granted_seconds REAL    NOT NULL DEFAULT 0,
+    PRIMARY KEY (profile_id, day)
+);
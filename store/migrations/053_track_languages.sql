@@ -0,0 +1,18 @@
+-- Languages of a video's audio and subtitle tracks, cached from ffprobe with
+-- the codecs, so a viewer's preferred language can be picked without probing.
+-- Each is comma-separated in track order, empty for an untagged track.
+ALTER TABLE video_codecs ADD COLUMN audio_languages    TEXT    NOT NULL DEFAULT '';
+ALTER TABLE video_codecs ADD COLUMN default_audio      INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE video_codecs ADD COLUMN subtitle_languages TEXT    NOT NULL DEFAULT '';
+-- Rows cached before now lack the languages; they are probed again the
+-- next time the video plays.
+DELETE FROM video_codecs;
+
+-- Preferred audio and subtitle languages per account, comma-separated in
+-- order of preference. user_id 0 stands for the shared -password or no
+-- sign-in, as in recent_tags_by_user.
+CREATE TABLE IF NOT EXISTS language_prefs (
+    user_id   INTEGER PRIMARY KEY,
+    audio     TEXT NOT NULL DEFAULT '',
+    subtitles TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,10 @@
+-- Trailers and sample clips found beside a video are its extras: listed under
+-- it in the player rather than as library entries of their own. The sync
+-- rewrites a directory's rows each time it runs; deleting the main video
+-- turns its extras back into ordinary videos.
+CREATE TABLE IF NOT EXISTS video_extras (
+    video_id INTEGER PRIMARY KEY REFERENCES videos(id) ON DELETE CASCADE,
+    main_id  INTEGER NOT NULL    REFERENCES videos(id) ON DELETE CASCADE,
+    kind     TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_video_extras_main_id ON video_extras(main_id);
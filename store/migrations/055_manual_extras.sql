@@ -0,0 +1,17 @@
+-- Extras can also be linked by hand: to a video, or to a whole show by name,
+-- and as bonus content of any kind. The sync only rewrites the rows it made
+-- itself (manual = 0). A manual row with an empty kind records that the
+-- video was taken back into the library, so the sync leaves it there.
+CREATE TABLE video_extras_new (
+    video_id  INTEGER PRIMARY KEY REFERENCES videos(id) ON DELETE CASCADE,
+    main_id   INTEGER REFERENCES videos(id) ON DELETE CASCADE,
+    show_name TEXT    NOT NULL DEFAULT '',
+    kind      TEXT    NOT NULL,
+    manual    INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO video_extras_new (video_id, main_id, kind)
+    SELECT video_id, main_id, kind FROM video_extras;
+DROP TABLE video_extras;
+ALTER TABLE video_extras_new RENAME TO video_extras;
+CREATE INDEX IF NOT EXISTS idx_video_extras_main_id ON video_extras(main_id);
+CREATE INDEX IF NOT EXISTS idx_video_extras_show_name ON video_extras(show_name) WHERE show_name != '';
@@ -0,0 +1,13 @@
+-- Notifications of failed jobs are marked, so the nightly report can list
+-- them apart from the jobs that finished.
+ALTER TABLE notifications ADD COLUMN failed INTEGER NOT NULL DEFAULT 0;
+
+-- Accounts that opted in to the nightly report, with the address it is
+-- emailed to ('' for the notification alone) and when it was last sent.
+-- user_id 0 stands for the shared -password or no sign-in, as in
+-- language_prefs.
+CREATE TABLE IF NOT EXISTS report_subscriptions (
+    user_id   INTEGER PRIMARY KEY,
+    email     TEXT NOT NULL DEFAULT '',
+    last_sent TEXT NOT NULL DEFAULT ''
+);
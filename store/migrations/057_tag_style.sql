@@ -0,0 +1,4 @@
+-- A tag's color label (one of VideoLabelColors, '' for none) and its place
+-- among the tag chips: lower sort_order first, then by name.
+ALTER TABLE tags ADD COLUMN color      TEXT    NOT NULL DEFAULT '';
+ALTER TABLE tags ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,15 @@
+-- Named library filters, evaluated each time they are opened. tag_ids is a
+-- comma-separated list of tag IDs; the other columns mirror the library
+-- list's filters and sort, '' or 0 when unused.
+CREATE TABLE IF NOT EXISTS smart_playlists (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    name         TEXT    NOT NULL UNIQUE,
+    search       TEXT    NOT NULL DEFAULT '',
+    tag_ids      TEXT    NOT NULL DEFAULT '',
+    all_tags     INTEGER NOT NULL DEFAULT 0,
+    video_type   TEXT    NOT NULL DEFAULT '',
+    directory_id INTEGER NOT NULL DEFAULT 0,
+    min_rating   INTEGER NOT NULL DEFAULT 0,
+    watched      TEXT    NOT NULL DEFAULT '',
+    sort         TEXT    NOT NULL DEFAULT ''
+);
@@ -0,0 +1,5 @@
+-- A video's rating on the 1–5 star scale, 0 for unrated. rating stays the
+-- thumbs rating derived from it: 4 stars is liked (1) and 5 is a
+-- favourite (2). Existing ratings carry over the same way.
+ALTER TABLE videos ADD COLUMN stars INTEGER NOT NULL DEFAULT 0;
+UPDATE videos SET stars = CASE rating WHEN 1 THEN 4 WHEN 2 THEN 5 ELSE 0 END;
@@ -0,0 +1,28 @@
+-- When each video was first found, so archive policies can tell how long it
+-- has sat unwatched. Videos already in the library count from now.
+ALTER TABLE videos ADD COLUMN added_at TEXT NOT NULL DEFAULT '';
+UPDATE videos SET added_at = datetime('now');
+
+-- What becomes of videos left unwatched: those with tag_id and of
+-- video_type (0 and '' match any) are kept for good ('keep'), or after days
+-- without a play are moved to directory_id ('move') or to the trash
+-- ('trash').
+CREATE TABLE IF NOT EXISTS archive_policies (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    name         TEXT    NOT NULL UNIQUE,
+    tag_id       INTEGER NOT NULL DEFAULT 0,
+    video_type   TEXT    NOT NULL DEFAULT '',
+    action       TEXT    NOT NULL,
+    days         INTEGER NOT NULL DEFAULT 0,
+    directory_id INTEGER NOT NULL DEFAULT 0
+);
+
+-- Videos a policy would move or trash, waiting for an admin to approve.
+-- A dismissed proposal stays, so the video is not proposed again, until the
+-- policy no longer picks it.
+CREATE TABLE IF NOT EXISTS archive_proposals (
+    video_id    INTEGER PRIMARY KEY REFERENCES videos(id) ON DELETE CASCADE,
+    policy_id   INTEGER NOT NULL REFERENCES archive_policies(id) ON DELETE CASCADE,
+    proposed_at TEXT    NOT NULL DEFAULT (datetime('now')),
+    dismissed   INTEGER NOT NULL DEFAULT 0
+);
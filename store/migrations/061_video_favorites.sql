@@ -0,0 +1,5 @@
+-- A "watch again soon" marker, kept apart from the rating: a video can be
+-- a favourite without being rated, or rated highly without being one.
+ALTER TABLE videos ADD COLUMN favorite INTEGER NOT NULL DEFAULT 0;
+-- Smart playlists can be limited to favourites like the library list.
+ALTER TABLE smart_playlists ADD COLUMN favorites INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- Short clips that belong to a photo beside them: the motion of a Live
+-- Photo or Motion Photo. photo is the photo's path. The sync rewrites a
+-- directory's rows after each scan.
+CREATE TABLE IF NOT EXISTS photo_companions (
+    video_id INTEGER PRIMARY KEY REFERENCES videos(id) ON DELETE CASCADE,
+    photo    TEXT    NOT NULL
+);
@@ -0,0 +1,4 @@
+-- How often the library poller rescans a directory, in seconds (0 for every
+-- poll), and when a scan of it last started, in Unix seconds (0 for never).
+ALTER TABLE directories ADD COLUMN sync_every_s INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE directories ADD COLUMN synced_at INTEGER NOT NULL DEFAULT 0;
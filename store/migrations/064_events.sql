@@ -0,0 +1,17 @@
+-- Everything the server announces, in one log: finished jobs, new videos,
+-- storage limits, aired episodes. Notifications, webhooks, the live event
+-- stream, the RSS feed and the activity panel are all fed from it. audience
+-- says who may see an event: 'user' (only user_id, 0 for the shared
+-- -password or no sign-in), 'admins' or 'everyone'. payload is the JSON a
+-- kind's own webhook receives, '' for kinds without one.
+CREATE TABLE IF NOT EXISTS events (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind       TEXT    NOT NULL,
+    message    TEXT    NOT NULL,
+    video_id   INTEGER REFERENCES videos(id) ON DELETE SET NULL,
+    failed     INTEGER NOT NULL DEFAULT 0,
+    audience   TEXT    NOT NULL DEFAULT 'everyone',
+    user_id    INTEGER NOT NULL DEFAULT 0,
+    payload    TEXT    NOT NULL DEFAULT '',
+    created_at TEXT    NOT NULL DEFAULT (datetime('now'))
+);
@@ -0,0 +1,6 @@
+-- Bytes of each video's file sent to viewers, all time, for the library
+-- statistics. Range requests and prepared copies count toward the video.
+CREATE TABLE IF NOT EXISTS video_bytes_served (
+    video_id INTEGER PRIMARY KEY REFERENCES videos(id) ON DELETE CASCADE,
+    bytes    INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,9 @@
+-- An archive policy picking videos by a tag goes with the tag, as a foreign
+-- key would take it (tag_id 0, for any tag, can't be one). Policies left
+-- naming a deleted or merged tag pick nothing and protect nothing.
+DELETE FROM archive_policies
+WHERE tag_id != 0 AND NOT EXISTS (SELECT 1 FROM tags t WHERE t.id = archive_policies.tag_id);
+
+CREATE TRIGGER IF NOT EXISTS archive_policies_tag_ad AFTER DELETE ON tags BEGIN
+    DELETE FROM archive_policies WHERE tag_id = OLD.id;
+END;
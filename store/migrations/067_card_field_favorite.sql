@@ -0,0 +1,4 @@
+-- The watch-again flag has its own card field now. Libraries that showed
+-- ratings on their cards showed the flag with them, so they keep it.
+UPDATE settings SET value = value || ',favorite'
+WHERE key = 'card_fields' AND ',' || value || ',' LIKE '%,rating,%';
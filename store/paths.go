@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrRelativePath is returned when a directory path is empty or relative.
+var ErrRelativePath = errors.New("path must be absolute")
+
+// CanonicalPath returns path cleaned and with symlinks resolved, so that a
+// folder is recorded under one path however it was spelled. A path that
+// cannot be resolved (not created yet, or on an offline drive) is only
+// cleaned. Empty and relative paths are rejected with ErrRelativePath.
+func CanonicalPath(path string) (string, error) {
+	if path == "" || !filepath.IsAbs(path) {
+		return "", fmt.Errorf("%w: %q", ErrRelativePath, path)
+	}
+	path = filepath.Clean(path)
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real, nil
+	}
+	return path, nil
+}
+
+// within reports whether path is root or lies under it.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// canonicalVideoDir returns the canonical form of dir, the folder of a video
+// under the registered directory at root. A folder reached through a
+// symlink that leads outside root keeps the path it was found by, as the
+// directory's exclude patterns and depth limit are measured from root.
+func canonicalVideoDir(root, dir string) (string, error) {
+	real, err := CanonicalPath(dir)
+	if err != nil {
+		return "", err
+	}
+	if root != "" && !within(root, real) {
+		return filepath.Clean(dir), nil
+	}
+	return real, nil
+}
+
+// directoryRoot returns the path of directory dirID, or "" if there is none.
+func (s *SQLiteStore) directoryRoot(ctx context.Context, dirID int64) (string, error) {
+	var root string
+	err := s.conn.QueryRowContext(ctx, `SELECT path FROM directories WHERE id = ?`, dirID).Scan(&root)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	return root, nil
+}
+
+// videoDir canonicalises dir for a video in directory dirID.
+func (s *SQLiteStore) videoDir(ctx context.Context, dirID int64, dir string) (string, error) {
+	root, err := s.directoryRoot(ctx, dirID)
+	if err != nil {
+		return "", err
+	}
+	return canonicalVideoDir(root, dir)
+}
@@ -17,6 +17,12 @@ type SQLiteStore struct {
 	conn *sql.DB
 }
 
+// execer is what the write helpers need from *sql.DB or *sql.Tx, so that a
+// write can run alone or as one step of a larger transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
 // NewSQLite opens (or creates) a SQLite database at path and applies all
 // pending migrations from the embedded migrations/ directory.
 func NewSQLite(path string) (*SQLiteStore, error) {
@@ -57,33 +63,66 @@ func (s *SQLiteStore) Close() error {
 
 // --- Directories ---
 
-func (s *SQLiteStore) GetDirectory(ctx context.Context, id int64) (Directory, error) {
-	row := s.conn.QueryRowContext(ctx, `SELECT id, path FROM directories WHERE id = ?`, id)
+// dirColumns is the column list scanned by scanDirectory.
+const dirColumns = `id, path, exclude_patterns, max_depth, parent_id, follow_symlinks, label, offline, budget_bytes, cap_bytes, prune_empty, sync_every_s, synced_at`
+
+// scanDirectory scans a row selected with dirColumns.
+func scanDirectory(scan func(dest ...any) error) (Directory, error) {
 	var d Directory
-	if err := row.Scan(&d.ID, &d.Path); err != nil {
-		return Directory{}, err
+	var excludes string
+	var parentID sql.NullInt64
+	var syncEvery, syncedAt int64
+	if err := scan(&d.ID, &d.Path, &excludes, &d.MaxDepth, &parentID, &d.FollowSymlinks, &d.Label, &d.Offline, &d.BudgetBytes, &d.CapBytes, &d.PruneEmpty, &syncEvery, &syncedAt); err != nil {
+		return Directory{}, dbError(err)
+	}
+	d.ParentID = parentID.Int64
+	d.SyncEvery = time.Duration(syncEvery) * time.Second
+	if syncedAt != 0 {
+		d.SyncedAt = time.Unix(syncedAt, 0)
+	}
+	for _, p := range strings.Split(excludes, "\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			d.Excludes = append(d.Excludes, p)
+		}
 	}
 	return d, nil
 }
 
+func (s *SQLiteStore) GetDirectory(ctx context.Context, id int64) (Directory, error) {
+	row := s.conn.QueryRowContext(ctx, `SELECT `+dirColumns+` FROM directories WHERE id = ?`, id)
+	return scanDirectory(row.Scan)
+}
+
 func (s *SQLiteStore) AddDirectory(ctx context.Context, path string) (Directory, error) {
-	var d Directory
-	err := s.conn.QueryRowContext(ctx,
-		`INSERT INTO directories (path) VALUES (?) RETURNING id, path`, path,
-	).Scan(&d.ID, &d.Path)
-	return d, err
+	path, err := CanonicalPath(path)
+	if err != nil {
+		return Directory{}, err
+	}
+	row := s.conn.QueryRowContext(ctx,
+		`INSERT INTO directories (path) VALUES (?) RETURNING `+dirColumns, path)
+	return scanDirectory(row.Scan)
+}
+
+func (s *SQLiteStore) AddChildDirectory(ctx context.Context, parentID int64, path string) (Directory, error) {
+	path, err := CanonicalPath(path)
+	if err != nil {
+		return Directory{}, err
+	}
+	row := s.conn.QueryRowContext(ctx,
+		`INSERT INTO directories (path, parent_id) VALUES (?, ?) RETURNING `+dirColumns, path, parentID)
+	return scanDirectory(row.Scan)
 }
 
 func (s *SQLiteStore) ListDirectories(ctx context.Context) ([]Directory, error) {
-	rows, err := s.conn.QueryContext(ctx, `SELECT id, path FROM directories ORDER BY path`)
+	rows, err := s.conn.QueryContext(ctx, `SELECT `+dirColumns+` FROM directories ORDER BY path`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var dirs []Directory
 	for rows.Next() {
-		var d Directory
-		if err := rows.Scan(&d.ID, &d.Path); err != nil {
+		d, err := scanDirectory(rows.Scan)
+		if err != nil {
 			return nil, err
 		}
 		dirs = append(dirs, d)
@@ -91,6 +130,65 @@ func (s *SQLiteStore) ListDirectories(ctx context.Context) ([]Directory, error)
 	return dirs, rows.Err()
 }
 
+func (s *SQLiteStore) SetDirectoryExcludes(ctx context.Context, id int64, patterns []string) error {
+	return s.updateDirectory(ctx, `UPDATE directories SET exclude_patterns = ? WHERE id = ?`,
+		strings.Join(patterns, "\n"), id)
+}
+
+func (s *SQLiteStore) SetDirectoryMaxDepth(ctx context.Context, id int64, depth int) error {
+	if depth < 0 {
+		return fmt.Errorf("max depth must not be negative")
+	}
+	return s.updateDirectory(ctx, `UPDATE directories SET max_depth = ? WHERE id = ?`, depth, id)
+}
+
+func (s *SQLiteStore) SetDirectoryFollowSymlinks(ctx context.Context, id int64, follow bool) error {
+	return s.updateDirectory(ctx, `UPDATE directories SET follow_symlinks = ? WHERE id = ?`, follow, id)
+}
+
+func (s *SQLiteStore) SetDirectoryPruneEmpty(ctx context.Context, id int64, prune bool) error {
+	return s.updateDirectory(ctx, `UPDATE directories SET prune_empty = ? WHERE id = ?`, prune, id)
+}
+
+func (s *SQLiteStore) SetDirectoryLabel(ctx context.Context, id int64, label string) error {
+	return s.updateDirectory(ctx, `UPDATE directories SET label = ? WHERE id = ?`, label, id)
+}
+
+func (s *SQLiteStore) SetDirectoryOffline(ctx context.Context, id int64, offline bool) error {
+	return s.updateDirectory(ctx, `UPDATE directories SET offline = ? WHERE id = ?`, offline, id)
+}
+
+func (s *SQLiteStore) SetDirectoryBudget(ctx context.Context, id int64, budget, capBytes int64) error {
+	return s.updateDirectory(ctx, `UPDATE directories SET budget_bytes = ?, cap_bytes = ? WHERE id = ?`, budget, capBytes, id)
+}
+
+func (s *SQLiteStore) SetDirectorySyncEvery(ctx context.Context, id int64, every time.Duration) error {
+	return s.updateDirectory(ctx, `UPDATE directories SET sync_every_s = ? WHERE id = ?`, int64(every/time.Second), id)
+}
+
+func (s *SQLiteStore) SetDirectorySynced(ctx context.Context, id int64, at time.Time) error {
+	return s.updateDirectory(ctx, `UPDATE directories SET synced_at = ? WHERE id = ?`, at.Unix(), id)
+}
+
+// updateDirectory runs a single-row UPDATE on directories and returns
+// ErrNotFound when no directory matched.
+func (s *SQLiteStore) updateDirectory(ctx context.Context, query string, args ...any) error {
+	return updateOne(ctx, s.conn, query, args...)
+}
+
+// updateOne runs a statement meant to change exactly one row, returning
+// ErrNotFound when it matched none.
+func updateOne(ctx context.Context, q execer, query string, args ...any) error {
+	res, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return dbError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func (s *SQLiteStore) DeleteDirectory(ctx context.Context, id int64) error {
 	_, err := s.conn.ExecContext(ctx, `DELETE FROM directories WHERE id = ?`, id)
 	return err
@@ -136,6 +234,10 @@ func (s *SQLiteStore) DeleteDirectoryAndVideos(ctx context.Context, id int64) ([
 }
 
 func (s *SQLiteStore) RenameDirectory(ctx context.Context, id int64, newPath string) error {
+	newPath, err := CanonicalPath(newPath)
+	if err != nil {
+		return err
+	}
 	tx, err := s.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -144,12 +246,12 @@ func (s *SQLiteStore) RenameDirectory(ctx context.Context, id int64, newPath str
 	var oldPath string
 	if err := tx.QueryRowContext(ctx, `SELECT path FROM directories WHERE id = ?`, id).Scan(&oldPath); err != nil {
 		tx.Rollback() //nolint:errcheck
-		return err
+		return dbError(err)
 	}
 	// Update directory row.
 	if _, err := tx.ExecContext(ctx, `UPDATE directories SET path = ? WHERE id = ?`, newPath, id); err != nil {
 		tx.Rollback() //nolint:errcheck
-		return err
+		return dbError(err)
 	}
 	// Update video directory_path: replace old path prefix with new path.
 	// This handles both exact matches (videos in the root) and subfolders.
@@ -173,42 +275,51 @@ func (s *SQLiteStore) RenameDirectory(ctx context.Context, id int64, newPath str
 
 // --- Videos (raw SQL — directory_id is nullable, so no sqlc JOIN queries) ---
 
-func (s *SQLiteStore) UpsertVideo(ctx context.Context, dirID int64, dirPath string, filename string) (Video, error) {
-	row := s.conn.QueryRowContext(ctx, `
-		INSERT INTO videos (filename, directory_id, directory_path, original_filename)
-		VALUES (?, ?, ?, ?)
+// upsertVideoQuery inserts a video, or updates the directory of an existing
+// one, and returns the row. Its arguments are filename, directory ID,
+// directory path and filename again (the original filename).
+const upsertVideoQuery = `
+		INSERT INTO videos (filename, directory_id, directory_path, original_filename, added_at)
+		VALUES (?, ?, ?, ?, datetime('now'))
 		ON CONFLICT (filename, directory_path)
 			DO UPDATE SET directory_id = excluded.directory_id
 		RETURNING id, filename, directory_id, directory_path, display_name,
 		          (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		           FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-		           WHERE vt.video_id=id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-		          rating, original_filename,
+		           WHERE vt.video_id=videos.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
+		          rating, stars, favorite, original_filename,
 		          (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		           FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-		           WHERE vt.video_id=id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
+		           WHERE vt.video_id=videos.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
 		          season_number,
 		          episode_number,
 		          episode_title,
 		          (SELECT GROUP_CONCAT(SUBSTR(t.name, INSTR(t.name,':')+1), ', ')
 		           FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-		           WHERE vt.video_id=id AND t.name LIKE 'actor:%') AS actors,
+		           WHERE vt.video_id=videos.id AND t.name LIKE 'actor:%') AS actors,
 		          (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		           FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-		           WHERE vt.video_id=id AND t.name LIKE 'studio:%' LIMIT 1) AS studio,
+		           WHERE vt.video_id=videos.id AND t.name LIKE 'studio:%' LIMIT 1) AS studio,
 		          (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		           FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-		           WHERE vt.video_id=id AND t.name LIKE 'channel:%' LIMIT 1) AS channel,
+		           WHERE vt.video_id=videos.id AND t.name LIKE 'channel:%' LIMIT 1) AS channel,
 		          (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		           FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-		           WHERE vt.video_id=id AND t.name LIKE 'type:%' LIMIT 1) AS video_type,
+		           WHERE vt.video_id=videos.id AND t.name LIKE 'type:%' LIMIT 1) AS video_type,
 		          (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		           FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-		           WHERE vt.video_id=id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-		          thumbnail_path, duration_s, air_date,
+		           WHERE vt.video_id=videos.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
+		          thumbnail_path, duration_s, air_date, width, height, file_size, file_mtime,
 		          NULL AS watched_at,
 		          watched
-	`, filename, dirID, dirPath, filename)
+	`
+
+func (s *SQLiteStore) UpsertVideo(ctx context.Context, dirID int64, dirPath string, filename string) (Video, error) {
+	dirPath, err := s.videoDir(ctx, dirID, dirPath)
+	if err != nil {
+		return Video{}, err
+	}
+	row := s.conn.QueryRowContext(ctx, upsertVideoQuery, filename, dirID, dirPath, filename)
 	return scanVideoRow(row)
 }
 
@@ -218,7 +329,7 @@ func (s *SQLiteStore) ListVideos(ctx context.Context) ([]Video, error) {
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-		       v.rating, v.original_filename,
+		       v.rating, v.stars, v.favorite, v.original_filename,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
@@ -240,7 +351,7 @@ func (s *SQLiteStore) ListVideos(ctx context.Context) ([]Video, error) {
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-		       v.thumbnail_path, v.duration_s, v.air_date,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
 		       wh.watched_at, v.watched
 		FROM videos v
 		LEFT JOIN watch_history wh ON v.id = wh.video_id
@@ -252,6 +363,124 @@ func (s *SQLiteStore) ListVideos(ctx context.Context) ([]Video, error) {
 	return scanVideos(rows)
 }
 
+func (s *SQLiteStore) ListVideosPage(ctx context.Context, q VideoQuery) ([]Video, int, error) {
+	// Extras are listed under their main video, not on their own.
+	where := []string{"NOT EXISTS (SELECT 1 FROM video_extras ve WHERE ve.video_id = v.id AND ve.kind != '')"}
+	var args []any
+	if q.Search != "" {
+		cond, arg := searchCondition(q.Search)
+		where = append(where, cond)
+		args = append(args, arg...)
+	}
+	if q.TagID != 0 {
+		where = append(where, `EXISTS (SELECT 1 FROM video_tags vtf WHERE vtf.video_id = v.id AND vtf.tag_id = ?)`)
+		args = append(args, q.TagID)
+	}
+	if ids := uniqueIDs(q.TagIDs); len(ids) > 0 {
+		in := `vtf.tag_id IN (?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
+		if q.AllTags {
+			where = append(where, `(SELECT COUNT(DISTINCT vtf.tag_id) FROM video_tags vtf
+			                        WHERE vtf.video_id = v.id AND `+in+`) = `+strconv.Itoa(len(ids)))
+		} else {
+			where = append(where, `EXISTS (SELECT 1 FROM video_tags vtf WHERE vtf.video_id = v.id AND `+in+`)`)
+		}
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	if q.Type != "" {
+		where = append(where, `EXISTS (SELECT 1 FROM video_tags vtf JOIN tags tf ON tf.id = vtf.tag_id
+		                               WHERE vtf.video_id = v.id AND tf.name = 'type:' || ?)`)
+		args = append(args, q.Type)
+	}
+	if q.DirectoryID != 0 {
+		where = append(where, `v.directory_id = ?`)
+		args = append(args, q.DirectoryID)
+	}
+	if q.MinRating > 0 {
+		where = append(where, `v.rating >= ?`)
+		args = append(args, q.MinRating)
+	}
+	switch q.Watched {
+	case "yes":
+		where = append(where, `v.watched = 1`)
+	case "no":
+		where = append(where, `v.watched = 0`)
+	}
+	if q.Favorites {
+		where = append(where, `v.favorite = 1`)
+	}
+	if !q.Companions {
+		where = append(where, `NOT EXISTS (SELECT 1 FROM photo_companions pc WHERE pc.video_id = v.id)`)
+	}
+	cond := strings.Join(where, " AND ")
+	var total int
+	if err := s.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM videos v WHERE `+cond, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	// v.id last keeps pages stable when the other keys tie.
+	order := `v.directory_path ASC, COALESCE(NULLIF(v.display_name, ''), v.filename) ASC, v.id`
+	switch q.Sort {
+	case "rating":
+		order = `v.rating DESC, COALESCE(NULLIF(v.display_name, ''), v.filename) ASC, v.id`
+	case "stars":
+		order = `v.stars DESC, COALESCE(NULLIF(v.display_name, ''), v.filename) ASC, v.id`
+	case "added":
+		// IDs are assigned on first sync, so newest first is descending ID.
+		order = `v.id DESC`
+	case "watched":
+		order = `wh.watched_at IS NULL, wh.watched_at DESC, COALESCE(NULLIF(v.display_name, ''), v.filename) ASC, v.id`
+	case "duration":
+		order = `v.duration_s DESC, COALESCE(NULLIF(v.display_name, ''), v.filename) ASC, v.id`
+	case "size":
+		order = `v.file_size DESC, COALESCE(NULLIF(v.display_name, ''), v.filename) ASC, v.id`
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1 // no limit
+	}
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT v.id, v.filename, v.directory_id, v.directory_path, v.display_name,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
+		       v.rating, v.stars, v.favorite, v.original_filename,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
+		       v.season_number,
+		       v.episode_number,
+		       v.episode_title,
+		       (SELECT GROUP_CONCAT(SUBSTR(t.name, INSTR(t.name,':')+1), ', ')
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'actor:%') AS actors,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'studio:%' LIMIT 1) AS studio,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'channel:%' LIMIT 1) AS channel,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'type:%' LIMIT 1) AS video_type,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
+		       wh.watched_at, v.watched
+		FROM videos v
+		LEFT JOIN watch_history wh ON v.id = wh.video_id
+		WHERE `+cond+`
+		ORDER BY `+order+`
+		LIMIT ? OFFSET ?
+	`, append(args, limit, max(q.Offset, 0))...)
+	if err != nil {
+		return nil, 0, err
+	}
+	videos, err := scanVideos(rows)
+	return videos, total, err
+}
+
 func (s *SQLiteStore) CountVideos(ctx context.Context) (int, error) {
 	var n int
 	err := s.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM videos`).Scan(&n)
@@ -264,7 +493,7 @@ func (s *SQLiteStore) ListVideosByTag(ctx context.Context, tagID int64) ([]Video
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt2 ON t.id=vt2.tag_id
 		        WHERE vt2.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-		       v.rating, v.original_filename,
+		       v.rating, v.stars, v.favorite, v.original_filename,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt2 ON t.id=vt2.tag_id
 		        WHERE vt2.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
@@ -286,7 +515,7 @@ func (s *SQLiteStore) ListVideosByTag(ctx context.Context, tagID int64) ([]Video
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt2 ON t.id=vt2.tag_id
 		        WHERE vt2.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-		       v.thumbnail_path, v.duration_s, v.air_date,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
 		       wh.watched_at, v.watched
 		FROM videos v
 		JOIN video_tags vt ON v.id = vt.video_id
@@ -306,7 +535,7 @@ func (s *SQLiteStore) ListVideosByDirectory(ctx context.Context, dirID int64) ([
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-		       v.rating, v.original_filename,
+		       v.rating, v.stars, v.favorite, v.original_filename,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
@@ -328,7 +557,7 @@ func (s *SQLiteStore) ListVideosByDirectory(ctx context.Context, dirID int64) ([
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-		       v.thumbnail_path, v.duration_s, v.air_date,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
 		       wh.watched_at, v.watched
 		FROM videos v
 		LEFT JOIN watch_history wh ON v.id = wh.video_id
@@ -347,7 +576,7 @@ func (s *SQLiteStore) GetVideo(ctx context.Context, id int64) (Video, error) {
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-		       v.rating, v.original_filename,
+		       v.rating, v.stars, v.favorite, v.original_filename,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
@@ -369,7 +598,7 @@ func (s *SQLiteStore) GetVideo(ctx context.Context, id int64) (Video, error) {
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-		       v.thumbnail_path, v.duration_s, v.air_date,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
 		       wh.watched_at, v.watched
 		FROM videos v
 		LEFT JOIN watch_history wh ON v.id = wh.video_id
@@ -379,8 +608,29 @@ func (s *SQLiteStore) GetVideo(ctx context.Context, id int64) (Video, error) {
 }
 
 func (s *SQLiteStore) SetVideoRating(ctx context.Context, id int64, rating int) error {
-	_, err := s.conn.ExecContext(ctx, `UPDATE videos SET rating = ? WHERE id = ?`, rating, id)
-	return err
+	stars := 0
+	switch rating {
+	case 1:
+		stars = 4
+	case 2:
+		stars = 5
+	}
+	return updateOne(ctx, s.conn, `UPDATE videos SET rating = ?, stars = ? WHERE id = ?`, rating, stars, id)
+}
+
+func (s *SQLiteStore) SetVideoStars(ctx context.Context, id int64, stars int) error {
+	rating := 0
+	switch stars {
+	case 4:
+		rating = 1
+	case 5:
+		rating = 2
+	}
+	return updateOne(ctx, s.conn, `UPDATE videos SET rating = ?, stars = ? WHERE id = ?`, rating, stars, id)
+}
+
+func (s *SQLiteStore) SetVideoFavorite(ctx context.Context, id int64, favorite bool) error {
+	return updateOne(ctx, s.conn, `UPDATE videos SET favorite = ? WHERE id = ?`, favorite, id)
 }
 
 func (s *SQLiteStore) ListVideosByRating(ctx context.Context) ([]Video, error) {
@@ -389,7 +639,7 @@ func (s *SQLiteStore) ListVideosByRating(ctx context.Context) ([]Video, error) {
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-		       v.rating, v.original_filename,
+		       v.rating, v.stars, v.favorite, v.original_filename,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
@@ -411,7 +661,7 @@ func (s *SQLiteStore) ListVideosByRating(ctx context.Context) ([]Video, error) {
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-		       v.thumbnail_path, v.duration_s, v.air_date,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
 		       wh.watched_at, v.watched
 		FROM videos v
 		LEFT JOIN watch_history wh ON v.id = wh.video_id
@@ -429,7 +679,7 @@ func (s *SQLiteStore) ListVideosByShow(ctx context.Context, showName string) ([]
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt2 ON t.id=vt2.tag_id
 		        WHERE vt2.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-		       v.rating, v.original_filename,
+		       v.rating, v.stars, v.favorite, v.original_filename,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt2 ON t.id=vt2.tag_id
 		        WHERE vt2.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
@@ -451,7 +701,7 @@ func (s *SQLiteStore) ListVideosByShow(ctx context.Context, showName string) ([]
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt2 ON t.id=vt2.tag_id
 		        WHERE vt2.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-		       v.thumbnail_path, v.duration_s, v.air_date,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
 		       wh.watched_at, v.watched
 		FROM videos v
 		JOIN video_tags vt ON vt.video_id = v.id
@@ -476,7 +726,7 @@ func (s *SQLiteStore) GetNextUnwatched(ctx context.Context, tagID int64) (Video,
 			       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 			        FROM tags t JOIN video_tags vt2 ON t.id=vt2.tag_id
 			        WHERE vt2.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-			       v.rating, v.original_filename,
+			       v.rating, v.stars, v.favorite, v.original_filename,
 			       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 			        FROM tags t JOIN video_tags vt2 ON t.id=vt2.tag_id
 			        WHERE vt2.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
@@ -498,7 +748,7 @@ func (s *SQLiteStore) GetNextUnwatched(ctx context.Context, tagID int64) (Video,
 			       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 			        FROM tags t JOIN video_tags vt2 ON t.id=vt2.tag_id
 			        WHERE vt2.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-			       v.thumbnail_path, v.duration_s, v.air_date,
+			       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
 			       wh.watched_at, v.watched
 			FROM videos v
 			JOIN video_tags vt ON v.id = vt.video_id
@@ -513,7 +763,7 @@ func (s *SQLiteStore) GetNextUnwatched(ctx context.Context, tagID int64) (Video,
 			       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 			        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 			        WHERE vt.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-			       v.rating, v.original_filename,
+			       v.rating, v.stars, v.favorite, v.original_filename,
 			       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 			        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 			        WHERE vt.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
@@ -535,7 +785,7 @@ func (s *SQLiteStore) GetNextUnwatched(ctx context.Context, tagID int64) (Video,
 			       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 			        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 			        WHERE vt.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-			       v.thumbnail_path, v.duration_s, v.air_date,
+			       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
 			       wh.watched_at, v.watched
 			FROM videos v
 			LEFT JOIN watch_history wh ON v.id = wh.video_id
@@ -564,7 +814,7 @@ func (s *SQLiteStore) GetNextUnwatchedFromSearch(ctx context.Context, query stri
 			return v, nil
 		}
 	}
-	return Video{}, sql.ErrNoRows
+	return Video{}, ErrNotFound
 }
 
 // GetNextUnwatchedLite returns only the id and title of the next unwatched
@@ -592,7 +842,7 @@ func (s *SQLiteStore) GetNextUnwatchedLite(ctx context.Context, tagID int64) (in
 		`)
 	}
 	err := row.Scan(&id, &title)
-	return id, title, err
+	return id, title, dbError(err)
 }
 
 // GetNextUnwatchedFromSearchLite returns the id and title of the first
@@ -610,19 +860,52 @@ func (s *SQLiteStore) GetNextUnwatchedFromSearchLite(ctx context.Context, query
 			return v.ID, v.Title(), nil
 		}
 	}
-	return 0, "", sql.ErrNoRows
+	return 0, "", ErrNotFound
+}
+
+func (s *SQLiteStore) GetRandomVideo(ctx context.Context, unwatched bool, exclude ...int64) (Video, error) {
+	return s.GetRandomVideoFiltered(ctx, RandomFilter{Unwatched: unwatched, Exclude: exclude})
 }
 
-func (s *SQLiteStore) GetRandomVideo(ctx context.Context) (Video, error) {
+func (s *SQLiteStore) GetRandomVideoFiltered(ctx context.Context, f RandomFilter) (Video, error) {
+	// Videos in offline directories cannot be played, so they are skipped;
+	// extras and photo companion clips are too, as they are not library
+	// entries of their own.
 	// Use OFFSET instead of ORDER BY RANDOM() to avoid a full-table sort.
 	// MAX(1, …) prevents modulo-by-zero when the table is empty; the query
 	// still returns no rows because there are none to offset into.
+	notIn := ` AND NOT EXISTS (SELECT 1 FROM video_extras ve WHERE ve.video_id = v.id AND ve.kind != '')
+		AND NOT EXISTS (SELECT 1 FROM photo_companions pc WHERE pc.video_id = v.id)`
+	var args []any
+	if f.Unwatched {
+		notIn += ` AND v.watched = 0`
+	}
+	if f.MinRating > 0 {
+		notIn += ` AND v.rating >= ?`
+		args = append(args, f.MinRating)
+	}
+	if len(f.TagIDs) > 0 {
+		notIn += ` AND EXISTS (SELECT 1 FROM video_tags vt WHERE vt.video_id = v.id AND vt.tag_id IN (?` + strings.Repeat(",?", len(f.TagIDs)-1) + `))`
+		for _, id := range f.TagIDs {
+			args = append(args, id)
+		}
+	}
+	if f.ExcludeShows {
+		notIn += ` AND NOT EXISTS (SELECT 1 FROM tags t JOIN video_tags vt ON t.id = vt.tag_id WHERE vt.video_id = v.id AND t.name LIKE 'show:%')`
+	}
+	if len(f.Exclude) > 0 {
+		notIn += ` AND v.id NOT IN (?` + strings.Repeat(",?", len(f.Exclude)-1) + `)`
+		for _, id := range f.Exclude {
+			args = append(args, id)
+		}
+	}
+	args = append(args, args...) // the filter appears twice
 	row := s.conn.QueryRowContext(ctx, `
 		SELECT v.id, v.filename, v.directory_id, v.directory_path, v.display_name,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-		       v.rating, v.original_filename,
+		       v.rating, v.stars, v.favorite, v.original_filename,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
@@ -644,18 +927,135 @@ func (s *SQLiteStore) GetRandomVideo(ctx context.Context) (Video, error) {
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-		       v.thumbnail_path, v.duration_s, v.air_date,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
 		       wh.watched_at, v.watched
 		FROM videos v
 		LEFT JOIN watch_history wh ON v.id = wh.video_id
-		LIMIT 1 OFFSET ABS(RANDOM()) % MAX(1, (SELECT COUNT(*) FROM videos))
-	`)
+		WHERE NOT EXISTS (SELECT 1 FROM directories d WHERE d.id = v.directory_id AND d.offline = 1)`+notIn+`
+		LIMIT 1 OFFSET ABS(RANDOM()) % MAX(1, (
+			SELECT COUNT(*) FROM videos v
+			WHERE NOT EXISTS (SELECT 1 FROM directories d WHERE d.id = v.directory_id AND d.offline = 1)`+notIn+`))
+	`, args...)
 	return scanVideoRow(row)
 }
 
+func (s *SQLiteStore) ListUnwatchedPile(ctx context.Context, tagID int64, limit int) ([]Video, error) {
+	// Any watch_history row means the video was started, even if only its
+	// progress was saved; those belong to Continue watching instead.
+	cond := `v.watched = 0 AND wh.video_id IS NULL
+		AND NOT EXISTS (SELECT 1 FROM directories d WHERE d.id = v.directory_id AND d.offline = 1)
+		AND NOT EXISTS (SELECT 1 FROM video_extras ve WHERE ve.video_id = v.id AND ve.kind != '')
+		AND NOT EXISTS (SELECT 1 FROM photo_companions pc WHERE pc.video_id = v.id)`
+	args := []any{}
+	if tagID != 0 {
+		cond += ` AND EXISTS (SELECT 1 FROM video_tags vtf WHERE vtf.video_id = v.id AND vtf.tag_id = ?)`
+		args = append(args, tagID)
+	}
+	if limit <= 0 {
+		limit = -1 // no limit
+	}
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT v.id, v.filename, v.directory_id, v.directory_path, v.display_name,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
+		       v.rating, v.stars, v.favorite, v.original_filename,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
+		       v.season_number,
+		       v.episode_number,
+		       v.episode_title,
+		       (SELECT GROUP_CONCAT(SUBSTR(t.name, INSTR(t.name,':')+1), ', ')
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'actor:%') AS actors,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'studio:%' LIMIT 1) AS studio,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'channel:%' LIMIT 1) AS channel,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'type:%' LIMIT 1) AS video_type,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
+		       wh.watched_at, v.watched
+		FROM videos v
+		LEFT JOIN watch_history wh ON v.id = wh.video_id
+		WHERE `+cond+`
+		ORDER BY v.id
+		LIMIT ?
+	`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanVideos(rows)
+}
+
+func (s *SQLiteStore) ListIdleVideos(ctx context.Context, tagID int64, videoType string, before time.Time) ([]Video, error) {
+	cutoff := before.UTC().Format(time.DateTime)
+	cond := `v.added_at < ? AND (wh.watched_at IS NULL OR wh.watched_at < ?)
+		AND NOT EXISTS (SELECT 1 FROM directories d WHERE d.id = v.directory_id AND d.offline = 1)
+		AND NOT EXISTS (SELECT 1 FROM video_extras ve WHERE ve.video_id = v.id AND ve.kind != '')`
+	args := []any{cutoff, cutoff}
+	if tagID != 0 {
+		cond += ` AND EXISTS (SELECT 1 FROM video_tags vtf WHERE vtf.video_id = v.id AND vtf.tag_id = ?)`
+		args = append(args, tagID)
+	}
+	if videoType != "" {
+		cond += ` AND EXISTS (SELECT 1 FROM video_tags vtf JOIN tags tf ON tf.id = vtf.tag_id
+		                      WHERE vtf.video_id = v.id AND tf.name = 'type:' || ?)`
+		args = append(args, videoType)
+	}
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT v.id, v.filename, v.directory_id, v.directory_path, v.display_name,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
+		       v.rating, v.stars, v.favorite, v.original_filename,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
+		       v.season_number,
+		       v.episode_number,
+		       v.episode_title,
+		       (SELECT GROUP_CONCAT(SUBSTR(t.name, INSTR(t.name,':')+1), ', ')
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'actor:%') AS actors,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'studio:%' LIMIT 1) AS studio,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'channel:%' LIMIT 1) AS channel,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'type:%' LIMIT 1) AS video_type,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
+		        WHERE vt.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
+		       wh.watched_at, v.watched
+		FROM videos v
+		LEFT JOIN watch_history wh ON v.id = wh.video_id
+		WHERE `+cond+`
+		ORDER BY COALESCE(wh.watched_at, v.added_at), v.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanVideos(rows)
+}
+
 func (s *SQLiteStore) UpdateVideoName(ctx context.Context, id int64, name string) error {
-	_, err := s.conn.ExecContext(ctx, `UPDATE videos SET display_name = ? WHERE id = ?`, name, id)
-	return err
+	return updateOne(ctx, s.conn, `UPDATE videos SET display_name = ? WHERE id = ?`, name, id)
+}
+
+func (s *SQLiteStore) SetVideoDescription(ctx context.Context, id int64, description string) error {
+	return updateOne(ctx, s.conn, `UPDATE videos SET description = ? WHERE id = ?`, description, id)
 }
 
 func (s *SQLiteStore) UpdateVideoShowName(ctx context.Context, id int64, showName string) error {
@@ -672,7 +1072,7 @@ func (s *SQLiteStore) ListVideosByType(ctx context.Context, videoType string) ([
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt2 ON t.id=vt2.tag_id
 		        WHERE vt2.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-		       v.rating, v.original_filename,
+		       v.rating, v.stars, v.favorite, v.original_filename,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt2 ON t.id=vt2.tag_id
 		        WHERE vt2.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
@@ -694,7 +1094,7 @@ func (s *SQLiteStore) ListVideosByType(ctx context.Context, videoType string) ([
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt2 ON t.id=vt2.tag_id
 		        WHERE vt2.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-		       v.thumbnail_path, v.duration_s, v.air_date,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
 		       wh.watched_at, v.watched
 		FROM videos v
 		JOIN video_tags vt ON vt.video_id = v.id
@@ -719,64 +1119,277 @@ func (s *SQLiteStore) UpdateVideoDuration(ctx context.Context, videoID int64, du
 	return err
 }
 
-func (s *SQLiteStore) DeleteVideo(ctx context.Context, id int64) error {
-	_, err := s.conn.ExecContext(ctx, "DELETE FROM videos WHERE id = ?", id)
-	return err
-}
-
-func (s *SQLiteStore) UpdateVideoPath(ctx context.Context, id, dirID int64, dirPath, filename string) error {
-	_, err := s.conn.ExecContext(ctx,
-		`UPDATE videos SET directory_id=?, directory_path=?, filename=? WHERE id=?`,
-		dirID, dirPath, filename, id)
+func (s *SQLiteStore) UpdateVideoResolution(ctx context.Context, videoID int64, width, height int) error {
+	_, err := s.conn.ExecContext(ctx, `UPDATE videos SET width = ?, height = ? WHERE id = ?`, width, height, videoID)
 	return err
 }
 
-func (s *SQLiteStore) UpdateVideoFields(ctx context.Context, id int64, f VideoFields) error {
-	// Structured numeric fields stay as column updates.
-	if _, err := s.conn.ExecContext(ctx,
-		`UPDATE videos SET season_number=?, episode_number=?, episode_title=?, air_date=? WHERE id=?`,
-		f.SeasonNumber, f.EpisodeNumber, f.EpisodeTitle, f.AirDate, id); err != nil {
+func (s *SQLiteStore) RecordLibrarySnapshot(ctx context.Context, day string) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
 		return err
 	}
-	// season: tag mirrors the season_number column for sidebar filtering.
-	seasonVal := ""
-	if f.SeasonNumber > 0 {
-		seasonVal = strconv.Itoa(f.SeasonNumber)
-	}
-	if err := s.SetExclusiveSystemTag(ctx, id, "season", seasonVal); err != nil {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM library_snapshots WHERE day = ?`, day); err != nil {
+		tx.Rollback() //nolint:errcheck
 		return err
 	}
-	if err := s.SetExclusiveSystemTag(ctx, id, "genre", f.Genre); err != nil {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO library_snapshots (day, directory_id, video_count, total_bytes)
+		SELECT ?, directory_id, COUNT(*), COALESCE(SUM(file_size), 0)
+		FROM videos GROUP BY directory_id`, day); err != nil {
+		tx.Rollback() //nolint:errcheck
 		return err
 	}
-	if err := s.SetExclusiveSystemTag(ctx, id, "studio", f.Studio); err != nil {
-		return err
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) DirectoryUsage(ctx context.Context) (map[int64]int64, error) {
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT directory_id, COALESCE(SUM(file_size), 0) FROM videos GROUP BY directory_id`)
+	if err != nil {
+		return nil, err
 	}
-	if err := s.SetExclusiveSystemTag(ctx, id, "channel", f.Channel); err != nil {
+	defer rows.Close()
+	usage := make(map[int64]int64)
+	for rows.Next() {
+		var id, bytes int64
+		if err := rows.Scan(&id, &bytes); err != nil {
+			return nil, err
+		}
+		usage[id] = bytes
+	}
+	return usage, rows.Err()
+}
+
+func (s *SQLiteStore) LibraryTotals(ctx context.Context) (LibraryTotals, error) {
+	var t LibraryTotals
+	err := s.conn.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(duration_s), 0), COALESCE(SUM(file_size), 0),
+			(SELECT COALESCE(SUM(bytes), 0) FROM video_bytes_served)
+		FROM videos`).
+		Scan(&t.Videos, &t.DurationS, &t.Bytes, &t.Served)
+	return t, err
+}
+
+func (s *SQLiteStore) AddBytesServed(ctx context.Context, served map[int64]int64) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
 		return err
 	}
-	// Actors: split on comma, one tag per actor.
-	actors := splitActors(f.Actors)
-	return s.SetMultiSystemTag(ctx, id, "actor", actors)
+	for id, n := range served {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO video_bytes_served (video_id, bytes)
+			SELECT id, ? FROM videos WHERE id = ?
+			ON CONFLICT (video_id) DO UPDATE SET bytes = bytes + excluded.bytes`, n, id); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-func splitActors(actors string) []string {
-	var result []string
-	for a := range strings.SplitSeq(actors, ",") {
-		if s := strings.TrimSpace(a); s != "" {
-			result = append(result, s)
+func (s *SQLiteStore) ListMostServed(ctx context.Context, limit int) ([]VideoBytes, error) {
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT video_id, bytes FROM video_bytes_served ORDER BY bytes DESC, video_id LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []VideoBytes
+	for rows.Next() {
+		var b VideoBytes
+		if err := rows.Scan(&b.VideoID, &b.Bytes); err != nil {
+			return nil, err
 		}
+		out = append(out, b)
 	}
-	return result
+	return out, rows.Err()
 }
 
-func (s *SQLiteStore) ListVideosByMinRating(ctx context.Context, minRating int) ([]Video, error) {
+func (s *SQLiteStore) ListMostWatched(ctx context.Context, limit int) ([]WatchCount, error) {
 	rows, err := s.conn.QueryContext(ctx, `
-		SELECT v.id, v.filename, v.directory_id, v.directory_path, v.display_name,
-		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
+		SELECT video_id, COUNT(*) AS n FROM watch_events
+		GROUP BY video_id ORDER BY n DESC, MAX(watched_at) DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WatchCount
+	for rows.Next() {
+		var c WatchCount
+		if err := rows.Scan(&c.VideoID, &c.Watches); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) ListWeeklyWatchTime(ctx context.Context, since time.Time) ([]WeekWatchTime, error) {
+	// 'weekday 0' moves to the coming Sunday (or stays on one); six days
+	// back is that week's Monday.
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT date(we.watched_at, 'weekday 0', '-6 days') AS week, COUNT(*), COALESCE(SUM(v.duration_s), 0)
+		FROM watch_events we JOIN videos v ON v.id = we.video_id
+		WHERE week >= date(?, 'weekday 0', '-6 days')
+		GROUP BY week ORDER BY week`, since.UTC().Format(time.DateTime))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WeekWatchTime
+	for rows.Next() {
+		var w WeekWatchTime
+		if err := rows.Scan(&w.Week, &w.Watches, &w.Seconds); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) ListLibrarySnapshots(ctx context.Context, since string) ([]LibrarySnapshot, error) {
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT day, directory_id, video_count, total_bytes FROM library_snapshots
+		WHERE day >= ? ORDER BY day, directory_id`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []LibrarySnapshot
+	for rows.Next() {
+		var snap LibrarySnapshot
+		if err := rows.Scan(&snap.Day, &snap.DirectoryID, &snap.Videos, &snap.Bytes); err != nil {
+			return nil, err
+		}
+		out = append(out, snap)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) SetVideoCodecs(ctx context.Context, videoID int64, codecs VideoCodecs) error {
+	return setVideoCodecs(ctx, s.conn, videoID, codecs)
+}
+
+func setVideoCodecs(ctx context.Context, q execer, videoID int64, codecs VideoCodecs) error {
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO video_codecs (video_id, video_codec, audio_codec, audio_languages, subtitle_languages, default_audio)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(video_id) DO UPDATE SET video_codec = excluded.video_codec, audio_codec = excluded.audio_codec,
+			audio_languages = excluded.audio_languages, subtitle_languages = excluded.subtitle_languages,
+			default_audio = excluded.default_audio`,
+		videoID, codecs.Video, codecs.Audio, codecs.AudioLanguages, codecs.SubtitleLanguages, codecs.DefaultAudio)
+	return err
+}
+
+func (s *SQLiteStore) GetVideoCodecs(ctx context.Context, videoID int64) (VideoCodecs, error) {
+	var c VideoCodecs
+	err := s.conn.QueryRowContext(ctx,
+		`SELECT video_codec, audio_codec, audio_languages, subtitle_languages, default_audio
+		 FROM video_codecs WHERE video_id = ?`, videoID).
+		Scan(&c.Video, &c.Audio, &c.AudioLanguages, &c.SubtitleLanguages, &c.DefaultAudio)
+	if err == sql.ErrNoRows {
+		return VideoCodecs{}, nil
+	}
+	return c, err
+}
+
+func (s *SQLiteStore) GetLanguagePrefs(ctx context.Context, userID int64) (LanguagePrefs, error) {
+	var p LanguagePrefs
+	err := s.conn.QueryRowContext(ctx,
+		`SELECT audio, subtitles FROM language_prefs WHERE user_id = ?`, userID).Scan(&p.Audio, &p.Subtitles)
+	if err == sql.ErrNoRows {
+		return LanguagePrefs{}, nil
+	}
+	return p, err
+}
+
+func (s *SQLiteStore) SetLanguagePrefs(ctx context.Context, userID int64, p LanguagePrefs) error {
+	_, err := s.conn.ExecContext(ctx, `
+		INSERT INTO language_prefs (user_id, audio, subtitles) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET audio = excluded.audio, subtitles = excluded.subtitles`,
+		userID, p.Audio, p.Subtitles)
+	return dbError(err)
+}
+
+func (s *SQLiteStore) UpdateVideoFileStat(ctx context.Context, videoID int64, size int64, modTime time.Time) (bool, error) {
+	var oldSize, oldMtime int64
+	if err := s.conn.QueryRowContext(ctx,
+		`SELECT file_size, file_mtime FROM videos WHERE id = ?`, videoID).Scan(&oldSize, &oldMtime); err != nil {
+		return false, dbError(err)
+	}
+	mtime := modTime.UnixNano()
+	if oldSize == size && oldMtime == mtime {
+		return false, nil
+	}
+	if _, err := s.conn.ExecContext(ctx,
+		`UPDATE videos SET file_size = ?, file_mtime = ? WHERE id = ?`, size, mtime, videoID); err != nil {
+		return false, err
+	}
+	return oldMtime != 0, nil
+}
+
+func (s *SQLiteStore) DeleteVideo(ctx context.Context, id int64) error {
+	_, err := s.conn.ExecContext(ctx, "DELETE FROM videos WHERE id = ?", id)
+	return err
+}
+
+func (s *SQLiteStore) UpdateVideoPath(ctx context.Context, id, dirID int64, dirPath, filename string) error {
+	dirPath, err := s.videoDir(ctx, dirID, dirPath)
+	if err != nil {
+		return err
+	}
+	return updateOne(ctx, s.conn,
+		`UPDATE videos SET directory_id=?, directory_path=?, filename=? WHERE id=?`,
+		dirID, dirPath, filename, id)
+}
+
+func (s *SQLiteStore) UpdateVideoFields(ctx context.Context, id int64, f VideoFields) error {
+	// Structured numeric fields stay as column updates.
+	if _, err := s.conn.ExecContext(ctx,
+		`UPDATE videos SET season_number=?, episode_number=?, episode_title=?, air_date=? WHERE id=?`,
+		f.SeasonNumber, f.EpisodeNumber, f.EpisodeTitle, f.AirDate, id); err != nil {
+		return err
+	}
+	// season: tag mirrors the season_number column for sidebar filtering.
+	seasonVal := ""
+	if f.SeasonNumber > 0 {
+		seasonVal = strconv.Itoa(f.SeasonNumber)
+	}
+	if err := s.SetExclusiveSystemTag(ctx, id, "season", seasonVal); err != nil {
+		return err
+	}
+	if err := s.SetExclusiveSystemTag(ctx, id, "genre", f.Genre); err != nil {
+		return err
+	}
+	if err := s.SetExclusiveSystemTag(ctx, id, "studio", f.Studio); err != nil {
+		return err
+	}
+	if err := s.SetExclusiveSystemTag(ctx, id, "channel", f.Channel); err != nil {
+		return err
+	}
+	// Actors: split on comma, one tag per actor.
+	actors := splitActors(f.Actors)
+	return s.SetMultiSystemTag(ctx, id, "actor", actors)
+}
+
+func splitActors(actors string) []string {
+	var result []string
+	for a := range strings.SplitSeq(actors, ",") {
+		if s := strings.TrimSpace(a); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func (s *SQLiteStore) ListVideosByMinRating(ctx context.Context, minRating int) ([]Video, error) {
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT v.id, v.filename, v.directory_id, v.directory_path, v.display_name,
+		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-		       v.rating, v.original_filename,
+		       v.rating, v.stars, v.favorite, v.original_filename,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
@@ -798,7 +1411,7 @@ func (s *SQLiteStore) ListVideosByMinRating(ctx context.Context, minRating int)
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-		       v.thumbnail_path, v.duration_s, v.air_date,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
 		       wh.watched_at, v.watched
 		FROM videos v
 		LEFT JOIN watch_history wh ON v.id = wh.video_id
@@ -811,67 +1424,45 @@ func (s *SQLiteStore) ListVideosByMinRating(ctx context.Context, minRating int)
 	return scanVideos(rows)
 }
 
-func (s *SQLiteStore) SearchVideos(ctx context.Context, query string) ([]Video, error) {
-	// The FTS5 trigram tokenizer requires ≥ 3 characters to form any trigrams.
-	// For short queries fall back to LIKE, which is fast enough at that scale.
+// uniqueIDs returns ids without repeats, in first-seen order.
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	var out []int64
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// searchCondition is the WHERE condition matching query against the search
+// index. The FTS5 trigram tokenizer needs at least 3 characters to form any
+// trigrams, so shorter queries match titles and tag names with LIKE, which
+// is fast enough at that scale.
+func searchCondition(query string) (string, []any) {
 	if len([]rune(query)) >= 3 {
 		// Wrap in FTS5 phrase quotes so spaces and punctuation are treated
 		// literally (equivalent to LIKE '%query%' with the trigram tokenizer).
 		ftsQuery := `"` + strings.ReplaceAll(query, `"`, `""`) + `"`
-		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
-		rows, err := s.conn.QueryContext(ctx, `
-			SELECT v.id, v.filename, v.directory_id, v.directory_path, v.display_name,
-			       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
-			        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-			        WHERE vt.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-			       v.rating, v.original_filename,
-			       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
-			        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-			        WHERE vt.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
-			       v.season_number,
-			       v.episode_number,
-			       v.episode_title,
-			       (SELECT GROUP_CONCAT(SUBSTR(t.name, INSTR(t.name,':')+1), ', ')
-			        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-			        WHERE vt.video_id=v.id AND t.name LIKE 'actor:%') AS actors,
-			       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
-			        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-			        WHERE vt.video_id=v.id AND t.name LIKE 'studio:%' LIMIT 1) AS studio,
-			       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
-			        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-			        WHERE vt.video_id=v.id AND t.name LIKE 'channel:%' LIMIT 1) AS channel,
-			       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
-			        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-			        WHERE vt.video_id=v.id AND t.name LIKE 'type:%' LIMIT 1) AS video_type,
-			       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
-			        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
-			        WHERE vt.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-			       v.thumbnail_path, v.duration_s, v.air_date,
-			       wh.watched_at, v.watched
-			FROM videos v
-			JOIN videos_fts ON videos_fts.rowid = v.id
-			LEFT JOIN watch_history wh ON v.id = wh.video_id
-			WHERE videos_fts MATCH ?
-			   OR EXISTS (
-			      SELECT 1 FROM video_tags vt2
-			      JOIN tags t2 ON t2.id = vt2.tag_id
-			      WHERE vt2.video_id = v.id AND LOWER(t2.name) LIKE LOWER(?) ESCAPE '\'
-			   )
-			ORDER BY COALESCE(NULLIF(v.display_name, ''), v.filename) ASC
-		`, ftsQuery, "%"+escaped+"%")
-		if err == nil {
-			return scanVideos(rows)
-		}
-		// FTS table unavailable — fall through to LIKE.
-	}
-	// LIKE fallback: escape special chars so they are treated literally.
-	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
+		return `v.id IN (SELECT rowid FROM video_search_fts WHERE video_search_fts MATCH ?)`, []any{ftsQuery}
+	}
+	// Escape special chars so they are treated literally.
+	like := "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query) + "%"
+	return `(LOWER(COALESCE(NULLIF(v.display_name, ''), v.filename)) LIKE LOWER(?) ESCAPE '\'
+	         OR EXISTS (SELECT 1 FROM video_tags vt2 JOIN tags t2 ON t2.id = vt2.tag_id
+	                    WHERE vt2.video_id = v.id AND LOWER(t2.name) LIKE LOWER(?) ESCAPE '\'))`, []any{like, like}
+}
+
+func (s *SQLiteStore) SearchVideos(ctx context.Context, query string) ([]Video, error) {
+	cond, args := searchCondition(query)
 	rows, err := s.conn.QueryContext(ctx, `
 		SELECT v.id, v.filename, v.directory_id, v.directory_path, v.display_name,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'show:%' LIMIT 1) AS show_name,
-		       v.rating, v.original_filename,
+		       v.rating, v.stars, v.favorite, v.original_filename,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'genre:%' LIMIT 1) AS genre,
@@ -893,18 +1484,13 @@ func (s *SQLiteStore) SearchVideos(ctx context.Context, query string) ([]Video,
 		       (SELECT SUBSTR(t.name, INSTR(t.name,':')+1)
 		        FROM tags t JOIN video_tags vt ON t.id=vt.tag_id
 		        WHERE vt.video_id=v.id AND t.name LIKE 'color:%' LIMIT 1) AS color_label,
-		       v.thumbnail_path, v.duration_s, v.air_date,
+		       v.thumbnail_path, v.duration_s, v.air_date, v.width, v.height, v.file_size, v.file_mtime,
 		       wh.watched_at, v.watched
 		FROM videos v
 		LEFT JOIN watch_history wh ON v.id = wh.video_id
-		WHERE LOWER(COALESCE(NULLIF(v.display_name, ''), v.filename)) LIKE LOWER(?) ESCAPE '\'
-		   OR EXISTS (
-		      SELECT 1 FROM video_tags vt2
-		      JOIN tags t2 ON t2.id = vt2.tag_id
-		      WHERE vt2.video_id = v.id AND LOWER(t2.name) LIKE LOWER(?) ESCAPE '\'
-		   )
+		WHERE `+cond+`
 		ORDER BY COALESCE(NULLIF(v.display_name, ''), v.filename) ASC
-	`, "%"+escaped+"%", "%"+escaped+"%")
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -916,14 +1502,76 @@ func (s *SQLiteStore) SearchVideos(ctx context.Context, query string) ([]Video,
 func (s *SQLiteStore) UpsertTag(ctx context.Context, name string) (Tag, error) {
 	var t Tag
 	err := s.conn.QueryRowContext(ctx,
-		`INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO UPDATE SET name = excluded.name RETURNING id, name`,
+		`INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO UPDATE SET name = excluded.name RETURNING id, name, color, sort_order`,
 		name,
-	).Scan(&t.ID, &t.Name)
-	return t, err
+	).Scan(&t.ID, &t.Name, &t.Color, &t.SortOrder)
+	return t, dbError(err)
+}
+
+func (s *SQLiteStore) GetTag(ctx context.Context, id int64) (Tag, error) {
+	var t Tag
+	err := s.conn.QueryRowContext(ctx, `SELECT id, name, color, sort_order FROM tags WHERE id = ?`, id).Scan(&t.ID, &t.Name, &t.Color, &t.SortOrder)
+	return t, dbError(err)
+}
+
+func (s *SQLiteStore) RenameTag(ctx context.Context, id int64, name string) error {
+	return updateOne(ctx, s.conn, `UPDATE tags SET name = ? WHERE id = ?`, name, id)
+}
+
+// DeleteTag relies on the schema's cascades: video_tags and recent_tags rows
+// go with the tag (the search index triggers fire for them as well) and
+// profiles landing on it fall back to the whole library.
+func (s *SQLiteStore) DeleteTag(ctx context.Context, id int64) error {
+	return updateOne(ctx, s.conn, `DELETE FROM tags WHERE id = ?`, id)
+}
+
+func (s *SQLiteStore) SetTagStyle(ctx context.Context, id int64, color string, sortOrder int) error {
+	return updateOne(ctx, s.conn, `UPDATE tags SET color = ?, sort_order = ? WHERE id = ?`, color, sortOrder, id)
+}
+
+func (s *SQLiteStore) CountTagVideos(ctx context.Context, id int64) (int, error) {
+	var n int
+	err := s.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM video_tags WHERE tag_id = ?`, id).Scan(&n)
+	return n, err
+}
+
+func (s *SQLiteStore) MergeTags(ctx context.Context, fromID, intoID int64) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM tags WHERE id IN (?, ?)`, fromID, intoID).Scan(&n); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+	if n != 2 {
+		tx.Rollback() //nolint:errcheck
+		return ErrNotFound
+	}
+	for _, q := range []string{
+		// OR IGNORE skips videos that already carry intoID, whose fromID
+		// row goes with the tag below.
+		`INSERT OR IGNORE INTO video_tags (video_id, tag_id)
+		 SELECT video_id, ?2 FROM video_tags WHERE tag_id = ?1`,
+		`DELETE FROM video_tags WHERE tag_id = ?1`,
+		`INSERT INTO recent_tags (user_id, tag_id, used_at)
+		 SELECT user_id, ?2, used_at FROM recent_tags WHERE tag_id = ?1
+		 ON CONFLICT(user_id, tag_id) DO UPDATE SET used_at = MAX(used_at, excluded.used_at)`,
+		`UPDATE profiles SET landing_tag_id = ?2 WHERE landing_tag_id = ?1`,
+		`UPDATE archive_policies SET tag_id = ?2 WHERE tag_id = ?1`,
+		`DELETE FROM tags WHERE id = ?1`,
+	} {
+		if _, err := tx.ExecContext(ctx, q, fromID, intoID); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return dbError(err)
+		}
+	}
+	return tx.Commit()
 }
 
 func (s *SQLiteStore) ListTags(ctx context.Context) ([]Tag, error) {
-	rows, err := s.conn.QueryContext(ctx, `SELECT id, name FROM tags ORDER BY name`)
+	rows, err := s.conn.QueryContext(ctx, `SELECT id, name, color, sort_order FROM tags ORDER BY sort_order, name`)
 	if err != nil {
 		return nil, err
 	}
@@ -931,7 +1579,7 @@ func (s *SQLiteStore) ListTags(ctx context.Context) ([]Tag, error) {
 	var tags []Tag
 	for rows.Next() {
 		var t Tag
-		if err := rows.Scan(&t.ID, &t.Name); err != nil {
+		if err := rows.Scan(&t.ID, &t.Name, &t.Color, &t.SortOrder); err != nil {
 			return nil, err
 		}
 		tags = append(tags, t)
@@ -939,9 +1587,34 @@ func (s *SQLiteStore) ListTags(ctx context.Context) ([]Tag, error) {
 	return tags, rows.Err()
 }
 
+func (s *SQLiteStore) ListTagRatings(ctx context.Context) ([]TagRating, error) {
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT t.id, t.name, COUNT(*),
+		       SUM(v.rating = 1), SUM(v.rating >= 2), AVG(v.rating)
+		FROM tags t
+		JOIN video_tags vt ON vt.tag_id = t.id
+		JOIN videos v ON v.id = vt.video_id
+		GROUP BY t.id
+		ORDER BY t.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []TagRating
+	for rows.Next() {
+		var tr TagRating
+		if err := rows.Scan(&tr.ID, &tr.Name, &tr.Videos, &tr.Liked, &tr.Favourites, &tr.Average); err != nil {
+			return nil, err
+		}
+		out = append(out, tr)
+	}
+	return out, rows.Err()
+}
+
 func (s *SQLiteStore) TagVideo(ctx context.Context, videoID, tagID int64) error {
 	_, err := s.conn.ExecContext(ctx, `INSERT OR IGNORE INTO video_tags (video_id, tag_id) VALUES (?, ?)`, videoID, tagID)
-	return err
+	return dbError(err)
 }
 
 func (s *SQLiteStore) UntagVideo(ctx context.Context, videoID, tagID int64) error {
@@ -949,6 +1622,45 @@ func (s *SQLiteStore) UntagVideo(ctx context.Context, videoID, tagID int64) erro
 	return err
 }
 
+func (s *SQLiteStore) BatchUpdateTags(ctx context.Context, videoIDs []int64, add []string, remove []int64) ([]Tag, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	added := make([]Tag, 0, len(add))
+	for _, name := range add {
+		var t Tag
+		if err := tx.QueryRowContext(ctx,
+			`INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO UPDATE SET name = excluded.name RETURNING id, name`,
+			name,
+		).Scan(&t.ID, &t.Name); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return nil, err
+		}
+		added = append(added, t)
+	}
+	for _, videoID := range videoIDs {
+		for _, t := range added {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT OR IGNORE INTO video_tags (video_id, tag_id) VALUES (?, ?)`, videoID, t.ID); err != nil {
+				tx.Rollback() //nolint:errcheck
+				return nil, err
+			}
+		}
+		for _, tagID := range remove {
+			if _, err := tx.ExecContext(ctx,
+				`DELETE FROM video_tags WHERE video_id = ? AND tag_id = ?`, videoID, tagID); err != nil {
+				tx.Rollback() //nolint:errcheck
+				return nil, err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
 func (s *SQLiteStore) PruneOrphanTags(ctx context.Context) error {
 	_, err := s.conn.ExecContext(ctx,
 		`DELETE FROM tags WHERE id NOT IN (SELECT DISTINCT tag_id FROM video_tags)`)
@@ -957,10 +1669,10 @@ func (s *SQLiteStore) PruneOrphanTags(ctx context.Context) error {
 
 func (s *SQLiteStore) ListTagsByVideo(ctx context.Context, videoID int64) ([]Tag, error) {
 	rows, err := s.conn.QueryContext(ctx, `
-		SELECT t.id, t.name FROM tags t
+		SELECT t.id, t.name, t.color, t.sort_order FROM tags t
 		JOIN video_tags vt ON t.id = vt.tag_id
 		WHERE vt.video_id = ?
-		ORDER BY t.name
+		ORDER BY t.sort_order, t.name
 	`, videoID)
 	if err != nil {
 		return nil, err
@@ -969,7 +1681,7 @@ func (s *SQLiteStore) ListTagsByVideo(ctx context.Context, videoID int64) ([]Tag
 	var tags []Tag
 	for rows.Next() {
 		var t Tag
-		if err := rows.Scan(&t.ID, &t.Name); err != nil {
+		if err := rows.Scan(&t.ID, &t.Name, &t.Color, &t.SortOrder); err != nil {
 			return nil, err
 		}
 		tags = append(tags, t)
@@ -977,42 +1689,154 @@ func (s *SQLiteStore) ListTagsByVideo(ctx context.Context, videoID int64) ([]Tag
 	return tags, rows.Err()
 }
 
-// SetExclusiveSystemTag removes all tags with prefix "namespace:" from the video
-// and upserts "namespace:value". Empty value just removes existing tags.
-func (s *SQLiteStore) SetExclusiveSystemTag(ctx context.Context, videoID int64, namespace, value string) error {
-	// Remove existing tags for this namespace from this video.
-	if _, err := s.conn.ExecContext(ctx, `
-		DELETE FROM video_tags WHERE video_id = ? AND tag_id IN (
-			SELECT id FROM tags WHERE name LIKE ?
-		)`, videoID, namespace+":%"); err != nil {
-		return err
+func (s *SQLiteStore) ListTagsByVideos(ctx context.Context, videoIDs []int64) (map[int64][]Tag, error) {
+	out := make(map[int64][]Tag)
+	if len(videoIDs) == 0 {
+		return out, nil
 	}
-	if value == "" {
-		return nil
+	args := make([]any, len(videoIDs))
+	for i, id := range videoIDs {
+		args[i] = id
 	}
-	name := namespace + ":" + value
-	if _, err := s.conn.ExecContext(ctx,
-		`INSERT OR IGNORE INTO tags (name) VALUES (?)`, name); err != nil {
-		return err
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT vt.video_id, t.id, t.name, t.color, t.sort_order FROM tags t
+		JOIN video_tags vt ON t.id = vt.tag_id
+		WHERE vt.video_id IN (?`+strings.Repeat(",?", len(videoIDs)-1)+`)
+		ORDER BY t.sort_order, t.name
+	`, args...)
+	if err != nil {
+		return nil, err
 	}
-	_, err := s.conn.ExecContext(ctx,
-		`INSERT OR IGNORE INTO video_tags (video_id, tag_id)
-		 SELECT ?, id FROM tags WHERE name = ?`, videoID, name)
-	return err
+	defer rows.Close()
+	for rows.Next() {
+		var videoID int64
+		var t Tag
+		if err := rows.Scan(&videoID, &t.ID, &t.Name, &t.Color, &t.SortOrder); err != nil {
+			return nil, err
+		}
+		out[videoID] = append(out[videoID], t)
+	}
+	return out, rows.Err()
 }
 
-// SetMultiSystemTag removes all tags with prefix "namespace:" then adds one tag
-// per value in values (empty strings skipped).
-func (s *SQLiteStore) SetMultiSystemTag(ctx context.Context, videoID int64, namespace string, values []string) error {
-	// Remove all existing tags for this namespace from this video.
-	if _, err := s.conn.ExecContext(ctx, `
-		DELETE FROM video_tags WHERE video_id = ? AND tag_id IN (
-			SELECT id FROM tags WHERE name LIKE ?
-		)`, videoID, namespace+":%"); err != nil {
-		return err
-	}
-	for _, value := range values {
-		if value == "" {
+func (s *SQLiteStore) SuggestTags(ctx context.Context, query string, limit int) ([]TagCount, error) {
+	// Escape special chars so they are treated literally.
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT t.id, t.name, COUNT(vt.video_id) AS n FROM tags t
+		LEFT JOIN video_tags vt ON t.id = vt.tag_id
+		WHERE LOWER(t.name) LIKE LOWER(?) ESCAPE '\' AND INSTR(t.name, ':') = 0
+		GROUP BY t.id
+		ORDER BY n DESC, t.name
+		LIMIT ?
+	`, "%"+escaped+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tags []TagCount
+	for rows.Next() {
+		var t TagCount
+		if err := rows.Scan(&t.ID, &t.Name, &t.Videos); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func (s *SQLiteStore) ListTagCounts(ctx context.Context) ([]TagCount, error) {
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT t.id, t.name, t.color, t.sort_order, COUNT(vt.video_id) FROM tags t
+		LEFT JOIN video_tags vt ON t.id = vt.tag_id
+		WHERE INSTR(t.name, ':') = 0
+		GROUP BY t.id
+		ORDER BY t.sort_order, t.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tags []TagCount
+	for rows.Next() {
+		var t TagCount
+		if err := rows.Scan(&t.ID, &t.Name, &t.Color, &t.SortOrder, &t.Videos); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func (s *SQLiteStore) RecordTagUse(ctx context.Context, userID, tagID int64) error {
+	_, err := s.conn.ExecContext(ctx, `
+		INSERT INTO recent_tags (user_id, tag_id) VALUES (?, ?)
+		ON CONFLICT(user_id, tag_id) DO UPDATE SET used_at = excluded.used_at`, userID, tagID)
+	return dbError(err)
+}
+
+func (s *SQLiteStore) ListRecentTags(ctx context.Context, userID int64, limit int) ([]Tag, error) {
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT t.id, t.name FROM recent_tags r
+		JOIN tags t ON t.id = r.tag_id
+		WHERE r.user_id = ?
+		ORDER BY r.used_at DESC
+		LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tags []Tag
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// SetExclusiveSystemTag removes all tags with prefix "namespace:" from the video
+// and upserts "namespace:value". Empty value just removes existing tags.
+func (s *SQLiteStore) SetExclusiveSystemTag(ctx context.Context, videoID int64, namespace, value string) error {
+	return setExclusiveSystemTag(ctx, s.conn, videoID, namespace, value)
+}
+
+func setExclusiveSystemTag(ctx context.Context, q execer, videoID int64, namespace, value string) error {
+	// Remove existing tags for this namespace from this video.
+	if _, err := q.ExecContext(ctx, `
+		DELETE FROM video_tags WHERE video_id = ? AND tag_id IN (
+			SELECT id FROM tags WHERE name LIKE ?
+		)`, videoID, namespace+":%"); err != nil {
+		return err
+	}
+	if value == "" {
+		return nil
+	}
+	name := namespace + ":" + value
+	if _, err := q.ExecContext(ctx,
+		`INSERT OR IGNORE INTO tags (name) VALUES (?)`, name); err != nil {
+		return err
+	}
+	_, err := q.ExecContext(ctx,
+		`INSERT OR IGNORE INTO video_tags (video_id, tag_id)
+		 SELECT ?, id FROM tags WHERE name = ?`, videoID, name)
+	return err
+}
+
+// SetMultiSystemTag removes all tags with prefix "namespace:" then adds one tag
+// per value in values (empty strings skipped).
+func (s *SQLiteStore) SetMultiSystemTag(ctx context.Context, videoID int64, namespace string, values []string) error {
+	// Remove all existing tags for this namespace from this video.
+	if _, err := s.conn.ExecContext(ctx, `
+		DELETE FROM video_tags WHERE video_id = ? AND tag_id IN (
+			SELECT id FROM tags WHERE name LIKE ?
+		)`, videoID, namespace+":%"); err != nil {
+		return err
+	}
+	for _, value := range values {
+		if value == "" {
 			continue
 		}
 		name := namespace + ":" + value
@@ -1036,14 +1860,15 @@ func scanVideoRow(row *sql.Row) (Video, error) {
 	var dirID sql.NullInt64
 	var showName, genre, actors, studio, channel, videoType, colorLabel, thumbnailPath, watchedAt, airDate sql.NullString
 	var watched int
+	var mtime int64
 	if err := row.Scan(
-		&v.ID, &v.Filename, &dirID, &v.DirectoryPath, &v.DisplayName, &showName, &v.Rating, &v.OriginalFilename,
+		&v.ID, &v.Filename, &dirID, &v.DirectoryPath, &v.DisplayName, &showName, &v.Rating, &v.Stars, &v.Favorite, &v.OriginalFilename,
 		&genre, &v.SeasonNumber, &v.EpisodeNumber, &v.EpisodeTitle, &actors, &studio, &channel, &videoType,
 		&colorLabel,
-		&thumbnailPath, &v.DurationS, &airDate,
+		&thumbnailPath, &v.DurationS, &airDate, &v.Width, &v.Height, &v.FileSize, &mtime,
 		&watchedAt, &watched,
 	); err != nil {
-		return Video{}, err
+		return Video{}, dbError(err)
 	}
 	if dirID.Valid {
 		v.DirectoryID = dirID.Int64
@@ -1061,6 +1886,9 @@ func scanVideoRow(row *sql.Row) (Video, error) {
 		v.WatchedAt = watchedAt.String
 	}
 	v.Watched = watched != 0
+	if mtime != 0 {
+		v.FileModTime = time.Unix(0, mtime)
+	}
 	return v, nil
 }
 
@@ -1072,11 +1900,12 @@ func scanVideos(rows *sql.Rows) ([]Video, error) {
 		var dirID sql.NullInt64
 		var showName, genre, actors, studio, channel, videoType, colorLabel, thumbnailPath, watchedAt, airDate sql.NullString
 		var watched int
+		var mtime int64
 		if err := rows.Scan(
-			&v.ID, &v.Filename, &dirID, &v.DirectoryPath, &v.DisplayName, &showName, &v.Rating, &v.OriginalFilename,
+			&v.ID, &v.Filename, &dirID, &v.DirectoryPath, &v.DisplayName, &showName, &v.Rating, &v.Stars, &v.Favorite, &v.OriginalFilename,
 			&genre, &v.SeasonNumber, &v.EpisodeNumber, &v.EpisodeTitle, &actors, &studio, &channel, &videoType,
 			&colorLabel,
-			&thumbnailPath, &v.DurationS, &airDate,
+			&thumbnailPath, &v.DurationS, &airDate, &v.Width, &v.Height, &v.FileSize, &mtime,
 			&watchedAt, &watched,
 		); err != nil {
 			return nil, err
@@ -1097,6 +1926,9 @@ func scanVideos(rows *sql.Rows) ([]Video, error) {
 			v.WatchedAt = watchedAt.String
 		}
 		v.Watched = watched != 0
+		if mtime != 0 {
+			v.FileModTime = time.Unix(0, mtime)
+		}
 		videos = append(videos, v)
 	}
 	return videos, rows.Err()
@@ -1187,18 +2019,106 @@ func (s *SQLiteStore) PruneExpiredSessions(ctx context.Context) error {
 	return err
 }
 
+func (s *SQLiteStore) SetSessionUser(ctx context.Context, token string, userID int64) error {
+	_, err := s.conn.ExecContext(ctx, `UPDATE sessions SET user_id = ? WHERE token = ?`, userID, token)
+	return err
+}
+
+func (s *SQLiteStore) LoadSessionUsers(ctx context.Context) (map[string]int64, error) {
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT token, user_id FROM sessions WHERE user_id IS NOT NULL AND expires_at > ?`, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	m := make(map[string]int64)
+	for rows.Next() {
+		var token string
+		var userID int64
+		if err := rows.Scan(&token, &userID); err != nil {
+			return nil, err
+		}
+		m[token] = userID
+	}
+	return m, rows.Err()
+}
+
+// --- Users ---
+
+const userColumns = "id, username, role, created_at"
+
+func scanUser(scan func(dest ...any) error) (User, error) {
+	var u User
+	err := scan(&u.ID, &u.Username, &u.Role, &u.CreatedAt)
+	return u, dbError(err)
+}
+
+func (s *SQLiteStore) CreateUser(ctx context.Context, username, passwordHash, role string) (User, error) {
+	row := s.conn.QueryRowContext(ctx,
+		`INSERT INTO users (username, password_hash, role) VALUES (?, ?, ?) RETURNING `+userColumns,
+		username, passwordHash, role)
+	return scanUser(row.Scan)
+}
+
+func (s *SQLiteStore) GetUser(ctx context.Context, id int64) (User, error) {
+	row := s.conn.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+	return scanUser(row.Scan)
+}
+
+func (s *SQLiteStore) GetUserByName(ctx context.Context, username string) (User, string, error) {
+	var u User
+	var hash string
+	err := s.conn.QueryRowContext(ctx,
+		`SELECT `+userColumns+`, password_hash FROM users WHERE username = ?`, username).
+		Scan(&u.ID, &u.Username, &u.Role, &u.CreatedAt, &hash)
+	return u, hash, dbError(err)
+}
+
+func (s *SQLiteStore) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := s.conn.QueryContext(ctx, `SELECT `+userColumns+` FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []User
+	for rows.Next() {
+		u, err := scanUser(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) SetUserRole(ctx context.Context, id int64, role string) error {
+	return s.updateUser(ctx, `UPDATE users SET role = ? WHERE id = ?`, role, id)
+}
+
+func (s *SQLiteStore) SetUserPassword(ctx context.Context, id int64, passwordHash string) error {
+	return s.updateUser(ctx, `UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, id)
+}
+
+func (s *SQLiteStore) DeleteUser(ctx context.Context, id int64) error {
+	// recent_tags.user_id, notifications.user_id and
+	// report_subscriptions.user_id have no foreign key (0 is not an
+	// account), so the account's rows are removed by hand.
+	for _, table := range []string{"recent_tags", "notifications", "report_subscriptions"} {
+		if _, err := s.conn.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = ?`, id); err != nil {
+			return err
+		}
+	}
+	return s.updateUser(ctx, `DELETE FROM users WHERE id = ?`, id)
+}
+
+func (s *SQLiteStore) updateUser(ctx context.Context, query string, args ...any) error {
+	return updateOne(ctx, s.conn, query, args...)
+}
+
 // --- Watch history ---
 
 func (s *SQLiteStore) RecordWatch(ctx context.Context, videoID int64, position float64) error {
-	// Upsert position/timestamp in watch_history.
-	_, err := s.conn.ExecContext(ctx, `
-		INSERT INTO watch_history (video_id, position, watched_at)
-		VALUES (?, ?, datetime('now'))
-		ON CONFLICT (video_id) DO UPDATE SET
-			position   = excluded.position,
-			watched_at = excluded.watched_at
-	`, videoID, position)
-	if err != nil {
+	if err := s.RecordProgress(ctx, videoID, position); err != nil {
 		return err
 	}
 	// Only flip watched 0→1 (avoids duplicate watch_events on repeated progress saves).
@@ -1214,6 +2134,18 @@ func (s *SQLiteStore) RecordWatch(ctx context.Context, videoID int64, position f
 	return err
 }
 
+func (s *SQLiteStore) RecordProgress(ctx context.Context, videoID int64, position float64) error {
+	// Upsert position/timestamp in watch_history.
+	_, err := s.conn.ExecContext(ctx, `
+		INSERT INTO watch_history (video_id, position, watched_at)
+		VALUES (?, ?, datetime('now'))
+		ON CONFLICT (video_id) DO UPDATE SET
+			position   = excluded.position,
+			watched_at = excluded.watched_at
+	`, videoID, position)
+	return dbError(err)
+}
+
 func (s *SQLiteStore) ClearWatch(ctx context.Context, videoID int64) error {
 	if _, err := s.conn.ExecContext(ctx,
 		`UPDATE videos SET watched = 0 WHERE id = ?`, videoID); err != nil {
@@ -1231,7 +2163,7 @@ func (s *SQLiteStore) GetWatch(ctx context.Context, videoID int64) (WatchRecord,
 	`, videoID)
 	var w WatchRecord
 	if err := row.Scan(&w.VideoID, &w.Position, &w.WatchedAt); err != nil {
-		return WatchRecord{}, err
+		return WatchRecord{}, dbError(err)
 	}
 	return w, nil
 }
@@ -1252,3 +2184,1296 @@ func (s *SQLiteStore) ListWatchHistory(ctx context.Context) (map[int64]WatchReco
 	}
 	return m, rows.Err()
 }
+
+func (s *SQLiteStore) ListInProgress(ctx context.Context, minPosition, finishedAt float64, limit int) ([]WatchRecord, error) {
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT w.video_id, w.position, w.watched_at
+		FROM watch_history w JOIN videos v ON v.id = w.video_id
+		WHERE w.position > ? AND (v.duration_s <= 0 OR w.position < v.duration_s * ?)
+		ORDER BY w.watched_at DESC, w.video_id DESC
+		LIMIT ?`, minPosition, finishedAt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WatchRecord
+	for rows.Next() {
+		var w WatchRecord
+		if err := rows.Scan(&w.VideoID, &w.Position, &w.WatchedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) SetVideoSidecars(ctx context.Context, videoID int64, sidecars []Sidecar) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := setVideoSidecars(ctx, tx, videoID, sidecars); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+	return tx.Commit()
+}
+
+func setVideoSidecars(ctx context.Context, q execer, videoID int64, sidecars []Sidecar) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM video_sidecars WHERE video_id = ?`, videoID); err != nil {
+		return err
+	}
+	for _, sc := range sidecars {
+		if _, err := q.ExecContext(ctx,
+			`INSERT OR IGNORE INTO video_sidecars (video_id, kind, path) VALUES (?, ?, ?)`,
+			videoID, sc.Kind, sc.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListVideoSidecars(ctx context.Context, videoID int64) ([]Sidecar, error) {
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT kind, path FROM video_sidecars WHERE video_id = ? ORDER BY path`, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Sidecar
+	for rows.Next() {
+		var sc Sidecar
+		if err := rows.Scan(&sc.Kind, &sc.Path); err != nil {
+			return nil, err
+		}
+		out = append(out, sc)
+	}
+	return out, rows.Err()
+}
+
+const profileColumns = "id, name, COALESCE(landing_tag_id, 0), landing_sort, daily_minutes"
+
+func scanProfile(scan func(dest ...any) error) (Profile, error) {
+	var p Profile
+	err := scan(&p.ID, &p.Name, &p.LandingTagID, &p.LandingSort, &p.DailyMinutes)
+	return p, dbError(err)
+}
+
+func (s *SQLiteStore) CreateProfile(ctx context.Context, name string) (Profile, error) {
+	row := s.conn.QueryRowContext(ctx,
+		`INSERT INTO profiles (name) VALUES (?) RETURNING `+profileColumns, name)
+	return scanProfile(row.Scan)
+}
+
+func (s *SQLiteStore) GetProfile(ctx context.Context, id int64) (Profile, error) {
+	row := s.conn.QueryRowContext(ctx, `SELECT `+profileColumns+` FROM profiles WHERE id = ?`, id)
+	return scanProfile(row.Scan)
+}
+
+func (s *SQLiteStore) ListProfiles(ctx context.Context) ([]Profile, error) {
+	rows, err := s.conn.QueryContext(ctx, `SELECT `+profileColumns+` FROM profiles ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Profile
+	for rows.Next() {
+		p, err := scanProfile(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) SetProfileLanding(ctx context.Context, id, tagID int64, sort string) error {
+	landingTag := sql.NullInt64{Int64: tagID, Valid: tagID != 0}
+	return updateOne(ctx, s.conn,
+		`UPDATE profiles SET landing_tag_id = ?, landing_sort = ? WHERE id = ?`, landingTag, sort, id)
+}
+
+func (s *SQLiteStore) SetProfileQuota(ctx context.Context, id int64, minutes int) error {
+	return updateOne(ctx, s.conn, `UPDATE profiles SET daily_minutes = ? WHERE id = ?`, minutes, id)
+}
+
+func (s *SQLiteStore) GetProfileDay(ctx context.Context, id int64, day string) (ProfileDay, error) {
+	var d ProfileDay
+	err := s.conn.QueryRowContext(ctx, `
+		SELECT watched_seconds, granted_seconds FROM profile_watch_time
+		WHERE profile_id = ? AND day = ?`, id, day).Scan(&d.WatchedSeconds, &d.GrantedSeconds)
+	if err == sql.ErrNoRows {
+		return ProfileDay{}, nil
+	}
+	return d, err
+}
+
+func (s *SQLiteStore) AddProfileWatchTime(ctx context.Context, id int64, day string, watched, granted float64) error {
+	_, err := s.conn.ExecContext(ctx, `
+		INSERT INTO profile_watch_time (profile_id, day, watched_seconds, granted_seconds)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(profile_id, day) DO UPDATE SET
+			watched_seconds = watched_seconds + excluded.watched_seconds,
+			granted_seconds = granted_seconds + excluded.granted_seconds`,
+		id, day, watched, granted)
+	return dbError(err)
+}
+
+func (s *SQLiteStore) DeleteProfile(ctx context.Context, id int64) error {
+	_, err := s.conn.ExecContext(ctx, `DELETE FROM profiles WHERE id = ?`, id)
+	return err
+}
+
+func (s *SQLiteStore) SetDirectoryExtras(ctx context.Context, dirID int64, links []ExtraLink) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM video_extras WHERE manual = 0
+		AND video_id IN (SELECT id FROM videos WHERE directory_id = ?)`, dirID); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+	for _, l := range links {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR IGNORE INTO video_extras (video_id, main_id, kind) VALUES (?, ?, ?)`,
+			l.VideoID, l.MainID, l.Kind); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return dbError(err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) LinkExtra(ctx context.Context, link ExtraLink) error {
+	var mainID any
+	if link.MainID != 0 {
+		mainID = link.MainID
+	}
+	_, err := s.conn.ExecContext(ctx, `
+		INSERT INTO video_extras (video_id, main_id, show_name, kind, manual) VALUES (?, ?, ?, ?, 1)
+		ON CONFLICT(video_id) DO UPDATE SET
+			main_id = excluded.main_id, show_name = excluded.show_name,
+			kind = excluded.kind, manual = 1`,
+		link.VideoID, mainID, link.ShowName, link.Kind)
+	return dbError(err)
+}
+
+func (s *SQLiteStore) UnlinkExtra(ctx context.Context, videoID int64) error {
+	return updateOne(ctx, s.conn, `
+		UPDATE video_extras SET main_id = NULL, show_name = '', kind = '', manual = 1
+		WHERE video_id = ? AND kind != ''`, videoID)
+}
+
+func (s *SQLiteStore) GetExtraLink(ctx context.Context, videoID int64) (ExtraLink, error) {
+	l := ExtraLink{VideoID: videoID}
+	var mainID sql.NullInt64
+	err := s.conn.QueryRowContext(ctx, `
+		SELECT main_id, show_name, kind FROM video_extras WHERE video_id = ? AND kind != ''`,
+		videoID).Scan(&mainID, &l.ShowName, &l.Kind)
+	l.MainID = mainID.Int64
+	return l, dbError(err)
+}
+
+func (s *SQLiteStore) ListVideoExtras(ctx context.Context, mainID int64) ([]VideoExtra, error) {
+	return s.listExtras(ctx, `ve.main_id = ?`, mainID)
+}
+
+func (s *SQLiteStore) ListShowExtras(ctx context.Context, showName string) ([]VideoExtra, error) {
+	return s.listExtras(ctx, `ve.main_id IS NULL AND ve.show_name = ? AND ve.kind != ''`, showName)
+}
+
+// listExtras returns the extras matching where, a condition on video_extras
+// ve, ordered by filename.
+func (s *SQLiteStore) listExtras(ctx context.Context, where string, args ...any) ([]VideoExtra, error) {
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT ve.video_id, ve.kind FROM video_extras ve
+		JOIN videos v ON v.id = ve.video_id
+		WHERE `+where+`
+		ORDER BY v.filename`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var links []ExtraLink
+	for rows.Next() {
+		var l ExtraLink
+		if err := rows.Scan(&l.VideoID, &l.Kind); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]VideoExtra, 0, len(links))
+	for _, l := range links {
+		v, err := s.GetVideo(ctx, l.VideoID)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, VideoExtra{Video: v, Kind: l.Kind})
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) ListExtraVideoIDs(ctx context.Context) (map[int64]bool, error) {
+	rows, err := s.conn.QueryContext(ctx, `SELECT video_id FROM video_extras WHERE kind != ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out[id] = true
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) SetDirectoryCompanions(ctx context.Context, dirID int64, clips []CompanionClip) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM photo_companions
+		WHERE video_id IN (SELECT id FROM videos WHERE directory_id = ?)`, dirID); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+	for _, c := range clips {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO photo_companions (video_id, photo) VALUES (?, ?)`,
+			c.VideoID, c.Photo); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return dbError(err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetCompanionClip(ctx context.Context, videoID int64) (CompanionClip, error) {
+	c := CompanionClip{VideoID: videoID}
+	err := s.conn.QueryRowContext(ctx,
+		`SELECT photo FROM photo_companions WHERE video_id = ?`, videoID).Scan(&c.Photo)
+	return c, dbError(err)
+}
+
+func (s *SQLiteStore) ListCompanionVideoIDs(ctx context.Context) (map[int64]bool, error) {
+	rows, err := s.conn.QueryContext(ctx, `SELECT video_id FROM photo_companions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out[id] = true
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) SetVideoSource(ctx context.Context, videoID int64, src VideoSource) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO video_sources (video_id, extractor, source_id, url, uploader, upload_date)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(video_id) DO UPDATE SET
+			extractor = excluded.extractor, source_id = excluded.source_id,
+			url = excluded.url, uploader = excluded.uploader, upload_date = excluded.upload_date`,
+		videoID, src.Extractor, src.ID, src.URL, src.Uploader, src.UploadDate); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return dbError(err)
+	}
+	// A YouTube download's ID is also its external ID, e.g. for SponsorBlock.
+	if src.Extractor == ExternalYouTube && src.ID != "" {
+		if err := setVideoExternalID(ctx, tx, videoID, ExternalYouTube, src.ID); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetVideoSource(ctx context.Context, videoID int64) (VideoSource, error) {
+	var src VideoSource
+	err := s.conn.QueryRowContext(ctx,
+		`SELECT extractor, source_id, url, uploader, upload_date FROM video_sources WHERE video_id = ?`, videoID).
+		Scan(&src.Extractor, &src.ID, &src.URL, &src.Uploader, &src.UploadDate)
+	return src, dbError(err)
+}
+
+func (s *SQLiteStore) SetVideoExternalID(ctx context.Context, videoID int64, provider, id string) error {
+	return setVideoExternalID(ctx, s.conn, videoID, provider, id)
+}
+
+func setVideoExternalID(ctx context.Context, q execer, videoID int64, provider, id string) error {
+	var err error
+	if id == "" {
+		_, err = q.ExecContext(ctx,
+			`DELETE FROM video_external_ids WHERE video_id = ? AND provider = ?`, videoID, provider)
+	} else {
+		_, err = q.ExecContext(ctx, `
+			INSERT INTO video_external_ids (video_id, provider, external_id) VALUES (?, ?, ?)
+			ON CONFLICT(video_id, provider) DO UPDATE SET external_id = excluded.external_id`,
+			videoID, provider, id)
+	}
+	return dbError(err)
+}
+
+func (s *SQLiteStore) ListVideoExternalIDs(ctx context.Context, videoID int64) (map[string]string, error) {
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT provider, external_id FROM video_external_ids WHERE video_id = ?`, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]string)
+	for rows.Next() {
+		var provider, id string
+		if err := rows.Scan(&provider, &id); err != nil {
+			return nil, err
+		}
+		out[provider] = id
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) FindVideoByExternalID(ctx context.Context, provider, id string) (int64, error) {
+	var videoID int64
+	err := s.conn.QueryRowContext(ctx,
+		`SELECT video_id FROM video_external_ids WHERE provider = ? AND external_id = ? ORDER BY video_id LIMIT 1`,
+		provider, id).Scan(&videoID)
+	return videoID, dbError(err)
+}
+
+func (s *SQLiteStore) SaveShow(ctx context.Context, show Show) (Show, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return Show{}, err
+	}
+	var id int64
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO shows (name, overview, poster_path) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			overview = CASE WHEN excluded.overview != '' THEN excluded.overview ELSE overview END,
+			poster_path = CASE WHEN excluded.poster_path != '' THEN excluded.poster_path ELSE poster_path END
+		RETURNING id`,
+		show.Name, show.Overview, show.PosterPath).Scan(&id); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return Show{}, dbError(err)
+	}
+	for provider, extID := range show.ExternalIDs {
+		if extID == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO show_external_ids (show_id, provider, external_id) VALUES (?, ?, ?)
+			ON CONFLICT(show_id, provider) DO UPDATE SET external_id = excluded.external_id`,
+			id, provider, extID); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return Show{}, dbError(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Show{}, err
+	}
+	return s.GetShow(ctx, show.Name)
+}
+
+const showColumns = `id, name, overview, poster_path,
+	status, next_season, next_episode, next_title, next_airs, next_notified`
+
+func scanShow(scan func(dest ...any) error) (Show, error) {
+	var sh Show
+	var airs int64
+	a := &sh.Airing
+	if err := scan(&sh.ID, &sh.Name, &sh.Overview, &sh.PosterPath,
+		&a.Status, &a.Next.Season, &a.Next.Episode, &a.Next.Title, &airs, &a.Notified); err != nil {
+		return Show{}, dbError(err)
+	}
+	if airs > 0 {
+		a.NextAirs = time.Unix(airs, 0)
+		a.Next.AirDate = a.NextAirs.Format(time.DateOnly)
+	}
+	return sh, nil
+}
+
+func (s *SQLiteStore) GetShow(ctx context.Context, name string) (Show, error) {
+	sh, err := scanShow(s.conn.QueryRowContext(ctx,
+		`SELECT `+showColumns+` FROM shows WHERE name = ?`, name).Scan)
+	if err != nil {
+		return Show{}, err
+	}
+	shows := []Show{sh}
+	if err := s.loadShowExternalIDs(ctx, shows); err != nil {
+		return Show{}, err
+	}
+	return shows[0], nil
+}
+
+func (s *SQLiteStore) ListShows(ctx context.Context) ([]Show, error) {
+	rows, err := s.conn.QueryContext(ctx, `SELECT `+showColumns+` FROM shows ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Show
+	for rows.Next() {
+		sh, err := scanShow(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sh)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, s.loadShowExternalIDs(ctx, out)
+}
+
+func (s *SQLiteStore) SetShowAiring(ctx context.Context, showID int64, airing ShowAiring) error {
+	var airs int64
+	if !airing.NextAirs.IsZero() {
+		airs = airing.NextAirs.Unix()
+	}
+	return updateOne(ctx, s.conn, `
+		UPDATE shows SET status = ?, next_season = ?, next_episode = ?, next_title = ?,
+			next_airs = ?, next_notified = ?
+		WHERE id = ?`,
+		airing.Status, airing.Next.Season, airing.Next.Episode, airing.Next.Title,
+		airs, airing.Notified, showID)
+}
+
+func (s *SQLiteStore) SetShowEpisodes(ctx context.Context, showID int64, episodes []ShowEpisode) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM show_episodes WHERE show_id = ?`, showID); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+	for _, e := range episodes {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO show_episodes (show_id, season, episode, title, air_date) VALUES (?, ?, ?, ?, ?)`,
+			showID, e.Season, e.Episode, e.Title, e.AirDate); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return dbError(err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) ListShowEpisodes(ctx context.Context, showID int64) ([]ShowEpisode, error) {
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT season, episode, title, air_date FROM show_episodes WHERE show_id = ? ORDER BY season, episode`, showID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ShowEpisode
+	for rows.Next() {
+		var e ShowEpisode
+		if err := rows.Scan(&e.Season, &e.Episode, &e.Title, &e.AirDate); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// loadShowExternalIDs fills in each show's ExternalIDs, reading only the
+// rows for those shows.
+func (s *SQLiteStore) loadShowExternalIDs(ctx context.Context, shows []Show) error {
+	if len(shows) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*Show, len(shows))
+	args := make([]any, len(shows))
+	for i := range shows {
+		shows[i].ExternalIDs = map[string]string{}
+		byID[shows[i].ID] = &shows[i]
+		args[i] = shows[i].ID
+	}
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT show_id, provider, external_id FROM show_external_ids
+		WHERE show_id IN (?`+strings.Repeat(",?", len(shows)-1)+`)`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var provider, extID string
+		if err := rows.Scan(&id, &provider, &extID); err != nil {
+			return err
+		}
+		if sh := byID[id]; sh != nil {
+			sh.ExternalIDs[provider] = extID
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLiteStore) SaveWatchOrder(ctx context.Context, order WatchOrder) (WatchOrder, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return WatchOrder{}, err
+	}
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO watch_orders (name) VALUES (?)
+		ON CONFLICT(name) DO UPDATE SET name = excluded.name
+		RETURNING id`, order.Name).Scan(&order.ID); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return WatchOrder{}, dbError(err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM watch_order_entries WHERE order_id = ?`, order.ID); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return WatchOrder{}, err
+	}
+	for i, e := range order.Entries {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO watch_order_entries (order_id, position, show, season, episode) VALUES (?, ?, ?, ?, ?)`,
+			order.ID, i, e.Show, e.Season, e.Episode); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return WatchOrder{}, dbError(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return WatchOrder{}, err
+	}
+	return order, nil
+}
+
+func (s *SQLiteStore) GetWatchOrder(ctx context.Context, id int64) (WatchOrder, error) {
+	o := WatchOrder{ID: id}
+	if err := s.conn.QueryRowContext(ctx, `SELECT name FROM watch_orders WHERE id = ?`, id).Scan(&o.Name); err != nil {
+		return WatchOrder{}, dbError(err)
+	}
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT show, season, episode FROM watch_order_entries WHERE order_id = ? ORDER BY position`, id)
+	if err != nil {
+		return WatchOrder{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e WatchOrderEntry
+		if err := rows.Scan(&e.Show, &e.Season, &e.Episode); err != nil {
+			return WatchOrder{}, err
+		}
+		o.Entries = append(o.Entries, e)
+	}
+	return o, rows.Err()
+}
+
+func (s *SQLiteStore) ListWatchOrders(ctx context.Context) ([]WatchOrder, error) {
+	rows, err := s.conn.QueryContext(ctx, `SELECT id, name FROM watch_orders ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WatchOrder
+	for rows.Next() {
+		var o WatchOrder
+		if err := rows.Scan(&o.ID, &o.Name); err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteWatchOrder(ctx context.Context, id int64) error {
+	return updateOne(ctx, s.conn, `DELETE FROM watch_orders WHERE id = ?`, id)
+}
+
+const smartPlaylistColumns = "id, name, search, tag_ids, all_tags, video_type, directory_id, min_rating, watched, favorites, sort"
+
+func scanSmartPlaylist(scan func(dest ...any) error) (SmartPlaylist, error) {
+	var p SmartPlaylist
+	var tagIDs string
+	err := scan(&p.ID, &p.Name, &p.Query.Search, &tagIDs, &p.Query.AllTags,
+		&p.Query.Type, &p.Query.DirectoryID, &p.Query.MinRating, &p.Query.Watched, &p.Query.Favorites, &p.Query.Sort)
+	for _, f := range strings.Split(tagIDs, ",") {
+		if id, perr := strconv.ParseInt(f, 10, 64); perr == nil {
+			p.Query.TagIDs = append(p.Query.TagIDs, id)
+		}
+	}
+	return p, dbError(err)
+}
+
+func (s *SQLiteStore) SaveSmartPlaylist(ctx context.Context, p SmartPlaylist) (SmartPlaylist, error) {
+	tagIDs := make([]string, len(p.Query.TagIDs))
+	for i, id := range p.Query.TagIDs {
+		tagIDs[i] = strconv.FormatInt(id, 10)
+	}
+	q := p.Query
+	return scanSmartPlaylist(s.conn.QueryRowContext(ctx, `
+		INSERT INTO smart_playlists (name, search, tag_ids, all_tags, video_type, directory_id, min_rating, watched, favorites, sort)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			search = excluded.search, tag_ids = excluded.tag_ids, all_tags = excluded.all_tags,
+			video_type = excluded.video_type, directory_id = excluded.directory_id, min_rating = excluded.min_rating,
+			watched = excluded.watched, favorites = excluded.favorites, sort = excluded.sort
+		RETURNING `+smartPlaylistColumns,
+		p.Name, q.Search, strings.Join(tagIDs, ","), q.AllTags, q.Type, q.DirectoryID, q.MinRating, q.Watched, q.Favorites, q.Sort).Scan)
+}
+
+func (s *SQLiteStore) GetSmartPlaylist(ctx context.Context, id int64) (SmartPlaylist, error) {
+	return scanSmartPlaylist(s.conn.QueryRowContext(ctx,
+		`SELECT `+smartPlaylistColumns+` FROM smart_playlists WHERE id = ?`, id).Scan)
+}
+
+func (s *SQLiteStore) ListSmartPlaylists(ctx context.Context) ([]SmartPlaylist, error) {
+	rows, err := s.conn.QueryContext(ctx, `SELECT `+smartPlaylistColumns+` FROM smart_playlists ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []SmartPlaylist
+	for rows.Next() {
+		p, err := scanSmartPlaylist(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteSmartPlaylist(ctx context.Context, id int64) error {
+	return updateOne(ctx, s.conn, `DELETE FROM smart_playlists WHERE id = ?`, id)
+}
+
+const archivePolicyColumns = "id, name, tag_id, video_type, action, days, directory_id"
+
+func scanArchivePolicy(scan func(dest ...any) error) (ArchivePolicy, error) {
+	var p ArchivePolicy
+	err := scan(&p.ID, &p.Name, &p.TagID, &p.VideoType, &p.Action, &p.Days, &p.DirectoryID)
+	return p, dbError(err)
+}
+
+func (s *SQLiteStore) SaveArchivePolicy(ctx context.Context, p ArchivePolicy) (ArchivePolicy, error) {
+	return scanArchivePolicy(s.conn.QueryRowContext(ctx, `
+		INSERT INTO archive_policies (name, tag_id, video_type, action, days, directory_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			tag_id = excluded.tag_id, video_type = excluded.video_type, action = excluded.action,
+			days = excluded.days, directory_id = excluded.directory_id
+		RETURNING `+archivePolicyColumns,
+		p.Name, p.TagID, p.VideoType, p.Action, p.Days, p.DirectoryID).Scan)
+}
+
+func (s *SQLiteStore) GetArchivePolicy(ctx context.Context, id int64) (ArchivePolicy, error) {
+	return scanArchivePolicy(s.conn.QueryRowContext(ctx,
+		`SELECT `+archivePolicyColumns+` FROM archive_policies WHERE id = ?`, id).Scan)
+}
+
+func (s *SQLiteStore) ListArchivePolicies(ctx context.Context) ([]ArchivePolicy, error) {
+	rows, err := s.conn.QueryContext(ctx, `SELECT `+archivePolicyColumns+` FROM archive_policies ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ArchivePolicy
+	for rows.Next() {
+		p, err := scanArchivePolicy(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteArchivePolicy(ctx context.Context, id int64) error {
+	return updateOne(ctx, s.conn, `DELETE FROM archive_policies WHERE id = ?`, id)
+}
+
+func (s *SQLiteStore) SetArchiveProposals(ctx context.Context, proposed map[int64]int64, at time.Time) error {
+	rows, err := s.conn.QueryContext(ctx, `SELECT video_id, policy_id FROM archive_proposals`)
+	if err != nil {
+		return err
+	}
+	have := map[int64]int64{}
+	for rows.Next() {
+		var videoID, policyID int64
+		if err := rows.Scan(&videoID, &policyID); err != nil {
+			rows.Close()
+			return err
+		}
+		have[videoID] = policyID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for videoID, policyID := range have {
+		// A video now picked by another policy is proposed afresh.
+		if proposed[videoID] == policyID {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM archive_proposals WHERE video_id = ?`, videoID); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return err
+		}
+	}
+	for videoID, policyID := range proposed {
+		if have[videoID] == policyID {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO archive_proposals (video_id, policy_id, proposed_at) VALUES (?, ?, ?)`,
+			videoID, policyID, at.UTC().Format(time.DateTime)); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return dbError(err)
+		}
+	}
+	return tx.Commit()
+}
+
+const archiveProposalColumns = "video_id, policy_id, proposed_at, dismissed"
+
+func scanArchiveProposal(scan func(dest ...any) error) (ArchiveProposal, error) {
+	var p ArchiveProposal
+	err := scan(&p.VideoID, &p.PolicyID, &p.ProposedAt, &p.Dismissed)
+	return p, dbError(err)
+}
+
+func (s *SQLiteStore) ListArchiveProposals(ctx context.Context) ([]ArchiveProposal, error) {
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT `+archiveProposalColumns+` FROM archive_proposals ORDER BY proposed_at, video_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ArchiveProposal
+	for rows.Next() {
+		p, err := scanArchiveProposal(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) GetArchiveProposal(ctx context.Context, videoID int64) (ArchiveProposal, error) {
+	return scanArchiveProposal(s.conn.QueryRowContext(ctx,
+		`SELECT `+archiveProposalColumns+` FROM archive_proposals WHERE video_id = ?`, videoID).Scan)
+}
+
+func (s *SQLiteStore) DismissArchiveProposal(ctx context.Context, videoID int64) error {
+	return updateOne(ctx, s.conn, `UPDATE archive_proposals SET dismissed = 1 WHERE video_id = ?`, videoID)
+}
+
+func (s *SQLiteStore) DeleteArchiveProposal(ctx context.Context, videoID int64) error {
+	return updateOne(ctx, s.conn, `DELETE FROM archive_proposals WHERE video_id = ?`, videoID)
+}
+
+const qualityPresetColumns = "id, name, max_height, bitrate_k"
+
+func scanQualityPreset(scan func(dest ...any) error) (QualityPreset, error) {
+	var p QualityPreset
+	err := scan(&p.ID, &p.Name, &p.MaxHeight, &p.BitrateK)
+	return p, dbError(err)
+}
+
+func (s *SQLiteStore) CreateQualityPreset(ctx context.Context, p QualityPreset) (QualityPreset, error) {
+	row := s.conn.QueryRowContext(ctx,
+		`INSERT INTO quality_presets (name, max_height, bitrate_k) VALUES (?, ?, ?) RETURNING `+qualityPresetColumns,
+		p.Name, p.MaxHeight, p.BitrateK)
+	return scanQualityPreset(row.Scan)
+}
+
+func (s *SQLiteStore) GetQualityPreset(ctx context.Context, id int64) (QualityPreset, error) {
+	row := s.conn.QueryRowContext(ctx, `SELECT `+qualityPresetColumns+` FROM quality_presets WHERE id = ?`, id)
+	return scanQualityPreset(row.Scan)
+}
+
+func (s *SQLiteStore) ListQualityPresets(ctx context.Context) ([]QualityPreset, error) {
+	rows, err := s.conn.QueryContext(ctx, `SELECT `+qualityPresetColumns+` FROM quality_presets ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []QualityPreset
+	for rows.Next() {
+		p, err := scanQualityPreset(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteQualityPreset(ctx context.Context, id int64) error {
+	return updateOne(ctx, s.conn, `DELETE FROM quality_presets WHERE id = ?`, id)
+}
+
+// --- Notifications ---
+
+const eventColumns = "id, kind, message, COALESCE(video_id, 0), failed, audience, user_id, payload, created_at"
+
+func scanEvent(scan func(dest ...any) error) (Event, error) {
+	var e Event
+	err := scan(&e.ID, &e.Kind, &e.Message, &e.VideoID, &e.Failed, &e.Audience, &e.UserID, &e.Payload, &e.CreatedAt)
+	return e, dbError(err)
+}
+
+func (s *SQLiteStore) AddEvent(ctx context.Context, e Event, keep int) (Event, error) {
+	row := s.conn.QueryRowContext(ctx, `
+		INSERT INTO events (kind, message, video_id, failed, audience, user_id, payload)
+		VALUES (?, ?, NULLIF(?, 0), ?, ?, ?, ?) RETURNING `+eventColumns,
+		e.Kind, e.Message, e.VideoID, e.Failed, e.Audience, e.UserID, e.Payload)
+	added, err := scanEvent(row.Scan)
+	if err != nil {
+		return Event{}, err
+	}
+	_, err = s.conn.ExecContext(ctx,
+		`DELETE FROM events WHERE id NOT IN (SELECT id FROM events ORDER BY id DESC LIMIT ?)`, keep)
+	return added, err
+}
+
+func (s *SQLiteStore) ListEvents(ctx context.Context, q EventQuery) ([]Event, error) {
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT `+eventColumns+` FROM events
+		WHERE id > ? AND (audience = 'everyone' OR (audience = 'admins' AND ?) OR (audience = 'user' AND user_id = ?))
+		ORDER BY id DESC LIMIT ?`, q.AfterID, q.Admin, q.UserID, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Event
+	for rows.Next() {
+		e, err := scanEvent(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+const notificationColumns = "id, user_id, kind, message, COALESCE(video_id, 0), created_at, read, failed"
+
+func scanNotification(scan func(dest ...any) error) (Notification, error) {
+	var n Notification
+	err := scan(&n.ID, &n.UserID, &n.Kind, &n.Message, &n.VideoID, &n.CreatedAt, &n.Read, &n.Failed)
+	return n, dbError(err)
+}
+
+func (s *SQLiteStore) AddNotification(ctx context.Context, n Notification, keep int) (Notification, error) {
+	row := s.conn.QueryRowContext(ctx,
+		`INSERT INTO notifications (user_id, kind, message, video_id, failed) VALUES (?, ?, ?, NULLIF(?, 0), ?) RETURNING `+notificationColumns,
+		n.UserID, n.Kind, n.Message, n.VideoID, n.Failed)
+	added, err := scanNotification(row.Scan)
+	if err != nil {
+		return Notification{}, err
+	}
+	_, err = s.conn.ExecContext(ctx, `
+		DELETE FROM notifications WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM notifications WHERE user_id = ? ORDER BY id DESC LIMIT ?)`,
+		n.UserID, n.UserID, keep)
+	return added, err
+}
+
+func (s *SQLiteStore) ListNotifications(ctx context.Context, userID int64, limit int) ([]Notification, error) {
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT `+notificationColumns+` FROM notifications WHERE user_id = ? ORDER BY id DESC LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Notification
+	for rows.Next() {
+		n, err := scanNotification(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) CountUnreadNotifications(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := s.conn.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read = 0`, userID).Scan(&n)
+	return n, err
+}
+
+func (s *SQLiteStore) MarkNotificationRead(ctx context.Context, userID, id int64) error {
+	return updateOne(ctx, s.conn, `UPDATE notifications SET read = 1 WHERE id = ? AND user_id = ?`, id, userID)
+}
+
+func (s *SQLiteStore) MarkAllNotificationsRead(ctx context.Context, userID int64) error {
+	_, err := s.conn.ExecContext(ctx, `UPDATE notifications SET read = 1 WHERE user_id = ? AND read = 0`, userID)
+	return err
+}
+
+func (s *SQLiteStore) ListNotificationsSince(ctx context.Context, userID int64, since string) ([]Notification, error) {
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT `+notificationColumns+` FROM notifications WHERE user_id = ? AND created_at > ? ORDER BY id`, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Notification
+	for rows.Next() {
+		n, err := scanNotification(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) GetReportSubscription(ctx context.Context, userID int64) (ReportSubscription, error) {
+	sub := ReportSubscription{UserID: userID}
+	err := s.conn.QueryRowContext(ctx,
+		`SELECT email, last_sent FROM report_subscriptions WHERE user_id = ?`, userID).Scan(&sub.Email, &sub.LastSent)
+	return sub, dbError(err)
+}
+
+func (s *SQLiteStore) SetReportSubscription(ctx context.Context, userID int64, email string) error {
+	_, err := s.conn.ExecContext(ctx, `
+		INSERT INTO report_subscriptions (user_id, email) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET email = excluded.email`,
+		userID, email)
+	return dbError(err)
+}
+
+func (s *SQLiteStore) DeleteReportSubscription(ctx context.Context, userID int64) error {
+	_, err := s.conn.ExecContext(ctx, `DELETE FROM report_subscriptions WHERE user_id = ?`, userID)
+	return err
+}
+
+func (s *SQLiteStore) ListReportSubscriptions(ctx context.Context) ([]ReportSubscription, error) {
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT user_id, email, last_sent FROM report_subscriptions ORDER BY user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ReportSubscription
+	for rows.Next() {
+		var sub ReportSubscription
+		if err := rows.Scan(&sub.UserID, &sub.Email, &sub.LastSent); err != nil {
+			return nil, err
+		}
+		out = append(out, sub)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) MarkReportSent(ctx context.Context, userID int64, sent string) error {
+	return updateOne(ctx, s.conn, `UPDATE report_subscriptions SET last_sent = ? WHERE user_id = ?`, sent, userID)
+}
+
+func (s *SQLiteStore) SetVideoMarkers(ctx context.Context, videoID int64, source string, markers []Marker) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := setVideoMarkers(ctx, tx, videoID, source, markers); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+	return tx.Commit()
+}
+
+func setVideoMarkers(ctx context.Context, q execer, videoID int64, source string, markers []Marker) error {
+	if _, err := q.ExecContext(ctx,
+		`DELETE FROM video_markers WHERE video_id = ? AND source = ?`, videoID, source); err != nil {
+		return err
+	}
+	for _, m := range markers {
+		if _, err := q.ExecContext(ctx,
+			`INSERT INTO video_markers (video_id, kind, start_s, end_s, label, source) VALUES (?, ?, ?, ?, ?, ?)`,
+			videoID, m.Kind, m.Start, m.End, m.Label, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListVideoMarkers(ctx context.Context, videoID int64) ([]Marker, error) {
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT kind, start_s, end_s, label, source FROM video_markers WHERE video_id = ? ORDER BY start_s, id`, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Marker
+	for rows.Next() {
+		var m Marker
+		if err := rows.Scan(&m.Kind, &m.Start, &m.End, &m.Label, &m.Source); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) AddBookmark(ctx context.Context, videoID int64, position float64, label string) (Bookmark, error) {
+	b := Bookmark{VideoID: videoID, Position: position, Label: label}
+	err := s.conn.QueryRowContext(ctx,
+		`INSERT INTO video_bookmarks (video_id, position_s, label) VALUES (?, ?, ?) RETURNING id`,
+		videoID, position, label).Scan(&b.ID)
+	if err != nil {
+		return Bookmark{}, dbError(err)
+	}
+	return b, nil
+}
+
+func (s *SQLiteStore) ListBookmarks(ctx context.Context, videoID int64) ([]Bookmark, error) {
+	rows, err := s.conn.QueryContext(ctx,
+		`SELECT id, video_id, position_s, label FROM video_bookmarks WHERE video_id = ? ORDER BY position_s, id`, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Bookmark
+	for rows.Next() {
+		var b Bookmark
+		if err := rows.Scan(&b.ID, &b.VideoID, &b.Position, &b.Label); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteBookmark(ctx context.Context, videoID, bookmarkID int64) error {
+	return updateOne(ctx, s.conn,
+		`DELETE FROM video_bookmarks WHERE id = ? AND video_id = ?`, bookmarkID, videoID)
+}
+
+func (s *SQLiteStore) SetPlayQueue(ctx context.Context, videoIDs []int64) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM play_queue`); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+	for i, id := range videoIDs {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO play_queue (position, video_id) VALUES (?, ?)`, i, id); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) ListPlayQueue(ctx context.Context) ([]int64, error) {
+	rows, err := s.conn.QueryContext(ctx, `SELECT video_id FROM play_queue ORDER BY position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) AdvancePlayQueue(ctx context.Context) (int64, int, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	var position, videoID int64
+	if err := tx.QueryRowContext(ctx,
+		`SELECT position, video_id FROM play_queue WHERE played = 0 ORDER BY position LIMIT 1`,
+	).Scan(&position, &videoID); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return 0, 0, dbError(err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE play_queue SET played = 1 WHERE position = ?`, position); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return 0, 0, err
+	}
+	var remaining int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM play_queue WHERE played = 0`).Scan(&remaining); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return 0, 0, err
+	}
+	return videoID, remaining, tx.Commit()
+}
+
+func (s *SQLiteStore) UpsertVideos(ctx context.Context, inputs []VideoInput) ([]Video, error) {
+	// Canonicalise first: the root lookups use their own connection.
+	roots := make(map[int64]string)
+	paths := make([]string, len(inputs))
+	for i, in := range inputs {
+		root, ok := roots[in.DirectoryID]
+		if !ok {
+			var err error
+			if root, err = s.directoryRoot(ctx, in.DirectoryID); err != nil {
+				return nil, err
+			}
+			roots[in.DirectoryID] = root
+		}
+		if i > 0 && in.DirectoryID == inputs[i-1].DirectoryID && in.DirectoryPath == inputs[i-1].DirectoryPath {
+			paths[i] = paths[i-1]
+			continue
+		}
+		dir, err := canonicalVideoDir(root, in.DirectoryPath)
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = dir
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := tx.PrepareContext(ctx, upsertVideoQuery)
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return nil, err
+	}
+	defer stmt.Close()
+	videos := make([]Video, 0, len(inputs))
+	for i, in := range inputs {
+		v, err := scanVideoRow(stmt.QueryRowContext(ctx, in.Filename, in.DirectoryID, paths[i], in.Filename))
+		if err != nil {
+			tx.Rollback() //nolint:errcheck
+			return nil, fmt.Errorf("upsert %s: %w", in.Filename, err)
+		}
+		videos = append(videos, v)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+func (s *SQLiteStore) SaveVideoScans(ctx context.Context, scans []VideoScan) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, sc := range scans {
+		if err := saveVideoScan(ctx, tx, sc); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return fmt.Errorf("save scan of video %d: %w", sc.VideoID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func saveVideoScan(ctx context.Context, tx *sql.Tx, sc VideoScan) error {
+	id := sc.VideoID
+	exec := func(query string, args ...any) error {
+		_, err := tx.ExecContext(ctx, query, args...)
+		return err
+	}
+	if !sc.FileModTime.IsZero() {
+		if err := exec(`UPDATE videos SET file_size = ?, file_mtime = ? WHERE id = ?`,
+			sc.FileSize, sc.FileModTime.UnixNano(), id); err != nil {
+			return err
+		}
+	}
+	if sc.Reset {
+		if err := exec(`UPDATE videos SET duration_s = 0, width = 0, height = 0 WHERE id = ?`, id); err != nil {
+			return err
+		}
+		if err := setVideoCodecs(ctx, tx, id, VideoCodecs{}); err != nil {
+			return err
+		}
+		if sc.MarkerSource != "" {
+			if err := setVideoMarkers(ctx, tx, id, sc.MarkerSource, nil); err != nil {
+				return err
+			}
+		}
+	}
+	if sc.ClearThumbnail {
+		if err := exec(`UPDATE videos SET thumbnail_path = '' WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	for _, t := range [][2]string{{"show", sc.ShowName}, {"genre", sc.Genre}, {"type", sc.VideoType}} {
+		if t[1] != "" {
+			if err := setExclusiveSystemTag(ctx, tx, id, t[0], t[1]); err != nil {
+				return err
+			}
+		}
+	}
+	if sc.DisplayName != "" {
+		if err := exec(`UPDATE videos SET display_name = ? WHERE id = ?`, sc.DisplayName, id); err != nil {
+			return err
+		}
+	}
+	if sc.Description != "" {
+		if err := exec(`UPDATE videos SET description = ? WHERE id = ?`, sc.Description, id); err != nil {
+			return err
+		}
+	}
+	if sc.DurationS > 0 {
+		if err := exec(`UPDATE videos SET duration_s = ? WHERE id = ?`, sc.DurationS, id); err != nil {
+			return err
+		}
+	}
+	if sc.Height > 0 {
+		if err := exec(`UPDATE videos SET width = ?, height = ? WHERE id = ?`, sc.Width, sc.Height, id); err != nil {
+			return err
+		}
+	}
+	if sc.Codecs != (VideoCodecs{}) {
+		if err := setVideoCodecs(ctx, tx, id, sc.Codecs); err != nil {
+			return err
+		}
+	}
+	if sc.MarkerSource != "" && len(sc.Markers) > 0 {
+		if err := setVideoMarkers(ctx, tx, id, sc.MarkerSource, sc.Markers); err != nil {
+			return err
+		}
+	}
+	if sc.Tag != "" {
+		if err := exec(`INSERT OR IGNORE INTO tags (name) VALUES (?)`, sc.Tag); err != nil {
+			return err
+		}
+		if err := exec(`INSERT OR IGNORE INTO video_tags (video_id, tag_id)
+			SELECT ?, id FROM tags WHERE name = ?`, id, sc.Tag); err != nil {
+			return err
+		}
+	}
+	if err := setVideoSidecars(ctx, tx, id, sc.Sidecars); err != nil {
+		return err
+	}
+	if sc.ThumbnailPath != "" {
+		return exec(`UPDATE videos SET thumbnail_path = ? WHERE id = ?`, sc.ThumbnailPath, id)
+	}
+	return nil
+}
@@ -2,6 +2,11 @@ package store_test
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"testing"
 	"time"
 
@@ -40,6 +45,87 @@ func TestAddAndListDirectories(t *testing.T) {
 	}
 }
 
+func TestSetDirectoryExcludes(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	if len(d.Excludes) != 0 {
+		t.Fatalf("new directory should have no excludes, got %q", d.Excludes)
+	}
+	if err := s.SetDirectoryExcludes(ctx, d.ID, []string{"*.sample.*", "extras/**"}); err != nil {
+		t.Fatalf("SetDirectoryExcludes: %v", err)
+	}
+	got, _ := s.GetDirectory(ctx, d.ID)
+	if len(got.Excludes) != 2 || got.Excludes[1] != "extras/**" {
+		t.Errorf("unexpected excludes: %q", got.Excludes)
+	}
+	if err := s.SetDirectoryExcludes(ctx, 9999, nil); err == nil {
+		t.Error("expected error for unknown directory")
+	}
+}
+
+func TestSetDirectoryMaxDepth(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	if err := s.SetDirectoryMaxDepth(ctx, d.ID, 3); err != nil {
+		t.Fatalf("SetDirectoryMaxDepth: %v", err)
+	}
+	if got, _ := s.GetDirectory(ctx, d.ID); got.MaxDepth != 3 {
+		t.Errorf("MaxDepth = %d, want 3", got.MaxDepth)
+	}
+	if err := s.SetDirectoryMaxDepth(ctx, d.ID, -1); err == nil {
+		t.Error("expected error for negative depth")
+	}
+}
+
+func TestSetDirectoryFollowSymlinks(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	if d.FollowSymlinks {
+		t.Fatal("new directory should not follow symlinks")
+	}
+	if err := s.SetDirectoryFollowSymlinks(ctx, d.ID, true); err != nil {
+		t.Fatalf("SetDirectoryFollowSymlinks: %v", err)
+	}
+	if got, _ := s.GetDirectory(ctx, d.ID); !got.FollowSymlinks {
+		t.Error("FollowSymlinks not persisted")
+	}
+}
+
+func TestAddChildDirectory(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	parent, _ := s.AddDirectory(ctx, "/videos/show")
+	child, err := s.AddChildDirectory(ctx, parent.ID, "/videos/show/Season 1")
+	if err != nil {
+		t.Fatalf("AddChildDirectory: %v", err)
+	}
+	if child.ParentID != parent.ID {
+		t.Errorf("ParentID = %d, want %d", child.ParentID, parent.ID)
+	}
+	if parent.ParentID != 0 {
+		t.Errorf("top-level ParentID = %d, want 0", parent.ParentID)
+	}
+
+	// Removing the parent keeps the child as a top-level entry.
+	if err := s.DeleteDirectory(ctx, parent.ID); err != nil {
+		t.Fatalf("DeleteDirectory: %v", err)
+	}
+	got, err := s.GetDirectory(ctx, child.ID)
+	if err != nil {
+		t.Fatalf("GetDirectory: %v", err)
+	}
+	if got.ParentID != 0 {
+		t.Errorf("ParentID after parent delete = %d, want 0", got.ParentID)
+	}
+}
+
 func TestDeleteDirectory(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
@@ -75,6 +161,89 @@ func TestDeleteDirectory_OrphansVideos(t *testing.T) {
 	}
 }
 
+func TestCanonicalDirectoryPaths(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	for _, p := range []string{"", "videos", "./videos"} {
+		if _, err := s.AddDirectory(ctx, p); !errors.Is(err, store.ErrRelativePath) {
+			t.Errorf("AddDirectory(%q): expected ErrRelativePath, got %v", p, err)
+		}
+	}
+
+	d, err := s.AddDirectory(ctx, "/videos/movies/../tv/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Path != "/videos/tv" {
+		t.Errorf("expected a cleaned path, got %q", d.Path)
+	}
+	if _, err := s.AddDirectory(ctx, "/videos//tv"); err == nil {
+		t.Error("expected a second spelling of the same folder to be rejected as a duplicate")
+	}
+
+	real := t.TempDir()
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	want, _ := filepath.EvalSymlinks(real)
+	d, err = s.AddDirectory(ctx, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Path != want {
+		t.Errorf("expected the symlink to resolve to %q, got %q", want, d.Path)
+	}
+	if err := s.RenameDirectory(ctx, d.ID, link+"/"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetDirectory(ctx, d.ID); got.Path != want {
+		t.Errorf("rename: expected %q, got %q", want, got.Path)
+	}
+}
+
+func TestCanonicalVideoPaths(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	d, _ := s.AddDirectory(ctx, root)
+	inside := filepath.Join(root, "shows")
+	os.Mkdir(inside, 0o755) //nolint:errcheck
+	if err := os.Symlink(inside, filepath.Join(root, "alias")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	outside := t.TempDir()
+	os.Symlink(outside, filepath.Join(root, "external")) //nolint:errcheck
+
+	v, err := s.UpsertVideo(ctx, d.ID, filepath.Join(root, "alias")+"/", "a.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.DirectoryPath != inside {
+		t.Errorf("expected a link within the folder to resolve to %q, got %q", inside, v.DirectoryPath)
+	}
+	again, _ := s.UpsertVideo(ctx, d.ID, inside, "a.mp4")
+	if again.ID != v.ID {
+		t.Error("expected both spellings to refer to the same video")
+	}
+
+	// A link leading out of the folder keeps the path it was found by.
+	external := filepath.Join(root, "external")
+	v, err = s.UpsertVideo(ctx, d.ID, external, "b.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.DirectoryPath != external {
+		t.Errorf("expected %q, got %q", external, v.DirectoryPath)
+	}
+
+	if err := s.UpdateVideoPath(ctx, v.ID, d.ID, "relative", "b.mp4"); !errors.Is(err, store.ErrRelativePath) {
+		t.Errorf("UpdateVideoPath: expected ErrRelativePath, got %v", err)
+	}
+}
+
 // --- Video tests ---
 
 func TestUpsertVideo_Idempotentent(t *testing.T) {
@@ -95,6 +264,112 @@ func TestUpsertVideo_Idempotentent(t *testing.T) {
 	}
 }
 
+func TestUpsertVideos(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	existing, _ := s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	inputs := []store.VideoInput{
+		{DirectoryID: d.ID, DirectoryPath: d.Path, Filename: "a.mp4"},
+		{DirectoryID: d.ID, DirectoryPath: d.Path + "/", Filename: "b.mp4"},
+		{DirectoryID: d.ID, DirectoryPath: d.Path + "/season 1", Filename: "c.mp4"},
+	}
+	videos, err := s.UpsertVideos(ctx, inputs)
+	if err != nil {
+		t.Fatalf("UpsertVideos: %v", err)
+	}
+	if len(videos) != 3 {
+		t.Fatalf("expected 3 videos, got %d", len(videos))
+	}
+	for i, v := range videos {
+		if v.Filename != inputs[i].Filename {
+			t.Errorf("video %d: expected %s, got %s", i, inputs[i].Filename, v.Filename)
+		}
+	}
+	if videos[1].ID != existing.ID {
+		t.Errorf("expected the existing video to be updated, got ID %d", videos[1].ID)
+	}
+	if videos[2].DirectoryPath != "/videos/season 1" {
+		t.Errorf("unexpected directory path %q", videos[2].DirectoryPath)
+	}
+	if n, _ := s.CountVideos(ctx); n != 3 {
+		t.Errorf("expected 3 videos stored, got %d", n)
+	}
+
+	// A bad input rolls the whole batch back.
+	_, err = s.UpsertVideos(ctx, []store.VideoInput{
+		{DirectoryID: d.ID, DirectoryPath: d.Path, Filename: "d.mp4"},
+		{DirectoryID: d.ID, DirectoryPath: "relative", Filename: "e.mp4"},
+	})
+	if !errors.Is(err, store.ErrRelativePath) {
+		t.Errorf("expected ErrRelativePath, got %v", err)
+	}
+	if n, _ := s.CountVideos(ctx); n != 3 {
+		t.Errorf("expected the failed batch to add nothing, got %d videos", n)
+	}
+}
+
+func TestSaveVideoScans(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	a, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	mod := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	err := s.SaveVideoScans(ctx, []store.VideoScan{
+		{
+			VideoID: a.ID, FileSize: 1234, FileModTime: mod,
+			ShowName: "Show", DisplayName: "Pilot", VideoType: "TV",
+			DurationS: 60, Width: 1920, Height: 1080,
+			Codecs:       store.VideoCodecs{Video: "h264", Audio: "aac"},
+			MarkerSource: "file", Markers: []store.Marker{{Kind: store.MarkerChapter, Start: 0, End: 30}},
+			Tag:           "videos",
+			Sidecars:      []store.Sidecar{{Kind: store.SidecarSubtitle, Path: "a.srt"}},
+			ThumbnailPath: "/videos/a_thumb.jpg",
+		},
+		{VideoID: b.ID, Tag: "videos"},
+	})
+	if err != nil {
+		t.Fatalf("SaveVideoScans: %v", err)
+	}
+	got, _ := s.GetVideo(ctx, a.ID)
+	if got.FileSize != 1234 || !got.FileModTime.Equal(mod) || got.ShowName != "Show" || got.DisplayName != "Pilot" ||
+		got.VideoType != "TV" || got.DurationS != 60 || got.Height != 1080 || got.ThumbnailPath != "/videos/a_thumb.jpg" {
+		t.Errorf("unexpected video after scan: %+v", got)
+	}
+	if c, _ := s.GetVideoCodecs(ctx, a.ID); c.Video != "h264" {
+		t.Errorf("unexpected codecs %+v", c)
+	}
+	if m, _ := s.ListVideoMarkers(ctx, a.ID); len(m) != 1 {
+		t.Errorf("expected 1 chapter, got %+v", m)
+	}
+	if sc, _ := s.ListVideoSidecars(ctx, a.ID); len(sc) != 1 {
+		t.Errorf("expected 1 sidecar, got %+v", sc)
+	}
+	for _, id := range []int64{a.ID, b.ID} {
+		tags, _ := s.ListTagsByVideo(ctx, id)
+		if !slices.ContainsFunc(tags, func(t store.Tag) bool { return t.Name == "videos" }) {
+			t.Errorf("video %d: expected the folder tag, got %+v", id, tags)
+		}
+	}
+
+	// Empty fields are left alone; Reset clears what came from the file.
+	if err := s.SaveVideoScans(ctx, []store.VideoScan{
+		{VideoID: a.ID, Reset: true, ClearThumbnail: true, MarkerSource: "file"},
+	}); err != nil {
+		t.Fatalf("SaveVideoScans reset: %v", err)
+	}
+	got, _ = s.GetVideo(ctx, a.ID)
+	if got.DurationS != 0 || got.Height != 0 || got.ThumbnailPath != "" || got.DisplayName != "Pilot" || got.ShowName != "Show" {
+		t.Errorf("unexpected video after reset: %+v", got)
+	}
+	if m, _ := s.ListVideoMarkers(ctx, a.ID); len(m) != 0 {
+		t.Errorf("expected the chapters cleared, got %+v", m)
+	}
+}
+
 func TestListVideos(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
@@ -176,6 +451,147 @@ func TestListVideosByDirectory(t *testing.T) {
 	}
 }
 
+func TestListVideosPage(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	var ids []int64
+	for _, n := range []string{"d.mp4", "a.mp4", "c.mp4", "b.mp4"} {
+		v, _ := s.UpsertVideo(ctx, d.ID, d.Path, n)
+		ids = append(ids, v.ID)
+	}
+	s.SetVideoRating(ctx, ids[0], 2)                      //nolint:errcheck
+	s.SetVideoRating(ctx, ids[2], 1)                      //nolint:errcheck
+	s.SetExclusiveSystemTag(ctx, ids[2], "type", "Movie") //nolint:errcheck
+	tag, _ := s.UpsertTag(ctx, "kept")
+	for _, id := range ids[1:] {
+		s.TagVideo(ctx, id, tag.ID) //nolint:errcheck
+	}
+	s.UpdateVideoDuration(ctx, ids[1], 100)                                                              //nolint:errcheck
+	s.UpdateVideoDuration(ctx, ids[3], 300)                                                              //nolint:errcheck
+	s.SaveVideoScans(ctx, []store.VideoScan{{VideoID: ids[2], FileSize: 5000, FileModTime: time.Now()}}) //nolint:errcheck
+	s.RecordWatch(ctx, ids[0], 10)                                                                       //nolint:errcheck
+	names := func(q store.VideoQuery) ([]string, int) {
+		t.Helper()
+		videos, total, err := s.ListVideosPage(ctx, q)
+		if err != nil {
+			t.Fatalf("ListVideosPage(%+v): %v", q, err)
+		}
+		var out []string
+		for _, v := range videos {
+			out = append(out, v.Filename)
+		}
+		return out, total
+	}
+
+	for _, c := range []struct {
+		q     store.VideoQuery
+		want  []string
+		total int
+	}{
+		{store.VideoQuery{}, []string{"a.mp4", "b.mp4", "c.mp4", "d.mp4"}, 4},
+		{store.VideoQuery{Limit: 2, Offset: 1}, []string{"b.mp4", "c.mp4"}, 4},
+		{store.VideoQuery{Offset: 3}, []string{"d.mp4"}, 4},
+		{store.VideoQuery{Sort: "rating", Limit: 2}, []string{"d.mp4", "c.mp4"}, 4},
+		{store.VideoQuery{Sort: "added", Limit: 1}, []string{"b.mp4"}, 4},
+		{store.VideoQuery{Sort: "watched", Limit: 2}, []string{"d.mp4", "a.mp4"}, 4},
+		{store.VideoQuery{Sort: "duration", Limit: 2}, []string{"b.mp4", "a.mp4"}, 4},
+		{store.VideoQuery{Sort: "size", Limit: 1}, []string{"c.mp4"}, 4},
+		{store.VideoQuery{TagID: tag.ID, Limit: 1, Offset: 1}, []string{"b.mp4"}, 3},
+		{store.VideoQuery{TagID: tag.ID, MinRating: 1}, []string{"c.mp4"}, 1},
+		{store.VideoQuery{Type: "Movie"}, []string{"c.mp4"}, 1},
+	} {
+		got, total := names(c.q)
+		if !slices.Equal(got, c.want) || total != c.total {
+			t.Errorf("%+v: got %v (total %d), want %v (total %d)", c.q, got, total, c.want, c.total)
+		}
+	}
+}
+
+func TestListVideosPage_CombinedFilters(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	tv, _ := s.AddDirectory(ctx, "/tv")
+	films, _ := s.AddDirectory(ctx, "/films")
+	a, _ := s.UpsertVideo(ctx, tv.ID, tv.Path, "space_show_1.mp4")
+	b, _ := s.UpsertVideo(ctx, tv.ID, tv.Path, "space_show_2.mp4")
+	c, _ := s.UpsertVideo(ctx, films.ID, films.Path, "space_film.mp4")
+	s.UpsertVideo(ctx, films.ID, films.Path, "other.mp4") //nolint:errcheck
+	scifi, _ := s.UpsertTag(ctx, "scifi")
+	for _, id := range []int64{a.ID, b.ID, c.ID} {
+		s.TagVideo(ctx, id, scifi.ID) //nolint:errcheck
+	}
+	s.RecordWatch(ctx, a.ID, 10)   //nolint:errcheck
+	s.SetVideoRating(ctx, c.ID, 2) //nolint:errcheck
+
+	for _, c := range []struct {
+		q    store.VideoQuery
+		want []string
+	}{
+		{store.VideoQuery{Search: "space", DirectoryID: tv.ID}, []string{"space_show_1.mp4", "space_show_2.mp4"}},
+		{store.VideoQuery{Search: "space", DirectoryID: tv.ID, Watched: "no"}, []string{"space_show_2.mp4"}},
+		{store.VideoQuery{Search: "space", Watched: "yes"}, []string{"space_show_1.mp4"}},
+		{store.VideoQuery{Search: "film", TagID: scifi.ID}, []string{"space_film.mp4"}},
+		{store.VideoQuery{Search: "sp", TagID: scifi.ID, MinRating: 1}, []string{"space_film.mp4"}},
+		{store.VideoQuery{Search: "other", TagID: scifi.ID}, nil},
+	} {
+		videos, total, err := s.ListVideosPage(ctx, c.q)
+		if err != nil {
+			t.Fatalf("ListVideosPage(%+v): %v", c.q, err)
+		}
+		var got []string
+		for _, v := range videos {
+			got = append(got, v.Filename)
+		}
+		if !slices.Equal(got, c.want) || total != len(c.want) {
+			t.Errorf("%+v: got %v (total %d), want %v", c.q, got, total, c.want)
+		}
+	}
+}
+
+func TestListVideosPage_MultipleTags(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	a, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	c, _ := s.UpsertVideo(ctx, d.ID, d.Path, "c.mp4")
+	s.UpsertVideo(ctx, d.ID, d.Path, "d.mp4") //nolint:errcheck
+	comedy, _ := s.UpsertTag(ctx, "comedy")
+	favs, _ := s.UpsertTag(ctx, "favorites")
+	s.TagVideo(ctx, a.ID, comedy.ID) //nolint:errcheck
+	s.TagVideo(ctx, a.ID, favs.ID)   //nolint:errcheck
+	s.TagVideo(ctx, b.ID, comedy.ID) //nolint:errcheck
+	s.TagVideo(ctx, c.ID, favs.ID)   //nolint:errcheck
+
+	both := []int64{comedy.ID, favs.ID}
+	for _, c := range []struct {
+		q    store.VideoQuery
+		want []string
+	}{
+		{store.VideoQuery{TagIDs: both}, []string{"a.mp4", "b.mp4", "c.mp4"}},
+		{store.VideoQuery{TagIDs: both, AllTags: true}, []string{"a.mp4"}},
+		// A repeated ID does not make all-of impossible.
+		{store.VideoQuery{TagIDs: []int64{comedy.ID, comedy.ID}, AllTags: true}, []string{"a.mp4", "b.mp4"}},
+		{store.VideoQuery{TagIDs: both, AllTags: true, Watched: "yes"}, nil},
+	} {
+		videos, total, err := s.ListVideosPage(ctx, c.q)
+		if err != nil {
+			t.Fatalf("ListVideosPage(%+v): %v", c.q, err)
+		}
+		var got []string
+		for _, v := range videos {
+			got = append(got, v.Filename)
+		}
+		if !slices.Equal(got, c.want) || total != len(c.want) {
+			t.Errorf("%+v: got %v (total %d), want %v", c.q, got, total, c.want)
+		}
+	}
+}
+
 func TestSearchVideos(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
@@ -215,7 +631,7 @@ func TestGetRandomVideo(t *testing.T) {
 	ctx := context.Background()
 
 	// Empty library — should return an error.
-	if _, err := s.GetRandomVideo(ctx); err == nil {
+	if _, err := s.GetRandomVideo(ctx, false); err == nil {
 		t.Error("expected error from GetRandomVideo on empty store, got nil")
 	}
 
@@ -223,7 +639,7 @@ func TestGetRandomVideo(t *testing.T) {
 	s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
 	s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
 
-	v, err := s.GetRandomVideo(ctx)
+	v, err := s.GetRandomVideo(ctx, false)
 	if err != nil {
 		t.Fatalf("GetRandomVideo: %v", err)
 	}
@@ -232,6 +648,209 @@ func TestGetRandomVideo(t *testing.T) {
 	}
 }
 
+func TestGetRandomVideo_SkipsOfflineDirectories(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	online, _ := s.AddDirectory(ctx, "/videos")
+	drive, _ := s.AddDirectory(ctx, "/media/usb")
+	s.UpsertVideo(ctx, online.ID, online.Path, "home.mp4") //nolint:errcheck
+	for _, f := range []string{"a.mp4", "b.mp4", "c.mp4"} {
+		s.UpsertVideo(ctx, drive.ID, drive.Path, f) //nolint:errcheck
+	}
+	if err := s.SetDirectoryOffline(ctx, drive.ID, true); err != nil {
+		t.Fatalf("SetDirectoryOffline: %v", err)
+	}
+	if d, _ := s.GetDirectory(ctx, drive.ID); !d.Offline {
+		t.Fatal("Offline not saved")
+	}
+	for range 20 {
+		v, err := s.GetRandomVideo(ctx, false)
+		if err != nil {
+			t.Fatalf("GetRandomVideo: %v", err)
+		}
+		if v.Filename != "home.mp4" {
+			t.Fatalf("random play picked %q from an offline directory", v.Filename)
+		}
+	}
+}
+
+func TestGetRandomVideo_Excludes(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	a, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	c, _ := s.UpsertVideo(ctx, d.ID, d.Path, "c.mp4")
+	for range 20 {
+		v, err := s.GetRandomVideo(ctx, false, a.ID, c.ID)
+		if err != nil {
+			t.Fatalf("GetRandomVideo: %v", err)
+		}
+		if v.ID != b.ID {
+			t.Fatalf("picked excluded video %q", v.Filename)
+		}
+	}
+	if _, err := s.GetRandomVideo(ctx, false, a.ID, b.ID, c.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("all excluded: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestGetRandomVideoFiltered(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	fav, _ := s.UpsertVideo(ctx, d.ID, d.Path, "fav.mp4")
+	ep, _ := s.UpsertVideo(ctx, d.ID, d.Path, "ep.mkv")
+	seen, _ := s.UpsertVideo(ctx, d.ID, d.Path, "seen.mp4")
+	s.SetVideoRating(ctx, fav.ID, 2)                     //nolint:errcheck
+	s.SetExclusiveSystemTag(ctx, ep.ID, "show", "Alpha") //nolint:errcheck
+	s.RecordWatch(ctx, seen.ID, 1)                       //nolint:errcheck
+	kids, _ := s.UpsertTag(ctx, "kids")
+	s.TagVideo(ctx, ep.ID, kids.ID)   //nolint:errcheck
+	s.TagVideo(ctx, seen.ID, kids.ID) //nolint:errcheck
+
+	for _, tc := range []struct {
+		name string
+		f    store.RandomFilter
+		want []int64
+	}{
+		{"everything", store.RandomFilter{}, []int64{fav.ID, ep.ID, seen.ID}},
+		{"unwatched", store.RandomFilter{Unwatched: true}, []int64{fav.ID, ep.ID}},
+		{"min rating", store.RandomFilter{MinRating: 1}, []int64{fav.ID}},
+		{"tags", store.RandomFilter{TagIDs: []int64{kids.ID}}, []int64{ep.ID, seen.ID}},
+		{"no shows", store.RandomFilter{ExcludeShows: true}, []int64{fav.ID, seen.ID}},
+		{"combined", store.RandomFilter{TagIDs: []int64{kids.ID}, ExcludeShows: true, Exclude: []int64{fav.ID}}, []int64{seen.ID}},
+		{"nothing left", store.RandomFilter{Unwatched: true, TagIDs: []int64{kids.ID}, Exclude: []int64{ep.ID}}, nil},
+	} {
+		saw := map[int64]bool{}
+		for range 30 {
+			v, err := s.GetRandomVideoFiltered(ctx, tc.f)
+			if tc.want == nil {
+				if !errors.Is(err, store.ErrNotFound) {
+					t.Fatalf("%s: expected ErrNotFound, got %v", tc.name, err)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			if !slices.Contains(tc.want, v.ID) {
+				t.Fatalf("%s: picked %q", tc.name, v.Filename)
+			}
+			saw[v.ID] = true
+		}
+		if len(saw) != len(tc.want) {
+			t.Errorf("%s: picked %d of %d videos in 30 tries", tc.name, len(saw), len(tc.want))
+		}
+	}
+}
+
+func TestVideoExtras(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	other, _ := s.AddDirectory(ctx, "/other")
+	film, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film.mkv")
+	trailer, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film-trailer.mp4")
+	sample, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film-sample.mkv")
+	elsewhere, _ := s.UpsertVideo(ctx, other.ID, other.Path, "clip-trailer.mp4")
+	show, _ := s.UpsertVideo(ctx, other.ID, other.Path, "clip.mp4")
+	s.SetDirectoryExtras(ctx, other.ID, []store.ExtraLink{{VideoID: elsewhere.ID, MainID: show.ID, Kind: store.ExtraTrailer}}) //nolint:errcheck
+
+	links := []store.ExtraLink{
+		{VideoID: trailer.ID, MainID: film.ID, Kind: store.ExtraTrailer},
+		{VideoID: sample.ID, MainID: film.ID, Kind: store.ExtraSample},
+	}
+	if err := s.SetDirectoryExtras(ctx, d.ID, links); err != nil {
+		t.Fatalf("SetDirectoryExtras: %v", err)
+	}
+	extras, err := s.ListVideoExtras(ctx, film.ID)
+	if err != nil || len(extras) != 2 || extras[0].ID != sample.ID || extras[0].Kind != store.ExtraSample || extras[1].ID != trailer.ID {
+		t.Fatalf("ListVideoExtras = %+v, %v", extras, err)
+	}
+	if _, total, _ := s.ListVideosPage(ctx, store.VideoQuery{DirectoryID: d.ID}); total != 1 {
+		t.Errorf("extras should not be listed, got %d videos", total)
+	}
+	for range 20 {
+		if v, _ := s.GetRandomVideo(ctx, false, show.ID); v.ID != film.ID {
+			t.Fatalf("random play picked extra %q", v.Filename)
+		}
+	}
+
+	// Replacing the directory's links leaves other directories alone.
+	if err := s.SetDirectoryExtras(ctx, d.ID, links[:1]); err != nil {
+		t.Fatalf("SetDirectoryExtras: %v", err)
+	}
+	ids, _ := s.ListExtraVideoIDs(ctx)
+	if len(ids) != 2 || !ids[trailer.ID] || !ids[elsewhere.ID] {
+		t.Errorf("ListExtraVideoIDs = %v", ids)
+	}
+	s.DeleteVideo(ctx, film.ID) //nolint:errcheck
+	if ids, _ := s.ListExtraVideoIDs(ctx); ids[trailer.ID] {
+		t.Error("deleting the main video should free its extras")
+	}
+}
+
+func TestManualExtras(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	film, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film.mkv")
+	trailer, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film-trailer.mp4")
+	bts, _ := s.UpsertVideo(ctx, d.ID, d.Path, "making of.mkv")
+	recap, _ := s.UpsertVideo(ctx, d.ID, d.Path, "recap.mkv")
+	auto := []store.ExtraLink{{VideoID: trailer.ID, MainID: film.ID, Kind: store.ExtraTrailer}}
+	s.SetDirectoryExtras(ctx, d.ID, auto) //nolint:errcheck
+
+	if err := s.LinkExtra(ctx, store.ExtraLink{VideoID: bts.ID, MainID: film.ID, Kind: store.ExtraBehindTheScene}); err != nil {
+		t.Fatalf("LinkExtra: %v", err)
+	}
+	if err := s.LinkExtra(ctx, store.ExtraLink{VideoID: recap.ID, ShowName: "Severance", Kind: store.ExtraOther}); err != nil {
+		t.Fatalf("LinkExtra show: %v", err)
+	}
+	if l, err := s.GetExtraLink(ctx, recap.ID); err != nil || l.MainID != 0 || l.ShowName != "Severance" {
+		t.Errorf("GetExtraLink = %+v, %v", l, err)
+	}
+	if extras, _ := s.ListShowExtras(ctx, "Severance"); len(extras) != 1 || extras[0].ID != recap.ID {
+		t.Errorf("ListShowExtras = %+v", extras)
+	}
+
+	// Taking the trailer back survives the next sync, as does the hand-made link.
+	if err := s.UnlinkExtra(ctx, trailer.ID); err != nil {
+		t.Fatalf("UnlinkExtra: %v", err)
+	}
+	s.SetDirectoryExtras(ctx, d.ID, auto) //nolint:errcheck
+	if extras, _ := s.ListVideoExtras(ctx, film.ID); len(extras) != 1 || extras[0].ID != bts.ID {
+		t.Errorf("after sync: ListVideoExtras = %+v", extras)
+	}
+	if _, err := s.GetExtraLink(ctx, trailer.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unlinked trailer: want ErrNotFound, got %v", err)
+	}
+	if _, total, _ := s.ListVideosPage(ctx, store.VideoQuery{}); total != 2 {
+		t.Errorf("library should list the film and the trailer, got %d", total)
+	}
+	if err := s.UnlinkExtra(ctx, trailer.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unlinking twice: want ErrNotFound, got %v", err)
+	}
+}
+
+func TestGetRandomVideo_Unwatched(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	a, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	s.RecordWatch(ctx, a.ID, 1) //nolint:errcheck
+	for range 20 {
+		if v, err := s.GetRandomVideo(ctx, true); err != nil || v.ID != b.ID {
+			t.Fatalf("GetRandomVideo(unwatched) = %q, %v; want b.mp4", v.Filename, err)
+		}
+	}
+	if _, err := s.GetRandomVideo(ctx, true, b.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("only watched left: expected ErrNotFound, got %v", err)
+	}
+}
+
 func TestSaveSettings(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
@@ -310,56 +929,223 @@ func TestUpsertTag_Idempotent(t *testing.T) {
 	}
 }
 
-func TestTagAndUntagVideo(t *testing.T) {
+func TestRenameTag(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
 
 	d, _ := s.AddDirectory(ctx, "/videos")
 	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
-	tag, _ := s.UpsertTag(ctx, "comedy")
+	comedy, _ := s.UpsertTag(ctx, "comdy")
+	drama, _ := s.UpsertTag(ctx, "drama")
+	s.UpsertTag(ctx, "genre:Drama")  //nolint:errcheck
+	s.TagVideo(ctx, v.ID, comedy.ID) //nolint:errcheck
 
-	if err := s.TagVideo(ctx, v.ID, tag.ID); err != nil {
-		t.Fatalf("TagVideo: %v", err)
+	if err := s.RenameTag(ctx, comedy.ID, "comedy"); err != nil {
+		t.Fatalf("RenameTag: %v", err)
 	}
-	tags, err := s.ListTagsByVideo(ctx, v.ID)
-	if err != nil {
-		t.Fatalf("ListTagsByVideo: %v", err)
+	if tags, _ := s.ListTagsByVideo(ctx, v.ID); len(tags) != 1 || tags[0].Name != "comedy" {
+		t.Errorf("video tags after rename = %+v", tags)
 	}
-	if len(tags) != 1 || tags[0].Name != "comedy" {
-		t.Errorf("expected [comedy], got %+v", tags)
+	if err := s.RenameTag(ctx, drama.ID, "comedy"); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("rename onto an existing name: want ErrConflict, got %v", err)
+	}
+	if err := s.RenameTag(ctx, 999, "x"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("missing tag: want ErrNotFound, got %v", err)
+	}
+	if _, err := s.GetTag(ctx, 999); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetTag missing: want ErrNotFound, got %v", err)
 	}
 
-	if err := s.UntagVideo(ctx, v.ID, tag.ID); err != nil {
-		t.Fatalf("UntagVideo: %v", err)
+	counts, err := s.ListTagCounts(ctx)
+	if err != nil || len(counts) != 2 {
+		t.Fatalf("ListTagCounts = %+v, %v; want comedy and drama", counts, err)
 	}
-	tags, _ = s.ListTagsByVideo(ctx, v.ID)
-	if len(tags) != 0 {
-		t.Errorf("expected no tags after untag, got %+v", tags)
+	if counts[0].Name != "comedy" || counts[0].Videos != 1 || counts[1].Name != "drama" || counts[1].Videos != 0 {
+		t.Errorf("ListTagCounts = %+v", counts)
 	}
 }
 
-func TestListVideosByTag(t *testing.T) {
+func TestMergeTags(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
 
 	d, _ := s.AddDirectory(ctx, "/videos")
-	v1, _ := s.UpsertVideo(ctx, d.ID, d.Path, "alpha.mp4")
-	v2, _ := s.UpsertVideo(ctx, d.ID, d.Path, "beta.mp4")
-	tag, _ := s.UpsertTag(ctx, "favorites")
-
-	s.TagVideo(ctx, v1.ID, tag.ID)
-
-	videos, err := s.ListVideosByTag(ctx, tag.ID)
-	if err != nil {
-		t.Fatalf("ListVideosByTag: %v", err)
+	both, _ := s.UpsertVideo(ctx, d.ID, d.Path, "both.mp4")
+	only, _ := s.UpsertVideo(ctx, d.ID, d.Path, "only.mp4")
+	from, _ := s.UpsertTag(ctx, "Bobs Burgers")
+	into, _ := s.UpsertTag(ctx, "Bob's Burgers")
+	s.TagVideo(ctx, both.ID, from.ID) //nolint:errcheck
+	s.TagVideo(ctx, both.ID, into.ID) //nolint:errcheck
+	s.TagVideo(ctx, only.ID, from.ID) //nolint:errcheck
+	s.RecordTagUse(ctx, 0, from.ID)   //nolint:errcheck
+	s.RecordTagUse(ctx, 0, into.ID)   //nolint:errcheck
+	s.RecordTagUse(ctx, 7, from.ID)   //nolint:errcheck
+	p, _ := s.CreateProfile(ctx, "Kids")
+	s.SetProfileLanding(ctx, p.ID, from.ID, "") //nolint:errcheck
+	keep, _ := s.SaveArchivePolicy(ctx, store.ArchivePolicy{Name: "Bob", TagID: from.ID, Action: store.ArchiveKeep})
+
+	if err := s.MergeTags(ctx, from.ID, into.ID); err != nil {
+		t.Fatalf("MergeTags: %v", err)
+	}
+	for _, v := range []store.Video{both, only} {
+		if tags, _ := s.ListTagsByVideo(ctx, v.ID); len(tags) != 1 || tags[0].ID != into.ID {
+			t.Errorf("%s: tags after merge = %+v", v.Filename, tags)
+		}
 	}
-	if len(videos) != 1 || videos[0].ID != v1.ID {
-		t.Errorf("expected only alpha.mp4 tagged, got %+v", videos)
+	if _, err := s.GetTag(ctx, from.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("merged tag should be gone, got %v", err)
 	}
-	_ = v2
-}
-
-func TestPruneOrphanTags(t *testing.T) {
+	for _, user := range []int64{0, 7} {
+		if recent, _ := s.ListRecentTags(ctx, user, 5); len(recent) != 1 || recent[0].ID != into.ID {
+			t.Errorf("user %d recent tags = %+v", user, recent)
+		}
+	}
+	if p, _ = s.GetProfile(ctx, p.ID); p.LandingTagID != into.ID {
+		t.Errorf("profile landing tag = %d, want %d", p.LandingTagID, into.ID)
+	}
+	if keep, _ = s.GetArchivePolicy(ctx, keep.ID); keep.TagID != into.ID {
+		t.Errorf("archive policy tag = %d, want %d", keep.TagID, into.ID)
+	}
+	if err := s.MergeTags(ctx, from.ID, into.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("merging a missing tag: want ErrNotFound, got %v", err)
+	}
+}
+
+func TestDeleteTag(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	tag, _ := s.UpsertTag(ctx, "blooper")
+	s.TagVideo(ctx, v.ID, tag.ID)  //nolint:errcheck
+	s.RecordTagUse(ctx, 0, tag.ID) //nolint:errcheck
+	p, _ := s.CreateProfile(ctx, "Kids")
+	s.SetProfileLanding(ctx, p.ID, tag.ID, "")                                                                //nolint:errcheck
+	s.SaveArchivePolicy(ctx, store.ArchivePolicy{Name: "Bloopers", TagID: tag.ID, Action: store.ArchiveKeep}) //nolint:errcheck
+	s.SaveArchivePolicy(ctx, store.ArchivePolicy{Name: "Everything", Action: store.ArchiveTrash, Days: 30})   //nolint:errcheck
+
+	if n, err := s.CountTagVideos(ctx, tag.ID); err != nil || n != 1 {
+		t.Fatalf("CountTagVideos = %d, %v; want 1", n, err)
+	}
+	if err := s.DeleteTag(ctx, tag.ID); err != nil {
+		t.Fatalf("DeleteTag: %v", err)
+	}
+	if tags, _ := s.ListTagsByVideo(ctx, v.ID); len(tags) != 0 {
+		t.Errorf("video tags after delete = %+v", tags)
+	}
+	if found, _ := s.SearchVideos(ctx, "blooper"); len(found) != 0 {
+		t.Errorf("search should no longer find the deleted tag, got %+v", found)
+	}
+	if recent, _ := s.ListRecentTags(ctx, 0, 5); len(recent) != 0 {
+		t.Errorf("recent tags after delete = %+v", recent)
+	}
+	if p, _ = s.GetProfile(ctx, p.ID); p.LandingTagID != 0 {
+		t.Errorf("profile landing tag = %d, want 0", p.LandingTagID)
+	}
+	if policies, _ := s.ListArchivePolicies(ctx); len(policies) != 1 || policies[0].Name != "Everything" {
+		t.Errorf("archive policies after delete = %+v, want only the one for any tag", policies)
+	}
+	if err := s.DeleteTag(ctx, tag.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("deleting a missing tag: want ErrNotFound, got %v", err)
+	}
+}
+
+func TestSetTagStyle(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	comedy, _ := s.UpsertTag(ctx, "comedy")
+	drama, _ := s.UpsertTag(ctx, "drama")
+	s.TagVideo(ctx, v.ID, comedy.ID) //nolint:errcheck
+	s.TagVideo(ctx, v.ID, drama.ID)  //nolint:errcheck
+
+	if err := s.SetTagStyle(ctx, drama.ID, "blue", -1); err != nil {
+		t.Fatalf("SetTagStyle: %v", err)
+	}
+	if tag, _ := s.GetTag(ctx, drama.ID); tag.Color != "blue" || tag.SortOrder != -1 {
+		t.Errorf("GetTag = %+v, want blue at -1", tag)
+	}
+	if tag, _ := s.UpsertTag(ctx, "drama"); tag.Color != "blue" {
+		t.Errorf("UpsertTag of an existing tag = %+v, want its color kept", tag)
+	}
+	want := []string{"drama", "comedy"}
+	names := func(tags []store.Tag) []string {
+		var out []string
+		for _, t := range tags {
+			out = append(out, t.Name)
+		}
+		return out
+	}
+	if tags, _ := s.ListTags(ctx); !slices.Equal(names(tags), want) {
+		t.Errorf("ListTags order = %v, want %v", names(tags), want)
+	}
+	if tags, _ := s.ListTagsByVideo(ctx, v.ID); !slices.Equal(names(tags), want) {
+		t.Errorf("ListTagsByVideo order = %v, want %v", names(tags), want)
+	}
+	if byVideo, _ := s.ListTagsByVideos(ctx, []int64{v.ID}); !slices.Equal(names(byVideo[v.ID]), want) || byVideo[v.ID][0].Color != "blue" {
+		t.Errorf("ListTagsByVideos = %+v", byVideo[v.ID])
+	}
+	if counts, _ := s.ListTagCounts(ctx); len(counts) != 2 || counts[0].Name != "drama" || counts[0].Color != "blue" {
+		t.Errorf("ListTagCounts = %+v", counts)
+	}
+	if err := s.SetTagStyle(ctx, 999, "", 0); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("styling a missing tag: want ErrNotFound, got %v", err)
+	}
+}
+
+func TestTagAndUntagVideo(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	tag, _ := s.UpsertTag(ctx, "comedy")
+
+	if err := s.TagVideo(ctx, v.ID, tag.ID); err != nil {
+		t.Fatalf("TagVideo: %v", err)
+	}
+	tags, err := s.ListTagsByVideo(ctx, v.ID)
+	if err != nil {
+		t.Fatalf("ListTagsByVideo: %v", err)
+	}
+	if len(tags) != 1 || tags[0].Name != "comedy" {
+		t.Errorf("expected [comedy], got %+v", tags)
+	}
+
+	if err := s.UntagVideo(ctx, v.ID, tag.ID); err != nil {
+		t.Fatalf("UntagVideo: %v", err)
+	}
+	tags, _ = s.ListTagsByVideo(ctx, v.ID)
+	if len(tags) != 0 {
+		t.Errorf("expected no tags after untag, got %+v", tags)
+	}
+}
+
+func TestListVideosByTag(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v1, _ := s.UpsertVideo(ctx, d.ID, d.Path, "alpha.mp4")
+	v2, _ := s.UpsertVideo(ctx, d.ID, d.Path, "beta.mp4")
+	tag, _ := s.UpsertTag(ctx, "favorites")
+
+	s.TagVideo(ctx, v1.ID, tag.ID)
+
+	videos, err := s.ListVideosByTag(ctx, tag.ID)
+	if err != nil {
+		t.Fatalf("ListVideosByTag: %v", err)
+	}
+	if len(videos) != 1 || videos[0].ID != v1.ID {
+		t.Errorf("expected only alpha.mp4 tagged, got %+v", videos)
+	}
+	_ = v2
+}
+
+func TestPruneOrphanTags(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
 
@@ -555,6 +1341,80 @@ func TestSetVideoRating(t *testing.T) {
 	}
 }
 
+func TestSetVideoStars(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+
+	// Stars set the thumbs rating: 4 is liked, 5 a favourite.
+	for _, tc := range []struct{ stars, rating int }{{3, 0}, {4, 1}, {5, 2}, {0, 0}} {
+		if err := s.SetVideoStars(ctx, v.ID, tc.stars); err != nil {
+			t.Fatalf("SetVideoStars %d: %v", tc.stars, err)
+		}
+		got, _ := s.GetVideo(ctx, v.ID)
+		if got.Stars != tc.stars || got.Rating != tc.rating {
+			t.Errorf("stars %d: got stars %d rating %d, want rating %d", tc.stars, got.Stars, got.Rating, tc.rating)
+		}
+	}
+	// And a thumbs rating sets the stars.
+	if err := s.SetVideoRating(ctx, v.ID, 2); err != nil {
+		t.Fatalf("SetVideoRating: %v", err)
+	}
+	if got, _ := s.GetVideo(ctx, v.ID); got.Stars != 5 {
+		t.Errorf("favourite: got %d stars, want 5", got.Stars)
+	}
+	if err := s.SetVideoStars(ctx, 999, 3); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unknown video: got %v, want ErrNotFound", err)
+	}
+
+	// Sort "stars" ranks by stars, though 2 and 3 stars are both neutral.
+	w, _ := s.UpsertVideo(ctx, d.ID, d.Path, "another.mp4")
+	s.SetVideoStars(ctx, v.ID, 2) //nolint:errcheck
+	s.SetVideoStars(ctx, w.ID, 3) //nolint:errcheck
+	list, _, err := s.ListVideosPage(ctx, store.VideoQuery{Sort: "stars"})
+	if err != nil {
+		t.Fatalf("ListVideosPage: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != w.ID {
+		t.Errorf("sort stars: got %+v, want another.mp4 first", list)
+	}
+}
+
+func TestSetVideoFavorite(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	s.UpsertVideo(ctx, d.ID, d.Path, "other.mp4") //nolint:errcheck
+	s.SetVideoRating(ctx, v.ID, 1)                //nolint:errcheck
+
+	if err := s.SetVideoFavorite(ctx, v.ID, true); err != nil {
+		t.Fatalf("SetVideoFavorite: %v", err)
+	}
+	// The rating is untouched.
+	if got, _ := s.GetVideo(ctx, v.ID); !got.Favorite || got.Rating != 1 {
+		t.Errorf("got favorite %v rating %d, want true and 1", got.Favorite, got.Rating)
+	}
+	list, total, err := s.ListVideosPage(ctx, store.VideoQuery{Favorites: true})
+	if err != nil {
+		t.Fatalf("ListVideosPage: %v", err)
+	}
+	if total != 1 || len(list) != 1 || list[0].ID != v.ID {
+		t.Errorf("favorites: got %d %+v, want only film.mp4", total, list)
+	}
+
+	s.SetVideoFavorite(ctx, v.ID, false) //nolint:errcheck
+	if _, total, _ := s.ListVideosPage(ctx, store.VideoQuery{Favorites: true}); total != 0 {
+		t.Errorf("after unmarking: %d favorites, want 0", total)
+	}
+	if err := s.SetVideoFavorite(ctx, 999, true); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unknown video: got %v, want ErrNotFound", err)
+	}
+}
+
 func TestListVideosByRating(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
@@ -664,11 +1524,76 @@ func TestListWatchHistory(t *testing.T) {
 	}
 }
 
+func TestListInProgress(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	add := func(name string, duration, position float64) int64 {
+		v, _ := s.UpsertVideo(ctx, d.ID, d.Path, name)
+		s.UpdateVideoDuration(ctx, v.ID, duration) //nolint:errcheck
+		s.RecordWatch(ctx, v.ID, position)         //nolint:errcheck
+		return v.ID
+	}
+	half := add("half.mp4", 100, 50)
+	add("done.mp4", 100, 95)
+	add("marked.mp4", 100, 1)
+	unknown := add("unknown.mp4", 0, 30)
+	s.UpsertVideo(ctx, d.ID, d.Path, "never.mp4") //nolint:errcheck
+
+	recs, err := s.ListInProgress(ctx, 1, 0.9, 10)
+	if err != nil {
+		t.Fatalf("ListInProgress: %v", err)
+	}
+	var ids []int64
+	for _, r := range recs {
+		ids = append(ids, r.VideoID)
+	}
+	slices.Sort(ids)
+	if !slices.Equal(ids, []int64{half, unknown}) {
+		t.Errorf("expected the half-watched and unknown-length videos, got %v", ids)
+	}
+	if recs, _ := s.ListInProgress(ctx, 1, 0.9, 1); len(recs) != 1 {
+		t.Errorf("expected the limit to apply, got %d", len(recs))
+	}
+}
+
+func TestPlayQueue(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	a, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	c, _ := s.UpsertVideo(ctx, d.ID, d.Path, "c.mp4")
+
+	if _, _, err := s.AdvancePlayQueue(ctx); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("empty queue: expected ErrNotFound, got %v", err)
+	}
+	if err := s.SetPlayQueue(ctx, []int64{c.ID, a.ID, b.ID}); err != nil {
+		t.Fatalf("SetPlayQueue: %v", err)
+	}
+	s.DeleteVideo(ctx, a.ID) //nolint:errcheck
+	for _, want := range []struct {
+		id        int64
+		remaining int
+	}{{c.ID, 1}, {b.ID, 0}} {
+		id, remaining, err := s.AdvancePlayQueue(ctx)
+		if err != nil || id != want.id || remaining != want.remaining {
+			t.Errorf("AdvancePlayQueue = %d, %d, %v; want %d, %d", id, remaining, err, want.id, want.remaining)
+		}
+	}
+	if _, _, err := s.AdvancePlayQueue(ctx); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("played-out queue: expected ErrNotFound, got %v", err)
+	}
+	if ids, _ := s.ListPlayQueue(ctx); !slices.Equal(ids, []int64{c.ID, b.ID}) {
+		t.Errorf("expected the played queue without the deleted video, got %v", ids)
+	}
+}
+
 // --- GetRandomVideo ---
 
 func TestGetRandomVideo_Empty(t *testing.T) {
 	s := newTestStore(t)
-	_, err := s.GetRandomVideo(context.Background())
+	_, err := s.GetRandomVideo(context.Background(), false)
 	if err == nil {
 		t.Fatal("expected error when no videos exist, got nil")
 	}
@@ -682,7 +1607,7 @@ func TestGetRandomVideo_ReturnsSomeVideo(t *testing.T) {
 	s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
 	s.UpsertVideo(ctx, d.ID, d.Path, "c.mp4")
 
-	v, err := s.GetRandomVideo(ctx)
+	v, err := s.GetRandomVideo(ctx, false)
 	if err != nil {
 		t.Fatalf("GetRandomVideo: %v", err)
 	}
@@ -919,6 +1844,62 @@ func TestUpdateVideoFields_WritesSystemTags(t *testing.T) {
 	}
 }
 
+func TestSearchVideos_IndexFollowsChanges(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "ep01.mp4")
+	s.UpsertVideo(ctx, d.ID, d.Path, "other.mp4") //nolint:errcheck
+	found := func(query string) bool {
+		t.Helper()
+		results, err := s.SearchVideos(ctx, query)
+		if err != nil {
+			t.Fatalf("SearchVideos(%q): %v", query, err)
+		}
+		return slices.ContainsFunc(results, func(r store.Video) bool { return r.ID == v.ID })
+	}
+
+	if err := s.SetVideoDescription(ctx, v.ID, "A chemistry teacher turns to crime"); err != nil {
+		t.Fatalf("SetVideoDescription: %v", err)
+	}
+	if !found("chemistry") {
+		t.Error("description not searched")
+	}
+	if err := s.UpdateVideoFields(ctx, v.ID, store.VideoFields{EpisodeTitle: "Pilot Light"}); err != nil {
+		t.Fatalf("UpdateVideoFields: %v", err)
+	}
+	if !found("pilot light") {
+		t.Error("episode title not searched")
+	}
+	tag, _ := s.UpsertTag(ctx, "desert")
+	s.TagVideo(ctx, v.ID, tag.ID) //nolint:errcheck
+	if !found("desert") {
+		t.Error("tag not searched")
+	}
+	s.UntagVideo(ctx, v.ID, tag.ID) //nolint:errcheck
+	if found("desert") {
+		t.Error("removed tag still matches")
+	}
+	s.SetExclusiveSystemTag(ctx, v.ID, "show", "Breaking Bad") //nolint:errcheck
+	if _, err := s.SaveShow(ctx, store.Show{Name: "Breaking Bad", Overview: "Set in Albuquerque"}); err != nil {
+		t.Fatalf("SaveShow: %v", err)
+	}
+	if !found("albuquerque") {
+		t.Error("show overview not searched")
+	}
+	if err := s.UpdateVideoName(ctx, v.ID, "Episode One"); err != nil {
+		t.Fatalf("UpdateVideoName: %v", err)
+	}
+	if !found("episode one") || !found("chemistry") {
+		t.Error("renamed video lost from the index")
+	}
+	s.DeleteVideo(ctx, v.ID) //nolint:errcheck
+	if found("chemistry") {
+		t.Error("deleted video still matches")
+	}
+}
+
 func TestSearchVideos_MatchesTagName(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
@@ -1046,6 +2027,132 @@ func TestUpdateVideoDuration_ZeroIsIdempotent(t *testing.T) {
 	}
 }
 
+// --- UpdateVideoResolution / ListTagsByVideos ---
+
+func TestUpdateVideoResolution_IsReturnedByGetAndList(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "hd.mp4")
+	if err := s.UpdateVideoResolution(ctx, v.ID, 1920, 1080); err != nil {
+		t.Fatalf("UpdateVideoResolution: %v", err)
+	}
+	got, _ := s.GetVideo(ctx, v.ID)
+	if got.Width != 1920 || got.Height != 1080 {
+		t.Errorf("GetVideo resolution = %dx%d, want 1920x1080", got.Width, got.Height)
+	}
+	list, _ := s.ListVideos(ctx)
+	if len(list) != 1 || list[0].Height != 1080 {
+		t.Errorf("ListVideos did not return resolution: %+v", list)
+	}
+}
+
+func TestLibrarySnapshots(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	a, _ := s.AddDirectory(ctx, "/a")
+	b, _ := s.AddDirectory(ctx, "/b")
+	v1, _ := s.UpsertVideo(ctx, a.ID, a.Path, "1.mp4")
+	s.UpdateVideoFileStat(ctx, v1.ID, 1000, time.Unix(0, 0)) //nolint:errcheck
+	if err := s.RecordLibrarySnapshot(ctx, "2026-01-01"); err != nil {
+		t.Fatalf("RecordLibrarySnapshot: %v", err)
+	}
+
+	v2, _ := s.UpsertVideo(ctx, a.ID, a.Path, "2.mp4")
+	s.UpdateVideoFileStat(ctx, v2.ID, 500, time.Unix(0, 0)) //nolint:errcheck
+	s.UpsertVideo(ctx, b.ID, b.Path, "3.mp4")               //nolint:errcheck
+	s.RecordLibrarySnapshot(ctx, "2026-01-02")              //nolint:errcheck
+	// A second snapshot the same day replaces the first.
+	s.RecordLibrarySnapshot(ctx, "2026-01-02") //nolint:errcheck
+
+	all, err := s.ListLibrarySnapshots(ctx, "2026-01-01")
+	if err != nil {
+		t.Fatalf("ListLibrarySnapshots: %v", err)
+	}
+	want := []store.LibrarySnapshot{
+		{Day: "2026-01-01", DirectoryID: a.ID, Videos: 1, Bytes: 1000},
+		{Day: "2026-01-02", DirectoryID: a.ID, Videos: 2, Bytes: 1500},
+		{Day: "2026-01-02", DirectoryID: b.ID, Videos: 1, Bytes: 0},
+	}
+	if !slices.Equal(all, want) {
+		t.Errorf("got %+v, want %+v", all, want)
+	}
+	if recent, _ := s.ListLibrarySnapshots(ctx, "2026-01-02"); len(recent) != 2 {
+		t.Errorf("expected since to exclude earlier days, got %+v", recent)
+	}
+}
+
+func TestVideoCodecs(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mkv")
+
+	if c, err := s.GetVideoCodecs(ctx, v.ID); err != nil || c != (store.VideoCodecs{}) {
+		t.Fatalf("unprobed video: got %+v, %v; want zero value", c, err)
+	}
+	want := store.VideoCodecs{Video: "hevc", Audio: "eac3"}
+	if err := s.SetVideoCodecs(ctx, v.ID, want); err != nil {
+		t.Fatalf("SetVideoCodecs: %v", err)
+	}
+	s.SetVideoCodecs(ctx, v.ID, store.VideoCodecs{Video: "h264", Audio: "aac"}) //nolint:errcheck
+	if c, _ := s.GetVideoCodecs(ctx, v.ID); c.Video != "h264" || c.Audio != "aac" {
+		t.Errorf("expected the second write to replace the first, got %+v", c)
+	}
+	langs := store.VideoCodecs{Video: "h264", Audio: "aac", AudioLanguages: "eng,jpn", SubtitleLanguages: ",eng", DefaultAudio: 1}
+	s.SetVideoCodecs(ctx, v.ID, langs) //nolint:errcheck
+	if c, _ := s.GetVideoCodecs(ctx, v.ID); c != langs {
+		t.Errorf("track languages: got %+v, want %+v", c, langs)
+	}
+}
+
+func TestLanguagePrefs(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	if p, err := s.GetLanguagePrefs(ctx, 3); err != nil || p != (store.LanguagePrefs{}) {
+		t.Fatalf("no prefs: got %+v, %v; want zero value", p, err)
+	}
+	s.SetLanguagePrefs(ctx, 3, store.LanguagePrefs{Audio: "jpn", Subtitles: "eng"}) //nolint:errcheck
+	want := store.LanguagePrefs{Audio: "jpn,eng"}
+	if err := s.SetLanguagePrefs(ctx, 3, want); err != nil {
+		t.Fatalf("SetLanguagePrefs: %v", err)
+	}
+	if p, _ := s.GetLanguagePrefs(ctx, 3); p != want {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+	if p, _ := s.GetLanguagePrefs(ctx, 0); p != (store.LanguagePrefs{}) {
+		t.Errorf("prefs leaked to another user: %+v", p)
+	}
+}
+
+func TestListTagsByVideos(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	d, _ := s.AddDirectory(ctx, "/videos")
+	a, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	c, _ := s.UpsertVideo(ctx, d.ID, d.Path, "c.mp4")
+	x, _ := s.UpsertTag(ctx, "x")
+	y, _ := s.UpsertTag(ctx, "y")
+	s.TagVideo(ctx, a.ID, x.ID) //nolint:errcheck
+	s.TagVideo(ctx, a.ID, y.ID) //nolint:errcheck
+	s.TagVideo(ctx, b.ID, y.ID) //nolint:errcheck
+
+	got, err := s.ListTagsByVideos(ctx, []int64{a.ID, b.ID, c.ID})
+	if err != nil {
+		t.Fatalf("ListTagsByVideos: %v", err)
+	}
+	if len(got[a.ID]) != 2 || len(got[b.ID]) != 1 || len(got[c.ID]) != 0 {
+		t.Errorf("unexpected tags: %+v", got)
+	}
+	if empty, err := s.ListTagsByVideos(ctx, nil); err != nil || len(empty) != 0 {
+		t.Errorf("expected empty map for no IDs, got %v, %v", empty, err)
+	}
+}
+
 // --- ListVideosByShow ---
 
 func TestListVideosByShow_ReturnsOnlyMatchingShow(t *testing.T) {
@@ -1270,6 +2377,42 @@ func TestCountVideos(t *testing.T) {
 
 // --- GetNextUnwatched ---
 
+func TestListUnwatchedPile(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	drive, _ := s.AddDirectory(ctx, "/media/usb")
+	var ids []int64
+	for _, name := range []string{"a.mp4", "b.mp4", "c.mp4", "d.mp4", "e.mp4"} {
+		v, _ := s.UpsertVideo(ctx, d.ID, d.Path, name)
+		ids = append(ids, v.ID)
+	}
+	away, _ := s.UpsertVideo(ctx, drive.ID, drive.Path, "away.mp4")
+	s.SetDirectoryOffline(ctx, drive.ID, true) //nolint:errcheck
+	s.RecordWatch(ctx, ids[0], 10)             //nolint:errcheck
+	s.RecordProgress(ctx, ids[2], 10)          //nolint:errcheck
+	tag, _ := s.UpsertTag(ctx, "noir")
+	s.TagVideo(ctx, ids[3], tag.ID)  //nolint:errcheck
+	s.TagVideo(ctx, away.ID, tag.ID) //nolint:errcheck
+
+	ofIDs := func(videos []store.Video) []int64 {
+		var out []int64
+		for _, v := range videos {
+			out = append(out, v.ID)
+		}
+		return out
+	}
+	if got, err := s.ListUnwatchedPile(ctx, 0, 0); err != nil || !slices.Equal(ofIDs(got), []int64{ids[1], ids[3], ids[4]}) {
+		t.Errorf("pile = %v, %v; want %v", ofIDs(got), err, []int64{ids[1], ids[3], ids[4]})
+	}
+	if got, _ := s.ListUnwatchedPile(ctx, 0, 2); !slices.Equal(ofIDs(got), []int64{ids[1], ids[3]}) {
+		t.Errorf("pile limit 2 = %v", ofIDs(got))
+	}
+	if got, _ := s.ListUnwatchedPile(ctx, tag.ID, 0); !slices.Equal(ofIDs(got), []int64{ids[3]}) {
+		t.Errorf("noir pile = %v, want [%d]", ofIDs(got), ids[3])
+	}
+}
+
 func TestGetNextUnwatched_ReturnsUnwatchedVideo(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
@@ -1353,10 +2496,10 @@ func TestListSettingsWithPrefix(t *testing.T) {
 		t.Errorf("expected 0, got %d", len(none))
 	}
 
-	// empty prefix matches all (5 defaults + 3 we added)
+	// empty prefix matches all (6 defaults + 3 we added)
 	all, _ := s.ListSettingsWithPrefix(ctx, "")
-	if len(all) != 8 {
-		t.Errorf("expected 8, got %d", len(all))
+	if len(all) != 9 {
+		t.Errorf("expected 9, got %d", len(all))
 	}
 }
 
@@ -1588,3 +2731,857 @@ func TestLoadSessions_ExcludesExpired(t *testing.T) {
 		t.Error("expired 'dead' session should not appear in LoadSessions result")
 	}
 }
+
+func TestSuggestTags(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	popular, _ := s.UpsertTag(ctx, "beach")
+	s.UpsertTag(ctx, "beaches")                          //nolint:errcheck
+	s.UpsertTag(ctx, "50%_off")                          //nolint:errcheck
+	s.TagVideo(ctx, v.ID, popular.ID)                    //nolint:errcheck
+	s.SetExclusiveSystemTag(ctx, v.ID, "genre", "Beach") //nolint:errcheck
+
+	got, err := s.SuggestTags(ctx, "BEACH", 10)
+	if err != nil {
+		t.Fatalf("SuggestTags: %v", err)
+	}
+	if len(got) != 2 || got[0].Name != "beach" || got[0].Videos != 1 || got[1].Name != "beaches" {
+		t.Errorf("unexpected suggestions (want beach, beaches; no genre:): %+v", got)
+	}
+
+	// LIKE wildcards in the query match literally.
+	got, _ = s.SuggestTags(ctx, "%_", 10)
+	if len(got) != 1 || got[0].Name != "50%_off" {
+		t.Errorf("wildcards not escaped: %+v", got)
+	}
+	if got, _ := s.SuggestTags(ctx, "", 1); len(got) != 1 || got[0].Name != "beach" {
+		t.Errorf("limit/ordering wrong for empty query: %+v", got)
+	}
+}
+
+func TestRecentTags(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	a, _ := s.UpsertTag(ctx, "a")
+	b, _ := s.UpsertTag(ctx, "b")
+	s.UpsertTag(ctx, "never-used") //nolint:errcheck
+
+	for _, id := range []int64{a.ID, b.ID, a.ID} {
+		if err := s.RecordTagUse(ctx, 0, id); err != nil {
+			t.Fatalf("RecordTagUse: %v", err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	got, err := s.ListRecentTags(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("ListRecentTags: %v", err)
+	}
+	if len(got) != 2 || got[0].Name != "a" || got[1].Name != "b" {
+		t.Errorf("expected [a b], got %+v", got)
+	}
+	if got, _ := s.ListRecentTags(ctx, 0, 1); len(got) != 1 {
+		t.Errorf("limit not applied: %+v", got)
+	}
+
+	// Each account has its own list.
+	u, _ := s.CreateUser(ctx, "sam", "", store.RoleViewer)
+	if err := s.RecordTagUse(ctx, u.ID, b.ID); err != nil {
+		t.Fatalf("RecordTagUse: %v", err)
+	}
+	if got, _ := s.ListRecentTags(ctx, u.ID, 10); len(got) != 1 || got[0].Name != "b" {
+		t.Errorf("expected only sam's tag [b], got %+v", got)
+	}
+	if err := s.DeleteUser(ctx, u.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if got, _ := s.ListRecentTags(ctx, u.ID, 10); len(got) != 0 {
+		t.Errorf("expected a deleted account's recent tags to go, got %+v", got)
+	}
+}
+
+func TestBatchUpdateTags(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	a, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	old, _ := s.UpsertTag(ctx, "old")
+	s.TagVideo(ctx, a.ID, old.ID) //nolint:errcheck
+
+	added, err := s.BatchUpdateTags(ctx, []int64{a.ID, b.ID}, []string{"new"}, []int64{old.ID})
+	if err != nil {
+		t.Fatalf("BatchUpdateTags: %v", err)
+	}
+	if len(added) != 1 || added[0].Name != "new" {
+		t.Errorf("added = %+v", added)
+	}
+	for _, id := range []int64{a.ID, b.ID} {
+		tags, _ := s.ListTagsByVideo(ctx, id)
+		if len(tags) != 1 || tags[0].Name != "new" {
+			t.Errorf("video %d tags = %+v, want [new]", id, tags)
+		}
+	}
+}
+
+func TestUpsertVideo_ReturnsOwnSystemTags(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	a, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	s.UpdateVideoShowName(ctx, a.ID, "Show A") //nolint:errcheck
+
+	// b's row must not pick up a's show because a tag ID equals b's ID.
+	b, err := s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	if err != nil {
+		t.Fatalf("UpsertVideo: %v", err)
+	}
+	if b.ShowName != "" {
+		t.Errorf("new video ShowName = %q, want empty", b.ShowName)
+	}
+	if a, _ = s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4"); a.ShowName != "Show A" {
+		t.Errorf("re-upserted ShowName = %q, want Show A", a.ShowName)
+	}
+}
+
+func TestUpdateVideoFileStat(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	mtime := time.Unix(1700000000, 0)
+
+	if changed, err := s.UpdateVideoFileStat(ctx, v.ID, 100, mtime); err != nil || changed {
+		t.Fatalf("first record: changed=%v err=%v, want false <nil>", changed, err)
+	}
+	if changed, _ := s.UpdateVideoFileStat(ctx, v.ID, 100, mtime); changed {
+		t.Error("same stat reported as changed")
+	}
+	if changed, _ := s.UpdateVideoFileStat(ctx, v.ID, 100, mtime.Add(time.Second)); !changed {
+		t.Error("new mtime not reported as changed")
+	}
+	if _, err := s.UpdateVideoFileStat(ctx, 9999, 1, mtime); err == nil {
+		t.Error("expected error for unknown video")
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	kids, err := s.CreateProfile(ctx, "Kids")
+	if err != nil {
+		t.Fatalf("CreateProfile: %v", err)
+	}
+	if _, err := s.CreateProfile(ctx, "Kids"); err == nil {
+		t.Error("expected error for duplicate profile name")
+	}
+	tag, _ := s.UpsertTag(ctx, "kids")
+	if err := s.SetProfileLanding(ctx, kids.ID, tag.ID, "added"); err != nil {
+		t.Fatalf("SetProfileLanding: %v", err)
+	}
+	got, _ := s.GetProfile(ctx, kids.ID)
+	if got.LandingTagID != tag.ID || got.LandingSort != "added" {
+		t.Errorf("landing not saved: %+v", got)
+	}
+	if err := s.SetProfileLanding(ctx, 9999, 0, ""); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+
+	// Deleting the landing tag falls back to the unfiltered library.
+	s.PruneOrphanTags(ctx) //nolint:errcheck
+	got, _ = s.GetProfile(ctx, kids.ID)
+	if got.LandingTagID != 0 {
+		t.Errorf("landing tag should clear when the tag is deleted, got %d", got.LandingTagID)
+	}
+
+	if err := s.DeleteProfile(ctx, kids.ID); err != nil {
+		t.Fatalf("DeleteProfile: %v", err)
+	}
+	if profiles, _ := s.ListProfiles(ctx); len(profiles) != 0 {
+		t.Errorf("expected no profiles, got %v", profiles)
+	}
+}
+
+func TestVideoSourceAndMarkers(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+
+	if _, err := s.GetVideoSource(ctx, v.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a video without source, got %v", err)
+	}
+	want := store.VideoSource{
+		Extractor: "youtube", ID: "abc", URL: "https://www.youtube.com/watch?v=abc",
+		Uploader: "Some Channel", UploadDate: "2024-03-01",
+	}
+	if err := s.SetVideoSource(ctx, v.ID, want); err != nil {
+		t.Fatalf("SetVideoSource: %v", err)
+	}
+	if src, _ := s.GetVideoSource(ctx, v.ID); src != want {
+		t.Errorf("unexpected source: %+v", src)
+	}
+
+	manual := []store.Marker{{Kind: store.MarkerSkip, Start: 5, End: 10, Label: "recap"}}
+	s.SetVideoMarkers(ctx, v.ID, "user", manual)                 //nolint:errcheck
+	s.SetVideoMarkers(ctx, v.ID, "sponsorblock", []store.Marker{ //nolint:errcheck
+		{Kind: store.MarkerSkip, Start: 60, End: 90, Label: "sponsor"},
+		{Kind: store.MarkerSkip, Start: 1, End: 3, Label: "intro"},
+	})
+	// A refresh replaces only that source's markers.
+	s.SetVideoMarkers(ctx, v.ID, "sponsorblock", []store.Marker{ //nolint:errcheck
+		{Kind: store.MarkerSkip, Start: 1, End: 4, Label: "intro"},
+	})
+	markers, err := s.ListVideoMarkers(ctx, v.ID)
+	if err != nil {
+		t.Fatalf("ListVideoMarkers: %v", err)
+	}
+	if len(markers) != 2 || markers[0].End != 4 || markers[0].Source != "sponsorblock" || markers[1].Label != "recap" {
+		t.Errorf("unexpected markers: %+v", markers)
+	}
+}
+
+func TestVideoExternalIDs(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+
+	// A YouTube download records its ID as the video's YouTube ID.
+	s.SetVideoSource(ctx, v.ID, store.VideoSource{Extractor: "youtube", ID: "abc"}) //nolint:errcheck
+	if err := s.SetVideoExternalID(ctx, v.ID, store.ExternalIMDb, "tt0133093"); err != nil {
+		t.Fatalf("SetVideoExternalID: %v", err)
+	}
+	s.SetVideoExternalID(ctx, v.ID, store.ExternalIMDb, "tt0234215") //nolint:errcheck
+	ids, err := s.ListVideoExternalIDs(ctx, v.ID)
+	if err != nil {
+		t.Fatalf("ListVideoExternalIDs: %v", err)
+	}
+	if len(ids) != 2 || ids[store.ExternalYouTube] != "abc" || ids[store.ExternalIMDb] != "tt0234215" {
+		t.Errorf("unexpected IDs: %v", ids)
+	}
+	if id, err := s.FindVideoByExternalID(ctx, store.ExternalIMDb, "tt0234215"); err != nil || id != v.ID {
+		t.Errorf("FindVideoByExternalID = %d, %v; want %d", id, err, v.ID)
+	}
+
+	// An empty ID clears it.
+	s.SetVideoExternalID(ctx, v.ID, store.ExternalIMDb, "") //nolint:errcheck
+	if _, err := s.FindVideoByExternalID(ctx, store.ExternalIMDb, "tt0234215"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after clearing, got %v", err)
+	}
+	if err := s.SetVideoExternalID(ctx, 9999, store.ExternalIMDb, "tt1"); !errors.Is(err, store.ErrForeignKey) {
+		t.Errorf("expected ErrForeignKey for an unknown video, got %v", err)
+	}
+}
+
+func TestSaveShow(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	if _, err := s.GetShow(ctx, "Lost"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown show, got %v", err)
+	}
+	first, err := s.SaveShow(ctx, store.Show{
+		Name: "Lost", Overview: "Castaways.", PosterPath: "/posters/1.jpg",
+		ExternalIDs: map[string]string{store.ExternalTMDB: "tv/4607"},
+	})
+	if err != nil {
+		t.Fatalf("SaveShow: %v", err)
+	}
+	// A later save keeps what it leaves empty and merges external IDs.
+	again, err := s.SaveShow(ctx, store.Show{
+		Name: "Lost", ExternalIDs: map[string]string{store.ExternalIMDb: "tt0411008"},
+	})
+	if err != nil {
+		t.Fatalf("SaveShow again: %v", err)
+	}
+	if again.ID != first.ID || again.Overview != "Castaways." || again.PosterPath != "/posters/1.jpg" ||
+		len(again.ExternalIDs) != 2 || again.ExternalIDs[store.ExternalIMDb] != "tt0411008" {
+		t.Errorf("unexpected show after second save: %+v", again)
+	}
+	s.SaveShow(ctx, store.Show{Name: "Fringe"}) //nolint:errcheck
+	shows, err := s.ListShows(ctx)
+	if err != nil || len(shows) != 2 || shows[0].Name != "Fringe" || len(shows[0].ExternalIDs) != 0 ||
+		shows[1].ExternalIDs[store.ExternalTMDB] != "tv/4607" {
+		t.Errorf("ListShows = %+v, %v", shows, err)
+	}
+	// Each show gets its own IDs and no one else's.
+	if fringe, err := s.GetShow(ctx, "Fringe"); err != nil || fringe.ExternalIDs == nil || len(fringe.ExternalIDs) != 0 {
+		t.Errorf("GetShow(Fringe) = %+v, %v; want no external IDs", fringe, err)
+	}
+}
+
+func TestDirectorySyncSchedule(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/a")
+	if !d.SyncedAt.IsZero() || d.SyncEvery != 0 {
+		t.Errorf("new directory: synced %v, every %v; want never and every poll", d.SyncedAt, d.SyncEvery)
+	}
+	at := time.Unix(1700000000, 0)
+	if err := s.SetDirectorySyncEvery(ctx, d.ID, 5*time.Minute); err != nil {
+		t.Fatalf("SetDirectorySyncEvery: %v", err)
+	}
+	if err := s.SetDirectorySynced(ctx, d.ID, at); err != nil {
+		t.Fatalf("SetDirectorySynced: %v", err)
+	}
+	if got, _ := s.GetDirectory(ctx, d.ID); got.SyncEvery != 5*time.Minute || !got.SyncedAt.Equal(at) {
+		t.Errorf("got every %v, synced %v; want 5m and %v", got.SyncEvery, got.SyncedAt, at)
+	}
+	if err := s.SetDirectorySyncEvery(ctx, 9999, time.Hour); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unknown directory: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestDirectoryBudgetAndUsage(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	a, _ := s.AddDirectory(ctx, "/a")
+	b, _ := s.AddDirectory(ctx, "/b")
+	if err := s.SetDirectoryBudget(ctx, a.ID, 1000, 2000); err != nil {
+		t.Fatalf("SetDirectoryBudget: %v", err)
+	}
+	if d, _ := s.GetDirectory(ctx, a.ID); d.BudgetBytes != 1000 || d.CapBytes != 2000 {
+		t.Errorf("got budget %d, cap %d; want 1000, 2000", d.BudgetBytes, d.CapBytes)
+	}
+	if err := s.SetDirectoryBudget(ctx, 9999, 1, 1); err == nil {
+		t.Error("expected an error for an unknown directory")
+	}
+
+	v1, _ := s.UpsertVideo(ctx, a.ID, a.Path, "1.mp4")
+	v2, _ := s.UpsertVideo(ctx, a.ID, a.Path, "2.mp4")
+	s.UpdateVideoFileStat(ctx, v1.ID, 700, time.Unix(0, 0)) //nolint:errcheck
+	s.UpdateVideoFileStat(ctx, v2.ID, 600, time.Unix(0, 0)) //nolint:errcheck
+	s.UpsertVideo(ctx, b.ID, b.Path, "3.mp4")               //nolint:errcheck
+	usage, err := s.DirectoryUsage(ctx)
+	if err != nil {
+		t.Fatalf("DirectoryUsage: %v", err)
+	}
+	if usage[a.ID] != 1300 || usage[b.ID] != 0 || len(usage) != 2 {
+		t.Errorf("got %v, want %d:1300 and %d:0", usage, a.ID, b.ID)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	alice, err := s.CreateUser(ctx, "alice", "hash-a", store.RoleAdmin)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := s.CreateUser(ctx, "ALICE", "", store.RoleViewer); err == nil {
+		t.Error("expected usernames to be unique regardless of case")
+	}
+	if _, err := s.CreateUser(ctx, "mallory", "", "owner"); err == nil {
+		t.Error("expected an unknown role to be rejected")
+	}
+	bob, _ := s.CreateUser(ctx, "bob", "", store.RoleViewer)
+
+	u, hash, err := s.GetUserByName(ctx, "Alice")
+	if err != nil || u.ID != alice.ID || hash != "hash-a" {
+		t.Errorf("GetUserByName = %+v, %q, %v", u, hash, err)
+	}
+	if err := s.SetUserRole(ctx, bob.ID, store.RoleAdmin); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	s.SetUserPassword(ctx, bob.ID, "hash-b") //nolint:errcheck
+	if u, hash, _ := s.GetUserByName(ctx, "bob"); u.Role != store.RoleAdmin || hash != "hash-b" {
+		t.Errorf("expected bob to be an admin with a password, got %+v, %q", u, hash)
+	}
+	if users, _ := s.ListUsers(ctx); len(users) != 2 || users[0].Username != "alice" {
+		t.Errorf("ListUsers = %+v", users)
+	}
+
+	// Deleting an account ends its sessions.
+	s.SaveSession(ctx, "tok-bob", time.Now().Add(time.Hour))    //nolint:errcheck
+	s.SetSessionUser(ctx, "tok-bob", bob.ID)                    //nolint:errcheck
+	s.SaveSession(ctx, "tok-shared", time.Now().Add(time.Hour)) //nolint:errcheck
+	if m, _ := s.LoadSessionUsers(ctx); m["tok-bob"] != bob.ID || len(m) != 1 {
+		t.Errorf("LoadSessionUsers = %v", m)
+	}
+	if err := s.DeleteUser(ctx, bob.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if sessions, _ := s.LoadSessions(ctx); len(sessions) != 1 {
+		t.Errorf("expected only the shared session to remain, got %v", sessions)
+	}
+	if err := s.DeleteUser(ctx, bob.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("deleting twice: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	if _, err := s.GetVideo(ctx, 999); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetVideo of a missing video: got %v, want ErrNotFound", err)
+	}
+	if err := s.UpdateVideoName(ctx, 999, "x"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateVideoName of a missing video: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.AddDirectory(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddDirectory(ctx, dir); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("adding a directory twice: got %v, want ErrConflict", err)
+	}
+	if _, err := s.CreateUser(ctx, "alice", "", store.RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateUser(ctx, "alice", "", store.RoleViewer); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("creating a user twice: got %v, want ErrConflict", err)
+	}
+	tag, _ := s.UpsertTag(ctx, "drama")
+	if err := s.TagVideo(ctx, 999, tag.ID); !errors.Is(err, store.ErrForeignKey) {
+		t.Errorf("tagging a missing video: got %v, want ErrForeignKey", err)
+	}
+}
+
+func TestBookmarks(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	other, _ := s.UpsertVideo(ctx, d.ID, d.Path, "other.mp4")
+
+	late, err := s.AddBookmark(ctx, v.ID, 600, "the twist")
+	if err != nil {
+		t.Fatalf("AddBookmark: %v", err)
+	}
+	s.AddBookmark(ctx, v.ID, 90.5, "") //nolint:errcheck
+	got, err := s.ListBookmarks(ctx, v.ID)
+	if err != nil || len(got) != 2 || got[0].Position != 90.5 || got[1].Label != "the twist" {
+		t.Fatalf("ListBookmarks = %+v, %v", got, err)
+	}
+	if err := s.DeleteBookmark(ctx, other.ID, late.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("deleting through another video: expected ErrNotFound, got %v", err)
+	}
+	if err := s.DeleteBookmark(ctx, v.ID, late.ID); err != nil {
+		t.Fatalf("DeleteBookmark: %v", err)
+	}
+	if got, _ := s.ListBookmarks(ctx, v.ID); len(got) != 1 {
+		t.Errorf("expected 1 bookmark after delete, got %d", len(got))
+	}
+}
+
+func TestShowEpisodes(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	show, _ := s.SaveShow(ctx, store.Show{Name: "Lost"})
+	s.SetShowEpisodes(ctx, show.ID, []store.ShowEpisode{{Season: 2, Episode: 1}, {Season: 1, Episode: 2}}) //nolint:errcheck
+	// A new list replaces the old one.
+	if err := s.SetShowEpisodes(ctx, show.ID, []store.ShowEpisode{
+		{Season: 1, Episode: 2, Title: "Pilot, Part 2", AirDate: "2004-09-29"},
+		{Season: 1, Episode: 1, Title: "Pilot, Part 1", AirDate: "2004-09-22"},
+	}); err != nil {
+		t.Fatalf("SetShowEpisodes: %v", err)
+	}
+	got, err := s.ListShowEpisodes(ctx, show.ID)
+	if err != nil || len(got) != 2 || got[0].Title != "Pilot, Part 1" || got[1].AirDate != "2004-09-29" {
+		t.Errorf("ListShowEpisodes = %+v, %v", got, err)
+	}
+}
+
+func TestRecordProgress_DoesNotMarkWatched(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+
+	if err := s.RecordProgress(ctx, v.ID, 120); err != nil {
+		t.Fatalf("RecordProgress: %v", err)
+	}
+	got, _ := s.GetVideo(ctx, v.ID)
+	rec, err := s.GetWatch(ctx, v.ID)
+	if got.Watched || err != nil || rec.Position != 120 {
+		t.Errorf("watched=%v position=%v err=%v; want unwatched at 120", got.Watched, rec.Position, err)
+	}
+	// A watched video stays watched when its position is saved again.
+	s.RecordWatch(ctx, v.ID, 1)    //nolint:errcheck
+	s.RecordProgress(ctx, v.ID, 5) //nolint:errcheck
+	if got, _ := s.GetVideo(ctx, v.ID); !got.Watched {
+		t.Error("RecordProgress unmarked a watched video")
+	}
+}
+
+func TestWatchOrders(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	o, err := s.SaveWatchOrder(ctx, store.WatchOrder{Name: "Crisis", Entries: []store.WatchOrderEntry{{Show: "Arrow", Season: 8, Episode: 8}}})
+	if err != nil {
+		t.Fatalf("SaveWatchOrder: %v", err)
+	}
+	// Saving under the same name replaces the entries.
+	again, err := s.SaveWatchOrder(ctx, store.WatchOrder{Name: "Crisis", Entries: []store.WatchOrderEntry{
+		{Show: "Supergirl", Season: 5, Episode: 9},
+		{Show: "Batwoman", Season: 1, Episode: 9},
+	}})
+	if err != nil || again.ID != o.ID {
+		t.Fatalf("re-save = %+v, %v; want ID %d", again, err, o.ID)
+	}
+	got, err := s.GetWatchOrder(ctx, o.ID)
+	if err != nil || len(got.Entries) != 2 || got.Entries[0].Show != "Supergirl" || got.Entries[1].Episode != 9 {
+		t.Errorf("GetWatchOrder = %+v, %v", got, err)
+	}
+	if list, _ := s.ListWatchOrders(ctx); len(list) != 1 || list[0].Name != "Crisis" {
+		t.Errorf("ListWatchOrders = %+v", list)
+	}
+	if err := s.DeleteWatchOrder(ctx, o.ID); err != nil {
+		t.Fatalf("DeleteWatchOrder: %v", err)
+	}
+	if _, err := s.GetWatchOrder(ctx, o.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("after delete: err = %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteWatchOrder(ctx, o.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("second delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestArchivePolicies(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	home, _ := s.UpsertVideo(ctx, d.ID, d.Path, "home.mp4")
+	clip, _ := s.UpsertVideo(ctx, d.ID, d.Path, "clip.mp4")
+	seen, _ := s.UpsertVideo(ctx, d.ID, d.Path, "seen.mp4")
+	for _, v := range []store.Video{clip, seen} {
+		s.UpdateVideoType(ctx, v.ID, "YouTube") //nolint:errcheck
+	}
+	tag, _ := s.UpsertTag(ctx, "family")
+	s.TagVideo(ctx, home.ID, tag.ID) //nolint:errcheck
+
+	keep, err := s.SaveArchivePolicy(ctx, store.ArchivePolicy{Name: "Home", TagID: tag.ID, Action: store.ArchiveKeep})
+	if err != nil {
+		t.Fatalf("SaveArchivePolicy: %v", err)
+	}
+	want := store.ArchivePolicy{Name: "Downloads", VideoType: "YouTube", Action: store.ArchiveMove, Days: 180, DirectoryID: d.ID}
+	move, _ := s.SaveArchivePolicy(ctx, want)
+	want.ID = move.ID
+	if got, err := s.GetArchivePolicy(ctx, move.ID); err != nil || got != want {
+		t.Errorf("GetArchivePolicy = %+v, %v; want %+v", got, err, want)
+	}
+	// Saving under the same name replaces the rest.
+	if again, _ := s.SaveArchivePolicy(ctx, store.ArchivePolicy{Name: "Home", Action: store.ArchiveTrash, Days: 9}); again.ID != keep.ID || again.Days != 9 {
+		t.Errorf("replaced policy = %+v, want ID %d and 9 days", again, keep.ID)
+	}
+	if list, _ := s.ListArchivePolicies(ctx); len(list) != 2 || list[0].Name != "Downloads" {
+		t.Errorf("ListArchivePolicies = %+v", list)
+	}
+
+	// Idle: neither added nor played since the cutoff.
+	later := time.Now().Add(time.Hour)
+	s.RecordWatch(ctx, seen.ID, 10) //nolint:errcheck
+	idle, err := s.ListIdleVideos(ctx, 0, "YouTube", later)
+	if err != nil || len(idle) != 2 {
+		t.Fatalf("ListIdleVideos = %+v, %v; want 2", idle, err)
+	}
+	if idle, _ := s.ListIdleVideos(ctx, tag.ID, "", later); len(idle) != 1 || idle[0].ID != home.ID {
+		t.Errorf("idle with tag = %+v, want home.mp4", idle)
+	}
+	if idle, _ := s.ListIdleVideos(ctx, 0, "", time.Now().Add(-time.Hour)); len(idle) != 0 {
+		t.Errorf("idle an hour ago = %+v, want none", idle)
+	}
+
+	// Proposals keep their dismissal while proposed by the same policy.
+	if err := s.SetArchiveProposals(ctx, map[int64]int64{clip.ID: move.ID, home.ID: keep.ID}, time.Now()); err != nil {
+		t.Fatalf("SetArchiveProposals: %v", err)
+	}
+	if err := s.DismissArchiveProposal(ctx, clip.ID); err != nil {
+		t.Fatalf("DismissArchiveProposal: %v", err)
+	}
+	s.SetArchiveProposals(ctx, map[int64]int64{clip.ID: move.ID, seen.ID: move.ID}, time.Now().Add(time.Hour)) //nolint:errcheck
+	got, _ := s.ListArchiveProposals(ctx)
+	if len(got) != 2 {
+		t.Fatalf("ListArchiveProposals = %+v, want clip and seen", got)
+	}
+	if p, _ := s.GetArchiveProposal(ctx, clip.ID); !p.Dismissed {
+		t.Errorf("clip's dismissal was lost: %+v", p)
+	}
+	if p, _ := s.GetArchiveProposal(ctx, seen.ID); p.ProposedAt != time.Now().Add(time.Hour).UTC().Format(time.DateTime) {
+		t.Errorf("new proposal dated %q, want an hour from now", p.ProposedAt)
+	}
+	if _, err := s.GetArchiveProposal(ctx, home.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("dropped proposal: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteArchiveProposal(ctx, seen.ID); err != nil {
+		t.Errorf("DeleteArchiveProposal: %v", err)
+	}
+	// Deleting the policy drops its proposals.
+	if err := s.DeleteArchivePolicy(ctx, move.ID); err != nil {
+		t.Fatalf("DeleteArchivePolicy: %v", err)
+	}
+	if got, _ := s.ListArchiveProposals(ctx); len(got) != 0 {
+		t.Errorf("proposals after deleting the policy = %+v", got)
+	}
+	if err := s.DeleteArchivePolicy(ctx, move.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("delete twice: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestSmartPlaylists(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	q := store.VideoQuery{Search: "noir", TagIDs: []int64{3, 7}, AllTags: true, Type: "Movie",
+		DirectoryID: 2, MinRating: 1, Watched: "no", Sort: "added"}
+	p, err := s.SaveSmartPlaylist(ctx, store.SmartPlaylist{Name: "Noir", Query: q})
+	if err != nil {
+		t.Fatalf("SaveSmartPlaylist: %v", err)
+	}
+	got, err := s.GetSmartPlaylist(ctx, p.ID)
+	if err != nil || got.Name != "Noir" || !reflect.DeepEqual(got.Query, q) {
+		t.Errorf("GetSmartPlaylist = %+v, %v; want query %+v", got, err, q)
+	}
+	// Saving under the same name replaces the filter.
+	again, err := s.SaveSmartPlaylist(ctx, store.SmartPlaylist{Name: "Noir", Query: store.VideoQuery{MinRating: 2}})
+	if err != nil || again.ID != p.ID || again.Query.Search != "" || len(again.Query.TagIDs) != 0 || again.Query.MinRating != 2 {
+		t.Fatalf("re-save = %+v, %v; want ID %d with only the rating", again, err, p.ID)
+	}
+	s.SaveSmartPlaylist(ctx, store.SmartPlaylist{Name: "Cartoons"}) //nolint:errcheck
+	if list, _ := s.ListSmartPlaylists(ctx); len(list) != 2 || list[0].Name != "Cartoons" || list[1].Name != "Noir" {
+		t.Errorf("ListSmartPlaylists = %+v", list)
+	}
+	if err := s.DeleteSmartPlaylist(ctx, p.ID); err != nil {
+		t.Fatalf("DeleteSmartPlaylist: %v", err)
+	}
+	if _, err := s.GetSmartPlaylist(ctx, p.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("after delete: err = %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteSmartPlaylist(ctx, p.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("second delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestListTagRatings(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	tag, _ := s.UpsertTag(ctx, "noir")
+	s.UpsertTag(ctx, "unused") //nolint:errcheck
+	for i, rating := range []int{0, 1, 2, 2} {
+		v, _ := s.UpsertVideo(ctx, d.ID, d.Path, string(rune('a'+i))+".mp4")
+		s.SetVideoRating(ctx, v.ID, rating) //nolint:errcheck
+		s.TagVideo(ctx, v.ID, tag.ID)       //nolint:errcheck
+	}
+	got, err := s.ListTagRatings(ctx)
+	if err != nil {
+		t.Fatalf("ListTagRatings: %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "noir" || got[0].Videos != 4 || got[0].Liked != 1 ||
+		got[0].Favourites != 2 || got[0].Average != 1.25 {
+		t.Errorf("ListTagRatings = %+v, want only noir rated 1.25 over 4 videos", got)
+	}
+}
+
+func TestQualityPresets(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	p, err := s.CreateQualityPreset(ctx, store.QualityPreset{Name: "Phone over LTE", MaxHeight: 720, BitrateK: 2000})
+	if err != nil {
+		t.Fatalf("CreateQualityPreset: %v", err)
+	}
+	if _, err := s.CreateQualityPreset(ctx, store.QualityPreset{Name: "Phone over LTE"}); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("duplicate name: err = %v, want ErrConflict", err)
+	}
+	if got, err := s.GetQualityPreset(ctx, p.ID); err != nil || got != p {
+		t.Errorf("GetQualityPreset = %+v, %v; want %+v", got, err, p)
+	}
+	if list, _ := s.ListQualityPresets(ctx); len(list) != 1 || list[0] != p {
+		t.Errorf("ListQualityPresets = %+v", list)
+	}
+	if err := s.DeleteQualityPreset(ctx, p.ID); err != nil {
+		t.Fatalf("DeleteQualityPreset: %v", err)
+	}
+	if _, err := s.GetQualityPreset(ctx, p.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("after delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	v, _ := s.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	for _, msg := range []string{"one", "two", "three"} {
+		if _, err := s.AddNotification(ctx, store.Notification{UserID: 7, Kind: store.NotifyDownload, Message: msg, VideoID: v.ID}, 2); err != nil {
+			t.Fatalf("AddNotification: %v", err)
+		}
+	}
+	s.AddNotification(ctx, store.Notification{Kind: store.NotifySync, Message: "shared"}, 2) //nolint:errcheck
+
+	list, err := s.ListNotifications(ctx, 7, 10)
+	if err != nil || len(list) != 2 || list[0].Message != "three" || list[1].Message != "two" || list[0].VideoID != v.ID {
+		t.Fatalf("ListNotifications = %+v, %v; want the newest two", list, err)
+	}
+	if n, _ := s.CountUnreadNotifications(ctx, 7); n != 2 {
+		t.Errorf("unread = %d, want 2", n)
+	}
+	if err := s.MarkNotificationRead(ctx, 0, list[0].ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("another user's notification: err = %v, want ErrNotFound", err)
+	}
+	if err := s.MarkNotificationRead(ctx, 7, list[0].ID); err != nil {
+		t.Fatalf("MarkNotificationRead: %v", err)
+	}
+	if n, _ := s.CountUnreadNotifications(ctx, 7); n != 1 {
+		t.Errorf("unread after one read = %d, want 1", n)
+	}
+	if err := s.MarkAllNotificationsRead(ctx, 7); err != nil {
+		t.Fatalf("MarkAllNotificationsRead: %v", err)
+	}
+	if n, _ := s.CountUnreadNotifications(ctx, 7); n != 0 {
+		t.Errorf("unread after all read = %d, want 0", n)
+	}
+	if n, _ := s.CountUnreadNotifications(ctx, 0); n != 1 {
+		t.Errorf("the shared user's unread = %d, want 1", n)
+	}
+
+	// Deleting the video keeps the notification, without its link.
+	s.DeleteVideo(ctx, v.ID) //nolint:errcheck
+	if list, _ := s.ListNotifications(ctx, 7, 1); len(list) != 1 || list[0].VideoID != 0 {
+		t.Errorf("after deleting the video: %+v", list)
+	}
+}
+
+func TestReportSubscriptions(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	s.AddNotification(ctx, store.Notification{UserID: 7, Kind: store.NotifyExport, Message: "failed", Failed: true}, 10) //nolint:errcheck
+	if list, err := s.ListNotificationsSince(ctx, 7, "2000-01-01 00:00:00"); err != nil || len(list) != 1 || !list[0].Failed {
+		t.Errorf("ListNotificationsSince = %+v, %v", list, err)
+	}
+	if list, _ := s.ListNotificationsSince(ctx, 7, "2999-01-01 00:00:00"); len(list) != 0 {
+		t.Errorf("notifications from the future: %+v", list)
+	}
+
+	if _, err := s.GetReportSubscription(ctx, 7); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("before opting in: want ErrNotFound, got %v", err)
+	}
+	s.SetReportSubscription(ctx, 0, "")                //nolint:errcheck
+	s.SetReportSubscription(ctx, 7, "old@example.com") //nolint:errcheck
+	s.SetReportSubscription(ctx, 7, "me@example.com")  //nolint:errcheck
+	s.MarkReportSent(ctx, 7, "2026-01-02 06:00:00")    //nolint:errcheck
+	if sub, err := s.GetReportSubscription(ctx, 7); err != nil || sub.Email != "me@example.com" || sub.LastSent != "2026-01-02 06:00:00" {
+		t.Errorf("GetReportSubscription = %+v, %v", sub, err)
+	}
+	if subs, _ := s.ListReportSubscriptions(ctx); len(subs) != 2 || subs[0].UserID != 0 || subs[1].UserID != 7 {
+		t.Errorf("ListReportSubscriptions = %+v", subs)
+	}
+	s.DeleteReportSubscription(ctx, 0) //nolint:errcheck
+	if subs, _ := s.ListReportSubscriptions(ctx); len(subs) != 1 {
+		t.Errorf("after opting out: %+v", subs)
+	}
+}
+
+func TestLibraryStatistics(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	a, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	s.UpdateVideoDuration(ctx, a.ID, 600)                  //nolint:errcheck
+	s.UpdateVideoFileStat(ctx, a.ID, 100, time.Unix(0, 0)) //nolint:errcheck
+	s.UpdateVideoFileStat(ctx, b.ID, 50, time.Unix(0, 0))  //nolint:errcheck
+
+	totals, err := s.LibraryTotals(ctx)
+	if err != nil {
+		t.Fatalf("LibraryTotals: %v", err)
+	}
+	if totals != (store.LibraryTotals{Videos: 2, DurationS: 600, Bytes: 150}) {
+		t.Errorf("LibraryTotals = %+v", totals)
+	}
+
+	s.RecordWatch(ctx, b.ID, 0) //nolint:errcheck
+	s.ClearWatch(ctx, b.ID)     //nolint:errcheck
+	s.RecordWatch(ctx, b.ID, 0) //nolint:errcheck
+	s.RecordWatch(ctx, a.ID, 0) //nolint:errcheck
+	top, err := s.ListMostWatched(ctx, 1)
+	if err != nil {
+		t.Fatalf("ListMostWatched: %v", err)
+	}
+	if len(top) != 1 || top[0] != (store.WatchCount{VideoID: b.ID, Watches: 2}) {
+		t.Errorf("ListMostWatched = %+v, want b twice", top)
+	}
+
+	weeks, err := s.ListWeeklyWatchTime(ctx, time.Now().AddDate(0, 0, -7))
+	if err != nil {
+		t.Fatalf("ListWeeklyWatchTime: %v", err)
+	}
+	monday := time.Now().UTC()
+	monday = monday.AddDate(0, 0, -(int(monday.Weekday())+6)%7)
+	if len(weeks) != 1 || weeks[0] != (store.WeekWatchTime{Week: monday.Format(time.DateOnly), Watches: 3, Seconds: 600}) {
+		t.Errorf("ListWeeklyWatchTime = %+v, want this week (%s): 3 watches, 600 s", weeks, monday.Format(time.DateOnly))
+	}
+	if weeks, _ := s.ListWeeklyWatchTime(ctx, time.Now().AddDate(0, 0, 14)); len(weeks) != 0 {
+		t.Errorf("weeks after now = %+v, want none", weeks)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	for _, e := range []store.Event{
+		{Kind: store.NotifySync, Message: "new videos", Audience: store.AudienceEveryone},
+		{Kind: store.NotifyBudget, Message: "over budget", Audience: store.AudienceAdmins, Payload: `{"event":"storage_limit_exceeded"}`},
+		{Kind: store.NotifyDownload, Message: "downloaded", Audience: store.AudienceUser, UserID: 7, Failed: true},
+	} {
+		if _, err := s.AddEvent(ctx, e, 3); err != nil {
+			t.Fatalf("AddEvent: %v", err)
+		}
+	}
+	messages := func(q store.EventQuery) []string {
+		t.Helper()
+		list, err := s.ListEvents(ctx, q)
+		if err != nil {
+			t.Fatalf("ListEvents: %v", err)
+		}
+		var out []string
+		for _, e := range list {
+			out = append(out, e.Message)
+		}
+		return out
+	}
+	if got := messages(store.EventQuery{UserID: 7, Limit: 10}); !slices.Equal(got, []string{"downloaded", "new videos"}) {
+		t.Errorf("viewer 7 sees %v", got)
+	}
+	if got := messages(store.EventQuery{Admin: true, Limit: 10}); !slices.Equal(got, []string{"over budget", "new videos"}) {
+		t.Errorf("an admin sees %v", got)
+	}
+	list, _ := s.ListEvents(ctx, store.EventQuery{Admin: true, Limit: 1})
+	if len(list) != 1 || list[0].Payload == "" || list[0].CreatedAt == "" {
+		t.Errorf("newest admin event = %+v", list)
+	}
+
+	// Only the newest keep are kept.
+	s.AddEvent(ctx, store.Event{Kind: store.NotifySync, Message: "more videos", Audience: store.AudienceEveryone}, 3) //nolint:errcheck
+	if got := messages(store.EventQuery{UserID: 7, Limit: 10}); !slices.Equal(got, []string{"more videos", "downloaded"}) {
+		t.Errorf("after pruning viewer 7 sees %v", got)
+	}
+	if got := messages(store.EventQuery{UserID: 7, AfterID: list[0].ID, Limit: 10}); !slices.Equal(got, []string{"more videos", "downloaded"}) {
+		t.Errorf("events after %d: %v", list[0].ID, got)
+	}
+}
+
+func TestBytesServed(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	d, _ := s.AddDirectory(ctx, "/videos")
+	a, _ := s.UpsertVideo(ctx, d.ID, d.Path, "a.mp4")
+	b, _ := s.UpsertVideo(ctx, d.ID, d.Path, "b.mp4")
+	if err := s.AddBytesServed(ctx, map[int64]int64{a.ID: 100, b.ID: 300}); err != nil {
+		t.Fatalf("AddBytesServed: %v", err)
+	}
+	if err := s.AddBytesServed(ctx, map[int64]int64{a.ID: 250, 999: 1}); err != nil {
+		t.Fatalf("AddBytesServed with a removed video: %v", err)
+	}
+	got, err := s.ListMostServed(ctx, 5)
+	if err != nil {
+		t.Fatalf("ListMostServed: %v", err)
+	}
+	want := []store.VideoBytes{{VideoID: a.ID, Bytes: 350}, {VideoID: b.ID, Bytes: 300}}
+	if !slices.Equal(got, want) {
+		t.Errorf("ListMostServed = %+v, want %+v", got, want)
+	}
+	if totals, _ := s.LibraryTotals(ctx); totals.Served != 650 {
+		t.Errorf("LibraryTotals.Served = %d, want 650", totals.Served)
+	}
+}
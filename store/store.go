@@ -10,6 +10,46 @@ import (
 type Directory struct {
 	ID   int64
 	Path string
+	// Excludes are glob patterns for files and folders that syncDir skips.
+	// A pattern without a slash matches any file or folder name; one with a
+	// slash matches the path relative to Path, where "**" spans folders.
+	Excludes []string
+	// MaxDepth limits how many folder levels below Path syncDir descends
+	// (1 = direct subfolders only). 0 means unlimited.
+	MaxDepth int
+	// FollowSymlinks makes syncDir descend into symlinked folders. Each real
+	// folder is scanned at most once, which breaks symlink loops.
+	FollowSymlinks bool
+	// PruneEmpty removes the folders below Path that deleting or moving
+	// videos leaves empty.
+	PruneEmpty bool
+	// ParentID is the directory this one was registered under as an
+	// immediate subfolder; 0 for top-level entries.
+	ParentID int64
+	// Label is an optional display name; empty means the folder name.
+	Label string
+	// Offline is set while the folder is unreachable, e.g. on an unplugged
+	// external drive. syncDir updates it on every scan.
+	Offline bool
+	// BudgetBytes is a soft storage limit: exceeding it raises a warning.
+	// CapBytes is a hard one: downloads into the directory are refused once
+	// it is reached. 0 means no limit.
+	BudgetBytes int64
+	CapBytes    int64
+	// SyncEvery is how often the library poller rescans the directory; 0
+	// means on every poll. SyncedAt is when its last scan started, zero if
+	// it has not been scanned.
+	SyncEvery time.Duration
+	SyncedAt  time.Time
+}
+
+// Title returns the label if set, otherwise the folder name. It is also the
+// name of the tag syncDir applies to the directory's videos.
+func (d Directory) Title() string {
+	if d.Label != "" {
+		return d.Label
+	}
+	return filepath.Base(d.Path)
 }
 
 // Video represents a video file with optional metadata.
@@ -22,6 +62,8 @@ type Video struct {
 	ShowName         string
 	VideoType        string // classification: TV, Movie, Concert, Vlog, Blog, YouTube
 	Rating           int    // 0=neutral, 1=liked, 2=double-liked
+	Stars            int    // 1 to 5, 0 for unrated; see SetVideoStars
+	Favorite         bool   // marked to watch again soon; independent of the rating
 	OriginalFilename string // filename at first import; never changed on rename/move
 	// Standardised descriptive fields (see VideoFields).
 	Genre         string
@@ -31,10 +73,14 @@ type Video struct {
 	Actors        string
 	Studio        string
 	Channel       string
-	AirDate       string  // original air/release date, e.g. "2023-04-15" (optional)
-	ThumbnailPath string  // relative or absolute path to thumbnail image
-	DurationS     float64 // total duration in seconds; 0 means unknown
-	ColorLabel    string  // color label: red, orange, yellow, green, blue, purple, or empty
+	AirDate       string    // original air/release date, e.g. "2023-04-15" (optional)
+	ThumbnailPath string    // relative or absolute path to thumbnail image
+	DurationS     float64   // total duration in seconds; 0 means unknown
+	Width         int       // video stream width in pixels; 0 means unknown
+	Height        int       // video stream height in pixels; 0 means unknown
+	FileSize      int64     // bytes at the last scan; 0 means not yet recorded
+	FileModTime   time.Time // modification time at the last scan; zero means not yet recorded
+	ColorLabel    string    // color label: red, orange, yellow, green, blue, purple, or empty
 	// WatchedAt holds the last watch timestamp (SQLite datetime string, empty if never watched).
 	// Populated by list queries via LEFT JOIN watch_history — do not set manually.
 	WatchedAt string
@@ -54,6 +100,74 @@ type VideoFields struct {
 	AirDate       string
 }
 
+// VideoQuery selects and orders a page of the library for ListVideosPage.
+// The filters combine: a video must pass every one that is set.
+type VideoQuery struct {
+	Search      string // text matched like SearchVideos
+	TagID       int64  // only videos with this tag; 0 for all
+	DirectoryID int64  // only videos in this directory; 0 for all
+	Type        string // only videos of this type
+	MinRating   int    // only videos rated at least this
+	Watched     string // "yes" for only watched videos, "no" for only unwatched
+	Favorites   bool   // only videos marked favorite
+	Companions  bool   // include photo companion clips, left out otherwise
+	// TagIDs limits the list to videos with any of these tags, or with all
+	// of them when AllTags is set.
+	TagIDs  []int64
+	AllTags bool
+	// Sort is "rating" (highest first), "stars" (most stars first),
+	// "added" (newest first), "watched" (most recently watched first, never
+	// watched last), "duration" (longest first), "size" (largest first) or
+	// empty for by folder, then title.
+	Sort   string
+	Limit  int // at most this many videos; 0 for all
+	Offset int // skip this many first
+}
+
+// RandomFilter narrows GetRandomVideoFiltered's pick. The zero value allows
+// every playable video.
+type RandomFilter struct {
+	Unwatched    bool    // only videos not yet watched
+	MinRating    int     // only videos rated at least this
+	TagIDs       []int64 // only videos with any of these tags
+	ExcludeShows bool    // leave out videos with a show
+	Exclude      []int64 // leave out these videos
+}
+
+// VideoInput names a video file for UpsertVideos.
+type VideoInput struct {
+	DirectoryID   int64
+	DirectoryPath string // the folder containing the file
+	Filename      string
+}
+
+// VideoScan is what a library scan learned about one video, written by
+// SaveVideoScans. Empty fields leave the stored values alone, except
+// Sidecars, which always replaces the recorded companion files.
+type VideoScan struct {
+	VideoID     int64
+	FileSize    int64     // recorded together with FileModTime
+	FileModTime time.Time // zero when the file was not statted
+	// Reset clears the duration, resolution, codecs and MarkerSource's
+	// markers before the fields below are applied, for a file changed
+	// since the last scan.
+	Reset          bool
+	ClearThumbnail bool
+	ShowName       string
+	DisplayName    string
+	Description    string
+	Genre          string
+	VideoType      string
+	DurationS      float64
+	Width, Height  int
+	Codecs         VideoCodecs
+	MarkerSource   string   // Marker.Source of Markers
+	Markers        []Marker // replace MarkerSource's markers when non-empty
+	Tag            string   // a tag to add, created if missing
+	Sidecars       []Sidecar
+	ThumbnailPath  string
+}
+
 // VideoLabelColors maps color label names to hex values used by the UI.
 var VideoLabelColors = map[string]string{
 	"red":    "#dc2626",
@@ -126,8 +240,364 @@ func (v Video) FilePath() string {
 
 // Tag represents a label that can be applied to videos.
 type Tag struct {
+	ID        int64
+	Name      string
+	Color     string // a VideoLabelColors key; "" for none
+	SortOrder int    // chips are listed by SortOrder, then by name
+}
+
+// TagRating sums up the ratings of a tag's videos. Shows are tags too
+// ("show:NAME"), so this also rates shows.
+type TagRating struct {
+	Tag
+	Videos     int     // videos with the tag
+	Liked      int     // of which rated 1
+	Favourites int     // of which rated 2
+	Average    float64 // mean rating, 0–2, counting unrated videos as 0
+}
+
+// Sidecar kinds recorded by syncDir.
+const (
+	SidecarSubtitle = "subtitle" // .srt, .vtt
+	SidecarNFO      = "nfo"      // Kodi/Jellyfin style .nfo metadata
+	SidecarImage    = "image"    // artwork: .jpg, .jpeg, .png
+)
+
+// Sidecar is a companion file stored next to a video that shares its
+// basename, e.g. "film.en.srt" or "film.nfo" for "film.mkv".
+type Sidecar struct {
+	Kind string
+	Path string // absolute path
+}
+
+// Extra kinds. The sync records trailers and samples; the rest are linked
+// by hand.
+const (
+	ExtraTrailer        = "trailer"
+	ExtraSample         = "sample"
+	ExtraBehindTheScene = "behind the scenes"
+	ExtraDeletedScene   = "deleted scene"
+	ExtraFeaturette     = "featurette"
+	ExtraInterview      = "interview"
+	ExtraOther          = "other"
+)
+
+// ExtraKinds lists the extra kinds in the order they are offered.
+var ExtraKinds = []string{ExtraTrailer, ExtraBehindTheScene, ExtraDeletedScene,
+	ExtraFeaturette, ExtraInterview, ExtraSample, ExtraOther}
+
+// ExtraLink makes video VideoID an extra of video MainID or, when MainID is
+// 0, of every episode of show ShowName.
+type ExtraLink struct {
+	VideoID  int64
+	MainID   int64
+	ShowName string
+	Kind     string // one of ExtraKinds
+}
+
+// VideoExtra is bonus content listed under its main video or show rather
+// than as a library entry of its own.
+type VideoExtra struct {
+	Video
+	Kind string
+}
+
+// CompanionClip is a short clip belonging to the photo beside it, the
+// motion of a Live Photo or Motion Photo.
+type CompanionClip struct {
+	VideoID int64
+	Photo   string // the photo's path
+}
+
+// Show holds series-level details. Its episodes are the videos whose show
+// name (their "show:" tag) equals Name.
+type Show struct {
+	ID          int64
+	Name        string
+	Overview    string
+	PosterPath  string            // local poster image; empty when none
+	ExternalIDs map[string]string // keyed by provider, e.g. ExternalTMDB
+	Airing      ShowAiring
+}
+
+// ShowAiring is a show's broadcast schedule as last fetched.
+type ShowAiring struct {
+	Status   string      // e.g. "Running" or "Ended"; empty until fetched
+	Next     ShowEpisode // the next episode to air; Episode is 0 when none is scheduled
+	NextAirs time.Time   // when Next airs; zero when none is scheduled
+	Notified bool        // Next's airing has been announced
+}
+
+// ShowEpisode is one entry in a show's episode list from the metadata
+// provider, whether or not the library has it.
+type ShowEpisode struct {
+	Season  int
+	Episode int
+	Title   string
+	AirDate string // YYYY-MM-DD; empty when not announced
+}
+
+// WatchOrder is a named viewing order across shows, such as a crossover.
+type WatchOrder struct {
+	ID      int64
+	Name    string
+	Entries []WatchOrderEntry // in viewing order
+}
+
+// WatchOrderEntry names one episode in a WatchOrder.
+type WatchOrderEntry struct {
+	Show    string
+	Season  int
+	Episode int
+}
+
+// SmartPlaylist is a named library filter, such as unwatched comedies rated
+// at least liked, listed afresh each time it is opened. Query's Search,
+// TagIDs, AllTags, Type, DirectoryID, MinRating, Watched and Sort are
+// saved; its other fields are not.
+type SmartPlaylist struct {
+	ID    int64
+	Name  string
+	Query VideoQuery
+}
+
+// Archive policy actions.
+const (
+	ArchiveKeep  = "keep"  // never move or trash the videos
+	ArchiveMove  = "move"  // move them to another directory, such as cold storage
+	ArchiveTrash = "trash" // move them to the trash and out of the library
+)
+
+// ArchivePolicy says what becomes of videos left unwatched, such as
+// downloaded YouTube videos moved to cold storage after 180 days without a
+// play. It applies to videos with the tag and of the type; a zero TagID or
+// empty VideoType matches any.
+type ArchivePolicy struct {
+	ID          int64
+	Name        string
+	TagID       int64
+	VideoType   string
+	Action      string // ArchiveKeep, ArchiveMove or ArchiveTrash
+	Days        int    // days since a video was added or last played; unused by ArchiveKeep
+	DirectoryID int64  // where ArchiveMove puts the videos
+}
+
+// ArchiveProposal is a video a policy would move or trash, waiting for an
+// admin's approval.
+type ArchiveProposal struct {
+	VideoID    int64
+	PolicyID   int64
+	ProposedAt string // SQLite datetime, UTC
+	Dismissed  bool   // the admin chose to keep the video
+}
+
+// QualityPreset is a named cap on playback quality, such as "Phone over
+// LTE" at 720p and 2000 kbit/s. A zero field sets no cap.
+type QualityPreset struct {
+	ID        int64
+	Name      string
+	MaxHeight int // pixels
+	BitrateK  int // video kbit/s
+}
+
+// Notification kinds.
+const (
+	NotifyDownload = "download" // a yt-dlp download finished or failed
+	NotifyExport   = "export"   // a conversion or USB export finished or failed
+	NotifySync     = "sync"     // a library scan found new videos
+	NotifyReport   = "report"   // the nightly report
+	NotifyArchive  = "archive"  // archive policies proposed videos, or approved ones were moved
+	NotifyBudget   = "budget"   // a storage budget or cap was exceeded
+	NotifyAiring   = "airing"   // the next episode of a show has aired
+)
+
+// Event audiences: who may see an event.
+const (
+	AudienceUser     = "user"     // only Event.UserID
+	AudienceAdmins   = "admins"   // the shared viewer and admin accounts
+	AudienceEveryone = "everyone" // the shared viewer and every account
+)
+
+// Event is one entry in the server's activity log.
+type Event struct {
+	ID        int64
+	Kind      string // a Notify* kind
+	Message   string
+	VideoID   int64 // the video it concerns; 0 for none
+	Failed    bool  // the job it reports on failed
+	Audience  string
+	UserID    int64  // the viewer an AudienceUser event is for; 0 for the shared password or no sign-in
+	Payload   string // JSON for the kind's own webhook; "" for none
+	CreatedAt string
+}
+
+// EventQuery selects events for ListEvents.
+type EventQuery struct {
+	UserID  int64 // the viewer: events for everyone and for this viewer
+	Admin   bool  // also events for the admins
+	AfterID int64 // only events newer than this one
+	Limit   int
+}
+
+// Notification tells one viewer about a finished background job.
+type Notification struct {
+	ID        int64
+	UserID    int64 // 0 for the shared password or no sign-in
+	Kind      string
+	Message   string
+	VideoID   int64 // the video it concerns; 0 for none
+	CreatedAt string
+	Read      bool
+	Failed    bool // the job failed
+}
+
+// ReportSubscription is an account's opt-in to the nightly report.
+type ReportSubscription struct {
+	UserID   int64  // 0 for the shared password or no sign-in
+	Email    string // where the report is emailed; "" for the notification alone
+	LastSent string // SQLite datetime of the last report, UTC; "" before the first
+}
+
+// LibrarySnapshot is one directory's size on one day.
+type LibrarySnapshot struct {
+	Day         string // YYYY-MM-DD
+	DirectoryID int64
+	Videos      int
+	Bytes       int64
+}
+
+// LibraryTotals sums up the whole library.
+type LibraryTotals struct {
+	Videos    int
+	DurationS float64 // of the videos whose duration is known
+	Bytes     int64
+	Served    int64 // bytes streamed to viewers, all time
+}
+
+// VideoBytes is how many bytes of a video were streamed.
+type VideoBytes struct {
+	VideoID int64
+	Bytes   int64
+}
+
+// WatchCount is how many times a video was watched to the end.
+type WatchCount struct {
+	VideoID int64
+	Watches int
+}
+
+// WeekWatchTime is the watching done in one week: the videos watched to the
+// end and their running time.
+type WeekWatchTime struct {
+	Week    string // the week's Monday, YYYY-MM-DD
+	Watches int
+	Seconds float64
+}
+
+// VideoCodecs holds the ffprobe codec names of a video's first video and
+// audio streams, e.g. "h264" and "aac". Empty means unknown.
+type VideoCodecs struct {
+	Video string
+	Audio string
+	// AudioLanguages and SubtitleLanguages list the languages of the
+	// file's audio and subtitle streams in track order, comma-separated,
+	// with an empty entry for an untagged track or an image subtitle.
+	AudioLanguages    string
+	SubtitleLanguages string
+	DefaultAudio      int // the audio track that plays by default
+}
+
+// LanguagePrefs are an account's preferred track languages, comma-separated
+// in order of preference, e.g. "ja,en".
+type LanguagePrefs struct {
+	Audio     string
+	Subtitles string
+}
+
+// VideoSource records where a downloaded video came from.
+type VideoSource struct {
+	Extractor  string // yt-dlp extractor name, e.g. "youtube"
+	ID         string // the site's own video ID
+	URL        string // page the video was downloaded from
+	Uploader   string
+	UploadDate string // YYYY-MM-DD, or empty when unknown
+}
+
+// External ID providers, the services a video can have an identifier at.
+const (
+	ExternalTMDB    = "tmdb"    // TMDB API path, e.g. "movie/603" or "tv/1399/season/1/episode/2"
+	ExternalTVMaze  = "tvmaze"  // TVMaze episode ID
+	ExternalYouTube = "youtube" // YouTube video ID
+	ExternalIMDb    = "imdb"    // IMDb title ID, e.g. "tt0133093"
+)
+
+// ExternalProviders lists the known providers in display order.
+var ExternalProviders = []string{ExternalTMDB, ExternalTVMaze, ExternalYouTube, ExternalIMDb}
+
+// Marker kinds.
+const (
+	MarkerSkip    = "skip"    // players should jump from Start to End
+	MarkerChapter = "chapter" // a named section starting at Start
+	MarkerIntro   = "intro"   // opening titles players offer to skip
+	MarkerCredits = "credits" // end credits players offer to skip
+)
+
+// Marker is a time range within a video, such as a sponsor segment.
+type Marker struct {
+	Kind   string
+	Start  float64 // seconds
+	End    float64 // seconds
+	Label  string  // e.g. the SponsorBlock category "sponsor"
+	Source string  // who created the marker, e.g. "sponsorblock"
+}
+
+// Bookmark is a named position within a video, saved from the player.
+type Bookmark struct {
+	ID       int64
+	VideoID  int64
+	Position float64 // seconds
+	Label    string
+}
+
+// TagCount is a tag together with the number of videos carrying it.
+type TagCount struct {
+	Tag
+	Videos int
+}
+
+// Profile is a viewer profile selected per device. Its landing filter is
+// what the library shows when the app is opened.
+type Profile struct {
 	ID   int64
 	Name string
+	// LandingTagID filters the library to one tag on open; 0 shows everything.
+	LandingTagID int64
+	// LandingSort overrides the video_sort setting with one of the
+	// VideoQuery sorts; empty keeps the global setting.
+	LandingSort string
+	// DailyMinutes caps the profile's playback time per day; 0 means no
+	// limit.
+	DailyMinutes int
+}
+
+// ProfileDay is a profile's playback time on one day.
+type ProfileDay struct {
+	WatchedSeconds float64
+	GrantedSeconds float64 // extra time allowed by an admin for the day
+}
+
+// User roles.
+const (
+	RoleAdmin  = "admin"  // manages directories, settings, files and jobs
+	RoleViewer = "viewer" // browses, plays, rates and tags
+)
+
+// User is a named account that can sign in.
+type User struct {
+	ID        int64
+	Username  string
+	Role      string // RoleAdmin or RoleViewer
+	CreatedAt string
 }
 
 // WatchRecord holds the last playback position and timestamp for a video.
@@ -139,9 +609,13 @@ type WatchRecord struct {
 
 // Store is the backend-agnostic interface for all persistence operations.
 // Swap implementations (e.g. SQLite → Postgres) by providing a different Store.
+// Implementations report missing and clashing records with ErrNotFound,
+// ErrConflict and ErrForeignKey rather than their database's own errors.
 type Store interface {
 	// Directory management
 	AddDirectory(ctx context.Context, path string) (Directory, error)
+	// AddChildDirectory registers path as a subfolder entry of parentID.
+	AddChildDirectory(ctx context.Context, parentID int64, path string) (Directory, error)
 	GetDirectory(ctx context.Context, id int64) (Directory, error)
 	ListDirectories(ctx context.Context) ([]Directory, error)
 	DeleteDirectory(ctx context.Context, id int64) error
@@ -150,16 +624,55 @@ type Store interface {
 	// the deleted videos so the caller can remove them from disk.
 	DeleteDirectoryAndVideos(ctx context.Context, id int64) ([]string, error)
 	RenameDirectory(ctx context.Context, id int64, newPath string) error
+	// SetDirectoryExcludes replaces the directory's exclude patterns.
+	SetDirectoryExcludes(ctx context.Context, id int64, patterns []string) error
+	// SetDirectoryMaxDepth sets how deep syncDir descends; 0 = unlimited.
+	SetDirectoryMaxDepth(ctx context.Context, id int64, depth int) error
+	// SetDirectoryFollowSymlinks toggles whether syncDir follows symlinked folders.
+	SetDirectoryFollowSymlinks(ctx context.Context, id int64, follow bool) error
+	// SetDirectoryPruneEmpty toggles removing folders left empty below it.
+	SetDirectoryPruneEmpty(ctx context.Context, id int64, prune bool) error
+	// SetDirectoryLabel sets the display label; empty reverts to the folder name.
+	SetDirectoryLabel(ctx context.Context, id int64, label string) error
+	// SetDirectoryOffline records whether the directory's folder is reachable.
+	SetDirectoryOffline(ctx context.Context, id int64, offline bool) error
+	// SetDirectoryBudget sets the soft budget and hard cap in bytes; 0 clears.
+	SetDirectoryBudget(ctx context.Context, id int64, budget, capBytes int64) error
+	// SetDirectorySyncEvery sets how often the poller rescans it; 0 for
+	// every poll.
+	SetDirectorySyncEvery(ctx context.Context, id int64, every time.Duration) error
+	// SetDirectorySynced records when a scan of the directory started.
+	SetDirectorySynced(ctx context.Context, id int64, at time.Time) error
 
 	// Video management
 	UpsertVideo(ctx context.Context, dirID int64, dirPath string, filename string) (Video, error)
+	// UpsertVideos upserts many files in one transaction, which is far faster
+	// than one UpsertVideo each, and returns their videos in input order.
+	UpsertVideos(ctx context.Context, inputs []VideoInput) ([]Video, error)
+	// SaveVideoScans writes what a scan learned about many videos in one
+	// transaction.
+	SaveVideoScans(ctx context.Context, scans []VideoScan) error
 	ListVideos(ctx context.Context) ([]Video, error)
+	// ListVideosPage returns the page of videos q selects, in q's order,
+	// and how many videos it selects in all.
+	ListVideosPage(ctx context.Context, q VideoQuery) ([]Video, int, error)
 	CountVideos(ctx context.Context) (int, error)
 	ListVideosByTag(ctx context.Context, tagID int64) ([]Video, error)
 	ListVideosByDirectory(ctx context.Context, dirID int64) ([]Video, error)
 	GetVideo(ctx context.Context, id int64) (Video, error)
 	UpdateVideoName(ctx context.Context, id int64, name string) error
+	// SetVideoDescription records the description from the video's file
+	// metadata, which search covers.
+	SetVideoDescription(ctx context.Context, id int64, description string) error
+	// SetVideoRating sets the thumbs rating and the stars matching it: 4
+	// for liked, 5 for a favourite and none for neutral.
 	SetVideoRating(ctx context.Context, id int64, rating int) error
+	// SetVideoStars sets the star rating, 0 to 5, and the thumbs rating
+	// matching it: 4 stars is liked, 5 a favourite and fewer neutral.
+	SetVideoStars(ctx context.Context, id int64, stars int) error
+	// SetVideoFavorite marks or unmarks the video to watch again soon,
+	// leaving its rating alone.
+	SetVideoFavorite(ctx context.Context, id int64, favorite bool) error
 	UpdateVideoShowName(ctx context.Context, id int64, showName string) error
 	// UpdateVideoType sets the classification string; empty clears it.
 	UpdateVideoType(ctx context.Context, id int64, videoType string) error
@@ -167,11 +680,22 @@ type Store interface {
 	UpdateVideoPath(ctx context.Context, id, dirID int64, dirPath, filename string) error
 	UpdateVideoFields(ctx context.Context, id int64, f VideoFields) error
 	ListVideosByMinRating(ctx context.Context, minRating int) ([]Video, error)
+	// SearchVideos finds videos whose title, filename, tags, description,
+	// episode title or show overview contain query.
 	SearchVideos(ctx context.Context, query string) ([]Video, error)
 	ListVideosByType(ctx context.Context, videoType string) ([]Video, error)
 	ListVideosByRating(ctx context.Context) ([]Video, error)
 	ListVideosByShow(ctx context.Context, showName string) ([]Video, error)
-	GetRandomVideo(ctx context.Context) (Video, error)
+	// GetRandomVideo returns a random video outside offline directories,
+	// other than the excluded ones; with unwatched set, only one not yet
+	// watched.
+	GetRandomVideo(ctx context.Context, unwatched bool, exclude ...int64) (Video, error)
+	// GetRandomVideoFiltered is GetRandomVideo narrowed by f.
+	GetRandomVideoFiltered(ctx context.Context, f RandomFilter) (Video, error)
+	// ListUnwatchedPile returns up to limit videos never watched or started,
+	// oldest added first, leaving out extras and offline directories; with
+	// tagID non-zero, only videos carrying that tag.
+	ListUnwatchedPile(ctx context.Context, tagID int64, limit int) ([]Video, error)
 	GetNextUnwatched(ctx context.Context, tagID int64) (Video, error)
 	GetNextUnwatchedFromSearch(ctx context.Context, query string, tagID int64) (Video, error)
 	// Lite variants return only the id and title — much cheaper under DB contention.
@@ -184,6 +708,42 @@ type Store interface {
 	LoadSessions(ctx context.Context) (map[string]time.Time, error)
 	PruneExpiredSessions(ctx context.Context) error
 
+	// SetSessionUser ties a saved session to the account that signed in.
+	SetSessionUser(ctx context.Context, token string, userID int64) error
+	// LoadSessionUsers returns the account of each unexpired session that
+	// has one, keyed by token.
+	LoadSessionUsers(ctx context.Context) (map[string]int64, error)
+
+	// Users
+	// CreateUser adds an account; passwordHash is a bcrypt hash, or empty
+	// for accounts that cannot sign in with a password.
+	CreateUser(ctx context.Context, username, passwordHash, role string) (User, error)
+	GetUser(ctx context.Context, id int64) (User, error)
+	// GetUserByName looks an account up case-insensitively and also returns
+	// its password hash.
+	GetUserByName(ctx context.Context, username string) (User, string, error)
+	ListUsers(ctx context.Context) ([]User, error)
+	SetUserRole(ctx context.Context, id int64, role string) error
+	SetUserPassword(ctx context.Context, id int64, passwordHash string) error
+	DeleteUser(ctx context.Context, id int64) error
+
+	// Profiles
+	CreateProfile(ctx context.Context, name string) (Profile, error)
+	GetProfile(ctx context.Context, id int64) (Profile, error)
+	ListProfiles(ctx context.Context) ([]Profile, error)
+	// SetProfileLanding sets the profile's landing tag (0 = none) and sort.
+	SetProfileLanding(ctx context.Context, id, tagID int64, sort string) error
+	// SetProfileQuota sets the profile's daily allowance in minutes (0 = no
+	// limit).
+	SetProfileQuota(ctx context.Context, id int64, minutes int) error
+	// GetProfileDay returns the profile's playback time on day
+	// ("2006-01-02"); a day with none is zero.
+	GetProfileDay(ctx context.Context, id int64, day string) (ProfileDay, error)
+	// AddProfileWatchTime adds watched and granted seconds to the profile's
+	// day.
+	AddProfileWatchTime(ctx context.Context, id int64, day string, watched, granted float64) error
+	DeleteProfile(ctx context.Context, id int64) error
+
 	// Settings
 	GetSetting(ctx context.Context, key string) (string, error)
 	// SaveSettings atomically writes multiple key-value pairs in a single transaction.
@@ -192,17 +752,63 @@ type Store interface {
 	ListSettingsWithPrefix(ctx context.Context, prefix string) (map[string]string, error)
 
 	// Watch history
+	// RecordWatch saves the playback position and marks the video watched.
 	RecordWatch(ctx context.Context, videoID int64, position float64) error
+	// RecordProgress saves the playback position without marking the video
+	// watched; a video already watched stays so.
+	RecordProgress(ctx context.Context, videoID int64, position float64) error
 	ClearWatch(ctx context.Context, videoID int64) error
 	GetWatch(ctx context.Context, videoID int64) (WatchRecord, error)
 	ListWatchHistory(ctx context.Context) (map[int64]WatchRecord, error)
+	// ListInProgress returns up to limit watch records, most recent first,
+	// whose position is past minPosition but short of finishedAt (a fraction
+	// of the video's duration). Videos of unknown duration are included.
+	ListInProgress(ctx context.Context, minPosition, finishedAt float64, limit int) ([]WatchRecord, error)
 
 	// Tag management
 	UpsertTag(ctx context.Context, name string) (Tag, error)
+	GetTag(ctx context.Context, id int64) (Tag, error)
+	// ListTags returns every tag, ordered by sort order and name.
 	ListTags(ctx context.Context) ([]Tag, error)
+	// ListTagCounts returns every plain (non-namespaced) tag with the
+	// number of videos carrying it, ordered by sort order and name.
+	ListTagCounts(ctx context.Context) ([]TagCount, error)
+	// RenameTag gives a tag a new name; ErrConflict when another tag
+	// already has it.
+	RenameTag(ctx context.Context, id int64, name string) error
+	// DeleteTag removes a tag from every video and deletes it, with the
+	// archive policies picking videos by it. ErrNotFound when it is missing.
+	DeleteTag(ctx context.Context, id int64) error
+	// SetTagStyle sets a tag's color and sort order.
+	SetTagStyle(ctx context.Context, id int64, color string, sortOrder int) error
+	// CountTagVideos returns the number of videos carrying a tag.
+	CountTagVideos(ctx context.Context, id int64) (int, error)
+	// MergeTags moves the videos, recent uses, profile landings and archive
+	// policies of tag fromID onto intoID, then deletes fromID. A video carrying both keeps
+	// one intoID. ErrNotFound when either tag is missing.
+	MergeTags(ctx context.Context, fromID, intoID int64) error
 	TagVideo(ctx context.Context, videoID, tagID int64) error
 	UntagVideo(ctx context.Context, videoID, tagID int64) error
 	ListTagsByVideo(ctx context.Context, videoID int64) ([]Tag, error)
+	// ListTagsByVideos returns the tags of each given video in one query,
+	// keyed by video ID. Videos without tags are absent from the map.
+	ListTagsByVideos(ctx context.Context, videoIDs []int64) (map[int64][]Tag, error)
+	// ListTagRatings returns the rating summary of every tag in use,
+	// ordered by name.
+	ListTagRatings(ctx context.Context) ([]TagRating, error)
+	// SuggestTags returns up to limit plain (non-namespaced) tags whose name
+	// contains query, case-insensitively, most-used first.
+	SuggestTags(ctx context.Context, query string, limit int) ([]TagCount, error)
+	// BatchUpdateTags adds the named tags to and removes the given tag IDs
+	// from every listed video in a single transaction. It returns the added
+	// tags.
+	BatchUpdateTags(ctx context.Context, videoIDs []int64, add []string, remove []int64) ([]Tag, error)
+	// RecordTagUse marks a tag as just applied by hand by the given user
+	// (0 for the shared password or no sign-in).
+	RecordTagUse(ctx context.Context, userID, tagID int64) error
+	// ListRecentTags returns up to limit tags, most recently applied by the
+	// user first.
+	ListRecentTags(ctx context.Context, userID int64, limit int) ([]Tag, error)
 	// PruneOrphanTags removes tags that are no longer associated with any video.
 	PruneOrphanTags(ctx context.Context) error
 
@@ -219,4 +825,240 @@ type Store interface {
 
 	// Duration
 	UpdateVideoDuration(ctx context.Context, videoID int64, duration float64) error
+
+	// Resolution
+	UpdateVideoResolution(ctx context.Context, videoID int64, width, height int) error
+
+	// Library growth
+	// RecordLibrarySnapshot stores the current per-directory video counts
+	// and sizes under day, replacing any snapshot already taken that day.
+	RecordLibrarySnapshot(ctx context.Context, day string) error
+	// ListLibrarySnapshots returns snapshots from since (inclusive) onwards,
+	// ordered by day then directory.
+	ListLibrarySnapshots(ctx context.Context, since string) ([]LibrarySnapshot, error)
+	// DirectoryUsage returns the total file size of each directory's videos,
+	// keyed by directory ID.
+	DirectoryUsage(ctx context.Context) (map[int64]int64, error)
+
+	// Library statistics
+	// LibraryTotals counts the library's videos, running time and size.
+	LibraryTotals(ctx context.Context) (LibraryTotals, error)
+	// ListMostWatched returns the videos watched to the end most often, at
+	// most limit of them, most watched first.
+	ListMostWatched(ctx context.Context, limit int) ([]WatchCount, error)
+	// ListWeeklyWatchTime returns the watching done per week (Monday to
+	// Sunday, UTC) from the week holding since onwards, oldest first. Weeks
+	// without any are left out.
+	ListWeeklyWatchTime(ctx context.Context, since time.Time) ([]WeekWatchTime, error)
+	// AddBytesServed adds to the bytes streamed of each video in served,
+	// by video ID. Videos since removed are skipped.
+	AddBytesServed(ctx context.Context, served map[int64]int64) error
+	// ListMostServed returns the videos most streamed by bytes, at most
+	// limit of them, most first.
+	ListMostServed(ctx context.Context, limit int) ([]VideoBytes, error)
+
+	// Codecs
+	SetVideoCodecs(ctx context.Context, videoID int64, codecs VideoCodecs) error
+	// GetVideoCodecs returns a zero VideoCodecs for videos never probed.
+	GetVideoCodecs(ctx context.Context, videoID int64) (VideoCodecs, error)
+
+	// Track languages
+	// GetLanguagePrefs returns zero LanguagePrefs for a user who has set none.
+	// User 0 is the shared -password or no sign-in.
+	GetLanguagePrefs(ctx context.Context, userID int64) (LanguagePrefs, error)
+	SetLanguagePrefs(ctx context.Context, userID int64, p LanguagePrefs) error
+
+	// File change detection
+	// UpdateVideoFileStat records the file's size and modification time and
+	// reports whether they differ from the previously recorded ones (false
+	// the first time a video is recorded).
+	UpdateVideoFileStat(ctx context.Context, videoID int64, size int64, modTime time.Time) (changed bool, err error)
+
+	// Sidecars
+	// SetVideoSidecars replaces the video's recorded sidecar files.
+	SetVideoSidecars(ctx context.Context, videoID int64, sidecars []Sidecar) error
+	// ListVideoSidecars returns the video's sidecar files ordered by path.
+	ListVideoSidecars(ctx context.Context, videoID int64) ([]Sidecar, error)
+
+	// Extras
+	// SetDirectoryExtras replaces the sync's extra links of the videos in
+	// directory dirID with links. Links made by hand, and videos taken back
+	// into the library by hand, are kept.
+	SetDirectoryExtras(ctx context.Context, dirID int64, links []ExtraLink) error
+	// LinkExtra makes a video an extra by hand, replacing any link it had.
+	LinkExtra(ctx context.Context, link ExtraLink) error
+	// UnlinkExtra takes an extra back into the library for good.
+	// ErrNotFound when the video is not an extra.
+	UnlinkExtra(ctx context.Context, videoID int64) error
+	// GetExtraLink returns what a video is an extra of; ErrNotFound when
+	// it is not one.
+	GetExtraLink(ctx context.Context, videoID int64) (ExtraLink, error)
+	// ListVideoExtras returns the extras of video mainID ordered by filename.
+	ListVideoExtras(ctx context.Context, mainID int64) ([]VideoExtra, error)
+	// ListShowExtras returns the extras of show showName ordered by filename.
+	ListShowExtras(ctx context.Context, showName string) ([]VideoExtra, error)
+	// ListExtraVideoIDs returns the IDs of every video that is an extra.
+	ListExtraVideoIDs(ctx context.Context) (map[int64]bool, error)
+
+	// Photo companions
+	// SetDirectoryCompanions replaces the companion clips among the videos
+	// in directory dirID with clips.
+	SetDirectoryCompanions(ctx context.Context, dirID int64, clips []CompanionClip) error
+	// GetCompanionClip returns the photo a video belongs to; ErrNotFound
+	// when it is not a companion clip.
+	GetCompanionClip(ctx context.Context, videoID int64) (CompanionClip, error)
+	// ListCompanionVideoIDs returns the IDs of every companion clip.
+	ListCompanionVideoIDs(ctx context.Context) (map[int64]bool, error)
+
+	// Download source
+	SetVideoSource(ctx context.Context, videoID int64, src VideoSource) error
+	// GetVideoSource returns ErrNotFound for videos that were not downloaded.
+	GetVideoSource(ctx context.Context, videoID int64) (VideoSource, error)
+
+	// External IDs
+	// SetVideoExternalID records the video's ID at provider; an empty id
+	// removes it. SetVideoSource records a YouTube download's ID itself.
+	SetVideoExternalID(ctx context.Context, videoID int64, provider, id string) error
+	// ListVideoExternalIDs returns the video's IDs keyed by provider.
+	ListVideoExternalIDs(ctx context.Context, videoID int64) (map[string]string, error)
+	// FindVideoByExternalID returns the video with the given ID at provider,
+	// or ErrNotFound.
+	FindVideoByExternalID(ctx context.Context, provider, id string) (int64, error)
+
+	// Shows
+	// SaveShow creates or updates the show named show.Name. Empty Overview
+	// and PosterPath leave the stored ones unchanged, and ExternalIDs are
+	// merged into the show's existing IDs.
+	SaveShow(ctx context.Context, show Show) (Show, error)
+	// GetShow returns the show with the given name, or ErrNotFound.
+	GetShow(ctx context.Context, name string) (Show, error)
+	// ListShows returns every show ordered by name.
+	ListShows(ctx context.Context) ([]Show, error)
+	// SetShowAiring replaces the show's broadcast schedule.
+	SetShowAiring(ctx context.Context, showID int64, airing ShowAiring) error
+	// SetShowEpisodes replaces the show's episode list.
+	SetShowEpisodes(ctx context.Context, showID int64, episodes []ShowEpisode) error
+	// ListShowEpisodes returns the show's episode list ordered by season
+	// and episode.
+	ListShowEpisodes(ctx context.Context, showID int64) ([]ShowEpisode, error)
+
+	// Watch orders
+	// SaveWatchOrder creates the order named order.Name, or replaces the
+	// entries of the existing one.
+	SaveWatchOrder(ctx context.Context, order WatchOrder) (WatchOrder, error)
+	// GetWatchOrder returns the order with its entries, or ErrNotFound.
+	GetWatchOrder(ctx context.Context, id int64) (WatchOrder, error)
+	// ListWatchOrders returns every order, without entries, ordered by name.
+	ListWatchOrders(ctx context.Context) ([]WatchOrder, error)
+	// DeleteWatchOrder removes an order, or returns ErrNotFound.
+	DeleteWatchOrder(ctx context.Context, id int64) error
+
+	// Smart playlists
+	// SaveSmartPlaylist creates the playlist named p.Name, or replaces the
+	// filter of the existing one.
+	SaveSmartPlaylist(ctx context.Context, p SmartPlaylist) (SmartPlaylist, error)
+	// GetSmartPlaylist returns a playlist, or ErrNotFound.
+	GetSmartPlaylist(ctx context.Context, id int64) (SmartPlaylist, error)
+	// ListSmartPlaylists returns every playlist ordered by name.
+	ListSmartPlaylists(ctx context.Context) ([]SmartPlaylist, error)
+	// DeleteSmartPlaylist removes a playlist, or returns ErrNotFound.
+	DeleteSmartPlaylist(ctx context.Context, id int64) error
+
+	// Archive policies
+	// SaveArchivePolicy creates the policy named p.Name, or replaces the
+	// rest of the existing one.
+	SaveArchivePolicy(ctx context.Context, p ArchivePolicy) (ArchivePolicy, error)
+	// GetArchivePolicy returns a policy, or ErrNotFound.
+	GetArchivePolicy(ctx context.Context, id int64) (ArchivePolicy, error)
+	// ListArchivePolicies returns every policy ordered by name.
+	ListArchivePolicies(ctx context.Context) ([]ArchivePolicy, error)
+	// DeleteArchivePolicy removes a policy and its proposals, or returns
+	// ErrNotFound.
+	DeleteArchivePolicy(ctx context.Context, id int64) error
+	// ListIdleVideos returns the videos with tag tagID and of type
+	// videoType (0 and "" match any) neither added nor played since before,
+	// oldest first, leaving out extras and offline directories.
+	ListIdleVideos(ctx context.Context, tagID int64, videoType string, before time.Time) ([]Video, error)
+	// SetArchiveProposals makes proposed, the ID of the proposing policy by
+	// video ID, the archive proposals, new ones dated at. Proposals already
+	// recorded keep their date and dismissal; the rest are dropped.
+	SetArchiveProposals(ctx context.Context, proposed map[int64]int64, at time.Time) error
+	// ListArchiveProposals returns the proposals, dismissed ones included,
+	// oldest first.
+	ListArchiveProposals(ctx context.Context) ([]ArchiveProposal, error)
+	// GetArchiveProposal returns a video's proposal, or ErrNotFound.
+	GetArchiveProposal(ctx context.Context, videoID int64) (ArchiveProposal, error)
+	// DismissArchiveProposal keeps a proposed video where it is for as
+	// long as its policy picks it, or returns ErrNotFound.
+	DismissArchiveProposal(ctx context.Context, videoID int64) error
+	// DeleteArchiveProposal removes a video's proposal once it has been
+	// carried out, or returns ErrNotFound.
+	DeleteArchiveProposal(ctx context.Context, videoID int64) error
+
+	// Quality presets
+	CreateQualityPreset(ctx context.Context, p QualityPreset) (QualityPreset, error)
+	GetQualityPreset(ctx context.Context, id int64) (QualityPreset, error)
+	// ListQualityPresets returns every preset ordered by name.
+	ListQualityPresets(ctx context.Context) ([]QualityPreset, error)
+	DeleteQualityPreset(ctx context.Context, id int64) error
+
+	// Notifications
+	// AddNotification saves a notification, keeping the user's newest
+	// keep and deleting older ones.
+	AddNotification(ctx context.Context, n Notification, keep int) (Notification, error)
+	// ListNotifications returns up to limit of the user's notifications,
+	// newest first.
+	ListNotifications(ctx context.Context, userID int64, limit int) ([]Notification, error)
+	CountUnreadNotifications(ctx context.Context, userID int64) (int, error)
+	// MarkNotificationRead marks one of the user's notifications read, or
+	// returns ErrNotFound.
+	MarkNotificationRead(ctx context.Context, userID, id int64) error
+	MarkAllNotificationsRead(ctx context.Context, userID int64) error
+	// ListNotificationsSince returns the user's notifications created
+	// after since (a SQLite datetime, UTC), oldest first.
+	ListNotificationsSince(ctx context.Context, userID int64, since string) ([]Notification, error)
+
+	// Events
+	// AddEvent saves an event, keeping the newest keep and deleting older
+	// ones.
+	AddEvent(ctx context.Context, e Event, keep int) (Event, error)
+	// ListEvents returns up to q.Limit of the events q's viewer may see,
+	// newest first.
+	ListEvents(ctx context.Context, q EventQuery) ([]Event, error)
+
+	// Nightly report
+	// GetReportSubscription returns ErrNotFound when the user has not
+	// opted in.
+	GetReportSubscription(ctx context.Context, userID int64) (ReportSubscription, error)
+	// SetReportSubscription opts a user in, or updates the address of one
+	// who already is.
+	SetReportSubscription(ctx context.Context, userID int64, email string) error
+	DeleteReportSubscription(ctx context.Context, userID int64) error
+	ListReportSubscriptions(ctx context.Context) ([]ReportSubscription, error)
+	// MarkReportSent records when the user's report was last sent.
+	MarkReportSent(ctx context.Context, userID int64, sent string) error
+
+	// Markers
+	// SetVideoMarkers replaces the video's markers from the given source.
+	SetVideoMarkers(ctx context.Context, videoID int64, source string, markers []Marker) error
+	// ListVideoMarkers returns all of the video's markers ordered by start.
+	ListVideoMarkers(ctx context.Context, videoID int64) ([]Marker, error)
+
+	// Bookmarks
+	// AddBookmark saves a bookmark at position seconds into the video.
+	AddBookmark(ctx context.Context, videoID int64, position float64, label string) (Bookmark, error)
+	// ListBookmarks returns the video's bookmarks ordered by position.
+	ListBookmarks(ctx context.Context, videoID int64) ([]Bookmark, error)
+	// DeleteBookmark removes one of the video's bookmarks, or returns
+	// ErrNotFound when the video has no bookmark with that ID.
+	DeleteBookmark(ctx context.Context, videoID, bookmarkID int64) error
+
+	// Play queue
+	// SetPlayQueue replaces the shuffle queue with videoIDs, in play order.
+	SetPlayQueue(ctx context.Context, videoIDs []int64) error
+	// ListPlayQueue returns every video in the queue, played or not, in order.
+	ListPlayQueue(ctx context.Context) ([]int64, error)
+	// AdvancePlayQueue marks the first unplayed entry played and returns its
+	// video and how many remain unplayed; ErrNotFound when none are left.
+	AdvancePlayQueue(ctx context.Context) (videoID int64, remaining int, err error)
 }
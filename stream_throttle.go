@@ -0,0 +1,75 @@
+// stream_throttle.go – a per-connection bandwidth cap on file streams.
+//
+// With the "stream_limit_mbps" setting above 0, each response of
+// /video/{id}, /videos/{id}/prepared and the DLNA media route is paced to
+// that many megabits per second, so one client pulling a large file can't
+// take the whole link. Every connection gets the full limit; HTTP Range
+// requests are paced separately. Paced streams are copied through user
+// space rather than sent with sendfile (see streams.go).
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// streamLimitBytes returns the per-connection cap in bytes per second, or
+// 0 when streams are not limited.
+func (s *server) streamLimitBytes(ctx context.Context) float64 {
+	v, _ := s.store.GetSetting(ctx, "stream_limit_mbps")
+	mbps, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || mbps <= 0 {
+		return 0
+	}
+	return mbps * 1e6 / 8
+}
+
+// throttledWriter paces the body written through it to rate bytes per
+// second, averaged from the first write.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx   context.Context
+	rate  float64
+	start time.Time
+	sent  int64
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	written := 0
+	for len(p) > 0 {
+		n, err := t.ResponseWriter.Write(p[:min(len(p), throttleChunkBytes)])
+		written += n
+		t.sent += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		due := t.start.Add(time.Duration(float64(t.sent) / t.rate * float64(time.Second)))
+		if wait := time.Until(due); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-t.ctx.Done():
+				timer.Stop()
+				return written, t.ctx.Err()
+			}
+		}
+	}
+	return written, nil
+}
+
+// throttleStream paces the wrapped handler's response to the stream limit.
+func (s *server) throttleStream(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rate := s.streamLimitBytes(r.Context()); rate > 0 {
+			w = &throttledWriter{ResponseWriter: w, ctx: r.Context(), rate: rate}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
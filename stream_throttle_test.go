@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStreamLimit(t *testing.T) {
+	dir := t.TempDir()
+	body := bytes.Repeat([]byte("x"), 256<<10)
+	os.WriteFile(filepath.Join(dir, "film.mp4"), body, 0644) //nolint:errcheck
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "film.mp4")
+	get := func() time.Duration {
+		t.Helper()
+		start := time.Now()
+		rec := doAs(srv, nil, http.MethodGet, "/video/"+itoa(v.ID), nil)
+		if rec.Code != http.StatusOK || rec.Body.Len() != len(body) {
+			t.Fatalf("expected the whole file, got %d with %d bytes", rec.Code, rec.Body.Len())
+		}
+		return time.Since(start)
+	}
+
+	if took := get(); took > 200*time.Millisecond {
+		t.Errorf("unlimited stream took %v", took)
+	}
+	// 4 Mbit/s is 500 kB/s: the 224 KiB after the first chunk take ~0.45s.
+	srv.store.SaveSettings(ctx, map[string]string{"stream_limit_mbps": "4"}) //nolint:errcheck
+	if took := get(); took < 300*time.Millisecond {
+		t.Errorf("limited stream took only %v", took)
+	}
+}
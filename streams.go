@@ -0,0 +1,172 @@
+// streams.go – metering of video file streams.
+//
+// /video/{id}, /videos/{id}/prepared, /share/{id}/video and the DLNA media
+// route pass through meterStream, which does two things:
+//
+//   - It caps how many of these streams one device (one remote address) has
+//     open at once, answering 429 Too Many Requests past the cap, so a
+//     misbehaving player can't hold every connection. The cap is the
+//     "streams_per_client" setting, streamsPerClient when it is blank and
+//     no cap at 0. Behind a reverse proxy every viewer shares the proxy's
+//     address, so raise the cap or turn it off there.
+//   - It counts the bytes sent per video. The counts are kept in memory and
+//     added to the store every streamFlushEvery, and before the library
+//     statistics are read.
+//
+// Files are sent with http.ServeContent from the *os.File the local blob
+// storage opens, so the kernel copies them to the socket (sendfile). Every
+// wrapper on the way down, including the byte counter, passes ReadFrom
+// through to keep it that way; only a throttled stream (stream_throttle.go)
+// is copied through user space, which pacing needs.
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// countingWriter counts the body bytes written through it.
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ReadFrom hands src to the underlying writer's ReadFrom when it has one, so
+// a file still goes out with sendfile.
+func (c *countingWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := c.ResponseWriter.(io.ReaderFrom); ok {
+		n, err := rf.ReadFrom(src)
+		c.n += n
+		return n, err
+	}
+	// Hide ReadFrom from io.Copy, which would call it again.
+	return io.Copy(struct{ io.Writer }{c}, src)
+}
+
+// Unwrap lets http.ResponseController reach the connection's writer.
+func (c *countingWriter) Unwrap() http.ResponseWriter { return c.ResponseWriter }
+
+// streamsPerClientLimit returns how many streams one device may have open
+// at once, or 0 for no cap.
+func (s *server) streamsPerClientLimit(ctx context.Context) int {
+	v, _ := s.store.GetSetting(ctx, "streams_per_client")
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return streamsPerClient
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return streamsPerClient
+	}
+	return n
+}
+
+// streamClient names the device making r: its remote address without the
+// port.
+func streamClient(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// acquireStream takes one of client's limit stream slots, reporting false
+// when they are all taken. limit 0 means no cap.
+func (s *server) acquireStream(client string, limit int) bool {
+	s.streamMu.Lock()
+	defer s.streamMu.Unlock()
+	if limit > 0 && s.streamsOpen[client] >= limit {
+		return false
+	}
+	if s.streamsOpen == nil {
+		s.streamsOpen = make(map[string]int)
+	}
+	s.streamsOpen[client]++
+	return true
+}
+
+func (s *server) releaseStream(client string) {
+	s.streamMu.Lock()
+	defer s.streamMu.Unlock()
+	if s.streamsOpen[client]--; s.streamsOpen[client] <= 0 {
+		delete(s.streamsOpen, client)
+	}
+}
+
+// countBytesServed adds n bytes to video id's count in memory.
+func (s *server) countBytesServed(id, n int64) {
+	s.streamMu.Lock()
+	defer s.streamMu.Unlock()
+	if s.bytesServed == nil {
+		s.bytesServed = make(map[int64]int64)
+	}
+	s.bytesServed[id] += n
+}
+
+// flushBytesServed adds the counts kept in memory to the store. Counts that
+// could not be saved are kept for the next flush.
+func (s *server) flushBytesServed(ctx context.Context) {
+	s.streamMu.Lock()
+	served := s.bytesServed
+	s.bytesServed = nil
+	s.streamMu.Unlock()
+	if len(served) == 0 {
+		return
+	}
+	if err := retryBusy(func() error { return s.store.AddBytesServed(ctx, served) }); err != nil {
+		slog.Warn("save bytes served failed", "err", err)
+		for id, n := range served {
+			s.countBytesServed(id, n)
+		}
+	}
+}
+
+// startStreamMeter saves the bytes served every streamFlushEvery until ctx
+// is cancelled, and once more then.
+func (s *server) startStreamMeter(ctx context.Context) {
+	ticker := time.NewTicker(streamFlushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.flushBytesServed(context.Background())
+			return
+		case <-ticker.C:
+			s.flushBytesServed(ctx)
+		}
+	}
+}
+
+// meterStream caps the open streams per device and counts the bytes the
+// wrapped handler sends of video {id}.
+func (s *server) meterStream(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := streamClient(r)
+		if !s.acquireStream(client, s.streamsPerClientLimit(r.Context())) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many streams open from this device", http.StatusTooManyRequests)
+			return
+		}
+		defer s.releaseStream(client)
+		cw := &countingWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		if id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64); err == nil && cw.n > 0 {
+			s.countBytesServed(id, cw.n)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readerFromRecorder is a ResponseRecorder that notes whether its body was
+// handed over with ReadFrom, as a connection that can sendfile would be.
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func (r *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.readFrom = true
+	return io.Copy(r.ResponseRecorder, src)
+}
+
+func TestCountingWriter_KeepsReadFrom(t *testing.T) {
+	under := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	cw := &countingWriter{ResponseWriter: under}
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	os.WriteFile(path, []byte("0123456789"), 0644) //nolint:errcheck
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(cw, f); err != nil {
+		t.Fatal(err)
+	}
+	if !under.readFrom || cw.n != 10 {
+		t.Errorf("readFrom = %v, counted %d of 10 bytes", under.readFrom, cw.n)
+	}
+
+	// Without ReadFrom underneath, writes are still counted.
+	plain := &countingWriter{ResponseWriter: httptest.NewRecorder()}
+	if n, err := plain.ReadFrom(strings.NewReader("abc")); n != 3 || err != nil || plain.n != 3 {
+		t.Errorf("ReadFrom = %d, %v; counted %d", n, err, plain.n)
+	}
+}
+
+func TestMeterStream(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "clip.mp4"), []byte("0123456789abcdef"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "clip.mp4")
+
+	get := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/video/"+itoa(v.ID), nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		return rec
+	}
+	get("")
+	if rec := get("bytes=0-7"); rec.Code != http.StatusPartialContent {
+		t.Fatalf("range request: got %d", rec.Code)
+	}
+	var stats libraryStats
+	apiGet(t, srv, "/api/stats", &stats)
+	if stats.BytesServed != 24 || len(stats.MostStreamed) != 1 || stats.MostStreamed[0].ID != v.ID {
+		t.Errorf("bytes served = %d, most streamed %+v; want 24 bytes of the clip", stats.BytesServed, stats.MostStreamed)
+	}
+
+	// A device with every slot taken is turned away until one frees up.
+	srv.store.SaveSettings(ctx, map[string]string{"streams_per_client": "1"}) //nolint:errcheck
+	client := "192.0.2.1"                                                     // httptest's remote address
+	srv.acquireStream(client, 0)
+	rec := get("")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("over the cap: got %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	srv.releaseStream(client)
+	if rec := get(""); rec.Code != http.StatusOK {
+		t.Errorf("after the stream ended: got %d", rec.Code)
+	}
+	srv.store.SaveSettings(ctx, map[string]string{"streams_per_client": "0"}) //nolint:errcheck
+	srv.acquireStream(client, 0)
+	if rec := get(""); rec.Code != http.StatusOK {
+		t.Errorf("with no cap: got %d", rec.Code)
+	}
+	if len(srv.streamsOpen) != 1 {
+		t.Errorf("open streams = %v, want only the one held", srv.streamsOpen)
+	}
+}
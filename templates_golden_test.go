@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/internal/fixture"
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// update rewrites the golden files instead of comparing against them:
+//
+//	go test . -run TestTemplateGolden -update
+var update = flag.Bool("update", false, "rewrite testdata/golden from the current templates")
+
+// goldenCase renders one template, through a request to the routes where
+// one reaches it and otherwise by executing it on data.
+type goldenCase struct {
+	tmpl   string // the template rendered
+	name   string // the golden file's name when tmpl has several cases
+	method string // GET when empty
+	target string // {movie}, {episode}, {comedy}, {dir}, {tmp} and {share} are filled in
+	form   url.Values
+	// setup runs after the fixture library is seeded. tmp is an empty
+	// directory, written as {tmp} in the golden file.
+	setup func(t *testing.T, srv *server, lib fixture.Library, tmp string)
+	data  func(lib fixture.Library) any // used when target is empty
+}
+
+var goldenCases = []goldenCase{
+	{tmpl: "activity.html", target: "/activity", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		srv.notifyEveryone(store.NotifySync, "New in Movies: "+lib.Movie.Title(), lib.Movie.ID)
+		srv.notifyFailed(0, store.NotifyDownload, "Download failed: https://example.com/v: exit status 1", 0)
+	}},
+	{tmpl: "archive.html", target: "/archive", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		ctx := t.Context()
+		for _, p := range []store.ArchivePolicy{
+			{Name: "Comedy", TagID: lib.Comedy.ID, Action: store.ArchiveKeep},
+			{Name: "Old TV", VideoType: "TV", Action: store.ArchiveMove, Days: 180, DirectoryID: lib.Dir.ID},
+			{Name: "Old movies", VideoType: "Movie", Action: store.ArchiveTrash, Days: 365},
+		} {
+			saved, err := srv.store.SaveArchivePolicy(ctx, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Action == store.ArchiveTrash {
+				srv.store.SetArchiveProposals(ctx, map[int64]int64{lib.Episodes[1].ID: saved.ID, lib.Movie.ID: saved.ID}, time.Now()) //nolint:errcheck
+				srv.store.DismissArchiveProposal(ctx, lib.Movie.ID)                                                                   //nolint:errcheck
+			}
+		}
+	}},
+	{tmpl: "batch_tags.html", target: "/videos/batch-tags?ids={movie},{episode}"},
+	{tmpl: "bookmarks.html", target: "/videos/{movie}/bookmarks", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		if _, err := srv.store.AddBookmark(t.Context(), lib.Movie.ID, 754, "The chase"); err != nil {
+			t.Fatal(err)
+		}
+	}},
+	{tmpl: "color_label.html", method: http.MethodPost, target: "/videos/{episode}/color", form: url.Values{"color": {"blue"}}},
+	{tmpl: "continue_watching.html", target: "/videos/continue"},
+	{tmpl: "convert_progress.html", data: func(lib fixture.Library) any {
+		return struct {
+			JobID   string
+			VideoID int64
+			OutName string
+		}{"job-1", lib.Movie.ID, "Big Movie (2019).mp4"}
+	}},
+	{tmpl: "favorite_button.html", method: http.MethodPost, target: "/videos/{episode}/favorite", form: url.Values{"favorite": {"1"}}},
+	{tmpl: "favorites_row.html", target: "/videos/favorites", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		if err := srv.store.SetVideoFavorite(t.Context(), lib.Movie.ID, true); err != nil {
+			t.Fatal(err)
+		}
+	}},
+	{tmpl: "dir_browser.html", target: "/fs?path={tmp}", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		t.Setenv("HOME", tmp) // browsing stays inside the home directory
+		for _, dir := range []string{"Movies", "Shows"} {
+			if err := os.Mkdir(filepath.Join(tmp, dir), 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}},
+	{tmpl: "directories.html", target: "/directories"},
+	{tmpl: "directory_delete_confirm.html", target: "/directories/{dir}/delete-confirm"},
+	{tmpl: "directory_options.html", target: "/directories/options"},
+	{tmpl: "duplicates.html", target: "/duplicates"},
+	{tmpl: "extras_panel.html", target: "/videos/{movie}/extras"},
+	{tmpl: "file_metadata.html", target: "/videos/{movie}/metadata"},
+	{tmpl: "file_metadata_edit.html", target: "/videos/{movie}/metadata/edit"},
+	{tmpl: "filename_import.html", target: "/filename-import"},
+	{tmpl: "filename_import_preview.html", target: "/filename-import/preview", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		fixture.AddVideo(t, srv.store, lib.Dir, fixture.Video{Filename: "Beach day [5stars] (family) #summer.mp4"})
+	}},
+	{tmpl: "index.html", target: "/"},
+	{tmpl: "language_prefs.html", target: "/language-prefs"},
+	{tmpl: "login.html", target: "/login", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		srv.passwordHash = []byte("unused")
+	}},
+	{tmpl: "lookup_episodes.html", data: func(lib fixture.Library) any {
+		return struct {
+			VideoID  int64
+			TmdbID   string
+			Season   int
+			Episodes []tmdbEpisode
+		}{lib.Episodes[0].ID, "1396", 1, []tmdbEpisode{
+			{EpisodeNumber: 1, Name: "Pilot", AirDate: "2008-01-20", Overview: "It begins."},
+			{EpisodeNumber: 2, Name: "The Return", AirDate: "2008-01-27"},
+		}}
+	}},
+	{tmpl: "lookup_modal.html", target: "/videos/{episode}/lookup", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		if err := srv.store.SaveSettings(t.Context(), map[string]string{"tmdb_api_key": "key"}); err != nil {
+			t.Fatal(err)
+		}
+	}},
+	{tmpl: "lookup_results.html", data: func(lib fixture.Library) any {
+		return struct {
+			VideoID     int64
+			Results     []tmdbResult
+			HintSeason  int
+			HintEpisode int
+		}{lib.Episodes[0].ID, []tmdbResult{
+			{ID: 1396, MediaType: "tv", Name: "Alpha", Overview: "A show.", FirstAirDate: "2008-01-20"},
+			{ID: 603, MediaType: "movie", Title: "Big Movie", ReleaseDate: "2019-03-31"},
+		}, 1, 1}
+	}},
+	{tmpl: "maintenance.html", data: func(fixture.Library) any { return nil }},
+	{tmpl: "maintenance_toggle.html", target: "/maintenance"},
+	{tmpl: "notice.html", data: func(fixture.Library) any {
+		return struct {
+			OK      bool
+			Message string
+		}{true, "Saved <everything>"}
+	}},
+	{tmpl: "text.html", data: func(fixture.Library) any { return "3 unread" }},
+	{tmpl: "notifications.html", target: "/notifications", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		srv.notify(0, store.NotifySync, "2 new videos in /library", lib.Movie.ID)
+		srv.notifyFailed(0, store.NotifyDownload, "Download failed: example.com/clip", 0)
+	}},
+	{tmpl: "player.html", target: "/play/{movie}"},
+	{tmpl: "profiles.html", target: "/profiles", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		if _, err := srv.store.CreateProfile(t.Context(), "Kids"); err != nil {
+			t.Fatal(err)
+		}
+	}},
+	{tmpl: "quality_presets.html", target: "/quality-presets"},
+	{tmpl: "quick_label_modal.html", target: "/videos/{episode}/quick-label"},
+	{tmpl: "quota_used_up.html", data: func(fixture.Library) any {
+		return watchQuota{Profile: store.Profile{ID: 1, Name: "Kids", DailyMinutes: 60}, UsedMinutes: 61, AllowedMinutes: 60}
+	}},
+	{tmpl: "rating_buttons.html", method: http.MethodPost, target: "/videos/{episode}/rating", form: url.Values{"rating": {"1"}}},
+	{tmpl: "star_rating.html", method: http.MethodPost, target: "/videos/{episode}/stars", form: url.Values{"stars": {"3"}}},
+	{tmpl: "report_email.html", target: "/report/preview", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		srv.blobs = diskSpace{free: 2 << 30, total: 500 << 30}
+	}},
+	{tmpl: "report_prefs.html", target: "/report"},
+	{tmpl: "settings.html", target: "/settings"},
+	{tmpl: "smart_playlist_options.html", target: "/smart-playlists/options", setup: saveGoldenSmartPlaylist},
+	{tmpl: "smart_playlists.html", target: "/smart-playlists", setup: saveGoldenSmartPlaylist},
+	{tmpl: "share_page.html", target: "{share}", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		if err := srv.store.SaveSettings(t.Context(), map[string]string{"share_pages": "true"}); err != nil {
+			t.Fatal(err)
+		}
+	}},
+	{tmpl: "share_panel.html", target: "/videos/{movie}/share"},
+	{tmpl: "show_gaps.html", target: "/shows/missing?show=Alpha"},
+	{tmpl: "show_next.html", target: "/shows/next?show=Alpha"},
+	{tmpl: "stats.html", data: func(lib fixture.Library) any {
+		// Fixed weeks; the seeded watches would date the chart.
+		return buildStatsPanel(libraryStats{
+			Videos: 3, DurationS: 9000, Bytes: 3 << 30,
+			Directories: []statsDirectory{{ID: 1, Title: "Movies", Bytes: 2 << 30}, {ID: 2, Title: "Shows", Bytes: 1 << 30}},
+			MostWatched: []statsVideo{{ID: lib.Movie.ID, Title: lib.Movie.Title(), Watches: 3}},
+			WeeklyHours: []statsWeek{{Week: "2026-01-05", Watches: 2, Hours: 3}, {Week: "2026-01-12", Watches: 1, Hours: 1.5}},
+			BytesServed: 5 << 30, MostStreamed: []statsStreamed{{ID: lib.Movie.ID, Title: lib.Movie.Title(), Bytes: 5 << 30}},
+		})
+	}},
+	{tmpl: "stats_growth.html", target: "/stats/growth"},
+	{tmpl: "stats_ratings.html", target: "/stats/ratings"},
+	{tmpl: "tag_delete_confirm.html", target: "/tags/{comedy}/delete-confirm"},
+	{tmpl: "tag_suggest.html", target: "/tags/suggest?q=d"},
+	{tmpl: "tags.html", target: "/tags", setup: func(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+		// The chips are shuffled within a sort order; one each keeps them still.
+		tags, _ := srv.store.ListTags(t.Context())
+		for i, tag := range tags {
+			if err := srv.store.SetTagStyle(t.Context(), tag.ID, tag.Color, i); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}},
+	{tmpl: "tags_manage.html", target: "/tags/manage"},
+	{tmpl: "users.html", target: "/users"},
+	{tmpl: "video_delete_confirm.html", target: "/videos/{movie}/delete-confirm"},
+	{tmpl: "video_fields.html", target: "/videos/{episode}/fields"},
+	{tmpl: "video_fields_edit.html", target: "/videos/{episode}/fields/edit"},
+	{tmpl: "video_list.html", target: "/videos"},
+	{tmpl: "video_tags.html", target: "/videos/{movie}/tags"},
+	{tmpl: "video_type_badge.html", method: http.MethodPost, target: "/videos/{episode}/type", form: url.Values{"type": {"Concert"}}},
+	{tmpl: "watch_orders.html", target: "/watch-orders"},
+	{tmpl: "ytdlp_progress.html", data: func(fixture.Library) any {
+		return []ytdlpJobEntry{{JobID: "job-1", URL: "https://example.com/clip"}}
+	}},
+}
+
+// saveGoldenSmartPlaylist saves a smart playlist using every filter.
+func saveGoldenSmartPlaylist(t *testing.T, srv *server, lib fixture.Library, tmp string) {
+	if _, err := srv.store.SaveSmartPlaylist(t.Context(), store.SmartPlaylist{Name: "Funny favourites", Query: store.VideoQuery{
+		Search: "big", TagIDs: []int64{lib.Comedy.ID, lib.Drama.ID}, AllTags: true, Type: "Movie",
+		DirectoryID: lib.Dir.ID, MinRating: 2, Watched: "yes", Sort: "rating",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// goldenScrubs replace what changes from run to run: times, tokens and
+// signatures.
+var goldenScrubs = []struct {
+	re   *regexp.Regexp
+	with string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}(:\d{2})?(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<time>"},
+	{regexp.MustCompile(`\b(Mon|Tue|Wed|Thu|Fri|Sat|Sun) \d{1,2} [A-Z][a-z]{2} \d{2}:\d{2}\b`), "<time>"},
+	{regexp.MustCompile(`sig=[\w.-]+`), "sig=<sig>"},
+	{regexp.MustCompile(`\b[0-9a-f]{32,}\b`), "<token>"},
+}
+
+// TestTemplateGolden renders every template on the fixture library and
+// compares the HTML with testdata/golden. Run with -update to accept a
+// deliberate change, then review the diff.
+func TestTemplateGolden(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC // times render the same wherever the test runs
+	t.Cleanup(func() { time.Local = local })
+	for _, tc := range goldenCases {
+		name := tc.name
+		if name == "" {
+			name = strings.TrimSuffix(tc.tmpl, ".html")
+		}
+		t.Run(name, func(t *testing.T) {
+			srv := newTestServer(t)
+			lib := fixture.Seed(t, srv.store)
+			tmp := t.TempDir()
+			if tc.setup != nil {
+				tc.setup(t, srv, lib, tmp)
+			}
+			got := renderGolden(t, srv, lib, tmp, tc)
+			path := filepath.Join("testdata", "golden", name+".html")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s differs from %s; run with -update if the change is intended\n%s", tc.tmpl, path, lineDiff(string(want), string(got)))
+			}
+		})
+	}
+}
+
+// renderGolden renders tc and scrubs the result.
+func renderGolden(t *testing.T, srv *server, lib fixture.Library, tmp string, tc goldenCase) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if tc.target == "" {
+		if err := templates.ExecuteTemplate(&buf, tc.tmpl, tc.data(lib)); err != nil {
+			t.Fatalf("execute %s: %v", tc.tmpl, err)
+		}
+	} else {
+		method := tc.method
+		if method == "" {
+			method = http.MethodGet
+		}
+		target := strings.NewReplacer(
+			"{movie}", itoa(lib.Movie.ID),
+			"{episode}", itoa(lib.Episodes[0].ID),
+			"{comedy}", itoa(lib.Comedy.ID),
+			"{dir}", itoa(lib.Dir.ID),
+			"{tmp}", url.QueryEscape(tmp),
+			"{share}", srv.sharePageURL(lib.Movie.ID),
+		).Replace(tc.target)
+		rec := doAs(srv, nil, method, target, tc.form)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: got %d: %s", method, target, rec.Code, rec.Body.String())
+		}
+		buf = *rec.Body
+	}
+	out := buf.Bytes()
+	for _, dir := range [][2]string{{tmp, "{tmp}"}, {filepath.Dir(tmp), "{tmp}/.."}} {
+		out = bytes.ReplaceAll(out, []byte(dir[0]), []byte(dir[1]))
+		out = bytes.ReplaceAll(out, []byte(url.QueryEscape(dir[0])), []byte(url.QueryEscape(dir[1])))
+	}
+	for _, s := range goldenScrubs {
+		out = s.re.ReplaceAll(out, []byte(s.with))
+	}
+	return out
+}
+
+// lineDiff lists the first lines where got departs from want.
+func lineDiff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var b strings.Builder
+	shown := 0
+	for i := 0; i < max(len(w), len(g)) && shown < 10; i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			b.WriteString("line " + itoa(int64(i+1)) + ":\n- " + wl + "\n+ " + gl + "\n")
+			shown++
+		}
+	}
+	return b.String()
+}
+
+// TestTemplateGoldenCoversEveryTemplate keeps goldenCases in step with the
+// templates directory: a new template needs a case.
+func TestTemplateGoldenCoversEveryTemplate(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, tc := range goldenCases {
+		covered[tc.tmpl] = true
+	}
+	for _, tmpl := range templates.Templates() {
+		if name := tmpl.Name(); strings.HasSuffix(name, ".html") && !covered[name] {
+			t.Errorf("no golden case renders %s", name)
+		}
+	}
+}
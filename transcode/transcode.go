@@ -9,7 +9,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -246,6 +248,12 @@ func GenerateThumbnail(src, dst string, position float64) error {
 		}
 	}
 
+	return ExtractFrame(src, dst, seekSecs)
+}
+
+// ExtractFrame saves the frame at seekSecs (absolute, in seconds) of src as a
+// 320px-wide JPEG thumbnail at dst.
+func ExtractFrame(src, dst string, seekSecs float64) error {
 	args := []string{
 		"-ss", fmt.Sprintf("%.3f", seekSecs), // seek before -i for speed
 		"-i", src,
@@ -258,6 +266,278 @@ func GenerateThumbnail(src, dst string, position float64) error {
 	return run(context.Background(), args...)
 }
 
+// StreamOptions controls an on-the-fly stream produced by Stream.
+type StreamOptions struct {
+	// Remux copies the video and audio streams into the output container
+	// without re-encoding. Use when the codecs are playable but the
+	// container is not.
+	Remux bool
+	// MaxHeight caps the output height when transcoding; 0 = source height.
+	MaxHeight int
+	// MaxBitrateK caps the video bitrate when transcoding, in kbit/s; 0 =
+	// no cap.
+	MaxBitrateK int
+	// AudioTrack picks the source's audio stream, counting from 1; 0 leaves
+	// the choice to ffmpeg.
+	AudioTrack int
+}
+
+// mapArgs selects the first video stream and the chosen audio stream. With
+// no audio track chosen it returns nil and ffmpeg picks the streams itself.
+func mapArgs(audioTrack int) []string {
+	if audioTrack <= 0 {
+		return nil
+	}
+	return []string{"-map", "0:v:0", "-map", "0:a:" + strconv.Itoa(audioTrack-1)}
+}
+
+// StreamArgs builds the ffmpeg argument list for a fragmented-MP4 stream of
+// src written to stdout.
+func StreamArgs(src string, opts StreamOptions) []string {
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", src}
+	args = append(args, codecArgs(opts)...)
+	return append(args,
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
+		"-f", "mp4", "pipe:1",
+	)
+}
+
+// codecArgs maps the chosen streams and copies or re-encodes them to
+// H.264/AAC as opts says.
+func codecArgs(opts StreamOptions) []string {
+	args := mapArgs(opts.AudioTrack)
+	if opts.Remux {
+		return append(args, "-c:v", "copy", "-c:a", "copy")
+	}
+	args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-crf", "23")
+	args = append(args, bitrateArgs(opts.MaxBitrateK)...)
+	if opts.MaxHeight > 0 {
+		// -2 keeps the width even, which libx264 requires.
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", opts.MaxHeight))
+	}
+	return append(args, "-c:a", "aac", "-b:a", "160k")
+}
+
+// bitrateArgs caps libx264's CRF encode at kbps, with a two-second buffer.
+// It returns nil when kbps is 0.
+func bitrateArgs(kbps int) []string {
+	if kbps <= 0 {
+		return nil
+	}
+	return []string{"-maxrate", strconv.Itoa(kbps) + "k", "-bufsize", strconv.Itoa(2*kbps) + "k"}
+}
+
+// PrepareArgs builds the ffmpeg argument list for a browser-playable MP4
+// copy of src written to dst ahead of playback, encoded as Stream would.
+// The index goes at the front so playback and seeking start at once.
+func PrepareArgs(src, dst string, opts StreamOptions) []string {
+	args := []string{"-hide_banner", "-loglevel", "error", "-y", "-i", src, "-sn", "-dn"}
+	args = append(args, codecArgs(opts)...)
+	return append(args, "-movflags", "+faststart", "-f", "mp4", dst)
+}
+
+// Prepare writes the copy described by PrepareArgs. Cancelling ctx stops
+// ffmpeg and leaves dst incomplete.
+func Prepare(ctx context.Context, src, dst string, opts StreamOptions) error {
+	return run(ctx, PrepareArgs(src, dst, opts)...)
+}
+
+// Stream runs ffmpeg and copies a fragmented-MP4 rendition of src to w until
+// the source is exhausted or ctx is cancelled (e.g. the client disconnects).
+func Stream(ctx context.Context, src string, opts StreamOptions, w io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", StreamArgs(src, opts)...) //nolint:gosec
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w\nstderr: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// AudioOptions controls an audio-only stream produced by Audio.
+type AudioOptions struct {
+	// Format is the output codec and container: "aac" (ADTS) or "mp3".
+	Format string
+	// BitrateK is the output bitrate in kbit/s.
+	BitrateK int
+	// AudioTrack picks the source's audio stream, counting from 1; 0 leaves
+	// the choice to ffmpeg.
+	AudioTrack int
+	// StartSecs skips into the source before encoding.
+	StartSecs float64
+}
+
+// AudioArgs builds the ffmpeg argument list for an audio-only stream of src
+// written to stdout. Video and subtitles are dropped, so the encode is cheap.
+func AudioArgs(src string, opts AudioOptions) []string {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if opts.StartSecs > 0 {
+		args = append(args, "-ss", fmt.Sprintf("%.3f", opts.StartSecs))
+	}
+	args = append(args, "-i", src, "-vn", "-sn", "-dn")
+	if opts.AudioTrack > 0 {
+		args = append(args, "-map", "0:a:"+strconv.Itoa(opts.AudioTrack-1))
+	}
+	codec, format := "aac", "adts"
+	if opts.Format == "mp3" {
+		codec, format = "libmp3lame", "mp3"
+	}
+	return append(args,
+		"-c:a", codec, "-b:a", strconv.Itoa(opts.BitrateK)+"k",
+		"-f", format, "pipe:1",
+	)
+}
+
+// Audio runs ffmpeg and copies an audio-only rendition of src to w until the
+// source is exhausted or ctx is cancelled.
+func Audio(ctx context.Context, src string, opts AudioOptions, w io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", AudioArgs(src, opts)...) //nolint:gosec
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w\nstderr: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// HLSOptions controls an HLS transcode started by HLS.
+type HLSOptions struct {
+	StartSegment int     // index of the first segment to produce
+	SegmentSecs  float64 // target segment length; keyframes are forced on this grid
+	MaxHeight    int     // caps the output height; 0 = source height
+	MaxBitrateK  int     // caps the video bitrate in kbit/s; 0 = no cap
+	AudioTrack   int     // source audio stream, counting from 1; 0 = ffmpeg's choice
+}
+
+// HLSSegmentName is the file name of segment n inside an HLS output directory.
+func HLSSegmentName(n int) string {
+	return strconv.Itoa(n) + ".ts"
+}
+
+// HLSArgs builds the ffmpeg argument list that writes H.264/AAC MPEG-TS
+// segments of src into dir, starting at opts.StartSegment. The input is
+// seeked to StartSegment*SegmentSecs and output timestamps are offset by the
+// same amount, so segments from a restarted run line up with earlier ones.
+func HLSArgs(src, dir string, opts HLSOptions) []string {
+	start := float64(opts.StartSegment) * opts.SegmentSecs
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if start > 0 {
+		args = append(args, "-ss", fmt.Sprintf("%.3f", start)) // seek before -i for speed
+	}
+	args = append(args, "-i", src)
+	args = append(args, mapArgs(opts.AudioTrack)...)
+	args = append(args,
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%g)", opts.SegmentSecs),
+	)
+	args = append(args, bitrateArgs(opts.MaxBitrateK)...)
+	if opts.MaxHeight > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", opts.MaxHeight))
+	}
+	return append(args,
+		"-c:a", "aac", "-b:a", "160k",
+		"-output_ts_offset", fmt.Sprintf("%.3f", start),
+		"-f", "hls",
+		"-hls_time", fmt.Sprintf("%g", opts.SegmentSecs),
+		"-hls_list_size", "0",
+		// temp_file writes each segment under a temporary name and renames it
+		// when complete, so a segment file that exists is safe to serve.
+		"-hls_flags", "temp_file",
+		"-start_number", strconv.Itoa(opts.StartSegment),
+		"-hls_segment_filename", filepath.Join(dir, "%d.ts"),
+		filepath.Join(dir, "ffmpeg.m3u8"),
+	)
+}
+
+// HLS runs ffmpeg until every segment from opts.StartSegment to the end of
+// src has been written to dir, or ctx is cancelled.
+func HLS(ctx context.Context, src, dir string, opts HLSOptions) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", HLSArgs(src, dir, opts)...) //nolint:gosec
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w\nstderr: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// StoryboardOptions controls the sprite sheets written by Storyboard.
+type StoryboardOptions struct {
+	IntervalSecs float64 // one frame every IntervalSecs of video
+	TileWidth    int     // width of each frame; height keeps the aspect ratio
+	Columns      int     // frames per row of a sheet
+	Rows         int     // rows per sheet
+}
+
+// StoryboardSheetName is the file name of sprite sheet n inside a
+// storyboard directory.
+func StoryboardSheetName(n int) string {
+	return strconv.Itoa(n) + ".jpg"
+}
+
+// StoryboardArgs builds the ffmpeg argument list that tiles a frame every
+// opts.IntervalSecs of src into Columns×Rows JPEG sheets in dir, numbered
+// from 0. Only keyframes are decoded, which is far faster and close enough
+// for scrub previews.
+func StoryboardArgs(src, dir string, opts StoryboardOptions) []string {
+	return []string{
+		"-hide_banner", "-loglevel", "error",
+		"-skip_frame", "nokey",
+		"-i", src,
+		"-an", "-sn",
+		"-vf", fmt.Sprintf("fps=1/%g,scale=%d:-2,tile=%dx%d", opts.IntervalSecs, opts.TileWidth, opts.Columns, opts.Rows),
+		"-fps_mode", "vfr",
+		"-q:v", "5",
+		"-start_number", "0",
+		"-y",
+		filepath.Join(dir, "%d.jpg"),
+	}
+}
+
+// Storyboard writes the sprite sheets described by StoryboardArgs.
+func Storyboard(ctx context.Context, src, dir string, opts StoryboardOptions) error {
+	return run(ctx, StoryboardArgs(src, dir, opts)...)
+}
+
+// PreviewClipArgs builds the ffmpeg argument list that cuts segSecs of
+// video from src at each of starts, scales the pieces to width and joins
+// them into a silent H.264 MP4 at dst. Each piece is its own input seeked
+// before decoding, so only the parts used are read.
+func PreviewClipArgs(src, dst string, starts []float64, segSecs float64, width int) []string {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	var filter, joined strings.Builder
+	for i, start := range starts {
+		args = append(args, "-ss", fmt.Sprintf("%g", start), "-t", fmt.Sprintf("%g", segSecs), "-i", src)
+		fmt.Fprintf(&filter, "[%d:v:0]scale=%d:-2,setsar=1,fps=24[v%d];", i, width, i)
+		fmt.Fprintf(&joined, "[v%d]", i)
+	}
+	fmt.Fprintf(&filter, "%sconcat=n=%d:v=1:a=0[out]", joined.String(), len(starts))
+	return append(args,
+		"-filter_complex", filter.String(),
+		"-map", "[out]",
+		"-an", "-sn",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "30", "-pix_fmt", "yuv420p",
+		"-movflags", "+faststart",
+		"-y", dst,
+	)
+}
+
+// PreviewClip writes the clip described by PreviewClipArgs.
+func PreviewClip(ctx context.Context, src, dst string, starts []float64, segSecs float64, width int) error {
+	return run(ctx, PreviewClipArgs(src, dst, starts, segSecs, width)...)
+}
+
 // run executes ffmpeg with the given arguments and returns a combined
 // stderr message on failure.
 func run(ctx context.Context, args ...string) error {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -358,3 +359,125 @@ func TestDelogo_ProducesOutput(t *testing.T) {
 		t.Errorf("ffprobe on Delogo output failed: %v", err)
 	}
 }
+
+func TestStreamArgs_RemuxCopiesStreams(t *testing.T) {
+	args := StreamArgs("in.mkv", StreamOptions{Remux: true})
+	assertContainsSequence(t, args, "-c:v", "copy")
+	assertContainsSequence(t, args, "-c:a", "copy")
+	assertContainsSequence(t, args, "-f", "mp4")
+}
+
+func TestStreamArgs_TranscodeScalesToMaxHeight(t *testing.T) {
+	args := StreamArgs("in.mkv", StreamOptions{MaxHeight: 720})
+	assertContainsSequence(t, args, "-c:v", "libx264")
+	assertContainsSequence(t, args, "-vf", "scale=-2:'min(720,ih)'")
+}
+
+func TestHLSArgs_SeeksAndOffsetsToStartSegment(t *testing.T) {
+	args := HLSArgs("in.mkv", "/tmp/hls", HLSOptions{StartSegment: 10, SegmentSecs: 6})
+	assertContainsSequence(t, args, "-ss", "60.000")
+	assertContainsSequence(t, args, "-output_ts_offset", "60.000")
+	assertContainsSequence(t, args, "-start_number", "10")
+	assertContainsSequence(t, args, "-force_key_frames", "expr:gte(t,n_forced*6)")
+	assertContainsSequence(t, args, "-hls_segment_filename", "/tmp/hls/%d.ts")
+}
+
+func TestHLSArgs_NoSeekAtStart(t *testing.T) {
+	for _, a := range HLSArgs("in.mkv", "/tmp/hls", HLSOptions{SegmentSecs: 6}) {
+		if a == "-ss" {
+			t.Fatal("expected no -ss when starting at segment 0")
+		}
+	}
+}
+
+func TestStreamArgs_CapsBitrate(t *testing.T) {
+	args := StreamArgs("in.mkv", StreamOptions{MaxBitrateK: 2000})
+	assertContainsSequence(t, args, "-maxrate", "2000k")
+	assertContainsSequence(t, args, "-bufsize", "4000k")
+	args = HLSArgs("in.mkv", "/tmp/hls", HLSOptions{SegmentSecs: 6, MaxBitrateK: 2000})
+	assertContainsSequence(t, args, "-maxrate", "2000k")
+	for _, a := range StreamArgs("in.mkv", StreamOptions{Remux: true, MaxBitrateK: 2000}) {
+		if a == "-maxrate" {
+			t.Fatal("a remux copies the streams and cannot cap their bitrate")
+		}
+	}
+}
+
+func TestStreamArgs_MapsChosenAudioTrack(t *testing.T) {
+	args := StreamArgs("in.mkv", StreamOptions{Remux: true, AudioTrack: 2})
+	assertContainsSequence(t, args, "-map", "0:v:0")
+	assertContainsSequence(t, args, "-map", "0:a:1")
+	for _, a := range StreamArgs("in.mkv", StreamOptions{Remux: true}) {
+		if a == "-map" {
+			t.Fatal("expected no -map when no audio track is chosen")
+		}
+	}
+}
+
+func TestHLSArgs_MapsChosenAudioTrack(t *testing.T) {
+	args := HLSArgs("in.mkv", "/tmp/hls", HLSOptions{SegmentSecs: 6, AudioTrack: 1})
+	assertContainsSequence(t, args, "-map", "0:v:0")
+	assertContainsSequence(t, args, "-map", "0:a:0")
+}
+
+// --- StoryboardArgs ---
+
+func TestStoryboardArgs_TilesFramesAtInterval(t *testing.T) {
+	args := StoryboardArgs("in.mkv", "/tmp/sb", StoryboardOptions{IntervalSecs: 5, TileWidth: 160, Columns: 10, Rows: 10})
+	assertContainsSequence(t, args, "-skip_frame", "nokey")
+	assertContainsSequence(t, args, "-vf", "fps=1/5,scale=160:-2,tile=10x10")
+	assertContainsSequence(t, args, "-start_number", "0")
+	if last := args[len(args)-1]; last != filepath.Join("/tmp/sb", "%d.jpg") {
+		t.Errorf("output pattern = %q", last)
+	}
+	if StoryboardSheetName(3) != "3.jpg" {
+		t.Errorf("StoryboardSheetName(3) = %q", StoryboardSheetName(3))
+	}
+}
+
+// --- PreviewClipArgs ---
+
+func TestPrepareArgs_WritesFastStartFile(t *testing.T) {
+	args := PrepareArgs("in.mkv", "/tmp/out.part", StreamOptions{Remux: true})
+	assertContainsSequence(t, args, "-c:v", "copy")
+	assertContainsSequence(t, args, "-movflags", "+faststart")
+	assertContainsSequence(t, args, "mp4", "/tmp/out.part")
+	args = PrepareArgs("in.mkv", "/tmp/out.part", StreamOptions{})
+	assertContainsSequence(t, args, "-c:v", "libx264")
+	assertContainsSequence(t, args, "-c:a", "aac")
+}
+
+func TestPreviewClipArgs_JoinsSeekedSegments(t *testing.T) {
+	args := PreviewClipArgs("in.mkv", "/tmp/p.mp4", []float64{10, 70.5}, 3, 320)
+	assertContainsSequence(t, args, "-ss", "10")
+	assertContainsSequence(t, args, "-ss", "70.5")
+	assertContainsSequence(t, args, "-t", "3")
+	assertContainsSequence(t, args, "-i", "in.mkv")
+	assertContainsSequence(t, args, "-filter_complex",
+		"[0:v:0]scale=320:-2,setsar=1,fps=24[v0];[1:v:0]scale=320:-2,setsar=1,fps=24[v1];[v0][v1]concat=n=2:v=1:a=0[out]")
+	assertContainsSequence(t, args, "-map", "[out]")
+	if last := args[len(args)-1]; last != "/tmp/p.mp4" {
+		t.Errorf("output = %q", last)
+	}
+}
+
+// --- AudioArgs ---
+
+func TestAudioArgs_DropsVideo(t *testing.T) {
+	args := AudioArgs("in.mkv", AudioOptions{Format: "aac", BitrateK: 96})
+	assertContainsSequence(t, args, "-i", "in.mkv")
+	assertContainsSequence(t, args, "-c:a", "aac")
+	assertContainsSequence(t, args, "-b:a", "96k")
+	assertContainsSequence(t, args, "-f", "adts")
+	if !slices.Contains(args, "-vn") || slices.Contains(args, "-ss") || slices.Contains(args, "-map") {
+		t.Errorf("args %v: want -vn, no seek and no stream map", args)
+	}
+}
+
+func TestAudioArgs_MP3TrackAndSeek(t *testing.T) {
+	args := AudioArgs("in.mkv", AudioOptions{Format: "mp3", BitrateK: 128, AudioTrack: 2, StartSecs: 90})
+	assertContainsSequence(t, args, "-ss", "90.000")
+	assertContainsSequence(t, args, "-map", "0:a:1")
+	assertContainsSequence(t, args, "-c:a", "libmp3lame")
+	assertContainsSequence(t, args, "-f", "mp3")
+}
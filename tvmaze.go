@@ -0,0 +1,153 @@
+// tvmaze.go – upcoming episode air dates from TVMaze.
+//
+// TVMaze (https://www.tvmaze.com/api) publishes each show's status and next
+// scheduled episode. Shows with a TVMaze ID (recorded by TMDB lookups) are
+// refreshed every airingCheckEvery until TVMaze reports them ended; the next
+// episode is shown with the show, and its airing is published to everyone
+// as an event and, when airing_webhook_url is set, POSTed there as JSON.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+const (
+	tvmazeTimeout    = 10 * time.Second
+	airingCheckEvery = time.Hour
+	tvmazeEnded      = "Ended" // store.ShowAiring.Status of a finished show
+)
+
+var (
+	// tvmazeAPI is a variable so tests can point it at a fake server.
+	tvmazeAPI    = "https://api.tvmaze.com"
+	tvmazeClient = &http.Client{Timeout: tvmazeTimeout}
+)
+
+// fetchTVMazeAiring returns the status and next episode of TVMaze show id.
+func fetchTVMazeAiring(ctx context.Context, id string) (store.ShowAiring, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		tvmazeAPI+"/shows/"+url.PathEscape(id)+"?embed=nextepisode", nil)
+	if err != nil {
+		return store.ShowAiring{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := tvmazeClient.Do(req)
+	if err != nil {
+		return store.ShowAiring{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return store.ShowAiring{}, fmt.Errorf("TVMaze API error: %s", resp.Status)
+	}
+	var show struct {
+		Status   string `json:"status"`
+		Embedded struct {
+			Next *struct {
+				Season   int    `json:"season"`
+				Number   int    `json:"number"`
+				Name     string `json:"name"`
+				AirDate  string `json:"airdate"`
+				AirStamp string `json:"airstamp"`
+			} `json:"nextepisode"`
+		} `json:"_embedded"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return store.ShowAiring{}, err
+	}
+	out := store.ShowAiring{Status: show.Status}
+	if next := show.Embedded.Next; next != nil && next.Number > 0 {
+		airs, err := time.Parse(time.RFC3339, next.AirStamp)
+		if err != nil {
+			// Only the day is known; count it as airing at its start.
+			airs, err = time.ParseInLocation(time.DateOnly, next.AirDate, time.Local)
+		}
+		if err == nil {
+			out.Next = store.ShowEpisode{Season: next.Season, Episode: next.Number, Title: next.Name, AirDate: next.AirDate}
+			out.NextAirs = airs
+		}
+	}
+	return out, nil
+}
+
+// startAiringRefresher refreshes show schedules now and then every
+// airingCheckEvery until ctx is cancelled.
+func (s *server) startAiringRefresher(ctx context.Context) {
+	s.refreshAiring(ctx, time.Now())
+	ticker := time.NewTicker(airingCheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.refreshAiring(ctx, now)
+		}
+	}
+}
+
+// refreshAiring announces next episodes that have aired by now, then fetches
+// fresh schedules for shows that are still running. Announcing comes first
+// because a refresh after an airing moves the show on to the episode after.
+func (s *server) refreshAiring(ctx context.Context, now time.Time) {
+	if s.maintenance.Load() {
+		return
+	}
+	shows, err := s.store.ListShows(ctx)
+	if err != nil {
+		slog.Warn("airing refresh: list shows failed", "err", err)
+		return
+	}
+	for _, sh := range shows {
+		a := sh.Airing
+		if a.Next.Episode > 0 && !a.Notified && !a.NextAirs.After(now) {
+			s.announceAiring(ctx, sh)
+			a.Notified = true
+			if err := s.store.SetShowAiring(ctx, sh.ID, a); err != nil {
+				slog.Warn("airing refresh: save failed", "show", sh.Name, "err", err)
+			}
+		}
+		id := sh.ExternalIDs[store.ExternalTVMaze]
+		if id == "" || a.Status == tvmazeEnded {
+			continue
+		}
+		fresh, err := fetchTVMazeAiring(ctx, id)
+		if err != nil {
+			slog.Warn("airing refresh: TVMaze fetch failed", "show", sh.Name, "err", err)
+			continue
+		}
+		if fresh.Next.Season == a.Next.Season && fresh.Next.Episode == a.Next.Episode && fresh.NextAirs.Equal(a.NextAirs) {
+			fresh.Notified = a.Notified
+		}
+		if err := s.store.SetShowAiring(ctx, sh.ID, fresh); err != nil {
+			slog.Warn("airing refresh: save failed", "show", sh.Name, "err", err)
+		}
+	}
+}
+
+// announceAiring logs and publishes that sh's next episode has aired.
+func (s *server) announceAiring(ctx context.Context, sh store.Show) {
+	next := sh.Airing.Next
+	msg := fmt.Sprintf("%s S%02dE%02d has aired", sh.Name, next.Season, next.Episode)
+	if next.Title != "" {
+		msg = fmt.Sprintf("%s S%02dE%02d %q has aired", sh.Name, next.Season, next.Episode, next.Title)
+	}
+	slog.Info("episode aired", "show", sh.Name, "season", next.Season, "episode", next.Episode)
+	payload, _ := json.Marshal(struct {
+		Event   string    `json:"event"`
+		Show    string    `json:"show"`
+		Season  int       `json:"season"`
+		Episode int       `json:"episode"`
+		Title   string    `json:"title,omitempty"`
+		AiredAt time.Time `json:"aired_at"`
+		Message string    `json:"message"`
+	}{"episode_aired", sh.Name, next.Season, next.Episode, next.Title, sh.Airing.NextAirs, msg})
+	s.publish(ctx, store.Event{Kind: store.NotifyAiring, Message: msg, Audience: store.AudienceEveryone, Payload: string(payload)})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// fakeTVMaze points the TVMaze client at handler for one test.
+func fakeTVMaze(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	orig := tvmazeAPI
+	tvmazeAPI = ts.URL
+	t.Cleanup(func() { tvmazeAPI = orig })
+}
+
+func TestRefreshAiring(t *testing.T) {
+	airs := time.Date(2030, 5, 2, 1, 0, 0, 0, time.UTC)
+	next := `{"season":3,"number":4,"name":"The Return","airdate":"2030-05-01","airstamp":"` + airs.Format(time.RFC3339) + `"}`
+	fakeTVMaze(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/shows/169" || r.URL.Query().Get("embed") != "nextepisode" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"status":"Running","_embedded":{"nextepisode":` + next + `}}`)) //nolint:errcheck
+	})
+	var events []map[string]any
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e map[string]any
+		json.NewDecoder(r.Body).Decode(&e) //nolint:errcheck
+		events = append(events, e)
+	}))
+	defer hook.Close()
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	srv.store.SaveSettings(ctx, map[string]string{"airing_webhook_url": hook.URL})                                       //nolint:errcheck
+	srv.store.SaveShow(ctx, store.Show{Name: "Twin Peaks", ExternalIDs: map[string]string{store.ExternalTVMaze: "169"}}) //nolint:errcheck
+	srv.store.SaveShow(ctx, store.Show{Name: "No IDs"})                                                                  //nolint:errcheck
+
+	srv.refreshAiring(ctx, airs.Add(-48*time.Hour))
+	show, _ := srv.store.GetShow(ctx, "Twin Peaks")
+	if a := show.Airing; a.Status != "Running" || a.Next.Episode != 4 || !a.NextAirs.Equal(airs) || a.Notified {
+		t.Fatalf("unexpected airing: %+v", a)
+	}
+	if len(events) != 0 {
+		t.Fatalf("webhook sent before the episode aired: %v", events)
+	}
+
+	d, _ := srv.store.AddDirectory(ctx, "/videos")
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "s03e03.mp4")
+	srv.store.UpdateVideoShowName(ctx, v.ID, "Twin Peaks") //nolint:errcheck
+	var shows []apiShow
+	apiGet(t, srv, "/api/shows", &shows)
+	if len(shows) != 1 || shows[0].Status != "Running" || shows[0].NextEpisode == nil || shows[0].NextEpisode.Title != "The Return" {
+		t.Errorf("unexpected /api/shows: %+v", shows)
+	}
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/shows/next?show="+url.QueryEscape("Twin Peaks"), nil))
+	if !strings.Contains(rec.Body.String(), "S03E04 — The Return") {
+		t.Errorf("partial missing the next episode:\n%s", rec.Body.String())
+	}
+
+	// Once it has aired it is announced once, even though TVMaze still lists it.
+	srv.refreshAiring(ctx, airs.Add(time.Minute))
+	srv.refreshAiring(ctx, airs.Add(time.Hour))
+	if len(events) != 1 || events[0]["event"] != "episode_aired" || events[0]["episode"] != float64(4) {
+		t.Fatalf("expected one episode_aired event, got %v", events)
+	}
+
+	// A new next episode is announced in its turn.
+	next = `{"season":3,"number":5,"airdate":"2030-05-09","airstamp":"` + airs.Add(7*24*time.Hour).Format(time.RFC3339) + `"}`
+	srv.refreshAiring(ctx, airs.Add(2*time.Hour))
+	if show, _ = srv.store.GetShow(ctx, "Twin Peaks"); show.Airing.Next.Episode != 5 || show.Airing.Notified {
+		t.Errorf("expected episode 5 pending, got %+v", show.Airing)
+	}
+}
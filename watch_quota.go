@@ -0,0 +1,187 @@
+// watch_quota.go – daily watch-time allowance per profile.
+//
+// A profile with a daily allowance (e.g. 60 minutes for "Kids") has its
+// playback time counted per local day. The server keeps the time itself:
+// each sign of playback from the profile, a progress report or a stream
+// request, adds the time since the one before, at most quotaGapMax, so a
+// paused or closed player stops counting. Once the day's time is used up,
+// the player shows a friendly "that's all for today" page and the stream
+// endpoints refuse with 403 until midnight, unless an admin allows more
+// time for the day. Only an admin can switch a device away from a limited
+// profile (see handleSelectProfile).
+//
+// PUT  /profiles/{id}/quota        – set the daily allowance (form value minutes; 0 = no limit)
+// POST /profiles/{id}/quota/grant  – allow more time today (form value minutes)
+// GET  /api/quota                  – the device's profile's allowance and what is left today
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+// watchQuota is a profile's allowance and its use today.
+type watchQuota struct {
+	Profile     store.Profile
+	UsedMinutes int
+	// AllowedMinutes is the daily allowance plus any time granted today.
+	AllowedMinutes int
+}
+
+// Limited reports whether the profile has an allowance at all.
+func (q watchQuota) Limited() bool { return q.Profile.DailyMinutes > 0 }
+
+func (q watchQuota) RemainingMinutes() int { return max(q.AllowedMinutes-q.UsedMinutes, 0) }
+
+// UsedUp reports whether a limited profile has no time left today.
+func (q watchQuota) UsedUp() bool { return q.Limited() && q.UsedMinutes >= q.AllowedMinutes }
+
+// quotaDay is the local day playback time is counted under.
+func quotaDay(now time.Time) string { return now.Format("2006-01-02") }
+
+func (s *server) watchQuota(ctx context.Context, p store.Profile) (watchQuota, error) {
+	day, err := s.store.GetProfileDay(ctx, p.ID, quotaDay(time.Now()))
+	if err != nil {
+		return watchQuota{}, err
+	}
+	return watchQuota{
+		Profile:        p,
+		UsedMinutes:    int(day.WatchedSeconds / 60),
+		AllowedMinutes: p.DailyMinutes + int(day.GrantedSeconds/60),
+	}, nil
+}
+
+// quotaUsedUp reports whether the device's profile has used up today's
+// allowance. A failed lookup lets playback through.
+func (s *server) quotaUsedUp(r *http.Request) (watchQuota, bool) {
+	p, ok := s.activeProfile(r)
+	if !ok || p.DailyMinutes <= 0 {
+		return watchQuota{}, false
+	}
+	q, err := s.watchQuota(r.Context(), p)
+	if err != nil {
+		slog.Warn("watch quota lookup failed", "profile", p.ID, "err", err)
+		return watchQuota{}, false
+	}
+	return q, q.UsedUp()
+}
+
+// requireQuota refuses streams to a profile that has used up today's
+// allowance, and counts the ones it lets through as playback.
+func (s *server) requireQuota(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q, usedUp := s.quotaUsedUp(r)
+		if usedUp {
+			http.Error(w, "today's watch time for "+q.Profile.Name+" is used up", http.StatusForbidden)
+			return
+		}
+		if q.Limited() {
+			s.countWatchTime(r.Context(), q.Profile)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// countWatchTime adds the time since limited profile p last showed
+// playback, at most quotaGapMax, to its day. The first sign of playback
+// only starts the clock.
+func (s *server) countWatchTime(ctx context.Context, p store.Profile) {
+	if p.DailyMinutes <= 0 {
+		return
+	}
+	now := time.Now()
+	s.quotaMu.Lock()
+	last, seen := s.quotaSeen[p.ID]
+	if s.quotaSeen == nil {
+		s.quotaSeen = make(map[int64]time.Time)
+	}
+	s.quotaSeen[p.ID] = now
+	s.quotaMu.Unlock()
+	if !seen || !now.After(last) {
+		return
+	}
+	played := min(now.Sub(last), quotaGapMax).Seconds()
+	if err := s.store.AddProfileWatchTime(ctx, p.ID, quotaDay(now), played, 0); err != nil {
+		slog.Warn("count watch time failed", "profile", p.ID, "err", err)
+	}
+}
+
+// quotaMinutes reads the minutes form value.
+func quotaMinutes(w http.ResponseWriter, r *http.Request) (int, bool) {
+	n, err := strconv.Atoi(r.FormValue("minutes"))
+	if err != nil || n < 0 || n > 24*60 {
+		http.Error(w, "minutes must be from 0 to 1440", http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// PUT /profiles/{id}/quota
+func (s *server) handleSetProfileQuota(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	minutes, ok := quotaMinutes(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.SetProfileQuota(r.Context(), id, minutes); err != nil {
+		storeError(w, err)
+		return
+	}
+	active, _ := s.activeProfile(r)
+	s.renderProfiles(w, r, active.ID)
+}
+
+// POST /profiles/{id}/quota/grant
+func (s *server) handleGrantProfileTime(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r)
+	if !ok {
+		return
+	}
+	minutes, ok := quotaMinutes(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.store.GetProfile(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+	if err := s.store.AddProfileWatchTime(r.Context(), id, quotaDay(time.Now()), 0, float64(minutes*60)); err != nil {
+		storeError(w, err)
+		return
+	}
+	slog.Info("watch time granted", "profile", id, "minutes", minutes, "by", s.requestUser(r).Username)
+	active, _ := s.activeProfile(r)
+	s.renderProfiles(w, r, active.ID)
+}
+
+// GET /api/quota answers for the device's profile; limited is false when
+// there is no profile or it has no allowance.
+func (s *server) handleAPIQuota(w http.ResponseWriter, r *http.Request) {
+	out := struct {
+		ProfileID        int64 `json:"profile_id,omitempty"`
+		Limited          bool  `json:"limited"`
+		DailyMinutes     int   `json:"daily_minutes,omitempty"`
+		UsedMinutes      int   `json:"used_minutes"`
+		RemainingMinutes int   `json:"remaining_minutes"`
+	}{}
+	if p, ok := s.activeProfile(r); ok {
+		q, err := s.watchQuota(r.Context(), p)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+		out.ProfileID, out.Limited, out.DailyMinutes, out.UsedMinutes = p.ID, q.Limited(), p.DailyMinutes, q.UsedMinutes
+		if q.Limited() {
+			out.RemainingMinutes = q.RemainingMinutes()
+		}
+	}
+	writeJSON(w, out)
+}
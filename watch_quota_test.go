@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxgarvey/video_manger/store"
+)
+
+func TestWatchQuota(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	v, _ := srv.store.UpsertVideo(ctx, d.ID, d.Path, "cartoon.mp4")
+	p, _ := srv.store.CreateProfile(ctx, "Kids")
+	kids := profileCookieFor(p.ID)
+	play := "/play/" + itoa(v.ID)
+
+	if rec := doAs(srv, nil, http.MethodPut, "/profiles/"+itoa(p.ID)+"/quota", url.Values{"minutes": {"-5"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative allowance: expected 400, got %d", rec.Code)
+	}
+	if rec := doAs(srv, kids, http.MethodPut, "/profiles/"+itoa(p.ID)+"/quota", url.Values{"minutes": {"1"}}); rec.Code != http.StatusOK {
+		t.Fatalf("set allowance: got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The server counts the time between signs of playback itself; step
+	// the profile's last one back to stand for time passing. The time the
+	// player claims is ignored.
+	elapse := func(d time.Duration) {
+		srv.quotaMu.Lock()
+		srv.quotaSeen[p.ID] = srv.quotaSeen[p.ID].Add(-d)
+		srv.quotaMu.Unlock()
+	}
+	progress := url.Values{"position": {"40"}, "played": {"3600"}}
+	doAs(srv, kids, http.MethodPost, "/videos/"+itoa(v.ID)+"/progress", progress)
+	elapse(time.Hour) // a long pause counts no more than quotaGapMax
+	doAs(srv, kids, http.MethodGet, "/video/"+itoa(v.ID), nil)
+	for range 3 {
+		if body := doAs(srv, kids, http.MethodGet, play, nil).Body.String(); strings.Contains(body, "all for today") {
+			t.Fatal("player blocked before the allowance was used")
+		}
+		elapse(quotaGapMax)
+		doAs(srv, kids, http.MethodPost, "/videos/"+itoa(v.ID)+"/progress", progress)
+	}
+	// Without the profile the device is not limited.
+	doAs(srv, nil, http.MethodPost, "/videos/"+itoa(v.ID)+"/progress", progress)
+
+	if body := doAs(srv, kids, http.MethodGet, play, nil).Body.String(); !strings.Contains(body, "all for today, Kids") {
+		t.Errorf("player after the allowance: want the used-up page, got: %s", body)
+	}
+	if rec := doAs(srv, kids, http.MethodGet, "/video/"+itoa(v.ID), nil); rec.Code != http.StatusForbidden {
+		t.Errorf("stream after the allowance: expected 403, got %d", rec.Code)
+	}
+	if body := doAs(srv, nil, http.MethodGet, play, nil).Body.String(); strings.Contains(body, "all for today") {
+		t.Error("a device without the profile was blocked")
+	}
+	var quota struct {
+		Limited          bool `json:"limited"`
+		UsedMinutes      int  `json:"used_minutes"`
+		RemainingMinutes int  `json:"remaining_minutes"`
+	}
+	rec := doAs(srv, kids, http.MethodGet, "/api/quota", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &quota); err != nil {
+		t.Fatalf("decode /api/quota: %v", err)
+	}
+	if !quota.Limited || quota.UsedMinutes != 1 || quota.RemainingMinutes != 0 {
+		t.Errorf("/api/quota = %+v, want limited with 1 used and 0 left", quota)
+	}
+
+	// An admin allows more time today.
+	rec = doAs(srv, kids, http.MethodPost, "/profiles/"+itoa(p.ID)+"/quota/grant", url.Values{"minutes": {"30"}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "1 of 31 minutes") {
+		t.Fatalf("grant: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if body := doAs(srv, kids, http.MethodGet, play, nil).Body.String(); strings.Contains(body, "all for today") {
+		t.Error("player still blocked after more time was granted")
+	}
+}
+
+func TestWatchQuota_OnlyAdminLeavesLimitedProfile(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	addTestUser(t, srv, "root", "adminpass", store.RoleAdmin)
+	addTestUser(t, srv, "kid", "viewerpass", store.RoleViewer)
+	rootCookie := loginAs(t, srv, "root", "adminpass")
+	kidCookie := loginAs(t, srv, "kid", "viewerpass")
+	p, _ := srv.store.CreateProfile(ctx, "Kids")
+	other, _ := srv.store.CreateProfile(ctx, "Grown-ups")
+	onKids := func(r *http.Request) { r.AddCookie(profileCookieFor(p.ID)) }
+
+	for _, id := range []int64{0, other.ID} {
+		if rec := doAs(srv, kidCookie, http.MethodPost, "/profiles/active", url.Values{"profile_id": {itoa(id)}}, onKids); rec.Code != http.StatusOK {
+			t.Fatalf("viewer leaving an unlimited profile for %d: got %d", id, rec.Code)
+		}
+	}
+	srv.store.SetProfileQuota(ctx, p.ID, 60) //nolint:errcheck
+	for _, id := range []int64{0, other.ID} {
+		if rec := doAs(srv, kidCookie, http.MethodPost, "/profiles/active", url.Values{"profile_id": {itoa(id)}}, onKids); rec.Code != http.StatusForbidden {
+			t.Errorf("viewer leaving a limited profile for %d: expected 403, got %d", id, rec.Code)
+		}
+	}
+	if body := doAs(srv, kidCookie, http.MethodGet, "/profiles", nil, onKids).Body.String(); !strings.Contains(body, "Only an admin can switch") {
+		t.Error("profile picker not disabled for the viewer")
+	}
+	if rec := doAs(srv, rootCookie, http.MethodPost, "/profiles/active", url.Values{"profile_id": {"0"}}, onKids); rec.Code != http.StatusOK {
+		t.Errorf("admin leaving a limited profile: got %d", rec.Code)
+	}
+}
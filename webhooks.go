@@ -0,0 +1,47 @@
+// webhooks.go – JSON event notifications POSTed to user-configured URLs.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// webhookClient delivers webhook events. Callers such as scans wait on the
+// delivery, so a webhook that never answers is given up on after
+// webhookTimeout.
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// postWebhook POSTs payload to url as JSON.
+func postWebhook(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// validWebhookURL reports whether v is an absolute http(s) URL.
+func validWebhookURL(v string) bool {
+	u, err := url.Parse(v)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,96 @@
+// ytdlp_input.go – checks on what is handed to yt-dlp.
+//
+// yt-dlp accepts far more than web pages: file:// and other schemes, its own
+// options, and an output template that expands fields taken from the remote
+// site. Submitted URLs are therefore limited to http(s) pages of bounded
+// length, optionally on an allow-list of sites (the ytdlp_allowed_domains
+// setting). The output template escapes the target path so only the title
+// and extension fields are expanded, and the file yt-dlp reports is only
+// accepted from inside the download's staging folder.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/maxgarvey/video_manger/naming"
+)
+
+// parseDomainList splits a comma- or whitespace-separated list of domains,
+// lower-casing them and dropping a leading "*." or ".". It reports false if
+// an entry is not a bare host name.
+func parseDomainList(s string) ([]string, bool) {
+	var domains []string
+	for _, d := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		d = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(d), "*."), ".")
+		if d == "" || strings.ContainsAny(d, "/:@?#%") {
+			return nil, false
+		}
+		domains = append(domains, d)
+	}
+	return domains, true
+}
+
+// ytdlpAllowedDomains returns the sites downloads are restricted to; nil
+// means any site.
+func (s *server) ytdlpAllowedDomains(ctx context.Context) []string {
+	v, _ := s.store.GetSetting(ctx, "ytdlp_allowed_domains")
+	domains, _ := parseDomainList(v)
+	return domains
+}
+
+// validateYTDLPURL checks a URL before it is passed to yt-dlp: http or
+// https only (no file://, ftp:// or other schemes yt-dlp would fetch), at
+// most ytdlpMaxURLLen bytes, no whitespace or control characters, and — when
+// allowed is non-empty — a host that is one of the allowed domains or a
+// subdomain of one. The error is suitable to show to the user.
+func validateYTDLPURL(raw string, allowed []string) error {
+	if len(raw) > ytdlpMaxURLLen {
+		return fmt.Errorf("URL is longer than %d characters", ytdlpMaxURLLen)
+	}
+	if strings.IndexFunc(raw, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return errors.New("URL must not contain spaces or control characters")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New("only http:// and https:// URLs are permitted")
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return errors.New("URL has no host")
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, d := range allowed {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return nil
+		}
+	}
+	return fmt.Errorf("downloads from %s are not allowed", host)
+}
+
+// ytdlpOutputTemplate is the -o template for a download into dir. A "%" in
+// the path would start a template field, so it is escaped; the title is
+// capped at naming.MaxBytes so a long one cannot exceed file name limits.
+// yt-dlp itself replaces path separators in field values; promoteDownload
+// makes the rest of the name safe.
+func ytdlpOutputTemplate(dir string) string {
+	return filepath.Join(strings.ReplaceAll(dir, "%", "%%"), fmt.Sprintf("%%(title).%dB.%%(ext)s", naming.MaxBytes))
+}
+
+// stagedOutput returns the cleaned path of a file yt-dlp reported, provided
+// it lies directly inside the staging folder. Paths are parsed from yt-dlp's
+// output, which also echoes site-supplied text, so anything else is refused.
+func stagedOutput(staging, reported string) (string, bool) {
+	p := filepath.Clean(reported)
+	if filepath.Dir(p) != filepath.Clean(staging) {
+		return "", false
+	}
+	return p, true
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateYTDLPURL(t *testing.T) {
+	allowed := []string{"youtube.com", "vimeo.com"}
+	for _, c := range []struct {
+		raw     string
+		allowed []string
+		ok      bool
+	}{
+		{"https://example.com/v", nil, true},
+		{"http://example.com/v", nil, true},
+		{"file:///etc/passwd", nil, false},
+		{"-o/tmp/x", nil, false},
+		{"https:///no-host", nil, false},
+		{"https://example.com/a b", nil, false},
+		{"https://example.com/" + strings.Repeat("a", ytdlpMaxURLLen), nil, false},
+		{"https://www.youtube.com/watch?v=x", allowed, true},
+		{"https://youtube.com/watch?v=x", allowed, true},
+		{"https://VIMEO.com/1", allowed, true},
+		{"https://notyoutube.com/watch?v=x", allowed, false},
+		{"https://youtube.com.evil.example/x", allowed, false},
+	} {
+		if err := validateYTDLPURL(c.raw, c.allowed); (err == nil) != c.ok {
+			t.Errorf("validateYTDLPURL(%.40q) = %v, want ok=%v", c.raw, err, c.ok)
+		}
+	}
+}
+
+func TestParseDomainList(t *testing.T) {
+	got, ok := parseDomainList(" YouTube.com, *.vimeo.com\n.example.org ")
+	if !ok || strings.Join(got, ",") != "youtube.com,vimeo.com,example.org" {
+		t.Errorf("parseDomainList = %v, %v", got, ok)
+	}
+	for _, bad := range []string{"https://youtube.com", "youtube.com/watch", "host:8080"} {
+		if _, ok := parseDomainList(bad); ok {
+			t.Errorf("parseDomainList(%q): expected rejection", bad)
+		}
+	}
+}
+
+func TestYTDLPOutputTemplate_EscapesPath(t *testing.T) {
+	got := ytdlpOutputTemplate("/videos/100% docs/.vm_download_1")
+	if got != "/videos/100%% docs/.vm_download_1/%(title).200B.%(ext)s" {
+		t.Errorf("ytdlpOutputTemplate = %q", got)
+	}
+}
+
+func TestRunYTDLPJob_RejectsFileOutsideStaging(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "secret.mp4")
+	os.WriteFile(outside, []byte("private"), 0644) //nolint:errcheck
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho '[download] Destination: " + outside + "'\n"
+	os.WriteFile(filepath.Join(bin, "yt-dlp"), []byte(script), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	srv := newTestServer(t)
+	dir := t.TempDir()
+	d, _ := srv.store.AddDirectory(context.Background(), dir)
+	job := &ytdlpJob{ch: make(chan string, 64)}
+	srv.runYTDLPJob(job, d, "https://example.com/clip")
+	if job.err == nil || !strings.Contains(job.err.Error(), "outside the download folder") {
+		t.Fatalf("expected the reported path to be refused, got %v", job.err)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("expected the outside file to be left alone: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected nothing moved into the library, got %v", entries)
+	}
+}
+
+func TestHandleYTDLPDownload_DomainAllowList(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	d, _ := srv.store.AddDirectory(ctx, t.TempDir())
+	srv.store.SaveSettings(ctx, map[string]string{"ytdlp_allowed_domains": "youtube.com"}) //nolint:errcheck
+
+	form := url.Values{"urls": {"https://youtube.com/watch?v=1\nhttps://example.com/v"}, "dir_id": {itoa(d.ID)}}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/ytdlp/download", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "example.com are not allowed") {
+		t.Errorf("expected the off-list site to be refused, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleSaveSettings_YTDLPAllowedDomains(t *testing.T) {
+	srv := newTestServer(t)
+	post := func(domains string) *httptest.ResponseRecorder {
+		form := url.Values{"ytdlp_allowed_domains": {domains}}
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/settings", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		srv.routes().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := post("https://youtube.com"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a URL to be refused, got %d", rec.Code)
+	}
+	rec := post("YouTube.com vimeo.com")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if got, _ := srv.store.GetSetting(context.Background(), "ytdlp_allowed_domains"); got != "youtube.com,vimeo.com" {
+		t.Errorf("ytdlp_allowed_domains = %q", got)
+	}
+	if !strings.Contains(rec.Body.String(), `value="youtube.com, vimeo.com"`) {
+		t.Error("expected the saved sites in the re-rendered settings")
+	}
+}
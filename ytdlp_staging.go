@@ -0,0 +1,135 @@
+// ytdlp_staging.go – keeps unfinished yt-dlp downloads out of the library.
+//
+// yt-dlp writes .part files, per-format streams ("Title.f137.mp4") and
+// other fragments next to its output while it works, and leaves them behind
+// when a download fails. Downloads therefore run in a hidden staging folder
+// inside the target directory (same filesystem, so the final move is a
+// rename) and only the finished file is moved into the library. Fragments
+// are never imported by a scan, and ones left over from crashed or older
+// downloads are removed at startup.
+package main
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/maxgarvey/video_manger/naming"
+)
+
+// ytdlpStagingPrefix names the staging folders downloads run in.
+const ytdlpStagingPrefix = ".vm_download_"
+
+// ytdlpFormatFragment matches the per-format streams yt-dlp downloads
+// before merging them, e.g. "Title.f137.mp4" or "Title.f251.webm".
+var ytdlpFormatFragment = regexp.MustCompile(`\.f\d+\.[[:alnum:]]+$`)
+
+// isDownloadFragment reports whether a file name is an unfinished or
+// intermediate yt-dlp artefact rather than a playable download.
+func isDownloadFragment(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasSuffix(lower, ".part") || strings.HasSuffix(lower, ".ytdl") ||
+		strings.Contains(lower, ".part-frag") || ytdlpFormatFragment.MatchString(lower)
+}
+
+// isStagingDir reports whether a folder name is a download staging folder.
+func isStagingDir(name string) bool {
+	return strings.HasPrefix(name, ytdlpStagingPrefix)
+}
+
+// underStaging reports whether path (inside root) is a download fragment or
+// sits in a staging folder below root.
+func underStaging(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	segs := strings.Split(filepath.ToSlash(rel), "/")
+	for _, seg := range segs[:len(segs)-1] {
+		if isStagingDir(seg) {
+			return true
+		}
+	}
+	return isDownloadFragment(segs[len(segs)-1])
+}
+
+// newStagingDir creates a staging folder for one download inside dirPath.
+func newStagingDir(dirPath string) (string, error) {
+	return os.MkdirTemp(dirPath, ytdlpStagingPrefix+"*")
+}
+
+// promoteDownload moves a finished download from its staging folder into
+// dirPath under a name made safe by naming.Filename and returns its new
+// path. If the library already holds a file of that name the staged copy is
+// discarded and existed is true.
+func promoteDownload(stagedPath, dirPath string) (dest string, existed bool, err error) {
+	base := filepath.Base(stagedPath)
+	ext := filepath.Ext(base)
+	dest = filepath.Join(dirPath, naming.Filename(strings.TrimSuffix(base, ext), ext))
+	if _, err := os.Stat(dest); err == nil {
+		return dest, true, nil
+	}
+	if err := os.Rename(stagedPath, dest); err != nil {
+		return "", false, err
+	}
+	return dest, false, nil
+}
+
+// cleanDownloadLeftovers removes staging folders and download fragments
+// under root that have not been touched for downloadLeftoverAge, so files a
+// download or another program is still writing are left alone. Returns the
+// paths removed.
+func cleanDownloadLeftovers(root string, now time.Time) []string {
+	var removed []string
+	stale := func(de fs.DirEntry) bool {
+		info, err := de.Info()
+		return err == nil && now.Sub(info.ModTime()) > downloadLeftoverAge
+	}
+	filepath.WalkDir(root, func(path string, de fs.DirEntry, err error) error { //nolint:errcheck
+		if err != nil {
+			return nil
+		}
+		switch {
+		case de.IsDir() && path != root && isStagingDir(de.Name()):
+			if stale(de) {
+				if err := os.RemoveAll(path); err != nil {
+					slog.Warn("remove download staging folder failed", "path", path, "err", err)
+				} else {
+					removed = append(removed, path)
+				}
+			}
+			return filepath.SkipDir
+		case !de.IsDir() && isDownloadFragment(de.Name()) && stale(de):
+			if err := os.Remove(path); err != nil {
+				slog.Warn("remove download fragment failed", "path", path, "err", err)
+			} else {
+				removed = append(removed, path)
+			}
+		}
+		return nil
+	})
+	return removed
+}
+
+// cleanAllDownloadLeftovers runs cleanDownloadLeftovers over every online
+// library directory.
+func (s *server) cleanAllDownloadLeftovers(ctx context.Context) {
+	dirs, err := s.store.ListDirectories(ctx)
+	if err != nil {
+		slog.Warn("download cleanup: list directories failed", "err", err)
+		return
+	}
+	for _, d := range dirs {
+		if d.Offline {
+			continue
+		}
+		for _, p := range cleanDownloadLeftovers(d.Path, time.Now()) {
+			slog.Info("removed leftover download fragment", "path", p)
+		}
+	}
+}
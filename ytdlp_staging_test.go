@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsDownloadFragment(t *testing.T) {
+	cases := map[string]bool{
+		"Clip.mp4":                false,
+		"Clip.mp4.part":           true,
+		"Clip.f137.mp4":           true,
+		"Clip.f251.webm.part":     true,
+		"Clip.mp4.ytdl":           true,
+		"Clip.mp4.part-Frag12":    true,
+		"Season.1.Episode.2.mkv":  false,
+		"Interview.final.cut.mp4": false,
+	}
+	for name, want := range cases {
+		if got := isDownloadFragment(name); got != want {
+			t.Errorf("isDownloadFragment(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestCleanDownloadLeftovers(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	old := now.Add(-2 * downloadLeftoverAge)
+	write := func(rel string, mtime time.Time) string {
+		p := filepath.Join(root, rel)
+		os.MkdirAll(filepath.Dir(p), 0755) //nolint:errcheck
+		if err := os.WriteFile(p, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, mtime, mtime) //nolint:errcheck
+		return p
+	}
+	oldFrag := write("Old.f137.mp4", old)
+	freshFrag := write("Fresh.mp4.part", now)
+	keep := write("Keep.mp4", old)
+	write(ytdlpStagingPrefix+"abc/Crashed.mp4.part", old)
+	staging := filepath.Join(root, ytdlpStagingPrefix+"abc")
+	os.Chtimes(staging, old, old) //nolint:errcheck
+
+	removed := cleanDownloadLeftovers(root, now)
+	if len(removed) != 2 {
+		t.Errorf("expected the stale fragment and staging folder to be removed, got %v", removed)
+	}
+	for _, p := range []string{oldFrag, staging} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s should have been removed", p)
+		}
+	}
+	for _, p := range []string{freshFrag, keep} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s should have been kept: %v", p, err)
+		}
+	}
+}
+
+func TestPromoteDownload_MakesNameSafe(t *testing.T) {
+	lib := t.TempDir()
+	staging, _ := newStagingDir(lib)
+	staged := filepath.Join(staging, "Q&A: what's next?.mp4")
+	os.WriteFile(staged, []byte("video"), 0644) //nolint:errcheck
+
+	dest, existed, err := promoteDownload(staged, lib)
+	if err != nil || existed {
+		t.Fatalf("promoteDownload: %v (existed %v)", err, existed)
+	}
+	if want := filepath.Join(lib, "Q&A- what's next.mp4"); dest != want {
+		t.Errorf("dest = %q, want %q", dest, want)
+	}
+	if _, err := os.Stat(dest); err != nil {
+		t.Errorf("promoted file missing: %v", err)
+	}
+}
+
+func TestSyncDir_IgnoresDownloadFragments(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"Done.mp4", "Half.f137.mp4", ytdlpStagingPrefix + "x/Staged.mp4"} {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(p), 0755) //nolint:errcheck
+		os.WriteFile(p, []byte("x"), 0644) //nolint:errcheck
+	}
+	// With junk filtering off, hidden staging folders must still be skipped.
+	srv.store.SaveSettings(ctx, map[string]string{"skip_junk_files": "false"}) //nolint:errcheck
+	d, _ := srv.store.AddDirectory(ctx, dir)
+	srv.syncDir(d)
+
+	videos, _ := srv.store.ListVideos(ctx)
+	if len(videos) != 1 || videos[0].Filename != "Done.mp4" {
+		t.Errorf("expected only the finished download to be imported, got %+v", videos)
+	}
+}
+
+// writeYTDLPStub installs a yt-dlp that writes a format fragment into the
+// -o folder, then either fails or "merges" it into Clip.mp4.
+func writeYTDLPStub(t *testing.T, fail bool) {
+	t.Helper()
+	bin := t.TempDir()
+	finish := `printf video > "$out_dir/Clip.mp4"
+echo "[Merger] Merging formats into \"$out_dir/Clip.mp4\""`
+	if fail {
+		finish = "exit 1"
+	}
+	script := `#!/bin/sh
+while [ $# -gt 1 ]; do [ "$1" = "-o" ] && out="$2"; shift; done
+out_dir=$(dirname "$out")
+printf frag > "$out_dir/Clip.f137.mp4"
+` + finish + "\n"
+	os.WriteFile(filepath.Join(bin, "yt-dlp"), []byte(script), 0755) //nolint:errcheck
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRunYTDLPJob_FailureLeavesLibraryClean(t *testing.T) {
+	writeYTDLPStub(t, true)
+	srv := newTestServer(t)
+	dir := t.TempDir()
+	d, _ := srv.store.AddDirectory(context.Background(), dir)
+
+	job := &ytdlpJob{ch: make(chan string, 64)}
+	srv.runYTDLPJob(job, d, "https://example.com/clip")
+	if job.err == nil {
+		t.Fatal("expected the failed download to be reported")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected nothing left in the library folder, got %v", entries)
+	}
+}
+
+func TestRunYTDLPJob_MovesFinishedFileIntoLibrary(t *testing.T) {
+	writeYTDLPStub(t, false)
+	srv := newTestServer(t)
+	dir := t.TempDir()
+	d, _ := srv.store.AddDirectory(context.Background(), dir)
+
+	job := &ytdlpJob{ch: make(chan string, 64)}
+	srv.runYTDLPJob(job, d, "https://example.com/clip")
+	if job.err != nil {
+		t.Fatalf("download failed: %v", job.err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, ",") != "Clip.mp4" {
+		t.Errorf("expected only Clip.mp4 in the library folder, got %v", names)
+	}
+	v, err := srv.store.GetVideo(context.Background(), job.videoID)
+	if err != nil || v.Filename != "Clip.mp4" {
+		t.Errorf("expected the finished file to be registered, got %+v, %v", v, err)
+	}
+}